@@ -1,3 +1,3 @@
-module slot-cli
+module github.com/mauriciopiber/exceder/cli/slot-cli
 
 go 1.25.7
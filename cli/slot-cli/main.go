@@ -1,56 +1,284 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"mime"
 	"net"
+	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"regexp"
+	"runtime"
+	"runtime/debug"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
+
+	"github.com/mauriciopiber/exceder/cli/slot-cli/pkg/dbclone"
+	"github.com/mauriciopiber/exceder/cli/slot-cli/pkg/lifecycle"
+	"github.com/mauriciopiber/exceder/cli/slot-cli/pkg/ports"
+	"github.com/mauriciopiber/exceder/cli/slot-cli/pkg/procs"
+	"github.com/mauriciopiber/exceder/cli/slot-cli/pkg/registry"
+	"github.com/mauriciopiber/exceder/cli/slot-cli/pkg/remote"
+	"github.com/mauriciopiber/exceder/cli/slot-cli/pkg/secrets"
+	"github.com/mauriciopiber/exceder/cli/slot-cli/pkg/trash"
+	"github.com/mauriciopiber/exceder/cli/slot-cli/pkg/worktree"
+)
+
+// Build metadata, set with
+// go build -ldflags "-X main.version=v1.2.0 -X main.commit=$(git rev-parse --short HEAD) -X main.date=$(date -u +%FT%TZ)"
+var (
+	version = "dev"
+	commit  = ""
+	date    = ""
+)
+
+// Registry types live in pkg/registry
+type (
+	Registry      = registry.Registry
+	GroupConfig   = registry.GroupConfig
+	ProjectConfig = registry.ProjectConfig
+	SlotConfig    = registry.SlotConfig
+	SlotLink      = registry.SlotLink
+	AgentOptions  = registry.AgentOptions
+)
+
+// Deleted slots are kept by pkg/trash
+type (
+	UndoEntry  = trash.UndoEntry
+	TrashEntry = trash.Entry
+)
+
+// `slot-cli clean <name>` process scanners live in pkg/procs
+type (
+	ProcessScanner = procs.Scanner
+	ScannedProcess = procs.Scanned
 )
 
-type Registry struct {
-	Groups   map[string]GroupConfig   `json:"groups,omitempty"`
-	Projects map[string]ProjectConfig `json:"projects"`
-	Slots    map[string]SlotConfig    `json:"slots"`
+var registryPath = registry.DefaultPath()
+
+// homeDir returns the user's home directory (HOME, or USERPROFILE on Windows)
+func homeDir() string {
+	home, _ := os.UserHomeDir()
+	return home
 }
 
-type GroupConfig struct {
-	Name  string `json:"name"`
-	Order int    `json:"order"`
+// shellCommand runs a command line through the platform shell
+func shellCommand(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", command)
+	}
+	return exec.Command("sh", "-c", command)
 }
 
-type ProjectConfig struct {
-	BasePort int    `json:"base_port"`
-	Path     string `json:"path"`
-	Group    string `json:"group,omitempty"`
+// assumeYes answers every confirmation prompt (global --yes / -y)
+var assumeYes = false
+
+// jsonOutput selects machine-readable output (global --json): errors are
+// printed as a JSON envelope, and commands that support it print JSON
+var jsonOutput = false
+
+// useColor enables ANSI colors in output (global --color, NO_COLOR and
+// whether stdout is a terminal; see colorEnabled)
+var useColor = false
+
+// style is an ANSI color that text is painted in when useColor is set
+type style string
+
+const (
+	red     style = "31"
+	green   style = "32"
+	yellow  style = "33"
+	magenta style = "35"
+	cyan    style = "36"
+)
+
+func (s style) Sprint(text string) string {
+	if !useColor {
+		return text
+	}
+	return "\033[" + string(s) + "m" + text + "\033[0m"
+}
+
+func (s style) Sprintf(format string, args ...any) string {
+	return s.Sprint(fmt.Sprintf(format, args...))
+}
+
+// colorEnabled resolves --color: always and never win, otherwise (auto)
+// colors are used on a terminal unless NO_COLOR is set or TERM is dumb
+func colorEnabled(mode, noColor, term string, tty bool) (bool, error) {
+	switch mode {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "", "auto":
+		return tty && noColor == "" && term != "dumb", nil
+	}
+	return false, fmt.Errorf("invalid --color '%s' (never, always or auto)", mode)
+}
+
+// extractGlobalFlags removes --yes/-y, --json and --color[=]<mode> from the
+// command line, up to a "--" (anything after it belongs to the command given
+// to run/exec)
+func extractGlobalFlags(args []string) (rest []string, yes, jsonOut bool, color string) {
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; {
+		case arg == "--":
+			return append(rest, args[i:]...), yes, jsonOut, color
+		case arg == "--yes" || arg == "-y":
+			yes = true
+		case arg == "--json":
+			jsonOut = true
+		case strings.HasPrefix(arg, "--color="):
+			color = strings.TrimPrefix(arg, "--color=")
+		case arg == "--color" && i+1 < len(args):
+			color = args[i+1]
+			i++
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return rest, yes, jsonOut, color
+}
+
+// Exit codes, so scripts can branch on why a command failed
+const (
+	exitOK       = 0
+	exitError    = 1 // anything not covered below
+	exitUsage    = 2 // bad arguments, or run from the wrong place
+	exitDirty    = 3 // uncommitted or unpushed changes
+	exitLocked   = 4 // slot is locked
+	exitConflict = 5 // merge or rebase conflict
+	exitNotFound = 6 // slot, project, branch, session or database not found
+	exitAborted  = 7 // confirmation declined
+	exitExists   = 8 // slot or branch already exists
+	exitLimit    = 9 // project is at its max_slots
+)
+
+var exitReasons = map[int]string{
+	exitError:    "error",
+	exitUsage:    "usage",
+	exitDirty:    "dirty",
+	exitLocked:   "locked",
+	exitConflict: "conflict",
+	exitNotFound: "not_found",
+	exitAborted:  "aborted",
+	exitExists:   "exists",
+	exitLimit:    "limit",
+}
+
+// APIError describes a failure: exit code, its reason name, message, hints
+type APIError struct {
+	Code    int      `json:"code"`
+	Reason  string   `json:"reason"`
+	Message string   `json:"message"`
+	Hints   []string `json:"hints,omitempty"`
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// ErrorEnvelope is what a failing command prints with --json
+type ErrorEnvelope struct {
+	Error APIError `json:"error"`
+}
+
+func newErrorEnvelope(code int, message string, hints []string) ErrorEnvelope {
+	return ErrorEnvelope{Error: APIError{Code: code, Reason: exitReasons[code], Message: message, Hints: hints}}
+}
+
+// fail prints an error with follow-up hints and exits with code
+func fail(code int, message string, hints ...string) {
+	if jsonOutput {
+		data, _ := json.Marshal(newErrorEnvelope(code, message, hints))
+		fmt.Println(string(data))
+		os.Exit(code)
+	}
+
+	fmt.Printf("Error: %s\n", message)
+	for _, h := range hints {
+		fmt.Println(h)
+	}
+	os.Exit(code)
+}
+
+// confirm asks a yes/no question. --yes answers it; without a terminal to
+// ask on, the answer is no.
+func confirm(prompt string) bool {
+	if assumeYes {
+		return true
+	}
+	if !isTerminal(os.Stdin) {
+		fmt.Printf("%s [y/N] no (not a terminal; pass --yes to confirm)\n", prompt)
+		return false
+	}
+	fmt.Printf("%s [y/N] ", prompt)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		fmt.Println()
+	}
+	return isYes(answer)
 }
 
-type SlotConfig struct {
-	Project   string `json:"project"`
-	Number    int    `json:"number"`    // 0 for named slots
-	Name      string `json:"name"`      // empty for numbered slots
-	Branch    string `json:"branch"`
-	CreatedAt string `json:"created_at"`
-	Locked    bool   `json:"locked,omitempty"`
-	LockNote  string `json:"lock_note,omitempty"`
+// isTerminal reports whether f is attached to a terminal
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
 }
 
-var registryPath = filepath.Join(os.Getenv("HOME"), ".config", "slots", "registry.json")
+func isYes(answer string) bool {
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
 
 func main() {
+	dbclone.Run = auditedRun
+	dbclone.Record = func(action, target, detail string) {
+		recordAudit(AuditEntry{Action: action, Slot: target, Detail: detail})
+	}
+
 	if len(os.Args) < 2 {
 		printUsage()
 		os.Exit(0)
 	}
 
-	cmd := os.Args[1]
-	args := os.Args[2:]
+	var args []string
+	var color string
+	args, assumeYes, jsonOutput, color = extractGlobalFlags(os.Args[1:])
+	var err error
+	if useColor, err = colorEnabled(color, os.Getenv("NO_COLOR"), os.Getenv("TERM"), isTerminal(os.Stdout)); err != nil {
+		fail(exitUsage, err.Error())
+	}
+	if len(args) == 0 {
+		printUsage()
+		os.Exit(0)
+	}
+	cmd := args[0]
+	args = args[1:]
 
 	switch cmd {
 	case "new", "create":
@@ -58,19 +286,43 @@ func main() {
 	case "delete", "rm", "kill":
 		cmdDelete(args)
 	case "list", "ls", "":
-		cmdList()
+		cmdList(args)
+	case "status":
+		cmdList(append([]string{"--output", "table"}, args...))
 	case "start":
-		cmdStart()
+		cmdStart(args)
 	case "continue":
-		cmdContinue()
+		cmdContinue(args)
+	case "usage":
+		cmdUsage(args)
 	case "init":
 		cmdInit(args)
 	case "check":
 		cmdCheck(args)
+	case "info":
+		cmdInfo(args)
+	case "attach":
+		cmdAttach(args)
+	case "run":
+		cmdRun(args)
+	case "open":
+		cmdOpen(args)
+	case "exec":
+		cmdExec(args)
+	case "history":
+		cmdHistory(args)
+	case "undo":
+		cmdUndo(args)
+	case "undelete":
+		cmdUndelete(args)
+	case "describe":
+		cmdDescribe(args)
+	case "label":
+		cmdLabel(args)
 	case "sync":
 		cmdSync()
 	case "db-sync":
-		cmdDBSync()
+		cmdDBSync(args)
 	case "merge":
 		cmdMerge(args)
 	case "done":
@@ -83,25 +335,124 @@ func main() {
 		cmdUnlock(args)
 	case "group":
 		cmdGroup(args)
+	case "config":
+		cmdConfig(args)
 	case "clean":
-		if len(args) > 0 && args[0] == "claude" {
-			cmdCleanClaude(args[1:])
-		} else if len(args) > 0 && args[0] == "storybook" {
-			cmdCleanStorybook(args[1:])
-		} else if len(args) > 0 && args[0] == "web" {
-			cmdCleanWeb(args[1:])
+		var scanner ProcessScanner
+		isScanner := false
+		if len(args) > 0 {
+			scanner, isScanner = loadScanners()[args[0]]
+		}
+		if len(args) > 0 && (args[0] == "claude" || args[0] == "agents") {
+			cmdCleanAgents(args[1:])
 		} else if len(args) > 0 && args[0] == "docker" {
 			cmdCleanDocker(args[1:])
+		} else if len(args) > 0 && args[0] == "prs" {
+			cmdCleanPRs(args[1:])
+		} else if len(args) > 0 && args[0] == "artifacts" {
+			cmdCleanArtifacts(args[1:])
+		} else if isScanner {
+			cmdCleanScanner(args[0], scanner, args[1:])
 		} else {
 			cmdClean(args)
 		}
+	case "doctor":
+		cmdDoctor()
+	case "version", "--version", "-v":
+		cmdVersion()
+	case "self-update":
+		cmdSelfUpdate(args)
 	case "verify":
-		cmdVerify()
+		cmdVerify(args)
 	case "fix-ports":
-		cmdFixPorts()
+		cmdFixPorts(args)
+	case "provision":
+		cmdProvision(args)
+	case "env":
+		cmdEnv(args)
+	case "link":
+		cmdLink(args)
+	case "unlink":
+		cmdUnlink(args)
+	case "dns":
+		cmdDNS(args)
+	case "serve":
+		cmdServe(args)
+	case "watch":
+		cmdWatch(args)
+	case "daemon":
+		cmdDaemon(args)
+	case "du":
+		cmdDU(args)
+	case "logs":
+		cmdLogs(args)
+	case "health":
+		cmdHealth(args)
+	case "url":
+		cmdURL(args)
+	case "share":
+		cmdShare(args)
+	case "devcontainer":
+		cmdDevcontainer(args)
+	case "adopt":
+		cmdAdopt(args)
+	case "registry":
+		cmdRegistry(args)
 	default:
+		runPlugin(cmd, args)
 		printUsage()
+		fail(exitUsage, fmt.Sprintf("unknown command '%s'", cmd))
+	}
+}
+
+// isPluginName reports whether cmd can name a slot-<cmd> plugin (no paths or flags)
+func isPluginName(cmd string) bool {
+	return cmd != "" && !strings.HasPrefix(cmd, "-") && !strings.ContainsAny(cmd, `/\:`)
+}
+
+// pluginEnv is the slot context exported to plugins: registry and binary
+// paths, the project, and the current slot's name, path and ports
+func pluginEnv(cwd string) []string {
+	env := []string{"SLOT_REGISTRY=" + registryPath}
+	if exe, err := os.Executable(); err == nil {
+		env = append(env, "SLOT_CLI="+exe)
+	}
+	mainRepo, project := worktree.DetectProject(cwd)
+	if mainRepo == "" {
+		return env
+	}
+	env = append(env, "SLOT_PROJECT="+project, "SLOT_MAIN_REPO="+mainRepo)
+	if mainRepo != cwd {
+		env = append(env, slotEnv(filepath.Base(cwd), cwd)...)
+	}
+	return env
+}
+
+// runPlugin runs slot-<cmd> from PATH git-style, if there is one, and exits
+// with its status; it returns when no such plugin exists
+func runPlugin(cmd string, args []string) {
+	if !isPluginName(cmd) {
+		return
+	}
+	path, err := exec.LookPath("slot-" + cmd)
+	if err != nil {
+		return
+	}
+
+	cwd, _ := os.Getwd()
+	c := exec.Command(path, args...)
+	c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+	c.Env = append(os.Environ(), pluginEnv(cwd)...)
+	if jsonOutput {
+		c.Env = append(c.Env, "SLOT_JSON=1")
 	}
+	if err := c.Run(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			os.Exit(exitErr.ExitCode())
+		}
+		fail(exitError, fmt.Sprintf("plugin %s: %v", path, err))
+	}
+	os.Exit(exitOK)
 }
 
 func printUsage() {
@@ -109,42 +460,231 @@ func printUsage() {
 
 Commands:
   new [N|name]      Create slot (number or name, auto-increment if omitted)
-  delete <N|name>   Delete slot (use --force to skip confirmation)
+                    --services db,redis / --profile minimal to run a compose subset
+                    --with-redis to copy main's redis data (or set copy_redis on the project)
+                    --tmux to create a tmux session (agent/dev/logs) (or set tmux on the project)
+                    --no-clipboard to skip copying the cd command
+                    --provision=clone|hardlink|offline to reuse main's node_modules / the
+                    pnpm store instead of a fresh install (or set provision on the project)
+                    --no-copy/--no-docker/--no-db/--no-deps to skip heavy setup (see provision)
+                    --from origin/feature-x to check out an existing remote branch (tracking
+                    it; the slot is named after the branch unless N|name is given)
+                    --at v2.3.1|<sha> to branch off a tag or commit (--detach for no branch)
+                    --pr 456 to check out a GitHub PR (forks too) as slot pr-456 for review
+                    --issue 123 to name the branch after a GitHub issue (issue_branch on the
+                    project, default feat/{number}-{slug}); pr then links it with Closes
+                    --ignore-max-slots to create a slot beyond the project's max_slots
+                    --devcontainer to write .devcontainer/slot (or set devcontainer on the project)
+                    --shared-postgres for databases on main's postgres (app_slot3) instead of a
+                    container of its own (or set shared_postgres on the project); cloning
+                    disconnects main's sessions from its database, so it asks first (--yes skips)
+                    --host devbox1 to create the slot over ssh with slot-cli on that machine
+                    (project registered there too); list, info and delete follow it
+                    --stack <group> <name> to create slot <name> in every project of a group,
+                    api first, with frontend URLs pointing at the stack's ports
+                    (--link-ports 4000:4007,... reuses another slot's port mappings)
+                    --ttl 7d to mark the slot expired after 12h/7d/2w (see clean --expired)
+                    --timings to report how long each phase took (worktree add, file copy,
+                    port scan, env rewrite, docker up, db clone, deps install, ...)
+                    gitignored files are copied per .slotignore in main (globs, !include,
+                    max-size 5MB; default skips node_modules, build output, logs and >1MB)
+  delete <N|name>   Delete slots into the trash (several: delete 2 3 5; --force skips
+                    confirmation, --no-trash deletes outright, slot-cli undelete restores;
+                    --all-merged: every clean slot already in main; --project <p> --all)
   done              Merge current slot into main + cleanup (run from slot)
-  pr                Push and create PR for current slot
-  list              Show running Claude instances
-  start             Start Claude in current directory
-  continue          Continue Claude session
-  check [N]         Validate slot configuration
+                    --require-checks to refuse while the PR's CI is red (or set
+                    require_checks on the project)
+                    --message "<msg>" for the merge commit (default: merge_message on the
+                    project, with {slot} {branch} {main} {issue} {issue_url} {subject} {changelog})
+  pr                Push and create a PR (GitHub via gh, GitLab via glab or GITLAB_TOKEN,
+                    Bitbucket via BITBUCKET_TOKEN); the URL is saved to the slot
+                    --draft, --title "<title>", --body-file <path>,
+                    --reviewer a,b, --label x,y (default body: the project's pr_template)
+  pr status [N|name]
+                    PR state, review approvals and CI checks (GitHub, --json)
+  list              Show running agent instances and slots idle for 7+ days
+                    (--group <id> for one group's projects only, --label <l> for
+                    slots labeled so)
+                    --output table|wide|json|names (-o): one line per slot instead;
+                    --columns name,branch,agent,idle,labels,url,ports,pr,path,...;
+                    -q/--quiet: names only, for xargs and fzf
+  status            Slot table, same as list --output table (same flags)
+  start             Start the project's agent (default: claude) in current directory
+                    --resume: resume the session recorded for this slot
+                    --agent aider|codex|cursor-agent|shell|<custom> (or SLOT_AGENT)
+                    --permissions default|accept-edits|plan|skip (or SLOT_AGENT_PERMISSIONS,
+                    agent_options in config.json or the project; default: the agent asks)
+                    With a tmux_layout (init --tmux-layout) it opens the slot's tmux
+                    session instead; --no-layout to run in the foreground
+  continue          Continue the agent's last session
+  usage             Claude tokens/turns/estimated cost per slot (--since 7d, --json)
+  check [N]         Validate slot configuration: worktree, env ports vs the slot's
+                    offset, unique COMPOSE_PROJECT_NAME, container ports, node_modules
+                    (--json)
+  info [N|name]     Show everything known about a slot (--json for one machine-readable record)
+  attach [N|name]   Attach to the slot's tmux session (creates it if missing)
+  open [N|name]     Open the slot in your editor (--editor code|cursor|zed, --browser)
+  url [N|name]      Print the slot's web URL from its PORT (--storybook for STORYBOOK_PORT,
+                    --open to open it in the browser)
+  share [N|name]    Start a cloudflared/ngrok tunnel to the slot's PORT and print the
+                    public URL and a QR code (--tool ngrok, --no-qr, --stop);
+                    delete, done and clean stop it
+  devcontainer [N|name]
+                    Write .devcontainer/slot/devcontainer.json from main's config with
+                    the slot's ports forwarded and its compose project name
+  run [N|name] -- <cmd...>  Run a command in a slot with SLOT_NAME/SLOT_PATH/SLOT_*_PORT set
+  health [N|name]   Check the slot's URLs (project health_urls, default / and /api/health
+                    on its PORT): status and latency; --wait [--timeout 120s] to poll
+                    until healthy, e.g. after new (--json)
+  logs [N|name]     Tail the slot's docker compose logs and dev server output in one
+                    stream (--service web,db,storybook, -n 50, --no-follow)
+  exec -- <cmd...>  Run a command in every slot of the project and summarize exit codes
+                    --project <name> | --group <id> | --label <l> | --all (every
+                    project), --parallel
   verify            Verify slot matches parent worktree (1:1)
-  fix-ports         Fix slot ports to match parent + slot number
+                    --fix: update the registry entry to match the worktree (adds it if
+                    missing); --fix-worktree: switch the worktree to the registry's branch
+  doctor            Check required tools, docker and registry integrity, with fixes
+  version           Show version, commit and build date
+  self-update       Install the latest GitHub release (verified by checksum; --check
+                    to only compare, SLOT_RELEASE_REPO for forks, GITHUB_TOKEN if private)
+  adopt [path]      Register the project's existing worktrees named <project>-<N|name>
+                    as slots (--any for every worktree next to main, --dry-run)
+  fix-ports         Fix slot ports to match parent + slot number (named slots: the
+                    offset recorded at creation, or derived from their env)
+                    --dry-run to list each file:line that would change, --report to
+                    only check (exits 1 on drift, for CI and git hooks; --json)
+  provision         Run the setup steps skipped by new --no-* (run from slot;
+                    --all to redo every step, --no-* to skip some again)
+  env diff [slot]   Show .env keys that drifted from main (added, removed, changed;
+                    port and COMPOSE_PROJECT_NAME rewrites are ignored)
+  env sync [slot]   Re-copy main's gitignored files into the slot with its ports,
+                    after a preview (--dry-run to only preview)
+  link <consumer> <provider>
+                    Point the consumer slot's env URLs at the provider slot's ports
+                    (e.g. app-3's API_URL at api-5), recorded until unlink
+  unlink <consumer> [provider]
+                    Restore the URLs a link rewrote (all links without provider)
   sync              Rebase slot branch on main (pull latest changes)
-  db-sync           Clone database from main to current slot
+  db-sync           Clone databases (postgres, mysql, mongo) from main to current slot
+                    --volume: copy the data volume instead of dump/restore
+                    --schema-only: copy structure only, no rows
+                    --tables a,b: copy only these tables
+                    --exclude a,b: skip these tables' data (structure is kept)
+                    --jobs N: parallel pg_dump/pg_restore jobs (default: CPUs, max 4)
+                    --to-main | --to <N|name>: push this slot's DBs to main/another
+                    slot (backs up the target first; type its name to confirm or pass
+                    --confirm=<main|slot>, --yes only covers other slots)
   merge <N>         Merge slot branch into main (run from main)
-  lock [note]       Lock current slot (prevents deletion)
+  describe [N|name] "text"
+                    Say what a slot is for (--ticket ID, --assignee NAME, --clear);
+                    shown by list, info and watch
+  label add|rm <slot> <label...>
+                    Tag slots (e.g. spike, backend); list, clean and exec take
+                    --label spike to act only on them ("label ls" shows all)
+  lock [note]       Lock current slot against delete/clean/done/merge/db-sync (--for 3d
+                    expires it; --no-touch also blocks sync, fix-ports and env sync)
   unlock            Unlock current slot
   init [port]       Register current project (auto-detects port and group)
+                    --sqlite=db/app.db,... to copy SQLite files on new/db-sync
+                    --anonymize=db/anonymize.sql to run after every DB clone
+                    --migrate="<cmd>"|off to override migration auto-detection
+                    --agent=aider to use another agent for start/continue
+                    --provision=install|offline|clone|hardlink for node_modules
+                    --install=npm|yarn|poetry|...|off|"<cmd>" to override lockfile detection
+                    --pr-template=.github/slot_pr.md as the default body for slot-cli pr
+                    --issue-branch="fix/{number}-{slug}" for new --issue branch names
+                    --max-slots=5 to cap the project's slots (new --ignore-max-slots to exceed)
+                    --health=/,/api/health,http://localhost:{API_PORT}/ping for slot-cli health
+                    --devcontainer to generate a devcontainer config in every new slot
+                    --shared-postgres so slots get databases on main's postgres, not containers
+                    --agent-permissions=accept-edits|plan|skip for the project's agents
+                    --tmux-layout=.slot/tmux.json: windows/panes that start opens in a tmux
+                    session named after the slot, e.g. {"windows": [{"name": "dev",
+                    "panes": ["{agent}", "pnpm dev", "pnpm storybook", ""]}]}
+                    (column masks: "masks" in registry.json, e.g. "users.email": "md5(email)")
   group list        Show all groups and their projects
   group create      Create a group: group create <id> "<name>"
   group assign      Assign project to group: group assign <project> <group-id>
-  clean             Scan for stale worktrees and tmux sessions
-  clean claude      List/stop Claude instances (--orphans, --all)
+  group rename      Rename a group: group rename <id> "<name>" [--id <new-id>]
+  group delete      Delete a group: group delete <id> [--to <group-id>] (else ungrouped)
+  group order       Reorder groups: group order <id> <position>
+  history [slot]    Show the audit log of destructive operations (-n 50)
+  undo [slot]       Restore the last slot removed by done, clean or delete --no-trash
+                    (branch, worktree, changes; --list); trashed slots use undelete
+  undelete <slot>   Move a deleted slot back from the trash (--list); delete keeps
+                    slots there for trash_days (config, default 7), unless --no-trash
+  registry export   Print the registry as JSON (paths under ~ stay portable)
+  registry import <file>
+                    Replace the registry with an export (backed up to registry.json.bak)
+                    --merge to add it to this one, asking about entries both define
+                    differently (--ours/--theirs to pick a side for all)
+  config [show|bundle|pull|trust-hooks|editor|permissions]  Local settings and shared team
+                    config bundle (https or git; its hooks only run once trusted)
+                    (agent_options in config.json: binary, flags, env, permissions)
+  clean             Scan for stale worktrees and tmux sessions (--prs: unmerged
+                    branches whose PR was merged/closed on the forge are clean;
+                    --expired: slots past their --ttl are clean unless dirty/unpushed;
+                    --idle 14d: same for slots with no commits/agent/dev server that long;
+                    --group <id>: every slot of the group's projects, wherever they live;
+                    --label <l>: only slots labeled so (e.g. clean --label spike --do);
+                    --grace 2d: keep slots younger than that (default 24h, config clean_grace);
+                    -i/--interactive: check/uncheck worktrees, sessions, orphan
+                    containers and registry entries, then clean the selection;
+                    --json: scan report of safe/blocked/warning/orphan items with reasons)
+  clean prs         Remove slots whose PR was merged or closed (--do, --all projects)
+  clean artifacts [project]
+                    node_modules, .next, .turbo, dist and coverage in registered slots
+                    with sizes (--idle 14d for idle slots only); --do removes them
+  clean agents      List/stop agent instances (--orphans, --all; alias: clean claude)
   clean docker      List/stop docker containers (--orphans, --all)
+                    --volumes/--images: list what deleted slots left behind (by compose
+                    project label) and its size; --orphans removes it
   clean storybook   List/kill storybook processes (--orphans, --all)
   clean web         List/kill web servers (--orphans, --all)
+  clean <scanner>   Same for "scanners" in config.json, e.g. "puma": {"label": "puma servers",
+                    "process": "puma .*tcp://", "port_flag": ":(\\d+)", "port_env": "PORT"}
+                    (port_env unset: processes inside a project or slot are attached)
+  dns [list|sync|remove]  Manage *.slot.test entries (--dnsmasq, --dry-run); after
+                    dns sync, new and delete keep them current
+  watch             Live status of slots, agents, ports and docker (--interval 2s, --once,
+                    --group <id>)
+  daemon            Periodic hygiene scan: orphaned, expired and merged slots, port
+                    collisions, idle agents (--interval 15m, --idle 30m, --notify,
+                    --once); findings go to ~/.config/slots/daemon.json
+  daemon status     Show the daemon's last findings
+  du [project]      Disk usage per slot (tree, node_modules, docker volumes), largest
+                    first, with per-project totals
+  serve             REST API for the dashboard and other tools (--port 7777,
+                    --host 127.0.0.1, --token or SLOT_API_TOKEN for bearer auth; without
+                    one a token is generated and printed); browser-origin requests and
+                    non-JSON POSTs are refused
+  <name> [args]     Run a slot-<name> plugin from PATH with SLOT_REGISTRY, SLOT_CLI,
+                    SLOT_PROJECT, SLOT_MAIN_REPO and, in a slot, SLOT_NAME/PATH/*_PORT
 
 Options:
   --force, -f       Force operations without confirmation
-  --do              Execute clean (default is dry run)`)
+  --yes, -y         Answer yes to every confirmation prompt (for scripts and CI)
+  --tracked=MODE    How port rewrites treat tracked files (new, fix-ports):
+                    override (default), skip-worktree, allow
+  --do              Execute clean (default is dry run)
+  --dry-run         Show what new, delete, done and fix-ports would do
+  --json            Print errors as {"error": {"code", "reason", "message", "hints"}}
+  --color=WHEN      Color output: auto (default: only on a terminal, off when NO_COLOR
+                    is set), always or never
+
+Exit codes:
+  0 ok, 1 error, 2 usage, 3 dirty tree / unpushed commits, 4 locked,
+  5 merge/rebase conflict, 6 not found, 7 aborted, 8 already exists,
+  9 project at its max_slots`)
 }
 
 func cmdInit(args []string) {
 	cwd, _ := os.Getwd()
-	mainRepo, project := detectProject(cwd)
+	mainRepo, project := worktree.DetectProject(cwd)
 
 	if mainRepo == "" {
-		fmt.Println("Error: not in a git repository")
-		os.Exit(1)
+		fail(exitUsage, "not in a git repository")
 	}
 
 	// If running from a worktree, use the main repo
@@ -152,8 +692,14 @@ func cmdInit(args []string) {
 		fmt.Printf("Note: detected main repo at %s\n", mainRepo)
 	}
 
-	// Detect base port from .env files
-	basePort := readEnvPort(mainRepo, "PORT")
+	cfg := loadConfig()
+	template := cfg.Templates[project]
+
+	// Detect base port from template, then .env files
+	basePort := template.BasePort
+	if basePort == 0 {
+		basePort = readEnvPort(mainRepo, "PORT")
+	}
 	if basePort == 0 {
 		basePort = 3000 // default
 	}
@@ -184,25 +730,100 @@ func cmdInit(args []string) {
 		}
 	}
 	if groupID == "" {
-		groupID = detectGroupFromPath(mainRepo)
+		groupID = template.Group
+	}
+	if groupID == "" {
+		groupID = cfg.detectGroup(mainRepo)
 	}
 
-	// Ensure group exists
+	// Ensure group exists (shared config provides the display name/order)
 	if groupID != "" {
 		if _, ok := reg.Groups[groupID]; !ok {
-			reg.Groups[groupID] = GroupConfig{
-				Name:  titleCase(groupID),
-				Order: len(reg.Groups) + 1,
+			group, shared := cfg.Groups[groupID]
+			if !shared {
+				group = GroupConfig{
+					Name:  titleCase(groupID),
+					Order: len(reg.Groups) + 1,
+				}
 			}
-			fmt.Printf("Auto-created group: %s (%s)\n", titleCase(groupID), groupID)
+			reg.Groups[groupID] = group
+			fmt.Printf("Auto-created group: %s (%s)\n", group.Name, groupID)
+		}
+	}
+
+	var sqliteFiles []string
+	anonymizeScript := ""
+	migrate := ""
+	agent := ""
+	provision := ""
+	install := ""
+	prTemplate := ""
+	issueBranch := ""
+	maxSlots := 0
+	tmuxLayout := ""
+	agentPermissions := ""
+	var healthURLs []string
+	devcontainer := slices.Contains(args, "--devcontainer")
+	sharedPostgres := slices.Contains(args, "--shared-postgres")
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--sqlite=") {
+			sqliteFiles = splitList(strings.TrimPrefix(arg, "--sqlite="))
+		} else if strings.HasPrefix(arg, "--anonymize=") {
+			anonymizeScript = strings.TrimPrefix(arg, "--anonymize=")
+		} else if strings.HasPrefix(arg, "--migrate=") {
+			migrate = strings.TrimPrefix(arg, "--migrate=")
+		} else if strings.HasPrefix(arg, "--agent=") {
+			agent = strings.TrimPrefix(arg, "--agent=")
+		} else if strings.HasPrefix(arg, "--provision=") {
+			provision = parseProvisionMode(strings.TrimPrefix(arg, "--provision="))
+		} else if strings.HasPrefix(arg, "--install=") {
+			install = strings.TrimPrefix(arg, "--install=")
+		} else if strings.HasPrefix(arg, "--pr-template=") {
+			prTemplate = strings.TrimPrefix(arg, "--pr-template=")
+		} else if strings.HasPrefix(arg, "--issue-branch=") {
+			issueBranch = strings.TrimPrefix(arg, "--issue-branch=")
+		} else if strings.HasPrefix(arg, "--health=") {
+			healthURLs = splitList(strings.TrimPrefix(arg, "--health="))
+		} else if strings.HasPrefix(arg, "--agent-permissions=") {
+			agentPermissions = strings.TrimPrefix(arg, "--agent-permissions=")
+		} else if strings.HasPrefix(arg, "--tmux-layout=") {
+			tmuxLayout = strings.TrimPrefix(arg, "--tmux-layout=")
+			data, err := os.ReadFile(filepath.Join(mainRepo, tmuxLayout))
+			if err == nil {
+				_, err = parseTmuxLayout(data)
+			}
+			if err != nil {
+				fail(exitUsage, fmt.Sprintf("invalid tmux layout %s: %v", tmuxLayout, err))
+			}
+		} else if strings.HasPrefix(arg, "--max-slots=") {
+			n, err := strconv.Atoi(strings.TrimPrefix(arg, "--max-slots="))
+			if err != nil || n < 0 {
+				fail(exitUsage, "--max-slots must be a number (0 = no limit)")
+			}
+			maxSlots = n
 		}
 	}
 
 	// Register
 	reg.Projects[project] = ProjectConfig{
-		BasePort: basePort,
-		Path:     mainRepo,
-		Group:    groupID,
+		BasePort:    basePort,
+		Path:        mainRepo,
+		Group:       groupID,
+		SQLiteFiles: sqliteFiles,
+
+		AnonymizeScript: anonymizeScript,
+		Migrate:         migrate,
+		Agent:           agent,
+		Provision:       provision,
+		Install:         install,
+		PRTemplate:      prTemplate,
+		IssueBranch:     issueBranch,
+		MaxSlots:        maxSlots,
+		TmuxLayout:      tmuxLayout,
+		AgentOptions:    AgentOptions{Permissions: agentPermissions},
+		HealthURLs:      healthURLs,
+		Devcontainer:    devcontainer,
+		SharedPostgres:  sharedPostgres,
 	}
 	saveRegistry(reg)
 
@@ -212,7 +833,7 @@ func cmdInit(args []string) {
 	fmt.Printf("  Path:  %s\n", mainRepo)
 	fmt.Printf("  Port:  %d\n", basePort)
 	if groupID != "" {
-		fmt.Printf("  Group: %s\n", titleCase(groupID))
+		fmt.Printf("  Group: %s\n", reg.Groups[groupID].Name)
 	}
 	fmt.Println()
 	fmt.Println("Now you can:")
@@ -220,37 +841,380 @@ func cmdInit(args []string) {
 	fmt.Println("  slot-cli list       See status")
 }
 
-func resolveSlotNamePure(project, cwdBase string, cwdIsSlot bool, args []string) string {
-	slotName := cwdBase
+// Config holds user settings from ~/.config/slots/config.json, layered over an
+// optional shared bundle fetched from a URL or git repo.
+type Config struct {
+	Bundle       string                     `json:"bundle,omitempty"` // URL or git repo of a shared config bundle
+	Groups       map[string]GroupConfig     `json:"groups,omitempty"`
+	Templates    map[string]ProjectTemplate `json:"templates,omitempty"` // project name -> init defaults
+	Detectors    []GroupDetector            `json:"detectors,omitempty"`
+	Hooks        map[string][]string        `json:"hooks,omitempty"`        // event -> shell commands
+	Agents       map[string]Agent           `json:"agents,omitempty"`       // custom or overridden agents
+	AgentOptions AgentOptions               `json:"agent_options,omitzero"` // binary, flags, env and permission mode for every agent
+	Editor       string                     `json:"editor,omitempty"`       // editor command for `slot-cli open`
+	Scanners     map[string]ProcessScanner  `json:"scanners,omitempty"`     // custom or overridden `slot-cli clean <name>` process scanners
+	CleanGrace   string                     `json:"clean_grace,omitempty"`  // minimum slot age before clean removes it, e.g. "2d"
+	TrashDays    int                        `json:"trash_days,omitempty"`   // days deleted slots stay in the trash (default 7)
+
+	// DNS backends set up with `slot-cli dns sync` (hosts, dnsmasq), which
+	// new and delete keep current (local config only)
+	DNS []string `json:"dns,omitempty"`
+
+	// Hash of the bundle hooks the user agreed to run; bundle hooks that
+	// don't match it are skipped (local config only)
+	TrustedHooks string `json:"trusted_hooks,omitempty"`
+}
 
-	if !cwdIsSlot {
-		for _, arg := range args {
-			if arg == "--force" || arg == "-f" || strings.HasPrefix(arg, "--") {
-				continue
-			}
-			if n, err := strconv.Atoi(arg); err == nil {
-				slotName = fmt.Sprintf("%s-%d", project, n)
-			} else {
-				slotName = fmt.Sprintf("%s-%s", project, arg)
-			}
-			break
+// ProjectTemplate provides defaults applied by `slot-cli init`
+type ProjectTemplate struct {
+	BasePort int    `json:"base_port,omitempty"`
+	Group    string `json:"group,omitempty"`
+}
+
+// GroupDetector assigns a group to projects whose path matches Pattern (regexp)
+type GroupDetector struct {
+	Pattern string `json:"pattern"`
+	Group   string `json:"group"`
+}
+
+func configPath() string {
+	return filepath.Join(filepath.Dir(registryPath), "config.json")
+}
+
+func bundleCachePath() string {
+	return filepath.Join(filepath.Dir(registryPath), "bundle.json")
+}
+
+func readConfigFile(path string) Config {
+	var cfg Config
+	if data, err := os.ReadFile(path); err == nil {
+		json.Unmarshal(data, &cfg)
+	}
+	return cfg
+}
+
+// loadConfig returns the shared bundle merged under the local config. The
+// bundle's hooks are left out until the user trusts them (config trust-hooks).
+func loadConfig() Config {
+	bundle, local := readConfigFile(bundleCachePath()), readConfigFile(configPath())
+	if !bundleHooksTrusted(bundle, local) {
+		bundle.Hooks = nil
+	}
+	return mergeConfig(bundle, local)
+}
+
+// hooksHash fingerprints a set of hooks, so trusting them covers exactly
+// these commands ("" when there are none)
+func hooksHash(hooks map[string][]string) string {
+	if len(hooks) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(hooks) // map keys are sorted
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// bundleHooksTrusted reports whether the bundle's hooks (if any) are the
+// ones the local config trusts
+func bundleHooksTrusted(bundle, local Config) bool {
+	hash := hooksHash(bundle.Hooks)
+	return hash == "" || hash == local.TrustedHooks
+}
+
+// reviewBundleHooks shows a freshly pulled bundle's hooks that aren't
+// trusted yet and asks before letting them run
+func reviewBundleHooks() {
+	bundle, local := readConfigFile(bundleCachePath()), readConfigFile(configPath())
+	if bundleHooksTrusted(bundle, local) {
+		return
+	}
+	fmt.Println("\nThe bundle has hooks, run through the shell on slot events:")
+	for _, event := range slices.Sorted(maps.Keys(bundle.Hooks)) {
+		for _, c := range bundle.Hooks[event] {
+			fmt.Printf("  %-12s %s\n", event, c)
+		}
+	}
+	if !confirm("Run these hooks?") {
+		fmt.Println("Bundle hooks stay off; review them later with: slot-cli config trust-hooks")
+		return
+	}
+	local.TrustedHooks = hooksHash(bundle.Hooks)
+	saveLocalConfig(local)
+	fmt.Println("✓ Bundle hooks trusted (you'll be asked again if they change)")
+}
+
+// bundleSourceError rejects bundle sources fetched without transport
+// security: bundles can carry hooks, so a tampered one runs code
+func bundleSourceError(source string) error {
+	lower := strings.ToLower(source)
+	switch {
+	case strings.HasPrefix(lower, "http://"), strings.HasPrefix(lower, "git://"):
+		return fmt.Errorf("bundle source must use https or ssh, not %s", strings.SplitN(source, ":", 2)[0])
+	case isGitBundleSource(source), strings.HasPrefix(lower, "https://"):
+		return nil
+	}
+	return fmt.Errorf("bundle source must be an https:// URL or a git repo")
+}
+
+func saveLocalConfig(cfg Config) {
+	os.MkdirAll(filepath.Dir(configPath()), 0755)
+	data, _ := json.MarshalIndent(cfg, "", "  ")
+	os.WriteFile(configPath(), data, 0644)
+}
+
+// mergeConfig layers local on top of base: local entries win per key,
+// local detectors are tried before base detectors, and hooks are replaced per event.
+func mergeConfig(base, local Config) Config {
+	merged := Config{
+		Bundle:     local.Bundle,
+		Editor:     firstNonEmpty(local.Editor, base.Editor),
+		CleanGrace: firstNonEmpty(local.CleanGrace, base.CleanGrace),
+		TrashDays:  cmp.Or(local.TrashDays, base.TrashDays),
+		Groups:     make(map[string]GroupConfig),
+		Templates:  make(map[string]ProjectTemplate),
+		Hooks:      make(map[string][]string),
+		Agents:     make(map[string]Agent),
+		Scanners:   make(map[string]ProcessScanner),
+	}
+	for id, g := range base.Groups {
+		merged.Groups[id] = g
+	}
+	for id, g := range local.Groups {
+		merged.Groups[id] = g
+	}
+	for name, t := range base.Templates {
+		merged.Templates[name] = t
+	}
+	for name, t := range local.Templates {
+		merged.Templates[name] = t
+	}
+	merged.Detectors = append(append(merged.Detectors, local.Detectors...), base.Detectors...)
+	for event, cmds := range base.Hooks {
+		merged.Hooks[event] = cmds
+	}
+	for event, cmds := range local.Hooks {
+		merged.Hooks[event] = cmds
+	}
+	for name, a := range base.Agents {
+		merged.Agents[name] = a
+	}
+	for name, a := range local.Agents {
+		merged.Agents[name] = a
+	}
+	maps.Copy(merged.Scanners, base.Scanners)
+	maps.Copy(merged.Scanners, local.Scanners)
+	merged.AgentOptions = local.AgentOptions.Over(base.AgentOptions)
+	return merged
+}
+
+// detectGroup returns the group for a project path, trying config detectors
+// before the /Projects/<owner>/<project> convention
+func (cfg Config) detectGroup(projectPath string) string {
+	for _, d := range cfg.Detectors {
+		re, err := regexp.Compile(d.Pattern)
+		if err != nil {
+			continue
+		}
+		if re.MatchString(projectPath) {
+			return d.Group
+		}
+	}
+	return detectGroupFromPath(projectPath)
+}
+
+// isGitBundleSource reports whether a bundle reference points at a git repo
+func isGitBundleSource(source string) bool {
+	return strings.HasSuffix(source, ".git") || strings.HasPrefix(source, "git@") || strings.HasPrefix(source, "ssh://")
+}
+
+// fetchBundle downloads the shared bundle from a URL, or from slots-bundle.json
+// at the root of a git repo
+func fetchBundle(source string) ([]byte, error) {
+	if isGitBundleSource(source) {
+		tmpDir, err := os.MkdirTemp("", "slot-bundle-")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(tmpDir)
+
+		if out, err := exec.Command("git", "clone", "--depth", "1", "--quiet", source, tmpDir).CombinedOutput(); err != nil {
+			return nil, fmt.Errorf("git clone failed: %s", strings.TrimSpace(string(out)))
+		}
+		return os.ReadFile(filepath.Join(tmpDir, "slots-bundle.json"))
+	}
+
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Get(source)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// pullBundle fetches and caches the shared bundle
+func pullBundle(source string) error {
+	if err := bundleSourceError(source); err != nil {
+		return err
+	}
+	data, err := fetchBundle(source)
+	if err != nil {
+		return err
+	}
+	var bundle Config
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return fmt.Errorf("invalid bundle: %w", err)
+	}
+	bundle.Bundle = ""
+	out, _ := json.MarshalIndent(bundle, "", "  ")
+	return os.WriteFile(bundleCachePath(), out, 0644)
+}
+
+// runHooks runs the configured shell commands for an event inside dir
+func runHooks(event, dir string, env ...string) {
+	if bundle, local := readConfigFile(bundleCachePath()), readConfigFile(configPath()); len(local.Hooks[event]) == 0 &&
+		len(bundle.Hooks[event]) > 0 && !bundleHooksTrusted(bundle, local) {
+		fmt.Printf("\n⚠ Skipped %d %s hook(s) from the shared bundle: not trusted (slot-cli config trust-hooks)\n", len(bundle.Hooks[event]), event)
+	}
+	cmds := loadConfig().Hooks[event]
+	if len(cmds) == 0 {
+		return
+	}
+	fmt.Printf("\nRunning %s hooks...\n", event)
+	for _, c := range cmds {
+		cmd := shellCommand(c)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), env...)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			fmt.Printf("  ⚠ Hook failed: %s (%v)\n", c, err)
+		}
+	}
+}
+
+func cmdConfig(args []string) {
+	if len(args) == 0 {
+		args = []string{"show"}
+	}
+
+	switch args[0] {
+	case "show":
+		cfg := loadConfig()
+		data, _ := json.MarshalIndent(cfg, "", "  ")
+		fmt.Println(string(data))
+
+	case "bundle":
+		if len(args) < 2 {
+			fail(exitUsage, "missing bundle source", "Usage: slot-cli config bundle <url|git-repo>")
+		}
+		if err := bundleSourceError(args[1]); err != nil {
+			fail(exitUsage, err.Error())
+		}
+		local := readConfigFile(configPath())
+		local.Bundle = args[1]
+		saveLocalConfig(local)
+		fmt.Printf("✓ Bundle set to %s\n", args[1])
+		fmt.Println("\nFetching...")
+		if err := pullBundle(args[1]); err != nil {
+			fail(exitError, err.Error())
+		}
+		fmt.Println("✓ Bundle cached")
+		reviewBundleHooks()
+
+	case "editor":
+		if len(args) < 2 {
+			fail(exitUsage, "missing editor", "Usage: slot-cli config editor <code|cursor|zed|command>")
+		}
+		local := readConfigFile(configPath())
+		local.Editor = strings.Join(args[1:], " ")
+		saveLocalConfig(local)
+		fmt.Printf("✓ Editor set to %s\n", local.Editor)
+
+	case "permissions":
+		if len(args) < 2 {
+			fail(exitUsage, "missing permission mode", "Usage: slot-cli config permissions default|accept-edits|plan|skip")
+		}
+		local := readConfigFile(configPath())
+		local.AgentOptions.Permissions = args[1]
+		saveLocalConfig(local)
+		fmt.Printf("✓ Agent permission mode set to %s\n", args[1])
+		if args[1] == "skip" {
+			fmt.Println("⚠ Agents will act without asking in every slot (projects can still set their own mode)")
+		}
+
+	case "pull":
+		local := readConfigFile(configPath())
+		if local.Bundle == "" {
+			fmt.Println("No bundle configured.")
+			fmt.Println("\nSet one with: slot-cli config bundle <url|git-repo>")
+			return
+		}
+		fmt.Printf("Fetching %s...\n", local.Bundle)
+		if err := pullBundle(local.Bundle); err != nil {
+			fail(exitError, err.Error())
+		}
+		fmt.Println("✓ Bundle updated")
+		reviewBundleHooks()
+
+	case "trust-hooks":
+		if hooksHash(readConfigFile(bundleCachePath()).Hooks) == "" {
+			fmt.Println("The bundle has no hooks.")
+			return
+		}
+		if bundleHooksTrusted(readConfigFile(bundleCachePath()), readConfigFile(configPath())) {
+			fmt.Println("✓ The bundle's hooks are already trusted")
+			return
 		}
+		reviewBundleHooks()
+
+	default:
+		fmt.Println("Usage:")
+		fmt.Println("  slot-cli config show                 Show merged config")
+		fmt.Println("  slot-cli config bundle <url|repo>    Set and fetch shared bundle")
+		fmt.Println("  slot-cli config pull                 Refresh shared bundle")
+		fmt.Println("  slot-cli config trust-hooks          Review the bundle's hooks and allow them to run")
+		fmt.Println("  slot-cli config editor <cmd>         Set the editor used by slot-cli open")
+		fmt.Println("  slot-cli config permissions <mode>   Agent permission mode: default, accept-edits, plan, skip")
 	}
-	return slotName
 }
 
 func resolveSlotName(args []string) string {
 	cwd, _ := os.Getwd()
-	_, project := detectProject(cwd)
+	_, project := worktree.DetectProject(cwd)
 	cwdBase := filepath.Base(cwd)
 
 	reg := loadRegistry()
 	_, cwdIsSlot := reg.Slots[cwdBase]
 
-	return resolveSlotNamePure(project, cwdBase, cwdIsSlot, args)
+	return worktree.ResolveSlotName(project, cwdBase, cwdIsSlot, args)
 }
 
 func cmdLock(args []string) {
+	forFlag, args := extractFlag(args, "--for")
+	scope := ""
+	args = slices.DeleteFunc(slices.Clone(args), func(arg string) bool {
+		switch arg {
+		case "--no-delete":
+			scope = registry.LockScopeNoDelete
+		case "--no-touch":
+			scope = registry.LockScopeNoTouch
+		default:
+			return false
+		}
+		return true
+	})
+	var lockedUntil string
+	if forFlag != "" {
+		d, err := parseSince(forFlag)
+		if err != nil || d == 0 {
+			fail(exitUsage, "--for must be a duration like 12h, 3d or 2w")
+		}
+		lockedUntil = time.Now().Add(d).Format(time.RFC3339)
+	}
 	slotName := resolveSlotName(args)
 
 	// Collect note from remaining args (skip flags and slot identifier)
@@ -294,12 +1258,13 @@ func cmdLock(args []string) {
 	reg := loadRegistry()
 	slot, ok := reg.Slots[slotName]
 	if !ok {
-		fmt.Printf("Error: slot '%s' not found in registry\n", slotName)
-		os.Exit(1)
+		fail(exitNotFound, fmt.Sprintf("slot '%s' not found in registry", slotName))
 	}
 
 	slot.Locked = true
 	slot.LockNote = note
+	slot.LockedUntil = lockedUntil
+	slot.LockScope = scope
 	reg.Slots[slotName] = slot
 	saveRegistry(reg)
 
@@ -307,83 +1272,295 @@ func cmdLock(args []string) {
 	if note != "" {
 		fmt.Printf("  Note: %s\n", note)
 	}
-	fmt.Println("\nThis slot cannot be deleted until unlocked:")
+	if scope == registry.LockScopeNoTouch {
+		fmt.Println("\nThis slot cannot be deleted, cleaned, merged, db-synced, synced,")
+		fmt.Println("fix-ported or env-synced until unlocked:")
+	} else {
+		fmt.Println("\nThis slot cannot be deleted, cleaned, merged or db-synced until unlocked:")
+	}
 	fmt.Println("  slot-cli unlock")
+	if lockedUntil != "" {
+		fmt.Printf("  (or until the lock expires at %s)\n", lockedUntil)
+	}
 }
 
-func cmdUnlock(args []string) {
+// cmdDescribe sets what a slot is for: a description plus optional ticket
+// and assignee; without any it prints them
+func cmdDescribe(args []string) {
+	ticket, args := extractFlag(args, "--ticket")
+	assignee, args := extractFlag(args, "--assignee")
+	clearAll := slices.Contains(args, "--clear")
 	slotName := resolveSlotName(args)
 
-	reg := loadRegistry()
-	slot, ok := reg.Slots[slotName]
-	if !ok {
-		fmt.Printf("Error: slot '%s' not found in registry\n", slotName)
-		os.Exit(1)
+	// The text is every other argument, minus the slot when one is named
+	cwd, _ := os.Getwd()
+	var words []string
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "--") {
+			words = append(words, arg)
+		}
+	}
+	if filepath.Base(cwd) != slotName && len(words) > 0 {
+		words = words[1:]
 	}
+	text := strings.Join(words, " ")
 
-	if !slot.Locked {
-		fmt.Printf("Slot '%s' is not locked\n", slotName)
+	slot, ok := loadRegistry().Slots[slotName]
+	if !ok {
+		fail(exitNotFound, fmt.Sprintf("slot '%s' not found in registry", slotName))
+	}
+	if text == "" && ticket == "" && assignee == "" && !clearAll {
+		if summary := slotSummary(slot); summary != "" {
+			fmt.Printf("%s: %s\n", slotName, summary)
+		} else {
+			fmt.Printf("%s has no description\n", slotName)
+			fmt.Println("  Set one with: slot-cli describe \"what it's for\" [--ticket ID] [--assignee NAME]")
+		}
 		return
 	}
 
-	slot.Locked = false
-	slot.LockNote = ""
-	reg.Slots[slotName] = slot
-	saveRegistry(reg)
+	modifySlot(slotName, func(s *SlotConfig) {
+		if clearAll {
+			s.Description, s.Ticket, s.Assignee = "", "", ""
+		}
+		s.Description = cmp.Or(text, s.Description)
+		s.Ticket = cmp.Or(ticket, s.Ticket)
+		s.Assignee = cmp.Or(strings.TrimPrefix(assignee, "@"), s.Assignee)
+		slot = *s
+	})
+	if summary := slotSummary(slot); summary != "" {
+		fmt.Printf("✓ %s: %s\n", slotName, summary)
+	} else {
+		fmt.Printf("✓ Cleared %s's description\n", slotName)
+	}
+}
 
-	fmt.Printf("✓ Unlocked '%s'\n", slotName)
+// slotSummary renders a slot's description, ticket, assignee and labels on
+// one line
+func slotSummary(slot SlotConfig) string {
+	var parts []string
+	if slot.Description != "" {
+		parts = append(parts, slot.Description)
+	}
+	if slot.Ticket != "" {
+		parts = append(parts, "["+slot.Ticket+"]")
+	}
+	if slot.Assignee != "" {
+		parts = append(parts, "@"+slot.Assignee)
+	}
+	for _, label := range slot.Labels {
+		parts = append(parts, "#"+label)
+	}
+	return strings.Join(parts, " ")
 }
 
-func cmdGroup(args []string) {
-	if len(args) == 0 {
-		args = []string{"list"}
+// printDescribedSlots lists the slots that have a description, ticket or
+// assignee, so list answers "what was app-4 for?"
+func printDescribedSlots(reg *Registry) {
+	var names []string
+	for name, slot := range reg.Slots {
+		if slotSummary(slot) != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return
 	}
+	sort.Strings(names)
+	fmt.Println("\nSlots:")
+	for _, name := range names {
+		fmt.Printf("  • %-28s %s\n", name, slotSummary(reg.Slots[name]))
+	}
+}
 
-	subcmd := args[0]
-	subargs := args[1:]
+// labelRe is what a slot label may contain, so it's safe in --label and JSON
+var labelRe = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
 
-	switch subcmd {
-	case "list", "ls":
-		reg := loadRegistry()
-		if len(reg.Groups) == 0 {
-			fmt.Println("No groups defined.")
-			fmt.Println("\nCreate one with: slot-cli group create <id> \"<name>\"")
+// cmdLabel tags slots with free-form labels that list, clean and exec
+// filter on (--label spike)
+func cmdLabel(args []string) {
+	usage := "Usage: slot-cli label add|rm <slot> <label...> | label ls [slot]"
+	if len(args) == 0 {
+		fail(exitUsage, "missing subcommand", usage)
+	}
+	reg := loadRegistry()
+	switch args[0] {
+	case "ls", "list":
+		names := slices.Sorted(maps.Keys(reg.Slots))
+		if len(args) > 1 {
+			slotName, _, _ := registeredSlot(reg, args[1])
+			names = []string{slotName}
+		}
+		if jsonOutput {
+			labels := make(map[string][]string)
+			for _, name := range names {
+				if slotLabels := reg.Slots[name].Labels; len(slotLabels) > 0 || len(names) == 1 {
+					labels[name] = slotLabels
+				}
+			}
+			data, _ := json.MarshalIndent(labels, "", "  ")
+			fmt.Println(string(data))
 			return
 		}
-
-		// Collect projects per group
-		groupProjects := make(map[string][]string)
-		ungrouped := []string{}
-		for name, proj := range reg.Projects {
-			if proj.Group != "" {
-				groupProjects[proj.Group] = append(groupProjects[proj.Group], name)
-			} else {
-				ungrouped = append(ungrouped, name)
+		shown := 0
+		for _, name := range names {
+			if labels := reg.Slots[name].Labels; len(labels) > 0 {
+				fmt.Printf("  %-28s %s\n", name, strings.Join(labels, ", "))
+				shown++
 			}
 		}
-
-		fmt.Println()
-		for id, group := range reg.Groups {
-			projects := groupProjects[id]
-			fmt.Printf("  %s (%s) — %d projects\n", group.Name, id, len(projects))
-			for _, p := range projects {
-				fmt.Printf("    • %s\n", p)
-			}
+		if shown == 0 {
+			fmt.Println("No labeled slots.")
+			fmt.Println("  Add one with: slot-cli label add <slot> <label>")
 		}
-
-		if len(ungrouped) > 0 {
-			fmt.Printf("\n  Ungrouped — %d projects\n", len(ungrouped))
-			for _, p := range ungrouped {
-				fmt.Printf("    • %s\n", p)
+	case "add", "rm", "remove":
+		if len(args) < 3 {
+			fail(exitUsage, "missing slot or label", usage)
+		}
+		slotName, _, _ := registeredSlot(reg, args[1])
+		for _, label := range args[2:] {
+			if !labelRe.MatchString(label) {
+				fail(exitUsage, fmt.Sprintf("invalid label '%s'", label), "Labels may contain letters, digits, '.', '_' and '-'")
+			}
+		}
+		var labels []string
+		modifySlot(slotName, func(s *SlotConfig) {
+			if args[0] == "add" {
+				s.Labels = addLabels(s.Labels, args[2:])
+			} else {
+				s.Labels = removeLabels(s.Labels, args[2:])
+			}
+			labels = s.Labels
+		})
+		if len(labels) == 0 {
+			fmt.Printf("✓ %s has no labels\n", slotName)
+		} else {
+			fmt.Printf("✓ %s: %s\n", slotName, strings.Join(labels, ", "))
+		}
+	default:
+		fail(exitUsage, fmt.Sprintf("unknown label subcommand '%s'", args[0]), usage)
+	}
+}
+
+// addLabels returns the union of labels and added, sorted and deduplicated
+func addLabels(labels, added []string) []string {
+	merged := append(slices.Clone(labels), added...)
+	slices.Sort(merged)
+	return slices.Compact(merged)
+}
+
+// removeLabels returns labels without the removed ones (nil when none remain)
+func removeLabels(labels, removed []string) []string {
+	kept := slices.DeleteFunc(slices.Clone(labels), func(label string) bool {
+		return slices.Contains(removed, label)
+	})
+	if len(kept) == 0 {
+		return nil
+	}
+	return kept
+}
+
+// lockError describes a slot's lock as the error a blocked command returns
+func lockError(slotName string, slot SlotConfig) *APIError {
+	message := fmt.Sprintf("Slot '%s' is LOCKED", slotName)
+	if slot.LockScope == registry.LockScopeNoTouch {
+		message += " (no-touch)"
+	}
+	var hints []string
+	if slot.LockNote != "" {
+		hints = append(hints, "  Note: "+slot.LockNote)
+	}
+	if slot.LockedUntil != "" {
+		hints = append(hints, "  Until: "+slot.LockedUntil)
+	}
+	return &APIError{Code: exitLocked, Message: message, Hints: append(hints, "Unlock first: slot-cli unlock "+slotName)}
+}
+
+// checkLock exits when slotName's lock forbids the command: any active lock
+// blocks removing or overwriting the slot, no-touch locks also edits (edit)
+func checkLock(slotName string, edit bool) {
+	if slot := loadRegistry().Slots[slotName]; slot.LockBlocks(edit, time.Now()) {
+		err := lockError(slotName, slot)
+		fail(err.Code, err.Message, err.Hints...)
+	}
+}
+
+func cmdUnlock(args []string) {
+	slotName := resolveSlotName(args)
+
+	reg := loadRegistry()
+	slot, ok := reg.Slots[slotName]
+	if !ok {
+		fail(exitNotFound, fmt.Sprintf("slot '%s' not found in registry", slotName))
+	}
+
+	if !slot.Locked {
+		fmt.Printf("Slot '%s' is not locked\n", slotName)
+		return
+	}
+
+	slot.Locked = false
+	slot.LockNote = ""
+	slot.LockedUntil = ""
+	slot.LockScope = ""
+	reg.Slots[slotName] = slot
+	saveRegistry(reg)
+
+	fmt.Printf("✓ Unlocked '%s'\n", slotName)
+}
+
+func cmdGroup(args []string) {
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+
+	subcmd := args[0]
+	subargs := args[1:]
+
+	switch subcmd {
+	case "list", "ls":
+		reg := loadRegistry()
+		if len(reg.Groups) == 0 {
+			fmt.Println("No groups defined.")
+			fmt.Println("\nCreate one with: slot-cli group create <id> \"<name>\"")
+			return
+		}
+
+		// Collect projects per group
+		groupProjects := make(map[string][]string)
+		ungrouped := []string{}
+		for name, proj := range reg.Projects {
+			if proj.Group != "" {
+				groupProjects[proj.Group] = append(groupProjects[proj.Group], name)
+			} else {
+				ungrouped = append(ungrouped, name)
+			}
+		}
+
+		fmt.Println()
+		for _, id := range sortedGroupIDs(reg.Groups) {
+			group := reg.Groups[id]
+			projects := groupProjects[id]
+			sort.Strings(projects)
+			fmt.Printf("  %d. %s (%s) — %d projects\n", group.Order, group.Name, id, len(projects))
+			for _, p := range projects {
+				fmt.Printf("    • %s\n", p)
+			}
+		}
+
+		if len(ungrouped) > 0 {
+			fmt.Printf("\n  Ungrouped — %d projects\n", len(ungrouped))
+			for _, p := range ungrouped {
+				fmt.Printf("    • %s\n", p)
 			}
 		}
 		fmt.Println()
 
 	case "create":
 		if len(subargs) < 2 {
-			fmt.Println("Usage: slot-cli group create <id> \"<display name>\"")
-			fmt.Println("Example: slot-cli group create edgevanta \"Edgevanta\"")
-			os.Exit(1)
+			fail(exitUsage, "missing group id or name",
+				"Usage: slot-cli group create <id> \"<display name>\"",
+				"Example: slot-cli group create edgevanta \"Edgevanta\"")
 		}
 
 		id := subargs[0]
@@ -409,8 +1586,7 @@ func cmdGroup(args []string) {
 
 	case "assign":
 		if len(subargs) < 2 {
-			fmt.Println("Usage: slot-cli group assign <project> <group-id>")
-			os.Exit(1)
+			fail(exitUsage, "missing project or group", "Usage: slot-cli group assign <project> <group-id>")
 		}
 
 		projectName := subargs[0]
@@ -420,18 +1596,10 @@ func cmdGroup(args []string) {
 
 		proj, ok := reg.Projects[projectName]
 		if !ok {
-			fmt.Printf("Error: project '%s' not found in registry\n", projectName)
-			os.Exit(1)
+			fail(exitNotFound, fmt.Sprintf("project '%s' not found in registry", projectName))
 		}
 
-		if _, ok := reg.Groups[groupID]; !ok {
-			fmt.Printf("Error: group '%s' not found\n", groupID)
-			fmt.Println("Available groups:")
-			for id, g := range reg.Groups {
-				fmt.Printf("  %s — %s\n", id, g.Name)
-			}
-			os.Exit(1)
-		}
+		requireGroup(reg, groupID)
 
 		proj.Group = groupID
 		reg.Projects[projectName] = proj
@@ -439,19 +1607,212 @@ func cmdGroup(args []string) {
 
 		fmt.Printf("✓ Assigned '%s' to group '%s'\n", projectName, reg.Groups[groupID].Name)
 
+	case "rename":
+		newID, subargs := extractFlag(subargs, "--id")
+		if len(subargs) < 2 {
+			fail(exitUsage, "missing group id or name", "Usage: slot-cli group rename <id> \"<new name>\" [--id <new-id>]")
+		}
+		id, name := subargs[0], subargs[1]
+
+		reg := loadRegistry()
+		requireGroup(reg, id)
+		group := reg.Groups[id]
+		group.Name = name
+		if newID != "" && newID != id {
+			if _, taken := reg.Groups[newID]; taken {
+				fail(exitExists, fmt.Sprintf("group '%s' already exists", newID))
+			}
+			delete(reg.Groups, id)
+			moveGroupProjects(reg, id, newID)
+			id = newID
+		}
+		reg.Groups[id] = group
+		saveRegistry(reg)
+
+		fmt.Printf("✓ Renamed group to '%s' (%s)\n", name, id)
+
+	case "delete", "rm":
+		target, subargs := extractFlag(subargs, "--to")
+		if len(subargs) < 1 {
+			fail(exitUsage, "missing group id", "Usage: slot-cli group delete <id> [--to <group-id>]")
+		}
+		id := subargs[0]
+
+		reg := loadRegistry()
+		requireGroup(reg, id)
+		if target != "" {
+			requireGroup(reg, target)
+			if target == id {
+				fail(exitUsage, "--to must name another group")
+			}
+		}
+		name := reg.Groups[id].Name
+		delete(reg.Groups, id)
+		moved := moveGroupProjects(reg, id, target)
+		reg.Groups = reorderGroups(reg.Groups, "", 0)
+		saveRegistry(reg)
+
+		fmt.Printf("✓ Deleted group '%s' (%s)\n", name, id)
+		for _, p := range moved {
+			if target != "" {
+				fmt.Printf("  %s → %s\n", p, reg.Groups[target].Name)
+			} else {
+				fmt.Printf("  %s → ungrouped\n", p)
+			}
+		}
+
+	case "order":
+		if len(subargs) < 2 {
+			fail(exitUsage, "missing group id or position", "Usage: slot-cli group order <id> <n>")
+		}
+		id := subargs[0]
+		pos, err := strconv.Atoi(subargs[1])
+		if err != nil || pos < 1 {
+			fail(exitUsage, "position must be a number from 1")
+		}
+
+		reg := loadRegistry()
+		requireGroup(reg, id)
+		reg.Groups = reorderGroups(reg.Groups, id, pos)
+		saveRegistry(reg)
+
+		fmt.Printf("✓ Moved '%s' to position %d\n", reg.Groups[id].Name, reg.Groups[id].Order)
+
 	default:
 		fmt.Println("Usage:")
-		fmt.Println("  slot-cli group list                     Show groups")
-		fmt.Println("  slot-cli group create <id> \"<name>\"     Create group")
+		fmt.Println("  slot-cli group list                      Show groups")
+		fmt.Println("  slot-cli group create <id> \"<name>\"      Create group")
 		fmt.Println("  slot-cli group assign <project> <group>  Assign project")
+		fmt.Println("  slot-cli group rename <id> \"<name>\"      Rename group (--id <new-id> to change its id)")
+		fmt.Println("  slot-cli group delete <id>               Delete group (--to <group> to move its projects)")
+		fmt.Println("  slot-cli group order <id> <n>            Move group to position n")
+	}
+}
+
+// groupRegistry narrows a registry to one group's projects and their slots
+func groupRegistry(reg *Registry, group string) *Registry {
+	scoped := &Registry{Groups: reg.Groups, Projects: map[string]ProjectConfig{}, Slots: map[string]SlotConfig{}}
+	for name, proj := range reg.Projects {
+		if proj.Group == group {
+			scoped.Projects[name] = proj
+		}
+	}
+	for name, slot := range reg.Slots {
+		if _, ok := scoped.Projects[slot.Project]; ok {
+			scoped.Slots[name] = slot
+		}
+	}
+	return scoped
+}
+
+// scopeToGroup applies a --group flag: the registry narrowed to that group
+// (failing if it doesn't exist), or reg itself when group is empty
+func scopeToGroup(reg *Registry, group string) *Registry {
+	if group == "" {
+		return reg
 	}
+	requireGroup(reg, group)
+	return groupRegistry(reg, group)
+}
+
+// scopeToLabel applies a --label flag: the registry's slots narrowed to those
+// labeled so (projects kept for their paths), or reg itself when label is empty
+func scopeToLabel(reg *Registry, label string) *Registry {
+	if label == "" {
+		return reg
+	}
+	scoped := &Registry{Groups: reg.Groups, Projects: reg.Projects, Slots: map[string]SlotConfig{}}
+	for name, slot := range reg.Slots {
+		if slices.Contains(slot.Labels, label) {
+			scoped.Slots[name] = slot
+		}
+	}
+	return scoped
+}
+
+// agentsIn keeps the agents working in one of reg's projects or slots
+func agentsIn(reg *Registry, agents []AgentProcess) []AgentProcess {
+	var paths []string
+	for _, proj := range reg.Projects {
+		paths = append(paths, proj.Path)
+	}
+	for name := range reg.Slots {
+		paths = append(paths, reg.SlotPath(name))
+	}
+	var kept []AgentProcess
+	for _, a := range agents {
+		for _, p := range paths {
+			if a.CWD != "" && p != "" && worktree.IsWithin(a.CWD, p) {
+				kept = append(kept, a)
+				break
+			}
+		}
+	}
+	return kept
+}
+
+// requireGroup fails unless the registry has the group, listing the ones it has
+func requireGroup(reg *Registry, id string) {
+	if _, ok := reg.Groups[id]; ok {
+		return
+	}
+	hints := []string{"Available groups:"}
+	for _, gid := range sortedGroupIDs(reg.Groups) {
+		hints = append(hints, fmt.Sprintf("  %s — %s", gid, reg.Groups[gid].Name))
+	}
+	fail(exitNotFound, fmt.Sprintf("group '%s' not found", id), hints...)
+}
+
+// moveGroupProjects reassigns a group's projects to another group ("" to
+// ungroup them) and returns their names
+func moveGroupProjects(reg *Registry, from, to string) []string {
+	var moved []string
+	for name, proj := range reg.Projects {
+		if proj.Group == from {
+			proj.Group = to
+			reg.Projects[name] = proj
+			moved = append(moved, name)
+		}
+	}
+	sort.Strings(moved)
+	return moved
+}
+
+// sortedGroupIDs returns group ids by display order (ties by id)
+func sortedGroupIDs(groups map[string]GroupConfig) []string {
+	ids := slices.Collect(maps.Keys(groups))
+	sort.Slice(ids, func(i, j int) bool {
+		if groups[ids[i]].Order != groups[ids[j]].Order {
+			return groups[ids[i]].Order < groups[ids[j]].Order
+		}
+		return ids[i] < ids[j]
+	})
+	return ids
+}
+
+// reorderGroups moves group id to position pos (1-based, clamped) and
+// renumbers every group 1..n; an empty id only renumbers
+func reorderGroups(groups map[string]GroupConfig, id string, pos int) map[string]GroupConfig {
+	ids := sortedGroupIDs(groups)
+	if i := slices.Index(ids, id); i >= 0 {
+		ids = slices.Delete(ids, i, i+1)
+		pos = min(max(pos, 1), len(ids)+1)
+		ids = slices.Insert(ids, pos-1, id)
+	}
+	reordered := make(map[string]GroupConfig, len(groups))
+	for i, gid := range ids {
+		g := groups[gid]
+		g.Order = i + 1
+		reordered[gid] = g
+	}
+	return reordered
 }
 
 // detectGroupFromPath extracts the owner/company folder from a project path.
 // For /Users/user/Projects/<owner>/<project>, returns the owner folder name.
 func detectGroupFromPath(projectPath string) string {
 	// Walk up to find the "Projects" parent
-	parts := strings.Split(projectPath, "/")
+	parts := strings.Split(filepath.ToSlash(projectPath), "/")
 	for i, part := range parts {
 		if part == "Projects" && i+2 < len(parts) {
 			return parts[i+1] // The folder right after "Projects"
@@ -468,13 +1829,223 @@ func titleCase(s string) string {
 	return strings.ToUpper(s[:1]) + s[1:]
 }
 
+// defaultIssueBranch names slots created with new --issue; the project's
+// issue_branch overrides it
+const defaultIssueBranch = "feat/{number}-{slug}"
+
+// Issue is a GitHub issue a slot was created for
+type Issue struct {
+	Number int    `json:"number"`
+	Title  string `json:"title"`
+	URL    string `json:"url"`
+}
+
+// fetchIssue reads an issue's title and URL with gh
+func fetchIssue(dir, number string) (*Issue, error) {
+	cmd := exec.Command("gh", "issue", "view", number, "--json", "number,title,url")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return nil, fmt.Errorf("%s", strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, err
+	}
+	var issue Issue
+	if err := json.Unmarshal(out, &issue); err != nil {
+		return nil, err
+	}
+	return &issue, nil
+}
+
+var nonSlugRe = regexp.MustCompile(`[^a-z0-9]+`)
+
+// issueSlug turns an issue title into a short branch-safe slug, cut at a
+// word boundary after 40 characters
+func issueSlug(title string) string {
+	slug := strings.Trim(nonSlugRe.ReplaceAllString(strings.ToLower(title), "-"), "-")
+	if len(slug) > 40 {
+		if i := strings.LastIndex(slug[:41], "-"); i > 0 {
+			slug = slug[:i]
+		} else {
+			slug = slug[:40]
+		}
+	}
+	return slug
+}
+
+// issueBranchName fills {number} and {slug} in a branch template
+func issueBranchName(tmpl string, issue Issue) string {
+	name := strings.NewReplacer("{number}", strconv.Itoa(issue.Number), "{slug}", issueSlug(issue.Title)).Replace(tmpl)
+	return strings.Trim(strings.ReplaceAll(name, "--", "-"), "-/")
+}
+
+// withIssueLink appends a closing reference to a PR body unless it already
+// mentions the issue
+func withIssueLink(body, issueURL string) string {
+	if issueURL == "" || strings.Contains(body, issueURL) {
+		return body
+	}
+	body = strings.TrimRight(body, "\n")
+	if body != "" {
+		body += "\n\n"
+	}
+	return body + "Closes " + issueURL + "\n"
+}
+
+// PullRequest is a GitHub PR a slot is checked out from (new --pr)
+type PullRequest struct {
+	Number            int    `json:"number"`
+	Title             string `json:"title"`
+	URL               string `json:"url"`
+	HeadRefName       string `json:"headRefName"`
+	IsCrossRepository bool   `json:"isCrossRepository"`
+	Owner             struct {
+		Login string `json:"login"`
+	} `json:"headRepositoryOwner"`
+}
+
+// LocalBranch is the branch a PR is checked out as: its head branch, or
+// <owner>/<head branch> for forks so it can't clash with ours
+func (pr PullRequest) LocalBranch() string {
+	if pr.IsCrossRepository && pr.Owner.Login != "" {
+		return pr.Owner.Login + "/" + pr.HeadRefName
+	}
+	return pr.HeadRefName
+}
+
+// fetchPullRequest reads a PR's head branch and fork owner with gh
+func fetchPullRequest(dir, number string) (*PullRequest, error) {
+	cmd := exec.Command("gh", "pr", "view", number, "--json", "number,title,url,headRefName,isCrossRepository,headRepositoryOwner")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return nil, fmt.Errorf("%s", strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, err
+	}
+	var pr PullRequest
+	if err := json.Unmarshal(out, &pr); err != nil {
+		return nil, err
+	}
+	return &pr, nil
+}
+
+// failIfBranchExists stops new when the branch it would create is taken
+func failIfBranchExists(mainRepo, branch string) {
+	if exec.Command("git", "-C", mainRepo, "rev-parse", "--verify", "--quiet", "refs/heads/"+branch).Run() == nil {
+		fail(exitExists, fmt.Sprintf("local branch '%s' already exists", branch),
+			"Check it out in a slot by hand: git worktree add <path> "+branch,
+			"or delete it first: git branch -D "+branch)
+	}
+}
+
+// revSlotName names a slot created at a revision: tags and other names as
+// branchSlotName does, commit hashes as at-<short sha>
+func revSlotName(rev, sha string) string {
+	if len(rev) >= 4 && strings.HasPrefix(sha, strings.ToLower(rev)) {
+		return "at-" + sha[:8]
+	}
+	return branchSlotName(rev)
+}
+
+// splitRemoteRef splits "origin/feature-x" into remote and branch when the
+// first segment names one of remotes; anything else is a branch on origin
+func splitRemoteRef(ref string, remotes []string) (remote, branch string) {
+	if first, rest, ok := strings.Cut(ref, "/"); ok && rest != "" && slices.Contains(remotes, first) {
+		return first, rest
+	}
+	return "origin", ref
+}
+
+// branchSlotName derives a slot name from a branch: feature/x -> feature-x;
+// a bare number gets a prefix so it doesn't read as a numbered slot
+func branchSlotName(branch string) string {
+	name := strings.Trim(regexp.MustCompile(`[^A-Za-z0-9._-]+`).ReplaceAllString(branch, "-"), "-")
+	if _, err := strconv.Atoi(name); err == nil {
+		name = "branch-" + name
+	}
+	return name
+}
+
 func cmdNew(args []string) {
+	if i := slices.Index(args, "--stack"); i >= 0 {
+		cmdNewStack(args[:i], args[i+1:])
+		return
+	}
+	if host, rest := extractFlag(args, "--host"); host != "" {
+		cmdNewRemote(host, rest)
+		return
+	}
+
 	// Parse slot identifier (number or name)
 	slotNum := 0
 	slotNameArg := ""
 
+	trackedFileMode, args = parseTrackedFileMode(args)
+	if linkFlag, rest := extractFlag(args, "--link-ports"); linkFlag != "" {
+		var err error
+		if linkedPorts, err = parseLinkedPorts(linkFlag); err != nil {
+			fail(exitUsage, err.Error())
+		}
+		args = rest
+	}
+
+	servicesFlag, args := extractFlag(args, "--services")
+	profileFlag, args := extractFlag(args, "--profile")
+	provision, args := extractFlag(args, "--provision")
+	issueFlag, args := extractFlag(args, "--issue")
+	fromRef, args := extractFlag(args, "--from")
+	prFlag, args := extractFlag(args, "--pr")
+	atRev, args := extractFlag(args, "--at")
+	ttlFlag, args := extractFlag(args, "--ttl")
+	compose := ComposeSelection{
+		Profiles: splitList(profileFlag),
+		Services: splitList(servicesFlag),
+	}
+	withRedis := false
+	withTmux := false
+	noClipboard := false
+	dryRun := false
+	detach := false
+	ignoreMaxSlots := false
+	devcontainer := false
+	sharedPostgres := false
+	var timings *Timings
+	var ttl time.Duration
+	if ttlFlag != "" {
+		var err error
+		if ttl, err = parseSince(ttlFlag); err != nil || ttl == 0 {
+			fail(exitUsage, "--ttl must be a duration like 12h, 7d or 2w")
+		}
+	}
+	skip := parseSkipFlags(args)
 	for _, arg := range args {
-		if arg == "--force" || arg == "-f" {
+		switch arg {
+		case "--dry-run":
+			dryRun = true
+		case "--ignore-max-slots":
+			ignoreMaxSlots = true
+		case "--with-redis":
+			withRedis = true
+		case "--tmux":
+			withTmux = true
+		case "--no-clipboard":
+			noClipboard = true
+		case "--detach":
+			detach = true
+		case "--devcontainer":
+			devcontainer = true
+		case "--shared-postgres":
+			sharedPostgres = true
+		case "--timings":
+			timings = &Timings{}
+		}
+	}
+
+	for _, arg := range args {
+		if arg == "--force" || arg == "-f" || strings.HasPrefix(arg, "--") {
 			continue
 		}
 		// Check if it's a number
@@ -490,11 +2061,91 @@ func cmdNew(args []string) {
 
 	// Detect project
 	cwd, _ := os.Getwd()
-	mainRepo, project := detectProject(cwd)
+	mainRepo, project := worktree.DetectProject(cwd)
 
 	if mainRepo == "" {
-		fmt.Println("Error: not in a git repository")
-		os.Exit(1)
+		fail(exitUsage, "not in a git repository")
+	}
+
+	projectCfg, registered := loadRegistry().Projects[project]
+	if registered {
+		withRedis = withRedis || projectCfg.CopyRedis
+		withTmux = withTmux || projectCfg.Tmux
+		devcontainer = devcontainer || projectCfg.Devcontainer
+		sharedPostgres = sharedPostgres || projectCfg.SharedPostgres
+		provision = firstNonEmpty(provision, projectCfg.Provision)
+	}
+	provision = parseProvisionMode(provision)
+
+	// Issue slots are named after the branch: feat/123-fix-login -> <project>-123-fix-login
+	var issue *Issue
+	branchOverride := ""
+	if issueFlag != "" {
+		if slotNum != 0 || slotNameArg != "" {
+			fail(exitUsage, "--issue names the slot; don't pass a number or name too")
+		}
+		if fromRef != "" || prFlag != "" {
+			fail(exitUsage, "--issue can't be combined with --from or --pr")
+		}
+		var err error
+		if issue, err = fetchIssue(mainRepo, strings.TrimPrefix(issueFlag, "#")); err != nil {
+			fail(exitNotFound, fmt.Sprintf("could not fetch issue %s: %v", issueFlag, err), "slot-cli new --issue needs gh (gh auth login)")
+		}
+		branchOverride = issueBranchName(firstNonEmpty(projectCfg.IssueBranch, defaultIssueBranch), *issue)
+		slotNameArg = path.Base(branchOverride)
+		if _, err := strconv.Atoi(slotNameArg); err == nil {
+			slotNameArg = "issue-" + slotNameArg // a bare number would read as a numbered slot
+		}
+		fmt.Printf("Issue #%d: %s\n", issue.Number, issue.Title)
+	}
+
+	// Slots from an existing remote branch track it under the same local name
+	remoteRef := ""
+	if fromRef != "" {
+		remotesOut, _ := exec.Command("git", "-C", mainRepo, "remote").Output()
+		remote, branch := splitRemoteRef(fromRef, strings.Fields(string(remotesOut)))
+		remoteRef = remote + "/" + branch
+		failIfBranchExists(mainRepo, branch)
+		branchOverride = branch
+		if slotNum == 0 && slotNameArg == "" {
+			slotNameArg = branchSlotName(branch)
+		}
+	}
+
+	// PR slots are checked out with gh, which also wires up forks
+	var pr *PullRequest
+	if prFlag != "" {
+		if fromRef != "" {
+			fail(exitUsage, "--pr and --from can't be combined")
+		}
+		var err error
+		if pr, err = fetchPullRequest(mainRepo, strings.TrimPrefix(prFlag, "#")); err != nil {
+			fail(exitNotFound, fmt.Sprintf("could not fetch PR %s: %v", prFlag, err), "slot-cli new --pr needs gh (gh auth login)")
+		}
+		branchOverride = pr.LocalBranch()
+		failIfBranchExists(mainRepo, branchOverride)
+		if slotNum == 0 && slotNameArg == "" {
+			slotNameArg = fmt.Sprintf("pr-%d", pr.Number)
+		}
+		fmt.Printf("PR #%d: %s (%s)\n", pr.Number, pr.Title, branchOverride)
+	}
+
+	// Slots at a tag or commit branch off it (or stay detached with --detach)
+	if atRev != "" {
+		if fromRef != "" || prFlag != "" || issueFlag != "" {
+			fail(exitUsage, "--at can't be combined with --from, --pr or --issue")
+		}
+		out, err := exec.Command("git", "-C", mainRepo, "rev-parse", "--verify", "--quiet", atRev+"^{commit}").Output()
+		if err != nil {
+			fail(exitNotFound, fmt.Sprintf("revision '%s' not found", atRev), "Fetch tags first: git fetch --tags")
+		}
+		sha := strings.TrimSpace(string(out))
+		if slotNum == 0 && slotNameArg == "" {
+			slotNameArg = revSlotName(atRev, sha)
+		}
+		atRev = sha
+	} else if detach {
+		fail(exitUsage, "--detach needs --at <tag|sha>")
 	}
 
 	var slotName, slotPath, branchName string
@@ -503,56 +2154,113 @@ func cmdNew(args []string) {
 		// Named slot: project-name, branch: name
 		slotName = fmt.Sprintf("%s-%s", project, slotNameArg)
 		slotPath = filepath.Join(filepath.Dir(mainRepo), slotName)
-		branchName = slotNameArg
+		branchName = firstNonEmpty(branchOverride, slotNameArg)
 	} else {
 		// Numbered slot: auto-increment if not provided
 		if slotNum == 0 {
-			slotNum = findNextSlotNumber(mainRepo, project)
+			slotNum = worktree.NextSlotNumber(mainRepo, project)
 			fmt.Printf("Auto-assigned slot: %d\n", slotNum)
 		}
 		slotName = fmt.Sprintf("%s-%d", project, slotNum)
 		slotPath = filepath.Join(filepath.Dir(mainRepo), slotName)
-		branchName = fmt.Sprintf("slot-%d", slotNum)
+		branchName = firstNonEmpty(branchOverride, fmt.Sprintf("slot-%d", slotNum))
 	}
 
 	// Check if exists
 	if _, err := os.Stat(slotPath); err == nil {
-		fmt.Printf("Error: Slot %s already exists at %s\n", slotName, slotPath)
-		os.Exit(1)
+		fail(exitExists, fmt.Sprintf("Slot %s already exists at %s", slotName, slotPath))
 	}
 
-	fmt.Printf("Creating slot: %s\n\n", slotName)
+	if limit := projectCfg.MaxSlots; limit > 0 && !ignoreMaxSlots {
+		if n := countProjectSlots(loadRegistry(), project, fileExists); n >= limit {
+			fail(exitLimit, fmt.Sprintf("%s already has %d slot(s) (max_slots is %d)", project, n, limit),
+				"Remove finished ones: slot-cli clean", "Or go over the limit once: slot-cli new --ignore-max-slots")
+		}
+	}
 
-	// Create worktree
-	runCmd(mainRepo, "git", "worktree", "add", slotPath, "-b", branchName)
-	fmt.Println("✓ Created worktree")
+	if dryRun {
+		base := worktree.BranchName(mainRepo)
+		if remoteRef != "" {
+			base = remoteRef + ", tracking"
+		} else if pr != nil {
+			base = fmt.Sprintf("PR #%d via gh pr checkout", pr.Number)
+		} else if atRev != "" {
+			base = fmt.Sprintf("%.8s", atRev)
+			if detach {
+				branchName = "(detached)"
+			}
+		}
+		planNewSlot(mainRepo, project, slotName, slotPath, branchName, base, slotNum, compose, withTmux)
+		return
+	}
 
-	// Copy gitignored files
-	copyGitignored(mainRepo, slotPath)
-	fmt.Println("✓ Copied gitignored files")
+	fmt.Printf("Creating slot: %s\n\n", slotName)
+	started := time.Now()
 
-	// Scan ports from main and update slot (use slotNum for port offset, default to 1 for named)
+	// Ports are offset by the slot number; named slots take the next free one
 	portOffset := slotNum
 	if portOffset == 0 {
-		portOffset = findNextSlotNumber(mainRepo, project)
+		portOffset = worktree.NextSlotNumber(mainRepo, project)
+	}
+	src := lifecycle.Source{RemoteRef: remoteRef, Rev: atRev, Detach: detach}
+	if pr != nil {
+		src.PR = pr.Number
+	}
+	if detach {
+		branchName = ""
+	}
+
+	env := lifecycleEnv()
+	env.Register = func(s lifecycle.Slot) {
+		updateRegistryFull(slotName, project, slotNum, slotNameArg, branchName)
+		modifySlot(slotName, func(slot *SlotConfig) {
+			slot.Profiles = compose.Profiles
+			slot.Services = compose.Services
+			slot.Pending = skip
+			slot.PortOffset = portOffset
+			slot.SharedPostgres = sharedPostgres
+			if issue != nil {
+				slot.IssueNumber, slot.IssueURL = issue.Number, issue.URL
+			}
+			if pr != nil {
+				slot.PRNumber, slot.PRURL = pr.Number, pr.URL
+			}
+			if ttl > 0 {
+				slot.ExpiresAt = time.Now().Add(ttl).Format(time.RFC3339)
+			}
+		})
+		refreshSlotDNS()
+		if devcontainer {
+			if _, err := writeSlotDevcontainer(mainRepo, slotPath); err != nil {
+				fmt.Printf("⚠ Could not write devcontainer config: %v\n", err)
+			} else {
+				fmt.Printf("✓ Wrote %s/devcontainer.json\n", slotDevcontainerDir)
+			}
+		}
 	}
-	portMap := scanAndAllocatePorts(mainRepo, portOffset)
-	if len(portMap) > 0 {
-		updateSlotEnvFiles(slotPath, portMap, slotName)
-		updateConfigFiles(slotPath, portMap)
-		updateDockerComposeFiles(slotPath, slotName)
-		ensureDockerComposeEnvFiles(slotPath, portMap, slotName)
-		fmt.Println("✓ Port mapping complete")
-
-		// Start docker and clone database
-		startDockerAndClone(mainRepo, slotPath, portMap)
+	s := lifecycle.Slot{MainRepo: mainRepo, Project: project, Name: slotName, Path: slotPath, Branch: branchName}
+	portMap, err := lifecycle.New(env, slotProvisioner(project, compose, withRedis, provision), s, lifecycle.NewOptions{
+		Source:     src,
+		PortOffset: portOffset,
+		Provision: lifecycle.ProvisionOptions{
+			Steps:          stepsToProvision(nil, skip, true),
+			SharedPostgres: sharedPostgres,
+			Timings:        timings,
+		},
+	})
+	if errors.Is(err, lifecycle.ErrFetch) {
+		fail(exitNotFound, err.Error())
+	} else if err != nil {
+		fail(exitError, err.Error())
 	}
 
-	// Install dependencies
-	installDeps(slotPath)
-
-	// Update registry
-	updateRegistryFull(slotName, project, slotNum, slotNameArg, branchName)
+	if withTmux {
+		if err := createSlotTmux(slotName, slotPath); err != nil {
+			fmt.Printf("⚠ Could not create tmux session: %v\n", err)
+		} else {
+			fmt.Printf("✓ Created tmux session %s\n", tmuxSessionName(slotName))
+		}
+	}
 
 	// Summary
 	fmt.Println("\n════════════════════════════════════════")
@@ -562,7 +2270,14 @@ func cmdNew(args []string) {
 		fmt.Printf("✓ Slot %d ready\n\n", slotNum)
 	}
 	fmt.Printf("  Path: %s\n", slotPath)
-	fmt.Printf("  Branch: %s\n", branchName)
+	if branchName == "" {
+		fmt.Printf("  Branch: (detached at %.8s)\n", atRev)
+	} else {
+		fmt.Printf("  Branch: %s\n", branchName)
+	}
+	if !compose.IsEmpty() {
+		fmt.Printf("  Compose: %s\n", compose)
+	}
 	if len(portMap) > 0 {
 		fmt.Println("  Ports:")
 		for mainPort, slotPort := range portMap {
@@ -570,2570 +2285,11080 @@ func cmdNew(args []string) {
 		}
 	}
 	fmt.Println()
+	if timings != nil {
+		fmt.Println(timings.Report(time.Since(started)))
+	}
+
+	if withTmux {
+		fmt.Printf("→ slot-cli attach %s\n", worktree.SlotIdentifier(slotName, project))
+		return
+	}
 
 	// Copy cd command to clipboard
-	exec.Command("sh", "-c", fmt.Sprintf("echo 'cd %s' | pbcopy", slotPath)).Run()
-	fmt.Println("→ Cmd+T, Cmd+V, Enter")
+	if !noClipboard && copyToClipboard(fmt.Sprintf("cd %s", slotPath)) == nil {
+		fmt.Println("→ cd command copied: open a new terminal tab, paste, Enter")
+	} else {
+		fmt.Printf("→ cd %s\n", slotPath)
+	}
+	if len(skip) > 0 {
+		fmt.Printf("→ Skipped %s: run slot-cli provision in the slot when you need it\n", strings.Join(skip, ", "))
+	}
 	fmt.Println("→ Then: slot-cli start")
+	fmt.Printf("→ Or open it in your editor: slot-cli open %s\n", worktree.SlotIdentifier(slotName, project))
 }
 
-func cmdDelete(args []string) {
-	force := false
-	slotNum := 0
-	slotNameArg := ""
+// Timings records how long each phase of slot creation took (new --timings)
+type Timings = lifecycle.Timings
 
-	for _, arg := range args {
-		if arg == "--force" || arg == "-f" {
-			force = true
-		} else if n, err := strconv.Atoi(arg); err == nil {
-			slotNum = n
-		} else if arg != "" {
-			slotNameArg = arg
+// parseSkipFlags returns the steps disabled by --no-copy/--no-docker/--no-db/--no-deps.
+// Skipping docker also skips db: databases are cloned into the slot's containers.
+func parseSkipFlags(args []string) []string {
+	var skip []string
+	for _, step := range lifecycle.Steps {
+		if slices.Contains(args, "--no-"+step) || (step == "db" && slices.Contains(skip, "docker")) {
+			skip = append(skip, step)
 		}
 	}
+	return skip
+}
+
+// stepsToProvision picks the pending steps (every step with all) minus the skipped ones
+func stepsToProvision(pending, skip []string, all bool) []string {
+	var steps []string
+	for _, step := range lifecycle.Steps {
+		if (all || slices.Contains(pending, step)) && !slices.Contains(skip, step) {
+			steps = append(steps, step)
+		}
+	}
+	return steps
+}
 
-	if slotNum == 0 && slotNameArg == "" {
-		fmt.Println("Error: need slot number or name")
-		fmt.Println("Usage: slot-cli delete <number|name> [--force]")
-		os.Exit(1)
+// slotProvisioner does the setup steps for a slot of project with its
+// compose selection, redis copy and node_modules provision mode
+func slotProvisioner(project string, compose ComposeSelection, withRedis bool, provision string) lifecycle.Provisioner {
+	projectCfg := loadRegistry().Projects[project]
+	return lifecycle.Provisioner{
+		CopyFiles: func(s lifecycle.Slot) {
+			copyGitignored(s.MainRepo, s.Path)
+		},
+		ResolveSecrets: func(s lifecycle.Slot) {
+			resolveSlotSecrets(s.Path)
+		},
+		MainPostgres: func(s lifecycle.Slot) []dbclone.Target {
+			return mainPostgres(s.MainRepo)
+		},
+		AllocatePorts: func(s lifecycle.Slot, offset int) map[int]int {
+			return scanAndAllocatePorts(s.MainRepo, offset)
+		},
+		RewritePorts: func(s lifecycle.Slot, portMap map[int]int) {
+			updateSlotEnvFiles(s.Path, portMap, s.Name)
+			updateConfigFiles(s.Path, portMap)
+			updateDockerComposeFiles(s.Path, s.Name, portMap)
+			ensureDockerComposeEnvFiles(s.Path, portMap, s.Name)
+		},
+		RenameDB: func(s lifecycle.Slot, port int, oldDB, newDB string) {
+			renameSlotDB(s.Path, port, oldDB, newDB)
+		},
+		StartDocker: func(s lifecycle.Slot, withDB bool, opts lifecycle.ProvisionOptions) {
+			if opts.SharedPostgres {
+				compose.Skip = postgresServices(s.Path)
+			}
+			startDockerAndClone(s.MainRepo, s.Path, compose, withRedis, withDB, opts.SharedPostgres, opts.Timings)
+		},
+		DBFiles: projectCfg.SQLiteFiles,
+		CopyDBFiles: func(s lifecycle.Slot, files []string) {
+			copySQLiteFiles(s.MainRepo, s.Path, files)
+		},
+		InstallDeps: func(s lifecycle.Slot) {
+			installDeps(s.MainRepo, s.Path, provision, projectCfg.Install)
+		},
 	}
+}
+
+// cmdProvision runs the setup steps a lightweight `new --no-*` skipped
+func cmdProvision(args []string) {
+	trackedFileMode, args = parseTrackedFileMode(args)
+	provision, args := extractFlag(args, "--provision")
+	all := slices.Contains(args, "--all")
+	skip := parseSkipFlags(args)
 
 	cwd, _ := os.Getwd()
-	mainRepo, project := detectProject(cwd)
+	mainRepo, project := worktree.DetectProject(cwd)
 
-	var slotName, slotPath string
-	if slotNameArg != "" {
-		slotName = fmt.Sprintf("%s-%s", project, slotNameArg)
-	} else {
-		slotName = fmt.Sprintf("%s-%d", project, slotNum)
+	if mainRepo == "" {
+		fail(exitUsage, "not in a git repository")
 	}
-	slotPath = filepath.Join(filepath.Dir(mainRepo), slotName)
-
-	if _, err := os.Stat(slotPath); os.IsNotExist(err) {
-		fmt.Printf("Error: Slot %s not found\n", slotName)
-		os.Exit(1)
+	if mainRepo == cwd {
+		fail(exitUsage, "must run from a slot worktree, not main")
 	}
 
-	// Check lock
+	slotPath := cwd
+	slotName := filepath.Base(slotPath)
 	reg := loadRegistry()
-	if slot, ok := reg.Slots[slotName]; ok && slot.Locked {
-		fmt.Printf("Error: Slot '%s' is LOCKED\n", slotName)
-		if slot.LockNote != "" {
-			fmt.Printf("  Note: %s\n", slot.LockNote)
-		}
-		fmt.Println("\nUnlock first: slot-cli unlock")
-		os.Exit(1)
-	}
-
-	// Check for uncommitted changes
-	out, _ := exec.Command("git", "-C", slotPath, "status", "--porcelain").Output()
-	if len(out) > 0 && !force {
-		fmt.Println("Warning: Slot has uncommitted changes")
-		fmt.Println("Use --force to delete anyway")
-		os.Exit(1)
+	slot, ok := reg.Slots[slotName]
+	if !ok {
+		fail(exitNotFound, fmt.Sprintf("slot %s is not in the registry", slotName))
 	}
+	projectCfg := reg.Projects[project]
 
-	// Stop docker
-	stopDocker(slotPath)
-
-	// Remove worktree
-	branchName := getBranchName(slotPath)
-	exec.Command("git", "-C", mainRepo, "worktree", "remove", slotPath, "--force").Run()
-	exec.Command("git", "-C", mainRepo, "branch", "-D", branchName).Run()
-
-	// Update registry
-	removeFromRegistry(slotName)
-
-	if slotNameArg != "" {
-		fmt.Printf("✓ Deleted slot '%s'\n", slotNameArg)
-	} else {
-		fmt.Printf("✓ Deleted slot %d\n", slotNum)
+	steps := stepsToProvision(slot.Pending, skip, all)
+	if len(steps) == 0 {
+		fmt.Println("✓ Nothing to provision (use --all to redo every step)")
+		return
 	}
-}
 
-func cmdList() {
-	fmt.Println("╔══════════════════════════════════════════════════════════════════╗")
-	fmt.Println("║                    CLAUDE INSTANCES                              ║")
-	fmt.Println("╚══════════════════════════════════════════════════════════════════╝")
+	fmt.Println("═══════════════════════════════════════════════════════════")
+	fmt.Printf("  PROVISION: %s (%s)\n", slotName, strings.Join(steps, ", "))
+	fmt.Println("═══════════════════════════════════════════════════════════")
 	fmt.Println()
 
-	out, err := exec.Command("pgrep", "-f", "claude").Output()
-	if err != nil {
-		fmt.Println("No Claude instances running.")
-		return
+	// Ports were mapped at creation; only files copied now still hold main's
+	portOffset := 0
+	if slices.Contains(steps, "copy") {
+		portOffset = slot.PortOffset
+		if portOffset == 0 {
+			portOffset = slot.Number
+		}
+		if portOffset == 0 {
+			portOffset = worktree.NextSlotNumber(mainRepo, project)
+		}
 	}
 
-	pids := strings.Fields(string(out))
-	for _, pid := range pids {
-		info := getClaudeInfo(pid)
-		if info != nil {
-			fmt.Printf("┌─ %s\n", info["project"])
-			fmt.Printf("│  Branch:  %s\n", info["branch"])
-			fmt.Printf("│  Session: %s\n", info["session"])
-			fmt.Printf("│  Model:   %s\n", info["model"])
-			fmt.Printf("│  Runtime: %s\n", info["runtime"])
-			fmt.Println("└──────────────────────────────────────")
-			fmt.Println()
+	compose := ComposeSelection{Profiles: slot.Profiles, Services: slot.Services}
+	lifecycle.Provision(lifecycleEnv(),
+		slotProvisioner(project, compose, projectCfg.CopyRedis, parseProvisionMode(firstNonEmpty(provision, projectCfg.Provision))),
+		lifecycle.Slot{MainRepo: mainRepo, Project: project, Name: slotName, Path: slotPath, Branch: slot.Branch},
+		portOffset, lifecycle.ProvisionOptions{Steps: steps, SharedPostgres: slot.SharedPostgres})
+
+	modifySlot(slotName, func(s *SlotConfig) {
+		s.Pending = slices.DeleteFunc(s.Pending, func(step string) bool {
+			return slices.Contains(steps, step)
+		})
+		if portOffset > 0 {
+			s.PortOffset = portOffset
 		}
-	}
-}
+	})
 
-func cmdStart() {
-	cmd := exec.Command("bash", "-lc", "claude --dangerously-skip-permissions")
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Run()
+	fmt.Println("\n✓ Slot provisioned")
 }
 
-func cmdContinue() {
-	cmd := exec.Command("bash", "-lc", "claude --continue --dangerously-skip-permissions")
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Run()
+// DeleteOptions are the delete flags applied to each slot
+type DeleteOptions struct {
+	Force   bool
+	DryRun  bool
+	NoTrash bool
+	// Confirmed skips the per-slot prompts: a bulk delete asked once for all
+	Confirmed bool
 }
 
-func cmdCheck(args []string) {
-	slotNum := 0
+func cmdDelete(args []string) {
+	projectFlag, args := extractFlag(args, "--project")
+	var opts DeleteOptions
+	all, allMerged := false, false
+	var ids []string
+
 	for _, arg := range args {
-		if n, err := strconv.Atoi(arg); err == nil {
-			slotNum = n
-			break
+		if arg == "--force" || arg == "-f" {
+			opts.Force = true
+		} else if arg == "--dry-run" {
+			opts.DryRun = true
+		} else if arg == "--no-trash" {
+			opts.NoTrash = true
+		} else if arg == "--all" {
+			all = true
+		} else if arg == "--all-merged" {
+			allMerged = true
+		} else if arg != "" && arg != "0" {
+			ids = append(ids, arg)
 		}
 	}
 
+	usage := []string{
+		"Usage: slot-cli delete <number|name>... [--force] [--dry-run] [--no-trash]",
+		"       slot-cli delete --all-merged | --project <p> --all",
+	}
+	switch {
+	case len(ids) == 0 && !all && !allMerged:
+		fail(exitUsage, "need slot number or name", usage...)
+	case len(ids) > 0 && (all || allMerged), all && allMerged:
+		fail(exitUsage, "give slots, --all or --all-merged, not several", usage...)
+	case all && projectFlag == "":
+		fail(exitUsage, "--all needs --project <p>", usage...)
+	}
+
 	cwd, _ := os.Getwd()
-	if slotNum == 0 {
-		// Try to detect from current directory name
-		base := filepath.Base(cwd)
-		re := regexp.MustCompile(`-(\d+)$`)
-		if m := re.FindStringSubmatch(base); len(m) > 1 {
-			slotNum, _ = strconv.Atoi(m[1])
+	mainRepo, project := worktree.DetectProject(cwd)
+	reg := loadRegistry()
+	if projectFlag != "" {
+		projectCfg, ok := reg.Projects[projectFlag]
+		if !ok {
+			fail(exitNotFound, fmt.Sprintf("project '%s' not in registry", projectFlag))
 		}
+		mainRepo, project = projectCfg.Path, projectFlag
 	}
 
-	if slotNum == 0 {
-		fmt.Println("Error: need slot number or run from slot directory")
-		os.Exit(1)
+	if len(ids) == 1 {
+		if err := deleteSlot(mainRepo, project, ids[0], opts); err != nil {
+			fail(err.Code, err.Message, err.Hints...)
+		}
+		return
 	}
 
-	mainRepo, project := detectProject(cwd)
-	slotName := fmt.Sprintf("%s-%d", project, slotNum)
-	slotPath := filepath.Join(filepath.Dir(mainRepo), slotName)
+	ids = deleteTargets(reg, project, ids, all, allMerged, func(name string) bool {
+		return mergedSlot(reg, name, mainRepo)
+	})
+	if len(ids) == 0 && allMerged {
+		fmt.Println("No clean, merged slots to delete (new slots are kept for clean_grace, default 24h).")
+		return
+	} else if len(ids) == 0 {
+		fmt.Println("No slots to delete.")
+		return
+	}
 
-	fmt.Println("═══════════════════════════════════════")
-	fmt.Printf("  SLOT VALIDATION: %s\n", slotName)
-	fmt.Println("═══════════════════════════════════════")
+	// One summary and one confirmation for the batch instead of a prompt per slot
+	fmt.Printf("Slots of %s to delete:\n", project)
+	for _, id := range ids {
+		name := project + "-" + id
+		line := fmt.Sprintf("  • %s  (%s)", name, reg.Slots[name].Branch)
+		if notes := deleteWarnings(reg, mainRepo, name); len(notes) > 0 && !opts.Force {
+			line += "  " + yellow.Sprint("⚠ "+strings.Join(notes, ", "))
+		}
+		fmt.Println(line)
+	}
+	if !opts.DryRun && !confirm(fmt.Sprintf("\nDelete %d slot(s)?", len(ids))) {
+		fail(exitAborted, "aborted")
+	}
+	opts.Confirmed = true
 	fmt.Println()
 
-	errors := 0
-
-	// Check directory exists
-	if _, err := os.Stat(slotPath); err == nil {
-		fmt.Println("✓ Directory exists")
-	} else {
-		fmt.Println("✗ Directory missing")
-		errors++
+	failed := 0
+	for _, id := range ids {
+		fmt.Printf("─── %s-%s ───\n", project, id)
+		if err := deleteSlot(mainRepo, project, id, opts); err != nil {
+			fmt.Printf("✗ %s\n", err.Message)
+			failed++
+		}
 	}
-
-	// Check is worktree
-	gitFile := filepath.Join(slotPath, ".git")
-	if info, err := os.Stat(gitFile); err == nil && !info.IsDir() {
-		fmt.Println("✓ Is git worktree")
-	} else {
-		fmt.Println("✗ Not a git worktree")
-		errors++
+	if failed > 0 {
+		fail(exitError, fmt.Sprintf("%d of %d slot(s) not deleted", failed, len(ids)))
 	}
+}
 
-	// Check branch
-	branch := getBranchName(slotPath)
-	if branch != "" {
-		fmt.Printf("✓ Branch: %s\n", branch)
-	} else {
-		fmt.Println("✗ Could not detect branch")
-		errors++
+// deleteTargets returns the slot ids a bulk delete acts on: the ids given, or
+// every slot of project (--all), or those merged accepts (--all-merged)
+func deleteTargets(reg *Registry, project string, ids []string, all, allMerged bool, merged func(name string) bool) []string {
+	if !all && !allMerged {
+		return ids
 	}
-
-	fmt.Println()
-	fmt.Println("═══════════════════════════════════════")
-	if errors == 0 {
-		fmt.Println("  ✓ ALL CHECKS PASSED")
-	} else {
-		fmt.Printf("  ✗ %d ISSUES FOUND\n", errors)
+	var targets []string
+	for _, name := range projectSlotNames(reg, project) {
+		if all || merged(name) {
+			targets = append(targets, worktree.SlotIdentifier(name, project))
+		}
 	}
-	fmt.Println("═══════════════════════════════════════")
+	return targets
 }
 
-func cmdSync() {
-	cwd, _ := os.Getwd()
-	mainRepo, _ := detectProject(cwd)
-
-	if mainRepo == "" {
-		fmt.Println("Error: not in a git repository")
-		os.Exit(1)
+// deleteWarnings lists what deleting a slot would lose, for the bulk summary:
+// uncommitted changes (saved as a patch) and commits that exist nowhere else
+func deleteWarnings(reg *Registry, mainRepo, name string) []string {
+	if reg.Slots[name].Host != "" {
+		return nil
 	}
-
-	// Check if we're in a slot (worktree)
-	if mainRepo == cwd {
-		fmt.Println("Error: already in main worktree, nothing to sync")
-		os.Exit(1)
+	path := filepath.Join(filepath.Dir(mainRepo), name)
+	if !fileExists(path) {
+		return []string{"not found"}
 	}
-
-	branch := getBranchName(cwd)
-	if branch == "" {
-		fmt.Println("Error: could not detect current branch")
-		os.Exit(1)
+	var notes []string
+	check := lifecycle.Inspect(lifecycle.Slot{MainRepo: mainRepo, Name: name, Path: path, Branch: worktree.BranchName(path)})
+	if check.Dirty {
+		notes = append(notes, "uncommitted changes")
 	}
-
-	fmt.Printf("Syncing slot branch '%s' with main...\n\n", branch)
-
-	// Check for uncommitted changes
-	out, _ := exec.Command("git", "-C", cwd, "status", "--porcelain").Output()
-	if len(out) > 0 {
-		fmt.Println("Error: uncommitted changes detected")
-		fmt.Println("Please commit or stash your changes before syncing")
-		os.Exit(1)
+	if len(check.Unpushed) > 0 {
+		notes = append(notes, fmt.Sprintf("%d unpushed commit(s)", len(check.Unpushed)))
 	}
+	return notes
+}
 
-	// Fetch latest from origin
-	fmt.Println("Fetching latest from origin...")
-	if err := runCmd(cwd, "git", "fetch", "origin", "main:main"); err != nil {
-		// Try without the ref update (origin/main might not exist locally)
-		runCmd(cwd, "git", "fetch", "origin", "main")
+// projectSlotNames lists a project's registered slots in slot order
+func projectSlotNames(reg *Registry, project string) []string {
+	var names []string
+	for name, slot := range reg.Slots {
+		if slot.Project == project {
+			names = append(names, name)
+		}
 	}
-	fmt.Println("✓ Fetched latest main")
-
-	// Check if rebase is needed
-	behindOut, _ := exec.Command("git", "-C", cwd, "rev-list", "--count", branch+"..main").Output()
-	behind := strings.TrimSpace(string(behindOut))
-
-	aheadOut, _ := exec.Command("git", "-C", cwd, "rev-list", "--count", "main.."+branch).Output()
-	ahead := strings.TrimSpace(string(aheadOut))
-
-	fmt.Printf("\nStatus: %s commits ahead, %s commits behind main\n", ahead, behind)
+	slices.SortFunc(names, func(a, b string) int {
+		return cmp.Or(cmp.Compare(reg.Slots[a].Number, reg.Slots[b].Number), strings.Compare(a, b))
+	})
+	return names
+}
 
-	if behind == "0" {
-		fmt.Println("\n✓ Already up to date with main")
-		return
+// mergedSlot reports whether a local slot is safe for delete --all-merged:
+// unlocked, clean, past the clean grace period and its HEAD already in main
+func mergedSlot(reg *Registry, name, mainRepo string) bool {
+	slot := reg.Slots[name]
+	path := reg.SlotPath(name)
+	if slot.Host != "" || slot.LockActive(time.Now()) || !fileExists(path) {
+		return false
+	}
+	if grace, err := cleanGrace(""); err == nil {
+		if info, err := os.Stat(filepath.Join(path, ".git")); err == nil && slotAge(slot.CreatedAt, info.ModTime(), time.Now()) < grace {
+			return false
+		}
+	}
+	if dirty, _ := exec.Command("git", "-C", path, "status", "--porcelain").Output(); len(bytes.TrimSpace(dirty)) > 0 {
+		return false
 	}
+	return worktree.IsMerged(path, mainRepo)
+}
 
-	// Perform rebase
-	fmt.Println("\nRebasing on main...")
-	cmd := exec.Command("git", "-C", cwd, "rebase", "main")
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+// deleteSlot deletes one slot of project given its number or name
+func deleteSlot(mainRepo, project, id string, opts DeleteOptions) *APIError {
+	slotName := fmt.Sprintf("%s-%s", project, id)
+	slotPath := filepath.Join(filepath.Dir(mainRepo), slotName)
 
-	if err := cmd.Run(); err != nil {
-		fmt.Println("\n⚠ Rebase conflict detected!")
-		fmt.Println("\nTo resolve:")
-		fmt.Println("  1. Fix conflicts in the affected files")
-		fmt.Println("  2. git add <fixed files>")
-		fmt.Println("  3. git rebase --continue")
-		fmt.Println("\nTo abort:")
-		fmt.Println("  git rebase --abort")
-		os.Exit(1)
+	// Remote slots are deleted by slot-cli on their host
+	if slot := loadRegistry().Slots[slotName]; slot.Host != "" {
+		remoteArgs := []string{"delete", id}
+		if opts.Force {
+			remoteArgs = append(remoteArgs, "--force")
+		}
+		if assumeYes || opts.Confirmed {
+			remoteArgs = append(remoteArgs, "--yes")
+		}
+		if opts.DryRun {
+			remoteArgs = append(remoteArgs, "--dry-run")
+		}
+		if err := remote.Run(slot.Host, slot.RemotePath, remoteArgs...); err != nil {
+			return &APIError{Code: exitError, Message: fmt.Sprintf("slot-cli delete on %s failed: %v", slot.Host, err)}
+		}
+		if !opts.DryRun {
+			removeFromRegistry(slotName)
+			fmt.Printf("✓ Dropped %s from the local registry\n", slotName)
+		}
+		return nil
 	}
 
-	fmt.Println("\n✓ Successfully synced with main")
+	if _, err := os.Stat(slotPath); os.IsNotExist(err) {
+		return &APIError{Code: exitNotFound, Message: fmt.Sprintf("Slot %s not found", slotName)}
+	}
 
-	// Install dependencies after rebase
-	installDeps(cwd)
-}
+	// Check lock
+	if slot := loadRegistry().Slots[slotName]; slot.LockBlocks(false, time.Now()) {
+		return lockError(slotName, slot)
+	}
 
-func cmdMerge(args []string) {
-	slotNum := 0
-	for _, arg := range args {
-		if n, err := strconv.Atoi(arg); err == nil {
-			slotNum = n
-			break
+	s := lifecycle.Slot{MainRepo: mainRepo, Project: project, Name: slotName, Path: slotPath, Branch: worktree.BranchName(slotPath)}
+	check := lifecycle.Inspect(s)
+	if check.Dirty && !opts.Force && !opts.Confirmed && !opts.DryRun {
+		fmt.Println("Warning: Slot has uncommitted changes")
+		if !confirm("Delete anyway?") {
+			return &APIError{Code: exitDirty, Message: "slot has uncommitted changes", Hints: []string{"Use --force to delete anyway"}}
 		}
 	}
 
-	if slotNum == 0 {
-		fmt.Println("Error: need slot number")
-		fmt.Println("Usage: slot-cli merge <N>")
-		os.Exit(1)
+	// Commits that exist nowhere else are lost with the branch
+	if commits := check.Unpushed; len(commits) > 0 && !opts.Force && !opts.Confirmed && !opts.DryRun {
+		fmt.Printf("Warning: branch has %d commit(s) that are not in main or on any remote:\n", len(commits))
+		for i, c := range commits {
+			if i == 5 {
+				fmt.Printf("  … and %d more\n", len(commits)-5)
+				break
+			}
+			fmt.Printf("  %s\n", c)
+		}
+		if !confirm("Delete anyway?") {
+			return &APIError{Code: exitDirty, Message: "branch has unpushed commits", Hints: []string{"Use --force to delete anyway"}}
+		}
 	}
 
-	cwd, _ := os.Getwd()
-	mainRepo, _ := detectProject(cwd)
-
-	if mainRepo == "" {
-		fmt.Println("Error: not in a git repository")
-		os.Exit(1)
+	if opts.DryRun {
+		fmt.Printf("Dry run: delete %s\n\n", slotName)
+		planSlotRemoval(mainRepo, slotName, slotPath, s.Branch, !opts.NoTrash)
+		fmt.Println("\nThis is a dry run. Run without --dry-run to apply.")
+		return nil
 	}
 
-	// Must be run from main worktree
-	if mainRepo != cwd {
-		fmt.Println("Error: must run from main worktree, not from a slot")
-		os.Exit(1)
+	// Into the trash (undelete restores it), or with --no-trash outright
+	// (the undo journal keeps branch and changes)
+	removed, err := lifecycle.Delete(lifecycleEnv(), s, opts.NoTrash)
+	if err != nil {
+		return &APIError{Code: exitError, Message: err.Error(),
+			Hints: []string{"The worktree was left in place", "Delete it outright with: slot-cli delete " + id + " --no-trash"}}
 	}
+	killSlotTmux(slotName)
 
-	branchName := fmt.Sprintf("slot-%d", slotNum)
-
-	// Check branch exists
-	out, err := exec.Command("git", "-C", mainRepo, "branch", "--list", branchName).Output()
-	if err != nil || strings.TrimSpace(string(out)) == "" {
-		fmt.Printf("Error: branch '%s' not found\n", branchName)
-		os.Exit(1)
+	if _, err := strconv.Atoi(id); err == nil {
+		fmt.Printf("✓ Deleted slot %s\n", id)
+	} else {
+		fmt.Printf("✓ Deleted slot '%s'\n", id)
+	}
+	if removed.Trashed != "" {
+		fmt.Printf("  Moved to %s for %d days; restore with: slot-cli undelete %s\n", removed.Trashed, trashDays(), slotName)
 	}
+	return nil
+}
 
-	fmt.Printf("Merging %s into main...\n", branchName)
+func trashDir() string {
+	return filepath.Join(filepath.Dir(registryPath), "trash")
+}
 
-	cmd := exec.Command("git", "-C", mainRepo, "merge", branchName)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+// trashDays is how long deleted slots stay in the trash (config trash_days)
+func trashDays() int {
+	return cmp.Or(loadConfig().TrashDays, 7)
+}
 
-	if err := cmd.Run(); err != nil {
-		fmt.Println("\n⚠ Merge conflict!")
-		fmt.Println("Resolve conflicts, then: git commit")
-		os.Exit(1)
+// trashSlot moves a slot's worktree into the trash and pins its commit with a
+// ref, so deleting the branch loses nothing; returns the trash directory
+func trashSlot(mainRepo, slotName, slotPath, branch string) (string, error) {
+	out, err := exec.Command("git", "-C", slotPath, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return "", fmt.Errorf("no HEAD commit")
+	}
+	entry, err := trash.Put(trashDir(), fmt.Sprintf("%s-%s", slotName, time.Now().Format("20060102-150405")), UndoEntry{
+		Time:     time.Now().Format(time.RFC3339),
+		Action:   "delete",
+		MainRepo: mainRepo,
+		SlotName: slotName,
+		SlotPath: slotPath,
+		Branch:   branch,
+		SHA:      strings.TrimSpace(string(out)),
+		Slot:     loadRegistry().Slots[slotName],
+	})
+	if err != nil {
+		return "", err
 	}
-
-	fmt.Printf("\n✓ Merged %s into main\n", branchName)
+	// The worktree's admin dir points at a path that is gone now
+	auditedRun("delete", slotName, exec.Command("git", "-C", mainRepo, "worktree", "prune"))
+	return entry.Dir, nil
 }
 
-func cmdDone(args []string) {
-	force := false
-	for _, arg := range args {
-		if arg == "--force" || arg == "-f" {
-			force = true
+// purgeTrash empties the trash of slots deleted more than trash_days ago
+func purgeTrash(now time.Time) {
+	for _, e := range trash.Expired(trash.Load(trashDir()), trashDays(), now) {
+		if e.Slot.SharedPostgres {
+			dropSharedDBs(e.MainRepo, e.Slot.Project, e.SlotName)
 		}
+		trash.Remove(e)
+		recordAudit(AuditEntry{Action: "trash-purge", Slot: e.SlotName, Detail: e.Dir})
 	}
+}
 
-	cwd, _ := os.Getwd()
-	mainRepo, project := detectProject(cwd)
-
-	if mainRepo == "" {
-		fmt.Println("Error: not in a git repository")
-		os.Exit(1)
-	}
+// cmdUndelete moves a deleted slot back from the trash: its branch, worktree
+// (uncommitted changes included) and registry entry
+func cmdUndelete(args []string) {
+	purgeTrash(time.Now())
+	entries := trash.Load(trashDir())
 
-	// Must be run from a slot (worktree), not main
-	if mainRepo == cwd {
-		fmt.Println("Error: must run from a slot worktree, not main")
-		os.Exit(1)
+	if len(args) == 0 || args[0] == "--list" || args[0] == "list" {
+		if len(entries) == 0 {
+			fmt.Println("The trash is empty.")
+			return
+		}
+		fmt.Printf("Deleted slots (kept %d days):\n", trashDays())
+		for i := len(entries) - 1; i >= 0; i-- {
+			e := entries[i]
+			fmt.Printf("  %s  %-24s %s @ %.8s\n", e.Time, e.SlotName, e.Branch, e.SHA)
+		}
+		if len(args) == 0 {
+			fmt.Println("\nRestore one with: slot-cli undelete <slot>")
+		}
+		return
 	}
 
-	slotPath := cwd
-	branchName := getBranchName(slotPath)
-	slotName := filepath.Base(slotPath)
-
-	// Check lock
-	reg := loadRegistry()
-	if slot, ok := reg.Slots[slotName]; ok && slot.Locked {
-		fmt.Printf("Error: Slot '%s' is LOCKED\n", slotName)
-		if slot.LockNote != "" {
-			fmt.Printf("  Note: %s\n", slot.LockNote)
-		}
-		fmt.Println("\nUnlock first: slot-cli unlock")
-		os.Exit(1)
+	// Most recent entry for the slot (full name or number/suffix)
+	idx := len(entries) - 1
+	for idx >= 0 && entries[idx].SlotName != args[0] && !strings.HasSuffix(entries[idx].SlotName, "-"+args[0]) {
+		idx--
+	}
+	if idx < 0 {
+		fail(exitNotFound, fmt.Sprintf("no deleted slot '%s' in the trash", args[0]), "List them with: slot-cli undelete --list")
+	}
+	e := entries[idx]
+	if _, err := os.Stat(e.SlotPath); err == nil {
+		fail(exitExists, fmt.Sprintf("%s already exists", e.SlotPath))
 	}
-	_ = project // used later
 
-	fmt.Printf("Completing slot: %s\n\n", slotName)
+	fmt.Printf("Restoring %s (%s, deleted at %s)\n\n", e.SlotName, e.Branch, e.Time)
 
-	// Check for uncommitted changes
-	out, _ := exec.Command("git", "-C", slotPath, "status", "--porcelain").Output()
-	if len(out) > 0 && !force {
-		fmt.Println("Error: uncommitted changes detected")
-		fmt.Println("Commit your changes or use --force to skip")
-		os.Exit(1)
+	// A fresh worktree registration without checkout, then the trashed
+	// files (the old .git link is stale after prune)
+	if e.Branch == "" {
+		if err := runCmd(e.MainRepo, "git", "worktree", "add", "--no-checkout", "--detach", e.SlotPath, e.SHA); err != nil {
+			fail(exitError, "could not re-create worktree")
+		}
+	} else {
+		out, err := exec.Command("git", "-C", e.MainRepo, "rev-parse", "--verify", "refs/heads/"+e.Branch).Output()
+		if err == nil && strings.TrimSpace(string(out)) != e.SHA {
+			fail(exitExists, fmt.Sprintf("branch '%s' already exists at a different commit", e.Branch))
+		}
+		if err != nil {
+			if err := auditedRun("undelete", e.SlotName, exec.Command("git", "-C", e.MainRepo, "branch", e.Branch, e.Ref)); err != nil {
+				fail(exitError, fmt.Sprintf("could not recreate branch from %s", e.Ref))
+			}
+		}
+		fmt.Printf("✓ Branch %s at %.8s\n", e.Branch, e.SHA)
+		if err := runCmd(e.MainRepo, "git", "worktree", "add", "--no-checkout", e.SlotPath, e.Branch); err != nil {
+			fail(exitError, "could not re-create worktree")
+		}
 	}
+	files, _ := os.ReadDir(e.Dir)
+	for _, f := range files {
+		if f.Name() == ".git" {
+			continue
+		}
+		if err := trash.MoveDir(filepath.Join(e.Dir, f.Name()), filepath.Join(e.SlotPath, f.Name())); err != nil {
+			fail(exitError, fmt.Sprintf("could not move %s back: %v", f.Name(), err), "The rest is still in "+e.Dir)
+		}
+	}
+	// Index from HEAD; the files on disk keep the uncommitted changes
+	exec.Command("git", "-C", e.SlotPath, "reset", "-q").Run()
+	fmt.Println("✓ Restored worktree with its uncommitted changes")
 
-	// Stop docker first
-	fmt.Println("Stopping docker...")
-	stopDocker(slotPath)
-	fmt.Println("✓ Docker stopped")
-
-	// Go to main and merge
-	fmt.Printf("\nMerging %s into main...\n", branchName)
-	cmd := exec.Command("git", "-C", mainRepo, "merge", branchName)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	reg := loadRegistry()
+	if e.Slot.Project != "" {
+		reg.Slots[e.SlotName] = e.Slot
+	} else {
+		reg.Slots[e.SlotName] = SlotConfig{
+			Project:   filepath.Base(e.MainRepo),
+			Branch:    e.Branch,
+			CreatedAt: time.Now().Format(time.RFC3339),
+		}
+	}
+	saveRegistry(reg)
+	refreshSlotDNS()
+	trash.Remove(e)
+
+	// The undo journal's copy of this deletion is spent
+	journal := loadUndoJournal()
+	for i := len(journal) - 1; i >= 0; i-- {
+		if journal[i].SlotName == e.SlotName && journal[i].SHA == e.SHA {
+			if journal[i].Patch != "" {
+				os.Remove(journal[i].Patch)
+			}
+			saveUndoJournal(append(journal[:i:i], journal[i+1:]...))
+			break
+		}
+	}
 
-	if err := cmd.Run(); err != nil {
-		fmt.Println("\n⚠ Merge conflict!")
-		fmt.Println("Resolve conflicts in main, then manually delete slot:")
-		fmt.Printf("  cd %s\n", mainRepo)
-		fmt.Println("  git commit")
-		fmt.Printf("  slot-cli delete %s\n", extractSlotIdentifier(slotName, project))
-		os.Exit(1)
+	fmt.Printf("\n✓ Restored %s\n", e.SlotName)
+	if e.Slot.SharedPostgres {
+		fmt.Println("  Its databases on main's postgres were kept while it was in the trash")
+		return
 	}
-	fmt.Printf("✓ Merged %s into main\n", branchName)
+	fmt.Println("  Docker volumes were not restored; run `slot-cli start` and `slot-cli db-sync` in the slot")
+}
 
-	// Remove worktree and branch
-	fmt.Println("\nCleaning up...")
-	exec.Command("git", "-C", mainRepo, "worktree", "remove", slotPath, "--force").Run()
-	exec.Command("git", "-C", mainRepo, "branch", "-D", branchName).Run()
-	fmt.Println("✓ Removed worktree and branch")
+const maxUndoEntries = 20
 
-	// Update registry
-	removeFromRegistry(slotName)
+func undoJournalPath() string {
+	return filepath.Join(filepath.Dir(registryPath), "undo.json")
+}
 
-	fmt.Printf("\n✓ Slot done! Now in main with merged changes.\n")
-	fmt.Printf("\n  cd %s\n", mainRepo)
+func loadUndoJournal() []UndoEntry {
+	var entries []UndoEntry
+	if data, err := os.ReadFile(undoJournalPath()); err == nil {
+		json.Unmarshal(data, &entries)
+	}
+	return entries
 }
 
-func cmdPR(args []string) {
-	cwd, _ := os.Getwd()
-	mainRepo, _ := detectProject(cwd)
+func saveUndoJournal(entries []UndoEntry) {
+	entries, dropped := trimUndoJournal(entries, maxUndoEntries)
+	for _, e := range dropped {
+		if e.Patch != "" {
+			os.Remove(e.Patch)
+		}
+	}
+	os.MkdirAll(filepath.Dir(undoJournalPath()), 0755)
+	data, _ := json.MarshalIndent(entries, "", "  ")
+	os.WriteFile(undoJournalPath(), data, 0600)
+}
 
-	if mainRepo == "" {
-		fmt.Println("Error: not in a git repository")
-		os.Exit(1)
+// trimUndoJournal keeps the newest max entries and returns the ones dropped
+func trimUndoJournal(entries []UndoEntry, max int) ([]UndoEntry, []UndoEntry) {
+	if len(entries) <= max {
+		return entries, nil
 	}
+	cut := len(entries) - max
+	return entries[cut:], entries[:cut]
+}
 
-	// Can run from slot or detect slot from args
-	slotPath := cwd
-	if mainRepo == cwd {
-		fmt.Println("Error: must run from a slot worktree")
-		os.Exit(1)
+// journalSlotRemoval records a slot's branch, commit, uncommitted work and
+// registry entry before it is removed, so `slot-cli undo` can restore it
+func journalSlotRemoval(action, mainRepo, slotName, slotPath, branch string) {
+	out, err := exec.Command("git", "-C", slotPath, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return
+	}
+	entry := UndoEntry{
+		Time:     time.Now().Format(time.RFC3339),
+		Action:   action,
+		MainRepo: mainRepo,
+		SlotName: slotName,
+		SlotPath: slotPath,
+		Branch:   branch,
+		SHA:      strings.TrimSpace(string(out)),
+		Slot:     loadRegistry().Slots[slotName],
 	}
 
-	branchName := getBranchName(slotPath)
-	if branchName == "" {
-		fmt.Println("Error: could not detect branch")
-		os.Exit(1)
+	if patch := captureWorktreePatch(slotPath); len(patch) > 0 {
+		dir := filepath.Join(filepath.Dir(registryPath), "undo")
+		os.MkdirAll(dir, 0700)
+		path := filepath.Join(dir, fmt.Sprintf("%s-%s.patch", slotName, time.Now().Format("20060102-150405")))
+		if os.WriteFile(path, patch, 0600) == nil {
+			entry.Patch = path
+		}
 	}
 
-	fmt.Printf("Creating PR for branch: %s\n\n", branchName)
+	saveUndoJournal(append(loadUndoJournal(), entry))
+}
 
-	// Push to origin with upstream tracking
-	fmt.Println("Pushing to origin...")
-	cmd := exec.Command("git", "-C", slotPath, "push", "-u", "origin", branchName)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
-		fmt.Println("Error: failed to push")
-		os.Exit(1)
+// exportUncommitted saves a slot's uncommitted changes (untracked files
+// included) to ~/.config/slots/patches before it is removed, and prints how
+// to apply them again. Unlike the undo journal's copy it is never pruned.
+// Returns the patch path, or "" when there was nothing to save.
+func exportUncommitted(slotName, slotPath string) string {
+	patch := captureWorktreePatch(slotPath)
+	if len(patch) == 0 {
+		return ""
 	}
-	fmt.Println("✓ Pushed to origin")
-
-	// Create PR using gh
-	fmt.Println("\nCreating PR...")
-	cmd = exec.Command("gh", "pr", "create", "--fill")
-	cmd.Dir = slotPath
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
-		fmt.Println("\n⚠ PR creation failed (may already exist)")
-		fmt.Println("View existing PRs: gh pr list")
+	sha, _ := exec.Command("git", "-C", slotPath, "rev-parse", "HEAD").Output()
+	base := fmt.Sprintf("%s (%s at %s)", slotName, worktree.BranchName(slotPath), strings.TrimSpace(string(sha)))
+	dir := filepath.Join(filepath.Dir(registryPath), "patches")
+	path := filepath.Join(dir, fmt.Sprintf("%s-%s.patch", slotName, time.Now().Format("20060102-150405")))
+	os.MkdirAll(dir, 0700)
+	// git apply skips the header lines before the first diff
+	header := fmt.Sprintf("Uncommitted changes of %s, saved %s\n\n", base, time.Now().Format(time.RFC3339))
+	if err := os.WriteFile(path, append([]byte(header), patch...), 0600); err != nil {
+		fmt.Printf("⚠ Could not save uncommitted changes: %v\n", err)
+		return ""
 	}
+	fmt.Printf("✓ Saved uncommitted changes to %s\n", path)
+	fmt.Printf("  Recover in a checkout of %.8s: git apply --binary %s\n", strings.TrimSpace(string(sha)), path)
+	return path
 }
 
-func cmdClean(args []string) {
-	doClean := false
-	force := false
+// captureWorktreePatch diffs the worktree (tracked and untracked files)
+// against HEAD using a scratch index, leaving the real index untouched
+func captureWorktreePatch(slotPath string) []byte {
+	tmp, err := os.CreateTemp("", "slot-undo-index-*")
+	if err != nil {
+		return nil
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
 
-	for _, arg := range args {
-		if arg == "--do" {
-			doClean = true
-		} else if arg == "--force" || arg == "-f" {
-			force = true
+	env := append(os.Environ(), "GIT_INDEX_FILE="+tmp.Name())
+	for _, args := range [][]string{{"read-tree", "HEAD"}, {"add", "-A"}} {
+		cmd := exec.Command("git", append([]string{"-C", slotPath}, args...)...)
+		cmd.Env = env
+		if cmd.Run() != nil {
+			return nil
 		}
 	}
+	cmd := exec.Command("git", "-C", slotPath, "diff", "--cached", "--binary", "HEAD")
+	cmd.Env = env
+	out, _ := cmd.Output()
+	return out
+}
 
-	fmt.Println()
-	fmt.Println("════════════════════════════════════════════════════════════════")
-	fmt.Println("                        SLOT CLEAN")
-	fmt.Println("════════════════════════════════════════════════════════════════")
-	fmt.Println()
-
-	cwd, _ := os.Getwd()
-	mainRepo, _ := detectProject(cwd)
-	if mainRepo == "" {
-		mainRepo = cwd
+// restoreSlotBranch recreates a removed slot's branch (or reuses it if it
+// still points at the old commit) and checks it out in a new worktree
+func restoreSlotBranch(e UndoEntry) {
+	out, err := exec.Command("git", "-C", e.MainRepo, "rev-parse", "--verify", "refs/heads/"+e.Branch).Output()
+	if err == nil && strings.TrimSpace(string(out)) != e.SHA {
+		fail(exitExists, fmt.Sprintf("branch '%s' already exists at a different commit", e.Branch))
 	}
-	parentDir := filepath.Dir(mainRepo)
-
-	reg := loadRegistry()
+	if err != nil {
+		if err := auditedRun("undo", e.SlotName, exec.Command("git", "-C", e.MainRepo, "branch", e.Branch, e.SHA)); err != nil {
+			fail(exitError, fmt.Sprintf("could not recreate branch at %.8s (commit may have been garbage collected)", e.SHA))
+		}
+	}
+	fmt.Printf("✓ Branch %s at %.8s\n", e.Branch, e.SHA)
 
-	var safeTmux []string
-	var safeWorktrees []string
-	var blockedItems []string
-	var warningItems []string
+	if err := runCmd(e.MainRepo, "git", "worktree", "add", e.SlotPath, e.Branch); err != nil {
+		fail(exitError, "could not re-create worktree")
+	}
+}
 
-	// 1. Check tmux sessions
-	fmt.Println("Scanning tmux sessions...")
-	out, _ := exec.Command("tmux", "list-sessions", "-F", "#{session_name}").Output()
-	sessions := strings.Split(strings.TrimSpace(string(out)), "\n")
+func cmdUndo(args []string) {
+	entries := loadUndoJournal()
 
-	for _, session := range sessions {
-		if session == "" {
-			continue
+	if len(args) > 0 && (args[0] == "--list" || args[0] == "list") {
+		if len(entries) == 0 {
+			fmt.Println("Nothing to undo.")
+			return
 		}
-		// Check if Claude is running in this session
-		paneOut, _ := exec.Command("tmux", "list-panes", "-t", session, "-F", "#{pane_current_command}").Output()
-		if strings.Contains(strings.ToLower(string(paneOut)), "claude") {
-			blockedItems = append(blockedItems, fmt.Sprintf("tmux:%s - Claude running", session))
-		} else {
-			safeTmux = append(safeTmux, session)
-			fmt.Printf("  ✓ tmux:%s - safe to kill\n", session)
+		for i := len(entries) - 1; i >= 0; i-- {
+			e := entries[i]
+			changes := ""
+			if e.Patch != "" {
+				changes = " +uncommitted changes"
+			}
+			fmt.Printf("%s  %-6s %-24s %s @ %.8s%s\n", e.Time, e.Action, e.SlotName, e.Branch, e.SHA, changes)
 		}
+		return
 	}
-	if len(sessions) == 0 || (len(sessions) == 1 && sessions[0] == "") {
-		fmt.Println("  (no tmux sessions)")
-	}
-
-	fmt.Println()
-
-	// 2. Check git worktrees
-	fmt.Println("Scanning worktrees...")
-	entries, _ := os.ReadDir(parentDir)
 
-	for _, entry := range entries {
-		if !entry.IsDir() {
-			continue
+	// Most recent entry, or the most recent one for the given slot
+	idx := len(entries) - 1
+	if len(args) > 0 {
+		for idx >= 0 && entries[idx].SlotName != args[0] && !strings.HasSuffix(entries[idx].SlotName, "-"+args[0]) {
+			idx--
 		}
-		wtPath := filepath.Join(parentDir, entry.Name())
+	}
+	if idx < 0 {
+		fmt.Println("Nothing to undo.")
+		return
+	}
+	e := entries[idx]
 
-		// Skip if it's the main repo
-		if wtPath == mainRepo {
-			continue
-		}
+	if _, err := os.Stat(e.SlotPath); err == nil {
+		fail(exitExists, fmt.Sprintf("%s already exists", e.SlotPath))
+	}
 
-		// Check if it's a slot/worktree pattern
-		if !strings.Contains(entry.Name(), "-") {
-			continue
-		}
+	fmt.Printf("Restoring %s (%s, removed by %s at %s)\n\n", e.SlotName, e.Branch, e.Action, e.Time)
 
-		// Check if it's a git worktree
-		gitFile := filepath.Join(wtPath, ".git")
-		info, err := os.Stat(gitFile)
-		if err != nil || info.IsDir() {
-			continue
+	// Detached slots (new --at --detach) come back at the same commit
+	if e.Branch == "" {
+		if err := runCmd(e.MainRepo, "git", "worktree", "add", "--detach", e.SlotPath, e.SHA); err != nil {
+			fail(exitError, fmt.Sprintf("could not re-create worktree at %.8s (commit may have been garbage collected)", e.SHA))
 		}
+	} else {
+		restoreSlotBranch(e)
+	}
+	fmt.Println("✓ Re-created worktree")
 
-		branch := getBranchName(wtPath)
+	copyGitignored(e.MainRepo, e.SlotPath)
 
-		// Check 1: Uncommitted changes
-		uncommittedOut, _ := exec.Command("git", "-C", wtPath, "status", "--porcelain").Output()
-		uncommitted := len(strings.TrimSpace(string(uncommittedOut))) > 0
+	portOffset := e.Slot.Number
+	if portOffset == 0 {
+		portOffset = worktree.NextSlotNumber(e.MainRepo, e.Slot.Project)
+	}
+	portMap := scanAndAllocatePorts(e.MainRepo, portOffset)
+	if len(portMap) > 0 {
+		updateSlotEnvFiles(e.SlotPath, portMap, e.SlotName)
+		updateConfigFiles(e.SlotPath, portMap)
+		updateDockerComposeFiles(e.SlotPath, e.SlotName, portMap)
+		ensureDockerComposeEnvFiles(e.SlotPath, portMap, e.SlotName)
+	}
 
-		// Check 2: Unpushed commits
-		unpushedOut, _ := exec.Command("git", "-C", wtPath, "log", "origin/"+branch+"..HEAD", "--oneline").Output()
-		unpushed := len(strings.TrimSpace(string(unpushedOut))) > 0
+	if e.Patch != "" {
+		if err := exec.Command("git", "-C", e.SlotPath, "apply", "--binary", e.Patch).Run(); err != nil {
+			fmt.Printf("⚠ Could not re-apply uncommitted changes; patch kept at %s\n", e.Patch)
+			e.Patch = ""
+		} else {
+			fmt.Println("✓ Restored uncommitted changes")
+		}
+	}
 
-		// Check 3: Unmerged with main
-		unmergedOut, _ := exec.Command("git", "-C", wtPath, "log", "origin/main..HEAD", "--oneline").Output()
-		if len(unmergedOut) == 0 {
-			unmergedOut, _ = exec.Command("git", "-C", wtPath, "log", "origin/master..HEAD", "--oneline").Output()
+	reg := loadRegistry()
+	if e.Slot.Project != "" {
+		reg.Slots[e.SlotName] = e.Slot
+	} else {
+		reg.Slots[e.SlotName] = SlotConfig{
+			Project:   filepath.Base(e.MainRepo),
+			Branch:    e.Branch,
+			CreatedAt: time.Now().Format(time.RFC3339),
 		}
-		unmergedCount := 0
-		if len(strings.TrimSpace(string(unmergedOut))) > 0 {
-			unmergedCount = len(strings.Split(strings.TrimSpace(string(unmergedOut)), "\n"))
+	}
+	saveRegistry(reg)
+	refreshSlotDNS()
+
+	if e.Patch != "" {
+		os.Remove(e.Patch)
+	}
+	saveUndoJournal(append(entries[:idx:idx], entries[idx+1:]...))
+	// A trashed copy of the same deletion is spent too
+	for _, t := range trash.Load(trashDir()) {
+		if t.SlotName == e.SlotName && t.SHA == e.SHA {
+			trash.Remove(t)
 		}
+	}
 
-		wtName := entry.Name()
+	fmt.Printf("\n✓ Restored %s\n", e.SlotName)
+	if len(portMap) > 0 {
+		fmt.Println("  Docker and databases were not restored; run `slot-cli db-sync` in the slot")
+	}
+}
 
-		// Check lock
-		if slot, ok := reg.Slots[wtName]; ok && slot.Locked {
-			note := ""
-			if slot.LockNote != "" {
-				note = " — " + slot.LockNote
+// projectPorts reads a main repo's env files: the ports it defines (PORT=,
+// *_PORT=) and the ports its URLs point at (localhost:P)
+func projectPorts(mainRepo string) (owned, refs []int) {
+	urlPortRe := regexp.MustCompile(`localhost:(\d+)`)
+	for _, rel := range envFiles(mainRepo) {
+		content, _ := os.ReadFile(filepath.Join(mainRepo, rel))
+		for _, line := range strings.Split(string(content), "\n") {
+			if _, port, ok := ports.FromEnvLine(strings.TrimSpace(line)); ok {
+				owned = append(owned, port)
+			}
+			for _, m := range urlPortRe.FindAllStringSubmatch(line, -1) {
+				if port, err := strconv.Atoi(m[1]); err == nil {
+					refs = append(refs, port)
+				}
 			}
-			blockedItems = append(blockedItems, fmt.Sprintf("%s (%s) - LOCKED%s", wtName, branch, note))
-			continue
 		}
+	}
+	return owned, refs
+}
 
-		if uncommitted {
-			blockedItems = append(blockedItems, fmt.Sprintf("%s (%s) - DIRTY: uncommitted files", wtName, branch))
-		} else if unpushed {
-			blockedItems = append(blockedItems, fmt.Sprintf("%s (%s) - UNPUSHED: commits not on remote", wtName, branch))
-		} else if unmergedCount > 0 {
-			warningItems = append(warningItems, fmt.Sprintf("%s (%s) - UNMERGED: %d commits not in main", wtName, branch, unmergedCount))
-			if force {
-				safeWorktrees = append(safeWorktrees, wtPath)
+// stackOrder orders a stack's projects so that the ones whose ports others
+// point at (the api a frontend calls) get their slots first; cycles fall
+// back to name order
+func stackOrder(projects []string, owned, refs map[string][]int) []string {
+	remaining := slices.Sorted(slices.Values(projects))
+	var order []string
+	for len(remaining) > 0 {
+		next := 0
+		for i, p := range remaining {
+			waits := false
+			for _, q := range remaining {
+				if q != p && slices.ContainsFunc(refs[p], func(port int) bool { return slices.Contains(owned[q], port) }) {
+					waits = true
+				}
+			}
+			if !waits {
+				next = i
+				break
 			}
-		} else {
-			safeWorktrees = append(safeWorktrees, wtPath)
-			fmt.Printf("  ✓ %s (%s) - CLEAN: merged to main\n", wtName, branch)
 		}
+		order = append(order, remaining[next])
+		remaining = slices.Delete(remaining, next, next+1)
 	}
+	return order
+}
 
-	if len(safeWorktrees) == 0 && len(blockedItems) == 0 && len(warningItems) == 0 {
-		fmt.Println("  (no worktrees found)")
+// cmdNewStack creates slot <name> in every project of a group, one after the
+// other, passing each the ports already given to the others (--link-ports)
+// so URLs between the projects point at the stack's slots
+func cmdNewStack(before, after []string) {
+	if len(after) < 2 || strings.HasPrefix(after[0], "-") || strings.HasPrefix(after[1], "-") {
+		fail(exitUsage, "missing group or slot name", "Usage: slot-cli new --stack <group> <name> [new flags]")
+	}
+	group, name := after[0], after[1]
+	passthrough := append(slices.Clone(before), after[2:]...)
+	for _, flag := range []string{"--from", "--pr", "--issue", "--at", "--link-ports"} {
+		if v, _ := extractFlag(passthrough, flag); v != "" {
+			fail(exitUsage, flag+" can't be combined with --stack")
+		}
 	}
 
-	fmt.Println()
+	reg := loadRegistry()
+	requireGroup(reg, group)
+	scoped := groupRegistry(reg, group)
+	if len(scoped.Projects) == 0 {
+		fail(exitNotFound, fmt.Sprintf("group '%s' has no projects", group), "Add some with: slot-cli group assign <project> "+group)
+	}
+	owned, refs := make(map[string][]int), make(map[string][]int)
+	for project, cfg := range scoped.Projects {
+		owned[project], refs[project] = projectPorts(cfg.Path)
+		if fileExists(filepath.Join(filepath.Dir(cfg.Path), project+"-"+name)) {
+			fail(exitExists, fmt.Sprintf("slot %s-%s already exists", project, name))
+		}
+	}
+	order := stackOrder(slices.Collect(maps.Keys(scoped.Projects)), owned, refs)
+	fmt.Printf("Creating stack '%s' in %s: %s\n", name, reg.Groups[group].Name, strings.Join(order, " → "))
 
-	// 3. Check for orphan registry entries (slot in registry but no directory on disk)
-	var orphanSlots []string
-	fmt.Println("Scanning registry for orphans...")
-	for slotName, slotCfg := range reg.Slots {
-		projectCfg, ok := reg.Projects[slotCfg.Project]
-		if !ok {
-			orphanSlots = append(orphanSlots, slotName)
-			fmt.Printf("  ✗ %s - ORPHAN: project '%s' not in registry\n", slotName, slotCfg.Project)
+	exe, err := os.Executable()
+	if err != nil {
+		fail(exitError, err.Error())
+	}
+	linked := make(map[int]int)
+	var created []string
+	for _, project := range order {
+		mainRepo := scoped.Projects[project].Path
+		fmt.Printf("\n━━━ %s ━━━\n", project)
+		cmdArgs := append([]string{"new", name}, passthrough...)
+		if len(linked) > 0 {
+			cmdArgs = append(cmdArgs, "--link-ports", formatLinkedPorts(linked))
+		}
+		if assumeYes {
+			cmdArgs = append(cmdArgs, "--yes")
+		}
+		cmd := exec.Command(exe, cmdArgs...)
+		cmd.Dir = mainRepo
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if err := cmd.Run(); err != nil {
+			var hints []string
+			for _, slot := range created {
+				hints = append(hints, "Already created: "+slot)
+			}
+			fail(exitError, fmt.Sprintf("stack stopped: new failed in %s", project), hints...)
+		}
+		if slices.Contains(passthrough, "--dry-run") {
 			continue
 		}
-		slotDir := filepath.Join(filepath.Dir(projectCfg.Path), slotName)
-		if _, err := os.Stat(slotDir); os.IsNotExist(err) {
-			orphanSlots = append(orphanSlots, slotName)
-			fmt.Printf("  ✗ %s - ORPHAN: directory not found (%s)\n", slotName, slotDir)
+
+		slotName := project + "-" + name
+		slotPath := filepath.Join(filepath.Dir(mainRepo), slotName)
+		for mainPort, slotPort := range slotPortMap(mainRepo, slotPath) {
+			if _, ok := linked[mainPort]; !ok {
+				linked[mainPort] = slotPort
+			}
 		}
-	}
-	if len(orphanSlots) == 0 {
-		fmt.Println("  (no orphans)")
+		modifySlot(slotName, func(slot *SlotConfig) { slot.Stack = group })
+		created = append(created, slotName)
 	}
 
-	fmt.Println()
+	if len(created) > 0 {
+		fmt.Printf("\n✓ Stack '%s' ready: %s\n", name, strings.Join(created, ", "))
+		if len(linked) > 0 {
+			fmt.Printf("  Linked ports: %s\n", formatLinkedPorts(linked))
+		}
+	}
+}
 
-	// 4. Summary
-	fmt.Println("════════════════════════════════════════════════════════════════")
+// planNewSlot prints what `new` would do without touching anything
+func planNewSlot(mainRepo, project, slotName, slotPath, branchName, base string, slotNum int, compose ComposeSelection, withTmux bool) {
+	fmt.Printf("Dry run: create %s\n\n", slotName)
+	fmt.Printf("  Worktree:  %s\n", slotPath)
+	fmt.Printf("  Branch:    %s (new, from %s)\n", branchName, base)
+	fmt.Println("  Copy:      gitignored files from main")
 
-	if len(blockedItems) > 0 {
-		fmt.Println("\033[31mBLOCKED - cannot clean:\033[0m")
-		for _, item := range blockedItems {
-			fmt.Printf("  ✗ %s\n", item)
+	portOffset := slotNum
+	if portOffset == 0 {
+		portOffset = worktree.NextSlotNumber(mainRepo, project)
+	}
+	fmt.Println()
+	portMap := scanAndAllocatePorts(mainRepo, portOffset)
+	if len(portMap) > 0 {
+		// Preview the rewrites against main's copies of the files
+		dryRunWrites = true
+		updateSlotEnvFiles(mainRepo, portMap, slotName)
+		updateConfigFiles(mainRepo, portMap)
+		updateDockerComposeFiles(mainRepo, slotName, portMap)
+		dryRunWrites = false
+
+		header := false
+		for _, path := range findComposeFiles(mainRepo) {
+			if !header {
+				fmt.Println("\nDocker:")
+				header = true
+			}
+			rel, _ := filepath.Rel(mainRepo, path)
+			if !compose.IsEmpty() {
+				rel += " (" + compose.String() + ")"
+			}
+			fmt.Printf("  Would start %s and clone its databases\n", rel)
 		}
-		fmt.Println()
 	}
 
-	if len(warningItems) > 0 {
-		fmt.Println("\033[33mWARNINGS - unmerged branches:\033[0m")
-		for _, item := range warningItems {
-			fmt.Printf("  ⚠ %s\n", item)
+	fmt.Println("\nRegistry:")
+	fmt.Printf("  Would add %s (project %s, branch %s)\n", slotName, project, branchName)
+	if withTmux {
+		fmt.Printf("  Would create tmux session %s\n", tmuxSessionName(slotName))
+	}
+	fmt.Println("\nThis is a dry run. Run without --dry-run to apply.")
+}
+
+// planSlotRemoval prints what removing a slot would do (docker, worktree,
+// branch, registry, tmux) without touching anything; trash moves the
+// worktree to the trash instead of deleting it
+func planSlotRemoval(mainRepo, slotName, slotPath, branchName string, trash bool) {
+	if out, _ := exec.Command("git", "-C", slotPath, "status", "--porcelain").Output(); len(out) > 0 {
+		kept := "kept for `slot-cli undo`"
+		if trash {
+			kept = "kept in the trash"
 		}
-		fmt.Println("  (use --force to include these)")
-		fmt.Println()
+		fmt.Printf("  ⚠ %d uncommitted change(s) would be removed (%s)\n", len(strings.Split(strings.TrimSpace(string(out)), "\n")), kept)
 	}
 
-	if len(orphanSlots) > 0 {
-		fmt.Println("\033[35mORPHAN REGISTRY ENTRIES:\033[0m")
-		for _, name := range orphanSlots {
-			fmt.Printf("  ✗ %s\n", name)
-		}
-		fmt.Println()
+	for _, path := range findComposeFiles(slotPath) {
+		rel, _ := filepath.Rel(slotPath, path)
+		fmt.Printf("  Would run: docker compose down -v   (%s, volumes are destroyed)\n", rel)
 	}
 
-	safeCount := len(safeTmux) + len(safeWorktrees) + len(orphanSlots)
-
-	if safeCount == 0 {
-		fmt.Println("\033[36mNothing safe to clean.\033[0m")
-		return
+	if commits := worktree.UnpushedCommits(mainRepo, branchName); len(commits) > 0 {
+		fmt.Printf("  ⚠ %d commit(s) exist only on %s\n", len(commits), branchName)
+	}
+	if trash {
+		fmt.Printf("  Would move %s to %s/ (slot-cli undelete restores it)\n", slotPath, trashDir())
+	} else {
+		fmt.Printf("  Would run: git worktree remove %s --force\n", slotPath)
+	}
+	sha, _ := exec.Command("git", "-C", slotPath, "rev-parse", "--short", "HEAD").Output()
+	fmt.Printf("  Would run: git branch -D %s   (at %s)\n", branchName, strings.TrimSpace(string(sha)))
+	if _, ok := loadRegistry().Slots[slotName]; ok {
+		fmt.Printf("  Would remove registry entry %s\n", slotName)
 	}
+	if tmuxSessionExists(tmuxSessionName(slotName)) {
+		fmt.Printf("  Would kill tmux session %s\n", tmuxSessionName(slotName))
+	}
+}
 
-	fmt.Printf("\033[32mSAFE TO CLEAN: %d items\033[0m\n", safeCount)
+// planMerge prints the commits a merge would bring into main and whether it
+// would conflict
+func planMerge(mainRepo, branchName string) {
+	mainBranch := worktree.BranchName(mainRepo)
+	fmt.Printf("Would merge %s into %s:\n", branchName, mainBranch)
 
-	if !doClean {
-		fmt.Println()
-		fmt.Println("This is a dry run. To actually clean, run:")
-		fmt.Println("  slot-cli clean --do")
-		if len(warningItems) > 0 {
-			fmt.Println("  slot-cli clean --do --force  (include unmerged branches)")
+	out, _ := exec.Command("git", "-C", mainRepo, "log", "--oneline", mainBranch+".."+branchName).Output()
+	commits := strings.TrimSpace(string(out))
+	if commits == "" {
+		fmt.Println("  (no new commits)")
+	}
+	for _, line := range strings.Split(commits, "\n") {
+		if line != "" {
+			fmt.Printf("  %s\n", line)
 		}
-		return
 	}
 
-	// Actually clean
+	// merge-tree --write-tree (git 2.38+) exits 1 on conflicts without touching the worktree
+	err := exec.Command("git", "-C", mainRepo, "merge-tree", "--write-tree", mainBranch, branchName).Run()
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+		fmt.Println("  ⚠ Merge would conflict")
+	} else if err == nil {
+		fmt.Println("  ✓ Merges cleanly")
+	}
 	fmt.Println()
-	fmt.Println("\033[36mCleaning...\033[0m")
+}
 
-	// Kill tmux sessions
-	for _, session := range safeTmux {
-		if err := exec.Command("tmux", "kill-session", "-t", session).Run(); err == nil {
-			fmt.Printf("  ✓ Killed tmux:%s\n", session)
-		}
+func cmdList(args []string) {
+	groupFlag, args := extractFlag(args, "--group")
+	labelFlag, args := extractFlag(args, "--label")
+	output, args := extractFlag(args, "--output")
+	if short, rest := extractFlag(args, "-o"); short != "" {
+		output, args = short, rest
+	}
+	columnsFlag, args := extractFlag(args, "--columns")
+	if slices.Contains(args, "-q") || slices.Contains(args, "--quiet") {
+		output = "names"
+	} else if jsonOutput && output == "" {
+		output = "json"
+	} else if output == "" && columnsFlag != "" {
+		output = "table"
+	}
+	columns, err := listLayout(output, columnsFlag)
+	if err != nil {
+		fail(exitUsage, err.Error())
 	}
 
-	// Remove orphan registry entries
-	for _, slotName := range orphanSlots {
-		removeFromRegistry(slotName)
-		fmt.Printf("  ✓ Removed orphan registry entry: %s\n", slotName)
+	processes := getAgentProcesses()
+	reg := loadRegistry()
+	if noteSlotActivity(reg, processes, time.Now()) {
+		saveRegistry(reg)
+	}
+	if output != "" {
+		printListOutput(scopeToLabel(scopeToGroup(reg, groupFlag), labelFlag), processes, output, columns)
+		return
 	}
 
-	// Remove worktrees
-	for _, wtPath := range safeWorktrees {
-		wtName := filepath.Base(wtPath)
-		branch := getBranchName(wtPath)
+	fmt.Println("╔══════════════════════════════════════════════════════════════════╗")
+	fmt.Println("║                    AGENT INSTANCES                               ║")
+	fmt.Println("╚══════════════════════════════════════════════════════════════════╝")
+	fmt.Println()
+
+	if groupFlag != "" {
+		reg = scopeToGroup(reg, groupFlag)
+		processes = agentsIn(reg, processes)
+	}
+	if labelFlag != "" {
+		reg = scopeToLabel(reg, labelFlag)
+		processes = slices.DeleteFunc(processes, func(a AgentProcess) bool {
+			for name := range reg.Slots {
+				if a.CWD != "" && worktree.IsWithin(a.CWD, reg.SlotPath(name)) {
+					return false
+				}
+			}
+			return true
+		})
+	}
+	defer printRemoteSlots(reg)
+	defer printIdleSlots(reg)
+	defer printDescribedSlots(reg)
 
-		// Stop docker if running
-		stopDocker(wtPath)
+	if len(processes) == 0 {
+		fmt.Println("No agent instances running.")
+		return
+	}
 
-		// Find main repo
-		gitContent, err := os.ReadFile(filepath.Join(wtPath, ".git"))
-		if err != nil {
-			continue
-		}
-		line := strings.TrimSpace(string(gitContent))
-		if !strings.HasPrefix(line, "gitdir:") {
-			continue
-		}
-		gitdir := strings.TrimSpace(strings.TrimPrefix(line, "gitdir:"))
-		idx := strings.Index(gitdir, "/.git/worktrees")
-		if idx < 0 {
-			continue
+	for _, p := range processes {
+		fmt.Printf("┌─ %s\n", p.Project)
+		fmt.Printf("│  Agent:   %s\n", p.Agent)
+		fmt.Printf("│  Branch:  %s\n", p.Branch)
+		if summary := slotSummary(reg.Slots[p.Project]); summary != "" {
+			fmt.Printf("│  Task:    %s\n", summary)
+		}
+		if slot := reg.Slots[p.Project]; slot.PRURL != "" {
+			fmt.Printf("│  PR:      #%d %s\n", slot.PRNumber, slot.PRURL)
+		}
+		if p.Agent == "claude" {
+			if info := getClaudeInfo(strconv.Itoa(p.PID)); info != nil {
+				fmt.Printf("│  Session: %s\n", info["session"])
+				fmt.Printf("│  Model:   %s\n", info["model"])
+			}
 		}
-		wtMainRepo := gitdir[:idx]
-
-		// Remove worktree and branch
-		exec.Command("git", "-C", wtMainRepo, "worktree", "remove", wtPath, "--force").Run()
-		exec.Command("git", "-C", wtMainRepo, "branch", "-D", branch).Run()
-		removeFromRegistry(wtName)
-		fmt.Printf("  ✓ Removed worktree: %s\n", wtName)
+		fmt.Printf("│  Runtime: %s\n", p.Runtime)
+		fmt.Println("└──────────────────────────────────────")
+		fmt.Println()
 	}
+}
 
-	fmt.Println()
-	fmt.Println("\033[32mDone!\033[0m")
+// ListRow is one slot as list --output prints it
+type ListRow struct {
+	Name    string            `json:"name"`
+	Project string            `json:"project"`
+	Branch  string            `json:"branch"`
+	Path    string            `json:"path"`
+	Exists  bool              `json:"exists"`
+	Agent   string            `json:"agent,omitempty"` // e.g. "claude 1h20m"
+	Idle    string            `json:"idle,omitempty"`  // set once idle for idleThreshold
+	Locked  bool              `json:"locked"`
+	Labels  []string          `json:"labels,omitempty"`
+	Summary string            `json:"summary,omitempty"`
+	URL     string            `json:"url,omitempty"`
+	Ports   map[string]string `json:"ports,omitempty"`
+	PR      string            `json:"pr,omitempty"`
 }
 
-type ClaudeProcess struct {
-	PID     int
-	CWD     string
-	Project string
-	Branch  string
-	Runtime string
+// ListColumn is a column list --columns can pick
+type ListColumn struct {
+	Header string
+	Width  int // padding; the last column is never padded
+	Value  func(ListRow) string
 }
 
-func getClaudeProcesses() []ClaudeProcess {
-	out, err := exec.Command("pgrep", "-f", "claude").Output()
-	if err != nil {
-		return nil
-	}
+var listColumns = map[string]ListColumn{
+	"name":    {"SLOT", 24, func(r ListRow) string { return r.Name }},
+	"project": {"PROJECT", 14, func(r ListRow) string { return r.Project }},
+	"branch":  {"BRANCH", 22, func(r ListRow) string { return r.Branch }},
+	"agent":   {"AGENT", 16, func(r ListRow) string { return r.Agent }},
+	"idle":    {"IDLE", 13, func(r ListRow) string { return strings.TrimPrefix(r.Idle, "idle ") }},
+	"locked": {"LOCK", 6, func(r ListRow) string {
+		if r.Locked {
+			return "yes"
+		}
+		return ""
+	}},
+	"labels":  {"LABELS", 18, func(r ListRow) string { return strings.Join(r.Labels, ",") }},
+	"summary": {"ABOUT", 40, func(r ListRow) string { return r.Summary }},
+	"url":     {"URL", 28, func(r ListRow) string { return r.URL }},
+	"ports": {"PORTS", 30, func(r ListRow) string {
+		var ports []string
+		for _, name := range slices.Sorted(maps.Keys(r.Ports)) {
+			ports = append(ports, strings.TrimPrefix(name, "SLOT_")+"="+r.Ports[name])
+		}
+		return strings.Join(ports, " ")
+	}},
+	"pr":   {"PR", 10, func(r ListRow) string { return r.PR }},
+	"path": {"PATH", 40, func(r ListRow) string { return r.Path }},
+}
 
-	seen := make(map[string]bool) // dedupe by cwd
-	var processes []ClaudeProcess
+// listOutputColumns are the columns of --output table and wide
+var listOutputColumns = map[string][]string{
+	"table": {"name", "branch", "agent", "idle", "summary"},
+	"wide":  {"name", "project", "branch", "agent", "idle", "locked", "labels", "url", "pr", "summary"},
+}
 
-	for _, pidStr := range strings.Fields(string(out)) {
-		pid, _ := strconv.Atoi(pidStr)
-		if pid == 0 {
-			continue
+// listLayout resolves --output and --columns to the columns to print;
+// json and names print none
+func listLayout(output, columns string) ([]string, error) {
+	switch output {
+	case "json", "names":
+		if columns != "" {
+			return nil, fmt.Errorf("--columns doesn't apply to --output %s", output)
 		}
-
-		// Get cwd
-		lsofOut, err := exec.Command("bash", "-c", fmt.Sprintf("lsof -p %d 2>/dev/null | grep cwd | awk '{print $NF}'", pid)).Output()
-		if err != nil {
-			continue
+		return nil, nil
+	case "", "table", "wide":
+	default:
+		return nil, fmt.Errorf("unknown output '%s' (table, wide, json or names)", output)
+	}
+	if columns == "" {
+		return listOutputColumns[cmp.Or(output, "table")], nil
+	}
+	selected := splitList(columns)
+	for _, name := range selected {
+		if _, ok := listColumns[name]; !ok {
+			return nil, fmt.Errorf("unknown column '%s' (%s)", name, strings.Join(slices.Sorted(maps.Keys(listColumns)), ", "))
 		}
-		cwd := strings.TrimSpace(string(lsofOut))
-		if cwd == "" || cwd == "/" || !strings.HasPrefix(cwd, "/Users") {
-			continue
+	}
+	return selected, nil
+}
+
+// renderListTable prints rows as a table of the given columns ("-" for empty cells)
+func renderListTable(rows []ListRow, columns []string) string {
+	var b strings.Builder
+	line := func(cell func(ListColumn) string) {
+		var cells []string
+		for i, name := range columns {
+			col := listColumns[name]
+			value := cmp.Or(cell(col), "-")
+			if i < len(columns)-1 {
+				value = fmt.Sprintf("%-*s", col.Width, truncate(value, col.Width))
+			}
+			cells = append(cells, value)
 		}
+		fmt.Fprintln(&b, strings.TrimRight(strings.Join(cells, " "), " "))
+	}
+	line(func(col ListColumn) string { return col.Header })
+	for _, row := range rows {
+		line(func(col ListColumn) string { return col.Value(row) })
+	}
+	return b.String()
+}
 
-		if seen[cwd] {
-			continue
+// listRows joins reg's slots with their running agents, sorted by name
+func listRows(reg *Registry, agents []AgentProcess, now time.Time) []ListRow {
+	var rows []ListRow
+	for _, name := range slices.Sorted(maps.Keys(reg.Slots)) {
+		st := slotStatus(reg, name)
+		row := ListRow{
+			Name: name, Project: st.Project, Branch: st.Branch, Path: st.Path, Exists: st.Exists,
+			Locked: st.LockActive(now), Labels: st.Labels, Summary: slotSummary(st.SlotConfig),
+			URL: st.URL, Ports: st.Ports, PR: st.PRURL,
+		}
+		for _, a := range agents {
+			if a.CWD != "" && worktree.IsWithin(a.CWD, st.Path) {
+				row.Agent = a.Agent + " " + a.Runtime
+				break
+			}
+		}
+		if st.Exists && idleFor(st.SlotConfig, now) >= idleThreshold {
+			row.Idle = idleLabel(idleFor(st.SlotConfig, now))
 		}
-		seen[cwd] = true
+		rows = append(rows, row)
+	}
+	return rows
+}
 
-		// Get branch
-		branchOut, _ := exec.Command("git", "-C", cwd, "branch", "--show-current").Output()
-		branch := strings.TrimSpace(string(branchOut))
+// printListOutput prints the slots for list --output/--columns/--quiet
+func printListOutput(reg *Registry, agents []AgentProcess, output string, columns []string) {
+	rows := listRows(reg, agents, time.Now())
+	switch output {
+	case "json":
+		if rows == nil {
+			rows = []ListRow{}
+		}
+		data, _ := json.MarshalIndent(rows, "", "  ")
+		fmt.Println(string(data))
+	case "names":
+		for _, row := range rows {
+			fmt.Println(row.Name)
+		}
+	default:
+		fmt.Print(renderListTable(rows, columns))
+	}
+}
 
-		// Get runtime
-		runtimeOut, _ := exec.Command("ps", "-p", pidStr, "-o", "etime=").Output()
-		runtime := strings.TrimSpace(string(runtimeOut))
+// Agent describes how to launch and find a coding agent
+type Agent struct {
+	Start      string `json:"start"`                 // launch command
+	Continue   string `json:"continue,omitempty"`    // resume the most recent conversation
+	NewSession string `json:"new_session,omitempty"` // start with a known session ID ({session} is replaced)
+	Resume     string `json:"resume,omitempty"`      // resume a specific session ({session} is replaced)
+	Process    string `json:"process,omitempty"`     // pgrep -f pattern for running instances
+
+	// Flags per permission mode (agent_options.permissions); without a mode
+	// the agent asks before acting, as it does by default
+	Permissions map[string]string `json:"permissions,omitempty"`
+}
 
-		// Extract project name from path
-		project := filepath.Base(cwd)
+// builtinAgents can be overridden or extended via "agents" in config.json
+var builtinAgents = map[string]Agent{
+	"claude": {
+		Start:      "claude",
+		Continue:   "claude --continue",
+		NewSession: "claude --session-id {session}",
+		Resume:     "claude --resume {session}",
+		Process:    "claude",
+		Permissions: map[string]string{
+			"accept-edits": "--permission-mode acceptEdits",
+			"plan":         "--permission-mode plan",
+			"skip":         "--dangerously-skip-permissions",
+		},
+	},
+	"aider": {
+		Start:       "aider",
+		Continue:    "aider --restore-chat-history",
+		Process:     "aider",
+		Permissions: map[string]string{"skip": "--yes-always"},
+	},
+	"codex": {
+		Start:    "codex",
+		Continue: "codex resume --last",
+		Process:  "codex",
+		Permissions: map[string]string{
+			"accept-edits": "--full-auto",
+			"skip":         "--dangerously-bypass-approvals-and-sandbox",
+		},
+	},
+	"cursor-agent": {
+		Start:       "cursor-agent",
+		Continue:    "cursor-agent resume",
+		Process:     "cursor-agent",
+		Permissions: map[string]string{"skip": "--force"},
+	},
+	"shell": {
+		Start: `exec "${SHELL:-bash}" -l`,
+	},
+}
 
-		processes = append(processes, ClaudeProcess{
-			PID:     pid,
-			CWD:     cwd,
-			Project: project,
-			Branch:  branch,
-			Runtime: runtime,
-		})
+// loadAgents returns the built-in agents merged with configured ones
+func loadAgents() map[string]Agent {
+	agents := make(map[string]Agent)
+	for name, a := range builtinAgents {
+		agents[name] = a
 	}
-	return processes
+	for name, a := range loadConfig().Agents {
+		agents[name] = a
+	}
+	return agents
 }
 
-func cmdCleanClaude(args []string) {
-	killOrphans := false
-	killAll := false
-	dryRun := true
-
-	for _, arg := range args {
-		if arg == "--orphans" {
-			killOrphans = true
-			dryRun = false
-		} else if arg == "--all" {
-			killAll = true
-			dryRun = false
-		}
+// resolveAgent picks the agent for dir: the --agent flag, SLOT_AGENT, the
+// project's configured agent, then claude
+func resolveAgent(flag, dir string) (string, Agent) {
+	name := firstNonEmpty(flag, os.Getenv("SLOT_AGENT"))
+	if name == "" {
+		_, project := worktree.DetectProject(dir)
+		name = firstNonEmpty(loadRegistry().Projects[project].Agent, "claude")
+	}
+	agent, ok := loadAgents()[name]
+	if !ok || agent.Start == "" {
+		fail(exitUsage, fmt.Sprintf("unknown agent '%s'", name))
 	}
+	return name, agent
+}
 
-	fmt.Println()
-	fmt.Println("════════════════════════════════════════════════════════════════")
-	fmt.Println("                     CLAUDE CLEANUP")
-	fmt.Println("════════════════════════════════════════════════════════════════")
-	fmt.Println()
+// agentOptions layers the launch options for dir: the user's, the project's,
+// then SLOT_AGENT_PERMISSIONS and a --permissions flag for the mode
+func agentOptions(dir, permissionsFlag string) AgentOptions {
+	_, project := worktree.DetectProject(dir)
+	opts := loadRegistry().Projects[project].AgentOptions.Over(loadConfig().AgentOptions)
+	opts.Permissions = firstNonEmpty(permissionsFlag, os.Getenv("SLOT_AGENT_PERMISSIONS"), opts.Permissions)
+	return opts
+}
 
-	processes := getClaudeProcesses()
-	if len(processes) == 0 {
-		fmt.Println("No Claude instances running.")
-		return
+// agentCommand applies launch options to one of an agent's commands: the
+// binary swap, the permission mode's flags, then the extra flags
+func agentCommand(command string, agent Agent, opts AgentOptions) (string, error) {
+	if opts.Binary != "" {
+		_, rest, _ := strings.Cut(command, " ")
+		command = strings.TrimSpace(opts.Binary + " " + rest)
+	}
+	switch mode := opts.Permissions; {
+	case mode == "" || mode == "default":
+	case agent.Permissions[mode] != "":
+		command += " " + agent.Permissions[mode]
+	default:
+		modes := slices.Sorted(maps.Keys(agent.Permissions))
+		return command, fmt.Errorf("no '%s' permission mode for this agent (modes: %s)", mode, strings.Join(append([]string{"default"}, modes...), ", "))
 	}
+	if opts.Flags != "" {
+		command += " " + opts.Flags
+	}
+	return command, nil
+}
 
-	registry := loadRegistry()
-
-	// Build set of known paths from registry
-	knownPaths := make(map[string]string) // path -> label
-	for name, project := range registry.Projects {
-		knownPaths[project.Path] = name + " (main)"
+// launchAgent runs one of the agent's commands with the launch options for dir
+func launchAgent(agentName string, agent Agent, command, dir, permissionsFlag string) {
+	opts := agentOptions(dir, permissionsFlag)
+	command, err := agentCommand(command, agent, opts)
+	if err != nil {
+		fail(exitUsage, fmt.Sprintf("%s: %v", agentName, err), "Set agent_options.permissions in config.json or the project, or pass --permissions")
 	}
-	for name, slot := range registry.Slots {
-		project := registry.Projects[slot.Project]
-		if project.Path != "" {
-			slotPath := filepath.Join(filepath.Dir(project.Path), name)
-			knownPaths[slotPath] = name + " (" + slot.Branch + ")"
+	if opts.Permissions == "skip" {
+		fmt.Printf("⚠ %s runs without permission prompts (permissions: skip)\n", agentName)
+	}
+	runAgent(command, opts.Env)
+}
+
+func cmdStart(args []string) {
+	agentFlag, args := extractFlag(args, "--agent")
+	permissionsFlag, args := extractFlag(args, "--permissions")
+	resume := false
+	for _, arg := range args {
+		if arg == "--resume" {
+			resume = true
 		}
 	}
 
-	var attached []ClaudeProcess
-	var orphans []ClaudeProcess
+	cwd, _ := os.Getwd()
+	agentName, agent := resolveAgent(agentFlag, cwd)
+	slotName := filepath.Base(cwd)
+	reg := loadRegistry()
+	slot, isSlot := reg.Slots[slotName]
+
+	// With a tmux_layout the agent runs in its pane of the slot's session,
+	// next to the dev server and whatever else the layout starts
+	if isSlot && reg.Projects[slot.Project].TmuxLayout != "" && !slices.Contains(args, "--no-layout") && runtime.GOOS != "windows" {
+		var startArgs []string
+		if resume {
+			startArgs = append(startArgs, "--resume")
+		}
+		if agentFlag != "" {
+			startArgs = append(startArgs, "--agent", agentFlag)
+		}
+		if permissionsFlag != "" {
+			startArgs = append(startArgs, "--permissions", permissionsFlag)
+		}
+		session := tmuxSessionName(slotName)
+		if tmuxSessionExists(session) {
+			fmt.Printf("tmux session %s is already running, attaching\n", session)
+		} else if err := createSlotTmux(slotName, cwd, startArgs...); err != nil {
+			fail(exitError, fmt.Sprintf("could not create tmux session: %v", err), "Run the agent in the foreground with: slot-cli start --no-layout")
+		} else {
+			fmt.Printf("✓ Created tmux session %s\n", session)
+		}
+		attachTmux(session)
+		return
+	}
 
-	for _, p := range processes {
-		matched := false
-		for knownPath, label := range knownPaths {
-			if p.CWD == knownPath || strings.HasPrefix(p.CWD, knownPath+"/") {
-				p.Project = label
-				attached = append(attached, p)
-				matched = true
-				break
-			}
+	// Session tracking only applies to agents that take a session ID
+	tracked := isSlot && agent.Resume != ""
+	command := agent.Start
+	sessionID := ""
+	if resume {
+		if agent.Resume == "" {
+			fail(exitUsage, fmt.Sprintf("agent '%s' can't resume a specific session", agentName), "Use: slot-cli continue")
 		}
-		if !matched {
-			orphans = append(orphans, p)
+		if !isSlot || slot.SessionID == "" {
+			fail(exitNotFound, "no agent session recorded for this slot", "Use: slot-cli continue")
+		}
+		if !fileExists(filepath.Join(claudeSessionDir(cwd), slot.SessionID+".jsonl")) {
+			fmt.Printf("⚠ Transcript for session %s not found, the agent may not be able to resume it\n", slot.SessionID)
 		}
+		sessionID = slot.SessionID
+		command = strings.ReplaceAll(agent.Resume, "{session}", sessionID)
+	} else if tracked && agent.NewSession != "" {
+		// Pick the session ID up front so it's recorded even if we never exit cleanly
+		sessionID = newSessionID()
+		command = strings.ReplaceAll(agent.NewSession, "{session}", sessionID)
 	}
 
-	fmt.Printf("\033[32mATTACHED TO SLOTS (%d):\033[0m\n", len(attached))
-	for _, p := range attached {
-		fmt.Printf("  • pid %d  %s  branch:%s  %s\n", p.PID, p.Project, p.Branch, p.Runtime)
-	}
-	if len(attached) == 0 {
-		fmt.Println("  (none)")
+	if tracked {
+		recordSlotSession(slotName, cwd, sessionID)
 	}
-	fmt.Println()
-
-	fmt.Printf("\033[33mUNREGISTERED (%d):\033[0m\n", len(orphans))
-	for _, p := range orphans {
-		fmt.Printf("  • pid %d  %s  branch:%s  %s\n", p.PID, p.Project, p.Branch, p.Runtime)
+	if isSlot {
+		modifySlot(slotName, func(slot *SlotConfig) { slot.AgentAt = time.Now().UTC().Format(time.RFC3339) })
 	}
-	if len(orphans) == 0 {
-		fmt.Println("  (none)")
+	launchAgent(agentName, agent, command, cwd, permissionsFlag)
+	if tracked {
+		recordSlotSession(slotName, cwd, sessionID)
 	}
-	fmt.Println()
+}
 
-	fmt.Println("════════════════════════════════════════════════════════════════")
+func cmdContinue(args []string) {
+	agentFlag, args := extractFlag(args, "--agent")
+	permissionsFlag, _ := extractFlag(args, "--permissions")
+	cwd, _ := os.Getwd()
+	agentName, agent := resolveAgent(agentFlag, cwd)
+	slotName := filepath.Base(cwd)
+	_, isSlot := loadRegistry().Slots[slotName]
 
-	if dryRun {
-		fmt.Println("This is a dry run. To stop instances:")
-		fmt.Println("  slot-cli clean claude --orphans  (stop unregistered only)")
-		fmt.Println("  slot-cli clean claude --all      (stop all claude instances)")
-		return
+	if isSlot {
+		modifySlot(slotName, func(slot *SlotConfig) { slot.AgentAt = time.Now().UTC().Format(time.RFC3339) })
 	}
-
-	var toKill []ClaudeProcess
-	if killAll {
-		toKill = processes
-		fmt.Printf("\n\033[36mStopping ALL %d claude instances...\033[0m\n", len(toKill))
-	} else if killOrphans {
-		toKill = orphans
-		fmt.Printf("\n\033[36mStopping %d unregistered claude instances...\033[0m\n", len(toKill))
+	launchAgent(agentName, agent, firstNonEmpty(agent.Continue, agent.Start), cwd, permissionsFlag)
+	if isSlot && agent.Resume != "" {
+		// --continue picks the newest transcript; record whichever that was
+		recordSlotSession(slotName, cwd, "")
 	}
+}
 
-	for _, p := range toKill {
-		if err := exec.Command("kill", strconv.Itoa(p.PID)).Run(); err == nil {
-			fmt.Printf("  ✓ Stopped %s (pid %d)\n", p.Project, p.PID)
-		} else {
-			fmt.Printf("  ✗ Failed to stop %s (pid %d)\n", p.Project, p.PID)
-		}
+func runAgent(command string, env map[string]string) {
+	// Login shell so the agent sees the user's PATH (no equivalent on Windows)
+	cmd := shellCommand(command)
+	if runtime.GOOS != "windows" {
+		cmd = exec.Command("bash", "-lc", command)
 	}
-
-	fmt.Println()
-	fmt.Println("\033[32mDone!\033[0m")
+	cmd.Env = os.Environ()
+	for _, key := range slices.Sorted(maps.Keys(env)) {
+		cmd.Env = append(cmd.Env, key+"="+env[key])
+	}
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Run()
 }
 
-type DockerProcess struct {
-	Name    string
-	Ports   string
-	Status  string
-	Image   string
-	Project string // matched project/slot from registry
+// claudeSessionDir returns where Claude keeps transcripts for a directory
+func claudeSessionDir(dir string) string {
+	return filepath.Join(homeDir(), ".claude", "projects", regexp.MustCompile(`[/\\:]`).ReplaceAllString(dir, "-"))
 }
 
-func getDockerProcesses() []DockerProcess {
-	out, err := exec.Command("docker", "ps", "--format", "{{.Names}}|{{.Ports}}|{{.Status}}|{{.Image}}").Output()
-	if err != nil {
-		return nil
-	}
+// newSessionID returns a random UUIDv4 for claude --session-id
+func newSessionID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
 
-	var processes []DockerProcess
-	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
-		if line == "" {
+// parseTranscriptSlug returns the last session slug found in a transcript
+func parseTranscriptSlug(content string) string {
+	slug := ""
+	for _, line := range strings.Split(content, "\n") {
+		if !strings.Contains(line, `"slug"`) {
 			continue
 		}
-		parts := strings.SplitN(line, "|", 4)
-		if len(parts) < 4 {
-			continue
+		var data struct {
+			Slug string `json:"slug"`
+		}
+		if json.Unmarshal([]byte(line), &data) == nil && data.Slug != "" {
+			slug = data.Slug
 		}
-		processes = append(processes, DockerProcess{
-			Name:   parts[0],
-			Ports:  parts[1],
-			Status: parts[2],
-			Image:  parts[3],
-		})
 	}
-	return processes
+	return slug
 }
 
-func cmdCleanDocker(args []string) {
-	killOrphans := false
-	killAll := false
-	dryRun := true
-
-	for _, arg := range args {
-		if arg == "--orphans" {
-			killOrphans = true
-			dryRun = false
-		} else if arg == "--all" {
-			killAll = true
-			dryRun = false
+// recordSlotSession stores the slot's Claude session in the registry. An
+// empty sessionID records the newest transcript in the slot's session dir.
+func recordSlotSession(slotName, slotPath, sessionID string) {
+	sessionDir := claudeSessionDir(slotPath)
+	if sessionID == "" {
+		files, _ := filepath.Glob(filepath.Join(sessionDir, "*.jsonl"))
+		var newest time.Time
+		for _, f := range files {
+			if fi, err := os.Stat(f); err == nil && fi.ModTime().After(newest) {
+				newest = fi.ModTime()
+				sessionID = strings.TrimSuffix(filepath.Base(f), ".jsonl")
+			}
+		}
+		if sessionID == "" {
+			return
 		}
 	}
 
-	fmt.Println()
-	fmt.Println("════════════════════════════════════════════════════════════════")
-	fmt.Println("                     DOCKER CLEANUP")
-	fmt.Println("════════════════════════════════════════════════════════════════")
-	fmt.Println()
+	content, _ := os.ReadFile(filepath.Join(sessionDir, sessionID+".jsonl"))
+	slug := parseTranscriptSlug(string(content))
+	modifySlot(slotName, func(slot *SlotConfig) {
+		if slot.SessionID != sessionID {
+			slot.SessionSlug = ""
+		}
+		slot.SessionID = sessionID
+		if slug != "" {
+			slot.SessionSlug = slug
+		}
+	})
+}
 
-	processes := getDockerProcesses()
-	if len(processes) == 0 {
-		fmt.Println("No docker containers running.")
-		return
-	}
+// tmuxSessionName returns the tmux session for a slot (tmux rejects '.' and ':')
+func tmuxSessionName(slotName string) string {
+	return strings.NewReplacer(".", "-", ":", "-").Replace(slotName)
+}
 
-	registry := loadRegistry()
+func tmuxSessionExists(session string) bool {
+	return exec.Command("tmux", "has-session", "-t", "="+session).Run() == nil
+}
 
-	// Build set of known prefixes from registry (projects + slots)
-	knownPrefixes := make(map[string]string) // prefix -> label
-	for name := range registry.Projects {
-		knownPrefixes[name] = name + " (main)"
-	}
-	for name, slot := range registry.Slots {
-		knownPrefixes[name] = name + " (" + slot.Branch + ")"
-	}
+// TmuxLayout is the tmux session built for a slot: the project's
+// tmux_layout file, or the default agent/dev/logs windows
+type TmuxLayout struct {
+	Windows []TmuxWindow `json:"windows"`
+}
 
-	var attached []DockerProcess
-	var orphans []DockerProcess
+// TmuxWindow is one window of a layout. Panes are commands ("" for a shell);
+// {agent}, {dev} and {logs} stand for the slot's agent, its dev server and
+// its docker logs. Layout is a tmux layout (tiled, even-horizontal, ...).
+type TmuxWindow struct {
+	Name   string   `json:"name"`
+	Layout string   `json:"layout,omitempty"`
+	Panes  []string `json:"panes"`
+}
 
-	for _, p := range processes {
-		matched := false
-		for prefix, label := range knownPrefixes {
-			if strings.HasPrefix(p.Name, prefix+"-") || p.Name == prefix {
-				p.Project = label
-				attached = append(attached, p)
-				matched = true
-				break
-			}
+var defaultTmuxLayout = TmuxLayout{Windows: []TmuxWindow{
+	{Name: "{agent}", Panes: []string{"{agent}"}},
+	{Name: "dev", Panes: []string{"{dev}"}},
+	{Name: "logs", Panes: []string{"{logs}"}},
+}}
+
+// parseTmuxLayout reads a tmux_layout file
+func parseTmuxLayout(data []byte) (TmuxLayout, error) {
+	var layout TmuxLayout
+	if err := json.Unmarshal(data, &layout); err != nil {
+		return layout, err
+	}
+	if len(layout.Windows) == 0 {
+		return layout, fmt.Errorf("no windows")
+	}
+	seen := make(map[string]bool)
+	for i, w := range layout.Windows {
+		if w.Name == "" || seen[w.Name] {
+			return layout, fmt.Errorf("window %d needs a unique name", i+1)
 		}
-		if !matched {
-			orphans = append(orphans, p)
+		seen[w.Name] = true
+		if len(w.Panes) == 0 {
+			layout.Windows[i].Panes = []string{""}
 		}
 	}
+	return layout, nil
+}
 
-	fmt.Printf("\033[32mATTACHED TO SLOTS (%d):\033[0m\n", len(attached))
-	for _, p := range attached {
-		fmt.Printf("  • %s → %s\n", p.Name, p.Project)
+// expandPane fills a pane command's placeholders; a placeholder with nothing
+// to run (no dev script, no compose file) leaves a plain shell
+func expandPane(command string, vars map[string]string) string {
+	if value, ok := vars[strings.TrimSpace(command)]; ok {
+		return value
 	}
-	if len(attached) == 0 {
-		fmt.Println("  (none)")
+	for key, value := range vars {
+		command = strings.ReplaceAll(command, key, value)
 	}
-	fmt.Println()
+	return command
+}
 
-	fmt.Printf("\033[33mORPHAN CONTAINERS (%d):\033[0m\n", len(orphans))
-	for _, p := range orphans {
-		fmt.Printf("  • %s (%s)\n", p.Name, p.Image)
+// slotTmuxLayout is the layout a slot's session is built from
+func slotTmuxLayout(slotName string) (TmuxLayout, error) {
+	reg := loadRegistry()
+	slot := reg.Slots[slotName]
+	file := reg.Projects[slot.Project].TmuxLayout
+	if file == "" {
+		return defaultTmuxLayout, nil
 	}
-	if len(orphans) == 0 {
-		fmt.Println("  (none)")
+	data, err := os.ReadFile(filepath.Join(reg.Projects[slot.Project].Path, file))
+	if err != nil {
+		return TmuxLayout{}, fmt.Errorf("tmux layout %s: %v", file, err)
 	}
-	fmt.Println()
-
-	fmt.Println("════════════════════════════════════════════════════════════════")
+	layout, err := parseTmuxLayout(data)
+	if err != nil {
+		return TmuxLayout{}, fmt.Errorf("tmux layout %s: %v", file, err)
+	}
+	return layout, nil
+}
 
-	if dryRun {
-		fmt.Println("This is a dry run. To stop containers:")
-		fmt.Println("  slot-cli clean docker --orphans  (stop orphans only)")
-		fmt.Println("  slot-cli clean docker --all      (stop all containers)")
-		fmt.Println()
-		fmt.Println("Note: volumes are preserved (no -v flag).")
-		return
+// createSlotTmux creates a detached session for the slot from its layout
+// (by default windows for the agent, the dev server and docker logs).
+// startArgs are passed to the agent's `slot-cli start`.
+func createSlotTmux(slotName, slotPath string, startArgs ...string) error {
+	if runtime.GOOS == "windows" {
+		return fmt.Errorf("tmux is not available on Windows")
+	}
+	session := tmuxSessionName(slotName)
+	if tmuxSessionExists(session) {
+		return nil
+	}
+	layout, err := slotTmuxLayout(slotName)
+	if err != nil {
+		return err
 	}
 
-	var toStop []DockerProcess
-	if killAll {
-		toStop = processes
-		fmt.Printf("\n\033[36mStopping ALL %d containers...\033[0m\n", len(toStop))
-	} else if killOrphans {
-		toStop = orphans
-		fmt.Printf("\n\033[36mStopping %d orphan containers...\033[0m\n", len(toStop))
+	agentName, _ := resolveAgent("", slotPath)
+	logsCmd := ""
+	if fileExists(filepath.Join(slotPath, composeFileIn(slotPath))) {
+		logsCmd = "docker compose " + strings.Join(composeFileArgs(slotPath), " ") + " logs -f"
+	}
+	vars := map[string]string{
+		"{agent}": strings.Join(append([]string{"slot-cli", "start", "--no-layout"}, startArgs...), " "),
+		"{dev}":   detectDevCommand(slotPath),
+		"{logs}":  logsCmd,
 	}
 
-	for _, p := range toStop {
-		if err := exec.Command("docker", "stop", p.Name).Run(); err == nil {
-			fmt.Printf("  ✓ Stopped %s\n", p.Name)
-		} else {
-			fmt.Printf("  ✗ Failed to stop %s\n", p.Name)
+	devStarted := false
+	for i, w := range layout.Windows {
+		name := strings.ReplaceAll(w.Name, "{agent}", agentName)
+		target := session + ":" + name
+		// -P prints the new pane's id, independent of the user's base-index
+		create := []string{"new-window", "-d", "-P", "-F", "#{pane_id}", "-t", session, "-n", name, "-c", slotPath}
+		if i == 0 {
+			create = []string{"new-session", "-d", "-P", "-F", "#{pane_id}", "-s", session, "-n", name, "-c", slotPath}
+		}
+		for j, pane := range w.Panes {
+			if j > 0 {
+				create = []string{"split-window", "-d", "-P", "-F", "#{pane_id}", "-t", target, "-c", slotPath}
+			}
+			out, err := exec.Command("tmux", create...).CombinedOutput()
+			if err != nil {
+				return fmt.Errorf("%s", strings.TrimSpace(string(out)))
+			}
+			paneID := strings.TrimSpace(string(out))
+			if command := expandPane(pane, vars); command != "" {
+				// Everything but the agent is logged for `slot-cli logs`
+				if !strings.Contains(pane, "{agent}") && os.MkdirAll(slotLogDir(slotName), 0755) == nil {
+					logPath := filepath.Join(slotLogDir(slotName), logNameForCommand(command)+".log")
+					exec.Command("tmux", "pipe-pane", "-t", paneID, "cat >> "+shellQuote(logPath)).Run()
+				}
+				exec.Command("tmux", "send-keys", "-t", paneID, command, "Enter").Run()
+				if !strings.Contains(pane, "{agent}") && isDevServerCommand(strings.Fields(command)) {
+					devStarted = true
+				}
+			}
+		}
+		if len(w.Panes) > 1 || w.Layout != "" {
+			exec.Command("tmux", "select-layout", "-t", target, firstNonEmpty(w.Layout, "tiled")).Run()
 		}
 	}
-
-	fmt.Println()
-	fmt.Println("\033[32mDone! (volumes preserved)\033[0m")
+	if devStarted {
+		modifySlot(slotName, func(slot *SlotConfig) { slot.DevAt = time.Now().UTC().Format(time.RFC3339) })
+	}
+	return nil
 }
 
-type StorybookProcess struct {
-	PID     int
-	Port    int
-	Project string
-	CWD     string
+// detectDevCommand returns the command that starts the dev server, if any
+func detectDevCommand(dir string) string {
+	content, err := os.ReadFile(filepath.Join(dir, "package.json"))
+	if err != nil {
+		return ""
+	}
+	var pkg struct {
+		Scripts map[string]string `json:"scripts"`
+	}
+	if json.Unmarshal(content, &pkg) != nil || pkg.Scripts["dev"] == "" {
+		return ""
+	}
+	if fileExists(filepath.Join(dir, "pnpm-lock.yaml")) {
+		return "pnpm dev"
+	}
+	return "npm run dev"
 }
 
-func getStorybookProcesses() []StorybookProcess {
-	out, err := exec.Command("bash", "-c", `ps aux | grep "storybook/dist/bin/dispatcher.js" | grep -v grep`).Output()
-	if err != nil {
-		return nil
+// killSlotTmux kills the slot's tmux session if it exists
+func killSlotTmux(slotName string) {
+	session := tmuxSessionName(slotName)
+	if !tmuxSessionExists(session) {
+		return
+	}
+	if err := exec.Command("tmux", "kill-session", "-t", "="+session).Run(); err == nil {
+		fmt.Printf("✓ Killed tmux session %s\n", session)
 	}
+}
 
-	var processes []StorybookProcess
-	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
-		if line == "" {
-			continue
+func cmdAttach(args []string) {
+	slotName := resolveSlotName(args)
+	session := tmuxSessionName(slotName)
+
+	if !tmuxSessionExists(session) {
+		reg := loadRegistry()
+		slot, ok := reg.Slots[slotName]
+		if !ok {
+			fail(exitNotFound, fmt.Sprintf("slot '%s' not found", slotName))
 		}
-		fields := strings.Fields(line)
-		if len(fields) < 2 {
-			continue
+		slotPath := filepath.Join(filepath.Dir(reg.Projects[slot.Project].Path), slotName)
+		if err := createSlotTmux(slotName, slotPath); err != nil {
+			fail(exitError, fmt.Sprintf("could not create tmux session: %v", err))
 		}
-		pid, _ := strconv.Atoi(fields[1])
+		fmt.Printf("✓ Created tmux session %s\n", session)
+	}
+	attachTmux(session)
+}
 
-		// Find -p PORT
-		port := 6006
-		for i, f := range fields {
-			if f == "-p" && i+1 < len(fields) {
-				port, _ = strconv.Atoi(fields[i+1])
-				break
-			}
-		}
+// attachTmux attaches to a session, or switches to it from inside tmux
+func attachTmux(session string) {
+	tmuxCmd := "attach-session"
+	if os.Getenv("TMUX") != "" {
+		tmuxCmd = "switch-client"
+	}
+	cmd := exec.Command("tmux", tmuxCmd, "-t", "="+session)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		os.Exit(exitError)
+	}
+}
 
-		// Extract project from path
-		re := regexp.MustCompile(`/Projects/[^/]+/([^/]+)`)
-		matches := re.FindStringSubmatch(line)
-		project := "unknown"
-		if len(matches) > 1 {
-			project = matches[1]
+// slotEnv returns the environment exported to commands run in a slot: its
+// name/path plus every port from its env files (root files take precedence,
+// .env.local over .env)
+func slotEnv(slotName, slotPath string) []string {
+	vars := map[string]string{}
+	scanFiles(slotPath, func(path string) bool {
+		name := filepath.Base(path)
+		if (name != ".env" && name != ".env.local") || filepath.Dir(path) == slotPath {
+			return false
+		}
+		// node_modules, .next and .git are never indexed
+		rel, _ := filepath.Rel(slotPath, path)
+		return !slices.Contains(strings.Split(filepath.Dir(rel), string(filepath.Separator)), "dist")
+	}, func(path string, content []byte) {
+		for k, v := range ports.EnvVars(string(content)) {
+			vars[k] = v
 		}
-
-		// Extract cwd
-		cwdRe := regexp.MustCompile(`(/Users/[^\s]+)/node_modules`)
-		cwdMatches := cwdRe.FindStringSubmatch(line)
-		cwd := ""
-		if len(cwdMatches) > 1 {
-			cwd = strings.Replace(cwdMatches[1], "/apps/web", "", 1)
+	})
+	for _, name := range []string{".env", ".env.local"} {
+		content, _ := os.ReadFile(filepath.Join(slotPath, name))
+		for k, v := range ports.EnvVars(string(content)) {
+			vars[k] = v
 		}
+	}
 
-		processes = append(processes, StorybookProcess{
-			PID:     pid,
-			Port:    port,
-			Project: project,
-			CWD:     cwd,
-		})
+	env := []string{"SLOT_NAME=" + slotName, "SLOT_PATH=" + slotPath}
+	keys := make([]string, 0, len(vars))
+	for k := range vars {
+		keys = append(keys, k)
 	}
-	return processes
+	sort.Strings(keys)
+	for _, k := range keys {
+		env = append(env, k+"="+vars[k])
+	}
+	return env
 }
 
-func getConfiguredStorybookPorts() map[int]string {
-	ports := make(map[int]string)
-	registry := loadRegistry()
+// resolveSlotArg resolves an optional slot argument (number, name or full
+// slot name) to an existing slot, defaulting to the slot we're in
+func resolveSlotArg(args []string) (slotName, slotPath string) {
+	cwd, _ := os.Getwd()
+	mainRepo, project := worktree.DetectProject(cwd)
+	if mainRepo == "" {
+		fail(exitUsage, "not in a git repository")
+	}
 
-	for name, project := range registry.Projects {
-		// Read from main project
-		port := readEnvPort(project.Path, "STORYBOOK_PORT")
-		if port > 0 {
-			ports[port] = name
+	slotName = filepath.Base(cwd)
+	if len(args) > 0 {
+		slotName = args[0]
+		if !strings.HasPrefix(slotName, project+"-") {
+			slotName = fmt.Sprintf("%s-%s", project, args[0])
 		}
+	} else if _, ok := loadRegistry().Slots[slotName]; !ok {
+		fail(exitUsage, "not in a slot, pass the slot number or name")
 	}
 
-	for name, slot := range registry.Slots {
-		project := registry.Projects[slot.Project]
-		if project.Path == "" {
-			continue
+	slotPath = filepath.Join(filepath.Dir(mainRepo), slotName)
+	if _, err := os.Stat(slotPath); os.IsNotExist(err) {
+		fail(exitNotFound, fmt.Sprintf("slot '%s' not found", slotName))
+	}
+	return slotName, slotPath
+}
+
+// slotURL returns the slot's app URL from its PORT, using the slot domain
+// when slot DNS is set up
+func slotURL(slotName, slotPath string) string {
+	return slotPortURL(slotName, slotPath, "PORT")
+}
+
+// slotPortURL is slotURL for any port variable, e.g. STORYBOOK_PORT (also
+// looked up in the monorepo app dirs readEnvPort knows)
+func slotPortURL(slotName, slotPath, varName string) string {
+	port := ""
+	for _, name := range []string{".env", ".env.local"} {
+		content, _ := os.ReadFile(filepath.Join(slotPath, name))
+		if p := ports.EnvVars(string(content))["SLOT_"+varName]; p != "" {
+			port = p
 		}
-		slotPath := filepath.Join(filepath.Dir(project.Path), name)
-		port := readEnvPort(slotPath, "STORYBOOK_PORT")
-		if port > 0 {
-			ports[port] = name
+	}
+	if port == "" {
+		if p := readEnvPort(slotPath, varName); p != 0 {
+			port = strconv.Itoa(p)
 		}
 	}
-
-	return ports
+	if port == "" {
+		return ""
+	}
+	host := "localhost"
+	if hosts, dnsmasq := slotDNSEnabled(); hosts || dnsmasq {
+		host = slotDomain(slotName)
+	}
+	return fmt.Sprintf("http://%s:%s", host, port)
 }
 
-func readEnvPort(basePath, varName string) int {
-	subdirs := []string{"", "apps/web", "packages/ui"}
-	envFiles := []string{".env.local", ".env"}
+// clipboardCandidates lists copy commands to try, in order, for a platform
+func clipboardCandidates(goos string, wayland bool) [][]string {
+	switch goos {
+	case "darwin":
+		return [][]string{{"pbcopy"}}
+	case "windows":
+		return [][]string{{"clip"}}
+	}
+	var candidates [][]string
+	if wayland {
+		candidates = append(candidates, []string{"wl-copy"})
+	}
+	return append(candidates,
+		[]string{"xclip", "-selection", "clipboard"},
+		[]string{"xsel", "--clipboard", "--input"},
+		[]string{"clip.exe"}, // WSL
+	)
+}
 
-	for _, subdir := range subdirs {
-		for _, envFile := range envFiles {
-			path := filepath.Join(basePath, subdir, envFile)
-			content, err := os.ReadFile(path)
-			if err != nil {
-				continue
-			}
-			re := regexp.MustCompile(varName + `=["']?(\d+)["']?`)
-			matches := re.FindSubmatch(content)
-			if len(matches) > 1 {
-				port, _ := strconv.Atoi(string(matches[1]))
-				return port
-			}
+// copyToClipboard copies text using the first available clipboard tool
+func copyToClipboard(text string) error {
+	for _, c := range clipboardCandidates(runtime.GOOS, os.Getenv("WAYLAND_DISPLAY") != "") {
+		if _, err := exec.LookPath(c[0]); err != nil {
+			continue
 		}
+		cmd := exec.Command(c[0], c[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		return cmd.Run()
 	}
-	return 0
+	return fmt.Errorf("no clipboard tool found")
 }
 
-func cmdCleanStorybook(args []string) {
-	killOrphans := false
-	killAll := false
-	dryRun := true
+// openURL opens a URL or path with the desktop's default handler
+func openURL(target string) error {
+	switch runtime.GOOS {
+	case "darwin":
+		return exec.Command("open", target).Start()
+	case "windows":
+		return exec.Command("cmd", "/c", "start", "", target).Start()
+	default:
+		return exec.Command("xdg-open", target).Start()
+	}
+}
 
+func cmdOpen(args []string) {
+	editorFlag, args := extractFlag(args, "--editor")
+	browser := false
+	var slotArgs []string
 	for _, arg := range args {
-		if arg == "--orphans" {
-			killOrphans = true
-			dryRun = false
-		} else if arg == "--all" {
-			killAll = true
-			dryRun = false
+		if arg == "--browser" || arg == "-b" {
+			browser = true
+		} else if !strings.HasPrefix(arg, "--") {
+			slotArgs = append(slotArgs, arg)
 		}
 	}
+	slotName, slotPath := resolveSlotArg(slotArgs)
 
-	fmt.Println()
-	fmt.Println("════════════════════════════════════════════════════════════════")
-	fmt.Println("                     STORYBOOK CLEANUP")
-	fmt.Println("════════════════════════════════════════════════════════════════")
-	fmt.Println()
-
-	processes := getStorybookProcesses()
-	if len(processes) == 0 {
-		fmt.Println("No storybook processes running.")
-		return
+	editor := firstNonEmpty(editorFlag, loadConfig().Editor, os.Getenv("VISUAL"), "code")
+	fields := strings.Fields(editor)
+	if err := exec.Command(fields[0], append(fields[1:], slotPath)...).Start(); err != nil {
+		fail(exitError, fmt.Sprintf("could not start %s: %v", editor, err))
 	}
+	fmt.Printf("✓ Opened %s in %s\n", slotName, editor)
 
-	configuredPorts := getConfiguredStorybookPorts()
-
-	var attached []StorybookProcess
-	var orphans []StorybookProcess
-
-	for _, p := range processes {
-		if _, ok := configuredPorts[p.Port]; ok {
-			attached = append(attached, p)
-		} else {
-			orphans = append(orphans, p)
+	if browser {
+		url := slotURL(slotName, slotPath)
+		if url == "" {
+			fmt.Println("⚠ No PORT found in the slot's .env, not opening a browser")
+			return
+		}
+		if err := openURL(url); err != nil {
+			fmt.Printf("⚠ Could not open %s: %v\n", url, err)
+			return
 		}
+		fmt.Printf("✓ Opened %s\n", url)
 	}
+}
 
-	// Show attached
-	fmt.Printf("\033[32mATTACHED TO SLOTS (%d):\033[0m\n", len(attached))
-	for _, p := range attached {
-		slot := configuredPorts[p.Port]
-		fmt.Printf("  • %s :%d (pid %d) → %s\n", p.Project, p.Port, p.PID, slot)
-	}
-	if len(attached) == 0 {
-		fmt.Println("  (none)")
+// cmdURL prints the slot's web URL (or storybook URL), optionally opening it
+func cmdURL(args []string) {
+	open, storybook := false, false
+	var slotArgs []string
+	for _, arg := range args {
+		switch arg {
+		case "--open", "-o":
+			open = true
+		case "--storybook":
+			storybook = true
+		default:
+			if !strings.HasPrefix(arg, "-") {
+				slotArgs = append(slotArgs, arg)
+			}
+		}
 	}
-	fmt.Println()
+	slotName, slotPath := resolveSlotArg(slotArgs)
 
-	// Show orphans
-	fmt.Printf("\033[33mORPHAN STORYBOOKS (%d):\033[0m\n", len(orphans))
-	for _, p := range orphans {
-		fmt.Printf("  • %s :%d (pid %d)\n", p.Project, p.Port, p.PID)
+	varName := "PORT"
+	if storybook {
+		varName = "STORYBOOK_PORT"
 	}
-	if len(orphans) == 0 {
-		fmt.Println("  (none)")
-	}
-	fmt.Println()
-
-	fmt.Println("════════════════════════════════════════════════════════════════")
-
-	if dryRun {
-		fmt.Println("This is a dry run. To kill processes:")
-		fmt.Println("  slot-cli clean storybook --orphans  (kill orphans only)")
-		fmt.Println("  slot-cli clean storybook --all      (kill all storybooks)")
-		return
+	url := slotPortURL(slotName, slotPath, varName)
+	if url == "" {
+		fail(exitNotFound, fmt.Sprintf("no %s in %s's env", varName, slotName))
 	}
-
-	var toKill []StorybookProcess
-	if killAll {
-		toKill = processes
-		fmt.Printf("\n\033[36mKilling ALL %d storybooks...\033[0m\n", len(toKill))
-	} else if killOrphans {
-		toKill = orphans
-		fmt.Printf("\n\033[36mKilling %d orphan storybooks...\033[0m\n", len(toKill))
+	if jsonOutput {
+		data, _ := json.MarshalIndent(map[string]string{"slot": slotName, "url": url}, "", "  ")
+		fmt.Println(string(data))
+	} else {
+		fmt.Println(url)
 	}
-
-	for _, p := range toKill {
-		if err := exec.Command("kill", strconv.Itoa(p.PID)).Run(); err == nil {
-			fmt.Printf("  ✓ Killed %s :%d (pid %d)\n", p.Project, p.Port, p.PID)
-		} else {
-			fmt.Printf("  ✗ Failed to kill %s :%d (pid %d)\n", p.Project, p.Port, p.PID)
+	if open {
+		if err := openURL(url); err != nil {
+			fail(exitError, fmt.Sprintf("could not open %s: %v", url, err))
 		}
 	}
+}
 
-	fmt.Println()
-	fmt.Println("\033[32mDone!\033[0m")
+// tunnelTools are the tunnel programs share can use, in order of preference
+// (cloudflared's quick tunnels need no account)
+var tunnelTools = []string{"cloudflared", "ngrok"}
+
+// tunnelArgs is the command line that tunnels tool to a local port
+func tunnelArgs(tool, port string) []string {
+	if tool == "ngrok" {
+		return []string{"ngrok", "http", port, "--log", "stdout"}
+	}
+	return []string{"cloudflared", "tunnel", "--url", "http://localhost:" + port}
 }
 
-type WebServerProcess struct {
-	PID     int
-	Port    int
-	Project string
-	CWD     string
+var tunnelURLRe = regexp.MustCompile(`https://[a-z0-9-]+\.(?:trycloudflare\.com|ngrok(?:-free)?\.(?:app|dev|io))`)
+
+// tunnelURL finds the public URL in a tunnel program's output
+func tunnelURL(output string) string {
+	return tunnelURLRe.FindString(output)
 }
 
-func getWebServerProcesses() []WebServerProcess {
-	// Look for Next.js dev servers (the main worker process)
-	out, err := exec.Command("bash", "-c", `ps aux | grep -E "next-server|next dev" | grep -v grep`).Output()
+// processAlive reports whether pid is still running (assumed on Windows)
+func processAlive(pid int) bool {
+	proc, err := os.FindProcess(pid)
 	if err != nil {
-		return nil
+		return false
 	}
+	return runtime.GOOS == "windows" || proc.Signal(syscall.Signal(0)) == nil
+}
 
-	var processes []WebServerProcess
-	seen := make(map[int]bool)
+// stopTunnel ends a slot's share tunnel, if it has one running
+func stopTunnel(slot SlotConfig) bool {
+	if slot.TunnelPID == 0 || !processAlive(slot.TunnelPID) {
+		return false
+	}
+	return terminateProcess(slot.TunnelPID) == nil
+}
 
-	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
-		if line == "" {
-			continue
+// cmdShare starts a public tunnel to the slot's web port for demos; the
+// tunnel runs in the background until share --stop or the slot is removed
+func cmdShare(args []string) {
+	toolFlag, args := extractFlag(args, "--tool")
+	stop := slices.Contains(args, "--stop")
+	noQR := slices.Contains(args, "--no-qr")
+	var slotArgs []string
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			slotArgs = append(slotArgs, arg)
 		}
-		fields := strings.Fields(line)
-		if len(fields) < 2 {
-			continue
-		}
-		pid, _ := strconv.Atoi(fields[1])
-		if seen[pid] {
-			continue
+	}
+	slotName, slotPath := resolveSlotArg(slotArgs)
+	reg := loadRegistry()
+	slot, ok := reg.Slots[slotName]
+	if !ok {
+		fail(exitNotFound, fmt.Sprintf("%s has no registry entry", slotName), "slot-cli adopt "+slotPath)
+	}
+
+	if stop {
+		if !stopTunnel(slot) {
+			fmt.Printf("%s is not shared\n", slotName)
+		} else {
+			fmt.Printf("✓ Stopped the tunnel for %s\n", slotName)
 		}
-		seen[pid] = true
+		slot.TunnelPID, slot.TunnelURL = 0, ""
+		reg.Slots[slotName] = slot
+		saveRegistry(reg)
+		return
+	}
+	if slot.TunnelPID != 0 && processAlive(slot.TunnelPID) {
+		fmt.Printf("%s is already shared at %s (pid %d)\n", slotName, slot.TunnelURL, slot.TunnelPID)
+		fmt.Printf("  slot-cli share %s --stop\n", slotName)
+		return
+	}
 
-		// Find -p PORT or --port PORT
-		port := 3000
-		for i, f := range fields {
-			if (f == "-p" || f == "--port") && i+1 < len(fields) {
-				p, err := strconv.Atoi(fields[i+1])
-				if err == nil {
-					port = p
-				}
+	port := ""
+	if url := slotPortURL(slotName, slotPath, "PORT"); url != "" {
+		port = url[strings.LastIndex(url, ":")+1:]
+	}
+	if port == "" {
+		fail(exitNotFound, fmt.Sprintf("no PORT in %s's env", slotName))
+	}
+	tool := toolFlag
+	if tool == "" {
+		for _, t := range tunnelTools {
+			if _, err := exec.LookPath(t); err == nil {
+				tool = t
 				break
 			}
 		}
+	}
+	if !slices.Contains(tunnelTools, tool) {
+		fail(exitNotFound, "no tunnel tool found", "Install cloudflared (brew install cloudflared) or ngrok, or pass --tool")
+	}
 
-		// Extract project from path
-		re := regexp.MustCompile(`/Projects/[^/]+/([^/]+)`)
-		matches := re.FindStringSubmatch(line)
-		project := "unknown"
-		if len(matches) > 1 {
-			project = matches[1]
+	logPath := filepath.Join(slotLogDir(slotName), "tunnel.log")
+	os.MkdirAll(filepath.Dir(logPath), 0755)
+	logFile, err := os.Create(logPath)
+	if err != nil {
+		fail(exitError, err.Error())
+	}
+	defer logFile.Close()
+	argv := tunnelArgs(tool, port)
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Stdout, cmd.Stderr = logFile, logFile
+	if err := cmd.Start(); err != nil {
+		fail(exitError, fmt.Sprintf("could not start %s: %v", tool, err))
+	}
+	pid := cmd.Process.Pid
+	exited := make(chan struct{})
+	go func() { cmd.Wait(); close(exited) }()
+
+	fmt.Printf("Starting %s tunnel to localhost:%s...\n", tool, port)
+	url := ""
+	deadline := time.After(30 * time.Second)
+	for url == "" {
+		select {
+		case <-exited:
+			output, _ := os.ReadFile(logPath)
+			fmt.Print(lastLines(string(output), 10))
+			fail(exitError, fmt.Sprintf("%s exited before the tunnel was up", tool))
+		case <-deadline:
+			cmd.Process.Kill()
+			fail(exitError, fmt.Sprintf("%s printed no public URL in 30s", tool), "See "+logPath)
+		case <-time.After(500 * time.Millisecond):
+			output, _ := os.ReadFile(logPath)
+			url = tunnelURL(string(output))
+		}
+	}
+	cmd.Process.Release()
+
+	reg = loadRegistry()
+	slot = reg.Slots[slotName]
+	slot.TunnelPID, slot.TunnelURL = pid, url
+	reg.Slots[slotName] = slot
+	saveRegistry(reg)
+	fmt.Printf("✓ %s is shared at %s\n", slotName, url)
+	if !noQR {
+		if _, err := exec.LookPath("qrencode"); err == nil {
+			qr := exec.Command("qrencode", "-t", "ANSIUTF8", url)
+			qr.Stdout = os.Stdout
+			qr.Run()
 		}
+	}
+	fmt.Printf("  Stop it with: slot-cli share %s --stop (delete, done and clean stop it too)\n", slotName)
+}
 
-		// Extract cwd
-		cwdRe := regexp.MustCompile(`(/Users/[^\s]+)`)
-		cwdMatches := cwdRe.FindStringSubmatch(line)
-		cwd := ""
-		if len(cwdMatches) > 1 {
-			cwd = cwdMatches[1]
-		}
+// slotDevcontainerDir holds the devcontainer config generated for a slot;
+// VS Code offers every .devcontainer/<dir>/devcontainer.json to reopen in
+const slotDevcontainerDir = ".devcontainer/slot"
 
-		processes = append(processes, WebServerProcess{
-			PID:     pid,
-			Port:    port,
-			Project: project,
-			CWD:     cwd,
-		})
-	}
-	return processes
+// defaultDevcontainer is the base config for projects without their own
+// .devcontainer/devcontainer.json
+var defaultDevcontainer = map[string]any{
+	"image": "mcr.microsoft.com/devcontainers/universal:2",
 }
 
-func cmdCleanWeb(args []string) {
-	killOrphans := false
-	killAll := false
-	dryRun := true
+// stripJSONC removes // and /* */ comments and trailing commas, which
+// devcontainer.json allows, leaving plain JSON
+func stripJSONC(data []byte) []byte {
+	var out []byte
+	inString := false
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case inString:
+			out = append(out, c)
+			if c == '\\' && i+1 < len(data) {
+				i++
+				out = append(out, data[i])
+			} else if c == '"' {
+				inString = false
+			}
+		case c == '"':
+			inString = true
+			out = append(out, c)
+		case c == '/' && i+1 < len(data) && data[i+1] == '/':
+			for i < len(data) && data[i] != '\n' {
+				i++
+			}
+			i--
+		case c == '/' && i+1 < len(data) && data[i+1] == '*':
+			end := bytes.Index(data[i+2:], []byte("*/"))
+			if end < 0 {
+				return out
+			}
+			i += end + 3
+		case c == '}' || c == ']':
+			trimmed := bytes.TrimRight(out, " \t\r\n")
+			if len(trimmed) > 0 && trimmed[len(trimmed)-1] == ',' {
+				out = append(trimmed[:len(trimmed)-1], out[len(trimmed):]...)
+			}
+			out = append(out, c)
+		default:
+			out = append(out, c)
+		}
+	}
+	return out
+}
 
-	for _, arg := range args {
-		if arg == "--orphans" {
-			killOrphans = true
-			dryRun = false
-		} else if arg == "--all" {
-			killAll = true
-			dryRun = false
+// devcontainerConfig tailors a project's devcontainer config to a slot:
+// named after its compose project, forwarding the slot's ports (envPorts
+// as from ports.EnvVars), with relative paths rebased one directory down
+func devcontainerConfig(base map[string]any, composeName string, envPorts map[string]string) map[string]any {
+	config := maps.Clone(base)
+	config["name"] = composeName
+
+	rebase := func(p any) any {
+		if s, ok := p.(string); ok && !filepath.IsAbs(s) && !strings.HasPrefix(s, "${") {
+			return "../" + s
+		}
+		return p
+	}
+	switch files := config["dockerComposeFile"].(type) {
+	case string:
+		config["dockerComposeFile"] = rebase(files)
+	case []any:
+		rebased := make([]any, len(files))
+		for i, f := range files {
+			rebased[i] = rebase(f)
+		}
+		config["dockerComposeFile"] = rebased
+	}
+	if build, ok := config["build"].(map[string]any); ok {
+		build = maps.Clone(build)
+		for _, key := range []string{"dockerfile", "context"} {
+			if v, ok := build[key]; ok {
+				build[key] = rebase(v)
+			}
 		}
+		if _, ok := build["context"]; !ok {
+			build["context"] = ".." // the default is the config's own dir
+		}
+		config["build"] = build
 	}
 
-	fmt.Println()
-	fmt.Println("════════════════════════════════════════════════════════════════")
-	fmt.Println("                     WEB SERVER CLEANUP")
-	fmt.Println("════════════════════════════════════════════════════════════════")
-	fmt.Println()
+	// Compose names the service containers itself; image and Dockerfile
+	// containers get the slot's name so they don't clash with main's
+	if _, compose := config["dockerComposeFile"]; !compose {
+		var runArgs []any
+		existing, _ := config["runArgs"].([]any)
+		for i := 0; i < len(existing); i++ {
+			if existing[i] == "--name" {
+				i++
+				continue
+			}
+			runArgs = append(runArgs, existing[i])
+		}
+		config["runArgs"] = append(runArgs, "--name", composeName+"-devcontainer")
+	}
 
-	processes := getWebServerProcesses()
-	if len(processes) == 0 {
-		fmt.Println("No web server processes running.")
-		return
+	vars := slices.Sorted(maps.Keys(envPorts))
+	var forward []any
+	attributes := make(map[string]any)
+	for _, v := range vars {
+		port, err := strconv.Atoi(envPorts[v])
+		if err != nil || slices.Contains(forward, any(port)) {
+			continue
+		}
+		forward = append(forward, port)
+		attributes[envPorts[v]] = map[string]any{"label": strings.TrimPrefix(v, "SLOT_")}
 	}
+	slices.SortFunc(forward, func(a, b any) int { return a.(int) - b.(int) })
+	config["forwardPorts"] = forward
+	config["portsAttributes"] = attributes
+	return config
+}
 
-	configuredPorts := make(map[int]string)
-	registry := loadRegistry()
-	for name, project := range registry.Projects {
-		port := readEnvPort(project.Path, "PORT")
-		if port > 0 {
-			configuredPorts[port] = name
+// writeSlotDevcontainer generates the slot's devcontainer config from main's
+// (or a default) and keeps it out of git
+func writeSlotDevcontainer(mainRepo, slotPath string) (string, error) {
+	base := defaultDevcontainer
+	if data, err := os.ReadFile(filepath.Join(mainRepo, ".devcontainer", "devcontainer.json")); err == nil {
+		base = nil
+		if err := json.Unmarshal(stripJSONC(data), &base); err != nil {
+			return "", fmt.Errorf("main's .devcontainer/devcontainer.json: %v", err)
 		}
 	}
-	for name, slot := range registry.Slots {
-		project := registry.Projects[slot.Project]
-		if project.Path == "" {
-			continue
+	envPorts := make(map[string]string)
+	for _, name := range []string{".env", ".env.local"} {
+		content, _ := os.ReadFile(filepath.Join(slotPath, name))
+		maps.Copy(envPorts, ports.EnvVars(string(content)))
+	}
+	config := devcontainerConfig(base, composeProjectName(slotPath), envPorts)
+
+	dir := filepath.Join(slotPath, slotDevcontainerDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	data, _ := json.MarshalIndent(config, "", "  ")
+	path := filepath.Join(dir, "devcontainer.json")
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return "", err
+	}
+	addToInfoExclude(slotPath, slotDevcontainerDir+"/")
+	return path, nil
+}
+
+// cmdDevcontainer (re)generates a slot's devcontainer config, e.g. after
+// fix-ports changed its ports
+func cmdDevcontainer(args []string) {
+	slotName, slotPath := resolveSlotArg(args)
+	cwd, _ := os.Getwd()
+	mainRepo, _ := worktree.DetectProject(cwd)
+	path, err := writeSlotDevcontainer(mainRepo, slotPath)
+	if err != nil {
+		fail(exitError, err.Error())
+	}
+	fmt.Printf("✓ Wrote %s\n", path)
+	fmt.Printf("→ slot-cli open %s, then \"Dev Containers: Reopen in Container\" and pick \"slot\"\n", slotName)
+}
+
+// cmdNewRemote creates the slot with slot-cli on host (worktree, docker
+// stack and DB clone all happen there) and tracks it in the local registry
+func cmdNewRemote(host string, args []string) {
+	cwd, _ := os.Getwd()
+	mainRepo, project := worktree.DetectProject(cwd)
+	if mainRepo == "" {
+		fail(exitUsage, "not in a git repository")
+	}
+	before, err := remote.Registry(host)
+	if err != nil {
+		fail(exitError, err.Error(), "slot-cli must be installed on "+host)
+	}
+	remoteProject, ok := before.Projects[project]
+	if !ok {
+		fail(exitNotFound, fmt.Sprintf("%s is not registered on %s", project, host),
+			fmt.Sprintf("Clone it there and run slot-cli init: ssh %s", host))
+	}
+	// Refuse a name a local slot already uses, as local new does; auto-numbered
+	// and derived names are only known afterwards and are checked below
+	reg := loadRegistry()
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name := project + "-" + args[0]
+		if _, exists := reg.Slots[name]; exists || fileExists(filepath.Join(filepath.Dir(mainRepo), name)) {
+			fail(exitExists, fmt.Sprintf("slot %s already exists locally", name),
+				"Pick another name: slot-cli new <name> --host "+host)
 		}
-		slotPath := filepath.Join(filepath.Dir(project.Path), name)
-		port := readEnvPort(slotPath, "PORT")
-		if port > 0 {
-			configuredPorts[port] = name
+	}
+
+	fmt.Printf("Creating the slot on %s:%s\n\n", host, remoteProject.Path)
+	newArgs := append([]string{"new", "--no-clipboard"}, args...)
+	if assumeYes {
+		newArgs = append(newArgs, "--yes")
+	}
+	if err := remote.Run(host, remoteProject.Path, newArgs...); err != nil {
+		fail(exitError, fmt.Sprintf("slot-cli new on %s failed: %v", host, err))
+	}
+	after, err := remote.Registry(host)
+	if err != nil {
+		fail(exitError, err.Error())
+	}
+	var created []string
+	for name, slot := range after.Slots {
+		if _, existed := before.Slots[name]; !existed && slot.Project == project {
+			created = append(created, name)
 		}
 	}
+	if len(created) != 1 {
+		fail(exitError, fmt.Sprintf("can't tell which slot was created on %s (%d new)", host, len(created)))
+	}
+
+	slotName := created[0]
+	reg = loadRegistry()
+	if _, exists := reg.Slots[slotName]; exists {
+		fail(exitExists, fmt.Sprintf("slot %s was created on %s but already exists locally; not tracking it", slotName, host),
+			fmt.Sprintf("Remove it there: ssh %s slot-cli delete %s", host, slotName),
+			"Then pick a name no local slot uses: slot-cli new <name> --host "+host)
+	}
+	slot := after.Slots[slotName]
+	slot.Host = host
+	slot.RemotePath = path.Join(path.Dir(remoteProject.Path), slotName)
+	reg.Slots[slotName] = slot
+	saveRegistry(reg)
 
-	var attached []WebServerProcess
-	var orphans []WebServerProcess
+	fmt.Printf("\n✓ Tracking %s on %s:%s\n", slotName, host, slot.RemotePath)
+	fmt.Printf("→ ssh %s, then: cd %s && slot-cli start\n", host, slot.RemotePath)
+}
 
-	for _, p := range processes {
-		if _, ok := configuredPorts[p.Port]; ok {
-			attached = append(attached, p)
-		} else {
-			orphans = append(orphans, p)
+// printRemoteSlots lists the slots that live on other machines
+func printRemoteSlots(reg *Registry) {
+	var remote []string
+	for name, slot := range reg.Slots {
+		if slot.Host != "" {
+			remote = append(remote, name)
 		}
 	}
+	if len(remote) == 0 {
+		return
+	}
+	sort.Strings(remote)
+	fmt.Println("\nRemote slots (slot-cli info <N|name> asks the host):")
+	for _, name := range remote {
+		slot := reg.Slots[name]
+		fmt.Printf("  ⇄ %-28s %s:%s  %s\n", name, slot.Host, slot.RemotePath, slot.Branch)
+	}
+}
 
-	fmt.Printf("\033[32mATTACHED TO SLOTS (%d):\033[0m\n", len(attached))
-	for _, p := range attached {
-		slot := configuredPorts[p.Port]
-		fmt.Printf("  • %s :%d (pid %d) → %s\n", p.Project, p.Port, p.PID, slot)
+// printIdleSlots lists the slots idle for idleThreshold or longer, most idle first
+func printIdleSlots(reg *Registry) {
+	now := time.Now()
+	var idle []string
+	for name, slot := range reg.Slots {
+		if fileExists(reg.SlotPath(name)) && idleFor(slot, now) >= idleThreshold {
+			idle = append(idle, name)
+		}
 	}
-	if len(attached) == 0 {
-		fmt.Println("  (none)")
+	if len(idle) == 0 {
+		return
 	}
-	fmt.Println()
+	sort.Slice(idle, func(i, j int) bool {
+		return idleFor(reg.Slots[idle[i]], now) > idleFor(reg.Slots[idle[j]], now)
+	})
+	fmt.Printf("\nIdle slots (no commits, agent or dev server for %d+ days):\n", int(idleThreshold/(24*time.Hour)))
+	for _, name := range idle {
+		fmt.Printf("  ⚠ %-28s %s\n", name, idleLabel(idleFor(reg.Slots[name], now)))
+	}
+	fmt.Println("  (review with: slot-cli clean --idle 7d)")
+}
 
-	fmt.Printf("\033[33mORPHAN WEB SERVERS (%d):\033[0m\n", len(orphans))
-	for _, p := range orphans {
-		fmt.Printf("  • %s :%d (pid %d)\n", p.Project, p.Port, p.PID)
+// idleThreshold is how long a slot goes without activity before list and
+// clean call it idle
+const idleThreshold = 7 * 24 * time.Hour
+
+// defaultCleanGrace keeps clean from removing a slot that was just created
+// (and so has no commits yet) unless clean_grace or --grace says otherwise
+const defaultCleanGrace = 24 * time.Hour
+
+// cleanGrace resolves the grace period from --grace, else config clean_grace
+func cleanGrace(flag string) (time.Duration, error) {
+	value := flag
+	if value == "" {
+		value = loadConfig().CleanGrace
 	}
-	if len(orphans) == 0 {
-		fmt.Println("  (none)")
+	switch value {
+	case "":
+		return defaultCleanGrace, nil
+	case "0":
+		return 0, nil
 	}
-	fmt.Println()
+	return parseSince(value)
+}
 
-	fmt.Println("════════════════════════════════════════════════════════════════")
+// slotAge is how long ago a slot was created, from the registry's created_at
+// or else fallback (the worktree's .git file time)
+func slotAge(createdAt string, fallback, now time.Time) time.Duration {
+	if t, err := time.Parse(time.RFC3339, createdAt); err == nil {
+		return now.Sub(t)
+	}
+	return now.Sub(fallback)
+}
 
-	if dryRun {
-		fmt.Println("This is a dry run. To kill processes:")
-		fmt.Println("  slot-cli clean web --orphans  (kill orphans only)")
-		fmt.Println("  slot-cli clean web --all      (kill all web servers)")
-		return
+// idleFor is how long a slot has gone without recorded activity (0 if unknown)
+func idleFor(slot SlotConfig, now time.Time) time.Duration {
+	last := slot.LastActive()
+	if last.IsZero() || last.After(now) {
+		return 0
 	}
+	return now.Sub(last)
+}
 
-	var toKill []WebServerProcess
-	if killAll {
-		toKill = processes
-		fmt.Printf("\n\033[36mKilling ALL %d web servers...\033[0m\n", len(toKill))
-	} else if killOrphans {
-		toKill = orphans
-		fmt.Printf("\n\033[36mKilling %d orphan web servers...\033[0m\n", len(toKill))
+// idleLabel formats an idle duration as "idle 12 days" or "idle 5h"
+func idleLabel(d time.Duration) string {
+	if days := int(d / (24 * time.Hour)); days >= 2 {
+		return fmt.Sprintf("idle %d days", days)
 	}
+	return fmt.Sprintf("idle %dh", int(d/time.Hour))
+}
 
-	skipped := 0
-	for _, p := range toKill {
-		// Never kill the exceder dashboard
-		if p.Project == "exceder" || (p.CWD != "" && strings.Contains(p.CWD, "exceder")) {
-			fmt.Printf("  ⊘ Skipped %s :%d (pid %d) — exceder dashboard\n", p.Project, p.Port, p.PID)
-			skipped++
+// noteSlotActivity records on reg what commands can see for free: each
+// slot's newest commit and the agents running in it. Reports whether
+// anything changed (the caller saves).
+func noteSlotActivity(reg *Registry, agents []AgentProcess, now time.Time) bool {
+	changed := false
+	for name, slot := range reg.Slots {
+		path := reg.SlotPath(name)
+		if path == "" || !fileExists(path) {
 			continue
 		}
-		if err := exec.Command("kill", strconv.Itoa(p.PID)).Run(); err == nil {
-			fmt.Printf("  ✓ Killed %s :%d (pid %d)\n", p.Project, p.Port, p.PID)
-		} else {
-			fmt.Printf("  ✗ Failed to kill %s :%d (pid %d)\n", p.Project, p.Port, p.PID)
+		updated := slot
+		if out, err := exec.Command("git", "-C", path, "log", "-1", "--format=%cI").Output(); err == nil {
+			if t, err := time.Parse(time.RFC3339, strings.TrimSpace(string(out))); err == nil {
+				updated.CommitAt = t.UTC().Format(time.RFC3339)
+			}
+		}
+		for _, a := range agents {
+			if a.CWD != "" && worktree.IsWithin(a.CWD, path) {
+				updated.AgentAt = now.UTC().Format(time.RFC3339)
+			}
+		}
+		if updated.CommitAt != slot.CommitAt || updated.AgentAt != slot.AgentAt {
+			reg.Slots[name] = updated
+			changed = true
 		}
 	}
+	return changed
+}
 
-	if skipped > 0 {
-		fmt.Printf("\n\033[36m(%d exceder processes skipped)\033[0m\n", skipped)
+// isDevServerCommand reports whether a `slot-cli run` command starts a dev
+// server (npm run dev, pnpm dev, rails server, pnpm storybook, ...)
+func isDevServerCommand(command []string) bool {
+	for _, arg := range command[1:] {
+		switch arg {
+		case "dev", "serve", "server", "start", "up", "runserver", "storybook":
+			return true
+		}
 	}
-	fmt.Println()
-	fmt.Println("\033[32mDone!\033[0m")
+	return false
 }
 
-func cmdVerify() {
-	cwd, _ := os.Getwd()
-	mainRepo, project := detectProject(cwd)
+func cmdRun(args []string) {
+	sep := -1
+	for i, arg := range args {
+		if arg == "--" {
+			sep = i
+			break
+		}
+	}
+	if sep == -1 || sep == len(args)-1 {
+		fail(exitUsage, "missing command", "Usage: slot-cli run [N|name] -- <cmd...>")
+	}
+	slotArgs, command := args[:sep], args[sep+1:]
+	slotName, slotPath := resolveSlotArg(slotArgs)
+	if isDevServerCommand(command) {
+		modifySlot(slotName, func(slot *SlotConfig) { slot.DevAt = time.Now().UTC().Format(time.RFC3339) })
+	}
 
-	if mainRepo == "" {
-		fmt.Println("Error: not in a git repository")
-		os.Exit(1)
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Dir = slotPath
+	cmd.Env = append(os.Environ(), slotEnv(slotName, slotPath)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	// Dev server output also goes to the slot's log for `slot-cli logs`
+	if isDevServerCommand(command) && os.MkdirAll(slotLogDir(slotName), 0755) == nil {
+		logPath := filepath.Join(slotLogDir(slotName), logNameForCommand(strings.Join(command, " "))+".log")
+		if logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644); err == nil {
+			defer logFile.Close()
+			cmd.Stdout = io.MultiWriter(os.Stdout, logFile)
+			cmd.Stderr = io.MultiWriter(os.Stderr, logFile)
+		}
+	}
+	if err := cmd.Run(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			os.Exit(exitErr.ExitCode())
+		}
+		fail(exitError, err.Error())
 	}
+}
 
-	// Must be run from slot (worktree)
-	if mainRepo == cwd {
-		fmt.Println("Error: must run from a slot worktree, not main")
-		os.Exit(1)
+// slotLogDir holds a slot's dev server output: tmux panes and `slot-cli run`
+// dev commands write <name>.log there for `slot-cli logs`
+func slotLogDir(slotName string) string {
+	return filepath.Join(filepath.Dir(registryPath), "logs", slotName)
+}
+
+// shellQuote quotes s as one sh word
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// logNameForCommand names a command's log after its last word: "pnpm dev"
+// is dev, "npm run storybook" is storybook
+func logNameForCommand(command string) string {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return ""
 	}
+	name := strings.Trim(regexp.MustCompile(`[^a-zA-Z0-9_-]+`).ReplaceAllString(filepath.Base(fields[len(fields)-1]), "-"), "-")
+	return strings.ToLower(name)
+}
 
-	slotPath := cwd
+// lastLines returns the last n lines of content
+func lastLines(content string, n int) []string {
+	lines := strings.Split(strings.TrimRight(content, "\n"), "\n")
+	if content == "" {
+		return nil
+	}
+	return lines[max(len(lines)-n, 0):]
+}
 
-	// Extract slot number from directory name
-	base := filepath.Base(slotPath)
-	re := regexp.MustCompile(`-(\d+)$`)
-	m := re.FindStringSubmatch(base)
-	if len(m) < 2 {
-		fmt.Println("Error: could not detect slot number from directory name")
-		os.Exit(1)
+// followLog sends the last n lines of a log file, then (follow) every line
+// appended to it, to out with the given prefix
+func followLog(path, prefix string, n int, follow bool, out chan<- string) {
+	data, _ := os.ReadFile(path)
+	for _, line := range lastLines(string(data), n) {
+		out <- prefix + line
+	}
+	offset := int64(len(data))
+	partial := ""
+	for follow {
+		time.Sleep(500 * time.Millisecond)
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		if info, err := f.Stat(); err == nil && info.Size() < offset {
+			offset = 0 // truncated or recreated
+		}
+		f.Seek(offset, io.SeekStart)
+		chunk, _ := io.ReadAll(f)
+		f.Close()
+		offset += int64(len(chunk))
+		lines := strings.Split(partial+string(chunk), "\n")
+		partial = lines[len(lines)-1]
+		for _, line := range lines[:len(lines)-1] {
+			out <- prefix + line
+		}
 	}
-	slotNum, _ := strconv.Atoi(m[1])
-	slotName := fmt.Sprintf("%s-%d", project, slotNum)
+}
 
-	fmt.Println("═══════════════════════════════════════════════════════════")
-	fmt.Printf("  SLOT VERIFICATION: %s\n", slotName)
-	fmt.Println("═══════════════════════════════════════════════════════════")
-	fmt.Println()
+// cmdLogs tails a slot's docker compose logs and dev server output in one
+// stream, each line prefixed with its service
+func cmdLogs(args []string) {
+	serviceFlag, args := extractFlag(args, "--service")
+	linesFlag, args := extractFlag(args, "-n")
+	follow := !slices.Contains(args, "--no-follow")
+	var slotArgs []string
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			slotArgs = append(slotArgs, arg)
+		}
+	}
+	slotName, slotPath := resolveSlotArg(slotArgs)
+	n := 50
+	if linesFlag != "" {
+		var err error
+		if n, err = strconv.Atoi(linesFlag); err != nil || n < 0 {
+			fail(exitUsage, "-n must be a number of lines")
+		}
+	}
 
-	errors := 0
-	warnings := 0
+	// Dev server logs by name, compose services from the compose file
+	logFiles := make(map[string]string)
+	paths, _ := filepath.Glob(filepath.Join(slotLogDir(slotName), "*.log"))
+	for _, path := range paths {
+		logFiles[strings.TrimSuffix(filepath.Base(path), ".log")] = path
+	}
+	var composeServices []string
+	hasCompose := fileExists(filepath.Join(slotPath, composeFileIn(slotPath)))
+	if hasCompose {
+		composeArgs := append(append([]string{"compose"}, composeFileArgs(slotPath)...), "config", "--services")
+		cmd := exec.Command("docker", composeArgs...)
+		cmd.Dir = slotPath
+		out, _ := cmd.Output()
+		composeServices = strings.Fields(string(out))
+	}
 
-	// 1. Check worktree linkage
-	fmt.Println("┌─ Worktree Linkage")
-	gitFile := filepath.Join(slotPath, ".git")
-	if info, err := os.Stat(gitFile); err == nil && !info.IsDir() {
-		content, _ := os.ReadFile(gitFile)
-		line := strings.TrimSpace(string(content))
-		if strings.HasPrefix(line, "gitdir:") {
-			gitdir := strings.TrimSpace(strings.TrimPrefix(line, "gitdir:"))
-			if strings.Contains(gitdir, mainRepo) {
-				fmt.Printf("│  ✓ Linked to main: %s\n", mainRepo)
-			} else {
-				fmt.Printf("│  ✗ Linked to unexpected repo: %s\n", gitdir)
-				errors++
+	var wantFiles, wantServices []string
+	if serviceFlag == "" {
+		wantFiles = slices.Sorted(maps.Keys(logFiles))
+	} else {
+		for _, service := range splitList(serviceFlag) {
+			switch {
+			case logFiles[service] != "":
+				wantFiles = append(wantFiles, service)
+			case slices.Contains(composeServices, service):
+				wantServices = append(wantServices, service)
+			default:
+				available := append(slices.Sorted(maps.Keys(logFiles)), composeServices...)
+				fail(exitNotFound, fmt.Sprintf("no '%s' logs for %s", service, slotName),
+					"Available: "+firstNonEmpty(strings.Join(available, ", "), "none (start the dev server in the slot's tmux session or with slot-cli run)"))
 			}
 		}
-	} else {
-		fmt.Println("│  ✗ Not a valid worktree (.git file missing)")
-		errors++
 	}
-	fmt.Println("└──────────────────────────────────────")
-	fmt.Println()
+	useDocker := hasCompose && (serviceFlag == "" || len(wantServices) > 0)
+	if len(wantFiles) == 0 && !useDocker {
+		fail(exitNotFound, fmt.Sprintf("no logs for %s yet", slotName),
+			"Dev servers started with slot-cli run or in the slot's tmux session log to "+slotLogDir(slotName))
+	}
+
+	width := 0
+	for _, name := range append(slices.Clone(wantFiles), composeServices...) {
+		width = max(width, len(name))
+	}
+	out := make(chan string)
+	var wg sync.WaitGroup
+	for _, name := range wantFiles {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			followLog(logFiles[name], fmt.Sprintf("%-*s | ", width, name), n, follow, out)
+		}()
+	}
+	if useDocker {
+		logArgs := append(append([]string{"compose"}, composeFileArgs(slotPath)...), "logs", "--tail", strconv.Itoa(n))
+		if follow {
+			logArgs = append(logArgs, "-f")
+		}
+		cmd := exec.Command("docker", append(logArgs, wantServices...)...)
+		cmd.Dir = slotPath
+		cmd.Stderr = cmd.Stdout
+		if stdout, err := cmd.StdoutPipe(); err == nil && cmd.Start() == nil {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				// Compose prefixes lines with "<service>-1  | " already
+				scanner := bufio.NewScanner(stdout)
+				for scanner.Scan() {
+					out <- scanner.Text()
+				}
+				cmd.Wait()
+			}()
+		} else {
+			fmt.Println("⚠ docker compose logs unavailable (is docker running?)")
+		}
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	for line := range out {
+		fmt.Println(line)
+	}
+}
 
-	// 2. Check branch relationship
-	fmt.Println("┌─ Branch & History")
-	slotBranch := getBranchName(slotPath)
-	mainBranch := getBranchName(mainRepo)
-	fmt.Printf("│  Slot branch:  %s\n", slotBranch)
-	fmt.Printf("│  Main branch:  %s\n", mainBranch)
+// defaultHealthURLs are checked for projects without health_urls
+var defaultHealthURLs = []string{"/", "/api/health"}
+
+// healthURLs expands health URL templates for a slot: a path is relative to
+// http://localhost:{PORT}, and {VAR} is the slot's VAR port from its env
+func healthURLs(templates []string, envPorts map[string]string) ([]string, error) {
+	var urls []string
+	for _, tmpl := range templates {
+		if strings.HasPrefix(tmpl, "/") {
+			tmpl = "http://localhost:{PORT}" + tmpl
+		}
+		var missing string
+		url := regexp.MustCompile(`\{([A-Z0-9_]+)\}`).ReplaceAllStringFunc(tmpl, func(m string) string {
+			port, ok := envPorts["SLOT_"+m[1:len(m)-1]]
+			if !ok {
+				missing = m
+			}
+			return port
+		})
+		if missing != "" {
+			return nil, fmt.Errorf("%s: the slot's env has no %s", tmpl, strings.Trim(missing, "{}"))
+		}
+		urls = append(urls, url)
+	}
+	return urls, nil
+}
 
-	// Check if branches share history (merge base exists)
-	mergeBase, err := exec.Command("git", "-C", slotPath, "merge-base", slotBranch, mainBranch).Output()
-	if err != nil || len(mergeBase) == 0 {
-		fmt.Println("│  ✗ No common ancestor with main")
-		errors++
-	} else {
-		fmt.Printf("│  ✓ Common ancestor: %s\n", strings.TrimSpace(string(mergeBase))[:7])
+// HealthResult is one URL checked by `slot-cli health`
+type HealthResult struct {
+	URL       string `json:"url"`
+	Status    int    `json:"status,omitempty"`
+	LatencyMS int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
 
-		// Check commits ahead/behind
-		behindOut, _ := exec.Command("git", "-C", slotPath, "rev-list", "--count", slotBranch+".."+mainBranch).Output()
-		aheadOut, _ := exec.Command("git", "-C", slotPath, "rev-list", "--count", mainBranch+".."+slotBranch).Output()
-		behind := strings.TrimSpace(string(behindOut))
-		ahead := strings.TrimSpace(string(aheadOut))
-		fmt.Printf("│  ✓ %s ahead, %s behind main\n", ahead, behind)
+// Healthy means the server answered without a server error (a 404 on
+// /api/health still shows the app is up)
+func (r HealthResult) Healthy() bool {
+	return r.Error == "" && r.Status < 500
+}
 
-		if behind != "0" {
-			fmt.Println("│  ⚠ Consider running 'slot-cli sync' to update")
-			warnings++
+// checkHealth requests each URL once, without following redirects
+func checkHealth(urls []string) []HealthResult {
+	client := &http.Client{
+		Timeout:       5 * time.Second,
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	results := make([]HealthResult, len(urls))
+	for i, url := range urls {
+		start := time.Now()
+		resp, err := client.Get(url)
+		results[i] = HealthResult{URL: url, LatencyMS: time.Since(start).Milliseconds()}
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
 		}
+		resp.Body.Close()
+		results[i].Status = resp.StatusCode
 	}
-	fmt.Println("└──────────────────────────────────────")
-	fmt.Println()
+	return results
+}
 
-	// 3. Check registry
-	fmt.Println("┌─ Registry")
-	reg := loadRegistry()
-	if slot, exists := reg.Slots[slotName]; exists {
-		fmt.Printf("│  ✓ Registry entry exists\n")
-		if slot.Project == project {
-			fmt.Printf("│  ✓ Project matches: %s\n", slot.Project)
-		} else {
-			fmt.Printf("│  ✗ Project mismatch: registry=%s, detected=%s\n", slot.Project, project)
-			errors++
-		}
-		if slot.Number == slotNum {
-			fmt.Printf("│  ✓ Slot number matches: %d\n", slot.Number)
-		} else {
-			fmt.Printf("│  ✗ Slot number mismatch: registry=%d, detected=%d\n", slot.Number, slotNum)
-			errors++
+// cmdHealth checks a slot's URLs; --wait polls until all are healthy (e.g.
+// right after new, while the dev server boots)
+func cmdHealth(args []string) {
+	timeoutFlag, args := extractFlag(args, "--timeout")
+	wait := slices.Contains(args, "--wait")
+	var slotArgs []string
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			slotArgs = append(slotArgs, arg)
 		}
-		if slot.Branch == slotBranch {
-			fmt.Printf("│  ✓ Branch matches: %s\n", slot.Branch)
-		} else {
-			fmt.Printf("│  ✗ Branch mismatch: registry=%s, actual=%s\n", slot.Branch, slotBranch)
-			errors++
+	}
+	slotName, slotPath := resolveSlotArg(slotArgs)
+	timeout := 120 * time.Second
+	if timeoutFlag != "" {
+		var err error
+		if timeout, err = time.ParseDuration(timeoutFlag); err != nil {
+			fail(exitUsage, "--timeout takes a duration like 120s or 5m")
 		}
-		fmt.Printf("│  Created: %s\n", slot.CreatedAt)
-	} else {
-		fmt.Println("│  ⚠ No registry entry (slot may have been created manually)")
-		warnings++
 	}
-	fmt.Println("└──────────────────────────────────────")
-	fmt.Println()
 
-	// 4. Check uncommitted changes
-	fmt.Println("┌─ Working Tree")
-	out, _ := exec.Command("git", "-C", slotPath, "status", "--porcelain").Output()
-	if len(out) == 0 {
-		fmt.Println("│  ✓ Clean working tree")
-	} else {
-		lines := strings.Split(strings.TrimSpace(string(out)), "\n")
-		fmt.Printf("│  ⚠ %d uncommitted changes\n", len(lines))
-		warnings++
+	envPorts := make(map[string]string)
+	for _, name := range []string{".env", ".env.local"} {
+		content, _ := os.ReadFile(filepath.Join(slotPath, name))
+		maps.Copy(envPorts, ports.EnvVars(string(content)))
+	}
+	reg := loadRegistry()
+	templates := reg.Projects[reg.Slots[slotName].Project].HealthURLs
+	if len(templates) == 0 {
+		templates = defaultHealthURLs
+	}
+	urls, err := healthURLs(templates, envPorts)
+	if err != nil {
+		fail(exitNotFound, err.Error(), "Set health_urls on the project (slot-cli init --health=...)")
 	}
-	fmt.Println("└──────────────────────────────────────")
-	fmt.Println()
 
-	// Summary
-	fmt.Println("═══════════════════════════════════════════════════════════")
-	if errors == 0 && warnings == 0 {
-		fmt.Println("  ✓ VERIFIED: Slot matches parent worktree 1:1")
-	} else if errors == 0 {
-		fmt.Printf("  ✓ VERIFIED with %d warning(s)\n", warnings)
+	deadline := time.Now().Add(timeout)
+	results := checkHealth(urls)
+	for wait && !allHealthy(results) && time.Now().Before(deadline) {
+		time.Sleep(2 * time.Second)
+		results = checkHealth(urls)
+	}
+
+	if jsonOutput {
+		data, _ := json.MarshalIndent(results, "", "  ")
+		fmt.Println(string(data))
 	} else {
-		fmt.Printf("  ✗ FAILED: %d error(s), %d warning(s)\n", errors, warnings)
+		fmt.Printf("HEALTH: %s\n", slotName)
+		for _, r := range results {
+			symbol, status := "✓", strconv.Itoa(r.Status)
+			if !r.Healthy() {
+				symbol = "✗"
+			}
+			if r.Error != "" {
+				status = "---"
+			}
+			fmt.Printf("  %s %s %5dms  %s\n", symbol, status, r.LatencyMS, r.URL)
+			if r.Error != "" {
+				fmt.Printf("        %s\n", r.Error)
+			}
+		}
 	}
-	fmt.Println("═══════════════════════════════════════════════════════════")
+	if !allHealthy(results) {
+		msg := fmt.Sprintf("%s is not healthy", slotName)
+		if wait {
+			msg = fmt.Sprintf("%s not healthy after %s", slotName, timeout)
+		}
+		fail(exitError, msg, "Is the dev server running? slot-cli logs "+slotName)
+	}
+}
 
-	if errors > 0 {
-		os.Exit(1)
+func allHealthy(results []HealthResult) bool {
+	for _, r := range results {
+		if !r.Healthy() {
+			return false
+		}
 	}
+	return true
 }
 
-func cmdFixPorts() {
-	cwd, _ := os.Getwd()
-	mainRepo, project := detectProject(cwd)
+// ExecResult is the outcome of running a command in one slot
+type ExecResult struct {
+	Slot     string
+	ExitCode int
+	Output   string
+}
 
-	if mainRepo == "" {
-		fmt.Println("Error: not in a git repository")
-		os.Exit(1)
+// splitExecArgs splits exec's arguments at the first "--" into its own flags
+// and the command to run (nil when there is none)
+func splitExecArgs(args []string) (flags, command []string) {
+	sep := slices.Index(args, "--")
+	if sep == -1 {
+		return args, nil
 	}
+	return args[:sep], args[sep+1:]
+}
 
-	// Must be run from slot (worktree)
-	if mainRepo == cwd {
-		fmt.Println("Error: must run from a slot worktree, not main")
-		os.Exit(1)
+// execSlots returns the slots exec runs in, sorted: every slot with all,
+// otherwise the slots of project
+func execSlots(reg *Registry, project string, all bool) []string {
+	var slotNames []string
+	for name, slot := range reg.Slots {
+		if all || slot.Project == project {
+			slotNames = append(slotNames, name)
+		}
 	}
+	sort.Strings(slotNames)
+	return slotNames
+}
 
-	slotPath := cwd
+// execInSlot runs command in a slot with its SLOT_* environment. ExitCode is
+// -1 when the command could not be started.
+func execInSlot(slotName, slotPath string, command []string) ExecResult {
+	result := ExecResult{Slot: slotName}
+	if _, err := os.Stat(slotPath); err != nil {
+		result.ExitCode = -1
+		result.Output = "slot directory not found"
+		return result
+	}
+
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Dir = slotPath
+	cmd.Env = append(os.Environ(), slotEnv(slotName, slotPath)...)
+	out, err := cmd.CombinedOutput()
+	result.Output = strings.TrimRight(string(out), "\n")
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		result.ExitCode = exitErr.ExitCode()
+	} else if err != nil {
+		result.ExitCode = -1
+		result.Output = err.Error()
+	}
+	return result
+}
 
-	// Extract slot number from directory name
-	base := filepath.Base(slotPath)
-	re := regexp.MustCompile(`-(\d+)$`)
-	m := re.FindStringSubmatch(base)
-	if len(m) < 2 {
-		fmt.Println("Error: could not detect slot number from directory name")
-		os.Exit(1)
+func cmdExec(args []string) {
+	flags, command := splitExecArgs(args)
+	if len(command) == 0 {
+		fail(exitUsage, "missing command", "Usage: slot-cli exec [--project <name>|--group <id>|--label <l>|--all] [--parallel] -- <cmd...>")
 	}
-	slotNum, _ := strconv.Atoi(m[1])
-	slotName := fmt.Sprintf("%s-%d", project, slotNum)
 
-	fmt.Println("═══════════════════════════════════════════════════════════")
-	fmt.Printf("  FIX PORTS: %s (slot %d)\n", slotName, slotNum)
-	fmt.Println("═══════════════════════════════════════════════════════════")
-	fmt.Println()
+	projectFlag, flags := extractFlag(flags, "--project")
+	groupFlag, flags := extractFlag(flags, "--group")
+	labelFlag, flags := extractFlag(flags, "--label")
+	all, parallel := false, false
+	for _, arg := range flags {
+		switch arg {
+		case "--all":
+			all = true
+		case "--parallel", "-p":
+			parallel = true
+		}
+	}
 
-	// Scan main's ports
-	fmt.Println("Scanning main project ports...")
-	mainPorts := scanPorts(mainRepo)
+	reg := loadRegistry()
+	if groupFlag != "" || labelFlag != "" {
+		reg = scopeToLabel(scopeToGroup(reg, groupFlag), labelFlag)
+		all = projectFlag == ""
+	}
+	project := projectFlag
+	if project == "" && !all {
+		cwd, _ := os.Getwd()
+		if _, project = worktree.DetectProject(cwd); project == "" {
+			fail(exitUsage, "not in a git repository (use --project or --all)")
+		}
+	}
+	if project != "" {
+		if _, ok := reg.Projects[project]; !ok {
+			fail(exitNotFound, fmt.Sprintf("project '%s' is not registered", project))
+		}
+	}
 
-	if len(mainPorts) == 0 {
-		fmt.Println("No ports found in main project")
+	slotNames := execSlots(reg, project, all)
+	if len(slotNames) == 0 {
+		fmt.Println("No slots found.")
 		return
 	}
 
-	// Calculate expected slot ports
-	portMap := make(map[int]int)
-	for mainPort, varName := range mainPorts {
-		slotPort := mainPort + slotNum
-		portMap[mainPort] = slotPort
-		fmt.Printf("  %s: %d → %d\n", varName, mainPort, slotPort)
+	results := make([]ExecResult, len(slotNames))
+	run := func(i int) {
+		slotName := slotNames[i]
+		slotPath := filepath.Join(filepath.Dir(reg.Projects[reg.Slots[slotName].Project].Path), slotName)
+		results[i] = execInSlot(slotName, slotPath, command)
 	}
 
-	fmt.Println()
+	if parallel {
+		var wg sync.WaitGroup
+		for i := range slotNames {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				run(i)
+			}(i)
+		}
+		wg.Wait()
+	} else {
+		for i := range slotNames {
+			run(i)
+		}
+	}
 
-	// Scan current slot ports
-	fmt.Println("Checking slot ports...")
+	failed := 0
+	for _, r := range results {
+		mark := "✓"
+		if r.ExitCode != 0 {
+			mark = "✗"
+			failed++
+		}
+		fmt.Printf("─── %s %s (exit %d) ───\n", mark, r.Slot, r.ExitCode)
+		if r.Output != "" {
+			fmt.Println(r.Output)
+		}
+		fmt.Println()
+	}
+
+	fmt.Println("════════════════════════════════════════")
+	fmt.Printf("  %s across %d slot(s): %d ok, %d failed\n", strings.Join(command, " "), len(results), len(results)-failed, failed)
+	for _, r := range results {
+		if r.ExitCode != 0 {
+			fmt.Printf("  ✗ %s (exit %d)\n", r.Slot, r.ExitCode)
+		}
+	}
+	if failed > 0 {
+		os.Exit(exitError)
+	}
+}
+
+// SlotInfo is everything known about a slot: its registry entry merged with
+// live facts (info --json)
+type SlotInfo struct {
+	Name       string          `json:"name"`
+	Path       string          `json:"path"`
+	Exists     bool            `json:"exists"`
+	Domain     string          `json:"domain"`
+	Registry   *SlotConfig     `json:"registry"` // nil when not registered
+	Branch     string          `json:"branch,omitempty"`
+	MainBranch string          `json:"main_branch,omitempty"`
+	Ahead      int             `json:"ahead"`
+	Behind     int             `json:"behind"`
+	Dirty      int             `json:"uncommitted_changes"`
+	Ports      []SlotPort      `json:"ports"`
+	Docker     bool            `json:"docker_available"`
+	Containers []SlotContainer `json:"containers"`
+	Agents     []SlotAgent     `json:"agents"`
+	Sessions   []SlotSession   `json:"sessions"`
+	Locked     bool            `json:"locked"` // an unexpired lock
+	Commits    []string        `json:"recent_commits"`
+	History    []AuditEntry    `json:"history"`    // the slot's latest audit log entries
+	DiskBytes  int64           `json:"disk_bytes"` // -1 when du is unavailable
+}
+
+// SlotPort is a port configured in the slot
+type SlotPort struct {
+	Var        string `json:"var"`
+	Port       int    `json:"port"`
+	Listening  bool   `json:"listening"`
+	SameAsMain bool   `json:"same_as_main"`
+}
+
+// SlotContainer is a docker container belonging to the slot
+type SlotContainer struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
+// SlotAgent is an agent process running in the slot
+type SlotAgent struct {
+	Agent   string `json:"agent"`
+	PID     int    `json:"pid"`
+	Runtime string `json:"runtime"`
+}
+
+// SlotSession is a Claude session transcript of the slot
+type SlotSession struct {
+	ID       string    `json:"id"`
+	Modified time.Time `json:"modified"`
+}
+
+// collectSlotInfo gathers registry data and live facts about a slot
+func collectSlotInfo(reg *Registry, mainRepo, slotName string) SlotInfo {
+	slotPath := filepath.Join(filepath.Dir(mainRepo), slotName)
+	info := SlotInfo{
+		Name:       slotName,
+		Path:       slotPath,
+		Domain:     slotDomain(slotName),
+		Ports:      []SlotPort{},
+		Containers: []SlotContainer{},
+		Agents:     []SlotAgent{},
+		Sessions:   []SlotSession{},
+		Commits:    []string{},
+		History:    []AuditEntry{},
+		DiskBytes:  -1,
+	}
+	if slot, ok := reg.Slots[slotName]; ok {
+		info.Registry = &slot
+		info.Locked = slot.LockActive(time.Now())
+	}
+	if _, err := os.Stat(slotPath); err == nil {
+		info.Exists = true
+	}
+
+	// Branch state
+	info.Branch = worktree.BranchName(slotPath)
+	if info.Branch != "" {
+		info.MainBranch = worktree.BranchName(mainRepo)
+		behindOut, _ := exec.Command("git", "-C", slotPath, "rev-list", "--count", info.Branch+".."+info.MainBranch).Output()
+		aheadOut, _ := exec.Command("git", "-C", slotPath, "rev-list", "--count", info.MainBranch+".."+info.Branch).Output()
+		info.Behind, _ = strconv.Atoi(strings.TrimSpace(string(behindOut)))
+		info.Ahead, _ = strconv.Atoi(strings.TrimSpace(string(aheadOut)))
+
+		out, _ := exec.Command("git", "-C", slotPath, "status", "--porcelain").Output()
+		if len(out) > 0 {
+			info.Dirty = len(strings.Split(strings.TrimSpace(string(out)), "\n"))
+		}
+	}
+
+	// Ports
+	mainPorts := scanPorts(mainRepo)
 	slotPorts := scanPorts(slotPath)
+	for port, varName := range slotPorts {
+		_, isMain := mainPorts[port]
+		info.Ports = append(info.Ports, SlotPort{Var: varName, Port: port, Listening: !ports.Available(port), SameAsMain: isMain})
+	}
+	sort.Slice(info.Ports, func(i, j int) bool { return info.Ports[i].Port < info.Ports[j].Port })
+
+	// Containers
+	dockerName := ports.DockerName(slotName)
+	containerOut, err := exec.Command("docker", "ps", "-a", "--filter", "name="+dockerName, "--format", "{{.Names}}|{{.Status}}").Output()
+	info.Docker = err == nil
+	for _, line := range strings.Split(strings.TrimSpace(string(containerOut)), "\n") {
+		parts := strings.SplitN(line, "|", 2)
+		if len(parts) < 2 || !strings.HasPrefix(parts[0], dockerName) {
+			continue
+		}
+		info.Containers = append(info.Containers, SlotContainer{Name: parts[0], Status: parts[1]})
+	}
 
-	// Find mismatches
-	fixes := 0
-	for mainPort, expectedSlotPort := range portMap {
-		// Check if slot has this port at wrong value
-		for currentPort := range slotPorts {
-			if currentPort == mainPort {
-				fmt.Printf("  ✗ Found main port %d (should be %d)\n", mainPort, expectedSlotPort)
-				fixes++
+	// Agent sessions
+	for _, p := range getAgentProcesses() {
+		if worktree.IsWithin(p.CWD, slotPath) {
+			info.Agents = append(info.Agents, SlotAgent{Agent: p.Agent, PID: p.PID, Runtime: p.Runtime})
+		}
+	}
+	sessionFiles, _ := filepath.Glob(filepath.Join(claudeSessionDir(slotPath), "*.jsonl"))
+	for _, f := range sessionFiles {
+		if fi, err := os.Stat(f); err == nil {
+			info.Sessions = append(info.Sessions, SlotSession{ID: strings.TrimSuffix(filepath.Base(f), ".jsonl"), Modified: fi.ModTime()})
+		}
+	}
+	sort.Slice(info.Sessions, func(i, j int) bool { return info.Sessions[i].Modified.After(info.Sessions[j].Modified) })
+
+	// Recent commits and audit log events
+	logOut, _ := exec.Command("git", "-C", slotPath, "log", "-5", "--format=%h %cr  %s").Output()
+	if s := strings.TrimSpace(string(logOut)); s != "" {
+		info.Commits = strings.Split(s, "\n")
+	}
+	info.History = append(info.History, readAuditLog(func(e AuditEntry) bool { return e.Slot == slotName }, 5)...)
+
+	// Disk usage
+	if duOut, err := exec.Command("du", "-sk", slotPath).Output(); err == nil {
+		if fields := strings.Fields(string(duOut)); len(fields) > 0 {
+			if kb, err := strconv.ParseInt(fields[0], 10, 64); err == nil {
+				info.DiskBytes = kb * 1024
 			}
 		}
 	}
 
-	if fixes == 0 {
-		// Check if ports are correct
-		allCorrect := true
-		for _, expectedSlotPort := range portMap {
-			if _, exists := slotPorts[expectedSlotPort]; !exists {
-				allCorrect = false
-				break
+	return info
+}
+
+// humanBytes formats a byte count like du -h (e.g. 1.2G, 340M, 12K)
+func humanBytes(n int64) string {
+	units := []string{"B", "K", "M", "G", "T"}
+	f := float64(n)
+	i := 0
+	for f >= 1024 && i < len(units)-1 {
+		f /= 1024
+		i++
+	}
+	if i == 0 || f >= 10 {
+		return fmt.Sprintf("%.0f%s", f, units[i])
+	}
+	return fmt.Sprintf("%.1f%s", f, units[i])
+}
+
+// SlotDiskUsage is a slot's footprint as reported by `slot-cli du`
+type SlotDiskUsage struct {
+	Slot        string `json:"slot"`
+	Project     string `json:"project"`
+	Tree        int64  `json:"tree_bytes"` // working tree without node_modules
+	NodeModules int64  `json:"node_modules_bytes"`
+	Docker      int64  `json:"docker_bytes"` // the slot's compose volumes
+}
+
+// Total is everything deleting the slot (and its volumes) would reclaim
+func (u SlotDiskUsage) Total() int64 {
+	return u.Tree + u.NodeModules + u.Docker
+}
+
+// Reclaimed tallies the disk space a clean frees, per category
+type Reclaimed struct {
+	Worktrees int64 `json:"worktrees_bytes"` // working trees without node_modules
+	Volumes   int64 `json:"volumes_bytes"`
+	Artifacts int64 `json:"artifacts_bytes"` // node_modules
+}
+
+// Add counts a removed slot's footprint
+func (r *Reclaimed) Add(u SlotDiskUsage) {
+	r.Worktrees += u.Tree
+	r.Volumes += u.Docker
+	r.Artifacts += u.NodeModules
+}
+
+// Total is the space freed across categories
+func (r Reclaimed) Total() int64 {
+	return r.Worktrees + r.Volumes + r.Artifacts
+}
+
+// Lines renders the per-category summary, skipping empty categories
+func (r Reclaimed) Lines() []string {
+	var lines []string
+	for _, c := range []struct {
+		Label string
+		Bytes int64
+	}{{"worktrees", r.Worktrees}, {"volumes", r.Volumes}, {"artifacts", r.Artifacts}} {
+		if c.Bytes > 0 {
+			lines = append(lines, fmt.Sprintf("  %-12s %8s", c.Label, humanBytes(c.Bytes)))
+		}
+	}
+	return append(lines, fmt.Sprintf("  %-12s %8s", "total", humanBytes(r.Total())))
+}
+
+// parseDuOutput maps each path of `du -sk` output to its size in bytes
+func parseDuOutput(out string) map[string]int64 {
+	sizes := make(map[string]int64)
+	for _, line := range strings.Split(out, "\n") {
+		kb, path, ok := strings.Cut(line, "\t")
+		if n, err := strconv.ParseInt(strings.TrimSpace(kb), 10, 64); ok && err == nil {
+			sizes[path] = n * 1024
+		}
+	}
+	return sizes
+}
+
+// parseDockerSize parses docker's decimal sizes like "48.3MB", "1.2GB" or "0B"
+func parseDockerSize(s string) int64 {
+	for _, unit := range []struct {
+		Suffix string
+		Mult   float64
+	}{{"TB", 1e12}, {"GB", 1e9}, {"MB", 1e6}, {"kB", 1e3}, {"KB", 1e3}, {"B", 1}} {
+		if num, ok := strings.CutSuffix(s, unit.Suffix); ok {
+			f, err := strconv.ParseFloat(num, 64)
+			if err != nil {
+				return 0
 			}
+			return int64(f * unit.Mult)
 		}
-		if allCorrect {
-			fmt.Println("  ✓ All ports are correct")
+	}
+	return 0
+}
+
+// dockerVolumeSizes returns volume sizes per compose project (nil without docker)
+func dockerVolumeSizes() map[string]int64 {
+	out, err := exec.Command("docker", "system", "df", "-v", "--format", "{{json .}}").Output()
+	if err != nil {
+		return nil
+	}
+	return composeVolumeSizes(out)
+}
+
+// composeVolumeSizes sums volume sizes per compose project from
+// `docker system df -v --format '{{json .}}'`
+func composeVolumeSizes(dfJSON []byte) map[string]int64 {
+	var df struct {
+		Volumes []struct {
+			Labels string
+			Size   string
+		}
+	}
+	sizes := make(map[string]int64)
+	if json.Unmarshal(dfJSON, &df) != nil {
+		return sizes
+	}
+	for _, v := range df.Volumes {
+		for _, label := range strings.Split(v.Labels, ",") {
+			if project, ok := strings.CutPrefix(label, "com.docker.compose.project="); ok {
+				sizes[project] += parseDockerSize(v.Size)
+			}
+		}
+	}
+	return sizes
+}
+
+// nodeModulesDirs finds the node_modules directories of a tree (workspaces
+// have several), without descending into them
+func nodeModulesDirs(root string) []string {
+	return dirsNamed(root, "node_modules")
+}
+
+// dirsNamed finds the directories of a tree with one of names, without
+// descending into them (or into .git)
+func dirsNamed(root string, names ...string) []string {
+	var dirs []string
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if slices.Contains(names, d.Name()) {
+			dirs = append(dirs, path)
+			return filepath.SkipDir
+		}
+		if d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return dirs
+}
+
+// slotDiskUsage measures a slot with du; volumes are sizes per compose project
+func slotDiskUsage(slotName, project, slotPath string, volumes map[string]int64) SlotDiskUsage {
+	usage := SlotDiskUsage{Slot: slotName, Project: project, Docker: volumes[composeProjectName(slotPath)]}
+	out, _ := exec.Command("du", "-sk", slotPath).Output()
+	total := parseDuOutput(string(out))[slotPath]
+	if dirs := nodeModulesDirs(slotPath); len(dirs) > 0 {
+		out, _ := exec.Command("du", append([]string{"-sk"}, dirs...)...).Output()
+		for _, n := range parseDuOutput(string(out)) {
+			usage.NodeModules += n
+		}
+	}
+	usage.Tree = max(total-usage.NodeModules, 0)
+	return usage
+}
+
+// artifactDirNames are the regenerable directories clean artifacts removes
+var artifactDirNames = []string{"node_modules", ".next", ".turbo", "dist", "coverage"}
+
+// SlotArtifacts are a slot's build artifact directories and their sizes
+type SlotArtifacts struct {
+	Slot  string           `json:"slot"`
+	Dirs  map[string]int64 `json:"dirs"` // path relative to the slot -> bytes
+	Total int64            `json:"total_bytes"`
+}
+
+// slotArtifacts measures a slot's artifact directories, leaving out any git
+// tracks (a committed dist is source, not cache)
+func slotArtifacts(slotName, slotPath string) SlotArtifacts {
+	a := SlotArtifacts{Slot: slotName, Dirs: make(map[string]int64)}
+	var dirs []string
+	for _, dir := range dirsNamed(slotPath, artifactDirNames...) {
+		rel, _ := filepath.Rel(slotPath, dir)
+		if filepath.Base(dir) == "node_modules" || !worktree.IsTracked(slotPath, rel) {
+			dirs = append(dirs, dir)
+		}
+	}
+	if len(dirs) == 0 {
+		return a
+	}
+	out, _ := exec.Command("du", append([]string{"-sk"}, dirs...)...).Output()
+	for path, size := range parseDuOutput(string(out)) {
+		rel, _ := filepath.Rel(slotPath, path)
+		a.Dirs[rel] = size
+		a.Total += size
+	}
+	return a
+}
+
+// cmdCleanArtifacts lists node_modules and build caches in registered slots
+// (--idle 14d for idle slots only, [project] to narrow) and removes them on --do
+func cmdCleanArtifacts(args []string) {
+	idleFlag, args := extractFlag(args, "--idle")
+	var idleLimit time.Duration
+	if idleFlag != "" {
+		var err error
+		if idleLimit, err = parseSince(idleFlag); err != nil || idleLimit == 0 {
+			fail(exitUsage, "--idle must be a duration like 7d or 2w")
+		}
+	}
+	doClean := slices.Contains(args, "--do")
+	var projects []string
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			projects = append(projects, arg)
+		}
+	}
+	if _, err := exec.LookPath("du"); err != nil {
+		fail(exitError, "du not found", "slot-cli clean artifacts needs the du command (coreutils)")
+	}
+
+	reg := loadRegistry()
+	now := time.Now()
+	if noteSlotActivity(reg, getAgentProcesses(), now) {
+		saveRegistry(reg)
+	}
+	var names []string
+	for name, slot := range reg.Slots {
+		switch {
+		case len(projects) > 0 && !slices.Contains(projects, slot.Project):
+		case slot.LockActive(now) || !fileExists(reg.SlotPath(name)):
+		case idleLimit > 0 && idleFor(slot, now) < idleLimit:
+		default:
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var found []SlotArtifacts
+	var total int64
+	for _, name := range names {
+		if a := slotArtifacts(name, reg.SlotPath(name)); a.Total > 0 {
+			found = append(found, a)
+			total += a.Total
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool { return found[i].Total > found[j].Total })
+
+	if jsonOutput {
+		data, _ := json.MarshalIndent(found, "", "  ")
+		fmt.Println(string(data))
+		if !doClean {
+			return
+		}
+	} else {
+		scope := "registered slots"
+		if idleLimit > 0 {
+			scope = fmt.Sprintf("slots idle %s+", idleFlag)
+		}
+		fmt.Printf("Build artifacts in %s (locked slots skipped):\n\n", scope)
+		for _, a := range found {
+			fmt.Printf("  %-36s %8s\n", a.Slot, humanBytes(a.Total))
+			for _, rel := range slices.Sorted(maps.Keys(a.Dirs)) {
+				fmt.Printf("    %-34s %8s\n", rel, humanBytes(a.Dirs[rel]))
+			}
+		}
+		if len(found) == 0 {
+			fmt.Println("  (none)")
 			return
 		}
+		fmt.Printf("\n  %-36s %8s\n", "total", humanBytes(total))
+	}
+
+	if !doClean {
+		fmt.Println("\nThis is a dry run. Run with --do to remove them (slot-cli provision --all reinstalls deps).")
+		return
+	}
+	if !confirm(fmt.Sprintf("\nRemove %s from %d slot(s)? Stop their dev servers first", humanBytes(total), len(found))) {
+		fail(exitAborted, "aborted")
+	}
+	for _, a := range found {
+		for rel := range a.Dirs {
+			if err := os.RemoveAll(filepath.Join(reg.SlotPath(a.Slot), rel)); err != nil {
+				fmt.Printf("  ✗ %s/%s: %v\n", a.Slot, rel, err)
+			}
+		}
+		recordAudit(AuditEntry{Action: "clean", Slot: a.Slot, Detail: "artifacts " + strings.Join(slices.Sorted(maps.Keys(a.Dirs)), ", ")})
+		fmt.Printf("  ✓ %s: freed %s\n", a.Slot, humanBytes(a.Total))
+	}
+	fmt.Println()
+	fmt.Println(green.Sprintf("Done! Reclaimed %s", humanBytes(total)))
+}
+
+// WorktreeEntry is one worktree of `git worktree list --porcelain`
+type WorktreeEntry struct {
+	Path   string
+	Branch string // "(detached)" for a detached HEAD
+}
+
+// parseWorktreeList parses `git worktree list --porcelain`; the main
+// worktree comes first
+func parseWorktreeList(out string) []WorktreeEntry {
+	var entries []WorktreeEntry
+	for _, block := range strings.Split(strings.TrimSpace(out), "\n\n") {
+		var entry WorktreeEntry
+		for _, line := range strings.Split(block, "\n") {
+			switch {
+			case strings.HasPrefix(line, "worktree "):
+				entry.Path = strings.TrimPrefix(line, "worktree ")
+			case strings.HasPrefix(line, "branch "):
+				entry.Branch = strings.TrimPrefix(strings.TrimPrefix(line, "branch "), "refs/heads/")
+			case line == "detached":
+				entry.Branch = "(detached)"
+			}
+		}
+		if entry.Path != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// adoptIdentity infers a worktree directory's slot number or name: <project>-N
+// or <project>-<name> follow the slot pattern; with anyName, other directories
+// become named slots under their own name
+func adoptIdentity(project, dirName string, anyName bool) (number int, name string, ok bool) {
+	if suffix, found := strings.CutPrefix(dirName, project+"-"); found && suffix != "" {
+		if n, err := strconv.Atoi(suffix); err == nil && n > 0 {
+			return n, "", true
+		}
+		return 0, suffix, true
+	}
+	if anyName && dirName != project {
+		return 0, dirName, true
+	}
+	return 0, "", false
+}
+
+// cmdAdopt registers the project's existing worktrees (made before slot-cli
+// or by plain git) as slots
+func cmdAdopt(args []string) {
+	anyName := slices.Contains(args, "--any")
+	dryRun := slices.Contains(args, "--dry-run")
+	dir, _ := os.Getwd()
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			dir, _ = filepath.Abs(arg)
+		}
+	}
+	mainRepo, project := worktree.DetectProject(dir)
+	if mainRepo == "" {
+		fail(exitUsage, fmt.Sprintf("%s is not in a git repository", dir))
+	}
+	reg := loadRegistry()
+	if _, ok := reg.Projects[project]; !ok {
+		fail(exitNotFound, fmt.Sprintf("project '%s' is not registered", project), "Register it first: cd "+mainRepo+" && slot-cli init")
+	}
+
+	out, err := exec.Command("git", "-C", mainRepo, "worktree", "list", "--porcelain").Output()
+	if err != nil {
+		fail(exitError, "git worktree list failed: "+err.Error())
+	}
+
+	type adoption struct {
+		slotName string
+		number   int
+		name     string
+		branch   string
+	}
+	var adopt []adoption
+	for _, wt := range parseWorktreeList(string(out))[1:] {
+		dirName := filepath.Base(wt.Path)
+		if _, ok := reg.Slots[dirName]; ok {
+			continue
+		}
+		number, name, ok := adoptIdentity(project, dirName, anyName)
+		if !ok {
+			fmt.Printf("  - %s: not named %s-<N|name> (--any to adopt it anyway)\n", wt.Path, project)
+			continue
+		}
+		// Slots live next to the main repo, that's where commands look for them
+		if filepath.Dir(wt.Path) != filepath.Dir(mainRepo) {
+			fmt.Printf("  - %s: not next to %s (git worktree move it there first)\n", wt.Path, mainRepo)
+			continue
+		}
+		adopt = append(adopt, adoption{dirName, number, name, wt.Branch})
+	}
+
+	if len(adopt) == 0 {
+		fmt.Printf("✓ No unregistered slot worktrees in %s\n", project)
+		return
+	}
+	fmt.Printf("Worktrees to adopt into %s:\n", project)
+	for _, a := range adopt {
+		fmt.Printf("  + %-28s %s\n", a.slotName, a.branch)
+	}
+	if dryRun || !confirm(fmt.Sprintf("Register %d worktree(s) as slots?", len(adopt))) {
+		return
+	}
+
+	reg = loadRegistry()
+	for _, a := range adopt {
+		// The worktree's age stands in for the slot's creation time, so idle
+		// detection doesn't treat old worktrees as brand new
+		createdAt := time.Now()
+		if info, err := os.Stat(filepath.Join(filepath.Dir(mainRepo), a.slotName, ".git")); err == nil {
+			createdAt = info.ModTime()
+		}
+		reg.Slots[a.slotName] = SlotConfig{
+			Project:   project,
+			Number:    a.number,
+			Name:      a.name,
+			Branch:    a.branch,
+			CreatedAt: createdAt.Format(time.RFC3339),
+		}
+	}
+	saveRegistry(reg)
+	fmt.Printf("✓ Adopted %d slot(s); their ports and env files are as they were (slot-cli fix-ports to align them)\n", len(adopt))
+}
+
+// cmdDU reports disk usage per slot (largest first) and per project
+func cmdDU(args []string) {
+	if _, err := exec.LookPath("du"); err != nil {
+		fail(exitError, "du not found", "slot-cli du needs the du command (coreutils)")
+	}
+	reg := loadRegistry()
+	volumes := dockerVolumeSizes()
+
+	var names []string
+	for name, slot := range reg.Slots {
+		if len(args) > 0 && !slices.Contains(args, slot.Project) {
+			continue
+		}
+		if fileExists(reg.SlotPath(name)) {
+			names = append(names, name)
+		}
+	}
+	usages := make([]SlotDiskUsage, len(names))
+	sem := make(chan struct{}, 4)
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			usages[i] = slotDiskUsage(name, reg.Slots[name].Project, reg.SlotPath(name), volumes)
+			<-sem
+		}()
+	}
+	wg.Wait()
+	sort.Slice(usages, func(i, j int) bool {
+		if usages[i].Project != usages[j].Project {
+			return usages[i].Project < usages[j].Project
+		}
+		return usages[i].Total() > usages[j].Total()
+	})
+
+	if jsonOutput {
+		data, _ := json.MarshalIndent(usages, "", "  ")
+		fmt.Println(string(data))
+		return
+	}
+	if len(usages) == 0 {
+		fmt.Println("No slots found.")
+		return
+	}
+
+	row := "%-28s %10s %13s %10s %10s\n"
+	fmt.Printf(row, "SLOT", "TREE", "NODE_MODULES", "DOCKER", "TOTAL")
+	var grand int64
+	for i, u := range usages {
+		if i == 0 || usages[i-1].Project != u.Project {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("%s\n", u.Project)
+		}
+		fmt.Printf(row, "  "+truncate(u.Slot, 26), humanBytes(u.Tree), humanBytes(u.NodeModules), humanBytes(u.Docker), humanBytes(u.Total()))
+		if i == len(usages)-1 || usages[i+1].Project != u.Project {
+			var sum SlotDiskUsage
+			for _, p := range usages {
+				if p.Project == u.Project {
+					sum.Tree, sum.NodeModules, sum.Docker = sum.Tree+p.Tree, sum.NodeModules+p.NodeModules, sum.Docker+p.Docker
+				}
+			}
+			fmt.Printf(row, "  total", humanBytes(sum.Tree), humanBytes(sum.NodeModules), humanBytes(sum.Docker), humanBytes(sum.Total()))
+			grand += sum.Total()
+		}
+	}
+	fmt.Printf("\n%d slot(s) use %s", len(usages), humanBytes(grand))
+	if volumes == nil {
+		fmt.Print(" (docker unavailable, volumes not counted)")
+	}
+	fmt.Println()
+}
+
+func cmdInfo(args []string) {
+	slotName := resolveSlotName(args)
+
+	reg := loadRegistry()
+	slot, inRegistry := reg.Slots[slotName]
+	if slot.Host != "" {
+		remoteArgs := []string{"info", slotName}
+		if jsonOutput {
+			remoteArgs = append(remoteArgs, "--json")
+		}
+		if err := remote.Run(slot.Host, slot.RemotePath, remoteArgs...); err != nil {
+			fail(exitError, fmt.Sprintf("slot-cli info on %s failed: %v", slot.Host, err))
+		}
+		return
+	}
+
+	cwd, _ := os.Getwd()
+	mainRepo, _ := worktree.DetectProject(cwd)
+	if inRegistry {
+		if projectCfg, ok := reg.Projects[slot.Project]; ok {
+			mainRepo = projectCfg.Path
+		}
+	}
+	if mainRepo == "" {
+		fail(exitUsage, "not in a git repository")
+	}
+	slotPath := filepath.Join(filepath.Dir(mainRepo), slotName)
+
+	if _, err := os.Stat(slotPath); os.IsNotExist(err) && !inRegistry {
+		fail(exitNotFound, fmt.Sprintf("slot '%s' not found", slotName))
+	}
+
+	info := collectSlotInfo(reg, mainRepo, slotName)
+	if jsonOutput {
+		data, _ := json.MarshalIndent(info, "", "  ")
+		fmt.Println(string(data))
+		return
+	}
+
+	fmt.Println("═══════════════════════════════════════════════════════════")
+	fmt.Printf("  SLOT INFO: %s\n", slotName)
+	fmt.Println("═══════════════════════════════════════════════════════════")
+	fmt.Println()
+
+	// 1. Registry
+	fmt.Println("┌─ Registry")
+	if inRegistry {
+		fmt.Printf("│  Project:  %s\n", slot.Project)
+		if slot.Name != "" {
+			fmt.Printf("│  Name:     %s\n", slot.Name)
+		} else {
+			fmt.Printf("│  Number:   %d\n", slot.Number)
+		}
+		fmt.Printf("│  Branch:   %s\n", slot.Branch)
+		if slot.Description != "" {
+			fmt.Printf("│  About:    %s\n", slot.Description)
+		}
+		if slot.Ticket != "" {
+			fmt.Printf("│  Ticket:   %s\n", slot.Ticket)
+		}
+		if slot.Assignee != "" {
+			fmt.Printf("│  Assignee: %s\n", slot.Assignee)
+		}
+		if len(slot.Labels) > 0 {
+			fmt.Printf("│  Labels:   %s\n", strings.Join(slot.Labels, ", "))
+		}
+		fmt.Printf("│  Created:  %s\n", slot.CreatedAt)
+		if slot.ExpiresAt != "" {
+			expiry := slot.ExpiresAt
+			if slot.Expired(time.Now()) {
+				expiry += " (expired)"
+			}
+			fmt.Printf("│  Expires:  %s\n", expiry)
+		}
+		if len(slot.Profiles) > 0 || len(slot.Services) > 0 {
+			fmt.Printf("│  Compose:  %s\n", ComposeSelection{Profiles: slot.Profiles, Services: slot.Services})
+		}
+		if len(slot.Pending) > 0 {
+			fmt.Printf("│  Pending:  %s (slot-cli provision)\n", strings.Join(slot.Pending, ", "))
+		}
+		if slot.IssueURL != "" {
+			fmt.Printf("│  Issue:    #%d %s\n", slot.IssueNumber, slot.IssueURL)
+		}
+		if slot.Stack != "" {
+			fmt.Printf("│  Stack:    %s (slot-cli new --stack)\n", slot.Stack)
+		}
+		for _, link := range slot.Links {
+			fmt.Printf("│  Linked:   %s (%s)\n", link.Slot, formatLinkedPorts(link.Ports))
+		}
+		if slot.PRURL != "" {
+			fmt.Printf("│  PR:       #%d %s\n", slot.PRNumber, slot.PRURL)
+		}
+		if slot.SharedPostgres {
+			var names []string
+			for _, t := range mainPostgres(mainRepo) {
+				names = append(names, fmt.Sprintf("%s (:%d)", dbclone.SharedDBName(t.DB, slot.Project, slotName), t.MainPort))
+			}
+			fmt.Printf("│  Postgres: shared with main: %s\n", strings.Join(names, ", "))
+		}
+		if slot.TunnelURL != "" && processAlive(slot.TunnelPID) {
+			fmt.Printf("│  Shared:   %s (pid %d)\n", slot.TunnelURL, slot.TunnelPID)
+		}
+	} else {
+		fmt.Println("│  ⚠ No registry entry")
+	}
+	fmt.Printf("│  Path:     %s\n", slotPath)
+	fmt.Printf("│  Domain:   %s\n", info.Domain)
+	fmt.Println("└──────────────────────────────────────")
+	fmt.Println()
+
+	// 2. Lock
+	fmt.Println("┌─ Lock")
+	if inRegistry && slot.LockActive(time.Now()) {
+		fmt.Printf("│  🔒 LOCKED (%s)\n", cmp.Or(slot.LockScope, registry.LockScopeNoDelete))
+		if slot.LockNote != "" {
+			fmt.Printf("│  Note: %s\n", slot.LockNote)
+		}
+		if slot.LockedUntil != "" {
+			fmt.Printf("│  Until: %s\n", slot.LockedUntil)
+		}
+	} else if inRegistry && slot.Locked {
+		fmt.Printf("│  Unlocked (lock expired %s)\n", slot.LockedUntil)
+	} else {
+		fmt.Println("│  Unlocked")
+	}
+	fmt.Println("└──────────────────────────────────────")
+	fmt.Println()
+
+	// 3. Branch state
+	fmt.Println("┌─ Branch")
+	if info.Branch == "" {
+		fmt.Println("│  ✗ Could not detect branch")
+	} else {
+		fmt.Printf("│  Current:  %s\n", info.Branch)
+		fmt.Printf("│  Status:   %d ahead, %d behind %s\n", info.Ahead, info.Behind, info.MainBranch)
+		if info.Dirty == 0 {
+			fmt.Println("│  ✓ Clean working tree")
+		} else {
+			fmt.Printf("│  ⚠ %d uncommitted changes\n", info.Dirty)
+		}
+	}
+	fmt.Println("└──────────────────────────────────────")
+	fmt.Println()
+
+	// 4. Ports
+	fmt.Println("┌─ Ports")
+	if len(info.Ports) == 0 {
+		fmt.Println("│  (no ports found)")
+	}
+	for _, p := range info.Ports {
+		status := "free"
+		if p.Listening {
+			status = "listening"
+		}
+		if p.SameAsMain {
+			status += ", ⚠ same as main"
+		}
+		fmt.Printf("│  %-20s %d (%s)\n", p.Var, p.Port, status)
+	}
+	fmt.Println("└──────────────────────────────────────")
+	fmt.Println()
+
+	// 5. Containers
+	fmt.Println("┌─ Containers")
+	if !info.Docker {
+		fmt.Println("│  (docker not available)")
+	} else if len(info.Containers) == 0 {
+		fmt.Println("│  (no containers)")
+	}
+	for _, c := range info.Containers {
+		fmt.Printf("│  • %s — %s\n", c.Name, c.Status)
+	}
+	fmt.Println("└──────────────────────────────────────")
+	fmt.Println()
+
+	// 6. Agent sessions
+	fmt.Println("┌─ Agent Sessions")
+	for _, a := range info.Agents {
+		fmt.Printf("│  ● %s running (pid %d, %s)\n", a.Agent, a.PID, a.Runtime)
+	}
+	if len(info.Agents) == 0 {
+		fmt.Println("│  No agent running")
+	}
+	if inRegistry && slot.SessionID != "" {
+		fmt.Printf("│  Tracked: %s (%s)\n", slot.SessionID, firstNonEmpty(slot.SessionSlug, "no slug yet"))
+	}
+	fmt.Printf("│  %d session file(s)\n", len(info.Sessions))
+	for i, s := range info.Sessions {
+		if i >= 3 {
+			break
+		}
+		fmt.Printf("│  • %s (%s)\n", s.ID, s.Modified.Format("2006-01-02 15:04"))
+	}
+	fmt.Println("└──────────────────────────────────────")
+	fmt.Println()
+
+	// 7. Recent commits
+	fmt.Println("┌─ Recent Commits")
+	if len(info.Commits) == 0 {
+		fmt.Println("│  (no commits)")
+	}
+	for _, line := range info.Commits {
+		fmt.Printf("│  %s\n", line)
+	}
+	fmt.Println("└──────────────────────────────────────")
+	fmt.Println()
+
+	// 8. Recent history (audit log)
+	fmt.Println("┌─ Recent History")
+	if len(info.History) == 0 {
+		fmt.Println("│  (no recorded operations)")
+	}
+	for _, e := range info.History {
+		mark := "✓"
+		if e.Error != "" {
+			mark = "✗"
+		}
+		fmt.Printf("│  %s %s %s\n", e.Time, mark, e.Action)
+	}
+	fmt.Printf("│  Full log: slot-cli history %s\n", slotName)
+	fmt.Println("└──────────────────────────────────────")
+	fmt.Println()
+
+	// 9. Disk usage
+	fmt.Println("┌─ Disk Usage")
+	if info.DiskBytes < 0 {
+		fmt.Println("│  (unavailable)")
+	} else {
+		fmt.Printf("│  %s\n", humanBytes(info.DiskBytes))
+	}
+	fmt.Println("└──────────────────────────────────────")
+}
+
+// doctorTools are the external tools slot-cli shells out to
+var doctorTools = []struct {
+	Name     string
+	Required bool
+	Purpose  string
+	Fix      string
+}{
+	{"git", true, "worktrees", "install git (https://git-scm.com/downloads)"},
+	{"docker", false, "slot databases and services", "install Docker Desktop or docker engine + compose plugin"},
+	{"psql", false, "postgres clone/restore", "install the postgres client (apt install postgresql-client, brew install libpq)"},
+	{"pg_dump", false, "postgres clone/restore", "install the postgres client (apt install postgresql-client, brew install libpq)"},
+	{"gh", false, "slot-cli pr on GitHub", "install the GitHub CLI (https://cli.github.com) and run gh auth login"},
+	{"glab", false, "slot-cli pr on GitLab", "install glab (https://gitlab.com/gitlab-org/cli) or set GITLAB_TOKEN"},
+	{"tmux", false, "--tmux and attach", "install tmux (apt install tmux, brew install tmux)"},
+	{"pnpm", false, "dependency installs", "run corepack enable, or npm install -g pnpm"},
+}
+
+// DoctorCheck is one doctor finding; Fix is set when OK is false
+type DoctorCheck struct {
+	Section string `json:"section"`
+	Name    string `json:"name"`
+	OK      bool   `json:"ok"`
+	Error   bool   `json:"error"` // false for warnings
+	Detail  string `json:"detail"`
+	Fix     string `json:"fix,omitempty"`
+}
+
+// checkRegistry validates registry integrity: slots of unknown projects,
+// project and slot paths that no longer exist and dangling group references
+func checkRegistry(reg *Registry, exists func(path string) bool) []DoctorCheck {
+	var checks []DoctorCheck
+	problem := func(name, detail, fix string) {
+		checks = append(checks, DoctorCheck{Section: "registry", Name: name, Detail: detail, Fix: fix, Error: true})
+	}
+
+	projects := make([]string, 0, len(reg.Projects))
+	for name := range reg.Projects {
+		projects = append(projects, name)
+	}
+	sort.Strings(projects)
+	for _, name := range projects {
+		p := reg.Projects[name]
+		if !exists(p.Path) {
+			problem(name, fmt.Sprintf("project path %s does not exist", p.Path),
+				fmt.Sprintf("run slot-cli init in the project's new location, or remove \"%s\" from %s", name, registryPath))
+		}
+		if p.Group != "" {
+			if _, ok := reg.Groups[p.Group]; !ok {
+				problem(name, fmt.Sprintf("project is in unknown group '%s'", p.Group),
+					fmt.Sprintf("slot-cli group create %s \"<name>\"", p.Group))
+			}
+		}
+	}
+
+	slots := make([]string, 0, len(reg.Slots))
+	for name := range reg.Slots {
+		slots = append(slots, name)
+	}
+	sort.Strings(slots)
+	for _, name := range slots {
+		slot := reg.Slots[name]
+		project, ok := reg.Projects[slot.Project]
+		if !ok {
+			problem(name, fmt.Sprintf("slot belongs to unregistered project '%s'", slot.Project),
+				fmt.Sprintf("register the project with slot-cli init, or remove \"%s\" from %s", name, registryPath))
+			continue
+		}
+		if slot.Host != "" {
+			continue // lives on another machine
+		}
+		if slotPath := filepath.Join(filepath.Dir(project.Path), name); exists(project.Path) && !exists(slotPath) {
+			problem(name, fmt.Sprintf("slot directory %s is missing", slotPath),
+				"slot-cli clean --do to drop stale entries (or slot-cli undo if it was just removed)")
+		}
+	}
+
+	if len(checks) == 0 {
+		checks = append(checks, DoctorCheck{Section: "registry", Name: "registry.json", OK: true,
+			Detail: fmt.Sprintf("%d project(s), %d slot(s)", len(reg.Projects), len(reg.Slots))})
+	}
+	return checks
+}
+
+// cmdDoctor checks the environment: external tools, docker, registry integrity
+func cmdDoctor() {
+	var checks []DoctorCheck
+
+	for _, tool := range doctorTools {
+		check := DoctorCheck{Section: "tools", Name: tool.Name, Error: tool.Required}
+		if path, err := exec.LookPath(tool.Name); err != nil {
+			check.Detail = "not found (needed for " + tool.Purpose + ")"
+			check.Fix = tool.Fix
+		} else {
+			check.OK = true
+			check.Detail = path
+		}
+		checks = append(checks, check)
+	}
+	if _, err := exec.LookPath("docker"); err == nil {
+		check := DoctorCheck{Section: "tools", Name: "docker daemon", OK: true, Detail: "running"}
+		if err := exec.Command("docker", "info", "--format", "{{.ServerVersion}}").Run(); err != nil {
+			check = DoctorCheck{Section: "tools", Name: "docker daemon", Detail: "not reachable",
+				Fix: "start Docker Desktop (or sudo systemctl start docker) and check your user can access the socket"}
+		}
+		checks = append(checks, check)
+	}
+
+	// loadRegistry treats a corrupt file as empty, and the next save would wipe it
+	data, err := os.ReadFile(registryPath)
+	var parseErr error
+	if err == nil {
+		var reg Registry
+		parseErr = json.Unmarshal(data, &reg)
+	}
+	switch {
+	case os.IsNotExist(err):
+		checks = append(checks, DoctorCheck{Section: "registry", Name: "registry.json", Detail: "no registry yet",
+			Fix: "run slot-cli init in a project"})
+	case err != nil:
+		checks = append(checks, DoctorCheck{Section: "registry", Name: "registry.json", Error: true, Detail: err.Error(),
+			Fix: "check the permissions of " + registryPath})
+	case parseErr != nil:
+		checks = append(checks, DoctorCheck{Section: "registry", Name: "registry.json", Error: true,
+			Detail: "invalid JSON: " + parseErr.Error(),
+			Fix:    "fix " + registryPath + " by hand before running other commands (slot-cli history lists recent changes)"})
+	default:
+		checks = append(checks, checkRegistry(loadRegistry(), func(path string) bool {
+			_, err := os.Stat(path)
+			return err == nil
+		})...)
+	}
+
+	errors := 0
+	for _, c := range checks {
+		if !c.OK && c.Error {
+			errors++
+		}
+	}
+
+	if jsonOutput {
+		data, _ := json.MarshalIndent(checks, "", "  ")
+		fmt.Println(string(data))
+	} else {
+		fmt.Println("═══════════════════════════════════════")
+		fmt.Println("  SLOT DOCTOR")
+		fmt.Println("═══════════════════════════════════════")
+		section := ""
+		for _, c := range checks {
+			if c.Section != section {
+				section = c.Section
+				fmt.Printf("\n%s:\n", strings.ToUpper(section[:1])+section[1:])
+			}
+			mark := "✓"
+			if !c.OK {
+				mark = "⚠"
+				if c.Error {
+					mark = "✗"
+				}
+			}
+			fmt.Printf("  %s %-14s %s\n", mark, c.Name, c.Detail)
+			if c.Fix != "" {
+				fmt.Printf("    → %s\n", c.Fix)
+			}
+		}
+		fmt.Println()
+		fmt.Println("═══════════════════════════════════════")
+		if errors == 0 {
+			fmt.Println("  ✓ NO PROBLEMS FOUND")
+		} else {
+			fmt.Printf("  ✗ %d PROBLEM(S) FOUND\n", errors)
+		}
+		fmt.Println("═══════════════════════════════════════")
+	}
+
+	if errors > 0 {
+		os.Exit(exitError)
+	}
+}
+
+func cmdCheck(args []string) {
+	slotNum := 0
+	for _, arg := range args {
+		if n, err := strconv.Atoi(arg); err == nil {
+			slotNum = n
+			break
+		}
+	}
+
+	cwd, _ := os.Getwd()
+	if slotNum == 0 {
+		// Try to detect from current directory name
+		base := filepath.Base(cwd)
+		re := regexp.MustCompile(`-(\d+)$`)
+		if m := re.FindStringSubmatch(base); len(m) > 1 {
+			slotNum, _ = strconv.Atoi(m[1])
+		}
+	}
+
+	if slotNum == 0 {
+		fail(exitUsage, "need slot number or run from slot directory")
+	}
+
+	mainRepo, project := worktree.DetectProject(cwd)
+	slotName := fmt.Sprintf("%s-%d", project, slotNum)
+	slotPath := filepath.Join(filepath.Dir(mainRepo), slotName)
+
+	reg := loadRegistry()
+	var checks []CheckResult
+	add := func(name, status, detail string) {
+		checks = append(checks, CheckResult{Name: name, Status: status, Detail: detail})
+	}
+
+	if _, err := os.Stat(slotPath); err == nil {
+		add("directory", "ok", "Directory exists")
+	} else {
+		add("directory", "fail", "Directory missing")
+	}
+
+	gitFile := filepath.Join(slotPath, ".git")
+	if info, err := os.Stat(gitFile); err == nil && !info.IsDir() {
+		add("worktree", "ok", "Is git worktree")
+	} else {
+		add("worktree", "fail", "Not a git worktree")
+	}
+
+	if branch := worktree.BranchName(slotPath); branch != "" {
+		add("branch", "ok", "Branch: "+branch)
+	} else {
+		add("branch", "fail", "Could not detect branch")
+	}
+
+	// Env ports: none may still be main's, and each should be main + offset
+	// (unless new had to skip a port in use)
+	offset := reg.Slots[slotName].PortOffset
+	if offset == 0 {
+		offset = slotNum
+	}
+	expected := ports.Allocate(scanPorts(mainRepo), offset)
+	var onMain, unexpected []string
+	for _, rel := range envFiles(mainRepo) {
+		slotData, err := os.ReadFile(filepath.Join(slotPath, rel))
+		if err != nil {
+			continue
+		}
+		mainData, _ := os.ReadFile(filepath.Join(mainRepo, rel))
+		fileOnMain, fileUnexpected := portDrift(envValues(string(mainData)), envValues(string(slotData)), expected)
+		for _, v := range fileOnMain {
+			onMain = append(onMain, rel+": "+v)
+		}
+		for _, v := range fileUnexpected {
+			unexpected = append(unexpected, rel+": "+v)
+		}
+	}
+	switch {
+	case len(onMain) > 0:
+		add("env_ports", "fail", "Env ports still on main's: "+strings.Join(onMain, ", ")+" (slot-cli fix-ports)")
+	case len(unexpected) > 0:
+		add("env_ports", "warn", "Env ports off the expected offset: "+strings.Join(unexpected, ", "))
+	default:
+		add("env_ports", "ok", fmt.Sprintf("Env ports match offset %d", offset))
+	}
+
+	// COMPOSE_PROJECT_NAME keeps the slot's containers and volumes apart
+	composeName := readComposeProjectName(slotPath)
+	hasCompose := len(findComposeFiles(mainRepo)) > 0
+	switch {
+	case !hasCompose:
+		add("compose_project", "ok", "No docker compose files")
+	case composeName == "":
+		add("compose_project", "fail", "COMPOSE_PROJECT_NAME not set (containers would clash with main's)")
+	default:
+		var clashes []string
+		if readComposeProjectName(mainRepo) == composeName {
+			clashes = append(clashes, "main")
+		}
+		for _, other := range slices.Sorted(maps.Keys(reg.Slots)) {
+			if other != slotName && readComposeProjectName(reg.SlotPath(other)) == composeName {
+				clashes = append(clashes, other)
+			}
+		}
+		if len(clashes) > 0 {
+			add("compose_project", "fail", fmt.Sprintf("COMPOSE_PROJECT_NAME=%s also used by %s", composeName, strings.Join(clashes, ", ")))
+		} else {
+			add("compose_project", "ok", "COMPOSE_PROJECT_NAME="+composeName+" (unique)")
+		}
+	}
+
+	// Running containers must publish the slot's ports, never main's
+	if hasCompose && composeName != "" {
+		out, err := exec.Command("docker", "ps", "--filter", "label=com.docker.compose.project="+composeName, "--format", "{{.Names}}|{{.Ports}}").Output()
+		slotPorts := make(map[int]bool)
+		for _, slotPort := range expected {
+			slotPorts[slotPort] = true
+		}
+		for _, rel := range envFiles(slotPath) {
+			content, _ := os.ReadFile(filepath.Join(slotPath, rel))
+			for key, value := range envValues(string(content)) {
+				if _, port, ok := ports.FromEnvLine(key + "=" + value); ok {
+					slotPorts[port] = true
+				}
+			}
+		}
+		var wrong, odd []string
+		containers := 0
+		for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+			name, published, ok := strings.Cut(line, "|")
+			if !ok {
+				continue
+			}
+			containers++
+			for _, port := range publishedPorts(published) {
+				if _, isMain := expected[port]; isMain && !slotPorts[port] {
+					wrong = append(wrong, fmt.Sprintf("%s:%d", name, port))
+				} else if !slotPorts[port] {
+					odd = append(odd, fmt.Sprintf("%s:%d", name, port))
+				}
+			}
+		}
+		switch {
+		case err != nil:
+			add("docker_ports", "skip", "Docker not available")
+		case containers == 0:
+			add("docker_ports", "ok", "No containers running")
+		case len(wrong) > 0:
+			add("docker_ports", "fail", "Containers publish main's ports: "+strings.Join(wrong, ", "))
+		case len(odd) > 0:
+			add("docker_ports", "warn", "Containers publish ports not in the slot's env: "+strings.Join(odd, ", "))
+		default:
+			add("docker_ports", "ok", fmt.Sprintf("%d container(s) on the slot's ports", containers))
+		}
+	}
+
+	if fileExists(filepath.Join(slotPath, "package.json")) {
+		if fileExists(filepath.Join(slotPath, "node_modules")) {
+			add("node_modules", "ok", "node_modules installed")
+		} else {
+			add("node_modules", "warn", "node_modules missing (slot-cli provision)")
+		}
+	}
+
+	failed, warned := 0, 0
+	for _, c := range checks {
+		switch c.Status {
+		case "fail":
+			failed++
+		case "warn":
+			warned++
+		}
+	}
+
+	if jsonOutput {
+		data, _ := json.MarshalIndent(map[string]any{
+			"slot": slotName, "checks": checks, "failed": failed, "warnings": warned,
+		}, "", "  ")
+		fmt.Println(string(data))
+		return
+	}
+
+	fmt.Println("═══════════════════════════════════════")
+	fmt.Printf("  SLOT VALIDATION: %s\n", slotName)
+	fmt.Println("═══════════════════════════════════════")
+	fmt.Println()
+	for _, c := range checks {
+		fmt.Printf("%s %s\n", checkSymbols[c.Status], c.Detail)
+	}
+
+	fmt.Println()
+	fmt.Println("═══════════════════════════════════════")
+	switch {
+	case failed == 0 && warned == 0:
+		fmt.Println("  ✓ ALL CHECKS PASSED")
+	case failed == 0:
+		fmt.Printf("  ✓ PASSED WITH %d WARNING(S)\n", warned)
+	default:
+		fmt.Printf("  ✗ %d ISSUES FOUND (%d warning(s))\n", failed, warned)
+	}
+	fmt.Println("═══════════════════════════════════════")
+}
+
+// CheckResult is one check of `slot-cli check`
+type CheckResult struct {
+	Name   string `json:"name"`
+	Status string `json:"status"` // ok, warn, fail or skip
+	Detail string `json:"detail"`
+}
+
+var checkSymbols = map[string]string{"ok": "✓", "warn": "⚠", "fail": "✗", "skip": "-"}
+
+// portDrift compares a slot's env port variables with main's: the ones still
+// on main's port (clashing with main) and the ones off their expected slot port
+func portDrift(mainEnv, slotEnv map[string]string, expected map[int]int) (onMain, unexpected []string) {
+	for _, key := range slices.Sorted(maps.Keys(mainEnv)) {
+		_, mainPort, ok := ports.FromEnvLine(key + "=" + mainEnv[key])
+		if !ok {
+			continue
+		}
+		_, slotPort, ok := ports.FromEnvLine(key + "=" + slotEnv[key])
+		switch {
+		case !ok:
+		case slotPort == mainPort:
+			onMain = append(onMain, fmt.Sprintf("%s=%d", key, slotPort))
+		case expected[mainPort] != 0 && slotPort != expected[mainPort]:
+			unexpected = append(unexpected, fmt.Sprintf("%s=%d (expected %d)", key, slotPort, expected[mainPort]))
+		}
+	}
+	return onMain, unexpected
+}
+
+// publishedPorts extracts the host ports of a `docker ps` Ports column
+// ("0.0.0.0:5441->5432/tcp, :::5441->5432/tcp")
+func publishedPorts(s string) []int {
+	var published []int
+	for _, m := range regexp.MustCompile(`:(\d+)->`).FindAllStringSubmatch(s, -1) {
+		if port, err := strconv.Atoi(m[1]); err == nil && !slices.Contains(published, port) {
+			published = append(published, port)
+		}
+	}
+	return published
+}
+
+func cmdSync() {
+	cwd, _ := os.Getwd()
+	mainRepo, project := worktree.DetectProject(cwd)
+
+	if mainRepo == "" {
+		fail(exitUsage, "not in a git repository")
+	}
+
+	// Check if we're in a slot (worktree)
+	if mainRepo == cwd {
+		fail(exitUsage, "already in main worktree, nothing to sync")
+	}
+
+	branch := worktree.BranchName(cwd)
+	if branch == "" {
+		fail(exitError, "could not detect current branch")
+	}
+
+	checkLock(filepath.Base(cwd), true)
+
+	fmt.Printf("Syncing slot branch '%s' with main...\n\n", branch)
+
+	// Check for uncommitted changes
+	out, _ := exec.Command("git", "-C", cwd, "status", "--porcelain").Output()
+	if len(out) > 0 {
+		fail(exitDirty, "uncommitted changes detected", "Please commit or stash your changes before syncing")
+	}
+
+	// Fetch latest from origin
+	fmt.Println("Fetching latest from origin...")
+	if err := runCmd(cwd, "git", "fetch", "origin", "main:main"); err != nil {
+		// Try without the ref update (origin/main might not exist locally)
+		runCmd(cwd, "git", "fetch", "origin", "main")
+	}
+	fmt.Println("✓ Fetched latest main")
+
+	// Check if rebase is needed
+	behindOut, _ := exec.Command("git", "-C", cwd, "rev-list", "--count", branch+"..main").Output()
+	behind := strings.TrimSpace(string(behindOut))
+
+	aheadOut, _ := exec.Command("git", "-C", cwd, "rev-list", "--count", "main.."+branch).Output()
+	ahead := strings.TrimSpace(string(aheadOut))
+
+	fmt.Printf("\nStatus: %s commits ahead, %s commits behind main\n", ahead, behind)
+
+	if behind == "0" {
+		fmt.Println("\n✓ Already up to date with main")
+		return
+	}
+
+	// Perform rebase
+	fmt.Println("\nRebasing on main...")
+	cmd := exec.Command("git", "-C", cwd, "rebase", "main")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		fmt.Println()
+		fail(exitConflict, "rebase conflict",
+			"To resolve:",
+			"  1. Fix conflicts in the affected files",
+			"  2. git add <fixed files>",
+			"  3. git rebase --continue",
+			"To abort:",
+			"  git rebase --abort")
+	}
+
+	fmt.Println("\n✓ Successfully synced with main")
+
+	// Install dependencies after rebase
+	projectCfg := loadRegistry().Projects[project]
+	installDeps(mainRepo, cwd, projectCfg.Provision, projectCfg.Install)
+}
+
+func cmdMerge(args []string) {
+	slotNum := 0
+	for _, arg := range args {
+		if n, err := strconv.Atoi(arg); err == nil {
+			slotNum = n
+			break
+		}
+	}
+
+	if slotNum == 0 {
+		fail(exitUsage, "need slot number", "Usage: slot-cli merge <N>")
+	}
+
+	cwd, _ := os.Getwd()
+	mainRepo, project := worktree.DetectProject(cwd)
+
+	if mainRepo == "" {
+		fail(exitUsage, "not in a git repository")
+	}
+
+	// Must be run from main worktree
+	if mainRepo != cwd {
+		fail(exitUsage, "must run from main worktree, not from a slot")
+	}
+	checkLock(fmt.Sprintf("%s-%d", project, slotNum), false)
+
+	branchName := fmt.Sprintf("slot-%d", slotNum)
+
+	// Check branch exists
+	out, err := exec.Command("git", "-C", mainRepo, "branch", "--list", branchName).Output()
+	if err != nil || strings.TrimSpace(string(out)) == "" {
+		fail(exitNotFound, fmt.Sprintf("branch '%s' not found", branchName))
+	}
+
+	fmt.Printf("Merging %s into main...\n", branchName)
+
+	cmd := exec.Command("git", "-C", mainRepo, "merge", branchName)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := auditedRun("merge", branchName, cmd); err != nil {
+		fmt.Println()
+		fail(exitConflict, "merge conflict", "Resolve conflicts, then: git commit")
+	}
+
+	fmt.Printf("\n✓ Merged %s into main\n", branchName)
+}
+
+// defaultMergeMessage is the done merge commit message; the project's
+// merge_message overrides it
+const defaultMergeMessage = "Merge {branch} ({slot})\n\nIssue: {issue_url}\n\n{changelog}"
+
+var mergePlaceholderRe = regexp.MustCompile(`\{[a-z_]+\}`)
+
+// renderMergeMessage fills {slot}, {branch}, {main}, {issue}, {issue_url},
+// {subject} and {changelog} in a template. Lines whose placeholders are all
+// empty are dropped, so "Issue: {issue_url}" disappears for slots without one.
+func renderMergeMessage(tmpl string, vars map[string]string) string {
+	var lines []string
+	for _, line := range strings.Split(tmpl, "\n") {
+		found, empty := 0, 0
+		line = mergePlaceholderRe.ReplaceAllStringFunc(line, func(p string) string {
+			value, ok := vars[strings.Trim(p, "{}")]
+			if !ok {
+				return p
+			}
+			found++
+			if value == "" {
+				empty++
+			}
+			return value
+		})
+		if found > 0 && found == empty {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	msg := regexp.MustCompile(`\n{3,}`).ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return strings.TrimSpace(msg) + "\n"
+}
+
+// mergeMessageVars collects the template values for merging a slot's branch
+func mergeMessageVars(mainRepo, slotName, branchName string, slot SlotConfig) map[string]string {
+	mainBranch := worktree.BranchName(mainRepo)
+	out, _ := exec.Command("git", "-C", mainRepo, "log", "--reverse", "--format=%s", mainBranch+".."+branchName).Output()
+	var subjects, changelog []string
+	for _, s := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if s != "" {
+			subjects = append(subjects, s)
+			changelog = append(changelog, "- "+s)
+		}
+	}
+	vars := map[string]string{
+		"slot":      slotName,
+		"branch":    branchName,
+		"main":      mainBranch,
+		"issue":     "",
+		"issue_url": slot.IssueURL,
+		"subject":   "",
+		"changelog": strings.Join(changelog, "\n"),
+	}
+	if slot.IssueNumber > 0 {
+		vars["issue"] = "#" + strconv.Itoa(slot.IssueNumber)
+	}
+	if len(subjects) > 0 {
+		vars["subject"] = subjects[0]
+	}
+	return vars
+}
+
+func cmdDone(args []string) {
+	message, args := extractFlag(args, "--message")
+	force := false
+	dryRun := false
+	requireChecks := false
+	for _, arg := range args {
+		if arg == "--force" || arg == "-f" {
+			force = true
+		} else if arg == "--dry-run" {
+			dryRun = true
+		} else if arg == "--require-checks" {
+			requireChecks = true
+		}
+	}
+
+	cwd, _ := os.Getwd()
+	mainRepo, project := worktree.DetectProject(cwd)
+
+	if mainRepo == "" {
+		fail(exitUsage, "not in a git repository")
+	}
+
+	// Must be run from a slot (worktree), not main
+	if mainRepo == cwd {
+		fail(exitUsage, "must run from a slot worktree, not main")
+	}
+
+	slotPath := cwd
+	branchName := worktree.BranchName(slotPath)
+	slotName := filepath.Base(slotPath)
+	if branchName == "" {
+		fail(exitUsage, "slot is on a detached HEAD; there is no branch to merge", "Create one first: git switch -c <branch>")
+	}
+
+	// Check lock
+	checkLock(slotName, false)
+	reg := loadRegistry()
+
+	fmt.Printf("Completing slot: %s\n\n", slotName)
+
+	// Refuse to merge while the PR's CI is red
+	if requireChecks || reg.Projects[project].RequireChecks {
+		status, err := slotPRStatus(reg, slotName, slotPath)
+		if err != nil {
+			fail(exitError, fmt.Sprintf("could not read PR checks: %v", err), "Run without --require-checks (or unset require_checks) to merge anyway")
+		}
+		counts := summarizeChecks(status.Checks)
+		if counts["fail"] > 0 {
+			var failed []string
+			for _, c := range status.Checks {
+				if c.Result() == "fail" {
+					failed = append(failed, firstNonEmpty(c.Name, c.Context))
+				}
+			}
+			fail(exitError, fmt.Sprintf("PR #%d has failing checks: %s", status.Number, strings.Join(failed, ", ")), "See: slot-cli pr status")
+		}
+		if counts["pending"] > 0 {
+			fmt.Printf("⚠ PR #%d has %d pending checks\n\n", status.Number, counts["pending"])
+		} else {
+			fmt.Printf("✓ PR #%d checks passed\n\n", status.Number)
+		}
+	}
+
+	// Check for uncommitted changes
+	s := lifecycle.Slot{MainRepo: mainRepo, Project: project, Name: slotName, Path: slotPath, Branch: branchName}
+	if lifecycle.Inspect(s).Dirty && !force && !dryRun {
+		fmt.Println("Warning: uncommitted changes detected (they are not merged and the worktree is removed)")
+		if !confirm("Continue anyway?") {
+			fail(exitDirty, "uncommitted changes detected", "Commit your changes or use --force to skip")
+		}
+	}
+
+	// Make sure no slot-specific port rewrites are about to land in main
+	mainPorts := scanPorts(mainRepo)
+	slotPorts := make(map[int]bool)
+	for port := range scanPorts(slotPath) {
+		if _, isMain := mainPorts[port]; !isMain {
+			slotPorts[port] = true
+		}
+	}
+	dockerName := ports.DockerName(slotName)
+	diffOut, _ := exec.Command("git", "-C", slotPath, "diff", worktree.BranchName(mainRepo)+"..."+branchName).Output()
+	if artifacts := findPortRewriteArtifacts(string(diffOut), slotPorts, dockerName); len(artifacts) > 0 {
+		fmt.Println("⚠ Branch contains slot-specific port rewrites:")
+		for _, a := range artifacts {
+			fmt.Printf("  • %s\n", a)
+		}
+		if !force && !dryRun && !confirm("\nMerge anyway?") {
+			fail(exitDirty, "branch contains slot-specific port rewrites", "Revert these changes before merging, or use --force to merge anyway")
+		}
+		fmt.Println()
+	}
+
+	if message == "" {
+		tmpl := firstNonEmpty(reg.Projects[project].MergeMessage, defaultMergeMessage)
+		message = renderMergeMessage(tmpl, mergeMessageVars(mainRepo, slotName, branchName, reg.Slots[slotName]))
+	}
+
+	if dryRun {
+		planMerge(mainRepo, branchName)
+		fmt.Println("\nMerge commit message:")
+		for _, line := range strings.Split(strings.TrimRight(message, "\n"), "\n") {
+			fmt.Println(strings.TrimRight("  │ "+line, " "))
+		}
+		planSlotRemoval(mainRepo, slotName, slotPath, branchName, false)
+		fmt.Println("\nThis is a dry run. Run without --dry-run to apply.")
+		return
+	}
+
+	if _, err := lifecycle.Done(lifecycleEnv(), s, message); errors.Is(err, lifecycle.ErrMergeConflict) {
+		fmt.Println()
+		fail(exitConflict, "merge conflict",
+			"Resolve conflicts in main, then manually delete slot:",
+			"  cd "+mainRepo,
+			"  git commit",
+			"  slot-cli delete "+worktree.SlotIdentifier(slotName, project))
+	} else if err != nil {
+		fail(exitError, err.Error())
+	}
+
+	fmt.Printf("\n✓ Slot done! Now in main with merged changes.\n")
+	fmt.Printf("\n  cd %s\n", mainRepo)
+
+	// Last: this may be the session we're running in
+	killSlotTmux(slotName)
+}
+
+// PROptions are the `pr` flags passed through to gh pr create
+type PROptions struct {
+	Draft     bool
+	Title     string
+	BodyFile  string
+	Reviewers []string
+	Labels    []string
+}
+
+// ghPRCreateArgs builds the gh pr create arguments; --fill supplies whichever
+// of title and body wasn't given from the branch's commits
+func ghPRCreateArgs(opts PROptions) []string {
+	args := []string{"pr", "create"}
+	if opts.Title == "" || opts.BodyFile == "" {
+		args = append(args, "--fill")
+	}
+	if opts.Title != "" {
+		args = append(args, "--title", opts.Title)
+	}
+	if opts.BodyFile != "" {
+		args = append(args, "--body-file", opts.BodyFile)
+	}
+	if opts.Draft {
+		args = append(args, "--draft")
+	}
+	for _, r := range opts.Reviewers {
+		args = append(args, "--reviewer", r)
+	}
+	for _, l := range opts.Labels {
+		args = append(args, "--label", l)
+	}
+	return args
+}
+
+var prURLRe = regexp.MustCompile(`https?://\S+/(?:pull|merge_requests|pull-requests)/(\d+)`)
+
+// parsePRURL finds a pull/merge request URL (GitHub, GitLab or Bitbucket)
+// and its number
+func parsePRURL(out string) (string, int) {
+	m := prURLRe.FindStringSubmatch(out)
+	if m == nil {
+		return "", 0
+	}
+	n, _ := strconv.Atoi(m[1])
+	return m[0], n
+}
+
+// Forge opens pull requests on the service hosting origin
+type Forge interface {
+	Name() string
+	// CreatePR opens a PR from branch into base and returns its URL
+	CreatePR(dir, branch, base string, opts PROptions) (string, error)
+	// PRState returns the newest PR for branch: open, merged or closed
+	// ("" when there is none) and its URL
+	PRState(dir, branch string) (state, url string, err error)
+}
+
+// normalizePRState maps GitHub (OPEN/MERGED/CLOSED), GitLab
+// (opened/merged/closed/locked) and Bitbucket (OPEN/MERGED/DECLINED/SUPERSEDED)
+// states onto open, merged and closed
+func normalizePRState(state string) string {
+	switch strings.ToLower(state) {
+	case "open", "opened", "locked":
+		return "open"
+	case "merged":
+		return "merged"
+	case "closed", "declined", "superseded":
+		return "closed"
+	}
+	return ""
+}
+
+// branchPRState asks the forge behind a worktree's origin for its branch's PR
+func branchPRState(dir, branch string) (state, url string, err error) {
+	originURL, err := exec.Command("git", "-C", dir, "remote", "get-url", "origin").Output()
+	if err != nil {
+		return "", "", fmt.Errorf("no origin remote")
+	}
+	return detectForge(string(originURL)).PRState(dir, branch)
+}
+
+// parseRemoteURL splits a git remote (https, ssh:// or scp-style) into host
+// and repository path, e.g. "gitlab.com", "group/sub/app"
+func parseRemoteURL(remote string) (host, path string) {
+	remote = strings.TrimSuffix(strings.TrimSpace(remote), "/")
+	if u, err := url.Parse(remote); err == nil && u.Host != "" {
+		host, path = u.Hostname(), u.Path
+	} else if at, rest, ok := strings.Cut(remote, ":"); ok {
+		host, path = at, rest
+		if i := strings.LastIndex(host, "@"); i >= 0 {
+			host = host[i+1:]
+		}
+	}
+	return host, strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+}
+
+// detectForge picks the forge from origin's host: GitLab and Bitbucket by
+// name (self-hosted GitLab included), GitHub otherwise
+func detectForge(remote string) Forge {
+	host, path := parseRemoteURL(remote)
+	switch {
+	case strings.Contains(host, "gitlab"):
+		return gitlabForge{host: host, path: path}
+	case strings.Contains(host, "bitbucket"):
+		return bitbucketForge{path: path}
+	default:
+		return githubForge{}
+	}
+}
+
+// prText returns the PR title and body: the flags, else the last commit
+func prText(dir string, opts PROptions) (title, body string, err error) {
+	title = opts.Title
+	if title == "" {
+		out, _ := exec.Command("git", "-C", dir, "log", "-1", "--format=%s").Output()
+		title = strings.TrimSpace(string(out))
+	}
+	if opts.BodyFile != "" {
+		data, err := os.ReadFile(opts.BodyFile)
+		if err != nil {
+			return "", "", err
+		}
+		return title, string(data), nil
+	}
+	out, _ := exec.Command("git", "-C", dir, "log", "-1", "--format=%b").Output()
+	return title, strings.TrimSpace(string(out)), nil
+}
+
+// forgeAPI sends a forge API request (JSON payload, nil for none) and
+// returns the response body
+func forgeAPI(method, endpoint string, payload any, auth func(*http.Request)) ([]byte, error) {
+	var body io.Reader
+	if payload != nil {
+		data, _ := json.Marshal(payload)
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	auth(req)
+	client := &http.Client{Timeout: time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return nil, fmt.Errorf("%s %s: %s: %s", method, endpoint, resp.Status, strings.TrimSpace(string(data)))
+	}
+	return data, nil
+}
+
+// githubForge uses the gh CLI
+type githubForge struct{}
+
+func (githubForge) Name() string { return "GitHub" }
+
+func (githubForge) CreatePR(dir, branch, base string, opts PROptions) (string, error) {
+	args := ghPRCreateArgs(opts)
+	if base != "" {
+		args = append(args, "--base", base)
+	}
+	var out strings.Builder
+	cmd := exec.Command("gh", args...)
+	cmd.Dir = dir
+	cmd.Stdout = io.MultiWriter(os.Stdout, &out)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		// Record an already-open PR for the branch, if that's why it failed
+		view := exec.Command("gh", "pr", "view", branch, "--json", "url", "-q", ".url")
+		view.Dir = dir
+		existing, _ := view.Output()
+		if url, _ := parsePRURL(string(existing)); url != "" {
+			fmt.Println("\n⚠ A PR already exists for this branch")
+			return url, nil
+		}
+		return "", fmt.Errorf("PR creation failed (may already exist; gh pr list)")
+	}
+	url, _ := parsePRURL(out.String())
+	return url, nil
+}
+
+func (githubForge) PRState(dir, branch string) (string, string, error) {
+	cmd := exec.Command("gh", "pr", "list", "--head", branch, "--state", "all", "--json", "state,url", "--limit", "1")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return "", "", fmt.Errorf("gh pr list failed (is gh installed and authenticated?)")
+	}
+	var prs []struct {
+		State string `json:"state"`
+		URL   string `json:"url"`
+	}
+	if err := json.Unmarshal(out, &prs); err != nil || len(prs) == 0 {
+		return "", "", err
+	}
+	return normalizePRState(prs[0].State), prs[0].URL, nil
+}
+
+// gitlabForge uses glab when installed, else the REST API with GITLAB_TOKEN
+type gitlabForge struct {
+	host string
+	path string
+}
+
+func (gitlabForge) Name() string { return "GitLab" }
+
+// glabMRCreateArgs builds the glab mr create arguments for a body read from
+// --body-file ("" lets --fill use the commits)
+func glabMRCreateArgs(branch, base, body string, opts PROptions) []string {
+	args := []string{"mr", "create", "--source-branch", branch, "--yes"}
+	if base != "" {
+		args = append(args, "--target-branch", base)
+	}
+	if opts.Title == "" || body == "" {
+		args = append(args, "--fill")
+	}
+	if opts.Title != "" {
+		args = append(args, "--title", opts.Title)
+	}
+	if body != "" {
+		args = append(args, "--description", body)
+	}
+	if opts.Draft {
+		args = append(args, "--draft")
+	}
+	if len(opts.Reviewers) > 0 {
+		args = append(args, "--reviewer", strings.Join(opts.Reviewers, ","))
+	}
+	if len(opts.Labels) > 0 {
+		args = append(args, "--label", strings.Join(opts.Labels, ","))
+	}
+	return args
+}
+
+func (f gitlabForge) CreatePR(dir, branch, base string, opts PROptions) (string, error) {
+	if _, err := exec.LookPath("glab"); err == nil {
+		body := ""
+		if opts.BodyFile != "" {
+			data, err := os.ReadFile(opts.BodyFile)
+			if err != nil {
+				return "", err
+			}
+			body = string(data)
+		}
+		var out strings.Builder
+		cmd := exec.Command("glab", glabMRCreateArgs(branch, base, body, opts)...)
+		cmd.Dir = dir
+		cmd.Stdout = io.MultiWriter(os.Stdout, &out)
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return "", fmt.Errorf("MR creation failed (may already exist; glab mr list)")
+		}
+		url, _ := parsePRURL(out.String())
+		return url, nil
+	}
+
+	token := os.Getenv("GITLAB_TOKEN")
+	if token == "" {
+		return "", errNoGitLabAuth
+	}
+	title, body, err := prText(dir, opts)
+	if err != nil {
+		return "", err
+	}
+	if opts.Draft {
+		title = "Draft: " + title
+	}
+	if len(opts.Reviewers) > 0 {
+		fmt.Println("⚠ Reviewers need glab on GitLab (the API wants user IDs); skipped")
+	}
+	endpoint := fmt.Sprintf("https://%s/api/v4/projects/%s/merge_requests", f.host, url.PathEscape(f.path))
+	data, err := forgeAPI("POST", endpoint, map[string]any{
+		"source_branch": branch,
+		"target_branch": base,
+		"title":         title,
+		"description":   body,
+		"labels":        strings.Join(opts.Labels, ","),
+	}, f.auth(token))
+	if err != nil {
+		return "", err
+	}
+	var mr struct {
+		WebURL string `json:"web_url"`
+	}
+	json.Unmarshal(data, &mr)
+	return mr.WebURL, nil
+}
+
+var errNoGitLabAuth = fmt.Errorf("install glab (https://gitlab.com/gitlab-org/cli) or set GITLAB_TOKEN")
+
+func (gitlabForge) auth(token string) func(*http.Request) {
+	return func(req *http.Request) { req.Header.Set("PRIVATE-TOKEN", token) }
+}
+
+func (f gitlabForge) PRState(dir, branch string) (string, string, error) {
+	query := "/merge_requests?state=all&order_by=updated_at&per_page=1&source_branch=" + url.QueryEscape(branch)
+	var data []byte
+	var err error
+	if _, lookErr := exec.LookPath("glab"); lookErr == nil {
+		cmd := exec.Command("glab", "api", "projects/:id"+query)
+		cmd.Dir = dir
+		data, err = cmd.Output()
+	} else if token := os.Getenv("GITLAB_TOKEN"); token != "" {
+		data, err = forgeAPI("GET", fmt.Sprintf("https://%s/api/v4/projects/%s%s", f.host, url.PathEscape(f.path), query), nil, f.auth(token))
+	} else {
+		return "", "", errNoGitLabAuth
+	}
+	if err != nil {
+		return "", "", err
+	}
+	var mrs []struct {
+		State  string `json:"state"`
+		WebURL string `json:"web_url"`
+	}
+	if err := json.Unmarshal(data, &mrs); err != nil || len(mrs) == 0 {
+		return "", "", err
+	}
+	return normalizePRState(mrs[0].State), mrs[0].WebURL, nil
+}
+
+// bitbucketForge uses the Bitbucket Cloud API with BITBUCKET_TOKEN, or
+// BITBUCKET_USERNAME and BITBUCKET_APP_PASSWORD
+type bitbucketForge struct {
+	path string // workspace/repo
+}
+
+func (bitbucketForge) Name() string { return "Bitbucket" }
+
+// auth authenticates API requests from BITBUCKET_TOKEN, or
+// BITBUCKET_USERNAME and BITBUCKET_APP_PASSWORD
+func (bitbucketForge) auth() (func(*http.Request), error) {
+	token := os.Getenv("BITBUCKET_TOKEN")
+	user, pass := os.Getenv("BITBUCKET_USERNAME"), os.Getenv("BITBUCKET_APP_PASSWORD")
+	if token == "" && (user == "" || pass == "") {
+		return nil, fmt.Errorf("set BITBUCKET_TOKEN, or BITBUCKET_USERNAME and BITBUCKET_APP_PASSWORD")
+	}
+	return func(req *http.Request) {
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		} else {
+			req.SetBasicAuth(user, pass)
+		}
+	}, nil
+}
+
+func (f bitbucketForge) CreatePR(dir, branch, base string, opts PROptions) (string, error) {
+	auth, err := f.auth()
+	if err != nil {
+		return "", err
+	}
+	title, body, err := prText(dir, opts)
+	if err != nil {
+		return "", err
+	}
+	if len(opts.Reviewers) > 0 || len(opts.Labels) > 0 {
+		fmt.Println("⚠ Bitbucket PRs are created without reviewers and labels (add them on the PR page)")
+	}
+	endpoint := "https://api.bitbucket.org/2.0/repositories/" + f.path + "/pullrequests"
+	data, err := forgeAPI("POST", endpoint, map[string]any{
+		"title":       title,
+		"description": body,
+		"draft":       opts.Draft,
+		"source":      map[string]any{"branch": map[string]string{"name": branch}},
+		"destination": map[string]any{"branch": map[string]string{"name": base}},
+	}, auth)
+	if err != nil {
+		return "", err
+	}
+	var pr bitbucketPR
+	json.Unmarshal(data, &pr)
+	return pr.Links.HTML.Href, nil
+}
+
+// bitbucketPR is the part of a Bitbucket pull request slot-cli reads
+type bitbucketPR struct {
+	State string `json:"state"`
+	Links struct {
+		HTML struct {
+			Href string `json:"href"`
+		} `json:"html"`
+	} `json:"links"`
+}
+
+func (f bitbucketForge) PRState(dir, branch string) (string, string, error) {
+	auth, err := f.auth()
+	if err != nil {
+		return "", "", err
+	}
+	query := url.Values{
+		"q":       {fmt.Sprintf(`source.branch.name="%s"`, branch)},
+		"state":   {"OPEN", "MERGED", "DECLINED", "SUPERSEDED"},
+		"sort":    {"-updated_on"},
+		"pagelen": {"1"},
+	}
+	data, err := forgeAPI("GET", "https://api.bitbucket.org/2.0/repositories/"+f.path+"/pullrequests?"+query.Encode(), nil, auth)
+	if err != nil {
+		return "", "", err
+	}
+	var page struct {
+		Values []bitbucketPR `json:"values"`
+	}
+	if err := json.Unmarshal(data, &page); err != nil || len(page.Values) == 0 {
+		return "", "", err
+	}
+	return normalizePRState(page.Values[0].State), page.Values[0].Links.HTML.Href, nil
+}
+
+func cmdPR(args []string) {
+	if len(args) > 0 && args[0] == "status" {
+		cmdPRStatus(args[1:])
+		return
+	}
+
+	title, args := extractFlag(args, "--title")
+	bodyFile, args := extractFlag(args, "--body-file")
+	reviewers, args := extractFlag(args, "--reviewer")
+	labels, args := extractFlag(args, "--label")
+	opts := PROptions{Title: title, BodyFile: bodyFile, Reviewers: splitList(reviewers), Labels: splitList(labels)}
+	for _, arg := range args {
+		if arg == "--draft" {
+			opts.Draft = true
+		}
+	}
+
+	cwd, _ := os.Getwd()
+	mainRepo, project := worktree.DetectProject(cwd)
+
+	if mainRepo == "" {
+		fail(exitUsage, "not in a git repository")
+	}
+
+	// Can run from slot or detect slot from args
+	slotPath := cwd
+	if mainRepo == cwd {
+		fail(exitUsage, "must run from a slot worktree")
+	}
+
+	branchName := worktree.BranchName(slotPath)
+	if branchName == "" {
+		fail(exitError, "could not detect branch")
+	}
+
+	reg := loadRegistry()
+	slotName := filepath.Base(slotPath)
+	if opts.BodyFile == "" {
+		if tmpl := reg.Projects[project].PRTemplate; tmpl != "" {
+			opts.BodyFile = filepath.Join(mainRepo, tmpl)
+			if _, err := os.Stat(opts.BodyFile); err != nil {
+				fail(exitNotFound, fmt.Sprintf("PR template %s not found", opts.BodyFile),
+					"fix pr_template in "+registryPath+" or pass --body-file")
+			}
+		}
+	} else if _, err := os.Stat(opts.BodyFile); err != nil {
+		fail(exitNotFound, fmt.Sprintf("body file %s not found", opts.BodyFile))
+	}
+
+	// Link the issue the slot was created for (new --issue)
+	if issueURL := reg.Slots[slotName].IssueURL; issueURL != "" {
+		_, body, err := prText(slotPath, opts)
+		if err != nil {
+			fail(exitError, fmt.Sprintf("could not read PR body: %v", err))
+		}
+		bodyFile, err := os.CreateTemp("", "slot-pr-*.md")
+		if err != nil {
+			fail(exitError, fmt.Sprintf("could not write PR body: %v", err))
+		}
+		defer os.Remove(bodyFile.Name())
+		bodyFile.WriteString(withIssueLink(body, issueURL))
+		bodyFile.Close()
+		opts.BodyFile = bodyFile.Name()
+	}
+
+	fmt.Printf("Creating PR for branch: %s\n\n", branchName)
+
+	// Push to origin with upstream tracking
+	fmt.Println("Pushing to origin...")
+	cmd := exec.Command("git", "-C", slotPath, "push", "-u", "origin", branchName)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		fail(exitError, "failed to push")
+	}
+	fmt.Println("✓ Pushed to origin")
+
+	originURL, _ := exec.Command("git", "-C", slotPath, "remote", "get-url", "origin").Output()
+	forge := detectForge(string(originURL))
+	fmt.Printf("\nCreating PR on %s...\n", forge.Name())
+	prURL, err := forge.CreatePR(slotPath, branchName, worktree.BranchName(mainRepo), opts)
+	if err != nil {
+		fmt.Printf("\n⚠ %v\n", err)
+		return
+	}
+
+	url, number := parsePRURL(prURL)
+	if url == "" {
+		return
+	}
+	if slot, ok := reg.Slots[slotName]; ok {
+		slot.PRURL, slot.PRNumber = url, number
+		reg.Slots[slotName] = slot
+		saveRegistry(reg)
+	}
+	fmt.Printf("✓ PR #%d: %s\n", number, url)
+}
+
+// PRStatus is a GitHub PR's state as reported by gh pr view --json
+type PRStatus struct {
+	Number         int        `json:"number"`
+	URL            string     `json:"url"`
+	State          string     `json:"state"` // OPEN, CLOSED, MERGED
+	IsDraft        bool       `json:"isDraft"`
+	ReviewDecision string     `json:"reviewDecision"` // APPROVED, CHANGES_REQUESTED, REVIEW_REQUIRED or empty
+	Reviews        []PRReview `json:"reviews"`
+	Checks         []PRCheck  `json:"statusCheckRollup"`
+}
+
+// PRReview is one submitted review
+type PRReview struct {
+	Author struct {
+		Login string `json:"login"`
+	} `json:"author"`
+	State string `json:"state"` // APPROVED, CHANGES_REQUESTED, COMMENTED, DISMISSED
+}
+
+// PRCheck is a check run (Name, Status, Conclusion) or a commit status
+// (Context, State)
+type PRCheck struct {
+	Name       string `json:"name"`
+	Context    string `json:"context"`
+	Status     string `json:"status"`
+	Conclusion string `json:"conclusion"`
+	State      string `json:"state"`
+}
+
+// Result collapses a check to pass, fail, pending or skipped
+func (c PRCheck) Result() string {
+	switch firstNonEmpty(c.Conclusion, c.State) {
+	case "SUCCESS":
+		return "pass"
+	case "NEUTRAL", "SKIPPED":
+		return "skipped"
+	case "FAILURE", "ERROR", "CANCELLED", "TIMED_OUT", "ACTION_REQUIRED", "STARTUP_FAILURE", "STALE":
+		return "fail"
+	}
+	return "pending"
+}
+
+// summarizeChecks counts checks by result
+func summarizeChecks(checks []PRCheck) map[string]int {
+	counts := map[string]int{}
+	for _, c := range checks {
+		counts[c.Result()]++
+	}
+	return counts
+}
+
+// latestReviews keeps each reviewer's most recent approve/request-changes
+// review, in order of first appearance; comments don't change a verdict
+func latestReviews(reviews []PRReview) []PRReview {
+	var order []string
+	latest := map[string]PRReview{}
+	for _, r := range reviews {
+		if r.State != "APPROVED" && r.State != "CHANGES_REQUESTED" && r.State != "DISMISSED" {
+			continue
+		}
+		if _, seen := latest[r.Author.Login]; !seen {
+			order = append(order, r.Author.Login)
+		}
+		latest[r.Author.Login] = r
+	}
+	var out []PRReview
+	for _, login := range order {
+		if latest[login].State != "DISMISSED" {
+			out = append(out, latest[login])
+		}
+	}
+	return out
+}
+
+// fetchPRStatus asks gh for the PR identified by ref (number or branch)
+func fetchPRStatus(dir, ref string) (*PRStatus, error) {
+	cmd := exec.Command("gh", "pr", "view", ref, "--json", "number,url,state,isDraft,reviewDecision,reviews,statusCheckRollup")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return nil, fmt.Errorf("%s", strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, err
+	}
+	var status PRStatus
+	if err := json.Unmarshal(out, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// slotPRStatus fetches the PR recorded for a slot, or the one for its branch
+func slotPRStatus(reg *Registry, slotName, slotPath string) (*PRStatus, error) {
+	if _, err := exec.LookPath("gh"); err != nil {
+		return nil, fmt.Errorf("gh is not installed (PR status is GitHub only)")
+	}
+	ref := worktree.BranchName(slotPath)
+	if n := reg.Slots[slotName].PRNumber; n > 0 {
+		ref = strconv.Itoa(n)
+	}
+	return fetchPRStatus(slotPath, ref)
+}
+
+// cmdPRStatus shows a slot's PR state, reviews and CI checks
+func cmdPRStatus(args []string) {
+	slotName := resolveSlotName(args)
+	reg := loadRegistry()
+	cwd, _ := os.Getwd()
+	mainRepo, _ := worktree.DetectProject(cwd)
+	if slot, ok := reg.Slots[slotName]; ok {
+		mainRepo = firstNonEmpty(reg.Projects[slot.Project].Path, mainRepo)
+	}
+	if mainRepo == "" {
+		fail(exitUsage, "not in a git repository")
+	}
+	slotPath := filepath.Join(filepath.Dir(mainRepo), slotName)
+	if _, err := os.Stat(slotPath); err != nil {
+		fail(exitNotFound, fmt.Sprintf("slot '%s' not found", slotName))
+	}
+
+	status, err := slotPRStatus(reg, slotName, slotPath)
+	if err != nil {
+		fail(exitNotFound, fmt.Sprintf("no PR for %s: %v", slotName, err), "Create one with: slot-cli pr")
+	}
+	if jsonOutput {
+		data, _ := json.MarshalIndent(status, "", "  ")
+		fmt.Println(string(data))
+		return
+	}
+
+	state := status.State
+	if status.IsDraft {
+		state += " (draft)"
+	}
+	fmt.Printf("┌─ PR #%d  %s\n", status.Number, status.URL)
+	fmt.Printf("│  State:    %s\n", state)
+	fmt.Printf("│  Review:   %s\n", firstNonEmpty(status.ReviewDecision, "none required"))
+	for _, r := range latestReviews(status.Reviews) {
+		mark := "✓"
+		if r.State == "CHANGES_REQUESTED" {
+			mark = "✗"
+		}
+		fmt.Printf("│    %s %s (%s)\n", mark, r.Author.Login, strings.ToLower(strings.ReplaceAll(r.State, "_", " ")))
+	}
+
+	counts := summarizeChecks(status.Checks)
+	if len(status.Checks) == 0 {
+		fmt.Println("│  Checks:   none")
+	} else {
+		fmt.Printf("│  Checks:   %d passed, %d failed, %d pending\n", counts["pass"], counts["fail"], counts["pending"])
+		marks := map[string]string{"pass": "✓", "fail": "✗", "pending": "…", "skipped": "-"}
+		for _, c := range status.Checks {
+			fmt.Printf("│    %s %s\n", marks[c.Result()], firstNonEmpty(c.Name, c.Context))
+		}
+	}
+	fmt.Println("└──────────────────────────────────────")
+}
+
+func cmdClean(args []string) {
+	groupFlag, args := extractFlag(args, "--group")
+	labelFlag, args := extractFlag(args, "--label")
+	idleFlag, args := extractFlag(args, "--idle")
+	var idleLimit time.Duration
+	if idleFlag != "" {
+		var err error
+		if idleLimit, err = parseSince(idleFlag); err != nil || idleLimit == 0 {
+			fail(exitUsage, "--idle must be a duration like 7d or 2w")
+		}
+	}
+	graceFlag, args := extractFlag(args, "--grace")
+	grace, err := cleanGrace(graceFlag)
+	if err != nil {
+		fail(exitUsage, "--grace / clean_grace must be a duration like 12h or 2d (0 disables it)")
+	}
+	doClean := false
+	force := false
+	checkPRs := false
+	expired := false
+	interactive := false
+
+	for _, arg := range args {
+		if arg == "--do" {
+			doClean = true
+		} else if arg == "--interactive" || arg == "-i" {
+			interactive = true
+		} else if arg == "--force" || arg == "-f" {
+			force = true
+		} else if arg == "--prs" {
+			checkPRs = true
+		} else if arg == "--expired" {
+			expired = true
+		}
+	}
+
+	// --json reports the scan for CI and the daemon to act on
+	screen := io.Writer(os.Stdout)
+	if jsonOutput {
+		if doClean || interactive {
+			fail(exitUsage, "--json only reports the scan", "Drop --json to clean, or act on the report with slot-cli delete")
+		}
+		screen = io.Discard
+	}
+	var report CleanReport
+
+	fmt.Fprintln(screen)
+	fmt.Fprintln(screen, "════════════════════════════════════════════════════════════════")
+	fmt.Fprintln(screen, "                        SLOT CLEAN")
+	fmt.Fprintln(screen, "════════════════════════════════════════════════════════════════")
+	fmt.Fprintln(screen)
+
+	cwd, _ := os.Getwd()
+	mainRepo, _ := worktree.DetectProject(cwd)
+	if mainRepo == "" {
+		mainRepo = cwd
+	}
+	parentDir := filepath.Dir(mainRepo)
+
+	reg := loadRegistry()
+	now := time.Now()
+	if noteSlotActivity(reg, getAgentProcesses(), now) {
+		saveRegistry(reg)
+	}
+	reg = scopeToLabel(scopeToGroup(reg, groupFlag), labelFlag)
+	scoped := groupFlag != "" || labelFlag != "" // only reg's slots, wherever they live
+	groupSessions := make(map[string]bool)
+	for name := range reg.Slots {
+		groupSessions[tmuxSessionName(name)] = true
+	}
+
+	if interactive {
+		if !isTerminal(os.Stdin) {
+			fail(exitUsage, "--interactive needs a terminal", "Use --do (with --force, --expired or --idle) instead")
+		}
+	}
+
+	var safeTmux []string
+	var safeWorktrees []string
+	var unmergedWorktrees []string // offered unchecked by --interactive
+	var blockedItems []string
+	var warningItems []string
+	expiredCount := 0 // expired slots kept only because they're unmerged
+	idleCount := 0    // same for idle ones
+	newCount := 0     // slots kept by the grace period
+
+	// 1. Check tmux sessions
+	fmt.Fprintln(screen, "Scanning tmux sessions...")
+	agents := loadAgents()
+	out, _ := exec.Command("tmux", "list-sessions", "-F", "#{session_name}").Output()
+	sessions := strings.Split(strings.TrimSpace(string(out)), "\n")
+
+	for _, session := range sessions {
+		if session == "" || (scoped && !groupSessions[session]) {
+			continue
+		}
+		// Check if an agent is running in this session
+		paneOut, _ := exec.Command("tmux", "list-panes", "-t", session, "-F", "#{pane_current_command}").Output()
+		if agentName := agentInPanes(string(paneOut), agents); agentName != "" {
+			blockedItems = append(blockedItems, fmt.Sprintf("tmux:%s - %s running", session, agentName))
+			report.Blocked = append(report.Blocked, CleanFinding{Kind: "tmux", Name: session, Reason: "agent-running", Detail: agentName + " running"})
+		} else {
+			safeTmux = append(safeTmux, session)
+			report.Safe = append(report.Safe, CleanFinding{Kind: "tmux", Name: session, Reason: "no-agent"})
+			fmt.Fprintf(screen, "  ✓ tmux:%s - safe to kill\n", session)
+		}
+	}
+	if len(sessions) == 0 || (len(sessions) == 1 && sessions[0] == "") {
+		fmt.Fprintln(screen, "  (no tmux sessions)")
+	}
+
+	fmt.Fprintln(screen)
+
+	// 2. Check git worktrees
+	fmt.Fprintln(screen, "Scanning worktrees...")
+	var wtPaths []string
+	if scoped {
+		for name := range reg.Slots {
+			wtPaths = append(wtPaths, reg.SlotPath(name))
+		}
+		sort.Strings(wtPaths)
+	} else {
+		entries, _ := os.ReadDir(parentDir)
+		for _, entry := range entries {
+			if entry.IsDir() {
+				wtPaths = append(wtPaths, filepath.Join(parentDir, entry.Name()))
+			}
+		}
+	}
+
+	for _, wtPath := range wtPaths {
+		wtName := filepath.Base(wtPath)
+
+		// Skip if it's the main repo
+		if wtPath == mainRepo {
+			continue
+		}
+
+		// Check if it's a slot/worktree pattern
+		if !strings.Contains(wtName, "-") {
+			continue
+		}
+
+		// Check if it's a git worktree
+		gitFile := filepath.Join(wtPath, ".git")
+		info, err := os.Stat(gitFile)
+		if err != nil || info.IsDir() {
+			continue
+		}
+
+		branch := worktree.BranchName(wtPath)
+		finding := func(reason, detail string) CleanFinding {
+			return CleanFinding{Kind: "worktree", Name: wtName, Path: wtPath, Branch: branch, Reason: reason, Detail: detail}
+		}
+
+		// Check 1: Uncommitted changes
+		uncommittedOut, _ := exec.Command("git", "-C", wtPath, "status", "--porcelain").Output()
+		uncommitted := len(strings.TrimSpace(string(uncommittedOut))) > 0
+
+		// Check 2: Unpushed commits
+		unpushedOut, _ := exec.Command("git", "-C", wtPath, "log", "origin/"+branch+"..HEAD", "--oneline").Output()
+		unpushed := len(strings.TrimSpace(string(unpushedOut))) > 0
+
+		// Check 3: Unmerged with main
+		unmergedOut, _ := exec.Command("git", "-C", wtPath, "log", "origin/main..HEAD", "--oneline").Output()
+		if len(unmergedOut) == 0 {
+			unmergedOut, _ = exec.Command("git", "-C", wtPath, "log", "origin/master..HEAD", "--oneline").Output()
+		}
+		unmergedCount := 0
+		if len(strings.TrimSpace(string(unmergedOut))) > 0 {
+			unmergedCount = len(strings.Split(strings.TrimSpace(string(unmergedOut)), "\n"))
+		}
+
+		// Check 4: PR merged or closed on the forge (squash/web UI merges)
+		prState, prURL := "", ""
+		if checkPRs && unmergedCount > 0 && !uncommitted && !unpushed {
+			prState, prURL, _ = branchPRState(wtPath, branch)
+		}
+
+		// Check 5: TTL from new --ttl ran out
+		slot, inRegistry := reg.Slots[wtName]
+		isExpired := inRegistry && slot.Expired(now)
+
+		// Check 6: no commits, agent or dev server for a while
+		idle := idleFor(slot, now)
+
+		// Check 7: created within the grace period (no commits yet is not "merged")
+		age := slotAge(slot.CreatedAt, info.ModTime(), now)
+
+		// Check lock
+		if inRegistry && slot.LockActive(now) {
+			note := ""
+			if slot.LockNote != "" {
+				note = " — " + slot.LockNote
+			}
+			blockedItems = append(blockedItems, fmt.Sprintf("%s (%s) - LOCKED%s", wtName, branch, note))
+			report.Blocked = append(report.Blocked, finding("locked", slot.LockNote))
+			continue
+		}
+
+		if uncommitted {
+			blockedItems = append(blockedItems, fmt.Sprintf("%s (%s) - DIRTY: uncommitted files", wtName, branch))
+			report.Blocked = append(report.Blocked, finding("dirty", "uncommitted files"))
+		} else if unpushed {
+			blockedItems = append(blockedItems, fmt.Sprintf("%s (%s) - UNPUSHED: commits not on remote", wtName, branch))
+			report.Blocked = append(report.Blocked, finding("unpushed", "commits not on remote"))
+		} else if prState == "merged" || prState == "closed" {
+			safeWorktrees = append(safeWorktrees, wtPath)
+			report.Safe = append(report.Safe, finding("pr-"+prState, prURL))
+			fmt.Fprintf(screen, "  ✓ %s (%s) - CLEAN: PR %s (%s)\n", wtName, branch, prState, prURL)
+		} else if isExpired && expired {
+			safeWorktrees = append(safeWorktrees, wtPath)
+			report.Safe = append(report.Safe, finding("expired", "expired "+slot.ExpiresAt))
+			fmt.Fprintf(screen, "  ✓ %s (%s) - CLEAN: expired %s\n", wtName, branch, slot.ExpiresAt)
+		} else if age < grace {
+			detail := fmt.Sprintf("created %dh ago", int(age/time.Hour))
+			if age < time.Hour {
+				detail = fmt.Sprintf("created %dm ago", int(age/time.Minute))
+			}
+			blockedItems = append(blockedItems, fmt.Sprintf("%s (%s) - NEW: %s", wtName, branch, detail))
+			report.Blocked = append(report.Blocked, finding("new", detail))
+			newCount++
+		} else if idleLimit > 0 && idle >= idleLimit {
+			safeWorktrees = append(safeWorktrees, wtPath)
+			report.Safe = append(report.Safe, finding("idle", idleLabel(idle)))
+			fmt.Fprintf(screen, "  ✓ %s (%s) - CLEAN: %s\n", wtName, branch, idleLabel(idle))
+		} else if unmergedCount > 0 {
+			note := ""
+			if isExpired {
+				note = ", EXPIRED"
+				expiredCount++
+			}
+			if idle >= idleThreshold {
+				note += ", " + strings.ToUpper(idleLabel(idle))
+				idleCount++
+			}
+			warningItems = append(warningItems, fmt.Sprintf("%s (%s) - UNMERGED: %d commits not in main%s", wtName, branch, unmergedCount, note))
+			detail := fmt.Sprintf("%d commits not in main%s", unmergedCount, strings.ToLower(note))
+			report.Warnings = append(report.Warnings, finding("unmerged", detail))
+			if force {
+				safeWorktrees = append(safeWorktrees, wtPath)
+				report.Safe = append(report.Safe, finding("unmerged-forced", detail))
+			} else {
+				unmergedWorktrees = append(unmergedWorktrees, wtPath)
+			}
+		} else {
+			safeWorktrees = append(safeWorktrees, wtPath)
+			report.Safe = append(report.Safe, finding("merged", "merged to main"))
+			if isExpired {
+				fmt.Fprintf(screen, "  ✓ %s (%s) - CLEAN: merged to main, expired %s\n", wtName, branch, slot.ExpiresAt)
+			} else if idle >= idleThreshold {
+				fmt.Fprintf(screen, "  ✓ %s (%s) - CLEAN: merged to main, %s\n", wtName, branch, idleLabel(idle))
+			} else {
+				fmt.Fprintf(screen, "  ✓ %s (%s) - CLEAN: merged to main\n", wtName, branch)
+			}
+		}
+	}
+
+	if len(safeWorktrees) == 0 && len(blockedItems) == 0 && len(warningItems) == 0 {
+		fmt.Fprintln(screen, "  (no worktrees found)")
+	}
+
+	fmt.Fprintln(screen)
+
+	// 3. Check for orphan registry entries (slot in registry but no directory on disk)
+	var orphanSlots []string
+	fmt.Fprintln(screen, "Scanning registry for orphans...")
+	for slotName, slotCfg := range reg.Slots {
+		projectCfg, ok := reg.Projects[slotCfg.Project]
+		if !ok {
+			orphanSlots = append(orphanSlots, slotName)
+			report.Orphans = append(report.Orphans, CleanFinding{Kind: "registry", Name: slotName, Reason: "project-missing", Detail: slotCfg.Project})
+			fmt.Fprintf(screen, "  ✗ %s - ORPHAN: project '%s' not in registry\n", slotName, slotCfg.Project)
+			continue
+		}
+		if slotCfg.Host != "" {
+			continue // lives on another machine
+		}
+		slotDir := filepath.Join(filepath.Dir(projectCfg.Path), slotName)
+		if _, err := os.Stat(slotDir); os.IsNotExist(err) {
+			orphanSlots = append(orphanSlots, slotName)
+			report.Orphans = append(report.Orphans, CleanFinding{Kind: "registry", Name: slotName, Path: slotDir, Reason: "directory-missing"})
+			fmt.Fprintf(screen, "  ✗ %s - ORPHAN: directory not found (%s)\n", slotName, slotDir)
+		}
+	}
+	if len(orphanSlots) == 0 {
+		fmt.Fprintln(screen, "  (no orphans)")
+	}
+
+	fmt.Fprintln(screen)
+
+	// Containers are only offered interactively (clean docker handles them otherwise)
+	var orphanContainers []DockerProcess
+	if interactive && !scoped {
+		fmt.Fprintln(screen, "Scanning docker containers...")
+		_, orphanContainers = classifyContainers(getDockerProcesses(), reg)
+		for _, p := range orphanContainers {
+			fmt.Fprintf(screen, "  ⚠ %s (%s) - ORPHAN: no registered slot\n", p.Name, p.Image)
+		}
+		if len(orphanContainers) == 0 {
+			fmt.Fprintln(screen, "  (no orphan containers)")
+		}
+		fmt.Fprintln(screen)
+	}
+
+	if jsonOutput {
+		for _, u := range measureWorktrees(safeWorktrees) {
+			report.Reclaimable += u.Total()
+		}
+		report.sort()
+		data, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(data))
+		return
+	}
+
+	// 4. Summary
+	fmt.Println("════════════════════════════════════════════════════════════════")
+
+	if len(blockedItems) > 0 {
+		fmt.Println(red.Sprint("BLOCKED - cannot clean:"))
+		for _, item := range blockedItems {
+			fmt.Printf("  ✗ %s\n", item)
+		}
+		if newCount > 0 {
+			fmt.Printf("  (slots younger than %dh are kept; --grace 0 includes them)\n", int(grace/time.Hour))
+		}
+		fmt.Println()
+	}
+
+	if len(warningItems) > 0 {
+		fmt.Println(yellow.Sprint("WARNINGS - unmerged branches:"))
+		for _, item := range warningItems {
+			fmt.Printf("  ⚠ %s\n", item)
+		}
+		fmt.Println("  (use --force to include these)")
+		if expiredCount > 0 {
+			fmt.Println("  (use --expired to include the ones past their --ttl)")
+		}
+		if idleCount > 0 {
+			fmt.Println("  (use --idle 7d to include the ones idle that long)")
+		}
+		fmt.Println()
+	}
+
+	if len(orphanSlots) > 0 {
+		fmt.Println(magenta.Sprint("ORPHAN REGISTRY ENTRIES:"))
+		for _, name := range orphanSlots {
+			fmt.Printf("  ✗ %s\n", name)
+		}
+		fmt.Println()
+	}
+
+	if interactive {
+		items := cleanItems(safeTmux, safeWorktrees, unmergedWorktrees, orphanContainers, orphanSlots)
+		if len(items) == 0 {
+			fmt.Println(cyan.Sprint("Nothing to clean."))
+			return
+		}
+		if !selectCleanItems(items) {
+			fail(exitAborted, "aborted")
+		}
+		safeTmux, safeWorktrees, orphanContainers, orphanSlots = nil, nil, nil, nil
+		for _, item := range items {
+			if !item.Selected {
+				continue
+			}
+			switch item.Kind {
+			case "tmux":
+				safeTmux = append(safeTmux, item.Name)
+			case "worktree":
+				safeWorktrees = append(safeWorktrees, item.Name)
+			case "container":
+				orphanContainers = append(orphanContainers, DockerProcess{Name: item.Name})
+			case "orphan":
+				orphanSlots = append(orphanSlots, item.Name)
+			}
+		}
+		doClean = true
+	}
+
+	safeCount := len(safeTmux) + len(safeWorktrees) + len(orphanSlots) + len(orphanContainers)
+
+	if safeCount == 0 {
+		fmt.Println(cyan.Sprint("Nothing safe to clean."))
+		return
+	}
+
+	usages := measureWorktrees(safeWorktrees)
+	var estimate Reclaimed
+	for _, u := range usages {
+		estimate.Add(u)
+	}
+	if estimate.Total() > 0 {
+		fmt.Println(green.Sprintf("SAFE TO CLEAN: %d items (~%s)", safeCount, humanBytes(estimate.Total())))
+	} else {
+		fmt.Println(green.Sprintf("SAFE TO CLEAN: %d items", safeCount))
+	}
+
+	if !doClean {
+		fmt.Println()
+		fmt.Println("This is a dry run. To actually clean, run:")
+		fmt.Println("  slot-cli clean --do")
+		if len(warningItems) > 0 {
+			fmt.Println("  slot-cli clean --do --force  (include unmerged branches)")
+			if !checkPRs {
+				fmt.Println("  slot-cli clean --prs         (treat merged/closed PRs as clean)")
+			}
+		}
+		return
+	}
+
+	if !interactive && !confirm(fmt.Sprintf("\nRemove %d items?", safeCount)) {
+		fail(exitAborted, "aborted")
+	}
+
+	// Actually clean
+	fmt.Println()
+	fmt.Println(cyan.Sprint("Cleaning..."))
+
+	// Stop orphan containers picked interactively
+	for _, p := range orphanContainers {
+		if err := auditedRun("clean", p.Name, exec.Command("docker", "stop", p.Name)); err == nil {
+			fmt.Printf("  ✓ Stopped container %s\n", p.Name)
+		} else {
+			fmt.Printf("  ✗ Failed to stop container %s\n", p.Name)
+		}
+	}
+
+	// Kill tmux sessions
+	for _, session := range safeTmux {
+		if err := auditedRun("clean", session, exec.Command("tmux", "kill-session", "-t", session)); err == nil {
+			fmt.Printf("  ✓ Killed tmux:%s\n", session)
+		}
+	}
+
+	// Remove orphan registry entries
+	for _, slotName := range orphanSlots {
+		removeFromRegistry(slotName)
+		fmt.Printf("  ✓ Removed orphan registry entry: %s\n", slotName)
+	}
+
+	// Remove worktrees
+	var reclaimed Reclaimed
+	for _, wtPath := range safeWorktrees {
+		if removeCleanWorktree(wtPath) {
+			reclaimed.Add(usages[wtPath])
+		}
+	}
+
+	fmt.Println()
+	printReclaimed(reclaimed)
+	fmt.Println(green.Sprint("Done!"))
+}
+
+// CleanFinding is one item of a clean scan. Reason is a stable code (merged,
+// pr-merged, pr-closed, expired, idle, unmerged-forced, no-agent for safe items;
+// dirty, unpushed, locked, new, agent-running for blocked ones; unmerged for
+// warnings; project-missing, directory-missing for orphans).
+type CleanFinding struct {
+	Kind   string `json:"kind"` // tmux, worktree or registry
+	Name   string `json:"name"`
+	Path   string `json:"path,omitempty"`
+	Branch string `json:"branch,omitempty"`
+	Reason string `json:"reason"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// CleanReport is the clean scan as printed by clean --json; Safe is what
+// clean --do (with the same flags) would remove
+type CleanReport struct {
+	Safe        []CleanFinding `json:"safe"`
+	Blocked     []CleanFinding `json:"blocked"`
+	Warnings    []CleanFinding `json:"warnings"`
+	Orphans     []CleanFinding `json:"orphans"`
+	Reclaimable int64          `json:"reclaimable_bytes"` // measured for safe worktrees
+}
+
+// sort orders each list by kind and name, with empty lists as [] not null
+func (r *CleanReport) sort() {
+	for _, list := range []*[]CleanFinding{&r.Safe, &r.Blocked, &r.Warnings, &r.Orphans} {
+		if *list == nil {
+			*list = []CleanFinding{}
+		}
+		slices.SortStableFunc(*list, func(a, b CleanFinding) int {
+			return cmp.Or(strings.Compare(a.Kind, b.Kind), strings.Compare(a.Name, b.Name))
+		})
+	}
+}
+
+// CleanItem is one entry of the clean --interactive checklist
+type CleanItem struct {
+	Kind     string // tmux, worktree, container or orphan
+	Name     string // session, worktree path, container or slot name
+	Label    string
+	Selected bool
+}
+
+// cleanItems builds the checklist from a clean scan: what --do would remove
+// starts checked, unmerged worktrees and orphan containers unchecked
+func cleanItems(tmux, worktrees, unmerged []string, containers []DockerProcess, orphans []string) []CleanItem {
+	var items []CleanItem
+	for _, s := range tmux {
+		items = append(items, CleanItem{"tmux", s, "tmux:" + s, true})
+	}
+	for _, path := range worktrees {
+		items = append(items, CleanItem{"worktree", path, "worktree " + filepath.Base(path), true})
+	}
+	for _, path := range unmerged {
+		items = append(items, CleanItem{"worktree", path, "worktree " + filepath.Base(path) + " (UNMERGED)", false})
+	}
+	for _, p := range containers {
+		items = append(items, CleanItem{"container", p.Name, "container " + p.Name + " (orphan)", false})
+	}
+	for _, name := range orphans {
+		items = append(items, CleanItem{"orphan", name, "registry entry " + name + " (orphan)", true})
+	}
+	return items
+}
+
+// toggleCleanItems applies a checklist command: item numbers or ranges
+// ("2", "3-5") flip those items, "a" checks all and "n" none. A bad token
+// leaves items as they were.
+func toggleCleanItems(items []CleanItem, input string) error {
+	before := slices.Clone(items)
+	for _, tok := range strings.FieldsFunc(input, func(r rune) bool { return r == ' ' || r == ',' }) {
+		switch tok {
+		case "a", "all":
+			for i := range items {
+				items[i].Selected = true
+			}
+			continue
+		case "n", "none":
+			for i := range items {
+				items[i].Selected = false
+			}
+			continue
+		}
+		lo, hi, isRange := strings.Cut(tok, "-")
+		first, err := strconv.Atoi(lo)
+		last := first
+		if err == nil && isRange {
+			last, err = strconv.Atoi(hi)
+		}
+		if err != nil || first < 1 || last > len(items) || first > last {
+			copy(items, before)
+			return fmt.Errorf("%q is not an item number (1-%d), a range, a or n", tok, len(items))
+		}
+		for i := first - 1; i < last; i++ {
+			items[i].Selected = !items[i].Selected
+		}
+	}
+	return nil
+}
+
+// selectCleanItems shows the checklist until Enter accepts it; false on q
+func selectCleanItems(items []CleanItem) bool {
+	in := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Println("Select what to clean:")
+		for i, item := range items {
+			mark := " "
+			if item.Selected {
+				mark = "x"
+			}
+			fmt.Printf("  %2d [%s] %s\n", i+1, mark, item.Label)
+		}
+		fmt.Print("\nToggle (e.g. 2 4-6, a=all, n=none), Enter to clean, q to quit: ")
+		line, err := in.ReadString('\n')
+		line = strings.TrimSpace(line)
+		switch {
+		case err != nil || line == "q":
+			fmt.Println()
+			return false
+		case line == "":
+			return true
+		}
+		if err := toggleCleanItems(items, line); err != nil {
+			fmt.Printf("  ✗ %v\n", err)
+		}
+		fmt.Println()
+	}
+}
+
+// printReclaimed prints the freed space per category, if any was measured
+func printReclaimed(r Reclaimed) {
+	if r.Total() == 0 {
+		return
+	}
+	fmt.Println("Reclaimed:")
+	for _, line := range r.Lines() {
+		fmt.Println(line)
+	}
+	fmt.Println()
+}
+
+// measureWorktrees sizes the worktrees a clean would remove, keyed by path
+// (empty when du is missing)
+func measureWorktrees(paths []string) map[string]SlotDiskUsage {
+	usages := make(map[string]SlotDiskUsage)
+	if _, err := exec.LookPath("du"); err != nil || len(paths) == 0 {
+		return usages
+	}
+	volumes := dockerVolumeSizes()
+	var mu sync.Mutex
+	sem := make(chan struct{}, 4)
+	var wg sync.WaitGroup
+	for _, path := range paths {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			u := slotDiskUsage(filepath.Base(path), "", path, volumes)
+			mu.Lock()
+			usages[path] = u
+			mu.Unlock()
+			<-sem
+		}()
+	}
+	wg.Wait()
+	return usages
+}
+
+// removeCleanWorktree stops a worktree's docker and removes it, its branch
+// and its registry entry (journaled for undo); false if it couldn't
+func removeCleanWorktree(wtPath string) bool {
+	wtName := filepath.Base(wtPath)
+	branch := worktree.BranchName(wtPath)
+
+	// Stop docker if running
+	stopDocker(wtPath)
+
+	// Find main repo
+	gitContent, err := os.ReadFile(filepath.Join(wtPath, ".git"))
+	if err != nil {
+		return false
+	}
+	line := strings.TrimSpace(string(gitContent))
+	if !strings.HasPrefix(line, "gitdir:") {
+		return false
+	}
+	gitdir := strings.TrimSpace(strings.TrimPrefix(line, "gitdir:"))
+	idx := strings.Index(gitdir, "/.git/worktrees")
+	if idx < 0 {
+		return false
+	}
+	wtMainRepo := gitdir[:idx]
+
+	// Remove worktree and branch
+	journalSlotRemoval("clean", wtMainRepo, wtName, wtPath, branch)
+	auditedRun("clean", wtName, exec.Command("git", "-C", wtMainRepo, "worktree", "remove", wtPath, "--force"))
+	if branch != "" {
+		auditedRun("clean", wtName, exec.Command("git", "-C", wtMainRepo, "branch", "-D", branch))
+	}
+	if fileExists(wtPath) {
+		fmt.Printf("  ✗ Could not remove worktree: %s\n", wtName)
+		return false
+	}
+	stopTunnel(loadRegistry().Slots[wtName])
+	removeFromRegistry(wtName)
+	fmt.Printf("  ✓ Removed worktree: %s\n", wtName)
+	return true
+}
+
+// cmdCleanPRs removes slots whose PR was merged or closed on the forge,
+// e.g. squash-merged in the web UI where git still sees unmerged commits
+func cmdCleanPRs(args []string) {
+	doClean := slices.Contains(args, "--do")
+	allProjects := slices.Contains(args, "--all")
+
+	fmt.Println()
+	fmt.Println("════════════════════════════════════════════════════════════════")
+	fmt.Println("                     MERGED/CLOSED PRS")
+	fmt.Println("════════════════════════════════════════════════════════════════")
+	fmt.Println()
+
+	cwd, _ := os.Getwd()
+	_, project := worktree.DetectProject(cwd)
+	if project == "" && !allProjects {
+		fail(exitUsage, "not in a git repository", "Use --all to check every project's slots")
+	}
+
+	reg := loadRegistry()
+	names := make([]string, 0, len(reg.Slots))
+	for name, slot := range reg.Slots {
+		if allProjects || slot.Project == project {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var safe []string
+	for _, name := range names {
+		slot := reg.Slots[name]
+		projectCfg, ok := reg.Projects[slot.Project]
+		if !ok {
+			continue
+		}
+		slotPath := filepath.Join(filepath.Dir(projectCfg.Path), name)
+		if _, err := os.Stat(slotPath); err != nil {
+			continue
+		}
+		branch := worktree.BranchName(slotPath)
+		dirty, _ := exec.Command("git", "-C", slotPath, "status", "--porcelain").Output()
+
+		state, prURL, err := branchPRState(slotPath, branch)
+		switch {
+		case err != nil:
+			fmt.Printf("  ⚠ %s (%s) - could not check PR: %v\n", name, branch, err)
+		case state == "":
+			fmt.Printf("  · %s (%s) - no PR\n", name, branch)
+		case state == "open":
+			fmt.Printf("  · %s (%s) - PR open: %s\n", name, branch, prURL)
+		case slot.LockActive(time.Now()):
+			fmt.Printf("  ✗ %s (%s) - PR %s but LOCKED\n", name, branch, state)
+		case len(strings.TrimSpace(string(dirty))) > 0:
+			fmt.Printf("  ✗ %s (%s) - PR %s but DIRTY: uncommitted files\n", name, branch, state)
+		default:
+			safe = append(safe, slotPath)
+			fmt.Printf("  ✓ %s (%s) - PR %s: %s\n", name, branch, state, prURL)
+		}
+	}
+	if len(names) == 0 {
+		fmt.Println("  (no slots)")
+	}
+	fmt.Println()
+
+	if len(safe) == 0 {
+		fmt.Println(cyan.Sprint("Nothing safe to clean."))
+		return
+	}
+	usages := measureWorktrees(safe)
+	var estimate Reclaimed
+	for _, u := range usages {
+		estimate.Add(u)
+	}
+	if estimate.Total() > 0 {
+		fmt.Println(green.Sprintf("SAFE TO CLEAN: %d slots (~%s)", len(safe), humanBytes(estimate.Total())))
+	} else {
+		fmt.Println(green.Sprintf("SAFE TO CLEAN: %d slots", len(safe)))
+	}
+	if !doClean {
+		fmt.Println()
+		fmt.Println("This is a dry run. To actually clean, run:")
+		fmt.Println("  slot-cli clean prs --do")
+		return
+	}
+	if !confirm(fmt.Sprintf("\nRemove %d slots?", len(safe))) {
+		fail(exitAborted, "aborted")
+	}
+	fmt.Println()
+	var reclaimed Reclaimed
+	for _, slotPath := range safe {
+		if removeCleanWorktree(slotPath) {
+			reclaimed.Add(usages[slotPath])
+		}
+	}
+	fmt.Println()
+	printReclaimed(reclaimed)
+	fmt.Println(green.Sprint("Done!"))
+}
+
+// terminateProcess asks a process to exit (SIGTERM, or taskkill on Windows)
+func terminateProcess(pid int) error {
+	if runtime.GOOS == "windows" {
+		return auditedRun("kill", "", exec.Command("taskkill", "/PID", strconv.Itoa(pid)))
+	}
+	return auditedRun("kill", "", exec.Command("kill", strconv.Itoa(pid)))
+}
+
+// isUserDir reports whether path is under a home directory, which is where
+// slots live (skips system and tool processes)
+func isUserDir(path string) bool {
+	if home := homeDir(); home != "" && home != "/" && strings.HasPrefix(path, home) {
+		return true
+	}
+	return strings.HasPrefix(path, "/Users/") || strings.HasPrefix(path, "/home/")
+}
+
+type AgentProcess struct {
+	PID     int
+	Agent   string
+	CWD     string
+	Project string
+	Branch  string
+	Runtime string
+}
+
+// agentInPanes returns the agent whose process pattern matches one of the
+// tmux pane commands, or ""
+func agentInPanes(paneCommands string, agents map[string]Agent) string {
+	names := make([]string, 0, len(agents))
+	for name := range agents {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, line := range strings.Split(strings.ToLower(paneCommands), "\n") {
+		for _, name := range names {
+			if p := agents[name].Process; p != "" && strings.Contains(line, strings.ToLower(p)) {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+func getAgentProcesses() []AgentProcess {
+	agents := loadAgents()
+	names := make([]string, 0, len(agents))
+	for name := range agents {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	seen := make(map[string]bool) // dedupe by agent + cwd
+	var processes []AgentProcess
+	for _, name := range names {
+		if agents[name].Process == "" {
+			continue
+		}
+		processes = append(processes, agentProcessesFor(name, procs.Find(agents[name].Process), seen)...)
+	}
+	return processes
+}
+
+func agentProcessesFor(agent string, found []procs.ProcInfo, seen map[string]bool) []AgentProcess {
+	var processes []AgentProcess
+	for _, proc := range found {
+		pid := proc.PID
+		pidStr := strconv.Itoa(pid)
+
+		// Get cwd
+		cwd := procs.CWD(pid)
+		if cwd == "" || cwd == "/" || !isUserDir(cwd) {
+			continue
+		}
+
+		if seen[agent+cwd] {
+			continue
+		}
+		seen[agent+cwd] = true
+
+		// Get branch
+		branchOut, _ := exec.Command("git", "-C", cwd, "branch", "--show-current").Output()
+		branch := strings.TrimSpace(string(branchOut))
+
+		// Get runtime
+		runtimeOut, _ := exec.Command("ps", "-p", pidStr, "-o", "etime=").Output()
+		runtime := strings.TrimSpace(string(runtimeOut))
+
+		// Extract project name from path
+		project := filepath.Base(cwd)
+
+		processes = append(processes, AgentProcess{
+			PID:     pid,
+			Agent:   agent,
+			CWD:     cwd,
+			Project: project,
+			Branch:  branch,
+			Runtime: runtime,
+		})
+	}
+	return processes
+}
+
+func cmdCleanAgents(args []string) {
+	killOrphans := false
+	killAll := false
+	dryRun := true
+
+	for _, arg := range args {
+		if arg == "--orphans" {
+			killOrphans = true
+			dryRun = false
+		} else if arg == "--all" {
+			killAll = true
+			dryRun = false
+		}
+	}
+
+	fmt.Println()
+	fmt.Println("════════════════════════════════════════════════════════════════")
+	fmt.Println("                     AGENT CLEANUP")
+	fmt.Println("════════════════════════════════════════════════════════════════")
+	fmt.Println()
+
+	processes := getAgentProcesses()
+	if len(processes) == 0 {
+		fmt.Println("No agent instances running.")
+		return
+	}
+
+	registry := loadRegistry()
+
+	// Build set of known paths from registry
+	knownPaths := make(map[string]string) // path -> label
+	for name, project := range registry.Projects {
+		knownPaths[project.Path] = name + " (main)"
+	}
+	for name, slot := range registry.Slots {
+		project := registry.Projects[slot.Project]
+		if project.Path != "" {
+			slotPath := filepath.Join(filepath.Dir(project.Path), name)
+			knownPaths[slotPath] = name + " (" + slot.Branch + ")"
+		}
+	}
+
+	var attached []AgentProcess
+	var orphans []AgentProcess
+
+	for _, p := range processes {
+		matched := false
+		for knownPath, label := range knownPaths {
+			if worktree.IsWithin(p.CWD, knownPath) {
+				p.Project = label
+				attached = append(attached, p)
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			orphans = append(orphans, p)
+		}
+	}
+
+	fmt.Println(green.Sprintf("ATTACHED TO SLOTS (%d):", len(attached)))
+	for _, p := range attached {
+		fmt.Printf("  • pid %d  %s  %s  branch:%s  %s\n", p.PID, p.Agent, p.Project, p.Branch, p.Runtime)
+	}
+	if len(attached) == 0 {
+		fmt.Println("  (none)")
+	}
+	fmt.Println()
+
+	fmt.Println(yellow.Sprintf("UNREGISTERED (%d):", len(orphans)))
+	for _, p := range orphans {
+		fmt.Printf("  • pid %d  %s  %s  branch:%s  %s\n", p.PID, p.Agent, p.Project, p.Branch, p.Runtime)
+	}
+	if len(orphans) == 0 {
+		fmt.Println("  (none)")
+	}
+	fmt.Println()
+
+	fmt.Println("════════════════════════════════════════════════════════════════")
+
+	if dryRun {
+		fmt.Println("This is a dry run. To stop instances:")
+		fmt.Println("  slot-cli clean agents --orphans  (stop unregistered only)")
+		fmt.Println("  slot-cli clean agents --all      (stop all agent instances)")
+		return
+	}
+
+	var toKill []AgentProcess
+	if killAll {
+		toKill = processes
+		fmt.Printf("\n%s\n", cyan.Sprintf("Stopping ALL %d agent instances...", len(toKill)))
+	} else if killOrphans {
+		toKill = orphans
+		fmt.Printf("\n%s\n", cyan.Sprintf("Stopping %d unregistered agent instances...", len(toKill)))
+	}
+
+	if len(toKill) > 0 && !confirm("Continue?") {
+		fail(exitAborted, "aborted")
+	}
+
+	for _, p := range toKill {
+		if err := terminateProcess(p.PID); err == nil {
+			fmt.Printf("  ✓ Stopped %s (pid %d)\n", p.Project, p.PID)
+		} else {
+			fmt.Printf("  ✗ Failed to stop %s (pid %d)\n", p.Project, p.PID)
+		}
+	}
+
+	fmt.Println()
+	fmt.Println(green.Sprint("Done!"))
+}
+
+type DockerProcess struct {
+	Name    string
+	Ports   string
+	Status  string
+	Image   string
+	Project string // matched project/slot from registry
+}
+
+func getDockerProcesses() []DockerProcess {
+	out, err := exec.Command("docker", "ps", "--format", "{{.Names}}|{{.Ports}}|{{.Status}}|{{.Image}}").Output()
+	if err != nil {
+		return nil
+	}
+
+	var processes []DockerProcess
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if line == "" {
+			continue
+		}
+		parts := strings.SplitN(line, "|", 4)
+		if len(parts) < 4 {
+			continue
+		}
+		processes = append(processes, DockerProcess{
+			Name:   parts[0],
+			Ports:  parts[1],
+			Status: parts[2],
+			Image:  parts[3],
+		})
+	}
+	return processes
+}
+
+// classifyContainers splits containers into those named after a registered
+// project or slot (Project set to its label) and orphans
+func classifyContainers(processes []DockerProcess, reg *Registry) (attached, orphans []DockerProcess) {
+	knownPrefixes := make(map[string]string) // prefix -> label
+	for name := range reg.Projects {
+		knownPrefixes[name] = name + " (main)"
+	}
+	for name, slot := range reg.Slots {
+		knownPrefixes[name] = name + " (" + slot.Branch + ")"
+	}
+
+	for _, p := range processes {
+		matched := false
+		for prefix, label := range knownPrefixes {
+			if strings.HasPrefix(p.Name, prefix+"-") || p.Name == prefix {
+				p.Project = label
+				attached = append(attached, p)
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			orphans = append(orphans, p)
+		}
+	}
+	return attached, orphans
+}
+
+func cmdCleanDocker(args []string) {
+	killOrphans := false
+	killAll := false
+	dryRun := true
+	volumes := slices.Contains(args, "--volumes")
+	images := slices.Contains(args, "--images")
+
+	for _, arg := range args {
+		if arg == "--orphans" {
+			killOrphans = true
+			dryRun = false
+		} else if arg == "--all" {
+			killAll = true
+			dryRun = false
+		}
+	}
+
+	fmt.Println()
+	fmt.Println("════════════════════════════════════════════════════════════════")
+	fmt.Println("                     DOCKER CLEANUP")
+	fmt.Println("════════════════════════════════════════════════════════════════")
+	fmt.Println()
+
+	// Volumes and images outlive their slot's containers
+	if volumes || images {
+		if killAll {
+			fail(exitUsage, "--all stops containers; with --volumes/--images use --orphans")
+		}
+		cmdCleanDockerData(volumes, images, killOrphans)
+		return
+	}
+
+	processes := getDockerProcesses()
+	if len(processes) == 0 {
+		fmt.Println("No docker containers running.")
+		return
+	}
+
+	attached, orphans := classifyContainers(processes, loadRegistry())
+
+	fmt.Println(green.Sprintf("ATTACHED TO SLOTS (%d):", len(attached)))
+	for _, p := range attached {
+		fmt.Printf("  • %s → %s\n", p.Name, p.Project)
+	}
+	if len(attached) == 0 {
+		fmt.Println("  (none)")
+	}
+	fmt.Println()
+
+	fmt.Println(yellow.Sprintf("ORPHAN CONTAINERS (%d):", len(orphans)))
+	for _, p := range orphans {
+		fmt.Printf("  • %s (%s)\n", p.Name, p.Image)
+	}
+	if len(orphans) == 0 {
+		fmt.Println("  (none)")
+	}
+	fmt.Println()
+
+	fmt.Println("════════════════════════════════════════════════════════════════")
+
+	if dryRun {
+		fmt.Println("This is a dry run. To stop containers:")
+		fmt.Println("  slot-cli clean docker --orphans  (stop orphans only)")
+		fmt.Println("  slot-cli clean docker --all      (stop all containers)")
+		fmt.Println()
+		fmt.Println("Note: volumes are preserved (no -v flag); see --volumes/--images.")
+		return
+	}
+
+	var toStop []DockerProcess
+	if killAll {
+		toStop = processes
+		fmt.Printf("\n%s\n", cyan.Sprintf("Stopping ALL %d containers...", len(toStop)))
+	} else if killOrphans {
+		toStop = orphans
+		fmt.Printf("\n%s\n", cyan.Sprintf("Stopping %d orphan containers...", len(toStop)))
+	}
+
+	if len(toStop) > 0 && !confirm("Continue?") {
+		fail(exitAborted, "aborted")
+	}
+
+	for _, p := range toStop {
+		if err := auditedRun("clean", p.Name, exec.Command("docker", "stop", p.Name)); err == nil {
+			fmt.Printf("  ✓ Stopped %s\n", p.Name)
+		} else {
+			fmt.Printf("  ✗ Failed to stop %s\n", p.Name)
+		}
+	}
+
+	fmt.Println()
+	fmt.Println(green.Sprint("Done! (volumes preserved)"))
+}
+
+// DockerResource is a compose volume or image found by clean docker
+type DockerResource struct {
+	Name    string // volume name, or image tags (ID when untagged)
+	ID      string // image ID (empty for volumes)
+	Project string // com.docker.compose.project label
+	Size    int64
+}
+
+// composeVolumes lists labeled compose volumes from
+// `docker system df -v --format '{{json .}}'`
+func composeVolumes(dfJSON []byte) []DockerResource {
+	var df struct {
+		Volumes []struct {
+			Name   string
+			Labels string
+			Size   string
+		}
+	}
+	var volumes []DockerResource
+	if json.Unmarshal(dfJSON, &df) != nil {
+		return nil
+	}
+	for _, v := range df.Volumes {
+		for _, label := range strings.Split(v.Labels, ",") {
+			if project, ok := strings.CutPrefix(label, "com.docker.compose.project="); ok {
+				volumes = append(volumes, DockerResource{Name: v.Name, Project: project, Size: parseDockerSize(v.Size)})
+			}
+		}
+	}
+	return volumes
+}
+
+// composeImages lists images compose built (labeled with their project)
+func composeImages() []DockerResource {
+	ids, err := exec.Command("docker", "image", "ls", "-q", "--no-trunc", "--filter", "label=com.docker.compose.project").Output()
+	if err != nil || len(strings.TrimSpace(string(ids))) == 0 {
+		return nil
+	}
+	inspectArgs := append([]string{"image", "inspect", "--format",
+		`{{.Id}}|{{index .Config.Labels "com.docker.compose.project"}}|{{.Size}}|{{join .RepoTags ","}}`},
+		slices.Compact(strings.Fields(string(ids)))...)
+	out, err := exec.Command("docker", inspectArgs...).Output()
+	if err != nil {
+		return nil
+	}
+	var images []DockerResource
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		parts := strings.SplitN(line, "|", 4)
+		if len(parts) < 4 {
+			continue
+		}
+		size, _ := strconv.ParseInt(parts[2], 10, 64)
+		images = append(images, DockerResource{Name: firstNonEmpty(parts[3], parts[0]), ID: parts[0], Project: parts[1], Size: size})
+	}
+	return images
+}
+
+// deletedSlotResources keeps the resources of compose projects named like a
+// slot of a registered project (<project>-…) that no live slot uses
+func deletedSlotResources(resources []DockerResource, projects []string, live map[string]bool) []DockerResource {
+	var deleted []DockerResource
+	for _, r := range resources {
+		if live[r.Project] {
+			continue
+		}
+		for _, project := range projects {
+			if strings.HasPrefix(r.Project, ports.DockerName(project)+"-") {
+				deleted = append(deleted, r)
+				break
+			}
+		}
+	}
+	return deleted
+}
+
+// liveComposeProjects returns the compose project names registered projects
+// and slots use
+func liveComposeProjects(reg *Registry) map[string]bool {
+	live := make(map[string]bool)
+	dirs := make(map[string]string)
+	for name, project := range reg.Projects {
+		dirs[name] = project.Path
+	}
+	for name := range reg.Slots {
+		dirs[name] = reg.SlotPath(name)
+	}
+	for name, dir := range dirs {
+		live[ports.DockerName(name)] = true
+		for _, composeFile := range findComposeFiles(dir) {
+			live[composeProjectName(filepath.Dir(composeFile))] = true
+		}
+	}
+	return live
+}
+
+// cmdCleanDockerData lists (and with --orphans removes) the volumes and/or
+// images left behind by deleted slots, with the space they take
+func cmdCleanDockerData(volumes, images, remove bool) {
+	reg := loadRegistry()
+	live := liveComposeProjects(reg)
+	projects := slices.Collect(maps.Keys(reg.Projects))
+
+	type leftovers struct {
+		Label     string
+		Resources []DockerResource
+		Remove    []string // docker subcommand removing one
+	}
+	var kinds []leftovers
+	if volumes {
+		var all []DockerResource
+		if out, err := exec.Command("docker", "system", "df", "-v", "--format", "{{json .}}").Output(); err == nil {
+			all = composeVolumes(out)
+		}
+		kinds = append(kinds, leftovers{"VOLUMES", deletedSlotResources(all, projects, live), []string{"volume", "rm"}})
+	}
+	if images {
+		kinds = append(kinds, leftovers{"IMAGES", deletedSlotResources(composeImages(), projects, live), []string{"image", "rm"}})
+	}
+
+	var total int64
+	count := 0
+	for _, kind := range kinds {
+		var size int64
+		for _, r := range kind.Resources {
+			size += r.Size
+		}
+		fmt.Println(yellow.Sprintf("%s OF DELETED SLOTS (%d, %s):", kind.Label, len(kind.Resources), humanBytes(size)))
+		for _, r := range kind.Resources {
+			fmt.Printf("  • %-40s %8s  (%s)\n", r.Name, humanBytes(r.Size), r.Project)
+		}
+		if len(kind.Resources) == 0 {
+			fmt.Println("  (none)")
+		}
+		fmt.Println()
+		total += size
+		count += len(kind.Resources)
+	}
+
+	fmt.Println("════════════════════════════════════════════════════════════════")
+	if count == 0 {
+		fmt.Println("Nothing left behind by deleted slots.")
+		return
+	}
+	if !remove {
+		fmt.Printf("This is a dry run. %s would be reclaimed with:\n", humanBytes(total))
+		flags := ""
+		if volumes {
+			flags += " --volumes"
+		}
+		if images {
+			flags += " --images"
+		}
+		fmt.Printf("  slot-cli clean docker%s --orphans\n", flags)
+		return
+	}
+	if !confirm(fmt.Sprintf("Remove %d item(s) (%s)?", count, humanBytes(total))) {
+		fail(exitAborted, "aborted")
+	}
+
+	var reclaimed int64
+	for _, kind := range kinds {
+		for _, r := range kind.Resources {
+			var stderr strings.Builder
+			cmd := exec.Command("docker", append(kind.Remove, firstNonEmpty(r.ID, r.Name))...)
+			cmd.Stderr = &stderr
+			if err := auditedRun("clean", r.Project, cmd); err != nil {
+				fmt.Printf("  ✗ %s: %s\n", r.Name, firstNonEmpty(strings.TrimSpace(stderr.String()), err.Error()))
+				continue
+			}
+			fmt.Printf("  ✓ Removed %s\n", r.Name)
+			reclaimed += r.Size
+		}
+	}
+	fmt.Println()
+	fmt.Println(green.Sprintf("Done! Reclaimed %s", humanBytes(reclaimed)))
+}
+
+// loadScanners returns the built-in process scanners merged with configured ones
+func loadScanners() map[string]ProcessScanner {
+	scanners := maps.Clone(procs.BuiltinScanners)
+	maps.Copy(scanners, loadConfig().Scanners)
+	return scanners
+}
+
+// scannerAttachedTo returns the project or slot a process found by s
+// belongs to, or ""
+func scannerAttachedTo(reg *Registry, s ProcessScanner, p ScannedProcess) string {
+	paths := make(map[string]string)
+	for name, project := range reg.Projects {
+		paths[name] = project.Path
+	}
+	for name, slot := range reg.Slots {
+		if project := reg.Projects[slot.Project]; project.Path != "" {
+			paths[name] = filepath.Join(filepath.Dir(project.Path), name)
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(paths)) {
+		if s.PortEnv != "" && p.Port > 0 && readEnvPort(paths[name], s.PortEnv) == p.Port {
+			return name
+		}
+		if s.PortEnv == "" && p.CWD != "" && worktree.IsWithin(p.CWD, paths[name]) {
+			return name
+		}
+	}
+	return ""
+}
+
+func readEnvPort(basePath, varName string) int {
+	subdirs := []string{"", "apps/web", "packages/ui"}
+	envFiles := []string{".env.local", ".env"}
+
+	for _, subdir := range subdirs {
+		for _, envFile := range envFiles {
+			path := filepath.Join(basePath, subdir, envFile)
+			content, err := os.ReadFile(path)
+			if err != nil {
+				continue
+			}
+			re := regexp.MustCompile(varName + `=["']?(\d+)["']?`)
+			matches := re.FindSubmatch(content)
+			if len(matches) > 1 {
+				port, _ := strconv.Atoi(string(matches[1]))
+				return port
+			}
+		}
+	}
+	return 0
+}
+
+// cmdCleanScanner lists a scanner's processes as attached or orphaned and
+// kills orphans (--orphans) or all of them (--all)
+func cmdCleanScanner(name string, s ProcessScanner, args []string) {
+	killOrphans := slices.Contains(args, "--orphans")
+	killAll := slices.Contains(args, "--all")
+	label := firstNonEmpty(s.Label, name+" processes")
+
+	fmt.Println()
+	fmt.Println("════════════════════════════════════════════════════════════════")
+	fmt.Printf("                     %s CLEANUP\n", strings.ToUpper(label))
+	fmt.Println("════════════════════════════════════════════════════════════════")
+	fmt.Println()
+
+	if _, err := regexp.Compile(s.Process); err != nil {
+		fail(exitUsage, fmt.Sprintf("scanner %s: bad process pattern: %v", name, err))
+	}
+	processes := s.Find()
+	if len(processes) == 0 {
+		fmt.Printf("No %s running.\n", label)
+		return
+	}
+
+	reg := loadRegistry()
+	var attached, orphans []ScannedProcess
+	owners := make(map[int]string)
+	for _, p := range processes {
+		if owner := scannerAttachedTo(reg, s, p); owner != "" {
+			owners[p.PID] = owner
+			attached = append(attached, p)
+		} else {
+			orphans = append(orphans, p)
+		}
+	}
+
+	fmt.Println(green.Sprintf("ATTACHED TO SLOTS (%d):", len(attached)))
+	for _, p := range attached {
+		fmt.Printf("  • %s :%d (pid %d) → %s\n", p.Project, p.Port, p.PID, owners[p.PID])
+	}
+	if len(attached) == 0 {
+		fmt.Println("  (none)")
+	}
+	fmt.Println()
+
+	fmt.Println(yellow.Sprintf("ORPHAN %s (%d):", strings.ToUpper(label), len(orphans)))
+	for _, p := range orphans {
+		fmt.Printf("  • %s :%d (pid %d)\n", p.Project, p.Port, p.PID)
+	}
+	if len(orphans) == 0 {
+		fmt.Println("  (none)")
+	}
+	fmt.Println()
+
+	fmt.Println("════════════════════════════════════════════════════════════════")
+
+	if !killOrphans && !killAll {
+		fmt.Println("This is a dry run. To kill processes:")
+		fmt.Printf("  slot-cli clean %s --orphans  (kill orphans only)\n", name)
+		fmt.Printf("  slot-cli clean %s --all      (kill all %s)\n", name, label)
+		return
+	}
+
+	toKill := orphans
+	if killAll {
+		toKill = processes
+		fmt.Printf("\n%s\n", cyan.Sprintf("Killing ALL %d %s...", len(toKill), label))
+	} else {
+		fmt.Printf("\n%s\n", cyan.Sprintf("Killing %d orphan %s...", len(toKill), label))
+	}
+
+	if len(toKill) > 0 && !confirm("Continue?") {
+		fail(exitAborted, "aborted")
+	}
+
+	skipped := 0
+	for _, p := range toKill {
+		if s.Protected(p) {
+			fmt.Printf("  ⊘ Skipped %s :%d (pid %d) — protected\n", p.Project, p.Port, p.PID)
+			skipped++
+			continue
+		}
+		if err := terminateProcess(p.PID); err == nil {
+			fmt.Printf("  ✓ Killed %s :%d (pid %d)\n", p.Project, p.Port, p.PID)
+		} else {
+			fmt.Printf("  ✗ Failed to kill %s :%d (pid %d)\n", p.Project, p.Port, p.PID)
+		}
+	}
+
+	if skipped > 0 {
+		fmt.Printf("\n%s\n", cyan.Sprintf("(%d protected processes skipped)", skipped))
+	}
+	fmt.Println()
+	fmt.Println(green.Sprint("Done!"))
+}
+
+// slotNumberFromDir extracts the slot number from a numbered slot's
+// directory name (app-3 → 3)
+func slotNumberFromDir(base string) (int, bool) {
+	m := regexp.MustCompile(`-(\d+)$`).FindStringSubmatch(base)
+	if m == nil {
+		return 0, false
+	}
+	n, err := strconv.Atoi(m[1])
+	return n, err == nil
+}
+
+// registryFix returns the registry entry verify --fix/--fix-worktree would
+// save. The directory name decides project and number (the worktree can't be
+// renamed from here, so --fix-worktree fixes those in the registry too); a
+// branch mismatch is fixed in the registry, or with fixWorktree by switching
+// the worktree to the registry's branch (switchTo)
+func registryFix(slot SlotConfig, project string, slotNum int, branch string, fixWorktree bool) (repaired SlotConfig, switchTo string) {
+	slot.Project, slot.Number = project, slotNum
+	if slot.Branch != branch && fixWorktree {
+		return slot, slot.Branch
+	}
+	slot.Branch = branch
+	return slot, ""
+}
+
+func cmdVerify(args []string) {
+	fixRegistry := slices.Contains(args, "--fix")
+	fixWorktree := slices.Contains(args, "--fix-worktree")
+	cwd, _ := os.Getwd()
+	mainRepo, project := worktree.DetectProject(cwd)
+
+	if mainRepo == "" {
+		fail(exitUsage, "not in a git repository")
+	}
+
+	// Must be run from slot (worktree)
+	if mainRepo == cwd {
+		fail(exitUsage, "must run from a slot worktree, not main")
+	}
+
+	slotPath := cwd
+
+	slotNum, ok := slotNumberFromDir(filepath.Base(slotPath))
+	if !ok {
+		fail(exitError, "could not detect slot number from directory name")
+	}
+	slotName := fmt.Sprintf("%s-%d", project, slotNum)
+
+	fmt.Println("═══════════════════════════════════════════════════════════")
+	fmt.Printf("  SLOT VERIFICATION: %s\n", slotName)
+	fmt.Println("═══════════════════════════════════════════════════════════")
+	fmt.Println()
+
+	errors := 0
+	warnings := 0
+	fixed := 0
+
+	// 1. Check worktree linkage
+	fmt.Println("┌─ Worktree Linkage")
+	gitFile := filepath.Join(slotPath, ".git")
+	if info, err := os.Stat(gitFile); err == nil && !info.IsDir() {
+		content, _ := os.ReadFile(gitFile)
+		line := strings.TrimSpace(string(content))
+		if strings.HasPrefix(line, "gitdir:") {
+			gitdir := strings.TrimSpace(strings.TrimPrefix(line, "gitdir:"))
+			if strings.Contains(gitdir, mainRepo) {
+				fmt.Printf("│  ✓ Linked to main: %s\n", mainRepo)
+			} else {
+				fmt.Printf("│  ✗ Linked to unexpected repo: %s\n", gitdir)
+				errors++
+			}
+		}
+	} else {
+		fmt.Println("│  ✗ Not a valid worktree (.git file missing)")
+		errors++
+	}
+	fmt.Println("└──────────────────────────────────────")
+	fmt.Println()
+
+	// 2. Check branch relationship
+	fmt.Println("┌─ Branch & History")
+	slotBranch := worktree.BranchName(slotPath)
+	mainBranch := worktree.BranchName(mainRepo)
+	fmt.Printf("│  Slot branch:  %s\n", slotBranch)
+	fmt.Printf("│  Main branch:  %s\n", mainBranch)
+
+	// Check if branches share history (merge base exists)
+	mergeBase, err := exec.Command("git", "-C", slotPath, "merge-base", slotBranch, mainBranch).Output()
+	if err != nil || len(mergeBase) == 0 {
+		fmt.Println("│  ✗ No common ancestor with main")
+		errors++
+	} else {
+		fmt.Printf("│  ✓ Common ancestor: %s\n", strings.TrimSpace(string(mergeBase))[:7])
+
+		// Check commits ahead/behind
+		behindOut, _ := exec.Command("git", "-C", slotPath, "rev-list", "--count", slotBranch+".."+mainBranch).Output()
+		aheadOut, _ := exec.Command("git", "-C", slotPath, "rev-list", "--count", mainBranch+".."+slotBranch).Output()
+		behind := strings.TrimSpace(string(behindOut))
+		ahead := strings.TrimSpace(string(aheadOut))
+		fmt.Printf("│  ✓ %s ahead, %s behind main\n", ahead, behind)
+
+		if behind != "0" {
+			fmt.Println("│  ⚠ Consider running 'slot-cli sync' to update")
+			warnings++
+		}
+	}
+	fmt.Println("└──────────────────────────────────────")
+	fmt.Println()
+
+	// 3. Check registry
+	fmt.Println("┌─ Registry")
+	reg := loadRegistry()
+	if slot, exists := reg.Slots[slotName]; exists {
+		fmt.Printf("│  ✓ Registry entry exists\n")
+		repaired, switchTo := registryFix(slot, project, slotNum, slotBranch, fixWorktree)
+		if slot.Project == project {
+			fmt.Printf("│  ✓ Project matches: %s\n", slot.Project)
+		} else if fixRegistry || fixWorktree {
+			fmt.Printf("│  ✓ Fixed project: registry %s → %s\n", slot.Project, project)
+			fixed++
+		} else {
+			fmt.Printf("│  ✗ Project mismatch: registry=%s, detected=%s\n", slot.Project, project)
+			errors++
+		}
+		if slot.Number == slotNum {
+			fmt.Printf("│  ✓ Slot number matches: %d\n", slot.Number)
+		} else if fixRegistry || fixWorktree {
+			fmt.Printf("│  ✓ Fixed slot number: registry %d → %d\n", slot.Number, slotNum)
+			fixed++
+		} else {
+			fmt.Printf("│  ✗ Slot number mismatch: registry=%d, detected=%d\n", slot.Number, slotNum)
+			errors++
+		}
+		switch {
+		case slot.Branch == slotBranch:
+			fmt.Printf("│  ✓ Branch matches: %s\n", slot.Branch)
+		case switchTo != "":
+			if out, err := exec.Command("git", "-C", slotPath, "switch", switchTo).CombinedOutput(); err != nil {
+				fmt.Printf("│  ✗ Could not switch the worktree to %s: %s\n", switchTo, strings.TrimSpace(string(out)))
+				errors++
+			} else {
+				fmt.Printf("│  ✓ Fixed branch: worktree %s → %s\n", slotBranch, switchTo)
+				fixed++
+			}
+		case fixRegistry:
+			fmt.Printf("│  ✓ Fixed branch: registry %s → %s\n", slot.Branch, slotBranch)
+			fixed++
+		default:
+			fmt.Printf("│  ✗ Branch mismatch: registry=%s, actual=%s\n", slot.Branch, slotBranch)
+			errors++
+		}
+		fmt.Printf("│  Created: %s\n", slot.CreatedAt)
+		if fixRegistry || fixWorktree {
+			reg.Slots[slotName] = repaired
+			saveRegistry(reg)
+		}
+	} else if fixRegistry || fixWorktree {
+		updateRegistry(slotName, project, slotNum, slotBranch)
+		fmt.Printf("│  ✓ Fixed: registered %s (branch %s)\n", slotName, slotBranch)
+		fixed++
+	} else {
+		fmt.Println("│  ⚠ No registry entry (slot may have been created manually; --fix to register it)")
+		warnings++
+	}
+	fmt.Println("└──────────────────────────────────────")
+	fmt.Println()
+
+	// 4. Check uncommitted changes
+	fmt.Println("┌─ Working Tree")
+	out, _ := exec.Command("git", "-C", slotPath, "status", "--porcelain").Output()
+	if len(out) == 0 {
+		fmt.Println("│  ✓ Clean working tree")
+	} else {
+		lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+		fmt.Printf("│  ⚠ %d uncommitted changes\n", len(lines))
+		warnings++
+	}
+	fmt.Println("└──────────────────────────────────────")
+	fmt.Println()
+
+	// Summary
+	fmt.Println("═══════════════════════════════════════════════════════════")
+	if fixed > 0 {
+		fmt.Printf("  ✓ Fixed %d mismatch(es)\n", fixed)
+	}
+	if errors == 0 && warnings == 0 {
+		fmt.Println("  ✓ VERIFIED: Slot matches parent worktree 1:1")
+	} else if errors == 0 {
+		fmt.Printf("  ✓ VERIFIED with %d warning(s)\n", warnings)
+	} else {
+		fmt.Printf("  ✗ FAILED: %d error(s), %d warning(s)\n", errors, warnings)
+		if !fixRegistry && !fixWorktree {
+			fmt.Println("  → slot-cli verify --fix to update the registry, --fix-worktree to update the worktree")
+		}
+	}
+	fmt.Println("═══════════════════════════════════════════════════════════")
+
+	if errors > 0 {
+		os.Exit(exitError)
+	}
+}
+
+func cmdFixPorts(args []string) {
+	trackedFileMode, args = parseTrackedFileMode(args)
+	report := slices.Contains(args, "--report")
+	for _, arg := range args {
+		if arg == "--dry-run" {
+			dryRunWrites = true
+		}
+	}
+
+	cwd, _ := os.Getwd()
+	mainRepo, project := worktree.DetectProject(cwd)
+
+	if mainRepo == "" {
+		fail(exitUsage, "not in a git repository")
+	}
+
+	// Must be run from slot (worktree)
+	if mainRepo == cwd {
+		fail(exitUsage, "must run from a slot worktree, not main")
+	}
+
+	slotPath := cwd
+	slotName := filepath.Base(slotPath)
+	if !report && !dryRunWrites {
+		checkLock(slotName, true)
+	}
+	slotNum := slotPortOffset(mainRepo, project, slotName, slotPath)
+	mainPorts := scanPorts(mainRepo)
+	portMap := make(map[int]int)
+	for mainPort := range mainPorts {
+		portMap[mainPort] = mainPort + slotNum
+	}
+
+	// --report only tells CI/hooks whether the slot drifted
+	if report {
+		changes := portFixChanges(slotPath, portMap, slotName)
+		if jsonOutput {
+			if changes == nil {
+				changes = []LineChange{}
+			}
+			data, _ := json.MarshalIndent(changes, "", "  ")
+			fmt.Println(string(data))
+		} else {
+			for _, c := range changes {
+				fmt.Printf("✗ %s:%d  %s → %s\n", c.File, c.Line, c.Old, c.New)
+			}
+		}
+		if len(changes) > 0 {
+			fail(exitError, fmt.Sprintf("%s: %d line(s) off the slot's ports (offset %d)", slotName, len(changes), slotNum), "Fix them with: slot-cli fix-ports")
+		}
+		if !jsonOutput {
+			fmt.Printf("✓ %s: ports match offset %d\n", slotName, slotNum)
+		}
+		return
+	}
+
+	fmt.Println("═══════════════════════════════════════════════════════════")
+	fmt.Printf("  FIX PORTS: %s (offset %d)\n", slotName, slotNum)
+	fmt.Println("═══════════════════════════════════════════════════════════")
+	fmt.Println()
+
+	// Scan main's ports
+	fmt.Println("Scanning main project ports...")
+	if len(mainPorts) == 0 {
+		fmt.Println("No ports found in main project")
+		return
+	}
+
+	// Expected slot ports
+	for _, mainPort := range slices.Sorted(maps.Keys(mainPorts)) {
+		fmt.Printf("  %s: %d → %d\n", mainPorts[mainPort], mainPort, portMap[mainPort])
+	}
+
+	fmt.Println()
+
+	if dryRunWrites {
+		changes := portFixChanges(slotPath, portMap, slotName)
+		if len(changes) == 0 {
+			fmt.Println("  ✓ All ports are correct")
+			return
+		}
+		fmt.Println("Would change:")
+		for _, c := range changes {
+			fmt.Printf("  %s:%d  %s → %s\n", c.File, c.Line, c.Old, c.New)
+		}
+		updateDockerComposeFiles(slotPath, slotName, portMap)
+		fmt.Println("\nThis is a dry run. Run without --dry-run to apply.")
+		return
+	}
+
+	// Scan current slot ports
+	fmt.Println("Checking slot ports...")
+	slotPorts := scanPorts(slotPath)
+
+	// Find mismatches
+	fixes := 0
+	for mainPort, expectedSlotPort := range portMap {
+		// Check if slot has this port at wrong value
+		for currentPort := range slotPorts {
+			if currentPort == mainPort {
+				fmt.Printf("  ✗ Found main port %d (should be %d)\n", mainPort, expectedSlotPort)
+				fixes++
+			}
+		}
+	}
+
+	if fixes == 0 {
+		// Check if ports are correct
+		allCorrect := true
+		for _, expectedSlotPort := range portMap {
+			if _, exists := slotPorts[expectedSlotPort]; !exists {
+				allCorrect = false
+				break
+			}
+		}
+		if allCorrect {
+			fmt.Println("  ✓ All ports are correct")
+			return
+		}
+	}
+
+	fmt.Println()
+	fmt.Println("Fixing ports...")
+
+	// Update all files
+	if !dryRunWrites {
+		modifySlot(slotName, func(slot *SlotConfig) { slot.PortOffset = slotNum })
+	}
+	updateSlotEnvFiles(slotPath, portMap, slotName)
+	updateConfigFiles(slotPath, portMap)
+	updateDockerComposeFiles(slotPath, slotName, portMap)
+
+	if dryRunWrites {
+		fmt.Println("\nThis is a dry run. Run without --dry-run to apply.")
+		return
+	}
+
+	fmt.Println()
+	fmt.Println("═══════════════════════════════════════════════════════════")
+	fmt.Println("  ✓ Ports fixed")
+	fmt.Println("═══════════════════════════════════════════════════════════")
+	fmt.Println()
+	fmt.Println("Note: You may need to restart docker containers:")
+	fmt.Println("  docker compose down && docker compose up -d")
+}
+
+// LineChange is one line a port rewrite would change
+type LineChange struct {
+	File string `json:"file"`
+	Line int    `json:"line"`
+	Old  string `json:"old"`
+	New  string `json:"new"`
+}
+
+// lineChanges lists the lines that differ between two versions of a file
+// (port rewrites keep lines in place; appended lines have an empty Old)
+func lineChanges(file, oldContent, newContent string) []LineChange {
+	oldLines := strings.Split(strings.TrimSuffix(oldContent, "\n"), "\n")
+	newLines := strings.Split(strings.TrimSuffix(newContent, "\n"), "\n")
+	var changes []LineChange
+	for i := range max(len(oldLines), len(newLines)) {
+		var oldLine, newLine string
+		if i < len(oldLines) {
+			oldLine = oldLines[i]
+		}
+		if i < len(newLines) {
+			newLine = newLines[i]
+		}
+		if oldLine != newLine {
+			changes = append(changes, LineChange{File: file, Line: i + 1, Old: oldLine, New: newLine})
+		}
+	}
+	return changes
+}
+
+// portFixChanges is what fix-ports would change in the slot's env files and
+// .mcp.json, line by line
+func portFixChanges(slotPath string, portMap map[int]int, slotName string) []LineChange {
+	var changes []LineChange
+	for _, path := range repoFiles(slotPath) {
+		rel, _ := filepath.Rel(slotPath, path)
+		var rewrite func(string) string
+		switch filepath.Base(path) {
+		case ".env", ".env.local":
+			rewrite = func(s string) string { return ports.ReplaceInEnv(s, portMap, slotName) }
+		case ".mcp.json":
+			rewrite = func(s string) string { return replaceLocalhostPorts(s, portMap) }
+		default:
+			continue
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		changes = append(changes, lineChanges(rel, string(content), rewrite(string(content)))...)
+	}
+	return changes
+}
+
+// slotPortOffset is the offset a slot's ports sit at above main's: the one
+// recorded at creation, else the slot number, else (named slots from before
+// offsets were recorded) derived from the slot's env or the first free one
+func slotPortOffset(mainRepo, project, slotName, slotPath string) int {
+	reg := loadRegistry()
+	if slot, ok := reg.Slots[slotName]; ok {
+		if slot.PortOffset > 0 {
+			return slot.PortOffset
+		}
+		if slot.Number > 0 {
+			return slot.Number
+		}
+	} else if m := regexp.MustCompile(`-(\d+)$`).FindStringSubmatch(slotName); len(m) > 1 {
+		n, _ := strconv.Atoi(m[1])
+		return n
+	} else {
+		fail(exitNotFound, fmt.Sprintf("slot '%s' is not registered", slotName), "Register it with: slot-cli adopt")
+	}
+
+	var deltas []int
+	for mainPort, slotPort := range slotPortMap(mainRepo, slotPath) {
+		deltas = append(deltas, slotPort-mainPort)
+	}
+	used := make(map[int]bool)
+	for name, slot := range reg.Slots {
+		if slot.Project == project && name != slotName {
+			used[max(slot.PortOffset, slot.Number)] = true
+		}
+	}
+	return deriveOffset(deltas, used)
+}
+
+// deriveOffset picks a slot's port offset: the most common shift of its env
+// ports (smallest on ties), or without any, the first offset no slot uses
+func deriveOffset(deltas []int, used map[int]bool) int {
+	counts := make(map[int]int)
+	best := 0
+	for _, d := range deltas {
+		if d <= 0 {
+			continue
+		}
+		counts[d]++
+		if counts[d] > counts[best] || (counts[d] == counts[best] && d < best) {
+			best = d
+		}
+	}
+	if best > 0 {
+		return best
+	}
+	for offset := 1; ; offset++ {
+		if !used[offset] {
+			return offset
+		}
+	}
+}
+
+// fileIndex caches one walk per root for the current invocation: new used to
+// walk the same tree once per scanner. Code that creates files calls forgetFiles.
+var (
+	fileIndexMu sync.Mutex
+	fileIndex   = map[string][]string{}
+)
+
+// indexSkipDirs are never descended into when indexing a tree (dependency
+// and build trees that only slow scans down)
+var indexSkipDirs = map[string]bool{
+	"node_modules": true, ".git": true, ".next": true,
+}
+
+// repoFiles returns the paths of all files under root, in walk order
+func repoFiles(root string) []string {
+	fileIndexMu.Lock()
+	defer fileIndexMu.Unlock()
+	if files, ok := fileIndex[root]; ok {
+		return files
+	}
+
+	var files []string
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if path != root && indexSkipDirs[d.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		files = append(files, path)
+		return nil
+	})
+	fileIndex[root] = files
+	return files
+}
+
+// forgetFiles drops the cached index of every root containing path
+func forgetFiles(path string) {
+	fileIndexMu.Lock()
+	defer fileIndexMu.Unlock()
+	for root := range fileIndex {
+		if path == root || strings.HasPrefix(path, root+string(filepath.Separator)) {
+			delete(fileIndex, root)
+		}
+	}
+}
+
+// scanFiles reads the files under root accepted by match concurrently, then
+// calls fn for each in walk order (unreadable files are skipped)
+func scanFiles(root string, match func(path string) bool, fn func(path string, content []byte)) {
+	var paths []string
+	for _, path := range repoFiles(root) {
+		if match(path) {
+			paths = append(paths, path)
+		}
+	}
+
+	contents := make([][]byte, len(paths))
+	errs := make([]error, len(paths))
+	sem := make(chan struct{}, 2*runtime.NumCPU())
+	var wg sync.WaitGroup
+	for i, path := range paths {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			contents[i], errs[i] = os.ReadFile(path)
+			<-sem
+		}()
+	}
+	wg.Wait()
+
+	for i, path := range paths {
+		if errs[i] == nil {
+			fn(path, contents[i])
+		}
+	}
+}
+
+// isComposeFile reports whether path is a docker-compose.yml/.yaml
+func isComposeFile(path string) bool {
+	name := filepath.Base(path)
+	return name == "docker-compose.yml" || name == "docker-compose.yaml"
+}
+
+// composeFileIncluded reports whether port rewrites cover a compose file
+// (those under build output or .git-like paths are left alone)
+func composeFileIncluded(root, path string) bool {
+	rel, _ := filepath.Rel(root, path)
+	for _, skip := range []string{"node_modules", ".next", "dist", ".git"} {
+		if strings.Contains(rel, skip) {
+			return false
+		}
+	}
+	return true
+}
+
+// findComposeFiles returns the docker-compose files under root
+func findComposeFiles(root string) []string {
+	var files []string
+	for _, path := range repoFiles(root) {
+		if isComposeFile(path) {
+			files = append(files, path)
+		}
+	}
+	return files
+}
+
+// scanPorts scans a directory for port configurations
+func scanPorts(dir string) map[int]string {
+	found := make(map[int]string)
+	urlPortRe := regexp.MustCompile(`localhost:(\d+)`)
+	pFlagRe := regexp.MustCompile(`-p\s+(\d+)`)
+
+	isEnv := func(baseName string) bool {
+		return strings.Contains(baseName, ".env") && !strings.Contains(baseName, ".example") && !strings.Contains(baseName, ".sample")
+	}
+	scanFiles(dir, func(path string) bool {
+		rel, _ := filepath.Rel(dir, path)
+		skipDirs := []string{"node_modules", ".next", "dist", ".git"}
+		for _, skip := range skipDirs {
+			if strings.Contains(rel, skip) {
+				return false
+			}
+		}
+
+		baseName := filepath.Base(path)
+		return isEnv(baseName) || baseName == ".mcp.json" || baseName == "package.json"
+	}, func(path string, content []byte) {
+		baseName := filepath.Base(path)
+		isEnvFile := isEnv(baseName)
+		isConfigFile := baseName == ".mcp.json" || baseName == "package.json"
+
+		for _, line := range strings.Split(string(content), "\n") {
+			if strings.HasPrefix(strings.TrimSpace(line), "#") {
+				continue
+			}
+
+			if isEnvFile {
+				if varName, port, ok := ports.FromEnvLine(line); ok {
+					if _, exists := found[port]; !exists {
+						found[port] = varName
+					}
+				}
+			}
+
+			for _, m := range urlPortRe.FindAllStringSubmatch(line, -1) {
+				if port, err := strconv.Atoi(m[1]); err == nil && port > 1000 {
+					if _, exists := found[port]; !exists {
+						found[port] = "URL"
+					}
+				}
+			}
+
+			if isConfigFile && baseName == "package.json" {
+				for _, m := range pFlagRe.FindAllStringSubmatch(line, -1) {
+					if port, err := strconv.Atoi(m[1]); err == nil && port > 1000 {
+						if _, exists := found[port]; !exists {
+							found[port] = "script"
+						}
+					}
+				}
+			}
+		}
+	})
+
+	return found
+}
+
+func cmdDBSync(args []string) {
+	tables, args := extractFlag(args, "--tables")
+	exclude, args := extractFlag(args, "--exclude")
+	reverseTarget, args := extractFlag(args, "--to")
+	confirmTarget, args := extractFlag(args, "--confirm")
+	jobs, args := extractFlag(args, "--jobs")
+	dumpOpts := dbclone.DumpOptions{Tables: splitList(tables), Exclude: splitList(exclude)}
+
+	volumeMode := false
+	for _, arg := range args {
+		switch arg {
+		case "--volume":
+			volumeMode = true
+		case "--schema-only":
+			dumpOpts.SchemaOnly = true
+		case "--to-main":
+			reverseTarget = "main"
+		}
+	}
+
+	if volumeMode && !dumpOpts.IsEmpty() {
+		fail(exitUsage, "--volume copies the whole database; it can't be combined with --schema-only/--tables/--exclude")
+	}
+
+	cwd, _ := os.Getwd()
+	mainRepo, project := worktree.DetectProject(cwd)
+
+	if mainRepo == "" {
+		fail(exitUsage, "not in a git repository")
+	}
+
+	// Check if we're in a slot (worktree)
+	if mainRepo == cwd {
+		fail(exitUsage, "already in main worktree, nothing to sync")
+	}
+
+	slotPath := cwd
+
+	dumpOpts.Jobs = loadRegistry().Projects[project].DumpJobs
+	if jobs != "" {
+		n, err := strconv.Atoi(jobs)
+		if err != nil || n < 1 {
+			fail(exitUsage, "--jobs must be a positive number")
+		}
+		dumpOpts.Jobs = n
+	}
+
+	slotName := filepath.Base(slotPath)
+	sharedPostgres := loadRegistry().Slots[slotName].SharedPostgres
+
+	if reverseTarget != "" {
+		if volumeMode {
+			fail(exitUsage, "--volume can't be combined with --to/--to-main")
+		}
+		if sharedPostgres {
+			fail(exitUsage, "--to/--to-main isn't supported for shared-postgres slots")
+		}
+		dbSyncReverse(mainRepo, project, slotPath, reverseTarget, confirmTarget, dumpOpts)
+		return
+	}
+
+	checkLock(slotName, false)
+	if !confirm(fmt.Sprintf("Replace %s's databases with copies from main?", filepath.Base(slotPath))) {
+		fail(exitAborted, "aborted")
+	}
+
+	fmt.Println("Syncing database from main worktree...")
+	fmt.Println()
+
+	synced := 0
+
+	// File-based databases listed in the project config
+	sqliteFiles := loadRegistry().Projects[project].SQLiteFiles
+	if len(sqliteFiles) > 0 {
+		fmt.Println("─── sqlite ───")
+		synced += copySQLiteFiles(mainRepo, slotPath, sqliteFiles)
+		fmt.Println()
+	}
+
+	// Find docker-compose files in slot
+	composeFiles := findComposeFiles(slotPath)
+
+	if len(composeFiles) == 0 && len(sqliteFiles) == 0 {
+		fail(exitNotFound, "no docker-compose files found")
+	}
+
+	for _, composeFile := range composeFiles {
+		composeDir := filepath.Dir(composeFile)
+		mainComposeDir := strings.Replace(composeDir, slotPath, mainRepo, 1)
+		relDir, _ := filepath.Rel(slotPath, composeDir)
+
+		fmt.Printf("─── %s ───\n", relDir)
+
+		targets := findDBTargets(composeFile, mainComposeDir)
+		if len(targets) == 0 {
+			fmt.Println("  ⚠ No databases found, skipping")
+			continue
+		}
+
+		for _, t := range targets {
+			if t.SlotPort == 0 {
+				fmt.Printf("  ⚠ No %s found in slot, skipping %s\n", t.PortVar, t.Engine)
+				continue
+			}
+
+			if t.MainPort == 0 {
+				fmt.Printf("  ⚠ No %s found in main, skipping %s\n", t.PortVar, t.Engine)
+				continue
+			}
+
+			if sharedPostgres && t.Engine == "postgres" {
+				if volumeMode || !dumpOpts.IsEmpty() {
+					fmt.Println("  ⚠ Shared postgres: only whole-database clones, skipping (drop --volume/--schema-only/--tables/--exclude)")
+					continue
+				}
+				if cloneSharedDB(mainRepo, project, slotName, t) {
+					synced++
+				}
+				continue
+			}
+
+			fmt.Printf("  [%s] Main: localhost:%d  Slot: localhost:%d\n", t.Engine, t.MainPort, t.SlotPort)
+
+			if volumeMode {
+				fmt.Println("  Copying data volume...")
+				if err := cloneDatabaseVolume(mainComposeDir, composeDir, dbclone.Engines[t.Engine].DataDir); err != nil {
+					fmt.Printf("  ✗ Failed to sync: %v\n", err)
+					continue
+				}
+				fmt.Println("  ✓ Database volume copied")
+				if !dbclone.Wait(t.DBService, t.SlotPort, 30) {
+					fmt.Println("  ⚠ Slot DB did not come back up, data was NOT anonymized")
+					continue
+				}
+				if !anonymizeAfterClone(mainRepo, t.DBService, t.SlotPort) {
+					continue
+				}
+				synced++
+				continue
+			}
+
+			// Check if main DB is running
+			if !dbclone.Ready(t.DBService, t.MainPort) {
+				fmt.Printf("  ⚠ Main %s not running on port %d, skipping\n", t.Engine, t.MainPort)
+				continue
+			}
+
+			// Check if slot DB is running, start if not
+			if !dbclone.Ready(t.DBService, t.SlotPort) {
+				fmt.Println("  Starting slot DB...")
+				startDockerCompose(composeDir, slotComposeSelection(filepath.Base(slotPath)))
+				if !dbclone.Wait(t.DBService, t.SlotPort, 30) {
+					fmt.Println("  ⚠ Could not start slot DB, skipping")
+					continue
+				}
+			}
+
+			// Clone database
+			if dumpOpts.IsEmpty() {
+				fmt.Printf("  Cloning %s...\n", t.DB)
+			} else {
+				fmt.Printf("  Cloning %s (%s)...\n", t.DB, dumpOpts)
+			}
+			if err := dbclone.Clone(t.DBService, t.MainPort, t.SlotPort, dumpOpts); err != nil {
+				fmt.Printf("  ✗ Failed to sync: %v\n", err)
+				continue
+			}
+			fmt.Println("  ✓ Database synced")
+			if !anonymizeAfterClone(mainRepo, t.DBService, t.SlotPort) {
+				continue
+			}
+			synced++
+		}
+	}
+
+	if synced > 0 && !dumpOpts.SchemaOnly {
+		runMigrations(mainRepo, slotPath, composeFiles)
+	}
+
+	fmt.Println()
+	if synced > 0 {
+		fmt.Printf("✓ Synced %d database(s) from main\n", synced)
+	} else {
+		fmt.Println("⚠ No databases were synced")
+	}
+}
+
+// detectMigrator returns the migration tool used in a directory and the
+// command that applies pending migrations. exists reports whether a path
+// relative to the directory exists; packageJSON is its package.json content.
+func detectMigrator(exists func(rel string) bool, packageJSON string) (name, command string) {
+	hasDep := func(dep string) bool {
+		return strings.Contains(packageJSON, `"`+dep+`"`)
+	}
+
+	switch {
+	case exists("prisma/schema.prisma") || exists("schema.prisma"):
+		return "prisma", "npx prisma migrate deploy"
+	case exists("drizzle.config.ts") || exists("drizzle.config.js") || exists("drizzle.config.json"):
+		return "drizzle", "npx drizzle-kit migrate"
+	case exists("knexfile.js") || exists("knexfile.ts"):
+		return "knex", "npx knex migrate:latest"
+	case hasDep("typeorm"):
+		if strings.Contains(packageJSON, `"migration:run"`) {
+			return "typeorm", "npm run migration:run"
+		}
+		return "typeorm", "npx typeorm migration:run"
+	case exists("migrations") && (exists("go.mod") || !exists("package.json")):
+		return "golang-migrate", `migrate -path migrations -database "$DATABASE_URL" up`
+	}
+	return "", ""
+}
+
+// runMigrations applies pending migrations in the slot root and each compose
+// dir after a DB clone, per the project's "migrate" setting
+func runMigrations(mainRepo, slotPath string, composeFiles []string) {
+	_, project := worktree.DetectProject(mainRepo)
+	setting := loadRegistry().Projects[project].Migrate
+	if setting == "off" {
+		return
+	}
+
+	dirs := []string{slotPath}
+	for _, f := range composeFiles {
+		if dir := filepath.Dir(f); dir != slotPath {
+			dirs = append(dirs, dir)
+		}
+	}
+
+	for _, dir := range dirs {
+		name, command := "custom", setting
+		if command == "" {
+			packageJSON, _ := os.ReadFile(filepath.Join(dir, "package.json"))
+			name, command = detectMigrator(func(rel string) bool {
+				return fileExists(filepath.Join(dir, rel))
+			}, string(packageJSON))
+		}
+		if command == "" {
+			continue
+		}
+
+		relDir, _ := filepath.Rel(slotPath, dir)
+		fmt.Printf("\nRunning %s migrations in %s...\n", name, relDir)
+
+		var env []string
+		for _, envFile := range []string{".env", ".env.local"} {
+			content, _ := os.ReadFile(filepath.Join(dir, envFile))
+			if url := parseEnvVarString(string(content), "DATABASE_URL"); url != "" {
+				env = append(env, "DATABASE_URL="+url)
+			}
+		}
+
+		cmd := shellCommand(command)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), env...)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			fmt.Printf("  ✗ Migrations failed: %v\n", err)
+		} else {
+			fmt.Println("  ✓ Migrations applied")
+		}
+
+		// A custom command is project-wide; run it once from the root
+		if setting != "" {
+			return
+		}
+	}
+}
+
+// reverseSyncTarget resolves db-sync --to's target: "main", or a slot given
+// by number, name or full slot name
+func reverseSyncTarget(mainRepo, project, target string) (name, path string) {
+	if target == "main" {
+		return "main", mainRepo
+	}
+	name = project + "-" + target
+	if strings.HasPrefix(target, project+"-") {
+		name = target
+	}
+	return name, filepath.Join(filepath.Dir(mainRepo), name)
+}
+
+// reverseSyncConfirmed reports whether flags already confirm overwriting
+// target: --confirm=<target>, or --yes when the target is another slot.
+// Main's databases always need their name, typed or passed to --confirm.
+func reverseSyncConfirmed(targetName, confirmFlag string, yes bool) bool {
+	return confirmFlag == targetName || (yes && targetName != "main")
+}
+
+// dbSyncReverse pushes the current slot's databases into main or another
+// slot. The target is dumped to ~/.config/slots/backups first, and the user
+// must type the target name to confirm unless reverseSyncConfirmed.
+func dbSyncReverse(mainRepo, project, slotPath, target, confirmFlag string, opts dbclone.DumpOptions) {
+	slotName := filepath.Base(slotPath)
+
+	targetName, targetPath := reverseSyncTarget(mainRepo, project, target)
+	if confirmFlag != "" && confirmFlag != targetName {
+		fail(exitUsage, fmt.Sprintf("--confirm=%s doesn't match the target %s", confirmFlag, targetName))
+	}
+	if target != "main" {
+		if _, err := os.Stat(targetPath); os.IsNotExist(err) {
+			fail(exitNotFound, fmt.Sprintf("slot '%s' not found", targetName))
+		}
+		checkLock(targetName, false)
+	}
+	if targetPath == slotPath {
+		fail(exitUsage, "source and target are the same slot")
+	}
+
+	// Collect targets: SlotPort is this slot (source), MainPort is the target
+	composeFiles := findComposeFiles(slotPath)
+
+	type pushTarget struct {
+		dbclone.Target
+		relDir string
+	}
+	var pushes []pushTarget
+	for _, composeFile := range composeFiles {
+		composeDir := filepath.Dir(composeFile)
+		targetComposeDir := strings.Replace(composeDir, slotPath, targetPath, 1)
+		relDir, _ := filepath.Rel(slotPath, composeDir)
+		for _, t := range findDBTargets(composeFile, targetComposeDir) {
+			if t.SlotPort == 0 || t.MainPort == 0 {
+				fmt.Printf("⚠ Skipping %s in %s: no %s\n", t.Engine, relDir, t.PortVar)
+				continue
+			}
+			pushes = append(pushes, pushTarget{t, relDir})
+		}
+	}
+	if len(pushes) == 0 {
+		fail(exitNotFound, "no databases found to push")
+	}
+
+	fmt.Println("═══════════════════════════════════════════════════════════")
+	fmt.Printf("  REVERSE DB SYNC: %s → %s\n", slotName, targetName)
+	fmt.Println("═══════════════════════════════════════════════════════════")
+	for _, p := range pushes {
+		fmt.Printf("  [%s] %s/%s  localhost:%d → localhost:%d\n", p.Engine, p.relDir, p.DB, p.SlotPort, p.MainPort)
+	}
+	fmt.Println()
+	fmt.Printf("⚠ This OVERWRITES the databases in %s.\n", targetName)
+
+	if !reverseSyncConfirmed(targetName, confirmFlag, assumeYes) {
+		fmt.Printf("Type '%s' to confirm: ", targetName)
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if strings.TrimSpace(answer) != targetName {
+			fail(exitAborted, "aborted", fmt.Sprintf("Without a terminal, pass --confirm=%s", targetName))
+		}
+	}
+	fmt.Println()
+
+	backupDir := filepath.Join(filepath.Dir(registryPath), "backups")
+	os.MkdirAll(backupDir, 0755)
+	stamp := time.Now().Format("20060102-150405")
+
+	pushed := 0
+	for _, p := range pushes {
+		fmt.Printf("─── %s [%s] ───\n", p.relDir, p.Engine)
+
+		// Safety dump of the target before overwriting it
+		backupFile := filepath.Join(backupDir, fmt.Sprintf("%s-%s-%s-%s.dump", targetName, p.Engine, p.DB, stamp))
+		fmt.Printf("  Backing up target and pushing %s...\n", p.DB)
+		if err := dbclone.Push(p.Target, backupFile, opts); errors.Is(err, dbclone.ErrNotRunning) {
+			fmt.Printf("  ⚠ %v, skipping\n", err)
+			continue
+		} else if err != nil {
+			fmt.Printf("  ✗ %v\n", err)
+			continue
+		}
+		fmt.Printf("  ✓ Database pushed (backup: %s)\n", backupFile)
+		pushed++
+	}
+
+	fmt.Println()
+	if pushed > 0 {
+		fmt.Printf("✓ Pushed %d database(s) from %s to %s\n", pushed, slotName, targetName)
+	} else {
+		fmt.Println("⚠ No databases were pushed")
+	}
+}
+
+const (
+	slotDomainSuffix = "slot.test"
+	hostsBlockBegin  = "# BEGIN slot-cli"
+	hostsBlockEnd    = "# END slot-cli"
+)
+
+var (
+	hostsFilePath   = defaultHostsFile()
+	dnsmasqConfPath = filepath.Join(homeDir(), ".config", "slots", "dnsmasq.conf")
+)
+
+func defaultHostsFile() string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(os.Getenv("SystemRoot"), "System32", "drivers", "etc", "hosts")
+	}
+	return "/etc/hosts"
+}
+
+// slotDomain returns the local domain for a slot, e.g. exceder-1.slot.test
+func slotDomain(slotName string) string {
+	return ports.DockerName(slotName) + "." + slotDomainSuffix
+}
+
+// registeredSlotDomains returns the sorted domains for every slot in the registry.
+func registeredSlotDomains(reg *Registry) []string {
+	var domains []string
+	for name := range reg.Slots {
+		domains = append(domains, slotDomain(name))
+	}
+	sort.Strings(domains)
+	return domains
+}
+
+// renderHostsBlock replaces (or appends) the slot-cli managed block in a hosts
+// file. An empty domain list removes the block entirely.
+func renderHostsBlock(content string, domains []string) string {
+	var kept []string
+	inBlock := false
+	for _, line := range strings.Split(content, "\n") {
+		switch strings.TrimSpace(line) {
+		case hostsBlockBegin:
+			inBlock = true
+			continue
+		case hostsBlockEnd:
+			inBlock = false
+			continue
+		}
+		if !inBlock {
+			kept = append(kept, line)
+		}
+	}
+
+	newContent := strings.TrimRight(strings.Join(kept, "\n"), "\n")
+	if len(domains) == 0 {
+		return newContent + "\n"
+	}
+
+	lines := []string{hostsBlockBegin}
+	for _, d := range domains {
+		lines = append(lines, "127.0.0.1 "+d)
+	}
+	lines = append(lines, hostsBlockEnd)
+
+	if newContent != "" {
+		newContent += "\n\n"
+	}
+	return newContent + strings.Join(lines, "\n") + "\n"
+}
+
+// renderDnsmasqConf generates a dnsmasq config resolving each slot domain to localhost.
+func renderDnsmasqConf(domains []string) string {
+	lines := []string{"# Managed by slot-cli — do not edit"}
+	for _, d := range domains {
+		lines = append(lines, fmt.Sprintf("address=/%s/127.0.0.1", d))
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// writeSystemFile writes a file, falling back to sudo tee when not writable.
+// Without a terminal sudo can't ask for a password, so it isn't tried.
+func writeSystemFile(path, content string) error {
+	err := os.WriteFile(path, []byte(content), 0644)
+	if err == nil {
+		return nil
+	}
+	if !isTerminal(os.Stdin) {
+		return fmt.Errorf("%w (not retrying with sudo without a terminal; run slot-cli dns sync from one)", err)
+	}
+	cmd := exec.Command("sudo", "tee", path)
+	cmd.Stdin = strings.NewReader(content)
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// printLineDiff prints removed/added lines between two file contents.
+func printLineDiff(oldContent, newContent string) int {
+	oldLines := make(map[string]bool)
+	for _, l := range strings.Split(oldContent, "\n") {
+		oldLines[l] = true
+	}
+	newLines := make(map[string]bool)
+	for _, l := range strings.Split(newContent, "\n") {
+		newLines[l] = true
+	}
+
+	changes := 0
+	for _, l := range strings.Split(oldContent, "\n") {
+		if l != "" && !newLines[l] {
+			fmt.Printf("  - %s\n", l)
+			changes++
+		}
+	}
+	for _, l := range strings.Split(newContent, "\n") {
+		if l != "" && !oldLines[l] {
+			fmt.Printf("  + %s\n", l)
+			changes++
+		}
+	}
+	return changes
+}
+
+// applySlotDNS rewrites the managed hosts block (or dnsmasq config) for the
+// given domains. With dryRun, only the changes are printed.
+func applySlotDNS(domains []string, useDnsmasq, dryRun bool) error {
+	path := hostsFilePath
+	if useDnsmasq {
+		path = dnsmasqConfPath
+	}
+
+	oldContent := ""
+	if content, err := os.ReadFile(path); err == nil {
+		oldContent = string(content)
+	}
+
+	var newContent string
+	if useDnsmasq {
+		newContent = renderDnsmasqConf(domains)
+	} else {
+		newContent = renderHostsBlock(oldContent, domains)
+	}
+
+	if newContent == oldContent {
+		fmt.Printf("✓ %s already up to date\n", path)
+		return nil
+	}
+
+	fmt.Printf("Changes to %s:\n", path)
+	printLineDiff(oldContent, newContent)
+
+	if dryRun {
+		fmt.Println("\nThis is a dry run. Run without --dry-run to apply.")
+		return nil
+	}
+
+	if useDnsmasq {
+		os.MkdirAll(filepath.Dir(path), 0755)
+	}
+	if err := writeSystemFile(path, newContent); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	fmt.Printf("✓ Updated %s\n", path)
+	if useDnsmasq {
+		fmt.Println("  Restart dnsmasq to apply: sudo brew services restart dnsmasq")
+	}
+	return nil
+}
+
+// slotDNSEnabled reports which DNS backends the user opted into with
+// `slot-cli dns sync`; a shared bundle can't turn them on
+func slotDNSEnabled() (hosts, dnsmasq bool) {
+	dns := readConfigFile(configPath()).DNS
+	return slices.Contains(dns, "hosts"), slices.Contains(dns, "dnsmasq")
+}
+
+// setSlotDNS records a DNS backend as opted into (dns sync) or out of (dns remove)
+func setSlotDNS(backend string, on bool) {
+	local := readConfigFile(configPath())
+	local.DNS = slices.DeleteFunc(local.DNS, func(b string) bool { return b == backend })
+	if on {
+		local.DNS = append(local.DNS, backend)
+	}
+	saveLocalConfig(local)
+}
+
+// refreshSlotDNS re-syncs enabled DNS backends after a slot is created or deleted.
+func refreshSlotDNS() {
+	hosts, dnsmasq := slotDNSEnabled()
+	if !hosts && !dnsmasq {
+		return
+	}
+	domains := registeredSlotDomains(loadRegistry())
+	fmt.Println("\nUpdating slot domains...")
+	if hosts {
+		if err := applySlotDNS(domains, false, false); err != nil {
+			fmt.Printf("  ⚠ %v\n", err)
+		}
+	}
+	if dnsmasq {
+		if err := applySlotDNS(domains, true, false); err != nil {
+			fmt.Printf("  ⚠ %v\n", err)
+		}
+	}
+}
+
+// WatchRow is one slot line in `slot-cli watch`
+type WatchRow struct {
+	Slot       string
+	Branch     string
+	Locked     bool
+	Exists     bool
+	Summary    string   // description, ticket and assignee
+	Agents     []string // e.g. "claude 1h20m"
+	Ports      []string // e.g. "SLOT_PORT:3001●"
+	Containers int
+}
+
+// buildWatchRows joins registry slots with running agents and containers.
+// up reports whether a port is accepting connections.
+func buildWatchRows(reg *Registry, agents []AgentProcess, containers []DockerProcess, up func(int) bool) []WatchRow {
+	var rows []WatchRow
+	for name := range reg.Slots {
+		st := slotStatus(reg, name)
+		row := WatchRow{Slot: name, Branch: st.Branch, Locked: st.LockActive(time.Now()), Exists: st.Exists, Summary: slotSummary(st.SlotConfig)}
+
+		for _, a := range agents {
+			if a.CWD != "" && worktree.IsWithin(a.CWD, st.Path) {
+				row.Agents = append(row.Agents, a.Agent+" "+a.Runtime)
+			}
+		}
+
+		dockerName := ports.DockerName(name)
+		for _, c := range containers {
+			if strings.HasPrefix(c.Name, dockerName+"-") || c.Name == dockerName {
+				row.Containers++
+			}
+		}
+
+		var vars []string
+		for v := range st.Ports {
+			vars = append(vars, v)
+		}
+		sort.Strings(vars)
+		for _, v := range vars {
+			mark := "○"
+			if port, err := strconv.Atoi(st.Ports[v]); err == nil && up(port) {
+				mark = "●"
+			}
+			label := strings.TrimSuffix(strings.TrimPrefix(v, "SLOT_"), "_PORT") // SLOT_DB_PORT → DB
+			row.Ports = append(row.Ports, fmt.Sprintf("%s:%s%s", label, st.Ports[v], mark))
+		}
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Slot < rows[j].Slot })
+	return rows
+}
+
+// renderWatch formats the status table
+func renderWatch(rows []WatchRow) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-24s %-20s %-18s %-8s %s\n", "SLOT", "BRANCH", "AGENT", "DOCKER", "PORTS (● listening)")
+	for _, r := range rows {
+		slot := r.Slot
+		if r.Locked {
+			slot += " 🔒"
+		}
+		if !r.Exists {
+			slot += " ✗"
+		}
+		agent := "-"
+		if len(r.Agents) > 0 {
+			agent = strings.Join(r.Agents, ", ")
+		}
+		docker := "-"
+		if r.Containers > 0 {
+			docker = strconv.Itoa(r.Containers)
+		}
+		fmt.Fprintf(&b, "%-24s %-20s %-18s %-8s %s\n", truncate(slot, 24), truncate(r.Branch, 20), truncate(agent, 18), docker, strings.Join(r.Ports, " "))
+		if r.Summary != "" {
+			fmt.Fprintf(&b, "  ↳ %s\n", truncate(r.Summary, 76))
+		}
+	}
+	return b.String()
+}
+
+func truncate(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n-1]) + "…"
+	}
+	return s
+}
+
+func cmdWatch(args []string) {
+	intervalFlag, args := extractFlag(args, "--interval")
+	groupFlag, args := extractFlag(args, "--group")
+	once := false
+	for _, arg := range args {
+		if arg == "--once" {
+			once = true
+		}
+	}
+	interval := 2 * time.Second
+	if intervalFlag != "" {
+		d, err := time.ParseDuration(intervalFlag)
+		if err != nil || d < 500*time.Millisecond {
+			fail(exitUsage, "--interval must be a duration of at least 500ms (e.g. 2s)")
+		}
+		interval = d
+	}
+
+	// Redraw in place on a terminal; piped output gets one snapshot after
+	// another, separated by a blank line
+	redraw := isTerminal(os.Stdout)
+	for tick := 0; ; tick++ {
+		reg := scopeToGroup(loadRegistry(), groupFlag)
+		agents := getAgentProcesses()
+		if groupFlag != "" {
+			agents = agentsIn(reg, agents)
+		}
+		containers := getDockerProcesses()
+		rows := buildWatchRows(reg, agents, containers, ports.Listening)
+
+		attached := 0
+		for _, r := range rows {
+			attached += r.Containers
+		}
+
+		if !once {
+			if redraw {
+				fmt.Print("\033[H\033[2J")
+			} else if tick > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("slot-cli watch — %s (every %s, Ctrl-C to quit)\n\n", time.Now().Format("15:04:05"), interval)
+		}
+		fmt.Print(renderWatch(rows))
+		fmt.Printf("\n%d slots · %d agents · %d containers (%d not attached to a slot)\n",
+			len(rows), len(agents), len(containers), len(containers)-attached)
+
+		if once {
+			return
+		}
+		time.Sleep(interval)
+	}
+}
+
+// DaemonFinding is one hygiene problem spotted by `slot-cli daemon`
+type DaemonFinding struct {
+	Kind    string `json:"kind"` // orphan, expired, stale, port, idle
+	Slot    string `json:"slot"`
+	Message string `json:"message"`
+}
+
+// DaemonStatus is the daemon's last scan, kept in ~/.config/slots/daemon.json
+type DaemonStatus struct {
+	UpdatedAt string          `json:"updated_at"`
+	Findings  []DaemonFinding `json:"findings"`
+}
+
+func daemonStatusPath() string {
+	return filepath.Join(filepath.Dir(registryPath), "daemon.json")
+}
+
+// agentSample is an agent's CPU time at the last tick that changed it
+type agentSample struct {
+	CPU   string
+	Since time.Time
+}
+
+// trackAgentCPU carries forward when each agent's CPU time last moved; an
+// agent whose CPU time stands still is waiting, not working
+func trackAgentCPU(prev map[int]agentSample, cpu map[int]string, now time.Time) map[int]agentSample {
+	next := make(map[int]agentSample, len(cpu))
+	for pid, t := range cpu {
+		if p, ok := prev[pid]; ok && p.CPU == t {
+			next[pid] = p
+		} else {
+			next[pid] = agentSample{CPU: t, Since: now}
+		}
+	}
+	return next
+}
+
+// portCollisions finds ports claimed by more than one slot (or by a slot and
+// main), given each slot's SLOT_*_PORT variables
+func portCollisions(slotPorts map[string]map[string]string) []DaemonFinding {
+	owners := make(map[string][]string)
+	for slot, vars := range slotPorts {
+		for _, port := range vars {
+			if !slices.Contains(owners[port], slot) {
+				owners[port] = append(owners[port], slot)
+			}
+		}
+	}
+	var findings []DaemonFinding
+	for port, slots := range owners {
+		if len(slots) > 1 {
+			sort.Strings(slots)
+			findings = append(findings, DaemonFinding{Kind: "port", Slot: slots[0],
+				Message: fmt.Sprintf("port %s is used by %s", port, strings.Join(slots, ", "))})
+		}
+	}
+	return findings
+}
+
+// newFindings returns the findings in cur that weren't in prev
+func newFindings(prev, cur []DaemonFinding) []DaemonFinding {
+	var fresh []DaemonFinding
+	for _, f := range cur {
+		if !slices.Contains(prev, f) {
+			fresh = append(fresh, f)
+		}
+	}
+	return fresh
+}
+
+// scanSlotHygiene runs the daemon checks once: orphaned and expired registry
+// entries, merged slots nobody works in, port collisions and idle agents
+func scanSlotHygiene(reg *Registry, agents []AgentProcess, activity map[int]agentSample, idleAfter time.Duration, now time.Time) []DaemonFinding {
+	var findings []DaemonFinding
+	slotPorts := make(map[string]map[string]string)
+	for project, cfg := range reg.Projects {
+		content, _ := os.ReadFile(filepath.Join(cfg.Path, ".env"))
+		if vars := ports.EnvVars(string(content)); len(vars) > 0 {
+			slotPorts[project+" (main)"] = vars
+		}
+	}
+
+	names := slices.Sorted(maps.Keys(reg.Slots))
+	for _, name := range names {
+		slot := reg.Slots[name]
+		st := slotStatus(reg, name)
+		if !st.Exists {
+			findings = append(findings, DaemonFinding{Kind: "orphan", Slot: name, Message: "registry entry without a directory (slot-cli clean --do)"})
+			continue
+		}
+		if len(st.Ports) > 0 {
+			slotPorts[name] = st.Ports
+		}
+		if slot.LockActive(now) {
+			continue
+		}
+
+		working := false
+		for _, a := range agents {
+			working = working || worktree.IsWithin(a.CWD, st.Path)
+		}
+		dirty, _ := exec.Command("git", "-C", st.Path, "status", "--porcelain").Output()
+		if len(bytes.TrimSpace(dirty)) > 0 || working {
+			continue
+		}
+		mainRepo := reg.Projects[slot.Project].Path
+		if slot.Expired(now) {
+			findings = append(findings, DaemonFinding{Kind: "expired", Slot: name, Message: "TTL ran out " + slot.ExpiresAt + " (slot-cli clean --expired --do)"})
+		} else if worktree.IsMerged(st.Path, mainRepo) {
+			findings = append(findings, DaemonFinding{Kind: "stale", Slot: name, Message: "clean, merged into main and no agent running (slot-cli clean --do)"})
+		}
+	}
+	findings = append(findings, portCollisions(slotPorts)...)
+
+	for _, a := range agents {
+		sample, ok := activity[a.PID]
+		if !ok || now.Sub(sample.Since) < idleAfter {
+			continue
+		}
+		slot := filepath.Base(a.CWD)
+		for _, name := range names {
+			if st := slotStatus(reg, name); worktree.IsWithin(a.CWD, st.Path) {
+				slot = name
+			}
+		}
+		findings = append(findings, DaemonFinding{Kind: "idle", Slot: slot,
+			Message: fmt.Sprintf("%s (pid %d) idle for over %s", a.Agent, a.PID, idleAfter)})
+	}
+	return findings
+}
+
+// agentCPUTimes reads each agent's cumulative CPU time from ps
+func agentCPUTimes(agents []AgentProcess) map[int]string {
+	cpu := make(map[int]string)
+	for _, a := range agents {
+		if out, err := exec.Command("ps", "-p", strconv.Itoa(a.PID), "-o", "time=").Output(); err == nil {
+			cpu[a.PID] = strings.TrimSpace(string(out))
+		}
+	}
+	return cpu
+}
+
+// notifyCandidates lists desktop notification commands for a platform
+func notifyCandidates(goos, title, message string) [][]string {
+	switch goos {
+	case "darwin":
+		return [][]string{{"osascript", "-e", fmt.Sprintf("display notification %q with title %q", message, title)}}
+	case "windows":
+		return nil
+	}
+	return [][]string{{"notify-send", title, message}}
+}
+
+// notifyDesktop shows a notification with the first available tool
+func notifyDesktop(title, message string) error {
+	for _, c := range notifyCandidates(runtime.GOOS, title, message) {
+		if _, err := exec.LookPath(c[0]); err == nil {
+			return exec.Command(c[0], c[1:]...).Run()
+		}
+	}
+	return fmt.Errorf("no notification tool found")
+}
+
+func cmdDaemon(args []string) {
+	if len(args) > 0 && args[0] == "status" {
+		cmdDaemonStatus()
+		return
+	}
+	intervalFlag, args := extractFlag(args, "--interval")
+	idleFlag, args := extractFlag(args, "--idle")
+	once := slices.Contains(args, "--once")
+	notify := slices.Contains(args, "--notify")
+
+	interval := 15 * time.Minute
+	if intervalFlag != "" {
+		d, err := time.ParseDuration(intervalFlag)
+		if err != nil || d < 10*time.Second {
+			fail(exitUsage, "--interval must be a duration of at least 10s (e.g. 15m)")
+		}
+		interval = d
+	}
+	idleAfter := 30 * time.Minute
+	if idleFlag != "" {
+		d, err := time.ParseDuration(idleFlag)
+		if err != nil || d <= 0 {
+			fail(exitUsage, "--idle must be a duration (e.g. 30m)")
+		}
+		idleAfter = d
+	}
+
+	if !once {
+		fmt.Printf("slot-cli daemon: scanning every %s, status in %s (Ctrl-C to stop)\n", interval, daemonStatusPath())
+	}
+	var prev []DaemonFinding
+	if data, err := os.ReadFile(daemonStatusPath()); err == nil {
+		var last DaemonStatus
+		if json.Unmarshal(data, &last) == nil {
+			prev = last.Findings
+		}
+	}
+	activity := map[int]agentSample{}
+	for {
+		now := time.Now()
+		agents := getAgentProcesses()
+		activity = trackAgentCPU(activity, agentCPUTimes(agents), now)
+		findings := scanSlotHygiene(loadRegistry(), agents, activity, idleAfter, now)
+
+		status := DaemonStatus{UpdatedAt: now.Format(time.RFC3339), Findings: findings}
+		if status.Findings == nil {
+			status.Findings = []DaemonFinding{}
+		}
+		data, _ := json.MarshalIndent(status, "", "  ")
+		if err := os.WriteFile(daemonStatusPath(), data, 0644); err != nil {
+			fmt.Printf("⚠ Could not write status: %v\n", err)
+		}
+
+		fresh := newFindings(prev, findings)
+		fmt.Printf("[%s] %d finding(s), %d new\n", now.Format("15:04:05"), len(findings), len(fresh))
+		for _, f := range fresh {
+			fmt.Printf("  ⚠ %-8s %s: %s\n", f.Kind, f.Slot, f.Message)
+			if notify {
+				if err := notifyDesktop("slot-cli: "+f.Slot, f.Message); err != nil {
+					fmt.Printf("  ⚠ Notification failed: %v\n", err)
+					notify = false
+				}
+			}
+		}
+		prev = findings
+
+		if once {
+			return
+		}
+		time.Sleep(interval)
+	}
+}
+
+// cmdDaemonStatus prints the daemon's last findings
+func cmdDaemonStatus() {
+	data, err := os.ReadFile(daemonStatusPath())
+	if err != nil {
+		fail(exitNotFound, "no daemon status yet", "Start it with: slot-cli daemon (or run one scan with --once)")
+	}
+	if jsonOutput {
+		fmt.Println(string(data))
+		return
+	}
+	var status DaemonStatus
+	if err := json.Unmarshal(data, &status); err != nil {
+		fail(exitError, fmt.Sprintf("invalid %s: %v", daemonStatusPath(), err))
+	}
+	fmt.Printf("Last scan: %s\n", status.UpdatedAt)
+	if len(status.Findings) == 0 {
+		fmt.Println("✓ No findings")
+		return
+	}
+	for _, f := range status.Findings {
+		fmt.Printf("  ⚠ %-8s %-24s %s\n", f.Kind, f.Slot, f.Message)
+	}
+}
+
+// SlotStatus is a slot as reported by the REST API
+type SlotStatus struct {
+	SlotConfig
+	Name   string            `json:"name"`
+	Path   string            `json:"path"`
+	Exists bool              `json:"exists"`
+	URL    string            `json:"url,omitempty"`
+	Ports  map[string]string `json:"ports,omitempty"`
+}
+
+// NewSlotRequest is the body of POST /api/slots
+type NewSlotRequest struct {
+	Project   string   `json:"project"`
+	Slot      string   `json:"slot,omitempty"` // number or name; empty = next number
+	Tmux      bool     `json:"tmux,omitempty"`
+	WithRedis bool     `json:"with_redis,omitempty"`
+	Services  []string `json:"services,omitempty"`
+	Profiles  []string `json:"profiles,omitempty"`
+}
+
+// CommandResult is the outcome of a CLI command run on behalf of the API
+type CommandResult struct {
+	OK       bool      `json:"ok"`
+	ExitCode int       `json:"exit_code"`
+	Output   string    `json:"output"`
+	Error    *APIError `json:"error,omitempty"`
+}
+
+// apiMu serializes mutating API calls; the registry has no file locking
+var apiMu sync.Mutex
+
+func slotStatus(reg *Registry, slotName string) SlotStatus {
+	slot := reg.Slots[slotName]
+	st := SlotStatus{
+		SlotConfig: slot,
+		Name:       slotName,
+		Path:       filepath.Join(filepath.Dir(reg.Projects[slot.Project].Path), slotName),
+	}
+	if _, err := os.Stat(st.Path); err == nil {
+		st.Exists = true
+		st.URL = slotURL(slotName, st.Path)
+		content, _ := os.ReadFile(filepath.Join(st.Path, ".env"))
+		if ports := ports.EnvVars(string(content)); len(ports) > 0 {
+			st.Ports = ports
+		}
+	}
+	return st
+}
+
+// runSelf runs slot-cli itself in dir with --json, so commands keep a single
+// implementation and their os.Exit can't take the server down. Prompts are
+// answered "no" (stdin is not a terminal) unless args include --yes/--force.
+func runSelf(dir string, args ...string) CommandResult {
+	exe, err := os.Executable()
+	if err != nil {
+		return CommandResult{ExitCode: exitError, Output: err.Error()}
+	}
+	cmd := exec.Command(exe, append([]string{"--json"}, args...)...)
+	cmd.Dir = dir
+	cmd.Stdin = strings.NewReader("")
+	out, err := cmd.CombinedOutput()
+	code := 0
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		code = exitErr.ExitCode()
+	} else if err != nil {
+		code = exitError
+	}
+	return parseCommandResult(string(out), code)
+}
+
+// parseCommandResult pulls the --json error envelope (if any) out of a
+// command's output
+func parseCommandResult(output string, code int) CommandResult {
+	res := CommandResult{OK: code == 0, ExitCode: code, Output: output}
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	for i := len(lines) - 1; i >= 0 && code != 0; i-- {
+		if !strings.HasPrefix(lines[i], `{"error":`) {
+			continue
+		}
+		var env ErrorEnvelope
+		if json.Unmarshal([]byte(lines[i]), &env) == nil {
+			res.Error = &env.Error
+			res.Output = strings.Join(lines[:i], "\n")
+		}
+		break
+	}
+	return res
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeAPIError(w http.ResponseWriter, status, code int, message string) {
+	writeJSON(w, status, newErrorEnvelope(code, message, nil))
+}
+
+// commandStatus maps a command's exit code to an HTTP status
+func commandStatus(res CommandResult) int {
+	switch res.ExitCode {
+	case exitOK:
+		return http.StatusOK
+	case exitUsage:
+		return http.StatusBadRequest
+	case exitNotFound:
+		return http.StatusNotFound
+	case exitDirty, exitLocked, exitConflict, exitExists, exitAborted, exitLimit:
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// apiAuthorized checks the bearer token; the API never runs without one
+func apiAuthorized(header, token string) bool {
+	return token != "" && subtle.ConstantTimeCompare([]byte(header), []byte("Bearer "+token)) == 1
+}
+
+// apiRequestError rejects what a web page can send to a local server: a Host
+// other than loopback or the --host it listens on (DNS rebinding), any Origin
+// (browsers set it on cross-site requests), and POSTs that aren't JSON (a
+// text/plain POST needs no CORS preflight). Returns "" when the request is fine.
+func apiRequestError(r *http.Request, listenHost string) string {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(r.Host); err == nil {
+		host = h
+	}
+	host = strings.Trim(host, "[]")
+	ip := net.ParseIP(host)
+	if host != "localhost" && (ip == nil || !ip.IsLoopback()) && (host != listenHost || ip != nil && ip.IsUnspecified()) {
+		return fmt.Sprintf("host '%s' not allowed", r.Host)
+	}
+	if r.Header.Get("Origin") != "" {
+		return "cross-origin requests are not allowed"
+	}
+	if r.Method == http.MethodPost {
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+			return "POST requests need Content-Type: application/json"
+		}
+	}
+	return ""
+}
+
+// apiSlotRe is what a slot number or name passed to the API may look like, so
+// it can't be read as a flag when handed to the CLI
+var apiSlotRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// apiMaxBody caps request bodies; the largest is a NewSlotRequest
+const apiMaxBody = 64 << 10
+
+func apiHandler(token, listenHost string) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /api/health", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
+	})
+
+	mux.HandleFunc("GET /api/registry", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, loadRegistry())
+	})
+
+	mux.HandleFunc("GET /api/projects", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, loadRegistry().Projects)
+	})
+
+	mux.HandleFunc("GET /api/slots", func(w http.ResponseWriter, r *http.Request) {
+		reg := loadRegistry()
+		project := r.URL.Query().Get("project")
+		slots := []SlotStatus{}
+		for name, slot := range reg.Slots {
+			if project == "" || slot.Project == project {
+				slots = append(slots, slotStatus(reg, name))
+			}
+		}
+		sort.Slice(slots, func(i, j int) bool { return slots[i].Name < slots[j].Name })
+		writeJSON(w, http.StatusOK, slots)
+	})
+
+	mux.HandleFunc("GET /api/slots/{name}", func(w http.ResponseWriter, r *http.Request) {
+		reg := loadRegistry()
+		name := r.PathValue("name")
+		if _, ok := reg.Slots[name]; !ok {
+			writeAPIError(w, http.StatusNotFound, exitNotFound, fmt.Sprintf("slot '%s' not found", name))
+			return
+		}
+		writeJSON(w, http.StatusOK, slotStatus(reg, name))
+	})
+
+	mux.HandleFunc("POST /api/slots", func(w http.ResponseWriter, r *http.Request) {
+		var req NewSlotRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeAPIError(w, http.StatusBadRequest, exitUsage, "invalid JSON body")
+			return
+		}
+		for _, value := range append([]string{req.Slot}, append(req.Services, req.Profiles...)...) {
+			if value != "" && !apiSlotRe.MatchString(value) {
+				writeAPIError(w, http.StatusBadRequest, exitUsage, fmt.Sprintf("invalid slot, service or profile '%s'", value))
+				return
+			}
+		}
+		proj, ok := loadRegistry().Projects[req.Project]
+		if !ok {
+			writeAPIError(w, http.StatusNotFound, exitNotFound, fmt.Sprintf("project '%s' is not registered", req.Project))
+			return
+		}
+
+		args := []string{"new", "--no-clipboard"}
+		if req.Slot != "" {
+			args = append(args, req.Slot)
+		}
+		if req.Tmux {
+			args = append(args, "--tmux")
+		}
+		if req.WithRedis {
+			args = append(args, "--with-redis")
+		}
+		if len(req.Services) > 0 {
+			args = append(args, "--services="+strings.Join(req.Services, ","))
+		}
+		if len(req.Profiles) > 0 {
+			args = append(args, "--profile="+strings.Join(req.Profiles, ","))
+		}
+
+		apiMu.Lock()
+		res := runSelf(proj.Path, args...)
+		apiMu.Unlock()
+		writeJSON(w, commandStatus(res), res)
+	})
+
+	mux.HandleFunc("DELETE /api/slots/{name}", func(w http.ResponseWriter, r *http.Request) {
+		reg := loadRegistry()
+		name := r.PathValue("name")
+		slot, ok := reg.Slots[name]
+		if !ok {
+			writeAPIError(w, http.StatusNotFound, exitNotFound, fmt.Sprintf("slot '%s' not found", name))
+			return
+		}
+		args := []string{"delete", worktree.SlotIdentifier(name, slot.Project)}
+		if r.URL.Query().Get("force") == "true" {
+			args = append(args, "--force")
+		}
+
+		apiMu.Lock()
+		res := runSelf(reg.Projects[slot.Project].Path, args...)
+		apiMu.Unlock()
+		writeJSON(w, commandStatus(res), res)
+	})
+
+	// Commands run inside the slot: sync (rebase on main), db-sync (the
+	// request itself confirms replacing the slot's databases)
+	for action, args := range map[string][]string{"sync": {"sync"}, "db-sync": {"db-sync", "--yes"}} {
+		mux.HandleFunc("POST /api/slots/{name}/"+action, func(w http.ResponseWriter, r *http.Request) {
+			reg := loadRegistry()
+			name := r.PathValue("name")
+			path := reg.SlotPath(name)
+			if _, ok := reg.Slots[name]; !ok || path == "" || !fileExists(path) {
+				writeAPIError(w, http.StatusNotFound, exitNotFound, fmt.Sprintf("slot '%s' not found", name))
+				return
+			}
+
+			apiMu.Lock()
+			res := runSelf(path, args...)
+			apiMu.Unlock()
+			writeJSON(w, commandStatus(res), res)
+		})
+	}
+
+	// Clean scans are always dry runs; cleaning itself stays in the CLI
+	mux.HandleFunc("GET /api/clean", func(w http.ResponseWriter, r *http.Request) {
+		args := []string{"clean"}
+		switch kind := r.URL.Query().Get("kind"); kind {
+		case "":
+		case "agents", "docker", "storybook", "web":
+			args = append(args, kind)
+		case "prs":
+			args = append(args, kind, "--all")
+		default:
+			writeAPIError(w, http.StatusBadRequest, exitUsage, fmt.Sprintf("unknown clean kind '%s'", kind))
+			return
+		}
+		res := runSelf(homeDir(), args...)
+		writeJSON(w, commandStatus(res), res)
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if msg := apiRequestError(r, listenHost); msg != "" {
+			writeAPIError(w, http.StatusForbidden, exitUsage, msg)
+			return
+		}
+		if !apiAuthorized(r.Header.Get("Authorization"), token) {
+			writeAPIError(w, http.StatusUnauthorized, exitUsage, "missing or invalid bearer token")
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, apiMaxBody)
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func cmdServe(args []string) {
+	portFlag, args := extractFlag(args, "--port")
+	host, args := extractFlag(args, "--host")
+	token, _ := extractFlag(args, "--token")
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	token = cmp.Or(token, os.Getenv("SLOT_API_TOKEN"))
+	generated := token == ""
+	if generated {
+		buf := make([]byte, 24)
+		rand.Read(buf)
+		token = hex.EncodeToString(buf)
+	}
+	port := 7777
+	if portFlag != "" {
+		n, err := strconv.Atoi(portFlag)
+		if err != nil || n < 1 || n > 65535 {
+			fail(exitUsage, "--port must be a port number")
+		}
+		port = n
+	}
+
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	fmt.Printf("slot-cli API listening on http://%s\n", addr)
+	fmt.Println("  Requests need: Authorization: Bearer <token> (and Content-Type: application/json on POST)")
+	if generated {
+		fmt.Printf("  Token for this run: %s (set --token or SLOT_API_TOKEN to keep one)\n", token)
+	}
+	if err := http.ListenAndServe(addr, apiHandler(token, host)); err != nil {
+		fail(exitError, err.Error())
+	}
+}
+
+func cmdDNS(args []string) {
+	subcmd := "list"
+	dryRun := false
+	useDnsmasq := false
+	for _, arg := range args {
+		if arg == "--dry-run" {
+			dryRun = true
+		} else if arg == "--dnsmasq" {
+			useDnsmasq = true
+		} else if !strings.HasPrefix(arg, "-") {
+			subcmd = arg
+		}
+	}
+
+	reg := loadRegistry()
+	backend := "hosts"
+	if useDnsmasq {
+		backend = "dnsmasq"
+	}
+
+	switch subcmd {
+	case "list", "ls":
+		domains := registeredSlotDomains(reg)
+		if len(domains) == 0 {
+			fmt.Println("No slots registered.")
+			return
+		}
+		hosts, dnsmasq := slotDNSEnabled()
+		fmt.Println()
+		for _, d := range domains {
+			fmt.Printf("  %s\n", d)
+		}
+		fmt.Println()
+		fmt.Printf("  /etc/hosts: %v   dnsmasq: %v\n", hosts, dnsmasq)
+		fmt.Println()
+
+	case "sync", "add":
+		if err := applySlotDNS(registeredSlotDomains(reg), useDnsmasq, dryRun); err != nil {
+			fail(exitError, err.Error())
+		}
+		if !dryRun {
+			setSlotDNS(backend, true)
+		}
+
+	case "remove", "rm":
+		if useDnsmasq {
+			if dryRun {
+				fmt.Printf("Would remove %s\n", dnsmasqConfPath)
+				return
+			}
+			if err := os.Remove(dnsmasqConfPath); err != nil && !os.IsNotExist(err) {
+				fail(exitError, err.Error())
+			}
+			setSlotDNS(backend, false)
+			fmt.Printf("✓ Removed %s\n", dnsmasqConfPath)
+			return
+		}
+		if err := applySlotDNS(nil, false, dryRun); err != nil {
+			fail(exitError, err.Error())
+		}
+		if !dryRun {
+			setSlotDNS(backend, false)
+		}
+
+	default:
+		fmt.Println("Usage:")
+		fmt.Println("  slot-cli dns list                  Show slot domains")
+		fmt.Println("  slot-cli dns sync [--dnsmasq]      Write *.slot.test entries")
+		fmt.Println("  slot-cli dns remove [--dnsmasq]    Remove managed entries")
+		fmt.Println("  --dry-run                          Show changes without writing")
+	}
+}
+
+// Helper functions
+
+func runCmd(dir string, name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Dir = dir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func copyGitignored(mainRepo, slotPath string) {
+	var files []string
+	for _, file := range gitignoredFiles(mainRepo) {
+		// Keep files the slot already has (provision re-runs this on live slots)
+		if _, err := os.Stat(filepath.Join(slotPath, file)); err == nil {
+			continue
+		}
+		files = append(files, file)
+	}
+
+	copyFiles(mainRepo, slotPath, files)
+}
+
+// gitignoredFiles lists main's gitignored files that .slotignore lets into slots
+func gitignoredFiles(mainRepo string) []string {
+	cmd := exec.Command("git", "ls-files", "--others", "--ignored", "--exclude-standard")
+	cmd.Dir = mainRepo
+	out, err := cmd.Output()
+	if err != nil {
+		return nil
+	}
+
+	ignore, err := loadSlotIgnore(mainRepo)
+	if err != nil {
+		fmt.Printf("⚠ %v\n", err)
+	}
+
+	var files []string
+	for _, file := range strings.Split(string(out), "\n") {
+		file = strings.TrimSpace(file)
+		if file == "" {
+			continue
+		}
+
+		info, err := os.Stat(filepath.Join(mainRepo, file))
+		if err != nil || info.IsDir() || !ignore.Copies(file, info.Size()) {
+			continue
+		}
+		files = append(files, file)
+	}
+	return files
+}
+
+// defaultCopySkips are path fragments of gitignored files never copied into
+// slots unless .slotignore includes them
+var defaultCopySkips = []string{
+	"node_modules", "dist/", "build/", ".next/", ".log",
+	".husky/", "backups/", ".turbo/", ".venv/", ".trunk/", "coverage/",
+}
+
+// defaultCopyMaxSize is the size cap for copied gitignored files (1MB)
+const defaultCopyMaxSize = 1048576
+
+// SlotIgnore is a main repo's .slotignore: which gitignored files propagate into slots.
+//
+//	# comments and blank lines are ignored
+//	max-size 5MB        size cap (B, KB, MB, GB; 0 = no limit)
+//	*.sqlite            exclude: skip matching files
+//	!.env.local         include: copy even if skipped by default or over the cap
+//
+// Patterns without a slash match any path component, patterns with one match
+// from the repo root, and a trailing slash matches directories only.
+type SlotIgnore struct {
+	Include []string
+	Exclude []string
+	MaxSize int64
+}
+
+// loadSlotIgnore reads mainRepo/.slotignore (defaults when missing)
+func loadSlotIgnore(mainRepo string) (SlotIgnore, error) {
+	data, err := os.ReadFile(filepath.Join(mainRepo, ".slotignore"))
+	if err != nil {
+		return SlotIgnore{MaxSize: defaultCopyMaxSize}, nil
+	}
+	return parseSlotIgnore(string(data))
+}
+
+// parseSlotIgnore parses .slotignore content; on error the valid lines still apply
+func parseSlotIgnore(content string) (SlotIgnore, error) {
+	ignore := SlotIgnore{MaxSize: defaultCopyMaxSize}
+	var firstErr error
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if rest, ok := strings.CutPrefix(line, "max-size"); ok && (rest == "" || rest[0] == ' ' || rest[0] == '\t') {
+			size, err := parseByteSize(strings.TrimSpace(rest))
+			if err != nil && firstErr == nil {
+				firstErr = fmt.Errorf(".slotignore line %d: %v", i+1, err)
+			} else if err == nil {
+				ignore.MaxSize = size
+			}
+			continue
+		}
+		if pattern, ok := strings.CutPrefix(line, "!"); ok {
+			ignore.Include = append(ignore.Include, pattern)
+		} else {
+			ignore.Exclude = append(ignore.Exclude, line)
+		}
+	}
+	return ignore, firstErr
+}
+
+// parseByteSize parses sizes like "512KB", "5MB", "1GB" or "2048"
+func parseByteSize(s string) (int64, error) {
+	upper := strings.ToUpper(s)
+	mult := int64(1)
+	for _, unit := range []struct {
+		Suffix string
+		Mult   int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(upper, unit.Suffix) {
+			upper = strings.TrimSpace(strings.TrimSuffix(upper, unit.Suffix))
+			mult = unit.Mult
+			break
+		}
+	}
+	n, err := strconv.ParseInt(upper, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q (use e.g. 512KB, 5MB, 0 for no limit)", s)
+	}
+	return n * mult, nil
+}
+
+// Copies reports whether a gitignored file of the given size is copied into slots
+func (s SlotIgnore) Copies(file string, size int64) bool {
+	file = filepath.ToSlash(file)
+	for _, pattern := range s.Include {
+		if matchSlotIgnore(pattern, file) {
+			return true
+		}
+	}
+	for _, pattern := range s.Exclude {
+		if matchSlotIgnore(pattern, file) {
+			return false
+		}
+	}
+	for _, p := range defaultCopySkips {
+		if strings.Contains(file, p) {
+			return false
+		}
+	}
+	return s.MaxSize == 0 || size <= s.MaxSize
+}
+
+// matchSlotIgnore matches a .slotignore glob against a slash-separated path
+func matchSlotIgnore(pattern, file string) bool {
+	dirOnly := strings.HasSuffix(pattern, "/")
+	pattern = strings.Trim(pattern, "/")
+	anchored := strings.Contains(pattern, "/")
+	segments := strings.Split(file, "/")
+
+	last := len(segments)
+	if dirOnly {
+		last--
+	}
+	for i := 0; i < last; i++ {
+		candidate := segments[i]
+		if anchored {
+			candidate = strings.Join(segments[:i+1], "/")
+		}
+		if ok, _ := path.Match(pattern, candidate); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// copyBatch is one cp invocation covering Files
+type copyBatch struct {
+	Files []string
+	Args  []string
+}
+
+// cowCopyBatches plans copy-on-write copies of files (relative paths, run
+// from the source root) into dstRoot: GNU cp --reflink=auto --parents in
+// chunks on Linux (Btrfs/XFS reflink, plain copy elsewhere), cp -c
+// (clonefile) per directory on macOS. Other platforms get no batches.
+func cowCopyBatches(goos, dstRoot string, files []string) []copyBatch {
+	var batches []copyBatch
+	switch goos {
+	case "linux":
+		for start := 0; start < len(files); start += 200 {
+			chunk := files[start:min(start+200, len(files))]
+			args := append([]string{"cp", "--reflink=auto", "-p", "--parents", "-t", dstRoot, "--"}, chunk...)
+			batches = append(batches, copyBatch{Files: chunk, Args: args})
+		}
+	case "darwin":
+		byDir := make(map[string][]string)
+		var dirs []string
+		for _, f := range files {
+			dir := filepath.Dir(f)
+			if _, ok := byDir[dir]; !ok {
+				dirs = append(dirs, dir)
+			}
+			byDir[dir] = append(byDir[dir], f)
+		}
+		for _, dir := range dirs {
+			args := append([]string{"cp", "-c", "-p", "--"}, byDir[dir]...)
+			args = append(args, filepath.Join(dstRoot, dir)+"/")
+			batches = append(batches, copyBatch{Files: byDir[dir], Args: args})
+		}
+	}
+	return batches
+}
+
+// copyFiles copies files (relative to srcRoot) to the same paths under
+// dstRoot, cloning them copy-on-write where the filesystem supports it and
+// falling back to a plain copy for anything cp couldn't handle
+func copyFiles(srcRoot, dstRoot string, files []string) {
+	defer forgetFiles(dstRoot)
+	for _, f := range files {
+		os.MkdirAll(filepath.Join(dstRoot, filepath.Dir(f)), 0755)
+	}
+
+	copied := make(map[string]bool)
+	for _, b := range cowCopyBatches(runtime.GOOS, dstRoot, files) {
+		cmd := exec.Command(b.Args[0], b.Args[1:]...)
+		cmd.Dir = srcRoot
+		if cmd.Run() == nil {
+			for _, f := range b.Files {
+				copied[f] = true
+			}
+		}
+	}
+
+	for _, f := range files {
+		if copied[f] {
+			continue
+		}
+		src := filepath.Join(srcRoot, f)
+		if info, err := os.Stat(src); err == nil {
+			copyFile(src, filepath.Join(dstRoot, f), info.Mode())
+		}
+	}
+}
+
+func scanAndAllocatePorts(mainRepo string, slotNum int) map[int]int {
+	portMap := make(map[int]int)
+	portVars := make(map[int]string) // port -> variable name for display
+
+	fmt.Println("Scanning main project ports...")
+
+	portRe := regexp.MustCompile(`^([A-Z_]*PORT)=["']?(\d+)["']?`)
+	urlPortRe := regexp.MustCompile(`localhost:(\d+)`)
+
+	// Scan all relevant files for ports
+	scanFiles(mainRepo, func(path string) bool {
+		// Skip unwanted directories
+		rel, _ := filepath.Rel(mainRepo, path)
+		skipDirs := []string{"node_modules", ".next", "dist", ".git"}
+		for _, skip := range skipDirs {
+			if strings.Contains(rel, skip) {
+				return false
+			}
+		}
+
+		baseName := filepath.Base(path)
+		return baseName == ".env" || baseName == ".env.local" || baseName == ".mcp.json"
+	}, func(path string, content []byte) {
+		baseName := filepath.Base(path)
+		isEnvFile := (baseName == ".env" || baseName == ".env.local")
+
+		for _, line := range strings.Split(string(content), "\n") {
+			// Skip comments
+			if strings.HasPrefix(strings.TrimSpace(line), "#") {
+				continue
+			}
+
+			// Check for PORT= or *_PORT= variables (env files)
+			if isEnvFile {
+				if m := portRe.FindStringSubmatch(line); len(m) > 2 {
+					if port, err := strconv.Atoi(m[2]); err == nil && port > 1000 {
+						if _, exists := portMap[port]; !exists {
+							portVars[port] = m[1]
+						}
+					}
+				}
+			}
+
+			// Check for localhost:PORT in URLs (all files)
+			for _, m := range urlPortRe.FindAllStringSubmatch(line, -1) {
+				if port, err := strconv.Atoi(m[1]); err == nil && port > 1000 {
+					if _, exists := portMap[port]; !exists {
+						if _, hasVar := portVars[port]; !hasVar {
+							portVars[port] = "URL"
+						}
+					}
+				}
+			}
+		}
+	})
+
+	// Allocate slot ports (collision-aware)
+	portMap = ports.Allocate(portVars, slotNum)
+	pinned, taken := applyLinkedPorts(portMap, linkedPorts)
+
+	// Verify system availability and adjust if needed
+	for mainPort, slotPort := range portMap {
+		if pinned[mainPort] {
+			fmt.Printf("  %s: %d → %d (linked slot)\n", portVars[mainPort], mainPort, slotPort)
+			continue
+		}
+		for taken[slotPort] || !ports.Available(slotPort) {
+			fmt.Printf("  Port %d in use, trying next...\n", slotPort)
+			slotPort++
+		}
+		portMap[mainPort] = slotPort
+		fmt.Printf("  %s: %d → %d\n", portVars[mainPort], mainPort, slotPort)
+	}
+
+	return portMap
+}
+
+// trackedFileMode controls how port rewrites treat files tracked by git:
+//   - override: leave tracked .env files untouched, write .git/info/exclude'd .env.local overrides
+//     instead; other tracked files fall back to skip-worktree
+//   - skip-worktree: rewrite in place and hide the change with git update-index --skip-worktree
+//   - allow: rewrite in place (changes show up in git status)
+var trackedFileMode = "override"
+
+// parseTrackedFileMode extracts --tracked <mode> (or --tracked=<mode>) from
+// args, returning the current mode when it isn't given
+func parseTrackedFileMode(args []string) (string, []string) {
+	mode, rest := extractFlag(args, "--tracked")
+	switch mode {
+	case "":
+		return trackedFileMode, rest
+	case "override", "skip-worktree", "allow":
+		return mode, rest
+	}
+	fail(exitUsage, fmt.Sprintf("unknown --tracked mode '%s' (override, skip-worktree, allow)", mode))
+	return "", nil
+}
+
+// linkedPorts are main→slot port mappings of the other slots in a stack (new
+// --link-ports): the same main port gets the same slot port, so URLs between
+// the projects keep working, and no other port may reuse those slot ports
+var linkedPorts map[int]int
+
+// parseLinkedPorts parses --link-ports "4000:4007,5432:5439"
+func parseLinkedPorts(s string) (map[int]int, error) {
+	linked := make(map[int]int)
+	for _, pair := range splitList(s) {
+		from, to, ok := strings.Cut(pair, ":")
+		mainPort, err1 := strconv.Atoi(from)
+		slotPort, err2 := strconv.Atoi(to)
+		if !ok || err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("invalid --link-ports entry %q (want main:slot, e.g. 4000:4007)", pair)
+		}
+		linked[mainPort] = slotPort
+	}
+	return linked, nil
+}
+
+// formatLinkedPorts is the --link-ports value for a port map, sorted
+func formatLinkedPorts(linked map[int]int) string {
+	var pairs []string
+	for _, mainPort := range slices.Sorted(maps.Keys(linked)) {
+		pairs = append(pairs, fmt.Sprintf("%d:%d", mainPort, linked[mainPort]))
+	}
+	return strings.Join(pairs, ",")
+}
+
+// applyLinkedPorts pins the ports of portMap that a linked slot already
+// mapped, and returns those (pinned) plus every linked slot port (taken)
+func applyLinkedPorts(portMap, linked map[int]int) (pinned map[int]bool, taken map[int]bool) {
+	pinned, taken = make(map[int]bool), make(map[int]bool)
+	for _, slotPort := range linked {
+		taken[slotPort] = true
+	}
+	for mainPort := range portMap {
+		if slotPort, ok := linked[mainPort]; ok {
+			portMap[mainPort] = slotPort
+			pinned[mainPort] = true
+		}
+	}
+	return pinned, taken
+}
+
+// dryRunWrites makes the port rewriters print their changes instead of
+// writing them (set by --dry-run)
+var dryRunWrites = false
+
+// writeSlotFile writes a port-rewritten file, protecting tracked files
+// according to trackedFileMode
+func writeSlotFile(slotPath, rel, content string, mode os.FileMode) {
+	if dryRunWrites {
+		old, _ := os.ReadFile(filepath.Join(slotPath, rel))
+		fmt.Printf("  Would update: %s\n", rel)
+		printLineDiff(string(old), content)
+		return
+	}
+	os.WriteFile(filepath.Join(slotPath, rel), []byte(content), mode)
+	forgetFiles(filepath.Join(slotPath, rel))
+
+	if trackedFileMode != "allow" && worktree.IsTracked(slotPath, rel) {
+		exec.Command("git", "-C", slotPath, "update-index", "--skip-worktree", rel).Run()
+		fmt.Printf("  Updated: %s (tracked, marked skip-worktree)\n", rel)
+		return
+	}
+	fmt.Printf("  Updated: %s\n", rel)
+}
+
+// addToInfoExclude appends a pattern to the repo's .git/info/exclude if missing
+func addToInfoExclude(repoPath, pattern string) {
+	out, err := exec.Command("git", "-C", repoPath, "rev-parse", "--git-common-dir").Output()
+	if err != nil {
+		return
+	}
+	gitDir := strings.TrimSpace(string(out))
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(repoPath, gitDir)
+	}
+	excludePath := filepath.Join(gitDir, "info", "exclude")
+
+	content, _ := os.ReadFile(excludePath)
+	for _, line := range strings.Split(string(content), "\n") {
+		if strings.TrimSpace(line) == pattern {
+			return
+		}
+	}
+
+	os.MkdirAll(filepath.Dir(excludePath), 0755)
+	newContent := strings.TrimRight(string(content), "\n")
+	if newContent != "" {
+		newContent += "\n"
+	}
+	os.WriteFile(excludePath, []byte(newContent+pattern+"\n"), 0644)
+}
+
+// envOverrideLines returns the lines of newContent that differ from oldContent
+func envOverrideLines(oldContent, newContent string) []string {
+	old := make(map[string]bool)
+	for _, line := range strings.Split(oldContent, "\n") {
+		old[line] = true
+	}
+	var lines []string
+	for _, line := range strings.Split(newContent, "\n") {
+		if line != "" && !old[line] {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+const (
+	envOverrideBegin = "# >>> slot-cli port overrides (managed, do not edit) >>>"
+	envOverrideEnd   = "# <<< slot-cli port overrides <<<"
+)
+
+// replaceEnvOverrideBlock writes lines into the slot-cli managed block of an
+// .env.local, replacing the block from an earlier run (or appending one), so
+// re-running new or fix-ports never duplicates the overrides
+func replaceEnvOverrideBlock(content string, lines []string) string {
+	block := envOverrideBegin + "\n" + strings.Join(lines, "\n") + "\n" + envOverrideEnd + "\n"
+	if start := strings.Index(content, envOverrideBegin); start >= 0 {
+		if end := strings.Index(content[start:], envOverrideEnd); end >= 0 {
+			rest := strings.TrimPrefix(content[start+end+len(envOverrideEnd):], "\n")
+			return content[:start] + block + rest
+		}
+	}
+	content = strings.TrimRight(content, "\n")
+	if content != "" {
+		content += "\n"
+	}
+	return content + block
+}
+
+// envOverrideBlockLines returns the lines of content's managed override
+// block, if it has one
+func envOverrideBlockLines(content string) ([]string, bool) {
+	start := strings.Index(content, envOverrideBegin)
+	if start < 0 {
+		return nil, false
+	}
+	block := content[start+len(envOverrideBegin):]
+	end := strings.Index(block, envOverrideEnd)
+	if end < 0 {
+		return nil, false
+	}
+	block = strings.Trim(block[:end], "\n")
+	if block == "" {
+		return nil, true
+	}
+	return strings.Split(block, "\n"), true
+}
+
+// EnvDiff is how a slot env file drifted from main's: keys only main has
+// (Missing), keys only the slot has (Extra) and keys whose values differ
+type EnvDiff struct {
+	File    string   `json:"file"`
+	Missing []string `json:"missing,omitempty"`
+	Extra   []string `json:"extra,omitempty"`
+	Changed []string `json:"changed,omitempty"`
+}
+
+// Empty reports whether the slot file matches main's
+func (d EnvDiff) Empty() bool {
+	return len(d.Missing)+len(d.Extra)+len(d.Changed) == 0
+}
+
+// envValues parses the KEY=value lines of env content, unquoting values
+// (comments, blank lines and export prefixes are skipped)
+func envValues(content string) map[string]string {
+	vars := make(map[string]string)
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimPrefix(strings.TrimSpace(line), "export ")
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || strings.HasPrefix(key, "#") {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		vars[key] = value
+	}
+	return vars
+}
+
+// envPortMap recovers the port rewrites `new` applied from the port
+// variables main and the slot both define
+func envPortMap(mainVars, slotVars map[string]string) map[int]int {
+	portMap := make(map[int]int)
+	for key, value := range mainVars {
+		_, mainPort, ok := ports.FromEnvLine(key + "=" + value)
+		if !ok {
+			continue
+		}
+		if _, slotPort, ok := ports.FromEnvLine(key + "=" + slotVars[key]); ok && slotPort != mainPort {
+			portMap[mainPort] = slotPort
+		}
+	}
+	return portMap
+}
+
+// diffEnv compares a slot env file against main's, ignoring the port and
+// COMPOSE_PROJECT_NAME rewrites and secret references the slot resolved
+func diffEnv(file, mainContent, slotContent string, portMap map[int]int, slotName string) EnvDiff {
+	return diffEnvValues(file, ports.ReplaceInEnv(mainContent, portMap, slotName), slotContent)
+}
+
+// diffEnvValues compares the keys of env content the slot should have with
+// the slot's, ignoring COMPOSE_PROJECT_NAME and secret references the slot
+// resolved
+func diffEnvValues(file, wantContent, slotContent string) EnvDiff {
+	want := envValues(wantContent)
+	have := envValues(slotContent)
+	diff := EnvDiff{File: file}
+	for key, value := range want {
+		slotValue, ok := have[key]
+		switch {
+		case key == "COMPOSE_PROJECT_NAME":
+		case !ok:
+			diff.Missing = append(diff.Missing, key)
+		case slotValue != value:
+			if _, _, isRef := secrets.Ref(key + "=" + value); !isRef {
+				diff.Changed = append(diff.Changed, key)
+			}
+		}
+	}
+	for key := range have {
+		if _, ok := want[key]; !ok && key != "COMPOSE_PROJECT_NAME" {
+			diff.Extra = append(diff.Extra, key)
+		}
+	}
+	sort.Strings(diff.Missing)
+	sort.Strings(diff.Extra)
+	sort.Strings(diff.Changed)
+	return diff
+}
+
+// envFiles returns the .env/.env.local paths under root, relative to it
+func envFiles(root string) []string {
+	var files []string
+	for _, path := range repoFiles(root) {
+		if name := filepath.Base(path); name == ".env" || name == ".env.local" {
+			rel, _ := filepath.Rel(root, path)
+			files = append(files, rel)
+		}
+	}
+	return files
+}
+
+// slotEnvDiffs compares every env file of a slot with main's copy
+func slotEnvDiffs(mainRepo, slotName, slotPath string) []EnvDiff {
+	rels := envFiles(mainRepo)
+	for _, rel := range envFiles(slotPath) {
+		if !slices.Contains(rels, rel) {
+			rels = append(rels, rel)
+		}
+	}
+	sort.Strings(rels)
+
+	portMap := slotPortMap(mainRepo, slotPath)
+	links := loadRegistry().Slots[slotName].Links
+	var diffs []EnvDiff
+	for _, rel := range rels {
+		mainData, _ := os.ReadFile(filepath.Join(mainRepo, rel))
+		slotData, _ := os.ReadFile(filepath.Join(slotPath, rel))
+		want := syncedContent(rel, string(mainData), string(slotData), portMap, slotName, links)
+		if diff := diffEnvValues(rel, want, string(slotData)); !diff.Empty() {
+			diffs = append(diffs, diff)
+		}
+	}
+	return diffs
+}
+
+// slotPortMap recovers a slot's port rewrites by comparing the port variables
+// of its env files with main's
+func slotPortMap(mainRepo, slotPath string) map[int]int {
+	portMap := make(map[int]int)
+	for _, rel := range envFiles(mainRepo) {
+		mainData, _ := os.ReadFile(filepath.Join(mainRepo, rel))
+		slotData, _ := os.ReadFile(filepath.Join(slotPath, rel))
+		slotVars := envValues(string(slotData))
+		if filepath.Base(rel) == ".env" {
+			// A tracked .env keeps main's ports; the slot's are in the
+			// override block of .env.local, which loaders prefer
+			local, _ := os.ReadFile(filepath.Join(slotPath, filepath.Dir(rel), ".env.local"))
+			if lines, ok := envOverrideBlockLines(string(local)); ok {
+				maps.Copy(slotVars, envValues(strings.Join(lines, "\n")))
+			}
+		}
+		// A port defined in .env is also rewritten in .env.local URLs
+		maps.Copy(portMap, envPortMap(envValues(string(mainData)), slotVars))
+	}
+	return portMap
+}
+
+func cmdEnv(args []string) {
+	if len(args) == 0 {
+		fail(exitUsage, "usage: slot-cli env diff|sync [slot]")
+	}
+	switch args[0] {
+	case "diff":
+		cmdEnvDiff(args[1:])
+	case "sync":
+		cmdEnvSync(args[1:])
+	default:
+		fail(exitUsage, fmt.Sprintf("unknown env command '%s'", args[0]), "Use: slot-cli env diff|sync [slot]")
+	}
+}
+
+// locateSlot resolves the slot named by args (or the current one) to its
+// main repo and path, failing when it doesn't exist
+func locateSlot(args []string) (mainRepo, slotName, slotPath string) {
+	slotName = resolveSlotName(args)
+	reg := loadRegistry()
+	cwd, _ := os.Getwd()
+	mainRepo, _ = worktree.DetectProject(cwd)
+	if slot, ok := reg.Slots[slotName]; ok {
+		mainRepo = firstNonEmpty(reg.Projects[slot.Project].Path, mainRepo)
+	}
+	if mainRepo == "" {
+		fail(exitUsage, "not in a git repository")
+	}
+	slotPath = filepath.Join(filepath.Dir(mainRepo), slotName)
+	if _, err := os.Stat(slotPath); err != nil {
+		fail(exitNotFound, fmt.Sprintf("slot '%s' not found", slotName))
+	}
+	return mainRepo, slotName, slotPath
+}
+
+// cmdEnvDiff reports env keys that drifted between a slot and main, e.g.
+// secrets added to main after the slot was created
+func cmdEnvDiff(args []string) {
+	mainRepo, slotName, slotPath := locateSlot(args)
+	diffs := slotEnvDiffs(mainRepo, slotName, slotPath)
+	if jsonOutput {
+		if diffs == nil {
+			diffs = []EnvDiff{}
+		}
+		data, _ := json.MarshalIndent(diffs, "", "  ")
+		fmt.Println(string(data))
+		return
+	}
+	if len(diffs) == 0 {
+		fmt.Printf("✓ %s env files match main (ports aside)\n", slotName)
+		return
+	}
+
+	fmt.Printf("ENV DIFF: %s vs main\n", slotName)
+	for _, d := range diffs {
+		fmt.Printf("\n  %s\n", d.File)
+		for _, key := range d.Missing {
+			fmt.Printf("    + %-30s only in main\n", key)
+		}
+		for _, key := range d.Extra {
+			fmt.Printf("    - %-30s only in slot\n", key)
+		}
+		for _, key := range d.Changed {
+			fmt.Printf("    ~ %-30s differs\n", key)
+		}
+	}
+	fmt.Println("\n  + keys are missing in the slot: copy them from main's file")
+}
+
+// syncedContent is what a gitignored file from main becomes in a slot: env
+// files get the slot's ports and compose name, config files its localhost
+// ports, both with the slot's link rewrites. An .env.local keeps the managed
+// override block of slotContent, the slot's current copy.
+func syncedContent(rel, content, slotContent string, portMap map[int]int, slotName string, links []SlotLink) string {
+	switch filepath.Base(rel) {
+	case ".env", ".env.local":
+		content = ports.ReplaceInEnv(content, portMap, slotName)
+	case ".mcp.json":
+		content = replaceLocalhostPorts(content, portMap)
+	default:
+		return content
+	}
+	for _, link := range links {
+		content = replaceLocalhostPorts(content, link.Ports)
+	}
+	if lines, ok := envOverrideBlockLines(slotContent); ok && filepath.Base(rel) == ".env.local" {
+		content = replaceEnvOverrideBlock(content, lines)
+	}
+	return content
+}
+
+// cmdEnvSync re-copies main's gitignored files into an existing slot
+// (re-applying its port rewrites), after previewing what would change
+func cmdEnvSync(args []string) {
+	dryRun := slices.Contains(args, "--dry-run")
+	mainRepo, slotName, slotPath := locateSlot(args)
+	if !dryRun {
+		checkLock(slotName, true)
+	}
+	portMap := slotPortMap(mainRepo, slotPath)
+	links := loadRegistry().Slots[slotName].Links
+
+	type fileUpdate struct {
+		rel, content string
+		mode         os.FileMode
+	}
+	var updates []fileUpdate
+	for _, rel := range gitignoredFiles(mainRepo) {
+		info, err := os.Stat(filepath.Join(mainRepo, rel))
+		if err != nil {
+			continue
+		}
+		mainData, _ := os.ReadFile(filepath.Join(mainRepo, rel))
+		slotData, err := os.ReadFile(filepath.Join(slotPath, rel))
+		content := syncedContent(rel, string(mainData), string(slotData), portMap, slotName, links)
+		exists := err == nil
+
+		if name := filepath.Base(rel); exists && (name == ".env" || name == ".env.local") {
+			// Key-level preview: env files hold secrets, and resolved references aren't drift
+			diff := diffEnvValues(rel, content, string(slotData))
+			if diff.Empty() {
+				continue
+			}
+			fmt.Printf("  ~ %s\n", rel)
+			for _, key := range diff.Missing {
+				fmt.Printf("      + %s\n", key)
+			}
+			for _, key := range diff.Extra {
+				fmt.Printf("      - %s (only in slot, will be removed)\n", key)
+			}
+			for _, key := range diff.Changed {
+				fmt.Printf("      ~ %s\n", key)
+			}
+		} else if content == string(slotData) {
+			continue
+		} else if !exists {
+			fmt.Printf("  + %s (new)\n", rel)
+		} else if bytes.IndexByte(mainData, 0) >= 0 || len(mainData) > 64*1024 {
+			fmt.Printf("  ~ %s (%d bytes)\n", rel, len(mainData))
+		} else {
+			fmt.Printf("  ~ %s\n", rel)
+			printLineDiff(string(slotData), content)
+		}
+		updates = append(updates, fileUpdate{rel, content, info.Mode()})
+	}
+
+	if len(updates) == 0 {
+		fmt.Printf("✓ %s is up to date with main's gitignored files\n", slotName)
+		return
+	}
+	if dryRun {
+		fmt.Printf("\nDry run: %d file(s) would be updated in %s\n", len(updates), slotName)
+		return
+	}
+	if !confirm(fmt.Sprintf("\nUpdate %d file(s) in %s from main?", len(updates), slotName)) {
+		fail(exitAborted, "aborted")
+	}
+
+	defer forgetFiles(slotPath)
+	for _, u := range updates {
+		path := filepath.Join(slotPath, u.rel)
+		content, mode := u.content, u.mode
+		if secrets.Count(content) > 0 {
+			resolved, n, err := secrets.Resolve(content)
+			if err != nil {
+				fmt.Printf("⚠ %s: %v\n", u.rel, err)
+			}
+			if n > 0 {
+				content, mode = resolved, mode.Perm()&0600
+			}
+		}
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), mode); err != nil {
+			fmt.Printf("✗ %s: %v\n", u.rel, err)
+			continue
+		}
+		os.Chmod(path, mode)
+		fmt.Printf("  Updated: %s\n", u.rel)
+	}
+	fmt.Printf("✓ Synced %d file(s) from main into %s\n", len(updates), slotName)
+}
+
+// findPortRewriteArtifacts scans a unified diff for added lines that contain
+// slot-specific values (slot ports or the slot's compose project name).
+// Returns "file: line" descriptions of each offending line.
+func findPortRewriteArtifacts(diff string, slotPorts map[int]bool, dockerName string) []string {
+	var artifacts []string
+	file := ""
+	for _, line := range strings.Split(diff, "\n") {
+		if strings.HasPrefix(line, "+++ ") {
+			file = strings.TrimPrefix(strings.TrimPrefix(line, "+++ "), "b/")
+			continue
+		}
+		if !strings.HasPrefix(line, "+") {
+			continue
+		}
+		added := strings.TrimPrefix(line, "+")
+
+		found := strings.Contains(added, "COMPOSE_PROJECT_NAME="+dockerName) ||
+			strings.Contains(added, "${COMPOSE_PROJECT_NAME:-"+dockerName+"}")
+		for port := range slotPorts {
+			if found {
+				break
+			}
+			// whole port tokens only: slot port 5433 must not match 54330
+			found = regexp.MustCompile(`(localhost:|=|=")` + strconv.Itoa(port) + `\b`).MatchString(added)
+		}
+		if found {
+			artifacts = append(artifacts, fmt.Sprintf("%s: %s", file, strings.TrimSpace(added)))
+		}
+	}
+	return artifacts
+}
+
+// registeredSlot resolves a slot argument (full slot name, or number/name in
+// the current project) to a registered slot and its project's main repo
+func registeredSlot(reg *Registry, arg string) (slotName, mainRepo, slotPath string) {
+	slotName = arg
+	if _, ok := reg.Slots[slotName]; !ok {
+		cwd, _ := os.Getwd()
+		if _, project := worktree.DetectProject(cwd); project != "" {
+			slotName = project + "-" + arg
+		}
+	}
+	slot, ok := reg.Slots[slotName]
+	if !ok {
+		fail(exitNotFound, fmt.Sprintf("slot '%s' not found", arg), "See slots with: slot-cli list")
+	}
+	return slotName, reg.Projects[slot.Project].Path, reg.SlotPath(slotName)
+}
+
+// linkRewrites finds the URLs of a consumer's env (main and slot values of
+// the same file) that point at ports the provider maps, and returns the
+// consumer slot port → provider slot port rewrites, plus how many URLs
+// reference the provider at all
+func linkRewrites(mainEnv, slotEnv map[string]string, provider map[int]int) (rewrites map[int]int, refs int) {
+	urlPortRe := regexp.MustCompile(`localhost:(\d+)`)
+	rewrites = make(map[int]int)
+	for key, mainValue := range mainEnv {
+		mainPorts := urlPortRe.FindAllStringSubmatch(mainValue, -1)
+		slotPorts := urlPortRe.FindAllStringSubmatch(slotEnv[key], -1)
+		if len(mainPorts) != len(slotPorts) {
+			continue
+		}
+		for i, m := range mainPorts {
+			mainPort, _ := strconv.Atoi(m[1])
+			current, _ := strconv.Atoi(slotPorts[i][1])
+			if target, ok := provider[mainPort]; ok {
+				refs++
+				if current != target {
+					rewrites[current] = target
+				}
+			}
+		}
+	}
+	return rewrites, refs
+}
+
+// rewriteSlotURLs applies localhost port rewrites to a slot's env files and
+// .mcp.json
+func rewriteSlotURLs(slotPath string, rewrites map[int]int) {
+	rels := envFiles(slotPath)
+	if fileExists(filepath.Join(slotPath, ".mcp.json")) {
+		rels = append(rels, ".mcp.json")
+	}
+	for _, rel := range rels {
+		path := filepath.Join(slotPath, rel)
+		content, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		if updated := replaceLocalhostPorts(string(content), rewrites); updated != string(content) {
+			if info, err := os.Stat(path); err == nil {
+				writeSlotFile(slotPath, rel, updated, info.Mode().Perm())
+			}
+		}
+	}
+}
+
+// unlinkSlot restores the URLs a link rewrote and drops it from the slot
+func unlinkSlot(consumer, consumerPath string, link SlotLink) {
+	restore := make(map[int]int)
+	for before, after := range link.Ports {
+		restore[after] = before
 	}
+	rewriteSlotURLs(consumerPath, restore)
+	modifySlot(consumer, func(slot *SlotConfig) {
+		slot.Links = slices.DeleteFunc(slot.Links, func(l SlotLink) bool { return l.Slot == link.Slot })
+	})
+}
 
-	fmt.Println()
-	fmt.Println("Fixing ports...")
+// cmdLink points a consumer slot's env URLs at the ports of a provider slot,
+// e.g. a frontend slot at the api slot with the feature it needs
+func cmdLink(args []string) {
+	if len(args) < 2 {
+		fail(exitUsage, "usage: slot-cli link <consumer-slot> <provider-slot>")
+	}
+	reg := loadRegistry()
+	consumer, consumerMain, consumerPath := registeredSlot(reg, args[0])
+	provider, providerMain, providerPath := registeredSlot(reg, args[1])
+	if consumer == provider {
+		fail(exitUsage, "a slot can't be linked to itself")
+	}
 
-	// Update all files
-	updateSlotEnvFiles(slotPath, portMap, slotName)
-	updateConfigFiles(slotPath, portMap)
+	// Relinking (e.g. after the provider's ports changed) starts from the
+	// consumer's own URLs
+	for _, link := range reg.Slots[consumer].Links {
+		if link.Slot == provider {
+			unlinkSlot(consumer, consumerPath, link)
+		}
+	}
 
+	providerPorts := slotPortMap(providerMain, providerPath)
+	rewrites, refs := make(map[int]int), 0
+	for _, rel := range envFiles(consumerMain) {
+		mainData, _ := os.ReadFile(filepath.Join(consumerMain, rel))
+		slotData, _ := os.ReadFile(filepath.Join(consumerPath, rel))
+		fileRewrites, fileRefs := linkRewrites(envValues(string(mainData)), envValues(string(slotData)), providerPorts)
+		maps.Copy(rewrites, fileRewrites)
+		refs += fileRefs
+	}
+	if refs == 0 {
+		fail(exitNotFound, fmt.Sprintf("%s's env has no URLs to %s's ports (%s)", consumer, provider, formatLinkedPorts(providerPorts)),
+			"Links rewrite localhost:<port> URLs in .env files, e.g. API_URL=http://localhost:4000")
+	}
+
+	fmt.Printf("Linking %s → %s\n", consumer, provider)
+	rewriteSlotURLs(consumerPath, rewrites)
+	modifySlot(consumer, func(slot *SlotConfig) {
+		slot.Links = append(slot.Links, SlotLink{Slot: provider, Ports: rewrites})
+	})
+	fmt.Printf("✓ %s now uses %s", consumer, provider)
+	if len(rewrites) > 0 {
+		fmt.Printf(" (%s)", formatLinkedPorts(rewrites))
+	}
 	fmt.Println()
-	fmt.Println("═══════════════════════════════════════════════════════════")
-	fmt.Println("  ✓ Ports fixed")
-	fmt.Println("═══════════════════════════════════════════════════════════")
-	fmt.Println()
-	fmt.Println("Note: You may need to restart docker containers:")
-	fmt.Println("  docker compose down && docker compose up -d")
+	fmt.Println("→ Restart the consumer's dev server to pick up the new URLs")
 }
 
-func extractPortFromEnvLine(line string) (varName string, port int, ok bool) {
-	portRe := regexp.MustCompile(`^([A-Z_]*PORT)=["']?(\d+)["']?`)
-	m := portRe.FindStringSubmatch(line)
-	if len(m) < 3 {
-		return "", 0, false
+// cmdUnlink restores a consumer slot's URLs from one link, or all of them
+func cmdUnlink(args []string) {
+	if len(args) < 1 {
+		fail(exitUsage, "usage: slot-cli unlink <consumer-slot> [provider-slot]")
 	}
-	p, err := strconv.Atoi(m[2])
-	if err != nil || p <= 1000 {
-		return "", 0, false
+	reg := loadRegistry()
+	consumer, _, consumerPath := registeredSlot(reg, args[0])
+	provider := ""
+	if len(args) > 1 {
+		// The provider may be gone already, so its name is taken as given
+		provider = args[1]
+		if _, ok := reg.Slots[provider]; !ok {
+			cwd, _ := os.Getwd()
+			if _, project := worktree.DetectProject(cwd); project != "" {
+				provider = project + "-" + provider
+			}
+		}
 	}
-	return m[1], p, true
-}
 
-// scanPorts scans a directory for port configurations
-func scanPorts(dir string) map[int]string {
-	ports := make(map[int]string)
+	unlinked := 0
+	for _, link := range reg.Slots[consumer].Links {
+		if provider == "" || link.Slot == provider {
+			unlinkSlot(consumer, consumerPath, link)
+			fmt.Printf("✓ Unlinked %s from %s\n", consumer, link.Slot)
+			unlinked++
+		}
+	}
+	if unlinked == 0 {
+		fmt.Printf("%s has no links to remove\n", consumer)
+	}
+}
 
-	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-		if err != nil || info.IsDir() {
-			return nil
+// resolveSlotSecrets replaces secret references (op://, doppler://, vault://)
+// in the slot's untracked env files with their values. Failed references are
+// left in place with a warning; tracked files are never given plaintext.
+func resolveSlotSecrets(slotPath string) {
+	scanFiles(slotPath, func(path string) bool {
+		return strings.HasPrefix(filepath.Base(path), ".env")
+	}, func(path string, content []byte) {
+		rel, _ := filepath.Rel(slotPath, path)
+		count := secrets.Count(string(content))
+		if count == 0 || worktree.IsTracked(slotPath, rel) {
+			return
+		}
+		if dryRunWrites {
+			fmt.Printf("  Would resolve %d secret(s) in %s\n", count, rel)
+			return
+		}
+		resolved, n, err := secrets.Resolve(string(content))
+		if err != nil {
+			fmt.Printf("⚠ %s: %v\n", rel, err)
+		}
+		if n == 0 {
+			return
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return
+		}
+		// Owner-only: the file now holds plaintext secrets
+		if err := os.WriteFile(path, []byte(resolved), info.Mode()); err != nil {
+			fmt.Printf("⚠ %s: %v\n", rel, err)
+			return
 		}
+		forgetFiles(path)
+		os.Chmod(path, info.Mode().Perm()&0600)
+		fmt.Printf("✓ Resolved %d secret(s) in %s\n", n, rel)
+	})
+}
 
-		rel, _ := filepath.Rel(dir, path)
+func updateSlotEnvFiles(slotPath string, portMap map[int]int, slotName string) {
+	fmt.Println("\nUpdating slot .env files...")
+
+	scanFiles(slotPath, func(path string) bool {
+		rel, _ := filepath.Rel(slotPath, path)
 		skipDirs := []string{"node_modules", ".next", "dist", ".git"}
 		for _, skip := range skipDirs {
 			if strings.Contains(rel, skip) {
-				return nil
+				return false
 			}
 		}
 
+		// Only modify .env and .env.local — skip .env.production, .env.staging, .env.test, .env.example, etc.
 		baseName := filepath.Base(path)
-		isEnvFile := strings.Contains(baseName, ".env") && !strings.Contains(baseName, ".example") && !strings.Contains(baseName, ".sample")
-		isConfigFile := baseName == ".mcp.json" || baseName == "package.json"
+		return baseName == ".env" || baseName == ".env.local"
+	}, func(path string, content []byte) {
+		rel, _ := filepath.Rel(slotPath, path)
+		baseName := filepath.Base(path)
+		newContent := ports.ReplaceInEnv(string(content), portMap, slotName)
 
-		if !isEnvFile && !isConfigFile {
-			return nil
+		if newContent == string(content) {
+			return
 		}
-
-		content, err := os.ReadFile(path)
+		info, err := os.Stat(path)
 		if err != nil {
-			return nil
+			return
 		}
 
-		urlPortRe := regexp.MustCompile(`localhost:(\d+)`)
-		pFlagRe := regexp.MustCompile(`-p\s+(\d+)`)
-
-		for _, line := range strings.Split(string(content), "\n") {
-			if strings.HasPrefix(strings.TrimSpace(line), "#") {
-				continue
-			}
-
-			if isEnvFile {
-				if varName, port, ok := extractPortFromEnvLine(line); ok {
-					if _, exists := ports[port]; !exists {
-						ports[port] = varName
-					}
-				}
+		if trackedFileMode == "override" && baseName == ".env" && worktree.IsTracked(slotPath, rel) {
+			// Write only the changed lines to .env.local, which env loaders prefer over .env
+			localRel := filepath.Join(filepath.Dir(rel), ".env.local")
+			localPath := filepath.Join(slotPath, localRel)
+			if worktree.IsTracked(slotPath, localRel) {
+				writeSlotFile(slotPath, rel, newContent, info.Mode())
+				return
 			}
-
-			for _, m := range urlPortRe.FindAllStringSubmatch(line, -1) {
-				if port, err := strconv.Atoi(m[1]); err == nil && port > 1000 {
-					if _, exists := ports[port]; !exists {
-						ports[port] = "URL"
-					}
+			existing, _ := os.ReadFile(localPath)
+			overrides := envOverrideLines(string(content), newContent)
+			if dryRunWrites {
+				fmt.Printf("  Would create override: %s (for tracked %s)\n", localRel, rel)
+				for _, line := range overrides {
+					fmt.Printf("  + %s\n", line)
 				}
+				return
 			}
-
-			if isConfigFile && baseName == "package.json" {
-				for _, m := range pFlagRe.FindAllStringSubmatch(line, -1) {
-					if port, err := strconv.Atoi(m[1]); err == nil && port > 1000 {
-						if _, exists := ports[port]; !exists {
-							ports[port] = "script"
-						}
-					}
-				}
+			localContent := replaceEnvOverrideBlock(string(existing), overrides)
+			if localContent == string(existing) {
+				return
 			}
+			os.WriteFile(localPath, []byte(localContent), 0644)
+			forgetFiles(localPath)
+			addToInfoExclude(slotPath, "/"+filepath.ToSlash(localRel))
+			fmt.Printf("  Created override: %s (for tracked %s)\n", localRel, rel)
+			return
 		}
 
-		return nil
+		writeSlotFile(slotPath, rel, newContent, info.Mode())
 	})
-
-	return ports
 }
 
-func cmdDBSync() {
-	cwd, _ := os.Getwd()
-	mainRepo, _ := detectProject(cwd)
-
-	if mainRepo == "" {
-		fmt.Println("Error: not in a git repository")
-		os.Exit(1)
+// replaceLocalhostPorts rewrites localhost:PORT patterns from main to slot ports
+func replaceLocalhostPorts(content string, portMap map[int]int) string {
+	for mainPort, slotPort := range portMap {
+		content = strings.ReplaceAll(content, fmt.Sprintf("localhost:%d", mainPort), fmt.Sprintf("localhost:%d", slotPort))
 	}
+	return content
+}
 
-	// Check if we're in a slot (worktree)
-	if mainRepo == cwd {
-		fmt.Println("Error: already in main worktree, nothing to sync")
-		os.Exit(1)
-	}
+func updateConfigFiles(slotPath string, portMap map[int]int) {
+	fmt.Println("\nUpdating config files...")
 
-	slotPath := cwd
+	scanFiles(slotPath, func(path string) bool {
+		rel, _ := filepath.Rel(slotPath, path)
+		skipDirs := []string{"node_modules", ".next", "dist", ".git"}
+		for _, skip := range skipDirs {
+			if strings.Contains(rel, skip) {
+				return false
+			}
+		}
 
-	fmt.Println("Syncing database from main worktree...")
-	fmt.Println()
+		// Only modify .mcp.json (gitignored) — skip package.json (tracked, creates dirty files)
+		return filepath.Base(path) == ".mcp.json"
+	}, func(path string, content []byte) {
+		rel, _ := filepath.Rel(slotPath, path)
+		newContent := replaceLocalhostPorts(string(content), portMap)
 
-	// Find docker-compose files in slot
-	composeFiles := []string{}
-	filepath.Walk(slotPath, func(path string, info os.FileInfo, err error) error {
-		if err != nil || info.IsDir() {
-			return nil
-		}
-		if info.Name() == "docker-compose.yml" || info.Name() == "docker-compose.yaml" {
-			composeFiles = append(composeFiles, path)
+		if newContent != string(content) {
+			if info, err := os.Stat(path); err == nil {
+				writeSlotFile(slotPath, rel, newContent, info.Mode())
+			}
 		}
-		return nil
 	})
+}
 
-	if len(composeFiles) == 0 {
-		fmt.Println("Error: no docker-compose files found")
-		os.Exit(1)
-	}
-
-	synced := 0
-
-	for _, composeFile := range composeFiles {
-		composeDir := filepath.Dir(composeFile)
-		mainComposeDir := strings.Replace(composeDir, slotPath, mainRepo, 1)
-		relDir, _ := filepath.Rel(slotPath, composeDir)
-
-		fmt.Printf("─── %s ───\n", relDir)
+const slotComposeOverrideName = "docker-compose.slot.override.yml"
 
-		// Read postgres config from compose file
-		pgUser, pgPass, pgDB := parseDockerCompose(composeFile)
+// updateDockerComposeFiles writes a docker-compose.slot.override.yml next to
+// each compose file instead of editing the (usually tracked) compose file.
+// startDockerCompose and stopDocker pass it via -f.
+func updateDockerComposeFiles(slotPath, slotName string, portMap map[int]int) {
+	dockerName := ports.DockerName(slotName)
 
-		// Find slot postgres port
-		slotPgPort := 0
-		for _, envName := range []string{".env.local", ".env"} {
-			envPath := filepath.Join(composeDir, envName)
-			if port := readEnvVar(envPath, "POSTGRES_PORT"); port > 0 {
-				slotPgPort = port
-				break
-			}
+	scanFiles(slotPath, func(path string) bool {
+		return isComposeFile(path) && composeFileIncluded(slotPath, path)
+	}, func(path string, content []byte) {
+		rel, _ := filepath.Rel(slotPath, path)
+		overrideRel := filepath.Join(filepath.Dir(rel), slotComposeOverrideName)
+		override := renderSlotComposeOverride(string(content), dockerName, portMap)
+		if dryRunWrites {
+			fmt.Printf("  Would create: %s\n", overrideRel)
+			return
 		}
+		os.WriteFile(filepath.Join(slotPath, overrideRel), []byte(override), 0644)
+		forgetFiles(filepath.Join(slotPath, overrideRel))
+		addToInfoExclude(slotPath, "/"+filepath.ToSlash(overrideRel))
+		fmt.Printf("  Created: %s\n", overrideRel)
+	})
+}
 
-		// Find main postgres port
-		mainPgPort := 0
-		for _, envName := range []string{".env.local", ".env"} {
-			envPath := filepath.Join(mainComposeDir, envName)
-			if port := readEnvVar(envPath, "POSTGRES_PORT"); port > 0 {
-				mainPgPort = port
-				break
-			}
+// composePortRe matches a compose port entry with a literal host port:
+// "5432:5432", 127.0.0.1:5432:5432, "5432:5432/tcp"
+var composePortRe = regexp.MustCompile(`^(\s*-\s*)["']?((?:[\d.]+:)?)(\d+)(:\d+(?:/\w+)?)["']?\s*$`)
+
+// renderSlotComposeOverride generates the slot's compose override: project
+// name, slot-specific container names, remapped literal host ports and the
+// per-slot network. Port lists use !override so main's host ports aren't merged in.
+func renderSlotComposeOverride(composeContent, dockerName string, portMap map[int]int) string {
+	serviceRe := regexp.MustCompile(`^  ([a-zA-Z0-9_.-]+):\s*$`)
+	containerRe := regexp.MustCompile(`^\s+container_name:`)
+	portsRe := regexp.MustCompile(`^\s+ports:\s*$`)
+
+	type serviceOverride struct {
+		name          string
+		containerName bool
+		ports         []string
+		remapped      bool
+	}
+	var services []*serviceOverride
+	var current *serviceOverride
+	inServices := false
+	inPorts := false
+
+	for _, line := range strings.Split(composeContent, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
 		}
-
-		if slotPgPort == 0 {
-			fmt.Println("  ⚠ No POSTGRES_PORT found in slot, skipping")
+		if !strings.HasPrefix(line, " ") {
+			inServices = strings.HasPrefix(line, "services:")
+			current = nil
+			inPorts = false
 			continue
 		}
-
-		if mainPgPort == 0 {
-			fmt.Println("  ⚠ No POSTGRES_PORT found in main, skipping")
+		if !inServices {
 			continue
 		}
-
-		fmt.Printf("  Main DB: localhost:%d\n", mainPgPort)
-		fmt.Printf("  Slot DB: localhost:%d\n", slotPgPort)
-
-		// Check if main DB is running
-		if !isPostgresReady(mainPgPort, pgUser, pgPass, pgDB) {
-			fmt.Printf("  ⚠ Main DB not running on port %d, skipping\n", mainPgPort)
+		if m := serviceRe.FindStringSubmatch(line); m != nil {
+			current = &serviceOverride{name: m[1]}
+			services = append(services, current)
+			inPorts = false
 			continue
 		}
-
-		// Check if slot DB is running, start if not
-		if !isPostgresReady(slotPgPort, pgUser, pgPass, pgDB) {
-			fmt.Println("  Starting slot DB...")
-			startDockerCompose(composeDir)
-			if !waitForPostgres(slotPgPort, pgUser, pgPass, pgDB, 30) {
-				fmt.Println("  ⚠ Could not start slot DB, skipping")
+		if current == nil {
+			continue
+		}
+		if containerRe.MatchString(line) {
+			current.containerName = true
+			inPorts = false
+			continue
+		}
+		if portsRe.MatchString(line) {
+			inPorts = true
+			continue
+		}
+		if inPorts {
+			if !strings.HasPrefix(trimmed, "-") {
+				inPorts = false
 				continue
 			}
+			entry := strings.Trim(strings.TrimSpace(strings.TrimPrefix(trimmed, "-")), `"'`)
+			if m := composePortRe.FindStringSubmatch(line); m != nil {
+				if hostPort, err := strconv.Atoi(m[3]); err == nil {
+					if slotPort, ok := portMap[hostPort]; ok {
+						entry = fmt.Sprintf("%s%d%s", m[2], slotPort, m[4])
+						current.remapped = true
+					}
+				}
+			}
+			current.ports = append(current.ports, entry)
 		}
+	}
 
-		// Clone database
-		fmt.Printf("  Cloning %s...\n", pgDB)
-		if err := cloneDatabase(mainPgPort, slotPgPort, pgUser, pgPass, pgDB); err != nil {
-			fmt.Printf("  ✗ Failed to sync: %v\n", err)
+	lines := []string{
+		"# Generated by slot-cli — do not edit",
+		"name: " + dockerName,
+	}
+
+	var serviceLines []string
+	for _, svc := range services {
+		if !svc.containerName && !svc.remapped {
 			continue
 		}
-		fmt.Println("  ✓ Database synced")
-		synced++
+		serviceLines = append(serviceLines, fmt.Sprintf("  %s:", svc.name))
+		if svc.containerName {
+			serviceLines = append(serviceLines, fmt.Sprintf("    container_name: %s-%s", dockerName, svc.name))
+		}
+		if svc.remapped {
+			serviceLines = append(serviceLines, "    ports: !override")
+			for _, p := range svc.ports {
+				serviceLines = append(serviceLines, fmt.Sprintf("      - \"%s\"", p))
+			}
+		}
 	}
-
-	fmt.Println()
-	if synced > 0 {
-		fmt.Printf("✓ Synced %d database(s) from main\n", synced)
-	} else {
-		fmt.Println("⚠ No databases were synced")
+	if len(serviceLines) > 0 {
+		lines = append(lines, "services:")
+		lines = append(lines, serviceLines...)
 	}
+
+	lines = append(lines,
+		"networks:",
+		"  default:",
+		"    name: "+dockerName,
+		"    external: true",
+	)
+	return strings.Join(lines, "\n") + "\n"
 }
 
-// Helper functions
+// ensureDockerComposeEnvFiles creates .env files next to docker-compose.yml
+// when they don't exist. Without this, docker-compose uses fallback defaults
+// for ${VAR:-default} references instead of the slot-specific ports.
+func ensureDockerComposeEnvFiles(slotPath string, portMap map[int]int, slotName string) {
+	dockerName := ports.DockerName(slotName)
 
-func detectProject(cwd string) (mainRepo, project string) {
-	// Check if in worktree
-	gitFile := filepath.Join(cwd, ".git")
-	if info, err := os.Stat(gitFile); err == nil && !info.IsDir() {
-		content, _ := os.ReadFile(gitFile)
-		// Parse: gitdir: /path/to/main/.git/worktrees/name
-		line := strings.TrimSpace(string(content))
-		if strings.HasPrefix(line, "gitdir:") {
-			gitdir := strings.TrimSpace(strings.TrimPrefix(line, "gitdir:"))
-			// Extract main repo path
-			if idx := strings.Index(gitdir, "/.git/worktrees"); idx > 0 {
-				mainRepo = gitdir[:idx]
-				project = filepath.Base(mainRepo)
-				return
+	defer forgetFiles(slotPath)
+	for _, path := range findComposeFiles(slotPath) {
+		if !composeFileIncluded(slotPath, path) {
+			continue
+		}
+
+		dir := filepath.Dir(path)
+		envPath := filepath.Join(dir, ".env")
+
+		// If .env or .env.local already exists, skip (updateSlotEnvFiles handled it)
+		if _, err := os.Stat(envPath); err == nil {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dir, ".env.local")); err == nil {
+			continue
+		}
+
+		envRel, _ := filepath.Rel(slotPath, envPath)
+
+		// Try .env.example or .env.sample as template
+		created := false
+		for _, tmpl := range []string{".env.example", ".env.sample"} {
+			tmplPath := filepath.Join(dir, tmpl)
+			if content, err := os.ReadFile(tmplPath); err == nil {
+				newContent := ports.ReplaceInEnv(string(content), portMap, slotName)
+				os.WriteFile(envPath, []byte(newContent), 0644)
+				fmt.Printf("  Created: %s (from %s)\n", envRel, tmpl)
+				created = true
+				break
 			}
 		}
-	}
+		if created {
+			continue
+		}
 
-	// Check if in main repo
-	if _, err := os.Stat(filepath.Join(cwd, ".git")); err == nil {
-		mainRepo = cwd
-		project = filepath.Base(cwd)
-		return
-	}
+		// No template - generate from docker-compose.yml ${VAR:-default} patterns
+		composeContent, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
 
-	return "", ""
-}
+		varRe := regexp.MustCompile(`\$\{([A-Z_]+)(?::-(\d+))?\}`)
+		matches := varRe.FindAllStringSubmatch(string(composeContent), -1)
 
-func findNextSlotNumber(mainRepo, project string) int {
-	parentDir := filepath.Dir(mainRepo)
-	pattern := filepath.Join(parentDir, project+"-*")
-	matches, _ := filepath.Glob(pattern)
+		lines := []string{"COMPOSE_PROJECT_NAME=" + dockerName}
+		seen := map[string]bool{"COMPOSE_PROJECT_NAME": true}
+
+		for _, m := range matches {
+			varName := m[1]
+			if seen[varName] {
+				continue
+			}
+			seen[varName] = true
 
-	maxNum := 0
-	re := regexp.MustCompile(`-(\d+)$`)
-	for _, m := range matches {
-		if match := re.FindStringSubmatch(filepath.Base(m)); len(match) > 1 {
-			if n, err := strconv.Atoi(match[1]); err == nil && n > maxNum {
-				maxNum = n
+			// If the default value matches a main port, write the slot port
+			if len(m) > 2 && m[2] != "" {
+				if defaultPort, err := strconv.Atoi(m[2]); err == nil {
+					if slotPort, ok := portMap[defaultPort]; ok {
+						lines = append(lines, fmt.Sprintf("%s=%d", varName, slotPort))
+					}
+				}
 			}
 		}
+
+		os.WriteFile(envPath, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+		fmt.Printf("  Created: %s (generated for docker-compose)\n", envRel)
 	}
-	return maxNum + 1
 }
 
-func runCmd(dir string, name string, args ...string) error {
-	cmd := exec.Command(name, args...)
-	cmd.Dir = dir
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
-}
+func startDockerAndClone(mainRepo, slotPath string, compose ComposeSelection, withRedis, cloneData, sharedPostgres bool, timings *Timings) {
+	// Find docker-compose files
+	composeFiles := findComposeFiles(slotPath)
 
-func copyGitignored(mainRepo, slotPath string) {
-	cmd := exec.Command("git", "ls-files", "--others", "--ignored", "--exclude-standard")
-	cmd.Dir = mainRepo
-	out, err := cmd.Output()
-	if err != nil {
+	if len(composeFiles) == 0 {
 		return
 	}
 
-	skipPatterns := []string{
-		"node_modules", "dist/", "build/", ".next/", ".log",
-		".husky/", "backups/", ".turbo/", ".venv/", ".trunk/", "coverage/",
-	}
+	if cloneData {
+		fmt.Println("\nStarting docker and cloning database...")
+	} else {
+		fmt.Println("\nStarting docker...")
+	}
+
+	_, project := worktree.DetectProject(mainRepo)
+	dumpJobs := loadRegistry().Projects[project].DumpJobs
+	cloned := 0
+
+	for _, composeFile := range composeFiles {
+		composeDir := filepath.Dir(composeFile)
+		mainComposeDir := strings.Replace(composeDir, slotPath, mainRepo, 1)
 
-	for _, file := range strings.Split(string(out), "\n") {
-		file = strings.TrimSpace(file)
-		if file == "" {
-			continue
+		var targets []dbclone.Target
+		for _, t := range findDBTargets(composeFile, mainComposeDir) {
+			if t.SlotPort == 0 {
+				fmt.Printf("  Skipping %s in %s: no %s\n", t.Engine, filepath.Base(composeDir), t.PortVar)
+				continue
+			}
+			targets = append(targets, t)
 		}
 
-		// Skip patterns
-		skip := false
-		for _, p := range skipPatterns {
-			if strings.Contains(file, p) {
-				skip = true
-				break
+		var redisTargets []dbclone.Target
+		if withRedis {
+			for _, t := range findRedisTargets(composeFile, mainComposeDir) {
+				if t.SlotPort == 0 {
+					fmt.Printf("  Skipping redis in %s: no %s\n", filepath.Base(composeDir), t.PortVar)
+					continue
+				}
+				redisTargets = append(redisTargets, t)
 			}
 		}
-		if skip {
+
+		if len(targets) == 0 && len(redisTargets) == 0 {
 			continue
 		}
 
-		srcPath := filepath.Join(mainRepo, file)
-		info, err := os.Stat(srcPath)
-		if err != nil || info.IsDir() || info.Size() > 1048576 {
+		// Start docker
+		fmt.Printf("  Starting docker in %s...\n", filepath.Base(composeDir))
+		done := timings.Track("docker up")
+		startDockerCompose(composeDir, compose)
+		done()
+		if !cloneData {
 			continue
 		}
 
-		dstPath := filepath.Join(slotPath, file)
-		os.MkdirAll(filepath.Dir(dstPath), 0755)
+		for _, t := range targets {
+			if sharedPostgres && t.Engine == "postgres" {
+				done := timings.Track("db clone")
+				if cloneSharedDB(mainRepo, project, filepath.Base(slotPath), t) {
+					cloned++
+				}
+				done()
+				continue
+			}
 
-		content, err := os.ReadFile(srcPath)
-		if err == nil {
-			os.WriteFile(dstPath, content, info.Mode())
+			// Wait for the database
+			fmt.Printf("  Waiting for %s on port %d...\n", t.Engine, t.SlotPort)
+			done := timings.Track("docker up")
+			dbclone.Wait(t.DBService, t.SlotPort, 30)
+			done()
+
+			// Clone database if main is running
+			done = timings.Track("db clone")
+			if t.MainPort > 0 && dbclone.Ready(t.DBService, t.MainPort) {
+				fmt.Printf("  Cloning %s from port %d to %d...\n", t.Engine, t.MainPort, t.SlotPort)
+				if err := dbclone.Clone(t.DBService, t.MainPort, t.SlotPort, dbclone.DumpOptions{Jobs: dumpJobs}); err != nil {
+					fmt.Printf("  ✗ Failed to clone: %v\n", err)
+				} else {
+					fmt.Println("  ✓ Database cloned")
+					anonymizeAfterClone(mainRepo, t.DBService, t.SlotPort)
+					cloned++
+				}
+			} else {
+				fmt.Printf("  ⚠ Main %s not running on port %d, skipping clone\n", t.Engine, t.MainPort)
+			}
+			done()
+		}
+
+		for _, t := range redisTargets {
+			fmt.Printf("  Waiting for redis on port %d...\n", t.SlotPort)
+			done := timings.Track("docker up")
+			dbclone.Wait(t.DBService, t.SlotPort, 30)
+			done()
+
+			done = timings.Track("db clone")
+			if t.MainPort > 0 && dbclone.Ready(t.DBService, t.MainPort) {
+				fmt.Printf("  Copying redis data from port %d to %d...\n", t.MainPort, t.SlotPort)
+				if err := copyRedisData(t, composeDir); err != nil {
+					fmt.Printf("  ✗ Failed to copy redis: %v\n", err)
+				} else {
+					fmt.Println("  ✓ Redis data copied")
+				}
+			} else {
+				fmt.Printf("  ⚠ Main redis not running on port %d, skipping copy\n", t.MainPort)
+			}
+			done()
 		}
 	}
-}
 
-func scanAndAllocatePorts(mainRepo string, slotNum int) map[int]int {
-	portMap := make(map[int]int)
-	portVars := make(map[int]string) // port -> variable name for display
+	if cloned > 0 {
+		done := timings.Track("migrations")
+		runMigrations(mainRepo, slotPath, composeFiles)
+		done()
+	}
+}
 
-	fmt.Println("Scanning main project ports...")
+// firstNonEmpty returns the first non-empty value
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
 
-	// Scan all relevant files for ports
-	filepath.Walk(mainRepo, func(path string, info os.FileInfo, err error) error {
-		if err != nil || info.IsDir() {
-			return nil
+// readComposeEnvPort reads a port variable from the env files in a compose dir
+func readComposeEnvPort(dir, varName string) int {
+	for _, envName := range []string{".env.local", ".env"} {
+		if port := readEnvVar(filepath.Join(dir, envName), varName); port > 0 {
+			return port
 		}
+	}
+	return 0
+}
 
-		// Skip unwanted directories
-		rel, _ := filepath.Rel(mainRepo, path)
-		skipDirs := []string{"node_modules", ".next", "dist", ".git"}
-		for _, skip := range skipDirs {
-			if strings.Contains(rel, skip) {
-				return nil
+// resolveDBPort reads a database's host port from the env files in dir,
+// falling back to the engine's connection URI variables
+func resolveDBPort(dir string, db dbclone.DBService) int {
+	if port := readComposeEnvPort(dir, db.PortVar); port > 0 {
+		return port
+	}
+	for _, envName := range []string{".env.local", ".env"} {
+		content, err := os.ReadFile(filepath.Join(dir, envName))
+		if err != nil {
+			continue
+		}
+		engine := dbclone.Engines[db.Engine]
+		for _, uriVar := range engine.URIVars {
+			if port := ports.FromLocalURI(parseEnvVarString(string(content), uriVar), engine.URIScheme); port > 0 {
+				return port
 			}
 		}
+	}
+	return 0
+}
 
-		baseName := filepath.Base(path)
-		isEnvFile := (baseName == ".env" || baseName == ".env.local")
-		isConfigFile := baseName == ".mcp.json"
-
-		if !isEnvFile && !isConfigFile {
-			return nil
-		}
+// findDBTargets detects the databases in a slot compose file and resolves
+// their host ports in the slot and in main
+func findDBTargets(composeFile, mainComposeDir string) []dbclone.Target {
+	return resolveDBTargets(composeFile, mainComposeDir, dbclone.Detect)
+}
 
-		content, err := os.ReadFile(path)
-		if err != nil {
-			return nil
-		}
+// findRedisTargets is findDBTargets for redis services
+func findRedisTargets(composeFile, mainComposeDir string) []dbclone.Target {
+	return resolveDBTargets(composeFile, mainComposeDir, dbclone.DetectRedis)
+}
 
-		portRe := regexp.MustCompile(`^([A-Z_]*PORT)=["']?(\d+)["']?`)
-		urlPortRe := regexp.MustCompile(`localhost:(\d+)`)
+func resolveDBTargets(composeFile, mainComposeDir string, detect func(string) []dbclone.DBService) []dbclone.Target {
+	content, err := os.ReadFile(composeFile)
+	if err != nil {
+		return nil
+	}
+	composeDir := filepath.Dir(composeFile)
 
-		for _, line := range strings.Split(string(content), "\n") {
-			// Skip comments
-			if strings.HasPrefix(strings.TrimSpace(line), "#") {
-				continue
-			}
+	var targets []dbclone.Target
+	for _, db := range detect(string(content)) {
+		targets = append(targets, dbclone.Target{
+			DBService: db,
+			MainPort:  resolveDBPort(mainComposeDir, db),
+			SlotPort:  resolveDBPort(composeDir, db),
+		})
+	}
+	return targets
+}
 
-			// Check for PORT= or *_PORT= variables (env files)
-			if isEnvFile {
-				if m := portRe.FindStringSubmatch(line); len(m) > 2 {
-					if port, err := strconv.Atoi(m[2]); err == nil && port > 1000 {
-						if _, exists := portMap[port]; !exists {
-							portVars[port] = m[1]
-						}
-					}
-				}
+// mainPostgres returns main's postgres databases, which shared-postgres
+// slots get their own databases on
+func mainPostgres(mainRepo string) []dbclone.Target {
+	var targets []dbclone.Target
+	for _, composeFile := range findComposeFiles(mainRepo) {
+		for _, t := range findDBTargets(composeFile, filepath.Dir(composeFile)) {
+			if t.Engine == "postgres" && t.MainPort > 0 {
+				targets = append(targets, t)
 			}
+		}
+	}
+	return targets
+}
 
-			// Check for localhost:PORT in URLs (all files)
-			for _, m := range urlPortRe.FindAllStringSubmatch(line, -1) {
-				if port, err := strconv.Atoi(m[1]); err == nil && port > 1000 {
-					if _, exists := portMap[port]; !exists {
-						if _, hasVar := portVars[port]; !hasVar {
-							portVars[port] = "URL"
-						}
-					}
-				}
+// postgresServices returns the compose services a shared-postgres slot
+// doesn't start
+func postgresServices(slotPath string) []string {
+	var services []string
+	for _, composeFile := range findComposeFiles(slotPath) {
+		content, _ := os.ReadFile(composeFile)
+		for _, db := range dbclone.Detect(string(content)) {
+			if db.Engine == "postgres" && !slices.Contains(services, db.Service) {
+				services = append(services, db.Service)
 			}
 		}
+	}
+	return services
+}
 
-		return nil
+// renameSlotDB rewrites the slot's .env files from main's database to its own
+func renameSlotDB(slotPath string, port int, oldDB, newDB string) {
+	scanFiles(slotPath, func(path string) bool {
+		rel, _ := filepath.Rel(slotPath, path)
+		base := filepath.Base(path)
+		return !strings.Contains(rel, "node_modules") && (base == ".env" || base == ".env.local")
+	}, func(path string, content []byte) {
+		newContent := dbclone.RenameDBInEnv(string(content), port, oldDB, newDB)
+		if newContent == string(content) {
+			return
+		}
+		if info, err := os.Stat(path); err == nil {
+			rel, _ := filepath.Rel(slotPath, path)
+			writeSlotFile(slotPath, rel, newContent, info.Mode())
+		}
 	})
+}
 
-	// Allocate slot ports (collision-aware)
-	portMap = allocateSlotPorts(portVars, slotNum)
+// cloneSharedDB copies main's database into the slot's on the same server
+func cloneSharedDB(mainRepo, project, slotName string, t dbclone.Target) bool {
+	name := dbclone.SharedDBName(t.DB, project, slotName)
+	if !dbclone.Ready(t.DBService, t.MainPort) {
+		fmt.Printf("  ⚠ Main postgres not running on port %d, %s not created (slot-cli db-sync later)\n", t.MainPort, name)
+		return false
+	}
+	// CREATE DATABASE ... TEMPLATE needs the source idle, so main's sessions are cut
+	fmt.Printf("  ⚠ Cloning closes every connection to %s on port %d; main's app reconnects on its next query\n", t.DB, t.MainPort)
+	if !confirm(fmt.Sprintf("  Disconnect main from %s to clone it?", t.DB)) {
+		fmt.Printf("  %s not created (slot-cli db-sync later)\n", name)
+		return false
+	}
+	fmt.Printf("  Cloning %s into %s on main's postgres (port %d)...\n", t.DB, name, t.MainPort)
+	if err := dbclone.CloneTemplate(t.DBService, t.MainPort, name); err != nil {
+		fmt.Printf("  ✗ %v\n", err)
+		return false
+	}
+	fmt.Println("  ✓ Database cloned")
+	slotDB := t.DBService
+	slotDB.DB = name
+	return anonymizeAfterClone(mainRepo, slotDB, t.MainPort)
+}
 
-	// Verify system availability and adjust if needed
-	for mainPort, slotPort := range portMap {
-		for !isPortAvailable(slotPort) {
-			fmt.Printf("  Port %d in use, trying next...\n", slotPort)
-			slotPort++
+// dropSharedDBs drops a shared-postgres slot's databases from main's
+// instance once the slot is gone for good: delete --no-trash, done and
+// trash purges. Trashed slots keep them so undelete gets them back. A
+// variable so tests can watch the drops.
+var dropSharedDBs = func(mainRepo, project, slotName string) {
+	for _, t := range mainPostgres(mainRepo) {
+		name := dbclone.SharedDBName(t.DB, project, slotName)
+		if err := dbclone.DropDatabase(t.DBService, t.MainPort, name); err != nil {
+			fmt.Printf("⚠ Could not drop %s: %v\n", name, err)
+		} else {
+			fmt.Printf("✓ Dropped database %s\n", name)
 		}
-		portMap[mainPort] = slotPort
-		fmt.Printf("  %s: %d → %d\n", portVars[mainPort], mainPort, slotPort)
 	}
-
-	return portMap
 }
 
-// allocateSlotPorts is a pure function that allocates slot ports while avoiding
-// collisions with main ports and already-allocated slot ports.
-func allocateSlotPorts(mainPorts map[int]string, slotNum int) map[int]int {
-	// Build reserved set from all main port values
-	reserved := make(map[int]bool)
-	for port := range mainPorts {
-		reserved[port] = true
+func parseEnvVarInt(content, varName string) int {
+	re := regexp.MustCompile(fmt.Sprintf(`(?m)^%s=["']?(\d+)["']?`, regexp.QuoteMeta(varName)))
+	if m := re.FindStringSubmatch(content); len(m) > 1 {
+		if n, err := strconv.Atoi(m[1]); err == nil {
+			return n
+		}
 	}
+	return 0
+}
 
-	// Sort main ports for deterministic allocation order
-	sorted := make([]int, 0, len(mainPorts))
-	for port := range mainPorts {
-		sorted = append(sorted, port)
+func parseEnvVarString(content, varName string) string {
+	re := regexp.MustCompile(fmt.Sprintf(`(?m)^%s=["']?([^"'\r\n]*)["']?`, regexp.QuoteMeta(varName)))
+	if m := re.FindStringSubmatch(content); len(m) > 1 {
+		return strings.TrimSpace(m[1])
 	}
-	sort.Ints(sorted)
+	return ""
+}
 
-	portMap := make(map[int]int)
-	for _, mainPort := range sorted {
-		slotPort := mainPort + slotNum
-		// Skip ports that are reserved (main ports or already-allocated slot ports)
-		for reserved[slotPort] {
-			slotPort++
+// readComposeProjectName returns COMPOSE_PROJECT_NAME from the env files in a compose dir
+func readComposeProjectName(dir string) string {
+	for _, envFile := range []string{".env.local", ".env"} {
+		content, err := os.ReadFile(filepath.Join(dir, envFile))
+		if err != nil {
+			continue
+		}
+		if name := parseEnvVarString(string(content), "COMPOSE_PROJECT_NAME"); name != "" {
+			return name
 		}
-		portMap[mainPort] = slotPort
-		reserved[slotPort] = true
 	}
-
-	return portMap
+	return ""
 }
 
-func isPortAvailable(port int) bool {
-	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+func readEnvVar(path, varName string) int {
+	content, err := os.ReadFile(path)
 	if err != nil {
-		return false
+		return 0
 	}
-	ln.Close()
-	return true
+	return parseEnvVarInt(string(content), varName)
+}
+
+func startDockerCompose(dir string, compose ComposeSelection) {
+	// Attach the slot to its own network so containers from other slots
+	// can't be discovered through a shared default network
+	composeArgs := []string{"compose"}
+	if networkName := readComposeProjectName(dir); networkName != "" {
+		if fileExists(filepath.Join(dir, slotComposeOverrideName)) {
+			if ensureSlotNetwork(networkName) {
+				composeArgs = append(composeArgs, composeFileArgs(dir)...)
+			}
+		} else if override := ensureSlotNetworkOverride(networkName); override != "" {
+			composeArgs = append(append(composeArgs, composeFileArgs(dir)...), "-f", override)
+		}
+	}
+	composeArgs = append(composeArgs, compose.ProfileArgs()...)
+	upArgs := []string{"up", "-d"}
+	for _, service := range compose.Skip {
+		upArgs = append(upArgs, "--scale", service+"=0")
+	}
+	upArgs = append(upArgs, compose.Services...)
+
+	// Try with .env.local first, then .env
+	for _, envFile := range []string{".env.local", ".env"} {
+		envPath := filepath.Join(dir, envFile)
+		if _, err := os.Stat(envPath); err == nil {
+			cmd := exec.Command("docker", append(append(composeArgs, "--env-file", envFile), upArgs...)...)
+			cmd.Dir = dir
+			if cmd.Run() == nil {
+				return
+			}
+		}
+	}
+
+	// Fallback without env file
+	cmd := exec.Command("docker", append(composeArgs, upArgs...)...)
+	cmd.Dir = dir
+	cmd.Run()
 }
 
-func replacePortsInEnvContent(content string, portMap map[int]int, slotName string) string {
-	dockerName := strings.ToLower(regexp.MustCompile(`[^a-z0-9-]`).ReplaceAllString(slotName, "-"))
+// ComposeSelection is the subset of a compose stack to run for a slot
+type ComposeSelection struct {
+	Profiles []string
+	Services []string
+	Skip     []string // services not started (scaled to 0), e.g. postgres for shared-postgres slots
+}
 
-	newContent := content
+func (c ComposeSelection) IsEmpty() bool {
+	return len(c.Profiles) == 0 && len(c.Services) == 0
+}
 
-	// Replace or add COMPOSE_PROJECT_NAME
-	composeRe := regexp.MustCompile(`(?m)^COMPOSE_PROJECT_NAME=.*$`)
-	if composeRe.MatchString(newContent) {
-		newContent = composeRe.ReplaceAllString(newContent, "COMPOSE_PROJECT_NAME="+dockerName)
-	} else {
-		newContent = "COMPOSE_PROJECT_NAME=" + dockerName + "\n" + newContent
+// ProfileArgs returns the --profile flags to pass before the compose subcommand
+func (c ComposeSelection) ProfileArgs() []string {
+	var args []string
+	for _, p := range c.Profiles {
+		args = append(args, "--profile", p)
 	}
+	return args
+}
 
-	// Replace each port
-	for mainPort, slotPort := range portMap {
-		newContent = strings.ReplaceAll(newContent, fmt.Sprintf("=%d", mainPort), fmt.Sprintf("=%d", slotPort))
-		newContent = strings.ReplaceAll(newContent, fmt.Sprintf("=\"%d\"", mainPort), fmt.Sprintf("=\"%d\"", slotPort))
-		newContent = strings.ReplaceAll(newContent, fmt.Sprintf("localhost:%d", mainPort), fmt.Sprintf("localhost:%d", slotPort))
+func (c ComposeSelection) String() string {
+	var parts []string
+	if len(c.Profiles) > 0 {
+		parts = append(parts, "profiles="+strings.Join(c.Profiles, ","))
 	}
+	if len(c.Services) > 0 {
+		parts = append(parts, "services="+strings.Join(c.Services, ","))
+	}
+	return strings.Join(parts, " ")
+}
 
-	return newContent
+// slotComposeSelection returns the compose subset recorded for a slot
+func slotComposeSelection(slotName string) ComposeSelection {
+	reg := loadRegistry()
+	slot := reg.Slots[slotName]
+	compose := ComposeSelection{Profiles: slot.Profiles, Services: slot.Services}
+	if slot.SharedPostgres {
+		compose.Skip = postgresServices(reg.SlotPath(slotName))
+	}
+	return compose
 }
 
-func updateSlotEnvFiles(slotPath string, portMap map[int]int, slotName string) {
-	fmt.Println("\nUpdating slot .env files...")
+// composeFileIn returns the docker-compose file name used in dir
+func composeFileIn(dir string) string {
+	if _, err := os.Stat(filepath.Join(dir, "docker-compose.yaml")); err == nil {
+		return "docker-compose.yaml"
+	}
+	return "docker-compose.yml"
+}
 
-	filepath.Walk(slotPath, func(path string, info os.FileInfo, err error) error {
-		if err != nil || info.IsDir() {
-			return nil
-		}
+// renderNetworkOverride generates a compose override that replaces the default
+// network with an external per-slot network.
+func renderNetworkOverride(networkName string) string {
+	return fmt.Sprintf("networks:\n  default:\n    name: %s\n    external: true\n", networkName)
+}
 
-		rel, _ := filepath.Rel(slotPath, path)
-		skipDirs := []string{"node_modules", ".next", "dist", ".git"}
-		for _, skip := range skipDirs {
-			if strings.Contains(rel, skip) {
-				return nil
-			}
-		}
+func slotNetworkOverridePath(networkName string) string {
+	return filepath.Join(filepath.Dir(registryPath), "compose", networkName, "network.yml")
+}
 
-		baseName := filepath.Base(path)
-		if !strings.Contains(baseName, ".env") {
-			return nil
-		}
-		// Only modify .env and .env.local — skip .env.production, .env.staging, .env.test, .env.example, etc.
-		if baseName != ".env" && baseName != ".env.local" {
-			return nil
+// composeFileArgs returns the -f flags for a slot compose dir: the compose
+// file, compose's own override (not auto-loaded once -f is used) and the
+// generated slot override
+func composeFileArgs(dir string) []string {
+	args := []string{"-f", composeFileIn(dir)}
+	for _, name := range []string{"docker-compose.override.yml", "docker-compose.override.yaml", slotComposeOverrideName} {
+		if fileExists(filepath.Join(dir, name)) {
+			args = append(args, "-f", name)
 		}
+	}
+	return args
+}
 
-		content, err := os.ReadFile(path)
-		if err != nil {
-			return nil
-		}
+// slotNetworkLabel marks the docker networks slot-cli created, the only ones
+// it removes again
+const slotNetworkLabel = "dev.slot-cli.network"
 
-		newContent := replacePortsInEnvContent(string(content), portMap, slotName)
+// ensureSlotNetwork creates the per-slot docker network if missing
+func ensureSlotNetwork(networkName string) bool {
+	if exec.Command("docker", "network", "inspect", networkName).Run() == nil {
+		return true
+	}
+	if err := exec.Command("docker", "network", "create", "--label", slotNetworkLabel+"=true", networkName).Run(); err != nil {
+		fmt.Printf("  ⚠ Could not create network %s, using compose default\n", networkName)
+		return false
+	}
+	fmt.Printf("  ✓ Created network %s\n", networkName)
+	return true
+}
 
-		if newContent != string(content) {
-			os.WriteFile(path, []byte(newContent), info.Mode())
-			fmt.Printf("  Updated: %s\n", rel)
-		}
+// ensureSlotNetworkOverride creates the per-slot network and writes a
+// network-only override for slots without a generated slot override.
+// Returns the override path, or "" on failure.
+func ensureSlotNetworkOverride(networkName string) string {
+	if !ensureSlotNetwork(networkName) {
+		return ""
+	}
 
-		return nil
-	})
+	overridePath := slotNetworkOverridePath(networkName)
+	os.MkdirAll(filepath.Dir(overridePath), 0755)
+	if err := os.WriteFile(overridePath, []byte(renderNetworkOverride(networkName)), 0644); err != nil {
+		return ""
+	}
+	return overridePath
 }
 
-func updateConfigFiles(slotPath string, portMap map[int]int) {
-	fmt.Println("\nUpdating config files...")
-
-	filepath.Walk(slotPath, func(path string, info os.FileInfo, err error) error {
-		if err != nil || info.IsDir() {
-			return nil
-		}
+// removeSlotNetwork deletes the per-slot network (if slot-cli created it)
+// and its compose override
+func removeSlotNetwork(networkName string) {
+	label, err := exec.Command("docker", "network", "inspect", "-f", `{{index .Labels "`+slotNetworkLabel+`"}}`, networkName).Output()
+	if err == nil && strings.TrimSpace(string(label)) == "true" && exec.Command("docker", "network", "rm", networkName).Run() == nil {
+		fmt.Printf("  ✓ Removed network %s\n", networkName)
+	}
+	os.RemoveAll(filepath.Dir(slotNetworkOverridePath(networkName)))
+}
 
-		rel, _ := filepath.Rel(slotPath, path)
-		skipDirs := []string{"node_modules", ".next", "dist", ".git"}
-		for _, skip := range skipDirs {
-			if strings.Contains(rel, skip) {
-				return nil
-			}
-		}
+// anonymizeAfterClone runs the project's anonymization script and column masks
+// against a freshly cloned slot database. Returns false if anonymization was
+// configured but failed, so callers don't report the DB as ready.
+func anonymizeAfterClone(mainRepo string, db dbclone.DBService, port int) bool {
+	_, project := worktree.DetectProject(mainRepo)
+	cfg := loadRegistry().Projects[project]
+	if cfg.AnonymizeScript == "" && len(cfg.Masks) == 0 {
+		return true
+	}
 
-		baseName := filepath.Base(path)
-		// Only modify .mcp.json (gitignored) — skip package.json (tracked, creates dirty files)
-		if baseName != ".mcp.json" {
-			return nil
-		}
+	if db.Engine != "postgres" && db.Engine != "mysql" {
+		fmt.Printf("  ⚠ Anonymization is not supported for %s, data was NOT anonymized\n", db.Engine)
+		return false
+	}
 
-		content, err := os.ReadFile(path)
+	var script strings.Builder
+	if cfg.AnonymizeScript != "" {
+		content, err := os.ReadFile(filepath.Join(mainRepo, cfg.AnonymizeScript))
 		if err != nil {
-			return nil
-		}
-
-		newContent := string(content)
-
-		// Replace localhost:PORT patterns
-		for mainPort, slotPort := range portMap {
-			newContent = strings.ReplaceAll(newContent, fmt.Sprintf("localhost:%d", mainPort), fmt.Sprintf("localhost:%d", slotPort))
+			fmt.Printf("  ✗ Could not read anonymize script: %v\n", err)
+			return false
 		}
+		script.Write(content)
+		script.WriteString("\n")
+	}
+	script.WriteString(dbclone.MaskSQL(cfg.Masks))
 
-		if newContent != string(content) {
-			os.WriteFile(path, []byte(newContent), info.Mode())
-			fmt.Printf("  Updated: %s\n", rel)
-		}
+	fmt.Println("  Anonymizing data...")
+	if err := dbclone.RunSQL(db, port, script.String()); err != nil {
+		fmt.Printf("  ✗ Anonymization failed, data was NOT anonymized: %v\n", err)
+		return false
+	}
+	fmt.Println("  ✓ Data anonymized")
+	return true
+}
 
-		return nil
-	})
+// composeProjectName returns the compose project name for a compose dir:
+// COMPOSE_PROJECT_NAME from its env files, or compose's directory-name default
+func composeProjectName(dir string) string {
+	if name := readComposeProjectName(dir); name != "" {
+		return name
+	}
+	return strings.ToLower(regexp.MustCompile(`[^a-z0-9_-]`).ReplaceAllString(strings.ToLower(filepath.Base(dir)), ""))
 }
 
-func updateDockerComposeFiles(slotPath, slotName string) {
-	dockerName := strings.ToLower(regexp.MustCompile(`[^a-z0-9-]`).ReplaceAllString(slotName, "-"))
-
-	filepath.Walk(slotPath, func(path string, info os.FileInfo, err error) error {
-		if err != nil || info.IsDir() {
-			return nil
+// findDataVolume returns the container and named volume mounted at dataDir
+// for a compose project
+func findDataVolume(project, dataDir string) (container, volume string) {
+	out, err := exec.Command("docker", "ps", "-a", "--filter", "label=com.docker.compose.project="+project, "--format", "{{.Names}}").Output()
+	if err != nil {
+		return "", ""
+	}
+	for _, name := range strings.Fields(string(out)) {
+		volOut, err := exec.Command("docker", "inspect", "-f",
+			`{{range .Mounts}}{{if eq .Destination "`+dataDir+`"}}{{.Name}}{{end}}{{end}}`, name).Output()
+		if err != nil {
+			continue
 		}
-
-		if info.Name() != "docker-compose.yml" && info.Name() != "docker-compose.yaml" {
-			return nil
+		if v := strings.TrimSpace(string(volOut)); v != "" {
+			return name, v
 		}
+	}
+	return "", ""
+}
 
-		content, err := os.ReadFile(path)
-		if err != nil {
-			return nil
-		}
+// cloneDatabaseVolume copies the main database data volume into the slot's
+// volume using a throwaway container. Both containers are stopped during the
+// copy so the data directory is consistent, then started again.
+func cloneDatabaseVolume(mainComposeDir, slotComposeDir, dataDir string) error {
+	mainContainer, mainVolume := findDataVolume(composeProjectName(mainComposeDir), dataDir)
+	if mainVolume == "" {
+		return fmt.Errorf("no data volume found for main")
+	}
+	slotContainer, slotVolume := findDataVolume(composeProjectName(slotComposeDir), dataDir)
+	if slotVolume == "" {
+		return fmt.Errorf("no data volume found for slot (start it once first)")
+	}
+	if mainVolume == slotVolume {
+		return fmt.Errorf("main and slot share volume %s", mainVolume)
+	}
 
-		newContent := string(content)
+	fmt.Printf("  %s → %s\n", mainVolume, slotVolume)
 
-		// Replace hardcoded container_name with dynamic one
-		// Pattern: container_name: something-db or container_name: something
-		containerRe := regexp.MustCompile(`(?m)(container_name:\s*)([a-zA-Z0-9_-]+)`)
-		newContent = containerRe.ReplaceAllString(newContent, "${1}${COMPOSE_PROJECT_NAME:-"+dockerName+"}-db")
+	exec.Command("docker", "stop", slotContainer).Run()
+	if err := exec.Command("docker", "stop", mainContainer).Run(); err != nil {
+		exec.Command("docker", "start", slotContainer).Run()
+		return fmt.Errorf("failed to stop main container %s: %w", mainContainer, err)
+	}
+	defer exec.Command("docker", "start", mainContainer).Run()
 
-		if newContent != string(content) {
-			os.WriteFile(path, []byte(newContent), info.Mode())
-			rel, _ := filepath.Rel(slotPath, path)
-			fmt.Printf("  Updated: %s (container_name)\n", rel)
-		}
+	copyCmd := exec.Command("docker", "run", "--rm",
+		"-v", mainVolume+":/from:ro",
+		"-v", slotVolume+":/to",
+		"alpine", "sh", "-c", "rm -rf /to/..?* /to/.[!.]* /to/* && cp -a /from/. /to/")
+	copyCmd.Stderr = os.Stderr
+	if err := copyCmd.Run(); err != nil {
+		return fmt.Errorf("volume copy failed: %w", err)
+	}
 
-		return nil
-	})
+	if err := exec.Command("docker", "start", slotContainer).Run(); err != nil {
+		return fmt.Errorf("failed to restart slot container %s: %w", slotContainer, err)
+	}
+	return nil
 }
 
-// ensureDockerComposeEnvFiles creates .env files next to docker-compose.yml
-// when they don't exist. Without this, docker-compose uses fallback defaults
-// for ${VAR:-default} references instead of the slot-specific ports.
-func ensureDockerComposeEnvFiles(slotPath string, portMap map[int]int, slotName string) {
-	dockerName := strings.ToLower(regexp.MustCompile(`[^a-z0-9-]`).ReplaceAllString(slotName, "-"))
+// copyRedisData snapshots main's redis with `redis-cli --rdb`, copies the dump
+// into the slot's redis container and restarts it so the dump is loaded.
+func copyRedisData(t dbclone.Target, slotComposeDir string) error {
+	tmpFile, err := os.CreateTemp("", "slot-redis-*.rdb")
+	if err != nil {
+		return err
+	}
+	tmpFile.Close()
+	defer os.Remove(tmpFile.Name())
 
-	filepath.Walk(slotPath, func(path string, info os.FileInfo, err error) error {
-		if err != nil || info.IsDir() {
-			return nil
-		}
+	if out, err := exec.Command("redis-cli", append(dbclone.RedisArgs(t.MainPort, t.Pass), "--rdb", tmpFile.Name())...).CombinedOutput(); err != nil {
+		return fmt.Errorf("redis-cli --rdb failed: %s", strings.TrimSpace(string(out)))
+	}
 
-		rel, _ := filepath.Rel(slotPath, path)
-		for _, skip := range []string{"node_modules", ".next", "dist", ".git"} {
-			if strings.Contains(rel, skip) {
-				return nil
-			}
-		}
+	out, err := exec.Command("docker", "ps", "-q",
+		"--filter", "label=com.docker.compose.project="+composeProjectName(slotComposeDir),
+		"--filter", "label=com.docker.compose.service="+t.Service).Output()
+	container := strings.TrimSpace(string(out))
+	if err != nil || container == "" {
+		return fmt.Errorf("slot redis container for service '%s' not found", t.Service)
+	}
 
-		if info.Name() != "docker-compose.yml" && info.Name() != "docker-compose.yaml" {
-			return nil
-		}
+	// Stop first so redis doesn't overwrite the copied dump on shutdown
+	if err := exec.Command("docker", "stop", container).Run(); err != nil {
+		return fmt.Errorf("failed to stop slot redis: %w", err)
+	}
+	if err := exec.Command("docker", "cp", tmpFile.Name(), container+":"+dbclone.Engines["redis"].DataDir+"/dump.rdb").Run(); err != nil {
+		exec.Command("docker", "start", container).Run()
+		return fmt.Errorf("docker cp failed: %w", err)
+	}
+	if err := exec.Command("docker", "start", container).Run(); err != nil {
+		return fmt.Errorf("failed to restart slot redis: %w", err)
+	}
 
-		dir := filepath.Dir(path)
-		envPath := filepath.Join(dir, ".env")
+	if !dbclone.Wait(t.DBService, t.SlotPort, 30) {
+		return fmt.Errorf("slot redis did not come back up")
+	}
+	return nil
+}
 
-		// If .env or .env.local already exists, skip (updateSlotEnvFiles handled it)
-		if _, err := os.Stat(envPath); err == nil {
-			return nil
-		}
-		if _, err := os.Stat(filepath.Join(dir, ".env.local")); err == nil {
-			return nil
+// copySQLiteFiles copies SQLite database files from main to the slot.
+// The WAL is checkpointed into the main file first so the copy is complete;
+// if sqlite3 isn't installed the -wal file is copied alongside instead.
+// Returns the number of databases copied.
+func copySQLiteFiles(mainRepo, slotPath string, files []string) int {
+	defer forgetFiles(slotPath)
+	copied := 0
+	for _, rel := range files {
+		src := filepath.Join(mainRepo, rel)
+		dst := filepath.Join(slotPath, rel)
+
+		info, err := os.Stat(src)
+		if err != nil {
+			fmt.Printf("  ⚠ %s not found in main, skipping\n", rel)
+			continue
 		}
 
-		envRel, _ := filepath.Rel(slotPath, envPath)
+		checkpointed := exec.Command("sqlite3", src, "PRAGMA wal_checkpoint(TRUNCATE);").Run() == nil
 
-		// Try .env.example or .env.sample as template
-		for _, tmpl := range []string{".env.example", ".env.sample"} {
-			tmplPath := filepath.Join(dir, tmpl)
-			if content, err := os.ReadFile(tmplPath); err == nil {
-				newContent := replacePortsInEnvContent(string(content), portMap, slotName)
-				os.WriteFile(envPath, []byte(newContent), 0644)
-				fmt.Printf("  Created: %s (from %s)\n", envRel, tmpl)
-				return nil
+		os.MkdirAll(filepath.Dir(dst), 0755)
+		for _, suffix := range []string{"-wal", "-shm"} {
+			os.Remove(dst + suffix)
+		}
+		if err := copyFile(src, dst, info.Mode()); err != nil {
+			fmt.Printf("  ✗ Failed to copy %s: %v\n", rel, err)
+			continue
+		}
+		if !checkpointed {
+			if walInfo, err := os.Stat(src + "-wal"); err == nil {
+				copyFile(src+"-wal", dst+"-wal", walInfo.Mode())
 			}
 		}
+		fmt.Printf("  ✓ Copied %s\n", rel)
+		copied++
+	}
+	return copied
+}
 
-		// No template - generate from docker-compose.yml ${VAR:-default} patterns
-		composeContent, err := os.ReadFile(path)
-		if err != nil {
-			return nil
+// copyFile copies one file, as a copy-on-write clone when possible
+func copyFile(src, dst string, mode os.FileMode) error {
+	if args := cloneTreeArgs(runtime.GOOS, "clone", src, dst); args != nil {
+		if exec.Command(args[0], args[1:]...).Run() == nil {
+			return os.Chmod(dst, mode)
 		}
+	}
 
-		varRe := regexp.MustCompile(`\$\{([A-Z_]+)(?::-(\d+))?\}`)
-		matches := varRe.FindAllStringSubmatch(string(composeContent), -1)
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
 
-		lines := []string{"COMPOSE_PROJECT_NAME=" + dockerName}
-		seen := map[string]bool{"COMPOSE_PROJECT_NAME": true}
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
 
-		for _, m := range matches {
-			varName := m[1]
-			if seen[varName] {
-				continue
-			}
-			seen[varName] = true
+func stopDocker(slotPath string) {
+	compose := slotComposeSelection(filepath.Base(slotPath))
 
-			// If the default value matches a main port, write the slot port
-			if len(m) > 2 && m[2] != "" {
-				if defaultPort, err := strconv.Atoi(m[2]); err == nil {
-					if slotPort, ok := portMap[defaultPort]; ok {
-						lines = append(lines, fmt.Sprintf("%s=%d", varName, slotPort))
-					}
-				}
+	for _, path := range findComposeFiles(slotPath) {
+		dir := filepath.Dir(path)
+		networkName := readComposeProjectName(dir)
+
+		composeArgs := []string{"compose"}
+		if fileExists(filepath.Join(dir, slotComposeOverrideName)) {
+			composeArgs = append(composeArgs, composeFileArgs(dir)...)
+		} else if networkName != "" {
+			if override := slotNetworkOverridePath(networkName); fileExists(override) {
+				composeArgs = append(append(composeArgs, composeFileArgs(dir)...), "-f", override)
 			}
 		}
+		composeArgs = append(composeArgs, compose.ProfileArgs()...)
+		cmd := exec.Command("docker", append(composeArgs, "down", "-v")...)
+		cmd.Dir = dir
+		auditedRun("docker-down", filepath.Base(slotPath), cmd)
 
-		os.WriteFile(envPath, []byte(strings.Join(lines, "\n")+"\n"), 0644)
-		fmt.Printf("  Created: %s (generated for docker-compose)\n", envRel)
-
-		return nil
-	})
+		if networkName != "" {
+			removeSlotNetwork(networkName)
+		}
+	}
 }
 
-func startDockerAndClone(mainRepo, slotPath string, portMap map[int]int) {
-	// Find docker-compose files
-	composeFiles := []string{}
-	filepath.Walk(slotPath, func(path string, info os.FileInfo, err error) error {
-		if err != nil || info.IsDir() {
-			return nil
-		}
-		if info.Name() == "docker-compose.yml" || info.Name() == "docker-compose.yaml" {
-			composeFiles = append(composeFiles, path)
-		}
-		return nil
-	})
+// parseProvisionMode validates a --provision value ("" means install)
+func parseProvisionMode(mode string) string {
+	switch mode {
+	case "", "install", "offline", "clone", "hardlink":
+		return mode
+	}
+	fail(exitUsage, fmt.Sprintf("unknown provision mode '%s' (install, offline, clone, hardlink)", mode))
+	return ""
+}
 
-	if len(composeFiles) == 0 {
-		return
+// cloneTreeArgs returns the command copying main's node_modules into a slot
+// for the clone/hardlink provision modes, or nil if the platform can't
+func cloneTreeArgs(goos, mode, src, dst string) []string {
+	switch {
+	case goos == "darwin" && (mode == "clone" || mode == "hardlink"):
+		return []string{"cp", "-cR", src, dst} // APFS clonefile; BSD cp can't hardlink trees
+	case goos == "linux" && mode == "clone":
+		return []string{"cp", "-a", "--reflink=auto", src, dst}
+	case goos == "linux" && mode == "hardlink":
+		return []string{"cp", "-al", src, dst}
 	}
+	return nil
+}
 
-	fmt.Println("\nStarting docker and cloning database...")
+// PackageManager describes how dependencies are installed for a lockfile
+type PackageManager struct {
+	Ecosystem string     // one manager per ecosystem runs in a directory
+	Lockfiles []string   // any of these marks a directory as using this manager
+	Install   [][]string // commands run in order for a reproducible install
+	Offline   string     // flag preferring the local cache/store, if supported
+}
 
-	for _, composeFile := range composeFiles {
-		composeDir := filepath.Dir(composeFile)
-		mainComposeDir := strings.Replace(composeDir, slotPath, mainRepo, 1)
+var packageManagers = map[string]PackageManager{
+	"pnpm": {"node", []string{"pnpm-lock.yaml"}, [][]string{{"pnpm", "install", "--frozen-lockfile"}}, "--prefer-offline"},
+	"bun":  {"node", []string{"bun.lockb", "bun.lock"}, [][]string{{"bun", "install", "--frozen-lockfile"}}, ""},
+	"yarn": {"node", []string{"yarn.lock"}, [][]string{{"yarn", "install", "--immutable"}}, ""},
+	"npm":  {"node", []string{"package-lock.json"}, [][]string{{"npm", "ci"}}, "--prefer-offline"},
+
+	"poetry": {"python", []string{"poetry.lock"}, [][]string{{"poetry", "install", "--no-root", "--no-interaction"}}, ""},
+	"pip": {"python", []string{"requirements.txt"}, [][]string{
+		{"python3", "-m", "venv", ".venv"},
+		{venvPython(), "-m", "pip", "install", "-r", "requirements.txt"},
+	}, ""},
+
+	"go":       {"go", []string{"go.mod"}, [][]string{{"go", "mod", "download"}}, ""},
+	"cargo":    {"rust", []string{"Cargo.toml"}, [][]string{{"cargo", "fetch"}}, ""},
+	"composer": {"php", []string{"composer.lock"}, [][]string{{"composer", "install", "--no-interaction"}}, ""},
+}
 
-		// Read postgres config from compose file
-		pgUser, pgPass, pgDB := parseDockerCompose(composeFile)
+// packageManagerOrder decides which manager wins when a directory has
+// several lockfiles of the same ecosystem
+var packageManagerOrder = []string{"pnpm", "bun", "yarn", "npm", "poetry", "pip", "go", "cargo", "composer"}
 
-		// Find slot and main postgres ports
-		slotPgPort := 0
-		mainPgPort := 0
+// venvPython is the interpreter inside a project's .venv
+func venvPython() string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(".venv", "Scripts", "python.exe")
+	}
+	return filepath.Join(".venv", "bin", "python")
+}
 
-		// Look for POSTGRES_PORT in slot's env
-		for _, envName := range []string{".env.local", ".env"} {
-			envPath := filepath.Join(composeDir, envName)
-			if port := readEnvVar(envPath, "POSTGRES_PORT"); port > 0 {
-				slotPgPort = port
-				break
-			}
-		}
+// lockfileDir is a directory whose dependencies are installed by Manager
+type lockfileDir struct {
+	Dir      string
+	Manager  string
+	Lockfile string
+}
 
-		// Look for POSTGRES_PORT in main's env
-		for _, envName := range []string{".env.local", ".env"} {
-			envPath := filepath.Join(mainComposeDir, envName)
-			if port := readEnvVar(envPath, "POSTGRES_PORT"); port > 0 {
-				mainPgPort = port
-				break
-			}
+// lockfileSkipDirs hold installed dependencies whose own lockfiles are not
+// projects to install (vendored modules, virtualenvs, cargo build output)
+var lockfileSkipDirs = []string{"vendor", "target", ".venv"}
+
+// inLockfileSkipDir reports whether dir is inside one of lockfileSkipDirs
+func inLockfileSkipDir(root, dir string) bool {
+	rel, err := filepath.Rel(root, dir)
+	if err != nil {
+		return false
+	}
+	for _, part := range strings.Split(filepath.ToSlash(rel), "/") {
+		if slices.Contains(lockfileSkipDirs, part) {
+			return true
 		}
+	}
+	return false
+}
 
-		if slotPgPort == 0 {
-			fmt.Printf("  Skipping %s: no POSTGRES_PORT\n", filepath.Base(composeDir))
+// findLockfileDirs returns every (directory, manager) pair under root, one
+// manager per ecosystem per directory. Dependency and build output dirs are
+// skipped, as are Cargo workspace members (cargo fetch covers the workspace).
+func findLockfileDirs(root string) []lockfileDir {
+	found := make(map[string]map[string]bool) // dir -> lockfile names
+	var dirs []string
+	for _, path := range repoFiles(root) {
+		dir := filepath.Dir(path)
+		if inLockfileSkipDir(root, dir) {
 			continue
 		}
-
-		// Start docker
-		fmt.Printf("  Starting docker in %s...\n", filepath.Base(composeDir))
-		startDockerCompose(composeDir)
-
-		// Wait for postgres
-		fmt.Printf("  Waiting for postgres on port %d...\n", slotPgPort)
-		waitForPostgres(slotPgPort, pgUser, pgPass, pgDB, 30)
-
-		// Clone database if main is running
-		if mainPgPort > 0 && isPostgresReady(mainPgPort, pgUser, pgPass, pgDB) {
-			fmt.Printf("  Cloning database from port %d to %d...\n", mainPgPort, slotPgPort)
-			if err := cloneDatabase(mainPgPort, slotPgPort, pgUser, pgPass, pgDB); err != nil {
-				fmt.Printf("  ✗ Failed to clone: %v\n", err)
-			} else {
-				fmt.Println("  ✓ Database cloned")
-			}
-		} else {
-			fmt.Printf("  ⚠ Main DB not running on port %d, skipping clone\n", mainPgPort)
+		if found[dir] == nil {
+			found[dir] = make(map[string]bool)
+			dirs = append(dirs, dir)
 		}
+		found[dir][filepath.Base(path)] = true
 	}
-}
-
-func parseDockerComposeContent(content string) (user, pass, db string) {
-	user, pass, db = "postgres", "postgres", "postgres"
 
-	for _, line := range strings.Split(content, "\n") {
-		line = strings.TrimSpace(line)
-		if strings.HasPrefix(line, "POSTGRES_USER:") {
-			if v := strings.Trim(strings.TrimPrefix(line, "POSTGRES_USER:"), " \"'"); v != "" {
-				user = v
-			}
-		} else if strings.HasPrefix(line, "POSTGRES_PASSWORD:") {
-			if v := strings.Trim(strings.TrimPrefix(line, "POSTGRES_PASSWORD:"), " \"'"); v != "" {
-				pass = v
+	var result []lockfileDir
+	var cargoRoots []string
+	for _, dir := range dirs {
+		done := make(map[string]bool) // ecosystems already handled in dir
+		for _, name := range packageManagerOrder {
+			pm := packageManagers[name]
+			if done[pm.Ecosystem] {
+				continue
 			}
-		} else if strings.HasPrefix(line, "POSTGRES_DB:") {
-			if v := strings.Trim(strings.TrimPrefix(line, "POSTGRES_DB:"), " \"'"); v != "" {
-				db = v
+			for _, lockfile := range pm.Lockfiles {
+				if !found[dir][lockfile] {
+					continue
+				}
+				if name == "cargo" && slices.ContainsFunc(cargoRoots, func(r string) bool { return worktree.IsWithin(dir, r) }) {
+					break
+				}
+				if name == "cargo" {
+					cargoRoots = append(cargoRoots, dir)
+				}
+				result = append(result, lockfileDir{Dir: dir, Manager: name, Lockfile: lockfile})
+				done[pm.Ecosystem] = true
+				break
 			}
 		}
 	}
-	return
+	return result
 }
 
-func parseDockerCompose(path string) (user, pass, db string) {
-	content, err := os.ReadFile(path)
-	if err != nil {
-		return "postgres", "postgres", "postgres"
+// seedNodeModules copies main's node_modules for a lockfile directory when
+// main's lockfile is identical, so the following install only has to
+// verify. Returns true if it did.
+func seedNodeModules(mainRepo, slotPath string, ld lockfileDir, mode string) bool {
+	rel, _ := filepath.Rel(slotPath, ld.Dir)
+	mainDir := filepath.Join(mainRepo, rel)
+	src := filepath.Join(mainDir, "node_modules")
+	dst := filepath.Join(ld.Dir, "node_modules")
+	if !fileExists(src) || fileExists(dst) {
+		return false
 	}
-	return parseDockerComposeContent(string(content))
-}
 
-func parseEnvVarInt(content, varName string) int {
-	re := regexp.MustCompile(fmt.Sprintf(`(?m)^%s=["']?(\d+)["']?`, regexp.QuoteMeta(varName)))
-	if m := re.FindStringSubmatch(content); len(m) > 1 {
-		if n, err := strconv.Atoi(m[1]); err == nil {
-			return n
-		}
+	mainLock, err1 := os.ReadFile(filepath.Join(mainDir, ld.Lockfile))
+	slotLock, err2 := os.ReadFile(filepath.Join(ld.Dir, ld.Lockfile))
+	if err1 != nil || err2 != nil || string(mainLock) != string(slotLock) {
+		return false
 	}
-	return 0
-}
 
-func readEnvVar(path, varName string) int {
-	content, err := os.ReadFile(path)
-	if err != nil {
-		return 0
+	args := cloneTreeArgs(runtime.GOOS, mode, src, dst)
+	if args == nil {
+		return false
 	}
-	return parseEnvVarInt(string(content), varName)
+	if err := exec.Command(args[0], args[1:]...).Run(); err != nil {
+		os.RemoveAll(dst)
+		return false
+	}
+	return true
 }
 
-func startDockerCompose(dir string) {
-	// Try with .env.local first, then .env
-	for _, envFile := range []string{".env.local", ".env"} {
-		envPath := filepath.Join(dir, envFile)
-		if _, err := os.Stat(envPath); err == nil {
-			cmd := exec.Command("docker", "compose", "--env-file", envFile, "up", "-d")
-			cmd.Dir = dir
-			if cmd.Run() == nil {
-				return
-			}
+// installDeps installs dependencies for every lockfile in the slot, a few at
+// a time, printing each directory's result as one block when it finishes.
+// mode is the project's provision mode (see ProjectConfig.Provision) and
+// override its install setting (see ProjectConfig.Install).
+func installDeps(mainRepo, slotPath, mode, override string) {
+	fmt.Println("\nInstalling dependencies...")
+
+	switch _, known := packageManagers[override]; {
+	case override == "off":
+		fmt.Println("  Skipped (install: off)")
+		return
+	case override != "" && !known:
+		cmd := shellCommand(override)
+		cmd.Dir = slotPath
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			fmt.Printf("  ✗ %s: %v\n", override, err)
+			return
 		}
+		fmt.Printf("  ✓ %s\n", override)
+		return
 	}
 
-	// Fallback without env file
-	cmd := exec.Command("docker", "compose", "up", "-d")
-	cmd.Dir = dir
-	cmd.Run()
-}
-
-func waitForPostgres(port int, user, pass, db string, timeoutSecs int) bool {
-	for i := 0; i < timeoutSecs; i++ {
-		if isPostgresReady(port, user, pass, db) {
-			return true
+	dirs := findLockfileDirs(slotPath)
+	for i := range dirs {
+		if override != "" && packageManagers[dirs[i].Manager].Ecosystem == packageManagers[override].Ecosystem {
+			dirs[i].Manager = override
 		}
-		time.Sleep(time.Second)
 	}
-	return false
-}
-
-func isPostgresReady(port int, user, pass, db string) bool {
-	cmd := exec.Command("psql", "-h", "localhost", "-p", strconv.Itoa(port), "-U", user, "-c", "SELECT 1", db)
-	cmd.Env = append(os.Environ(), "PGPASSWORD="+pass)
-	return cmd.Run() == nil
-}
-
-func cloneDatabase(srcPort, dstPort int, user, pass, db string) error {
-	env := append(os.Environ(), "PGPASSWORD="+pass)
 
-	// Use template1 as maintenance DB to avoid "cannot drop currently open database"
-	// when the target database is named "postgres"
-	maintDB := "template1"
+	sem := make(chan struct{}, min(runtime.NumCPU(), 4))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, ld := range dirs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
 
-	// 1. Terminate existing connections to target DB
-	terminateCmd := fmt.Sprintf(
-		`psql -h localhost -p %d -U %s -d %s -c "SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE datname='%s' AND pid <> pg_backend_pid();"`,
-		dstPort, user, maintDB, db,
-	)
-	cmd := exec.Command("sh", "-c", terminateCmd)
-	cmd.Env = env
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to terminate connections: %w", err)
-	}
+			pm := packageManagers[ld.Manager]
+			rel, _ := filepath.Rel(slotPath, ld.Dir)
+			if _, err := exec.LookPath(pm.Install[0][0]); err != nil {
+				mu.Lock()
+				fmt.Printf("  ⚠ %s not found, skipping %s\n", pm.Install[0][0], rel)
+				mu.Unlock()
+				return
+			}
 
-	// 2. Drop and recreate target DB
-	dropCreateCmd := fmt.Sprintf(
-		`psql -h localhost -p %d -U %s -d %s -c "DROP DATABASE IF EXISTS %s;" -c "CREATE DATABASE %s;"`,
-		dstPort, user, maintDB, db, db,
-	)
-	cmd = exec.Command("sh", "-c", dropCreateCmd)
-	cmd.Env = env
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to drop/create database: %w", err)
-	}
+			start := time.Now()
+			seeded := pm.Ecosystem == "node" && (mode == "clone" || mode == "hardlink") && seedNodeModules(mainRepo, slotPath, ld, mode)
+			var out []byte
+			var err error
+			for i, step := range pm.Install {
+				args := append([]string{}, step...)
+				if i == len(pm.Install)-1 && (seeded || mode == "offline") && pm.Offline != "" {
+					args = append(args, pm.Offline)
+				}
+				cmd := exec.Command(args[0], args[1:]...)
+				cmd.Dir = ld.Dir
+				var stepOut []byte
+				stepOut, err = cmd.CombinedOutput()
+				out = append(out, stepOut...)
+				if err != nil {
+					break
+				}
+			}
 
-	// 3. Pipe dump to fresh DB
-	pipeCmd := fmt.Sprintf(
-		"pg_dump -h localhost -p %d -U %s --no-owner %s | psql -h localhost -p %d -U %s %s",
-		srcPort, user, db, dstPort, user, db,
-	)
-	cmd = exec.Command("sh", "-c", pipeCmd)
-	cmd.Env = env
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to restore database: %w", err)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				fmt.Printf("  ✗ %s (%s): %v\n", rel, ld.Manager, err)
+				for _, line := range strings.Split(strings.TrimRight(string(out), "\n"), "\n") {
+					fmt.Printf("      %s\n", line)
+				}
+				return
+			}
+			how := ld.Manager
+			if seeded {
+				how += ", " + mode + " from main"
+			}
+			fmt.Printf("  ✓ %s (%s, %s)\n", rel, how, time.Since(start).Round(100*time.Millisecond))
+		}()
 	}
-
-	return nil
+	wg.Wait()
 }
 
-func stopDocker(slotPath string) {
-	filepath.Walk(slotPath, func(path string, info os.FileInfo, err error) error {
-		if err != nil || info.IsDir() {
-			return nil
-		}
-		if info.Name() == "docker-compose.yml" || info.Name() == "docker-compose.yaml" {
-			dir := filepath.Dir(path)
-			cmd := exec.Command("docker", "compose", "down", "-v")
-			cmd.Dir = dir
-			cmd.Run()
+// extractFlag removes a "--name value" or "--name=value" flag from args,
+// returning its value and the remaining args
+func extractFlag(args []string, name string) (string, []string) {
+	var rest []string
+	value := ""
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if strings.HasPrefix(arg, name+"=") {
+			value = strings.TrimPrefix(arg, name+"=")
+		} else if arg == name && i+1 < len(args) {
+			value = args[i+1]
+			i++
+		} else {
+			rest = append(rest, arg)
 		}
-		return nil
-	})
+	}
+	return value, rest
 }
 
-func installDeps(slotPath string) {
-	fmt.Println("\nInstalling dependencies...")
-
-	filepath.Walk(slotPath, func(path string, info os.FileInfo, err error) error {
-		if err != nil || info.IsDir() {
-			return nil
-		}
-
-		if strings.Contains(path, "node_modules") {
-			return filepath.SkipDir
+// splitList splits a comma-separated flag value, dropping empty entries
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
 		}
+	}
+	return items
+}
 
-		if info.Name() == "pnpm-lock.yaml" {
-			dir := filepath.Dir(path)
-			rel, _ := filepath.Rel(slotPath, dir)
-			fmt.Printf("  Installing in %s...\n", rel)
-
-			cmd := exec.Command("pnpm", "install", "--frozen-lockfile")
-			cmd.Dir = dir
-			cmd.Run()
+// countProjectSlots counts a project's registered slots whose directory exists
+func countProjectSlots(reg *Registry, project string, exists func(string) bool) int {
+	n := 0
+	for name, slot := range reg.Slots {
+		if slot.Project == project && exists(reg.SlotPath(name)) {
+			n++
 		}
-		return nil
-	})
+	}
+	return n
 }
 
-func getBranchName(repoPath string) string {
-	out, err := exec.Command("git", "-C", repoPath, "branch", "--show-current").Output()
-	if err != nil {
-		return ""
-	}
-	return strings.TrimSpace(string(out))
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
 }
 
 func getClaudeInfo(pid string) map[string]string {
 	// Get working directory
-	out, err := exec.Command("lsof", "-p", pid).Output()
-	if err != nil {
-		return nil
-	}
-
-	cwd := ""
-	for _, line := range strings.Split(string(out), "\n") {
-		if strings.Contains(line, "cwd") {
-			fields := strings.Fields(line)
-			if len(fields) > 0 {
-				cwd = fields[len(fields)-1]
-			}
-		}
-	}
-
+	pidNum, _ := strconv.Atoi(pid)
+	cwd := procs.CWD(pidNum)
 	if cwd == "" {
 		return nil
 	}
@@ -3145,20 +13370,24 @@ func getClaudeInfo(pid string) map[string]string {
 	runtime, _ := exec.Command("ps", "-p", pid, "-o", "etime=").Output()
 
 	// Get session info from claude files
-	projectKey := strings.ReplaceAll(cwd, "/", "-")
-	sessionDir := filepath.Join(os.Getenv("HOME"), ".claude", "projects", projectKey)
+	sessionDir := claudeSessionDir(cwd)
 
 	slug := "unknown"
 	model := "unknown"
 
-	files, _ := filepath.Glob(filepath.Join(sessionDir, "*.jsonl"))
+	matches, _ := filepath.Glob(filepath.Join(sessionDir, "*.jsonl"))
+	// Files that vanish between Glob and Stat are skipped, not dereferenced
+	modTimes := make(map[string]time.Time)
+	var files []string
+	for _, f := range matches {
+		if fi, err := os.Stat(f); err == nil {
+			modTimes[f] = fi.ModTime()
+			files = append(files, f)
+		}
+	}
 	if len(files) > 0 {
 		// Sort by modification time, get newest
-		sort.Slice(files, func(i, j int) bool {
-			fi, _ := os.Stat(files[i])
-			fj, _ := os.Stat(files[j])
-			return fi.ModTime().After(fj.ModTime())
-		})
+		sort.Slice(files, func(i, j int) bool { return modTimes[files[i]].After(modTimes[files[j]]) })
 
 		content, _ := os.ReadFile(files[0])
 		lines := strings.Split(string(content), "\n")
@@ -3192,43 +13421,508 @@ func getClaudeInfo(pid string) map[string]string {
 	}
 }
 
+// UsageStats aggregates Claude token usage for one slot (or main worktree)
+type UsageStats struct {
+	Project          string  `json:"project"`
+	Slot             string  `json:"slot"`
+	Turns            int     `json:"turns"`
+	InputTokens      int     `json:"input_tokens"`
+	OutputTokens     int     `json:"output_tokens"`
+	CacheWriteTokens int     `json:"cache_write_tokens"`
+	CacheReadTokens  int     `json:"cache_read_tokens"`
+	Cost             float64 `json:"estimated_cost_usd"`
+}
+
+func (u *UsageStats) add(o UsageStats) {
+	u.Turns += o.Turns
+	u.InputTokens += o.InputTokens
+	u.OutputTokens += o.OutputTokens
+	u.CacheWriteTokens += o.CacheWriteTokens
+	u.CacheReadTokens += o.CacheReadTokens
+	u.Cost += o.Cost
+}
+
+// modelPrices are USD per million input/output tokens, matched by substring
+// in order (cache writes bill at 1.25x input, cache reads at 0.1x)
+var modelPrices = []struct {
+	match         string
+	input, output float64
+}{
+	{"opus-4-5", 5, 25},
+	{"opus", 15, 75},
+	{"sonnet", 3, 15},
+	{"haiku-4-5", 1, 5},
+	{"haiku", 0.8, 4},
+}
+
+func estimateCost(model string, input, output, cacheWrite, cacheRead int) float64 {
+	for _, p := range modelPrices {
+		if strings.Contains(model, p.match) {
+			in := float64(input) + float64(cacheWrite)*1.25 + float64(cacheRead)*0.1
+			return (in*p.input + float64(output)*p.output) / 1e6
+		}
+	}
+	return 0
+}
+
+// parseTranscriptUsage sums usage per cwd from a Claude transcript, counting
+// only entries at or after since. Streamed assistant messages repeat their
+// usage on every line, so each message ID is counted once via seen.
+func parseTranscriptUsage(content string, since time.Time, seen map[string]bool) map[string]*UsageStats {
+	stats := map[string]*UsageStats{}
+	for _, line := range strings.Split(content, "\n") {
+		if !strings.Contains(line, `"usage"`) && !strings.Contains(line, `"type":"user"`) {
+			continue
+		}
+		var entry struct {
+			Type      string    `json:"type"`
+			CWD       string    `json:"cwd"`
+			Timestamp time.Time `json:"timestamp"`
+			RequestID string    `json:"requestId"`
+			Message   struct {
+				ID      string          `json:"id"`
+				Model   string          `json:"model"`
+				Content json.RawMessage `json:"content"`
+				Usage   struct {
+					InputTokens      int `json:"input_tokens"`
+					OutputTokens     int `json:"output_tokens"`
+					CacheWriteTokens int `json:"cache_creation_input_tokens"`
+					CacheReadTokens  int `json:"cache_read_input_tokens"`
+				} `json:"usage"`
+			} `json:"message"`
+		}
+		if json.Unmarshal([]byte(line), &entry) != nil || entry.CWD == "" {
+			continue
+		}
+		if !since.IsZero() && entry.Timestamp.Before(since) {
+			continue
+		}
+
+		s, ok := stats[entry.CWD]
+		if !ok {
+			s = &UsageStats{}
+			stats[entry.CWD] = s
+		}
+
+		switch entry.Type {
+		case "user":
+			// Typed prompts have string content; tool results are arrays
+			if len(entry.Message.Content) > 0 && entry.Message.Content[0] == '"' {
+				s.Turns++
+			}
+		case "assistant":
+			key := entry.Message.ID + "/" + entry.RequestID
+			if entry.Message.ID == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			u := entry.Message.Usage
+			s.InputTokens += u.InputTokens
+			s.OutputTokens += u.OutputTokens
+			s.CacheWriteTokens += u.CacheWriteTokens
+			s.CacheReadTokens += u.CacheReadTokens
+			s.Cost += estimateCost(entry.Message.Model, u.InputTokens, u.OutputTokens, u.CacheWriteTokens, u.CacheReadTokens)
+		}
+	}
+	return stats
+}
+
+// attributeCWD maps a transcript cwd to a registered project and slot name.
+// Slots are recognised by directory name so deleted slots still count.
+func attributeCWD(cwd string, projects map[string]ProjectConfig) (project, slot string) {
+	for name, p := range projects {
+		if p.Path == "" {
+			continue
+		}
+		if worktree.IsWithin(cwd, p.Path) {
+			return name, name
+		}
+		rel, err := filepath.Rel(filepath.Dir(p.Path), cwd)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		top := strings.Split(rel, string(filepath.Separator))[0]
+		if strings.HasPrefix(top, name+"-") {
+			return name, top
+		}
+	}
+	return "", ""
+}
+
+// parseSince parses a lookback or TTL like "7d", "2w" or "12h"
+func parseSince(s string) (time.Duration, error) {
+	if len(s) < 2 {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	unit := map[byte]time.Duration{'h': time.Hour, 'd': 24 * time.Hour, 'w': 7 * 24 * time.Hour}[s[len(s)-1]]
+	n, err := strconv.Atoi(s[:len(s)-1])
+	if unit == 0 || err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid duration %q (use e.g. 12h, 7d, 2w)", s)
+	}
+	return time.Duration(n) * unit, nil
+}
+
+func cmdUsage(args []string) {
+	sinceFlag, args := extractFlag(args, "--since")
+	jsonOut := jsonOutput
+
+	var since time.Time
+	if sinceFlag != "" {
+		d, err := parseSince(sinceFlag)
+		if err != nil {
+			fail(exitUsage, err.Error())
+		}
+		since = time.Now().Add(-d)
+	}
+
+	reg := loadRegistry()
+	bySlot := map[string]*UsageStats{}
+	seen := map[string]bool{}
+
+	files, _ := filepath.Glob(filepath.Join(homeDir(), ".claude", "projects", "*", "*.jsonl"))
+	for _, f := range files {
+		if fi, err := os.Stat(f); err != nil || fi.ModTime().Before(since) {
+			continue
+		}
+		content, err := os.ReadFile(f)
+		if err != nil {
+			continue
+		}
+		for cwd, s := range parseTranscriptUsage(string(content), since, seen) {
+			project, slot := attributeCWD(cwd, reg.Projects)
+			if project == "" {
+				continue
+			}
+			total, ok := bySlot[slot]
+			if !ok {
+				total = &UsageStats{Project: project, Slot: slot}
+				bySlot[slot] = total
+			}
+			total.add(*s)
+		}
+	}
+
+	var rows []UsageStats
+	for _, s := range bySlot {
+		rows = append(rows, *s)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Project != rows[j].Project {
+			return rows[i].Project < rows[j].Project
+		}
+		return rows[i].Slot < rows[j].Slot
+	})
+
+	if jsonOut {
+		if rows == nil {
+			rows = []UsageStats{}
+		}
+		data, _ := json.MarshalIndent(rows, "", "  ")
+		fmt.Println(string(data))
+		return
+	}
+
+	period := "all time"
+	if sinceFlag != "" {
+		period = "last " + sinceFlag
+	}
+	fmt.Println("═══════════════════════════════════════════════════════════")
+	fmt.Printf("  CLAUDE USAGE (%s)\n", period)
+	fmt.Println("═══════════════════════════════════════════════════════════")
+	fmt.Println()
+
+	if len(rows) == 0 {
+		fmt.Println("No usage found for registered projects.")
+		return
+	}
+
+	var grand UsageStats
+	for i := 0; i < len(rows); {
+		project := rows[i].Project
+		projectTotal := UsageStats{}
+		fmt.Printf("┌─ %s\n", project)
+		fmt.Printf("│  %-28s %6s %9s %9s %9s %9s\n", "", "turns", "input", "output", "cache", "cost")
+		for ; i < len(rows) && rows[i].Project == project; i++ {
+			r := rows[i]
+			label := r.Slot
+			if r.Slot == project {
+				label += " (main)"
+			}
+			fmt.Printf("│  %-28s %6d %9s %9s %9s %9s\n", label, r.Turns, formatTokens(r.InputTokens),
+				formatTokens(r.OutputTokens), formatTokens(r.CacheWriteTokens+r.CacheReadTokens), fmt.Sprintf("$%.2f", r.Cost))
+			projectTotal.add(r)
+		}
+		fmt.Printf("└─ %-28s %6d %9s %9s %9s %9s\n", "total", projectTotal.Turns, formatTokens(projectTotal.InputTokens),
+			formatTokens(projectTotal.OutputTokens), formatTokens(projectTotal.CacheWriteTokens+projectTotal.CacheReadTokens),
+			fmt.Sprintf("$%.2f", projectTotal.Cost))
+		fmt.Println()
+		grand.add(projectTotal)
+	}
+
+	fmt.Printf("Total: %d turns, %s output tokens, ~$%.2f (estimated at list prices)\n",
+		grand.Turns, formatTokens(grand.OutputTokens), grand.Cost)
+}
+
+// formatTokens renders a token count as 950, 12.3k or 4.5M
+func formatTokens(n int) string {
+	switch {
+	case n >= 1_000_000:
+		return fmt.Sprintf("%.1fM", float64(n)/1e6)
+	case n >= 1_000:
+		return fmt.Sprintf("%.1fk", float64(n)/1e3)
+	default:
+		return strconv.Itoa(n)
+	}
+}
+
 func loadRegistry() *Registry {
 	os.MkdirAll(filepath.Dir(registryPath), 0755)
+	reg, _ := registry.Load(registryPath)
+	return reg
+}
 
-	data, err := os.ReadFile(registryPath)
+func saveRegistry(reg *Registry) {
+	old, _ := registry.Load(registryPath)
+	for _, change := range registry.Changes(old, reg) {
+		recordAudit(AuditEntry{Action: "registry", Slot: change[0], Detail: change[1]})
+	}
+	registry.Save(registryPath, reg)
+}
+
+// homeRelative rewrites project paths under home to ~/... (toTilde) or back,
+// so an exported registry fits a machine with another home directory
+func homeRelative(reg *Registry, home string, toTilde bool) {
+	for name, proj := range reg.Projects {
+		if toTilde {
+			if rel, err := filepath.Rel(home, proj.Path); err == nil && !strings.HasPrefix(rel, "..") {
+				proj.Path = "~/" + filepath.ToSlash(rel)
+			}
+		} else if rest, ok := strings.CutPrefix(proj.Path, "~/"); ok {
+			proj.Path = filepath.Join(home, filepath.FromSlash(rest))
+		}
+		reg.Projects[name] = proj
+	}
+}
+
+func cmdRegistry(args []string) {
+	if len(args) == 0 {
+		fail(exitUsage, "usage: slot-cli registry export|import")
+	}
+	switch args[0] {
+	case "export":
+		reg := loadRegistry()
+		home, _ := os.UserHomeDir()
+		homeRelative(reg, home, true)
+		data, _ := json.MarshalIndent(reg, "", "  ")
+		fmt.Println(string(data))
+	case "import":
+		cmdRegistryImport(args[1:])
+	default:
+		fail(exitUsage, fmt.Sprintf("unknown registry command '%s'", args[0]), "Use: slot-cli registry export|import")
+	}
+}
+
+// cmdRegistryImport replaces the registry with an exported one, or merges it
+// in (--merge), asking about entries both define differently unless --ours
+// or --theirs picks a side
+func cmdRegistryImport(args []string) {
+	merge := slices.Contains(args, "--merge")
+	ours, theirs := slices.Contains(args, "--ours"), slices.Contains(args, "--theirs")
+	if ours && theirs {
+		fail(exitUsage, "--ours and --theirs can't be combined")
+	}
+	file := ""
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			file = arg
+		}
+	}
+	if file == "" {
+		fail(exitUsage, "missing file", "Usage: slot-cli registry import <file.json> [--merge [--ours|--theirs]]")
+	}
+	if _, err := os.Stat(file); err != nil {
+		fail(exitNotFound, fmt.Sprintf("%s not found", file))
+	}
+	imported, err := registry.Load(file)
 	if err != nil {
-		return &Registry{
-			Groups:   make(map[string]GroupConfig),
-			Projects: make(map[string]ProjectConfig),
-			Slots:    make(map[string]SlotConfig),
+		fail(exitError, fmt.Sprintf("can't read %s: %v", file, err))
+	}
+	home, _ := os.UserHomeDir()
+	homeRelative(imported, home, false)
+
+	reg := loadRegistry()
+	if merge {
+		added, replaced, kept := reg.Merge(imported, func(c registry.Conflict) bool {
+			if ours || theirs {
+				return theirs
+			}
+			return confirm(fmt.Sprintf("%s '%s' differs here, use the imported one?", c.Kind, c.Name))
+		})
+		if len(added) == 0 && len(replaced) == 0 {
+			fmt.Println("✓ Nothing to import, the registry already has everything")
+			return
+		}
+		backupRegistry()
+		saveRegistry(reg)
+		fmt.Printf("✓ Merged %s: %d added, %d replaced, %d kept\n", file, len(added), len(replaced), len(kept))
+		for _, c := range replaced {
+			fmt.Printf("  ↻ %s %s (imported version)\n", c.Kind, c.Name)
+		}
+		for _, c := range kept {
+			fmt.Printf("  = %s %s (kept this machine's)\n", c.Kind, c.Name)
+		}
+	} else {
+		changes := registry.Changes(reg, imported)
+		for _, change := range changes {
+			fmt.Printf("  %-24s %s\n", change[0], change[1])
+		}
+		if !confirm(fmt.Sprintf("Replace the registry with %s (%d projects, %d slots)?", file, len(imported.Projects), len(imported.Slots))) {
+			fail(exitAborted, "aborted", "Use --merge to combine it with this machine's registry instead")
 		}
+		backupRegistry()
+		saveRegistry(imported)
+		reg = imported
+		fmt.Printf("✓ Imported %s\n", file)
 	}
 
-	var reg Registry
-	if json.Unmarshal(data, &reg) != nil {
-		return &Registry{
-			Groups:   make(map[string]GroupConfig),
-			Projects: make(map[string]ProjectConfig),
-			Slots:    make(map[string]SlotConfig),
+	for _, name := range slices.Sorted(maps.Keys(reg.Projects)) {
+		if path := reg.Projects[name].Path; !fileExists(path) {
+			fmt.Printf("⚠ %s: %s doesn't exist on this machine (clone it there, or slot-cli init in its clone)\n", name, path)
 		}
 	}
+}
+
+// backupRegistry copies registry.json to registry.json.bak before an import
+func backupRegistry() {
+	if data, err := os.ReadFile(registryPath); err == nil {
+		os.WriteFile(registryPath+".bak", data, 0644)
+		fmt.Printf("  Previous registry saved to %s\n", registryPath+".bak")
+	}
+}
+
+// AuditEntry is one line of ~/.config/slots/audit.log
+type AuditEntry struct {
+	Time    string `json:"time"`
+	Action  string `json:"action"`
+	Slot    string `json:"slot,omitempty"`
+	Command string `json:"command,omitempty"`
+	Detail  string `json:"detail,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
 
-	if reg.Groups == nil {
-		reg.Groups = make(map[string]GroupConfig)
+func auditLogPath() string {
+	return filepath.Join(filepath.Dir(registryPath), "audit.log")
+}
+
+// recordAudit appends an entry to the audit log
+func recordAudit(entry AuditEntry) {
+	if entry.Time == "" {
+		entry.Time = time.Now().Format(time.RFC3339)
 	}
-	if reg.Projects == nil {
-		reg.Projects = make(map[string]ProjectConfig)
+	os.MkdirAll(filepath.Dir(auditLogPath()), 0755)
+	f, err := os.OpenFile(auditLogPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
 	}
-	if reg.Slots == nil {
-		reg.Slots = make(map[string]SlotConfig)
+	defer f.Close()
+	data, _ := json.Marshal(entry)
+	f.Write(append(data, '\n'))
+}
+
+// auditedRun runs a destructive command and records it in the audit log
+func auditedRun(action, slot string, cmd *exec.Cmd) error {
+	err := cmd.Run()
+	entry := AuditEntry{Action: action, Slot: slot, Command: commandLine(cmd.Args)}
+	if err != nil {
+		entry.Error = err.Error()
 	}
+	recordAudit(entry)
+	return err
+}
 
-	return &reg
+// commandLine renders a command for the audit log with credentials redacted
+func commandLine(args []string) string {
+	parts := make([]string, len(args))
+	redactNext := false
+	for i, a := range args {
+		switch {
+		case redactNext:
+			a, redactNext = "***", false
+		case a == "--password" || a == "-a":
+			redactNext = true
+		case strings.HasPrefix(a, "PGPASSWORD=") || strings.HasPrefix(a, "MYSQL_PWD="):
+			a = a[:strings.Index(a, "=")+1] + "***"
+		}
+		if strings.ContainsAny(a, " \t\"'") {
+			a = strconv.Quote(a)
+		}
+		parts[i] = a
+	}
+	return strings.Join(parts, " ")
 }
 
-func saveRegistry(reg *Registry) {
-	data, _ := json.MarshalIndent(reg, "", "  ")
-	os.WriteFile(registryPath, data, 0644)
+// readAuditLog returns the last limit audit log entries match accepts,
+// oldest first
+func readAuditLog(match func(AuditEntry) bool, limit int) []AuditEntry {
+	data, err := os.ReadFile(auditLogPath())
+	if err != nil {
+		return nil
+	}
+	var entries []AuditEntry
+	for _, line := range strings.Split(string(data), "\n") {
+		var e AuditEntry
+		if json.Unmarshal([]byte(line), &e) != nil || !match(e) {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	if len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	return entries
+}
+
+func cmdHistory(args []string) {
+	limitFlag, args := extractFlag(args, "-n")
+	limit := 50
+	if limitFlag != "" {
+		if n, err := strconv.Atoi(limitFlag); err == nil && n > 0 {
+			limit = n
+		}
+	}
+	filter := ""
+	if len(args) > 0 {
+		filter = args[0]
+	}
+
+	if _, err := os.Stat(auditLogPath()); err != nil {
+		fmt.Println("No history yet.")
+		return
+	}
+	entries := readAuditLog(func(e AuditEntry) bool {
+		return filter == "" || strings.Contains(e.Slot, filter) || strings.Contains(e.Command, filter)
+	}, limit)
+	if len(entries) == 0 {
+		fmt.Println("No matching history.")
+		return
+	}
+
+	for _, e := range entries {
+		mark := "✓"
+		if e.Error != "" {
+			mark = "✗"
+		}
+		fmt.Printf("%s %s %-11s %s\n", e.Time, mark, e.Action, e.Slot)
+		if e.Command != "" {
+			fmt.Printf("      $ %s\n", e.Command)
+		}
+		if e.Detail != "" {
+			fmt.Printf("      %s\n", e.Detail)
+		}
+		if e.Error != "" {
+			fmt.Printf("      error: %s\n", e.Error)
+		}
+	}
 }
 
 func updateRegistry(slotName, project string, number int, branch string) {
@@ -3247,22 +13941,252 @@ func updateRegistryFull(slotName, project string, number int, name, branch strin
 	saveRegistry(reg)
 }
 
-// extractSlotIdentifier extracts the slot number or name from a slot directory name
-func extractSlotIdentifier(slotName, project string) string {
-	prefix := project + "-"
-	if !strings.HasPrefix(slotName, prefix) {
-		return slotName
+// modifySlot applies fn to a slot's registry entry and saves it.
+// Returns false if the slot is not registered.
+func modifySlot(slotName string, fn func(slot *SlotConfig)) bool {
+	reg := loadRegistry()
+	slot, ok := reg.Slots[slotName]
+	if !ok {
+		return false
+	}
+	fn(&slot)
+	reg.Slots[slotName] = slot
+	saveRegistry(reg)
+	return true
+}
+
+// lifecycleEnv wires pkg/lifecycle to the registry, config and audit log,
+// and to the docker, tunnel and DNS state slot-cli keeps per slot
+func lifecycleEnv() lifecycle.Env {
+	return lifecycle.Env{
+		Out:  os.Stdout,
+		Logf: func(format string, args ...any) { fmt.Printf(format+"\n", args...) },
+		Run:  auditedRun,
+		Hook: func(event string, s lifecycle.Slot) {
+			runHooks(event, s.Path, "SLOT_NAME="+s.Name, "SLOT_PATH="+s.Path, "SLOT_BRANCH="+s.Branch)
+		},
+		StopDocker: stopDocker,
+		SavePatch: func(s lifecycle.Slot) string {
+			return exportUncommitted(s.Name, s.Path)
+		},
+		Journal: func(action string, s lifecycle.Slot) {
+			journalSlotRemoval(action, s.MainRepo, s.Name, s.Path, s.Branch)
+		},
+		Trash: func(s lifecycle.Slot) (string, error) {
+			purgeTrash(time.Now())
+			return trashSlot(s.MainRepo, s.Name, s.Path, s.Branch)
+		},
+		Forget: forgetSlot,
 	}
-	suffix := strings.TrimPrefix(slotName, prefix)
-	// Check if it's a number
-	if _, err := strconv.Atoi(suffix); err == nil {
-		return suffix
+}
+
+// forgetSlot unregisters a removed slot after stopping its tunnel; dropDBs
+// drops its databases on main's postgres too (not for trashed slots)
+func forgetSlot(s lifecycle.Slot, dropDBs bool) {
+	slot := loadRegistry().Slots[s.Name]
+	stopTunnel(slot)
+	if dropDBs && slot.SharedPostgres {
+		dropSharedDBs(s.MainRepo, s.Project, s.Name)
 	}
-	return suffix
+	removeFromRegistry(s.Name)
+	refreshSlotDNS()
 }
 
 func removeFromRegistry(slotName string) {
 	reg := loadRegistry()
 	delete(reg.Slots, slotName)
 	saveRegistry(reg)
+	os.RemoveAll(slotLogDir(slotName))
+}
+
+// releaseRepo is the GitHub repository self-update installs releases from
+// (SLOT_RELEASE_REPO overrides it for forks)
+var releaseRepo = "mauriciopiber/exceder"
+
+// buildInfo returns version, commit and date, falling back to the VCS stamp
+// go build embeds when no -ldflags were given
+func buildInfo() (string, string, string) {
+	v, c, d := version, commit, date
+	if bi, ok := debug.ReadBuildInfo(); ok && c == "" {
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				c = s.Value
+				if len(c) > 12 {
+					c = c[:12]
+				}
+			case "vcs.time":
+				d = firstNonEmpty(d, s.Value)
+			}
+		}
+	}
+	return v, c, d
+}
+
+func cmdVersion() {
+	v, c, d := buildInfo()
+	fmt.Printf("slot-cli %s", v)
+	if c != "" {
+		fmt.Printf(" (%s", c)
+		if d != "" {
+			fmt.Printf(", %s", d)
+		}
+		fmt.Print(")")
+	}
+	fmt.Printf(" %s/%s\n", runtime.GOOS, runtime.GOARCH)
+}
+
+// GitHubRelease is the part of the GitHub releases API slot-cli uses
+type GitHubRelease struct {
+	TagName string `json:"tag_name"`
+	Assets  []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+// assetURL returns the download URL of the named release asset, or ""
+func (r GitHubRelease) assetURL(name string) string {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a.URL
+		}
+	}
+	return ""
+}
+
+// releaseAssetName is the release binary for a platform, e.g. slot-cli_darwin_arm64
+func releaseAssetName(goos, goarch string) string {
+	name := fmt.Sprintf("slot-cli_%s_%s", goos, goarch)
+	if goos == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// parseChecksums parses a sha256sum-style checksums.txt into name -> hex digest
+func parseChecksums(content string) map[string]string {
+	sums := make(map[string]string)
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 {
+			sums[strings.TrimPrefix(fields[1], "*")] = strings.ToLower(fields[0])
+		}
+	}
+	return sums
+}
+
+// githubGet fetches a URL, authenticating with GITHUB_TOKEN when set
+func githubGet(url string) ([]byte, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	client := &http.Client{Timeout: 5 * time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// cmdSelfUpdate replaces the running binary with the latest GitHub release
+func cmdSelfUpdate(args []string) {
+	checkOnly := slices.Contains(args, "--check")
+	force := slices.Contains(args, "--force") || slices.Contains(args, "-f")
+	repo := firstNonEmpty(os.Getenv("SLOT_RELEASE_REPO"), releaseRepo)
+
+	data, err := githubGet("https://api.github.com/repos/" + repo + "/releases/latest")
+	if err != nil {
+		fail(exitError, fmt.Sprintf("could not fetch the latest release: %v", err), "Set GITHUB_TOKEN if the repository is private or you hit the rate limit")
+	}
+	var release GitHubRelease
+	if err := json.Unmarshal(data, &release); err != nil || release.TagName == "" {
+		fail(exitError, "unexpected response from the GitHub releases API")
+	}
+
+	current, _, _ := buildInfo()
+	fmt.Printf("Current: %s\n", current)
+	fmt.Printf("Latest:  %s\n", release.TagName)
+	if strings.TrimPrefix(release.TagName, "v") == strings.TrimPrefix(current, "v") && !force {
+		fmt.Println("✓ Already up to date")
+		return
+	}
+	if checkOnly {
+		fmt.Println("→ slot-cli self-update to install it")
+		return
+	}
+	if current == "dev" && !force && !confirm(fmt.Sprintf("This is a dev build. Replace it with %s?", release.TagName)) {
+		fail(exitAborted, "aborted")
+	}
+
+	asset := releaseAssetName(runtime.GOOS, runtime.GOARCH)
+	binURL := release.assetURL(asset)
+	sumsURL := release.assetURL("checksums.txt")
+	if binURL == "" {
+		fail(exitNotFound, fmt.Sprintf("release %s has no %s asset", release.TagName, asset))
+	}
+	if sumsURL == "" {
+		fail(exitNotFound, fmt.Sprintf("release %s has no checksums.txt, refusing to install an unverified binary", release.TagName))
+	}
+
+	fmt.Printf("Downloading %s...\n", asset)
+	bin, err := githubGet(binURL)
+	if err != nil {
+		fail(exitError, fmt.Sprintf("download failed: %v", err))
+	}
+	sums, err := githubGet(sumsURL)
+	if err != nil {
+		fail(exitError, fmt.Sprintf("could not download checksums.txt: %v", err))
+	}
+	sum := sha256.Sum256(bin)
+	want := parseChecksums(string(sums))[asset]
+	if want == "" || hex.EncodeToString(sum[:]) != want {
+		fail(exitError, fmt.Sprintf("checksum mismatch for %s (got %x, want %s)", asset, sum, firstNonEmpty(want, "none listed")))
+	}
+	fmt.Println("✓ Checksum verified")
+
+	exe, err := os.Executable()
+	if err == nil {
+		exe, err = filepath.EvalSymlinks(exe)
+	}
+	if err != nil {
+		fail(exitError, fmt.Sprintf("could not locate the running binary: %v", err))
+	}
+
+	// Write next to the binary so the final rename stays on one filesystem
+	tmp := exe + ".new"
+	if err := os.WriteFile(tmp, bin, 0755); err != nil {
+		fail(exitError, fmt.Sprintf("could not write %s: %v", tmp, err), "Re-run with permission to write to "+filepath.Dir(exe))
+	}
+	// macOS kills unsigned Go binaries (signal 9): ad-hoc sign before swapping it in
+	if runtime.GOOS == "darwin" {
+		if out, err := exec.Command("codesign", "-f", "-s", "-", tmp).CombinedOutput(); err != nil {
+			os.Remove(tmp)
+			fail(exitError, fmt.Sprintf("could not sign %s: %v %s", tmp, err, strings.TrimSpace(string(out))),
+				"Install the Xcode command line tools: xcode-select --install")
+		}
+	}
+	// Windows can't overwrite a running executable, but it can rename it
+	if runtime.GOOS == "windows" {
+		os.Remove(exe + ".old")
+		if err := os.Rename(exe, exe+".old"); err != nil {
+			os.Remove(tmp)
+			fail(exitError, fmt.Sprintf("could not move the current binary aside: %v", err))
+		}
+	}
+	if err := os.Rename(tmp, exe); err != nil {
+		os.Remove(tmp)
+		fail(exitError, fmt.Sprintf("could not replace %s: %v", exe, err))
+	}
+
+	recordAudit(AuditEntry{Action: "self-update", Detail: current + " → " + release.TagName})
+	fmt.Printf("✓ Updated %s to %s\n", exe, release.TagName)
 }
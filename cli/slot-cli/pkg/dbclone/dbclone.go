@@ -0,0 +1,774 @@
+// Package dbclone detects the databases in a docker-compose file and copies
+// their data between a main checkout and a slot: postgres, mysql and mongo
+// via their dump/restore tools, redis via an RDB snapshot.
+package dbclone
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Run executes a destructive command (drop/recreate database). Callers can
+// replace it to audit or dry-run those commands.
+var Run = func(action, target string, cmd *exec.Cmd) error {
+	return cmd.Run()
+}
+
+// Record is told about each Clone before it runs (action db-clone, the
+// target database and what is copied from where). Callers can replace it
+// to audit the copies.
+var Record = func(action, target, detail string) {}
+
+// ErrNotRunning is returned (wrapped) when a database to copy from or into
+// doesn't accept connections
+var ErrNotRunning = errors.New("not running")
+
+// DBService is a database detected in a docker-compose file
+type DBService struct {
+	Engine  string // postgres, mysql, mongo, redis
+	Service string // compose service name
+	PortVar string // env var holding the host port, e.g. POSTGRES_PORT
+	User    string
+	Pass    string
+	DB      string
+}
+
+// Engines describes how each supported engine is discovered
+var Engines = map[string]struct {
+	PortVar   string   // env var holding the host port
+	DataDir   string   // data directory inside the container (for volume copies)
+	URIScheme string   // scheme of connection URIs, e.g. mongodb
+	URIVars   []string // connection URI vars to read the port from when PortVar is unset
+}{
+	"postgres": {"POSTGRES_PORT", "/var/lib/postgresql/data", "", nil},
+	"mysql":    {"MYSQL_PORT", "/var/lib/mysql", "", nil},
+	"mongo":    {"MONGO_PORT", "/data/db", "mongodb", []string{"MONGO_URI", "MONGODB_URI", "MONGO_URL", "DATABASE_URL"}},
+	"redis":    {"REDIS_PORT", "/data", "redis", []string{"REDIS_URL", "REDIS_URI"}},
+}
+
+// Target is a detected database with its main and slot host ports (0 if unknown)
+type Target struct {
+	DBService
+	MainPort int
+	SlotPort int
+}
+
+// composeService is a service block parsed from a docker-compose file
+type composeService struct {
+	Name  string
+	Image string
+	Env   map[string]string
+}
+
+// parseComposeServices extracts service names, images and environment
+// variables (map or list form) from a docker-compose file
+func parseComposeServices(content string) []composeService {
+	serviceRe := regexp.MustCompile(`^  ([a-zA-Z0-9_.-]+):\s*$`)
+	imageRe := regexp.MustCompile(`^\s+image:\s*["']?([^"'\s]+)["']?`)
+	envMapRe := regexp.MustCompile(`^\s+([A-Z][A-Z0-9_]*):\s*(.*)$`)
+	envListRe := regexp.MustCompile(`^\s+-\s*["']?([A-Z][A-Z0-9_]*)=([^"']*)["']?\s*$`)
+
+	var services []composeService
+	inServices := false
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if !strings.HasPrefix(line, " ") {
+			inServices = strings.HasPrefix(line, "services:")
+			continue
+		}
+		if !inServices {
+			continue
+		}
+		if m := serviceRe.FindStringSubmatch(line); m != nil {
+			services = append(services, composeService{Name: m[1], Env: make(map[string]string)})
+			continue
+		}
+		if len(services) == 0 {
+			continue
+		}
+		svc := &services[len(services)-1]
+		if m := imageRe.FindStringSubmatch(line); m != nil {
+			svc.Image = m[1]
+		} else if m := envListRe.FindStringSubmatch(line); m != nil {
+			svc.Env[m[1]] = strings.TrimSpace(m[2])
+		} else if m := envMapRe.FindStringSubmatch(line); m != nil {
+			svc.Env[m[1]] = strings.Trim(strings.TrimSpace(m[2]), `"'`)
+		}
+	}
+	return services
+}
+
+// firstNonEmpty returns the first non-empty value
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// Detect finds the databases defined in a docker-compose file.
+// Compose files that only reference POSTGRES_* variables (no recognizable
+// image) are treated as postgres, as before.
+func Detect(content string) []DBService {
+	var dbs []DBService
+	hasPostgres := false
+
+	for _, svc := range parseComposeServices(content) {
+		image := strings.ToLower(svc.Image)
+		switch {
+		case strings.Contains(image, "postgres") || strings.Contains(image, "postgis"):
+			hasPostgres = true
+			dbs = append(dbs, DBService{
+				Engine:  "postgres",
+				Service: svc.Name,
+				PortVar: Engines["postgres"].PortVar,
+				User:    firstNonEmpty(svc.Env["POSTGRES_USER"], "postgres"),
+				Pass:    firstNonEmpty(svc.Env["POSTGRES_PASSWORD"], "postgres"),
+				DB:      firstNonEmpty(svc.Env["POSTGRES_DB"], svc.Env["POSTGRES_USER"], "postgres"),
+			})
+		case strings.Contains(image, "mysql") || strings.Contains(image, "mariadb"):
+			user := firstNonEmpty(svc.Env["MYSQL_USER"], svc.Env["MARIADB_USER"], "root")
+			pass := firstNonEmpty(svc.Env["MYSQL_PASSWORD"], svc.Env["MARIADB_PASSWORD"])
+			if user == "root" {
+				pass = firstNonEmpty(svc.Env["MYSQL_ROOT_PASSWORD"], svc.Env["MARIADB_ROOT_PASSWORD"])
+			}
+			dbs = append(dbs, DBService{
+				Engine:  "mysql",
+				Service: svc.Name,
+				PortVar: Engines["mysql"].PortVar,
+				User:    user,
+				Pass:    pass,
+				DB:      firstNonEmpty(svc.Env["MYSQL_DATABASE"], svc.Env["MARIADB_DATABASE"]),
+			})
+		case strings.Contains(image, "mongo"):
+			dbs = append(dbs, DBService{
+				Engine:  "mongo",
+				Service: svc.Name,
+				PortVar: Engines["mongo"].PortVar,
+				User:    svc.Env["MONGO_INITDB_ROOT_USERNAME"],
+				Pass:    svc.Env["MONGO_INITDB_ROOT_PASSWORD"],
+				DB:      svc.Env["MONGO_INITDB_DATABASE"],
+			})
+		}
+	}
+
+	if !hasPostgres && strings.Contains(content, "POSTGRES_") {
+		user, pass, db := parseDockerComposeContent(content)
+		dbs = append([]DBService{{
+			Engine:  "postgres",
+			PortVar: Engines["postgres"].PortVar,
+			User:    user,
+			Pass:    pass,
+			DB:      db,
+		}}, dbs...)
+	}
+	return dbs
+}
+
+// DetectRedis finds redis (or valkey) services in a docker-compose
+// file. Redis is kept out of Detect since copying it is opt-in.
+func DetectRedis(content string) []DBService {
+	var dbs []DBService
+	for _, svc := range parseComposeServices(content) {
+		image := strings.ToLower(svc.Image)
+		if strings.Contains(image, "redis") || strings.Contains(image, "valkey") {
+			dbs = append(dbs, DBService{
+				Engine:  "redis",
+				Service: svc.Name,
+				PortVar: Engines["redis"].PortVar,
+				Pass:    firstNonEmpty(svc.Env["REDIS_PASSWORD"]),
+			})
+		}
+	}
+	return dbs
+}
+
+// Ready reports whether a database accepts connections on port
+func Ready(db DBService, port int) bool {
+	switch db.Engine {
+	case "mysql":
+		return isMySQLReady(port, db.User, db.Pass, db.DB)
+	case "mongo":
+		return isMongoReady(port, db.User, db.Pass)
+	case "redis":
+		return isRedisReady(port, db.Pass)
+	default:
+		return isPostgresReady(port, db.User, db.Pass, db.DB)
+	}
+}
+
+// Wait polls Ready once a second for up to timeoutSecs
+func Wait(db DBService, port int, timeoutSecs int) bool {
+	for i := 0; i < timeoutSecs; i++ {
+		if Ready(db, port) {
+			return true
+		}
+		time.Sleep(time.Second)
+	}
+	return false
+}
+
+// DumpOptions narrows what db-sync copies from main
+type DumpOptions struct {
+	SchemaOnly bool     // structure only, no rows
+	Tables     []string // only these tables
+	Exclude    []string // keep these tables' structure but skip their data
+	Jobs       int      // parallel pg_dump/pg_restore jobs (0 = default)
+}
+
+// jobs returns the parallel job count, defaulting to the CPU count capped at 4
+func (o DumpOptions) jobs() int {
+	if o.Jobs > 0 {
+		return o.Jobs
+	}
+	return min(runtime.NumCPU(), 4)
+}
+
+// IsEmpty reports whether the options copy everything
+func (o DumpOptions) IsEmpty() bool {
+	return !o.SchemaOnly && len(o.Tables) == 0 && len(o.Exclude) == 0
+}
+
+// String describes the options for logs, e.g. "schema only; tables: users"
+func (o DumpOptions) String() string {
+	var parts []string
+	if o.SchemaOnly {
+		parts = append(parts, "schema only")
+	}
+	if len(o.Tables) > 0 {
+		parts = append(parts, "tables: "+strings.Join(o.Tables, ","))
+	}
+	if len(o.Exclude) > 0 {
+		parts = append(parts, "excluding data: "+strings.Join(o.Exclude, ","))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// pgDumpArgs maps the options onto pg_dump flags
+func (o DumpOptions) pgDumpArgs() []string {
+	var args []string
+	if o.SchemaOnly {
+		args = append(args, "--schema-only")
+	}
+	for _, t := range o.Tables {
+		args = append(args, "--table="+t)
+	}
+	for _, t := range o.Exclude {
+		args = append(args, "--exclude-table-data="+t)
+	}
+	return args
+}
+
+// mysqldumpArgs maps the options onto mysqldump flags; tables go after the db name
+func (o DumpOptions) mysqldumpArgs(db string) (flags, tables []string) {
+	if o.SchemaOnly {
+		flags = append(flags, "--no-data")
+	}
+	for _, t := range o.Exclude {
+		flags = append(flags, "--ignore-table-data="+db+"."+t)
+	}
+	return flags, o.Tables
+}
+
+func parseDockerComposeContent(content string) (user, pass, db string) {
+	user, pass, db = "postgres", "postgres", "postgres"
+
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "POSTGRES_USER:") {
+			if v := strings.Trim(strings.TrimPrefix(line, "POSTGRES_USER:"), " \"'"); v != "" {
+				user = v
+			}
+		} else if strings.HasPrefix(line, "POSTGRES_PASSWORD:") {
+			if v := strings.Trim(strings.TrimPrefix(line, "POSTGRES_PASSWORD:"), " \"'"); v != "" {
+				pass = v
+			}
+		} else if strings.HasPrefix(line, "POSTGRES_DB:") {
+			if v := strings.Trim(strings.TrimPrefix(line, "POSTGRES_DB:"), " \"'"); v != "" {
+				db = v
+			}
+		}
+	}
+	return
+}
+
+// Dump writes a full dump of a database to path (plain SQL for
+// postgres/mysql, a mongodump archive for mongo)
+func Dump(db DBService, port int, path string) error {
+	var cmd *exec.Cmd
+	switch db.Engine {
+	case "mysql":
+		cmd = exec.Command("mysqldump", append(mysqlArgs(port, db.User), "--single-transaction", "--routines", "--triggers", db.DB)...)
+		cmd.Env = append(os.Environ(), "MYSQL_PWD="+db.Pass)
+	case "mongo":
+		args := append(mongoArgs(port, db.User, db.Pass), "--archive="+path, "--quiet")
+		if db.DB != "" {
+			args = append(args, "--db", db.DB)
+		}
+		if out, err := exec.Command("mongodump", args...).CombinedOutput(); err != nil {
+			return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+		}
+		return nil
+	default:
+		cmd = newPGClient(port, "pg_dump").command(db.Pass, "pg_dump", "-U", db.User, "--no-owner", db.DB)
+	}
+
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	cmd.Stdout = out
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		os.Remove(path)
+		return err
+	}
+	return nil
+}
+
+// pgClient runs postgres client tools against a server port: on the host
+// when the binaries exist, otherwise inside the container publishing the port
+type pgClient struct {
+	port          int
+	container     string // empty = host binaries
+	containerPort int
+}
+
+// newPGClient picks the host binary for tool if it's on PATH, falling back
+// to docker exec in the postgres container
+func newPGClient(port int, tool string) pgClient {
+	if _, err := exec.LookPath(tool); err == nil {
+		return pgClient{port: port}
+	}
+	return containerPGClient(port)
+}
+
+func containerPGClient(port int) pgClient {
+	out, _ := exec.Command("docker", "ps", "--format", "{{.Names}}\t{{.Ports}}").Output()
+	container, containerPort := findContainerForHostPort(string(out), port)
+	return pgClient{port: port, container: container, containerPort: containerPort}
+}
+
+// findContainerForHostPort finds the container publishing hostPort in
+// `docker ps --format '{{.Names}}\t{{.Ports}}'` output and the container-side port
+func findContainerForHostPort(psOutput string, hostPort int) (container string, containerPort int) {
+	re := regexp.MustCompile(fmt.Sprintf(`:%d->(\d+)/tcp`, hostPort))
+	for _, line := range strings.Split(psOutput, "\n") {
+		name, ports, ok := strings.Cut(line, "\t")
+		if !ok {
+			continue
+		}
+		if m := re.FindStringSubmatch(ports); m != nil {
+			p, _ := strconv.Atoi(m[1])
+			return strings.TrimSpace(name), p
+		}
+	}
+	return "", 0
+}
+
+// command builds the tool invocation with connection flags and password set
+func (c pgClient) command(pass, tool string, args ...string) *exec.Cmd {
+	if c.container == "" {
+		cmd := exec.Command(tool, append([]string{"-h", "localhost", "-p", strconv.Itoa(c.port)}, args...)...)
+		cmd.Env = append(os.Environ(), "PGPASSWORD="+pass)
+		return cmd
+	}
+	execArgs := []string{"exec", "-i", "-e", "PGPASSWORD=" + pass, c.container,
+		tool, "-h", "localhost", "-p", strconv.Itoa(c.containerPort)}
+	return exec.Command("docker", append(execArgs, args...)...)
+}
+
+// isPGVersionMismatch reports whether a host client refused the server version
+func isPGVersionMismatch(out []byte) bool {
+	return strings.Contains(string(out), "version mismatch") || strings.Contains(string(out), "unsupported version")
+}
+
+func isPostgresReady(port int, user, pass, db string) bool {
+	return newPGClient(port, "psql").command(pass, "psql", "-U", user, "-c", "SELECT 1", db).Run() == nil
+}
+
+// Clone replaces the database on dstPort with a copy of the one on srcPort.
+// The target database is dropped first (through Run).
+func Clone(db DBService, srcPort, dstPort int, opts DumpOptions) error {
+	Record("db-clone", fmt.Sprintf("localhost:%d/%s", dstPort, db.DB),
+		fmt.Sprintf("%s localhost:%d → localhost:%d %s", db.Engine, srcPort, dstPort, opts))
+	switch db.Engine {
+	case "mysql":
+		return cloneMySQL(srcPort, dstPort, db.User, db.Pass, db.DB, opts)
+	case "mongo":
+		if !opts.IsEmpty() {
+			return fmt.Errorf("--schema-only/--tables/--exclude are not supported for mongo")
+		}
+		return cloneMongo(srcPort, dstPort, db.User, db.Pass, db.DB)
+	default:
+		return clonePostgres(srcPort, dstPort, db.User, db.Pass, db.DB, opts)
+	}
+}
+
+// Push overwrites a target database with a slot's: t.SlotPort is the
+// source and t.MainPort the database replaced, which is first dumped to
+// backup. Nothing is overwritten when either side isn't running
+// (ErrNotRunning) or the backup fails.
+func Push(t Target, backup string, opts DumpOptions) error {
+	if !Ready(t.DBService, t.SlotPort) {
+		return fmt.Errorf("slot %s on port %d: %w", t.Engine, t.SlotPort, ErrNotRunning)
+	}
+	if !Ready(t.DBService, t.MainPort) {
+		return fmt.Errorf("target %s on port %d: %w", t.Engine, t.MainPort, ErrNotRunning)
+	}
+	if err := Dump(t.DBService, t.MainPort, backup); err != nil {
+		return fmt.Errorf("backup failed, not overwriting: %w", err)
+	}
+	if err := Clone(t.DBService, t.SlotPort, t.MainPort, opts); err != nil {
+		return fmt.Errorf("failed to push: %w (restore from %s)", err, backup)
+	}
+	return nil
+}
+
+func clonePostgres(srcPort, dstPort int, user, pass, db string, opts DumpOptions) error {
+	// Use template1 as maintenance DB to avoid "cannot drop currently open database"
+	// when the target database is named "postgres"
+	maintDB := "template1"
+	dst := newPGClient(dstPort, "psql")
+
+	// 1. Terminate existing connections to target DB
+	cmd := dst.command(pass, "psql", "-U", user, "-d", maintDB, "-c",
+		fmt.Sprintf("SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE datname='%s' AND pid <> pg_backend_pid();", db))
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to terminate connections: %w", err)
+	}
+
+	// 2. Drop and recreate target DB
+	cmd = dst.command(pass, "psql", "-U", user, "-d", maintDB,
+		"-c", fmt.Sprintf("DROP DATABASE IF EXISTS %s;", db), "-c", fmt.Sprintf("CREATE DATABASE %s;", db))
+	if err := Run("db-drop", fmt.Sprintf("localhost:%d/%s", dstPort, db), cmd); err != nil {
+		return fmt.Errorf("failed to drop/create database: %w", err)
+	}
+
+	// 3. Parallel directory-format dump into a temp dir, then parallel restore
+	jobs := strconv.Itoa(opts.jobs())
+	tmpDir, err := os.MkdirTemp("", "slot-pgdump-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+	dumpDir := filepath.Join(tmpDir, "dump") // pg_dump -Fd wants to create the dir itself
+
+	dumpArgs := append([]string{"-U", user, "--no-owner", "-Fd", "-j", jobs}, opts.pgDumpArgs()...)
+	if err := pgDumpDir(newPGClient(srcPort, "pg_dump"), pass, dumpArgs, db, dumpDir); err != nil {
+		return err
+	}
+
+	restoreArgs := []string{"-U", user, "--no-owner", "--no-acl", "-j", jobs, "-d", db}
+	return pgRestoreDir(newPGClient(dstPort, "pg_restore"), pass, restoreArgs, dumpDir)
+}
+
+// CloneTemplate replaces database newDB with a server-side copy of db.DB on
+// the same postgres (CREATE DATABASE ... TEMPLATE), for slots sharing main's
+// instance. TEMPLATE needs the source to be idle, so its connections (main's
+// app) are terminated first; they reconnect on their next query.
+func CloneTemplate(db DBService, port int, newDB string) error {
+	if db.Engine != "postgres" {
+		return fmt.Errorf("template clones are postgres only, not %s", db.Engine)
+	}
+	c := newPGClient(port, "psql")
+	cmd := c.command(db.Pass, "psql", "-U", db.User, "-d", "template1",
+		"-c", fmt.Sprintf("SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE datname IN ('%s', '%s') AND pid <> pg_backend_pid();", db.DB, newDB),
+		"-c", fmt.Sprintf("DROP DATABASE IF EXISTS %s;", newDB),
+		"-c", fmt.Sprintf("CREATE DATABASE %s TEMPLATE %s;", newDB, db.DB))
+	if out, err := runOutput("db-clone-template", fmt.Sprintf("localhost:%d/%s", port, newDB), cmd); err != nil {
+		return fmt.Errorf("failed to clone %s into %s: %s", db.DB, newDB, out)
+	}
+	return nil
+}
+
+// SharedDBName names a shared-postgres slot's database on main's instance:
+// app for slot app-3 is app_slot3, for app-feature-x app_feature_x
+func SharedDBName(db, project, slotName string) string {
+	suffix := strings.TrimPrefix(slotName, project+"-")
+	if _, err := strconv.Atoi(suffix); err == nil {
+		suffix = "slot" + suffix
+	}
+	suffix = strings.Trim(regexp.MustCompile(`[^a-z0-9]+`).ReplaceAllString(strings.ToLower(suffix), "_"), "_")
+	name := db + "_" + suffix
+	if len(name) > 63 { // postgres truncates identifiers at 63 bytes
+		name = name[:63]
+	}
+	return name
+}
+
+// RenameDBInEnv points env content at newDB instead of oldDB on the server
+// at port: database name variables and connection URLs to that port
+func RenameDBInEnv(content string, port int, oldDB, newDB string) string {
+	urlRe := regexp.MustCompile(fmt.Sprintf(`(postgres(?:ql)?://[^\s"'/]*:%d/)%s([?"'\s]|$)`, port, regexp.QuoteMeta(oldDB)))
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		line = urlRe.ReplaceAllString(line, "${1}"+newDB+"${2}")
+		key, value, ok := strings.Cut(line, "=")
+		upper := strings.ToUpper(strings.TrimSpace(strings.TrimPrefix(key, "export ")))
+		if ok && (strings.Contains(upper, "DB") || strings.Contains(upper, "DATABASE")) && strings.Trim(strings.TrimSpace(value), `"'`) == oldDB {
+			line = key + "=" + strings.Replace(value, oldDB, newDB, 1)
+		}
+		lines[i] = line
+	}
+	return strings.Join(lines, "\n")
+}
+
+// DropDatabase drops a postgres database, closing its connections first
+func DropDatabase(db DBService, port int, name string) error {
+	c := newPGClient(port, "psql")
+	cmd := c.command(db.Pass, "psql", "-U", db.User, "-d", "template1",
+		"-c", fmt.Sprintf("SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE datname='%s' AND pid <> pg_backend_pid();", name),
+		"-c", fmt.Sprintf("DROP DATABASE IF EXISTS %s;", name))
+	if out, err := runOutput("db-drop", fmt.Sprintf("localhost:%d/%s", port, name), cmd); err != nil {
+		return fmt.Errorf("failed to drop %s: %s", name, out)
+	}
+	return nil
+}
+
+// runOutput is Run keeping the command's output for error messages
+func runOutput(action, target string, cmd *exec.Cmd) (string, error) {
+	var out strings.Builder
+	cmd.Stdout, cmd.Stderr = &out, &out
+	err := Run(action, target, cmd)
+	if err != nil && out.Len() == 0 {
+		return err.Error(), err
+	}
+	return strings.TrimSpace(out.String()), err
+}
+
+// pgDumpDir runs a directory-format pg_dump into localDir. Container dumps
+// are written inside the container and copied out; a host client that
+// rejects the server version is retried in the container.
+func pgDumpDir(c pgClient, pass string, args []string, db, localDir string) error {
+	if c.container == "" {
+		out, err := c.command(pass, "pg_dump", append(append(args, "-f", localDir), db)...).CombinedOutput()
+		if err == nil {
+			return nil
+		}
+		if !isPGVersionMismatch(out) {
+			return fmt.Errorf("failed to dump database: %s", strings.TrimSpace(string(out)))
+		}
+		if c = containerPGClient(c.port); c.container == "" {
+			return fmt.Errorf("failed to dump database: %s", strings.TrimSpace(string(out)))
+		}
+	}
+
+	remoteDir := "/tmp/" + filepath.Base(filepath.Dir(localDir))
+	defer exec.Command("docker", "exec", c.container, "rm", "-rf", remoteDir).Run()
+	if out, err := c.command(pass, "pg_dump", append(append(args, "-f", remoteDir), db)...).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to dump database: %s", strings.TrimSpace(string(out)))
+	}
+	if out, err := exec.Command("docker", "cp", c.container+":"+remoteDir, localDir).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to copy dump out of %s: %s", c.container, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// pgRestoreDir restores a directory-format dump, copying it into the
+// container first when running there
+func pgRestoreDir(c pgClient, pass string, args []string, localDir string) error {
+	if c.container == "" {
+		out, err := c.command(pass, "pg_restore", append(args, localDir)...).CombinedOutput()
+		if err == nil {
+			return nil
+		}
+		if !isPGVersionMismatch(out) {
+			return fmt.Errorf("failed to restore database: %s", strings.TrimSpace(string(out)))
+		}
+		if c = containerPGClient(c.port); c.container == "" {
+			return fmt.Errorf("failed to restore database: %s", strings.TrimSpace(string(out)))
+		}
+	}
+
+	remoteDir := "/tmp/" + filepath.Base(filepath.Dir(localDir))
+	defer exec.Command("docker", "exec", c.container, "rm", "-rf", remoteDir).Run()
+	if out, err := exec.Command("docker", "cp", localDir, c.container+":"+remoteDir).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to copy dump into %s: %s", c.container, strings.TrimSpace(string(out)))
+	}
+	if out, err := c.command(pass, "pg_restore", append(args, remoteDir)...).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to restore database: %s", strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// MaskSQL turns "table.column" -> expression masks into one UPDATE per
+// table, sorted so the output is stable
+func MaskSQL(masks map[string]string) string {
+	byTable := map[string][]string{}
+	for key, expr := range masks {
+		dot := strings.LastIndex(key, ".")
+		if dot <= 0 || dot == len(key)-1 {
+			continue
+		}
+		table, column := key[:dot], key[dot+1:]
+		byTable[table] = append(byTable[table], fmt.Sprintf("%s = %s", column, expr))
+	}
+
+	tables := make([]string, 0, len(byTable))
+	for table := range byTable {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+
+	var b strings.Builder
+	for _, table := range tables {
+		sets := byTable[table]
+		sort.Strings(sets)
+		fmt.Fprintf(&b, "UPDATE %s SET %s;\n", table, strings.Join(sets, ", "))
+	}
+	return b.String()
+}
+
+// RunSQL executes a SQL script against a database
+func RunSQL(db DBService, port int, script string) error {
+	var cmd *exec.Cmd
+	switch db.Engine {
+	case "mysql":
+		cmd = exec.Command("mysql", append(mysqlArgs(port, db.User), db.DB)...)
+		cmd.Env = append(os.Environ(), "MYSQL_PWD="+db.Pass)
+	case "postgres":
+		cmd = newPGClient(port, "psql").command(db.Pass, "psql", "-U", db.User, "-v", "ON_ERROR_STOP=1", "-q", "-d", db.DB)
+	default:
+		return fmt.Errorf("running SQL is not supported for %s", db.Engine)
+	}
+	cmd.Stdin = strings.NewReader(script)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// mysqlArgs returns connection flags; 127.0.0.1 forces TCP (localhost uses the socket)
+func mysqlArgs(port int, user string) []string {
+	return []string{"-h", "127.0.0.1", "-P", strconv.Itoa(port), "-u", user}
+}
+
+func isMySQLReady(port int, user, pass, db string) bool {
+	args := append(mysqlArgs(port, user), "-e", "SELECT 1")
+	if db != "" {
+		args = append(args, db)
+	}
+	cmd := exec.Command("mysql", args...)
+	cmd.Env = append(os.Environ(), "MYSQL_PWD="+pass)
+	return cmd.Run() == nil
+}
+
+func cloneMySQL(srcPort, dstPort int, user, pass, db string, opts DumpOptions) error {
+	if db == "" {
+		return fmt.Errorf("no MYSQL_DATABASE set in docker-compose")
+	}
+	env := append(os.Environ(), "MYSQL_PWD="+pass)
+
+	// 1. Drop and recreate target DB
+	cmd := exec.Command("mysql", append(mysqlArgs(dstPort, user), "-e",
+		fmt.Sprintf("DROP DATABASE IF EXISTS `%s`; CREATE DATABASE `%s`;", db, db))...)
+	cmd.Env = env
+	if err := Run("db-drop", fmt.Sprintf("localhost:%d/%s", dstPort, db), cmd); err != nil {
+		return fmt.Errorf("failed to drop/create database: %w", err)
+	}
+
+	// 2. Pipe dump to fresh DB
+	flags, tables := opts.mysqldumpArgs(db)
+	dumpArgs := append(mysqlArgs(srcPort, user), "--single-transaction", "--routines", "--triggers")
+	dumpArgs = append(append(append(dumpArgs, flags...), db), tables...)
+	dump := exec.Command("mysqldump", dumpArgs...)
+	dump.Env = env
+	restore := exec.Command("mysql", append(mysqlArgs(dstPort, user), db)...)
+	restore.Env = env
+	restore.Stderr = os.Stderr
+
+	pipe, err := dump.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	restore.Stdin = pipe
+	if err := dump.Start(); err != nil {
+		return fmt.Errorf("failed to start mysqldump: %w", err)
+	}
+	if err := restore.Run(); err != nil {
+		dump.Wait()
+		return fmt.Errorf("failed to restore database: %w", err)
+	}
+	if err := dump.Wait(); err != nil {
+		return fmt.Errorf("mysqldump failed: %w", err)
+	}
+
+	return nil
+}
+
+// mongoArgs returns connection flags for mongosh/mongodump/mongorestore
+func mongoArgs(port int, user, pass string) []string {
+	args := []string{"--host", "127.0.0.1", "--port", strconv.Itoa(port)}
+	if user != "" {
+		args = append(args, "--username", user, "--password", pass, "--authenticationDatabase", "admin")
+	}
+	return args
+}
+
+func isMongoReady(port int, user, pass string) bool {
+	args := append([]string{"--quiet"}, mongoArgs(port, user, pass)...)
+	args = append(args, "--eval", "db.runCommand({ ping: 1 })")
+	return exec.Command("mongosh", args...).Run() == nil
+}
+
+// cloneMongo pipes mongodump into mongorestore --drop. An empty db
+// clones every database.
+func cloneMongo(srcPort, dstPort int, user, pass, db string) error {
+	dumpArgs := append(mongoArgs(srcPort, user, pass), "--archive", "--quiet")
+	if db != "" {
+		dumpArgs = append(dumpArgs, "--db", db)
+	}
+	restoreArgs := append(mongoArgs(dstPort, user, pass), "--archive", "--drop", "--quiet")
+
+	dump := exec.Command("mongodump", dumpArgs...)
+	restore := exec.Command("mongorestore", restoreArgs...)
+
+	pipe, err := dump.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	restore.Stdin = pipe
+	restore.Stderr = os.Stderr
+
+	if err := dump.Start(); err != nil {
+		return fmt.Errorf("failed to start mongodump: %w", err)
+	}
+	if err := restore.Run(); err != nil {
+		dump.Wait()
+		return fmt.Errorf("failed to restore database: %w", err)
+	}
+	if err := dump.Wait(); err != nil {
+		return fmt.Errorf("mongodump failed: %w", err)
+	}
+	return nil
+}
+
+// RedisArgs returns redis-cli connection flags
+func RedisArgs(port int, pass string) []string {
+	args := []string{"-h", "127.0.0.1", "-p", strconv.Itoa(port)}
+	if pass != "" {
+		args = append(args, "--no-auth-warning", "-a", pass)
+	}
+	return args
+}
+
+func isRedisReady(port int, pass string) bool {
+	out, err := exec.Command("redis-cli", append(RedisArgs(port, pass), "ping")...).Output()
+	return err == nil && strings.TrimSpace(string(out)) == "PONG"
+}
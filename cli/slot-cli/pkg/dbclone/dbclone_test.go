@@ -0,0 +1,326 @@
+package dbclone
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestParseDockerComposeContent(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		wantUser string
+		wantPass string
+		wantDB   string
+	}{
+		{
+			"all three values",
+			"POSTGRES_USER: myuser\nPOSTGRES_PASSWORD: mypass\nPOSTGRES_DB: mydb",
+			"myuser", "mypass", "mydb",
+		},
+		{
+			"quoted values",
+			`POSTGRES_USER: "myuser"
+POSTGRES_PASSWORD: 'mypass'
+POSTGRES_DB: "mydb"`,
+			"myuser", "mypass", "mydb",
+		},
+		{
+			"partial - only user",
+			"POSTGRES_USER: admin",
+			"admin", "postgres", "postgres",
+		},
+		{
+			"empty content",
+			"",
+			"postgres", "postgres", "postgres",
+		},
+		{
+			"with surrounding yaml",
+			`services:
+  postgres:
+    environment:
+      POSTGRES_USER: dbuser
+      POSTGRES_PASSWORD: dbpass
+      POSTGRES_DB: appdb
+    ports:
+      - "5432:5432"`,
+			"dbuser", "dbpass", "appdb",
+		},
+		{
+			"extra whitespace",
+			"POSTGRES_USER:   spaced  ",
+			"spaced", "postgres", "postgres",
+		},
+		{
+			"empty pass-through values",
+			"POSTGRES_USER:\nPOSTGRES_PASSWORD:\nPOSTGRES_DB:",
+			"postgres", "postgres", "postgres",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, pass, db := parseDockerComposeContent(tt.content)
+			if user != tt.wantUser {
+				t.Errorf("user = %q, want %q", user, tt.wantUser)
+			}
+			if pass != tt.wantPass {
+				t.Errorf("pass = %q, want %q", pass, tt.wantPass)
+			}
+			if db != tt.wantDB {
+				t.Errorf("db = %q, want %q", db, tt.wantDB)
+			}
+		})
+	}
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name    string
+		compose string
+		want    []DBService
+	}{
+		{
+			"postgres image",
+			`services:
+  db:
+    image: postgres:16
+    environment:
+      POSTGRES_USER: app
+      POSTGRES_PASSWORD: secret
+      POSTGRES_DB: appdb
+`,
+			[]DBService{{Engine: "postgres", Service: "db", PortVar: "POSTGRES_PORT", User: "app", Pass: "secret", DB: "appdb"}},
+		},
+		{
+			"mysql with list env",
+			`services:
+  mysql:
+    image: mysql:8
+    environment:
+      - MYSQL_USER=app
+      - MYSQL_PASSWORD=secret
+      - MYSQL_DATABASE=appdb
+`,
+			[]DBService{{Engine: "mysql", Service: "mysql", PortVar: "MYSQL_PORT", User: "app", Pass: "secret", DB: "appdb"}},
+		},
+		{
+			"mariadb root user",
+			`services:
+  maria:
+    image: "mariadb:11"
+    environment:
+      MARIADB_ROOT_PASSWORD: rootpw
+      MARIADB_DATABASE: shop
+`,
+			[]DBService{{Engine: "mysql", Service: "maria", PortVar: "MYSQL_PORT", User: "root", Pass: "rootpw", DB: "shop"}},
+		},
+		{
+			"legacy postgres vars without image",
+			`services:
+  db:
+    build: ./db
+    environment:
+      POSTGRES_DB: legacy
+`,
+			[]DBService{{Engine: "postgres", PortVar: "POSTGRES_PORT", User: "postgres", Pass: "postgres", DB: "legacy"}},
+		},
+		{
+			"postgres and mysql",
+			`services:
+  pg:
+    image: postgres
+  my:
+    image: mysql
+    environment:
+      MYSQL_ROOT_PASSWORD: pw
+      MYSQL_DATABASE: x
+`,
+			[]DBService{
+				{Engine: "postgres", Service: "pg", PortVar: "POSTGRES_PORT", User: "postgres", Pass: "postgres", DB: "postgres"},
+				{Engine: "mysql", Service: "my", PortVar: "MYSQL_PORT", User: "root", Pass: "pw", DB: "x"},
+			},
+		},
+		{
+			"no databases",
+			"services:\n  web:\n    image: node:20\n",
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Detect(tt.compose)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d services %+v, want %d", len(got), got, len(tt.want))
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("service %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPushNeedsBothDatabasesRunning(t *testing.T) {
+	backup := filepath.Join(t.TempDir(), "target.dump")
+	target := Target{DBService: DBService{Engine: "redis", DB: "0"}, MainPort: 1, SlotPort: 1}
+	if err := Push(target, backup, DumpOptions{}); !errors.Is(err, ErrNotRunning) {
+		t.Fatalf("Push() = %v, want ErrNotRunning", err)
+	}
+	if _, err := os.Stat(backup); !os.IsNotExist(err) {
+		t.Errorf("Push() wrote a backup although nothing was pushed")
+	}
+}
+
+func TestDumpOptionsPgDumpArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		opts DumpOptions
+		want string
+	}{
+		{"empty", DumpOptions{}, ""},
+		{"schema only", DumpOptions{SchemaOnly: true}, "--schema-only"},
+		{"tables", DumpOptions{Tables: []string{"users", "accounts"}}, "--table=users --table=accounts"},
+		{"exclude", DumpOptions{Exclude: []string{"events", "audit_log"}}, "--exclude-table-data=events --exclude-table-data=audit_log"},
+		{"combined", DumpOptions{Tables: []string{"users"}, Exclude: []string{"events"}}, "--table=users --exclude-table-data=events"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := strings.Join(tt.opts.pgDumpArgs(), " "); got != tt.want {
+				t.Errorf("pgDumpArgs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDumpOptionsJobs(t *testing.T) {
+	defaultJobs := min(runtime.NumCPU(), 4)
+	tests := []struct {
+		name string
+		opts DumpOptions
+		want int
+	}{
+		{"default is CPUs capped at 4", DumpOptions{}, defaultJobs},
+		{"explicit", DumpOptions{Jobs: 2}, 2},
+		{"explicit above the cap", DumpOptions{Jobs: 8}, 8},
+		{"negative falls back", DumpOptions{Jobs: -1}, defaultJobs},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.opts.jobs(); got != tt.want {
+				t.Errorf("jobs() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsPGVersionMismatch(t *testing.T) {
+	tests := []struct {
+		out  string
+		want bool
+	}{
+		{"pg_dump: error: aborting because of server version mismatch", true},
+		{"pg_restore: error: unsupported version (1.16) in file header", true},
+		{"pg_dump: error: connection to server failed", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := isPGVersionMismatch([]byte(tt.out)); got != tt.want {
+			t.Errorf("isPGVersionMismatch(%q) = %v, want %v", tt.out, got, tt.want)
+		}
+	}
+}
+
+func TestMaskSQL(t *testing.T) {
+	tests := []struct {
+		name  string
+		masks map[string]string
+		want  string
+	}{
+		{"empty", nil, ""},
+		{
+			"groups columns by table",
+			map[string]string{
+				"users.name":    "'User ' || id",
+				"users.email":   "'user' || id || '@example.test'",
+				"accounts.iban": "NULL",
+			},
+			"UPDATE accounts SET iban = NULL;\n" +
+				"UPDATE users SET email = 'user' || id || '@example.test', name = 'User ' || id;\n",
+		},
+		{"schema-qualified table", map[string]string{"public.users.phone": "NULL"}, "UPDATE public.users SET phone = NULL;\n"},
+		{"skips keys without a column", map[string]string{"users": "NULL", "users.": "NULL"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MaskSQL(tt.masks); got != tt.want {
+				t.Errorf("MaskSQL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindContainerForHostPort(t *testing.T) {
+	ps := "exceder-1-postgres\t0.0.0.0:5433->5432/tcp, [::]:5433->5432/tcp\n" +
+		"exceder-postgres\t0.0.0.0:5432->5432/tcp\n" +
+		"exceder-1-api\t0.0.0.0:30010->3000/tcp\n" +
+		"worker\t\n"
+	tests := []struct {
+		port          int
+		wantContainer string
+		wantPort      int
+	}{
+		{5433, "exceder-1-postgres", 5432},
+		{5432, "exceder-postgres", 5432},
+		{30010, "exceder-1-api", 3000},
+		{543, "", 0},
+		{9999, "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.port), func(t *testing.T) {
+			container, port := findContainerForHostPort(ps, tt.port)
+			if container != tt.wantContainer || port != tt.wantPort {
+				t.Errorf("findContainerForHostPort(%d) = %q, %d, want %q, %d", tt.port, container, port, tt.wantContainer, tt.wantPort)
+			}
+		})
+	}
+}
+
+func TestSharedDBName(t *testing.T) {
+	tests := []struct {
+		db, slot, want string
+	}{
+		{"app", "app-3", "app_slot3"},
+		{"app_dev", "app-feature-X", "app_dev_feature_x"},
+		{"app", "app-" + strings.Repeat("a", 70), "app_" + strings.Repeat("a", 59)},
+	}
+	for _, tt := range tests {
+		if got := SharedDBName(tt.db, "app", tt.slot); got != tt.want {
+			t.Errorf("SharedDBName(%q, %q) = %q, want %q", tt.db, tt.slot, got, tt.want)
+		}
+	}
+}
+
+func TestRenameDBInEnv(t *testing.T) {
+	in := `POSTGRES_DB=app
+DB_NAME="app"
+APP_NAME=app
+DATABASE_URL=postgresql://u:p@localhost:5432/app?schema=public
+OTHER_URL=postgres://u:p@localhost:5433/app
+SHADOW_URL="postgres://u:p@localhost:5432/app_shadow"`
+	want := `POSTGRES_DB=app_slot3
+DB_NAME="app_slot3"
+APP_NAME=app
+DATABASE_URL=postgresql://u:p@localhost:5432/app_slot3?schema=public
+OTHER_URL=postgres://u:p@localhost:5433/app
+SHADOW_URL="postgres://u:p@localhost:5432/app_shadow"`
+	if got := RenameDBInEnv(in, 5432, "app", "app_slot3"); got != want {
+		t.Errorf("RenameDBInEnv =\n%s\nwant\n%s", got, want)
+	}
+}
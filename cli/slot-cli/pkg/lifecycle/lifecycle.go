@@ -0,0 +1,141 @@
+// Package lifecycle runs the slot flows that create and remove worktrees:
+// new, provision, delete and done. They return what they did or an error
+// instead of printing and exiting; the CLI supplies the side effects tied
+// to its registry, config and audit log through Env.
+package lifecycle
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+
+	"github.com/mauriciopiber/exceder/cli/slot-cli/pkg/worktree"
+)
+
+// Slot is a slot worktree of a project
+type Slot struct {
+	MainRepo string
+	Project  string
+	Name     string
+	Path     string
+	Branch   string // "" when detached
+}
+
+// Env connects the flows to the CLI around them
+type Env struct {
+	// Out receives the output of commands the user should see (git merge, gh)
+	Out io.Writer
+	// Logf reports progress, one line per call
+	Logf func(format string, args ...any)
+	// Run runs a command that changes a repository, recording it in the audit log
+	Run func(action, slot string, cmd *exec.Cmd) error
+	// Register records a new slot in the registry and the state the CLI
+	// keeps per slot, before its post-create hooks run
+	Register func(s Slot)
+	// Hook runs the configured hooks for an event in the slot
+	Hook func(event string, s Slot)
+	// StopDocker takes down the slot's compose stacks
+	StopDocker func(slotPath string)
+	// SavePatch saves uncommitted changes before a dirty slot is removed and
+	// returns the patch file, "" if there was nothing to save
+	SavePatch func(s Slot) string
+	// Journal records a removal so `slot-cli undo` can restore it
+	Journal func(action string, s Slot)
+	// Trash moves the worktree into the trash and returns where it went
+	Trash func(s Slot) (string, error)
+	// Forget drops a removed slot from the registry with its tunnel and DNS
+	// name; dropDBs also drops its databases on main's postgres, for slots
+	// that can't come back from the trash
+	Forget func(s Slot, dropDBs bool)
+}
+
+// Check is what removing a slot would lose
+type Check struct {
+	Dirty    bool     // uncommitted changes, saved as a patch on removal
+	Unpushed []string // commits in neither main nor any remote
+}
+
+// Inspect reports what removing s would lose
+func Inspect(s Slot) Check {
+	out, _ := exec.Command("git", "-C", s.Path, "status", "--porcelain").Output()
+	return Check{
+		Dirty:    len(out) > 0,
+		Unpushed: worktree.UnpushedCommits(s.MainRepo, s.Branch),
+	}
+}
+
+// Removed is what Delete and Done left behind
+type Removed struct {
+	Patch   string // uncommitted changes, "" if the slot was clean
+	Trashed string // trash directory, "" when the worktree was removed outright
+}
+
+// Delete removes a slot: runs the pre-delete hooks, saves uncommitted
+// changes, stops docker, moves the worktree into the trash (or with noTrash
+// removes it outright, journaled for undo), deletes the branch and forgets
+// the slot. A trashed slot keeps its databases for undelete.
+func Delete(env Env, s Slot, noTrash bool) (Removed, error) {
+	var res Removed
+	env.Hook("pre-delete", s)
+	if Inspect(s).Dirty {
+		res.Patch = env.SavePatch(s)
+	}
+	env.StopDocker(s.Path)
+
+	if noTrash {
+		env.Journal("delete", s)
+		env.Run("delete", s.Name, exec.Command("git", "-C", s.MainRepo, "worktree", "remove", s.Path, "--force"))
+	} else {
+		var err error
+		if res.Trashed, err = env.Trash(s); err != nil {
+			return res, fmt.Errorf("could not move %s to the trash: %w", s.Name, err)
+		}
+	}
+	if s.Branch != "" {
+		env.Run("delete", s.Name, exec.Command("git", "-C", s.MainRepo, "branch", "-D", s.Branch))
+	}
+	env.Forget(s, res.Trashed == "")
+	return res, nil
+}
+
+// ErrMergeConflict is returned by Done when the branch doesn't merge cleanly;
+// the merge is left in progress in main and the slot in place
+var ErrMergeConflict = errors.New("merge conflict")
+
+// Done merges a slot's branch into main with message, then removes the
+// worktree and branch (journaled for undo) and forgets the slot. Docker
+// is stopped before the merge.
+func Done(env Env, s Slot, message string) (Removed, error) {
+	var res Removed
+	if s.Branch == "" {
+		return res, fmt.Errorf("slot %s is on a detached HEAD; there is no branch to merge", s.Name)
+	}
+	dirty := Inspect(s).Dirty
+	env.Hook("pre-delete", s)
+
+	env.Logf("Stopping docker...")
+	env.StopDocker(s.Path)
+	env.Logf("✓ Docker stopped")
+
+	env.Logf("\nMerging %s into main...", s.Branch)
+	cmd := exec.Command("git", "-C", s.MainRepo, "merge", "--no-ff", "-m", message, s.Branch)
+	cmd.Stdout = env.Out
+	cmd.Stderr = env.Out
+	if err := env.Run("done", s.Name, cmd); err != nil {
+		return res, ErrMergeConflict
+	}
+	env.Logf("✓ Merged %s into main", s.Branch)
+
+	env.Logf("\nCleaning up...")
+	if dirty {
+		res.Patch = env.SavePatch(s)
+	}
+	env.Journal("done", s)
+	env.Run("done", s.Name, exec.Command("git", "-C", s.MainRepo, "worktree", "remove", s.Path, "--force"))
+	env.Run("done", s.Name, exec.Command("git", "-C", s.MainRepo, "branch", "-D", s.Branch))
+	env.Logf("✓ Removed worktree and branch")
+
+	env.Forget(s, true)
+	return res, nil
+}
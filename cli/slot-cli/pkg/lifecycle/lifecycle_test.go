@@ -0,0 +1,178 @@
+package lifecycle
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var gitIdentity = []string{"GIT_AUTHOR_NAME=t", "GIT_AUTHOR_EMAIL=t@t", "GIT_COMMITTER_NAME=t", "GIT_COMMITTER_EMAIL=t@t"}
+
+// newSlot creates a main repo with one commit and a slot worktree app-1 on
+// branch slot-1 that adds feature.txt
+func newSlot(t *testing.T) Slot {
+	root := t.TempDir()
+	s := Slot{MainRepo: filepath.Join(root, "app"), Project: "app", Name: "app-1", Path: filepath.Join(root, "app-1"), Branch: "slot-1"}
+	git := func(dir string, args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		cmd.Env = append(os.Environ(), gitIdentity...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	os.MkdirAll(s.MainRepo, 0755)
+	git(s.MainRepo, "init", "-q")
+	git(s.MainRepo, "commit", "-q", "--allow-empty", "-m", "init")
+	git(s.MainRepo, "worktree", "add", "-q", "-b", s.Branch, s.Path)
+	os.WriteFile(filepath.Join(s.Path, "feature.txt"), []byte("feature\n"), 0644)
+	git(s.Path, "add", "-A")
+	git(s.Path, "commit", "-qm", "feature")
+	return s
+}
+
+// recordingEnv is an Env that runs git for real and logs every other side
+// effect as a call
+func recordingEnv(calls *[]string) Env {
+	record := func(format string, args ...any) { *calls = append(*calls, fmt.Sprintf(format, args...)) }
+	return Env{
+		Out:  io.Discard,
+		Logf: func(string, ...any) {},
+		Run: func(action, slot string, cmd *exec.Cmd) error {
+			cmd.Env = append(os.Environ(), gitIdentity...)
+			return cmd.Run()
+		},
+		Hook:       func(event string, s Slot) { record("hook %s", event) },
+		StopDocker: func(string) { record("stop docker") },
+		SavePatch:  func(Slot) string { record("save patch"); return "changes.patch" },
+		Journal:    func(action string, s Slot) { record("journal %s", action) },
+		Trash: func(s Slot) (string, error) {
+			record("trash")
+			dir := s.Path + ".trashed"
+			if err := os.Rename(s.Path, dir); err != nil {
+				return "", err
+			}
+			return dir, exec.Command("git", "-C", s.MainRepo, "worktree", "prune").Run()
+		},
+		Forget: func(s Slot, dropDBs bool) { record("forget dropDBs=%v", dropDBs) },
+	}
+}
+
+func branchExists(s Slot) bool {
+	return exec.Command("git", "-C", s.MainRepo, "rev-parse", "--verify", "--quiet", "refs/heads/"+s.Branch).Run() == nil
+}
+
+func TestInspect(t *testing.T) {
+	s := newSlot(t)
+	if check := Inspect(s); check.Dirty || len(check.Unpushed) != 1 || !strings.HasSuffix(check.Unpushed[0], "feature") {
+		t.Errorf("Inspect() = %+v, want clean with the feature commit unpushed", check)
+	}
+	os.WriteFile(filepath.Join(s.Path, "scratch.txt"), []byte("wip\n"), 0644)
+	if !Inspect(s).Dirty {
+		t.Errorf("Inspect() not dirty with an untracked file")
+	}
+}
+
+func TestDelete(t *testing.T) {
+	tests := []struct {
+		name    string
+		noTrash bool
+		dirty   bool
+		want    []string
+	}{
+		{"trash keeps the databases", false, false,
+			[]string{"hook pre-delete", "stop docker", "trash", "forget dropDBs=false"}},
+		{"no-trash journals and drops them", true, false,
+			[]string{"hook pre-delete", "stop docker", "journal delete", "forget dropDBs=true"}},
+		{"dirty slots are saved first", true, true,
+			[]string{"hook pre-delete", "save patch", "stop docker", "journal delete", "forget dropDBs=true"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSlot(t)
+			if tt.dirty {
+				os.WriteFile(filepath.Join(s.Path, "scratch.txt"), []byte("wip\n"), 0644)
+			}
+			var calls []string
+			res, err := Delete(recordingEnv(&calls), s, tt.noTrash)
+			if err != nil {
+				t.Fatalf("Delete() error: %v", err)
+			}
+			if !slices.Equal(calls, tt.want) {
+				t.Errorf("calls = %q, want %q", calls, tt.want)
+			}
+			if (res.Trashed != "") == tt.noTrash || (res.Patch != "") != tt.dirty {
+				t.Errorf("Delete() = %+v", res)
+			}
+			if _, err := os.Stat(s.Path); !os.IsNotExist(err) {
+				t.Errorf("worktree still at %s", s.Path)
+			}
+			if branchExists(s) {
+				t.Errorf("branch %s not deleted", s.Branch)
+			}
+		})
+	}
+}
+
+func TestDeleteTrashFailureKeepsSlot(t *testing.T) {
+	s := newSlot(t)
+	var calls []string
+	env := recordingEnv(&calls)
+	env.Trash = func(Slot) (string, error) { return "", errors.New("disk full") }
+	if _, err := Delete(env, s, false); err == nil || !strings.Contains(err.Error(), "disk full") {
+		t.Fatalf("Delete() error = %v, want the trash failure", err)
+	}
+	if slices.ContainsFunc(calls, func(c string) bool { return strings.HasPrefix(c, "forget") }) {
+		t.Errorf("slot forgotten although it wasn't removed: %q", calls)
+	}
+	if !branchExists(s) {
+		t.Errorf("branch deleted although the worktree stayed")
+	}
+}
+
+func TestDone(t *testing.T) {
+	s := newSlot(t)
+	var calls []string
+	if _, err := Done(recordingEnv(&calls), s, "Merge app-1"); err != nil {
+		t.Fatalf("Done() error: %v", err)
+	}
+	if want := []string{"hook pre-delete", "stop docker", "journal done", "forget dropDBs=true"}; !slices.Equal(calls, want) {
+		t.Errorf("calls = %q, want %q", calls, want)
+	}
+	if _, err := os.Stat(filepath.Join(s.MainRepo, "feature.txt")); err != nil {
+		t.Errorf("feature.txt not merged into main: %v", err)
+	}
+	if out, _ := exec.Command("git", "-C", s.MainRepo, "log", "-1", "--format=%s").Output(); strings.TrimSpace(string(out)) != "Merge app-1" {
+		t.Errorf("merge commit = %q", out)
+	}
+	if _, err := os.Stat(s.Path); !os.IsNotExist(err) || branchExists(s) {
+		t.Errorf("worktree or branch left behind")
+	}
+}
+
+func TestDoneConflictKeepsSlot(t *testing.T) {
+	s := newSlot(t)
+	os.WriteFile(filepath.Join(s.MainRepo, "feature.txt"), []byte("main's version\n"), 0644)
+	cmd := exec.Command("git", "-C", s.MainRepo, "commit", "-qm", "conflicting")
+	exec.Command("git", "-C", s.MainRepo, "add", "-A").Run()
+	cmd.Env = append(os.Environ(), gitIdentity...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("commit in main: %v\n%s", err, out)
+	}
+
+	var calls []string
+	if _, err := Done(recordingEnv(&calls), s, "Merge app-1"); !errors.Is(err, ErrMergeConflict) {
+		t.Fatalf("Done() error = %v, want ErrMergeConflict", err)
+	}
+	if _, err := os.Stat(s.Path); err != nil || !branchExists(s) {
+		t.Errorf("slot removed after a failed merge")
+	}
+	if slices.Contains(calls, "forget dropDBs=true") {
+		t.Errorf("slot forgotten after a failed merge: %q", calls)
+	}
+}
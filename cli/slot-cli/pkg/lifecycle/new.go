@@ -0,0 +1,259 @@
+package lifecycle
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mauriciopiber/exceder/cli/slot-cli/pkg/dbclone"
+)
+
+// Source is where a new slot's worktree starts; the zero value branches off
+// main's HEAD
+type Source struct {
+	RemoteRef string // remote/branch to fetch and track (new --from)
+	PR        int    // GitHub PR to check out with gh (new --pr)
+	Rev       string // commit to branch off (new --at)
+	Detach    bool   // stay detached at Rev instead of branching
+}
+
+// ErrFetch is returned (wrapped) when a Source's remote branch can't be fetched
+var ErrFetch = errors.New("could not fetch")
+
+// run runs a command in dir with its output going to env.Out
+func run(env Env, dir, name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Dir = dir
+	cmd.Stdout = env.Out
+	cmd.Stderr = env.Out
+	return cmd.Run()
+}
+
+// AddWorktree creates s's worktree on branch s.Branch, from src. A
+// worktree left behind by a failed PR checkout is removed again.
+func AddWorktree(env Env, s Slot, src Source) error {
+	switch {
+	case src.RemoteRef != "":
+		remote, branch, _ := strings.Cut(src.RemoteRef, "/")
+		env.Logf("Fetching %s...", src.RemoteRef)
+		if err := run(env, s.MainRepo, "git", "fetch", remote, branch); err != nil {
+			return fmt.Errorf("%w %s", ErrFetch, src.RemoteRef)
+		}
+		if err := run(env, s.MainRepo, "git", "worktree", "add", "--track", "-b", s.Branch, s.Path, src.RemoteRef); err != nil {
+			return fmt.Errorf("failed to create worktree")
+		}
+	case src.PR != 0:
+		if err := run(env, s.MainRepo, "git", "worktree", "add", "--detach", s.Path); err != nil {
+			return fmt.Errorf("failed to create worktree")
+		}
+		if err := run(env, s.Path, "gh", "pr", "checkout", strconv.Itoa(src.PR), "--branch", s.Branch); err != nil {
+			run(env, s.MainRepo, "git", "worktree", "remove", "--force", s.Path)
+			return fmt.Errorf("gh pr checkout %d failed", src.PR)
+		}
+	case src.Rev != "" && src.Detach:
+		if err := run(env, s.MainRepo, "git", "worktree", "add", "--detach", s.Path, src.Rev); err != nil {
+			return fmt.Errorf("failed to create worktree")
+		}
+	case src.Rev != "":
+		if err := run(env, s.MainRepo, "git", "worktree", "add", s.Path, "-b", s.Branch, src.Rev); err != nil {
+			return fmt.Errorf("failed to create worktree")
+		}
+	default:
+		if err := run(env, s.MainRepo, "git", "worktree", "add", s.Path, "-b", s.Branch); err != nil {
+			return fmt.Errorf("failed to create worktree")
+		}
+	}
+	return nil
+}
+
+// Steps are the heavy setup steps of a slot, in the order they run
+var Steps = []string{"copy", "docker", "db", "deps"}
+
+// ProvisionOptions selects the setup steps Provision runs
+type ProvisionOptions struct {
+	Steps []string // subset of Steps
+
+	// Give the slot databases on main's postgres instead of its own container
+	SharedPostgres bool
+
+	Timings *Timings // new --timings; nil when not timed
+}
+
+// Provisioner does the work of each setup step; the CLI supplies it with
+// the project's config and the slot's compose selection
+type Provisioner struct {
+	CopyFiles      func(s Slot) // main's gitignored files, per .slotignore
+	ResolveSecrets func(s Slot) // secret references in the copied env files
+	// MainPostgres lists main's postgres databases, for shared-postgres slots
+	MainPostgres func(s Slot) []dbclone.Target
+	// AllocatePorts maps main's ports to free slot ports from offset on
+	AllocatePorts func(s Slot, offset int) map[int]int
+	// RewritePorts applies a port map to the slot's env, config and compose files
+	RewritePorts func(s Slot, portMap map[int]int)
+	// RenameDB points the slot's env files from oldDB on port to newDB
+	RenameDB func(s Slot, port int, oldDB, newDB string)
+	// StartDocker starts the slot's compose stacks, cloning main's databases withDB
+	StartDocker func(s Slot, withDB bool, opts ProvisionOptions)
+
+	DBFiles     []string // file-based databases (sqlite), relative to the repo
+	CopyDBFiles func(s Slot, files []string)
+	InstallDeps func(s Slot)
+}
+
+// Provision runs opts.Steps for s: copies gitignored files, maps ports
+// (when portOffset > 0), starts docker, clones databases and installs
+// dependencies. Returns the port map, main port to slot port.
+func Provision(env Env, p Provisioner, s Slot, portOffset int, opts ProvisionOptions) map[int]int {
+	if slices.Contains(opts.Steps, "copy") {
+		done := opts.Timings.Track("file copy")
+		p.CopyFiles(s)
+		env.Logf("✓ Copied gitignored files")
+		p.ResolveSecrets(s)
+		done()
+	}
+
+	var shared []dbclone.Target
+	if opts.SharedPostgres {
+		shared = p.MainPostgres(s)
+	}
+
+	var portMap map[int]int
+	if portOffset > 0 {
+		done := opts.Timings.Track("port scan")
+		portMap = p.AllocatePorts(s, portOffset)
+		done()
+		for _, t := range shared {
+			if _, ok := portMap[t.MainPort]; ok {
+				delete(portMap, t.MainPort)
+				env.Logf("  %s stays %d: the slot uses main's postgres", t.PortVar, t.MainPort)
+			}
+		}
+		if len(portMap) > 0 {
+			done := opts.Timings.Track("env rewrite")
+			p.RewritePorts(s, portMap)
+			env.Logf("✓ Port mapping complete")
+			done()
+		}
+		for _, t := range shared {
+			p.RenameDB(s, t.MainPort, t.DB, dbclone.SharedDBName(t.DB, s.Project, s.Name))
+		}
+	}
+
+	// Without slot ports the compose stack would collide with main's
+	withDB := slices.Contains(opts.Steps, "db")
+	if (slices.Contains(opts.Steps, "docker") || withDB) && (portOffset == 0 || len(portMap) > 0) {
+		p.StartDocker(s, withDB, opts)
+	}
+
+	// Copy file-based databases (too large for CopyFiles)
+	if withDB && len(p.DBFiles) > 0 {
+		done := opts.Timings.Track("db clone")
+		env.Logf("\nCopying sqlite databases...")
+		p.CopyDBFiles(s, p.DBFiles)
+		done()
+	}
+
+	if slices.Contains(opts.Steps, "deps") {
+		done := opts.Timings.Track("deps install")
+		p.InstallDeps(s)
+		done()
+	}
+
+	return portMap
+}
+
+// NewOptions is how New creates a slot
+type NewOptions struct {
+	Source     Source
+	PortOffset int // first slot port is main's plus this
+	Provision  ProvisionOptions
+}
+
+// New creates a slot: adds its worktree from opts.Source, provisions it,
+// records it with Env.Register and runs the post-create hooks. Returns the
+// port map, main port to slot port.
+func New(env Env, p Provisioner, s Slot, opts NewOptions) (map[int]int, error) {
+	done := opts.Provision.Timings.Track("worktree add")
+	if err := AddWorktree(env, s, opts.Source); err != nil {
+		return nil, err
+	}
+	done()
+	env.Logf("✓ Created worktree")
+
+	portMap := Provision(env, p, s, opts.PortOffset, opts.Provision)
+	env.Register(s)
+
+	done = opts.Provision.Timings.Track("hooks")
+	env.Hook("post-create", s)
+	done()
+	return portMap, nil
+}
+
+// Timings records how long each phase of slot creation took (new --timings).
+// A nil *Timings records nothing, so callers track phases unconditionally.
+type Timings struct {
+	Phases []Phase
+}
+
+// Phase is the time spent in one named step; repeats (e.g. one docker up
+// per compose dir) add up
+type Phase struct {
+	Name     string
+	Duration time.Duration
+}
+
+// Track starts timing a phase; call the returned func when it ends
+func (t *Timings) Track(name string) func() {
+	if t == nil {
+		return func() {}
+	}
+	start := time.Now()
+	return func() { t.Add(name, time.Since(start)) }
+}
+
+// Add counts d toward the named phase
+func (t *Timings) Add(name string, d time.Duration) {
+	for i := range t.Phases {
+		if t.Phases[i].Name == name {
+			t.Phases[i].Duration += d
+			return
+		}
+	}
+	t.Phases = append(t.Phases, Phase{name, d})
+}
+
+// Report renders the phases in the order they ran with their share of
+// total; time outside them is shown as "other"
+func (t *Timings) Report(total time.Duration) string {
+	phases := slices.Clone(t.Phases)
+	var tracked time.Duration
+	for _, p := range phases {
+		tracked += p.Duration
+	}
+	if other := total - tracked; other >= 100*time.Millisecond {
+		phases = append(phases, Phase{"other", other})
+	}
+	var b strings.Builder
+	b.WriteString("Timings:\n")
+	for _, p := range phases {
+		share := 0
+		if total > 0 {
+			share = int(p.Duration * 100 / total)
+		}
+		fmt.Fprintf(&b, "  %-14s %8s %4d%%\n", p.Name, roundPhase(p.Duration), share)
+	}
+	fmt.Fprintf(&b, "  %-14s %8s\n", "total", roundPhase(total))
+	return b.String()
+}
+
+// roundPhase keeps milliseconds for sub-second phases and tenths above
+func roundPhase(d time.Duration) time.Duration {
+	if d < time.Second {
+		return d.Round(time.Millisecond)
+	}
+	return d.Round(100 * time.Millisecond)
+}
@@ -0,0 +1,168 @@
+package lifecycle
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mauriciopiber/exceder/cli/slot-cli/pkg/dbclone"
+)
+
+// recordingProvisioner logs each step it is asked to do; main has ports
+// 3000 and postgres on 5432
+func recordingProvisioner(calls *[]string) Provisioner {
+	record := func(format string, args ...any) { *calls = append(*calls, fmt.Sprintf(format, args...)) }
+	return Provisioner{
+		CopyFiles:      func(Slot) { record("copy") },
+		ResolveSecrets: func(Slot) { record("secrets") },
+		MainPostgres: func(Slot) []dbclone.Target {
+			return []dbclone.Target{{DBService: dbclone.DBService{Engine: "postgres", PortVar: "POSTGRES_PORT", DB: "app"}, MainPort: 5432}}
+		},
+		AllocatePorts: func(_ Slot, offset int) map[int]int {
+			return map[int]int{3000: 3000 + offset, 5432: 5432 + offset}
+		},
+		RewritePorts: func(_ Slot, portMap map[int]int) { record("rewrite %v", slices.Sorted(maps.Keys(portMap))) },
+		RenameDB:     func(_ Slot, port int, oldDB, newDB string) { record("rename %s→%s on %d", oldDB, newDB, port) },
+		StartDocker:  func(_ Slot, withDB bool, _ ProvisionOptions) { record("docker db=%v", withDB) },
+		CopyDBFiles:  func(_ Slot, files []string) { record("sqlite %v", files) },
+		InstallDeps:  func(Slot) { record("deps") },
+	}
+}
+
+func TestProvision(t *testing.T) {
+	s := Slot{MainRepo: "/src/app", Project: "app", Name: "app-2", Path: "/src/app-2"}
+	tests := []struct {
+		name       string
+		steps      []string
+		shared     bool
+		portOffset int
+		dbFiles    []string
+		want       []string
+		wantPorts  map[int]int
+	}{
+		{"every step", Steps, false, 2, nil,
+			[]string{"copy", "secrets", "rewrite [3000 5432]", "docker db=true", "deps"},
+			map[int]int{3000: 3002, 5432: 5434}},
+		{"shared postgres keeps main's port", Steps, true, 2, []string{"data/app.db"},
+			[]string{"copy", "secrets", "rewrite [3000]", "rename app→app_slot2 on 5432", "docker db=true", "sqlite [data/app.db]", "deps"},
+			map[int]int{3000: 3002}},
+		{"already mapped: no port scan", []string{"docker"}, false, 0, []string{"data/app.db"},
+			[]string{"docker db=false"}, nil},
+		{"deps only", []string{"deps"}, false, 0, nil, []string{"deps"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls []string
+			p := recordingProvisioner(&calls)
+			p.DBFiles = tt.dbFiles
+			got := Provision(Env{Logf: func(string, ...any) {}}, p, s, tt.portOffset, ProvisionOptions{Steps: tt.steps, SharedPostgres: tt.shared})
+			if !slices.Equal(calls, tt.want) {
+				t.Errorf("calls = %q, want %q", calls, tt.want)
+			}
+			if !maps.Equal(got, tt.wantPorts) {
+				t.Errorf("Provision() = %v, want %v", got, tt.wantPorts)
+			}
+		})
+	}
+}
+
+func TestProvisionWithoutFreePortsSkipsDocker(t *testing.T) {
+	var calls []string
+	p := recordingProvisioner(&calls)
+	p.AllocatePorts = func(Slot, int) map[int]int { return nil }
+	Provision(Env{Logf: func(string, ...any) {}}, p, Slot{}, 2, ProvisionOptions{Steps: []string{"docker", "db"}})
+	if slices.ContainsFunc(calls, func(c string) bool { return strings.HasPrefix(c, "docker") }) {
+		t.Errorf("docker started without slot ports, it would collide with main's: %q", calls)
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name   string
+		detach bool
+		branch string
+	}{
+		{"branch", false, "slot-2"},
+		{"detached at a commit", true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := newSlot(t)
+			head, _ := exec.Command("git", "-C", base.MainRepo, "rev-parse", "HEAD").Output()
+			s := Slot{MainRepo: base.MainRepo, Project: "app", Name: "app-2", Path: filepath.Join(filepath.Dir(base.MainRepo), "app-2"), Branch: tt.branch}
+			src := Source{}
+			if tt.detach {
+				src = Source{Rev: strings.TrimSpace(string(head)), Detach: true}
+			}
+
+			var calls []string
+			env := recordingEnv(&calls)
+			env.Register = func(Slot) { calls = append(calls, "register") }
+			timings := &Timings{}
+			if _, err := New(env, recordingProvisioner(&calls), s, NewOptions{Source: src, Provision: ProvisionOptions{Steps: []string{"deps"}, Timings: timings}}); err != nil {
+				t.Fatalf("New() error: %v", err)
+			}
+			if want := []string{"deps", "register", "hook post-create"}; !slices.Equal(calls, want) {
+				t.Errorf("calls = %q, want %q", calls, want)
+			}
+			out, _ := exec.Command("git", "-C", s.Path, "branch", "--show-current").Output()
+			if got := strings.TrimSpace(string(out)); got != tt.branch {
+				t.Errorf("worktree on branch %q, want %q", got, tt.branch)
+			}
+			var phases []string
+			for _, p := range timings.Phases {
+				phases = append(phases, p.Name)
+			}
+			if want := []string{"worktree add", "deps install", "hooks"}; !slices.Equal(phases, want) {
+				t.Errorf("timed phases = %q, want %q", phases, want)
+			}
+		})
+	}
+}
+
+func TestNewFetchFailure(t *testing.T) {
+	base := newSlot(t)
+	s := Slot{MainRepo: base.MainRepo, Name: "app-feature", Path: filepath.Join(filepath.Dir(base.MainRepo), "app-feature"), Branch: "feature"}
+	var calls []string
+	_, err := New(recordingEnv(&calls), recordingProvisioner(&calls), s, NewOptions{Source: Source{RemoteRef: "origin/feature"}})
+	if !errors.Is(err, ErrFetch) || err.Error() != "could not fetch origin/feature" {
+		t.Fatalf("New() error = %v, want ErrFetch", err)
+	}
+	if len(calls) > 0 {
+		t.Errorf("slot provisioned after a failed fetch: %q", calls)
+	}
+	if _, err := os.Stat(s.Path); !os.IsNotExist(err) {
+		t.Errorf("worktree created after a failed fetch")
+	}
+}
+
+func TestTimingsReport(t *testing.T) {
+	var timings Timings
+	timings.Add("worktree add", 1500*time.Millisecond)
+	timings.Add("docker up", 3*time.Second)
+	timings.Add("db clone", 4*time.Second)
+	timings.Add("docker up", 1*time.Second)
+	timings.Add("hooks", 12345*time.Microsecond)
+
+	got := timings.Report(10 * time.Second)
+	want := "Timings:\n" +
+		"  worktree add       1.5s   15%\n" +
+		"  docker up            4s   40%\n" +
+		"  db clone             4s   40%\n" +
+		"  hooks              12ms    0%\n" +
+		"  other             488ms    4%\n" +
+		"  total               10s\n"
+	if got != want {
+		t.Errorf("Report =\n%s\nwant\n%s", got, want)
+	}
+
+	var untimed *Timings
+	untimed.Track("deps install")() // nil records nothing, without panicking
+}
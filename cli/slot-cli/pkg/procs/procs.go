@@ -0,0 +1,116 @@
+// Package procs lists and inspects running processes portably: /proc on
+// Linux, ps and lsof on macOS, PowerShell on Windows.
+package procs
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// ProcInfo is a running process and its full command line
+type ProcInfo struct {
+	PID     int
+	Cmdline string
+}
+
+// List returns all processes: from /proc on Linux, `ps` elsewhere
+func List() []ProcInfo {
+	if runtime.GOOS == "linux" {
+		entries, err := os.ReadDir("/proc")
+		if err == nil {
+			var procs []ProcInfo
+			for _, e := range entries {
+				pid, err := strconv.Atoi(e.Name())
+				if err != nil {
+					continue
+				}
+				data, err := os.ReadFile(filepath.Join("/proc", e.Name(), "cmdline"))
+				if err != nil || len(data) == 0 {
+					continue
+				}
+				procs = append(procs, ProcInfo{PID: pid, Cmdline: parseProcCmdline(data)})
+			}
+			return procs
+		}
+	}
+	if runtime.GOOS == "windows" {
+		// Same "<pid> <command line>" shape as ps
+		out, err := exec.Command("powershell", "-NoProfile", "-Command",
+			`Get-CimInstance Win32_Process | ForEach-Object { "$($_.ProcessId) $($_.CommandLine)" }`).Output()
+		if err != nil {
+			return nil
+		}
+		return parsePSOutput(strings.ReplaceAll(string(out), "\r", ""))
+	}
+	out, err := exec.Command("ps", "-axo", "pid=,command=").Output()
+	if err != nil {
+		return nil
+	}
+	return parsePSOutput(string(out))
+}
+
+// parseProcCmdline turns a NUL-separated /proc/<pid>/cmdline into a command line
+func parseProcCmdline(data []byte) string {
+	return strings.TrimSpace(strings.ReplaceAll(string(data), "\x00", " "))
+}
+
+// parsePSOutput parses `ps -axo pid=,command=` output
+func parsePSOutput(out string) []ProcInfo {
+	var procs []ProcInfo
+	for _, line := range strings.Split(out, "\n") {
+		pidStr, cmdline, ok := strings.Cut(strings.TrimSpace(line), " ")
+		if !ok {
+			continue
+		}
+		pid, err := strconv.Atoi(pidStr)
+		if err != nil {
+			continue
+		}
+		procs = append(procs, ProcInfo{PID: pid, Cmdline: strings.TrimSpace(cmdline)})
+	}
+	return procs
+}
+
+// Find returns processes whose command line matches pattern (like
+// pgrep -f), excluding this process
+func Find(pattern string) []ProcInfo {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil
+	}
+	var matches []ProcInfo
+	for _, p := range List() {
+		if p.PID != os.Getpid() && re.MatchString(p.Cmdline) {
+			matches = append(matches, p)
+		}
+	}
+	return matches
+}
+
+// CWD returns a process's working directory: /proc/<pid>/cwd on
+// Linux, lsof elsewhere (not available on Windows)
+func CWD(pid int) string {
+	switch runtime.GOOS {
+	case "linux":
+		cwd, _ := os.Readlink(fmt.Sprintf("/proc/%d/cwd", pid))
+		return cwd
+	case "windows":
+		return ""
+	}
+	out, err := exec.Command("lsof", "-a", "-p", strconv.Itoa(pid), "-d", "cwd", "-Fn").Output()
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.HasPrefix(line, "n") {
+			return line[1:]
+		}
+	}
+	return ""
+}
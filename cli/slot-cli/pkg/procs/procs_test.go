@@ -0,0 +1,47 @@
+package procs
+
+import (
+	"testing"
+)
+
+func TestParsePSOutput(t *testing.T) {
+	out := "    1 /sbin/launchd\n  812 node /Users/me/Projects/acme/exceder-1/node_modules/.bin/next dev -p 3010\n\nbogus line\n"
+	got := parsePSOutput(out)
+	if len(got) != 2 {
+		t.Fatalf("parsePSOutput() = %+v, want 2 processes", got)
+	}
+	if got[1].PID != 812 || got[1].Cmdline != "node /Users/me/Projects/acme/exceder-1/node_modules/.bin/next dev -p 3010" {
+		t.Errorf("got[1] = %+v", got[1])
+	}
+}
+
+func TestParseProcCmdline(t *testing.T) {
+	data := []byte("node\x00/home/me/exceder/node_modules/.bin/next\x00dev\x00")
+	if got, want := parseProcCmdline(data), "node /home/me/exceder/node_modules/.bin/next dev"; got != want {
+		t.Errorf("parseProcCmdline() = %q, want %q", got, want)
+	}
+}
+
+func TestScanProcess(t *testing.T) {
+	tests := []struct {
+		scanner string
+		cmdline string
+		want    Scanned
+	}{
+		{"storybook", "node /Users/me/Projects/acme/shop-2/node_modules/storybook/dist/bin/dispatcher.js dev -p 6008",
+			Scanned{PID: 1, Port: 6008, Project: "shop-2", CWD: "/Users/me/Projects/acme/shop-2"}},
+		{"web", "next-server (v14.2.3)", Scanned{PID: 1, Port: 3000, Project: "unknown"}},
+		{"web", "node /home/me/Projects/acme/shop/node_modules/.bin/next dev --port=3004",
+			Scanned{PID: 1, Port: 3004, Project: "shop", CWD: "/home/me/Projects/acme/shop"}},
+	}
+	for _, tt := range tests {
+		if got := BuiltinScanners[tt.scanner].Scan(1, tt.cmdline); got != tt.want {
+			t.Errorf("%s.Scan(%q) = %+v, want %+v", tt.scanner, tt.cmdline, got, tt.want)
+		}
+	}
+
+	puma := Scanner{Process: `puma .*tcp://`, PortFlag: `tcp://[^:]+:(\d+)`}
+	if got := puma.Scan(7, "puma 6.4.0 (tcp://0.0.0.0:3101) [api]"); got.Port != 3101 {
+		t.Errorf("puma port = %d, want 3101", got.Port)
+	}
+}
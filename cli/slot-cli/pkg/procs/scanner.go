@@ -0,0 +1,101 @@
+package procs
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// userPathRe matches an absolute path under a home directory in a command line
+var userPathRe = regexp.MustCompile(`(?:/Users|/home)/[^\s]+`)
+
+// Scanner finds one kind of dev process for `slot-cli clean <name>`:
+// processes on a port some project or slot has in PortEnv are attached, the
+// rest are orphans (without PortEnv, processes running inside a project or
+// slot directory are attached)
+type Scanner struct {
+	Label       string   `json:"label,omitempty"`        // what the processes are called in output, e.g. "puma servers"
+	Process     string   `json:"process"`                // regexp matched against full command lines
+	PortFlag    string   `json:"port_flag,omitempty"`    // regexp capturing the port in the command line, e.g. "-p (\\d+)"
+	DefaultPort int      `json:"default_port,omitempty"` // port when the command line has none
+	PortEnv     string   `json:"port_env,omitempty"`     // env var holding the port in projects and slots
+	Protect     []string `json:"protect,omitempty"`      // never killed: processes whose project or cwd contains one of these
+}
+
+// BuiltinScanners can be overridden or extended via "scanners" in config.json
+var BuiltinScanners = map[string]Scanner{
+	"storybook": {
+		Label:       "storybooks",
+		Process:     `storybook/dist/bin/dispatcher\.js`,
+		PortFlag:    `(?:^|\s)-p\s+(\d+)`,
+		DefaultPort: 6006,
+		PortEnv:     "STORYBOOK_PORT",
+	},
+	"web": {
+		Label:       "web servers",
+		Process:     `next-server|next dev`,
+		PortFlag:    `(?:^|\s)(?:-p|--port)[\s=]+(\d+)`,
+		DefaultPort: 3000,
+		PortEnv:     "PORT",
+		Protect:     []string{"exceder"}, // the dashboard
+	},
+}
+
+// Scanned is a process found by a Scanner
+type Scanned struct {
+	PID     int
+	Port    int
+	Project string
+	CWD     string
+}
+
+// Scan reads a matched command line: its port (from PortFlag, else
+// DefaultPort), project (/Projects/<owner>/<project>) and working directory
+// (0 port and empty cwd when the command line doesn't say)
+func (s Scanner) Scan(pid int, cmdline string) Scanned {
+	p := Scanned{PID: pid, Port: s.DefaultPort, Project: "unknown"}
+	if s.PortFlag != "" {
+		if re, err := regexp.Compile(s.PortFlag); err == nil {
+			if m := re.FindStringSubmatch(cmdline); len(m) > 1 {
+				if port, err := strconv.Atoi(m[1]); err == nil {
+					p.Port = port
+				}
+			}
+		}
+	}
+	if m := regexp.MustCompile(`/Projects/[^/]+/([^/\s]+)`).FindStringSubmatch(cmdline); m != nil {
+		p.Project = m[1]
+	}
+	if m := userPathRe.FindString(cmdline); m != "" {
+		p.CWD, _, _ = strings.Cut(m, "/node_modules")
+	}
+	return p
+}
+
+// Find lists the running processes the scanner matches
+func (s Scanner) Find() []Scanned {
+	var processes []Scanned
+	seen := make(map[int]bool)
+	for _, proc := range Find(s.Process) {
+		if seen[proc.PID] {
+			continue
+		}
+		seen[proc.PID] = true
+		p := s.Scan(proc.PID, proc.Cmdline)
+		if p.CWD == "" {
+			p.CWD = CWD(proc.PID)
+		}
+		processes = append(processes, p)
+	}
+	return processes
+}
+
+// Protected reports whether clean must leave the process alone
+func (s Scanner) Protected(p Scanned) bool {
+	for _, name := range s.Protect {
+		if p.Project == name || (p.CWD != "" && strings.Contains(p.CWD, name)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,406 @@
+// Package registry reads and writes the slot registry
+// (~/.config/slots/registry.json): registered projects, groups and slots.
+package registry
+
+import (
+	"encoding/json"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"time"
+)
+
+// Registry is the contents of registry.json: registered projects, their
+// groups and every slot created from them
+type Registry struct {
+	Groups   map[string]GroupConfig   `json:"groups,omitempty"`
+	Projects map[string]ProjectConfig `json:"projects"`
+	Slots    map[string]SlotConfig    `json:"slots"`
+}
+
+// GroupConfig is a named, ordered group of projects
+type GroupConfig struct {
+	Name  string `json:"name"`
+	Order int    `json:"order"`
+}
+
+// ProjectConfig is a registered main repository and its slot settings
+type ProjectConfig struct {
+	BasePort  int    `json:"base_port"`
+	Path      string `json:"path"`
+	Group     string `json:"group,omitempty"`
+	CopyRedis bool   `json:"copy_redis,omitempty"` // copy main's redis data into new slots
+
+	// SQLite/LiteFS database files (relative to the project root) copied into slots
+	SQLiteFiles []string `json:"sqlite_files,omitempty"`
+
+	// Anonymization applied to every cloned SQL database: a script (relative
+	// to the project root) and/or column masks, "table.column" -> SQL expression
+	AnonymizeScript string            `json:"anonymize_script,omitempty"`
+	Masks           map[string]string `json:"masks,omitempty"`
+
+	// Migrations run after a DB clone: "" auto-detects the tool, "off"
+	// disables, anything else is run as a shell command in the slot
+	Migrate string `json:"migrate,omitempty"`
+
+	// Parallel jobs for postgres dump/restore (0 = CPU count, max 4)
+	DumpJobs int `json:"dump_jobs,omitempty"`
+
+	Tmux bool `json:"tmux,omitempty"` // create a tmux session for every new slot
+
+	// Tmux layout file (JSON windows and panes, relative to the project root)
+	// that start, attach and new --tmux build the slot's session from
+	TmuxLayout string `json:"tmux_layout,omitempty"`
+
+	Agent string `json:"agent,omitempty"` // agent started in slots (default: claude)
+
+	// How the agent is launched in this project's slots (over the user's
+	// agent_options in config.json)
+	AgentOptions AgentOptions `json:"agent_options,omitzero"`
+
+	// How slots get node_modules: "install" (default), "offline" (pnpm store
+	// only), "clone" (copy-on-write copy of main's), "hardlink" (shares files
+	// with main's; edits inside node_modules show up in both)
+	Provision string `json:"provision,omitempty"`
+
+	// Dependency install: "" detects managers from lockfiles,
+	// a manager name forces it for its ecosystem, "off" skips, anything else
+	// is a shell command run once in the slot root
+	Install string `json:"install,omitempty"`
+
+	// PR body template (relative to the project root) used by `slot-cli pr`
+	// when no --body-file is given
+	PRTemplate string `json:"pr_template,omitempty"`
+
+	// Refuse `slot-cli done` while the slot's PR has failing checks
+	RequireChecks bool `json:"require_checks,omitempty"`
+
+	// Branch template for `slot-cli new --issue`: {number} and {slug} (from
+	// the issue title) are filled in
+	IssueBranch string `json:"issue_branch,omitempty"`
+
+	// Merge commit message template for `slot-cli done` ({slot}, {branch},
+	// {main}, {issue}, {issue_url}, {subject}, {changelog})
+	MergeMessage string `json:"merge_message,omitempty"`
+
+	// Most slots `slot-cli new` creates for the project (0 = no limit)
+	MaxSlots int `json:"max_slots,omitempty"`
+
+	// URLs `slot-cli health` checks: paths are relative to
+	// http://localhost:{PORT}, {VAR} is the slot's VAR port
+	HealthURLs []string `json:"health_urls,omitempty"`
+
+	// New slots get databases on main's postgres (app_slot3) instead of
+	// their own container (new --shared-postgres for one slot)
+	SharedPostgres bool `json:"shared_postgres,omitempty"`
+
+	// Generate .devcontainer/slot for every new slot (new --devcontainer)
+	Devcontainer bool `json:"devcontainer,omitempty"`
+}
+
+// AgentOptions adjust an agent's launch command: set per user in config.json
+// and per project in the registry (project values win)
+type AgentOptions struct {
+	Binary      string            `json:"binary,omitempty"`      // replaces the command's program, e.g. a wrapper script
+	Flags       string            `json:"flags,omitempty"`       // appended to every launch
+	Env         map[string]string `json:"env,omitempty"`         // extra environment for the agent
+	Permissions string            `json:"permissions,omitempty"` // permission mode (default: the agent's own prompts)
+}
+
+// Over layers o on top of base: o's non-empty fields win, env is merged
+func (o AgentOptions) Over(base AgentOptions) AgentOptions {
+	merged := AgentOptions{
+		Binary:      base.Binary,
+		Flags:       base.Flags,
+		Permissions: base.Permissions,
+	}
+	if o.Binary != "" {
+		merged.Binary = o.Binary
+	}
+	if o.Flags != "" {
+		merged.Flags = o.Flags
+	}
+	if o.Permissions != "" {
+		merged.Permissions = o.Permissions
+	}
+	if len(base.Env)+len(o.Env) > 0 {
+		merged.Env = make(map[string]string)
+		maps.Copy(merged.Env, base.Env)
+		maps.Copy(merged.Env, o.Env)
+	}
+	return merged
+}
+
+// SlotConfig is one slot (worktree) of a project
+type SlotConfig struct {
+	Project   string `json:"project"`
+	Number    int    `json:"number"` // 0 for named slots
+	Name      string `json:"name"`   // empty for numbered slots
+	Branch    string `json:"branch"`
+	CreatedAt string `json:"created_at"`
+	Locked    bool   `json:"locked,omitempty"`
+	LockNote  string `json:"lock_note,omitempty"`
+
+	// What the slot is for, set with `slot-cli describe`
+	Description string `json:"description,omitempty"`
+	Ticket      string `json:"ticket,omitempty"`
+	Assignee    string `json:"assignee,omitempty"`
+
+	// Free-form tags (`slot-cli label add`) that list/clean/exec filter on
+	Labels []string `json:"labels,omitempty"`
+
+	// Lock expiry (RFC3339, empty = until unlocked) and scope (LockScope*)
+	LockedUntil string `json:"locked_until,omitempty"`
+	LockScope   string `json:"lock_scope,omitempty"`
+
+	// Docker compose subset started for this slot (empty = full stack)
+	Profiles []string `json:"profiles,omitempty"`
+	Services []string `json:"services,omitempty"`
+
+	// Claude session last started/continued in this slot
+	SessionID   string `json:"session_id,omitempty"`
+	SessionSlug string `json:"session_slug,omitempty"`
+
+	// Setup steps deferred by new --no-* until `slot-cli provision`
+	Pending    []string `json:"pending,omitempty"`
+	PortOffset int      `json:"port_offset,omitempty"`
+
+	// Pull request opened from this slot by `slot-cli pr`
+	PRURL    string `json:"pr_url,omitempty"`
+	PRNumber int    `json:"pr_number,omitempty"`
+
+	// Issue the slot was created for with `slot-cli new --issue`
+	IssueURL    string `json:"issue_url,omitempty"`
+	IssueNumber int    `json:"issue_number,omitempty"`
+
+	// Group whose projects got matching slots with `slot-cli new --stack`
+	Stack string `json:"stack,omitempty"`
+
+	// Other slots this slot's URLs were pointed at with `slot-cli link`
+	Links []SlotLink `json:"links,omitempty"`
+
+	// Databases live on main's postgres (<db>_slot<N>), not a slot container
+	SharedPostgres bool `json:"shared_postgres,omitempty"`
+
+	// Remote slots (new --host) live on another machine: the ssh host and
+	// the slot's path there, which slot-cli on the host manages
+	Host       string `json:"host,omitempty"`
+	RemotePath string `json:"remote_path,omitempty"`
+
+	// Public tunnel to the slot's web port started by `slot-cli share`
+	TunnelPID int    `json:"tunnel_pid,omitempty"`
+	TunnelURL string `json:"tunnel_url,omitempty"`
+
+	// RFC3339 time after which clean treats the slot as abandoned (new --ttl)
+	ExpiresAt string `json:"expires_at,omitempty"`
+
+	// Last activity seen by commands (RFC3339): newest commit, agent started
+	// or seen running, dev server started
+	CommitAt string `json:"commit_at,omitempty"`
+	AgentAt  string `json:"agent_at,omitempty"`
+	DevAt    string `json:"dev_at,omitempty"`
+}
+
+// SlotLink is a consumer slot's URLs pointed at a provider slot: Ports maps
+// the port each URL used before (restored by unlink) to the provider's port
+type SlotLink struct {
+	Slot  string      `json:"slot"`
+	Ports map[int]int `json:"ports,omitempty"`
+}
+
+// LastActive is the latest of the slot's creation and recorded activity
+func (s SlotConfig) LastActive() time.Time {
+	var last time.Time
+	for _, ts := range []string{s.CreatedAt, s.CommitAt, s.AgentAt, s.DevAt} {
+		if t, err := time.Parse(time.RFC3339, ts); err == nil && t.After(last) {
+			last = t
+		}
+	}
+	return last
+}
+
+// Lock scopes: the default only protects the slot from removal and
+// overwrites; no-touch also blocks commands that edit it
+const (
+	LockScopeNoDelete = "no-delete"
+	LockScopeNoTouch  = "no-touch"
+)
+
+// LockActive reports whether the slot is locked at now (a lock past its
+// locked_until no longer counts)
+func (s SlotConfig) LockActive(now time.Time) bool {
+	if !s.Locked {
+		return false
+	}
+	until, err := time.Parse(time.RFC3339, s.LockedUntil)
+	return err != nil || now.Before(until)
+}
+
+// LockBlocks reports whether the lock forbids a command at now: any active
+// lock blocks removal (edit false), only no-touch ones block edits
+func (s SlotConfig) LockBlocks(edit bool, now time.Time) bool {
+	return s.LockActive(now) && (!edit || s.LockScope == LockScopeNoTouch)
+}
+
+// Expired reports whether the slot's TTL ran out by now (false without one)
+func (s SlotConfig) Expired(now time.Time) bool {
+	expires, err := time.Parse(time.RFC3339, s.ExpiresAt)
+	return err == nil && now.After(expires)
+}
+
+// DefaultPath is ~/.config/slots/registry.json
+func DefaultPath() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".config", "slots", "registry.json")
+}
+
+// New returns an empty registry with all maps allocated
+func New() *Registry {
+	return &Registry{
+		Groups:   make(map[string]GroupConfig),
+		Projects: make(map[string]ProjectConfig),
+		Slots:    make(map[string]SlotConfig),
+	}
+}
+
+// Load reads the registry at path. A missing file is an empty registry; an
+// unparsable one returns an empty registry and the error.
+func Load(path string) (*Registry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return New(), nil
+		}
+		return New(), err
+	}
+
+	var reg Registry
+	if err := json.Unmarshal(data, &reg); err != nil {
+		return New(), err
+	}
+
+	if reg.Groups == nil {
+		reg.Groups = make(map[string]GroupConfig)
+	}
+	if reg.Projects == nil {
+		reg.Projects = make(map[string]ProjectConfig)
+	}
+	if reg.Slots == nil {
+		reg.Slots = make(map[string]SlotConfig)
+	}
+
+	return &reg, nil
+}
+
+// Save writes the registry to path, creating its directory
+func Save(path string, reg *Registry) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(reg, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// SlotPath is where a slot of a registered project lives: next to its main repo
+func (r *Registry) SlotPath(slotName string) string {
+	slot, ok := r.Slots[slotName]
+	if !ok {
+		return ""
+	}
+	project, ok := r.Projects[slot.Project]
+	if !ok {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(project.Path), slotName)
+}
+
+// Changes lists the notable differences between two registries as
+// (name, description) pairs: projects/slots added or removed, lock changes
+func Changes(old, new *Registry) [][2]string {
+	var changes [][2]string
+	for name := range new.Projects {
+		if _, ok := old.Projects[name]; !ok {
+			changes = append(changes, [2]string{name, "project registered"})
+		}
+	}
+	for name := range old.Projects {
+		if _, ok := new.Projects[name]; !ok {
+			changes = append(changes, [2]string{name, "project removed"})
+		}
+	}
+	for name, slot := range new.Slots {
+		prev, ok := old.Slots[name]
+		switch {
+		case !ok:
+			changes = append(changes, [2]string{name, "slot added (branch " + slot.Branch + ")"})
+		case slot.Locked && !prev.Locked:
+			changes = append(changes, [2]string{name, "slot locked"})
+		case !slot.Locked && prev.Locked:
+			changes = append(changes, [2]string{name, "slot unlocked"})
+		}
+	}
+	for name, slot := range old.Slots {
+		if _, ok := new.Slots[name]; !ok {
+			changes = append(changes, [2]string{name, "slot removed (branch " + slot.Branch + ")"})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i][0] != changes[j][0] {
+			return changes[i][0] < changes[j][0]
+		}
+		return changes[i][1] < changes[j][1]
+	})
+	return changes
+}
+
+// Conflict is a group, project or slot two registries define differently
+type Conflict struct {
+	Kind string // "group", "project" or "slot"
+	Name string
+}
+
+// Merge adds other's groups, projects and slots to r. Entries only in other
+// are added; for conflicts, theirs decides whether other's version replaces
+// r's. Returns the names added and the conflicts with how they were resolved.
+func (r *Registry) Merge(other *Registry, theirs func(Conflict) bool) (added []string, replaced, kept []Conflict) {
+	resolve := func(kind, name string, exists, differs bool) bool {
+		switch {
+		case !exists:
+			added = append(added, name)
+			return true
+		case !differs:
+			return false
+		case theirs(Conflict{kind, name}):
+			replaced = append(replaced, Conflict{kind, name})
+			return true
+		}
+		kept = append(kept, Conflict{kind, name})
+		return false
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(other.Groups)) {
+		mine, ok := r.Groups[name]
+		if resolve("group", name, ok, mine != other.Groups[name]) {
+			r.Groups[name] = other.Groups[name]
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(other.Projects)) {
+		mine, ok := r.Projects[name]
+		if resolve("project", name, ok, !reflect.DeepEqual(mine, other.Projects[name])) {
+			r.Projects[name] = other.Projects[name]
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(other.Slots)) {
+		mine, ok := r.Slots[name]
+		if resolve("slot", name, ok, !reflect.DeepEqual(mine, other.Slots[name])) {
+			r.Slots[name] = other.Slots[name]
+		}
+	}
+	return added, replaced, kept
+}
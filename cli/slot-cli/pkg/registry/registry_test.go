@@ -0,0 +1,177 @@
+package registry
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRegistryChanges(t *testing.T) {
+	old := &Registry{
+		Projects: map[string]ProjectConfig{"app": {}},
+		Slots: map[string]SlotConfig{
+			"app-1": {Branch: "slot/app-1"},
+			"app-2": {Branch: "slot/app-2", Locked: true},
+		},
+	}
+	new := &Registry{
+		Projects: map[string]ProjectConfig{"app": {}, "api": {}},
+		Slots: map[string]SlotConfig{
+			"app-2": {Branch: "slot/app-2", SessionID: "abc"},
+			"app-3": {Branch: "slot/app-3"},
+		},
+	}
+
+	got := Changes(old, new)
+	want := [][2]string{
+		{"api", "project registered"},
+		{"app-1", "slot removed (branch slot/app-1)"},
+		{"app-2", "slot unlocked"},
+		{"app-3", "slot added (branch slot/app-3)"},
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Changes() = %v, want %v", got, want)
+	}
+	if changes := Changes(new, new); len(changes) != 0 {
+		t.Errorf("Changes(same) = %v, want none", changes)
+	}
+}
+
+func TestLoadSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "slots", "registry.json")
+
+	reg, err := Load(path)
+	if err != nil || reg.Slots == nil || reg.Projects == nil || reg.Groups == nil {
+		t.Fatalf("Load(missing) = %+v, %v; want an empty registry", reg, err)
+	}
+
+	reg.Projects["app"] = ProjectConfig{Path: "/src/app"}
+	reg.Slots["app-1"] = SlotConfig{Project: "app", Number: 1, Branch: "slot-1"}
+	if err := Save(path, reg); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	loaded, err := Load(path)
+	if err != nil || loaded.Slots["app-1"].Branch != "slot-1" {
+		t.Errorf("Load after Save = %+v, %v", loaded, err)
+	}
+	if got := loaded.SlotPath("app-1"); got != filepath.Join("/src", "app-1") {
+		t.Errorf("SlotPath(app-1) = %q", got)
+	}
+
+	os.WriteFile(path, []byte("{not json"), 0644)
+	if reg, err := Load(path); err == nil || reg.Slots == nil {
+		t.Errorf("Load(corrupt) = %+v, %v; want an empty registry and an error", reg, err)
+	}
+}
+
+func TestSlotExpired(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		expiresAt string
+		want      bool
+	}{
+		{"", false},
+		{"2026-03-10T11:00:00Z", true},
+		{"2026-03-17T12:00:00Z", false},
+		{"not a time", false},
+	}
+	for _, tt := range tests {
+		if got := (SlotConfig{ExpiresAt: tt.expiresAt}).Expired(now); got != tt.want {
+			t.Errorf("Expired(%q) = %v, want %v", tt.expiresAt, got, tt.want)
+		}
+	}
+}
+
+func TestSlotLockBlocks(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		slot          SlotConfig
+		removal, edit bool
+	}{
+		{SlotConfig{}, false, false},
+		{SlotConfig{Locked: true}, true, false},
+		{SlotConfig{Locked: true, LockScope: LockScopeNoDelete}, true, false},
+		{SlotConfig{Locked: true, LockScope: LockScopeNoTouch}, true, true},
+		{SlotConfig{Locked: true, LockedUntil: "2026-03-11T12:00:00Z"}, true, false},
+		{SlotConfig{Locked: true, LockScope: LockScopeNoTouch, LockedUntil: "2026-03-10T11:00:00Z"}, false, false},
+	}
+	for _, tt := range tests {
+		if got := tt.slot.LockBlocks(false, now); got != tt.removal {
+			t.Errorf("%+v: LockBlocks(removal) = %v, want %v", tt.slot, got, tt.removal)
+		}
+		if got := tt.slot.LockBlocks(true, now); got != tt.edit {
+			t.Errorf("%+v: LockBlocks(edit) = %v, want %v", tt.slot, got, tt.edit)
+		}
+	}
+}
+
+func TestSlotLastActive(t *testing.T) {
+	slot := SlotConfig{
+		CreatedAt: "2026-03-01T10:00:00Z",
+		CommitAt:  "2026-03-05T10:00:00Z",
+		AgentAt:   "2026-03-04T10:00:00Z",
+		DevAt:     "garbage",
+	}
+	if got, want := slot.LastActive(), time.Date(2026, 3, 5, 10, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("LastActive = %v, want %v", got, want)
+	}
+	if got := (SlotConfig{}).LastActive(); !got.IsZero() {
+		t.Errorf("LastActive of an empty slot = %v, want zero", got)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	reg := &Registry{
+		Groups:   map[string]GroupConfig{"work": {Name: "Work"}},
+		Projects: map[string]ProjectConfig{"app": {Path: "/a/app", BasePort: 3000}},
+		Slots: map[string]SlotConfig{
+			"app-1": {Project: "app", Branch: "slot-1"},
+			"app-2": {Project: "app", Branch: "slot-2"},
+		},
+	}
+	other := &Registry{
+		Groups:   map[string]GroupConfig{"work": {Name: "Work"}, "oss": {Name: "OSS"}},
+		Projects: map[string]ProjectConfig{"app": {Path: "/b/app", BasePort: 3000}, "api": {Path: "/b/api"}},
+		Slots: map[string]SlotConfig{
+			"app-1": {Project: "app", Branch: "slot-1"},
+			"app-2": {Project: "app", Branch: "fix-login"},
+		},
+	}
+
+	var asked []Conflict
+	added, replaced, kept := reg.Merge(other, func(c Conflict) bool {
+		asked = append(asked, c)
+		return c.Kind == "slot"
+	})
+
+	if fmt.Sprint(added) != "[oss api]" {
+		t.Errorf("added = %v", added)
+	}
+	if fmt.Sprint(asked) != "[{project app} {slot app-2}]" {
+		t.Errorf("asked about %v", asked)
+	}
+	if fmt.Sprint(replaced) != "[{slot app-2}]" || fmt.Sprint(kept) != "[{project app}]" {
+		t.Errorf("replaced = %v, kept = %v", replaced, kept)
+	}
+	if reg.Projects["app"].Path != "/a/app" || reg.Slots["app-2"].Branch != "fix-login" || reg.Groups["oss"].Name != "OSS" {
+		t.Errorf("merged registry = %+v", reg)
+	}
+}
+
+func TestAgentOptionsOver(t *testing.T) {
+	user := AgentOptions{Binary: "claude-wrapper", Permissions: "skip", Env: map[string]string{"A": "1", "B": "1"}}
+	project := AgentOptions{Permissions: "plan", Env: map[string]string{"B": "2"}}
+
+	got := project.Over(user)
+	if got.Binary != "claude-wrapper" || got.Permissions != "plan" || got.Env["A"] != "1" || got.Env["B"] != "2" {
+		t.Errorf("Over = %+v", got)
+	}
+	if user.Env["B"] != "1" {
+		t.Error("Over modified the base env")
+	}
+	if empty := (AgentOptions{}).Over(AgentOptions{}); empty.Env != nil {
+		t.Errorf("Over of empty options = %+v", empty)
+	}
+}
@@ -0,0 +1,56 @@
+// Package remote drives slot-cli on other machines over ssh, for slots that
+// live on a dev box but are tracked in the local registry.
+package remote
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/mauriciopiber/exceder/cli/slot-cli/pkg/registry"
+)
+
+// Shell is the shell command that runs slot-cli with args in dir on a
+// remote host (a leading ~/ stays unquoted so the remote shell expands it)
+func Shell(dir string, args ...string) string {
+	cd := quote(dir)
+	if rest, ok := strings.CutPrefix(dir, "~/"); ok {
+		cd = "~/" + quote(rest)
+	}
+	words := []string{"slot-cli"}
+	for _, arg := range args {
+		words = append(words, quote(arg))
+	}
+	return "cd " + cd + " && " + strings.Join(words, " ")
+}
+
+// Run runs slot-cli on host in dir over ssh, attached to the terminal
+func Run(host, dir string, args ...string) error {
+	sshArgs := []string{host, Shell(dir, args...)}
+	if fi, err := os.Stdin.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+		sshArgs = append([]string{"-t"}, sshArgs...)
+	}
+	cmd := exec.Command("ssh", sshArgs...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return cmd.Run()
+}
+
+// Registry reads the registry of slot-cli on host
+func Registry(host string) (*registry.Registry, error) {
+	out, err := exec.Command("ssh", host, "slot-cli registry export").Output()
+	if err != nil {
+		return nil, fmt.Errorf("ssh %s slot-cli registry export: %v", host, err)
+	}
+	var reg registry.Registry
+	if err := json.Unmarshal(out, &reg); err != nil {
+		return nil, fmt.Errorf("%s: unreadable registry: %v", host, err)
+	}
+	return &reg, nil
+}
+
+// quote quotes s as one sh word
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
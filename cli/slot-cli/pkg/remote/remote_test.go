@@ -0,0 +1,20 @@
+package remote
+
+import "testing"
+
+func TestShell(t *testing.T) {
+	tests := []struct {
+		dir  string
+		args []string
+		want string
+	}{
+		{"~/code/app", []string{"new", "3"}, `cd ~/'code/app' && slot-cli 'new' '3'`},
+		{"/srv/my app", []string{"info", "app-3", "--json"}, `cd '/srv/my app' && slot-cli 'info' 'app-3' '--json'`},
+		{"~/x", []string{"new", "it's"}, `cd ~/'x' && slot-cli 'new' 'it'\''s'`},
+	}
+	for _, tt := range tests {
+		if got := Shell(tt.dir, tt.args...); got != tt.want {
+			t.Errorf("Shell(%q, %q) = %s, want %s", tt.dir, tt.args, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+// Package secrets resolves secret references in env files (op://, doppler://,
+// vault://) through the provider's CLI, so slots get the values without main
+// keeping plaintext secrets to copy around.
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Provider resolves references with one scheme through a CLI tool
+type Provider struct {
+	Name   string
+	Scheme string // reference prefix without "://"
+	Tool   string // CLI binary
+	// Args returns the Tool arguments that print the secret for ref
+	Args func(ref string) ([]string, error)
+}
+
+// Providers are the supported secret managers:
+//
+//	op://vault/item/field              1Password (op read)
+//	doppler://project/config/NAME      Doppler (doppler secrets get)
+//	vault://secret/path#field          HashiCorp Vault (vault kv get)
+var Providers = []Provider{
+	{Name: "1Password", Scheme: "op", Tool: "op", Args: func(ref string) ([]string, error) {
+		return []string{"read", "--no-newline", ref}, nil
+	}},
+	{Name: "Doppler", Scheme: "doppler", Tool: "doppler", Args: func(ref string) ([]string, error) {
+		parts := strings.Split(strings.TrimPrefix(ref, "doppler://"), "/")
+		if len(parts) != 3 || slices.Contains(parts, "") {
+			return nil, fmt.Errorf("%s: want doppler://project/config/NAME", ref)
+		}
+		return []string{"secrets", "get", parts[2], "--plain", "--project", parts[0], "--config", parts[1]}, nil
+	}},
+	{Name: "Vault", Scheme: "vault", Tool: "vault", Args: func(ref string) ([]string, error) {
+		path, field, ok := strings.Cut(strings.TrimPrefix(ref, "vault://"), "#")
+		if !ok || path == "" || field == "" {
+			return nil, fmt.Errorf("%s: want vault://path#field", ref)
+		}
+		return []string{"kv", "get", "-field=" + field, path}, nil
+	}},
+}
+
+// Fetch runs a provider command and returns what it printed. Tests replace it.
+var Fetch = func(tool string, args ...string) (string, error) {
+	out, err := exec.Command(tool, args...).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return "", fmt.Errorf("%s: %s", tool, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("%s: %w", tool, err)
+	}
+	return strings.TrimRight(string(out), "\r\n"), nil
+}
+
+// refLineRe matches an env line whose whole value is a secret reference
+var refLineRe = regexp.MustCompile(`^(\s*(?:export\s+)?[A-Za-z_][A-Za-z0-9_.]*\s*=\s*)(["']?)([a-z]+://[^"'\s]+)(["']?)\s*$`)
+
+// Ref returns the provider and reference of an env line like KEY=op://a/b/c
+func Ref(line string) (Provider, string, bool) {
+	m := refLineRe.FindStringSubmatch(line)
+	if m == nil || m[2] != m[4] {
+		return Provider{}, "", false
+	}
+	scheme, _, _ := strings.Cut(m[3], "://")
+	for _, p := range Providers {
+		if p.Scheme == scheme {
+			return p, m[3], true
+		}
+	}
+	return Provider{}, "", false
+}
+
+// Count returns how many lines of env content hold secret references
+func Count(content string) int {
+	n := 0
+	for _, line := range strings.Split(content, "\n") {
+		if _, _, ok := Ref(line); ok {
+			n++
+		}
+	}
+	return n
+}
+
+// Resolve replaces every secret reference in env content with its value.
+// Lines that fail keep their reference; the errors are joined in err.
+func Resolve(content string) (resolved string, n int, err error) {
+	lines := strings.Split(content, "\n")
+	var errs []error
+	for i, line := range lines {
+		p, ref, ok := Ref(line)
+		if !ok {
+			continue
+		}
+		args, aerr := p.Args(ref)
+		if aerr != nil {
+			errs = append(errs, aerr)
+			continue
+		}
+		value, ferr := Fetch(p.Tool, args...)
+		if ferr != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", ref, ferr))
+			continue
+		}
+		m := refLineRe.FindStringSubmatch(line)
+		lines[i] = m[1] + quote(value, m[2])
+		n++
+	}
+	return strings.Join(lines, "\n"), n, errors.Join(errs...)
+}
+
+// quote renders value in the reference's quoting, adding double quotes when
+// an unquoted value would not survive env parsing
+func quote(value, q string) string {
+	switch {
+	case q == "'" && !strings.Contains(value, "'"):
+		return "'" + value + "'"
+	case q == "" && !strings.ContainsAny(value, " \t\n#\"'\\$"):
+		return value
+	}
+	return strconv.Quote(value)
+}
@@ -0,0 +1,92 @@
+package secrets
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRef(t *testing.T) {
+	tests := []struct {
+		line, scheme, ref string
+	}{
+		{"DB_PASS=op://dev/db/password", "op", "op://dev/db/password"},
+		{`API_KEY="doppler://app/dev/API_KEY"`, "doppler", "doppler://app/dev/API_KEY"},
+		{"export TOKEN='vault://secret/app#token'", "vault", "vault://secret/app#token"},
+		{"URL=https://example.com", "", ""},
+		{"# DB_PASS=op://dev/db/password", "", ""},
+		{`MIXED="op://dev/db/password'`, "", ""},
+		{"DB_PASS=prefix-op://dev/db/password", "", ""},
+	}
+	for _, tt := range tests {
+		p, ref, ok := Ref(tt.line)
+		if ok != (tt.scheme != "") || p.Scheme != tt.scheme || ref != tt.ref {
+			t.Errorf("Ref(%q) = %q, %q, %v; want %q, %q", tt.line, p.Scheme, ref, ok, tt.scheme, tt.ref)
+		}
+	}
+}
+
+func TestProviderArgs(t *testing.T) {
+	tests := []struct {
+		ref     string
+		want    []string
+		wantErr bool
+	}{
+		{"op://dev/db/password", []string{"read", "--no-newline", "op://dev/db/password"}, false},
+		{"doppler://app/dev/API_KEY", []string{"secrets", "get", "API_KEY", "--plain", "--project", "app", "--config", "dev"}, false},
+		{"doppler://app/API_KEY", nil, true},
+		{"vault://secret/app#token", []string{"kv", "get", "-field=token", "secret/app"}, false},
+		{"vault://secret/app", nil, true},
+	}
+	for _, tt := range tests {
+		p, _, _ := Ref("X=" + tt.ref)
+		got, err := p.Args(tt.ref)
+		if (err != nil) != tt.wantErr || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s args = %v, %v; want %v", tt.ref, got, err, tt.want)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	orig := Fetch
+	defer func() { Fetch = orig }()
+	Fetch = func(tool string, args ...string) (string, error) {
+		switch args[len(args)-1] {
+		case "op://dev/db/password":
+			return "s3cret", nil
+		case "dev":
+			return "has space", nil
+		}
+		return "", errors.New("not found")
+	}
+
+	content := "PORT=3000\nDB_PASS=op://dev/db/password\nAPI_KEY=doppler://app/dev/API_KEY\nTOKEN=vault://secret/app#token\n"
+	got, n, err := Resolve(content)
+	want := "PORT=3000\nDB_PASS=s3cret\nAPI_KEY=\"has space\"\nTOKEN=vault://secret/app#token\n"
+	if got != want || n != 2 {
+		t.Errorf("Resolve = %q, %d; want %q, 2", got, n, want)
+	}
+	if err == nil || !strings.Contains(err.Error(), "vault://secret/app#token") {
+		t.Errorf("Resolve err = %v, want the failed vault reference", err)
+	}
+	if c := Count(content); c != 3 {
+		t.Errorf("Count = %d, want 3", c)
+	}
+}
+
+func TestQuote(t *testing.T) {
+	tests := []struct{ value, q, want string }{
+		{"plain", "", "plain"},
+		{"plain", `"`, `"plain"`},
+		{"plain", "'", "'plain'"},
+		{"a b", "", `"a b"`},
+		{"it's", "'", `"it's"`},
+		{"x#y", "", `"x#y"`},
+	}
+	for _, tt := range tests {
+		if got := quote(tt.value, tt.q); got != tt.want {
+			t.Errorf("quote(%q, %q) = %q, want %q", tt.value, tt.q, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+// Package trash keeps deleted slots restorable: the worktree is moved into a
+// trash directory next to a JSON record of the slot, and a ref in the main
+// repo pins its commit until the entry is purged.
+package trash
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mauriciopiber/exceder/cli/slot-cli/pkg/registry"
+)
+
+// UndoEntry is the state needed to bring back a removed slot
+type UndoEntry struct {
+	Time     string              `json:"time"`
+	Action   string              `json:"action"` // delete, done, clean
+	MainRepo string              `json:"main_repo"`
+	SlotName string              `json:"slot_name"`
+	SlotPath string              `json:"slot_path"`
+	Branch   string              `json:"branch"`
+	SHA      string              `json:"sha"`
+	Patch    string              `json:"patch,omitempty"` // uncommitted changes, incl. untracked files
+	Slot     registry.SlotConfig `json:"slot"`
+}
+
+// Entry is a deleted slot kept in the trash: its worktree directory and
+// a ref pinning its commit, with what undelete needs to put it back
+type Entry struct {
+	UndoEntry
+	Dir string `json:"dir"` // the worktree, moved into the trash
+	Ref string `json:"ref"` // refs/slot-trash/<id> in the main repo
+}
+
+// Put moves e's worktree into dir/id, pins e.SHA with refs/slot-trash/<id>
+// and writes the entry's record next to it. On failure the worktree and
+// the ref are left as they were.
+func Put(dir, id string, e UndoEntry) (Entry, error) {
+	entry := Entry{UndoEntry: e, Dir: filepath.Join(dir, id), Ref: "refs/slot-trash/" + id}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return Entry{}, err
+	}
+	if err := exec.Command("git", "-C", e.MainRepo, "update-ref", entry.Ref, e.SHA).Run(); err != nil {
+		return Entry{}, fmt.Errorf("could not pin %.8s", e.SHA)
+	}
+	if err := MoveDir(e.SlotPath, entry.Dir); err != nil {
+		exec.Command("git", "-C", e.MainRepo, "update-ref", "-d", entry.Ref).Run()
+		return Entry{}, err
+	}
+	data, _ := json.MarshalIndent(entry, "", "  ")
+	os.WriteFile(entry.Dir+".json", data, 0600)
+	return entry, nil
+}
+
+// Load reads the entries in dir, oldest first
+func Load(dir string) []Entry {
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	var entries []Entry
+	for _, f := range files {
+		var e Entry
+		if data, err := os.ReadFile(f); err == nil && json.Unmarshal(data, &e) == nil {
+			entries = append(entries, e)
+		}
+	}
+	slices.SortFunc(entries, func(a, b Entry) int { return strings.Compare(a.Time, b.Time) })
+	return entries
+}
+
+// Expired returns the entries older than days
+func Expired(entries []Entry, days int, now time.Time) []Entry {
+	var expired []Entry
+	for _, e := range entries {
+		if t, err := time.Parse(time.RFC3339, e.Time); err == nil && now.Sub(t) > time.Duration(days)*24*time.Hour {
+			expired = append(expired, e)
+		}
+	}
+	return expired
+}
+
+// Remove deletes a trashed worktree, its record and its ref
+func Remove(e Entry) {
+	os.RemoveAll(e.Dir)
+	os.Remove(e.Dir + ".json")
+	exec.Command("git", "-C", e.MainRepo, "update-ref", "-d", e.Ref).Run()
+}
+
+// MoveDir renames src (a directory or file) to dst, copying and then removing
+// src when they're on different filesystems (the trash may not share one with
+// the worktrees). On failure src is left as it was.
+func MoveDir(src, dst string) error {
+	if os.Rename(src, dst) == nil {
+		return nil
+	}
+	if err := copyTree(src, dst); err != nil {
+		os.RemoveAll(dst)
+		return fmt.Errorf("copy failed: %w", err)
+	}
+	if err := os.RemoveAll(src); err != nil {
+		return fmt.Errorf("copied to %s but could not remove the original: %w", dst, err)
+	}
+	return nil
+}
+
+// copyTree copies a directory tree, keeping modes and symlinks
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(src, path)
+		target := filepath.Join(dst, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case d.Type().IsRegular():
+			return copyFile(path, target, info.Mode().Perm())
+		}
+		return nil // sockets and other special files aren't worth keeping
+	})
+}
+
+// copyFile copies one file (a copy-on-write clone can't cross filesystems,
+// which is the only time copyTree runs)
+func copyFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,120 @@
+package trash
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+func TestExpired(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	entry := func(name string, age time.Duration) Entry {
+		return Entry{UndoEntry: UndoEntry{SlotName: name, Time: now.Add(-age).Format(time.RFC3339)}}
+	}
+	entries := []Entry{
+		entry("app-1", 8*24*time.Hour),
+		entry("app-2", 6*24*time.Hour),
+		entry("app-3", 30*24*time.Hour),
+		{UndoEntry: UndoEntry{SlotName: "app-4", Time: "garbled"}},
+	}
+	var got []string
+	for _, e := range Expired(entries, 7, now) {
+		got = append(got, e.SlotName)
+	}
+	if want := []string{"app-1", "app-3"}; !slices.Equal(got, want) {
+		t.Errorf("Expired() = %v, want %v", got, want)
+	}
+}
+
+func TestMoveDir(t *testing.T) {
+	root := t.TempDir()
+	src := filepath.Join(root, "app-1")
+	os.MkdirAll(filepath.Join(src, "src"), 0755)
+	os.WriteFile(filepath.Join(src, "src", "main.go"), []byte("package main\n"), 0644)
+	os.WriteFile(filepath.Join(src, "run.sh"), []byte("#!/bin/sh\n"), 0755)
+	os.Symlink("src/main.go", filepath.Join(src, "link"))
+
+	// copyTree is what MoveDir falls back to across filesystems
+	copied := filepath.Join(root, "copy")
+	if err := copyTree(src, copied); err != nil {
+		t.Fatalf("copyTree: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(copied, "src", "main.go")); string(data) != "package main\n" {
+		t.Errorf("copied main.go = %q", data)
+	}
+	if info, err := os.Stat(filepath.Join(copied, "run.sh")); err != nil || info.Mode().Perm() != 0755 {
+		t.Errorf("run.sh mode = %v, %v", info, err)
+	}
+	if link, err := os.Readlink(filepath.Join(copied, "link")); err != nil || link != "src/main.go" {
+		t.Errorf("link = %q, %v", link, err)
+	}
+
+	dst := filepath.Join(root, "trash", "app-1")
+	os.MkdirAll(filepath.Dir(dst), 0700)
+	if err := MoveDir(src, dst); err != nil || exists(src) || !exists(filepath.Join(dst, "run.sh")) {
+		t.Errorf("MoveDir = %v; src exists %v", err, exists(src))
+	}
+	if err := MoveDir(filepath.Join(root, "missing"), filepath.Join(root, "x")); err == nil {
+		t.Error("MoveDir of a missing dir should fail")
+	}
+}
+
+func TestPutLoadRemove(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	root := t.TempDir()
+	mainRepo := filepath.Join(root, "app")
+	git := func(args ...string) string {
+		cmd := exec.Command("git", append([]string{"-C", mainRepo}, args...)...)
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=t", "GIT_AUTHOR_EMAIL=t@t", "GIT_COMMITTER_NAME=t", "GIT_COMMITTER_EMAIL=t@t")
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+		return string(out)
+	}
+	os.MkdirAll(mainRepo, 0755)
+	git("init", "-q")
+	git("commit", "-q", "--allow-empty", "-m", "init")
+	sha := git("rev-parse", "HEAD")[:40]
+
+	slotPath := filepath.Join(root, "app-1")
+	os.MkdirAll(slotPath, 0755)
+	os.WriteFile(filepath.Join(slotPath, "wip.txt"), []byte("wip\n"), 0644)
+
+	dir := filepath.Join(root, "trash")
+	entry, err := Put(dir, "app-1-20260310-120000", UndoEntry{
+		Time: "2026-03-10T12:00:00Z", MainRepo: mainRepo, SlotName: "app-1", SlotPath: slotPath, SHA: sha,
+	})
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if exists(slotPath) || !exists(filepath.Join(entry.Dir, "wip.txt")) {
+		t.Errorf("Put left the worktree at %s instead of moving it to %s", slotPath, entry.Dir)
+	}
+	if got := git("rev-parse", entry.Ref)[:40]; got != sha {
+		t.Errorf("%s = %s, want %s", entry.Ref, got, sha)
+	}
+
+	loaded := Load(dir)
+	if len(loaded) != 1 || loaded[0].SlotName != "app-1" || loaded[0].Dir != entry.Dir {
+		t.Fatalf("Load() = %+v, want the app-1 entry", loaded)
+	}
+
+	Remove(loaded[0])
+	if exists(entry.Dir) || exists(entry.Dir+".json") || len(Load(dir)) != 0 {
+		t.Error("Remove left the entry behind")
+	}
+	if err := exec.Command("git", "-C", mainRepo, "rev-parse", "--verify", "--quiet", entry.Ref).Run(); err == nil {
+		t.Errorf("Remove kept %s", entry.Ref)
+	}
+}
@@ -0,0 +1,139 @@
+// Package worktree locates main repositories and their slot worktrees and
+// names slots the way slot-cli does (<project>-<N|name> next to the main repo).
+package worktree
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DetectProject returns the main repository and project name for cwd, which
+// must be a main repo root or a slot worktree root ("" if neither)
+func DetectProject(cwd string) (mainRepo, project string) {
+	// Check if in worktree
+	gitFile := filepath.Join(cwd, ".git")
+	if info, err := os.Stat(gitFile); err == nil && !info.IsDir() {
+		content, _ := os.ReadFile(gitFile)
+		// Parse: gitdir: /path/to/main/.git/worktrees/name
+		line := strings.TrimSpace(string(content))
+		if strings.HasPrefix(line, "gitdir:") {
+			gitdir := filepath.ToSlash(strings.TrimSpace(strings.TrimPrefix(line, "gitdir:")))
+			// Extract main repo path
+			if idx := strings.Index(gitdir, "/.git/worktrees"); idx > 0 {
+				mainRepo = filepath.FromSlash(gitdir[:idx])
+				project = filepath.Base(mainRepo)
+				return
+			}
+		}
+	}
+
+	// Check if in main repo
+	if _, err := os.Stat(filepath.Join(cwd, ".git")); err == nil {
+		mainRepo = cwd
+		project = filepath.Base(cwd)
+		return
+	}
+
+	return "", ""
+}
+
+// NextSlotNumber returns one more than the highest numbered slot directory
+// (<project>-<N>) next to mainRepo
+func NextSlotNumber(mainRepo, project string) int {
+	parentDir := filepath.Dir(mainRepo)
+	pattern := filepath.Join(parentDir, project+"-*")
+	matches, _ := filepath.Glob(pattern)
+
+	maxNum := 0
+	re := regexp.MustCompile(`-(\d+)$`)
+	for _, m := range matches {
+		if match := re.FindStringSubmatch(filepath.Base(m)); len(match) > 1 {
+			if n, err := strconv.Atoi(match[1]); err == nil && n > maxNum {
+				maxNum = n
+			}
+		}
+	}
+	return maxNum + 1
+}
+
+// BranchName returns the branch checked out in repoPath, or "" (detached, not a repo)
+func BranchName(repoPath string) string {
+	out, err := exec.Command("git", "-C", repoPath, "branch", "--show-current").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// ResolveSlotName picks the slot a command targets: the current slot when
+// cwd is one, else the first non-flag argument as a number or name
+func ResolveSlotName(project, cwdBase string, cwdIsSlot bool, args []string) string {
+	slotName := cwdBase
+
+	if !cwdIsSlot {
+		for _, arg := range args {
+			if arg == "--force" || arg == "-f" || strings.HasPrefix(arg, "--") {
+				continue
+			}
+			if n, err := strconv.Atoi(arg); err == nil {
+				slotName = fmt.Sprintf("%s-%d", project, n)
+			} else {
+				slotName = fmt.Sprintf("%s-%s", project, arg)
+			}
+			break
+		}
+	}
+	return slotName
+}
+
+// SlotIdentifier extracts the slot number or name from a slot directory name
+func SlotIdentifier(slotName, project string) string {
+	prefix := project + "-"
+	if !strings.HasPrefix(slotName, prefix) {
+		return slotName
+	}
+	suffix := strings.TrimPrefix(slotName, prefix)
+	// Check if it's a number
+	if _, err := strconv.Atoi(suffix); err == nil {
+		return suffix
+	}
+	return suffix
+}
+
+// UnpushedCommits lists commits on branch that are neither in the main
+// worktree's branch nor on any remote
+func UnpushedCommits(mainRepo, branch string) []string {
+	if branch == "" {
+		return nil
+	}
+	out, err := exec.Command("git", "-C", mainRepo, "log", "--oneline", branch, "--not", BranchName(mainRepo), "--remotes").Output()
+	if err != nil || len(strings.TrimSpace(string(out))) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSpace(string(out)), "\n")
+}
+
+// IsTracked reports whether rel is tracked in repoPath
+func IsTracked(repoPath, rel string) bool {
+	return exec.Command("git", "-C", repoPath, "ls-files", "--error-unmatch", rel).Run() == nil
+}
+
+// IsWithin reports whether path is dir or inside it
+func IsWithin(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+// IsMerged reports whether the worktree's HEAD is already in mainRepo's
+// current branch
+func IsMerged(path, mainRepo string) bool {
+	head, err := exec.Command("git", "-C", path, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return false
+	}
+	return exec.Command("git", "-C", mainRepo, "merge-base", "--is-ancestor", strings.TrimSpace(string(head)), "HEAD").Run() == nil
+}
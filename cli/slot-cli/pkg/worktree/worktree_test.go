@@ -0,0 +1,133 @@
+package worktree
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveSlotName(t *testing.T) {
+	tests := []struct {
+		name      string
+		project   string
+		cwdBase   string
+		cwdIsSlot bool
+		args      []string
+		want      string
+	}{
+		{
+			"in slot dir, args ignored",
+			"exceder", "exceder-1", true,
+			[]string{"2"},
+			"exceder-1",
+		},
+		{
+			"numeric arg",
+			"exceder", "exceder", false,
+			[]string{"2"},
+			"exceder-2",
+		},
+		{
+			"named arg",
+			"exceder", "exceder", false,
+			[]string{"auth"},
+			"exceder-auth",
+		},
+		{
+			"flags skipped",
+			"exceder", "exceder", false,
+			[]string{"--force", "3"},
+			"exceder-3",
+		},
+		{
+			"no args, returns cwdBase",
+			"exceder", "exceder", false,
+			[]string{},
+			"exceder",
+		},
+		{
+			"double-dash flag skipped",
+			"exceder", "exceder", false,
+			[]string{"--dry-run", "auth"},
+			"exceder-auth",
+		},
+		{
+			"-f flag skipped",
+			"exceder", "exceder", false,
+			[]string{"-f", "1"},
+			"exceder-1",
+		},
+		{
+			"in slot dir with no args",
+			"exceder", "exceder-auth", true,
+			[]string{},
+			"exceder-auth",
+		},
+		{
+			"only flags, no identifier",
+			"exceder", "exceder", false,
+			[]string{"--force", "-f"},
+			"exceder",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ResolveSlotName(tt.project, tt.cwdBase, tt.cwdIsSlot, tt.args)
+			if got != tt.want {
+				t.Errorf("ResolveSlotName(%q, %q, %v, %v) = %q, want %q",
+					tt.project, tt.cwdBase, tt.cwdIsSlot, tt.args, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectProject(t *testing.T) {
+	root := t.TempDir()
+	mainRepo := filepath.Join(root, "app")
+	slot := filepath.Join(root, "app-2")
+	os.MkdirAll(filepath.Join(mainRepo, ".git", "worktrees", "app-2"), 0755)
+	os.MkdirAll(slot, 0755)
+	os.WriteFile(filepath.Join(slot, ".git"), []byte("gitdir: "+filepath.Join(mainRepo, ".git", "worktrees", "app-2")+"\n"), 0644)
+	os.MkdirAll(filepath.Join(root, "app-7"), 0755)
+
+	if repo, project := DetectProject(mainRepo); repo != mainRepo || project != "app" {
+		t.Errorf("DetectProject(main) = %q, %q", repo, project)
+	}
+	if repo, project := DetectProject(slot); repo != mainRepo || project != "app" {
+		t.Errorf("DetectProject(slot) = %q, %q", repo, project)
+	}
+	if repo, _ := DetectProject(root); repo != "" {
+		t.Errorf("DetectProject(non-repo) = %q, want \"\"", repo)
+	}
+	if n := NextSlotNumber(mainRepo, "app"); n != 8 {
+		t.Errorf("NextSlotNumber = %d, want 8", n)
+	}
+	if id := SlotIdentifier("app-auth", "app"); id != "auth" {
+		t.Errorf("SlotIdentifier(app-auth) = %q", id)
+	}
+	if !IsWithin(slot, slot) || !IsWithin(filepath.Join(slot, "src"), slot) || IsWithin(slot+"0", slot) {
+		t.Error("IsWithin misreports containment")
+	}
+}
+
+func TestIsWithin(t *testing.T) {
+	slot := filepath.Join(string(filepath.Separator)+"src", "app-1")
+	tests := []struct {
+		name string
+		path string
+		want bool
+	}{
+		{"the dir itself", slot, true},
+		{"nested", filepath.Join(slot, "src", "index.ts"), true},
+		{"sibling with the same prefix", slot + "0", false},
+		{"parent", filepath.Dir(slot), false},
+		{"unrelated", filepath.Join(string(filepath.Separator)+"tmp", "x"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsWithin(tt.path, slot); got != tt.want {
+				t.Errorf("IsWithin(%q, %q) = %v, want %v", tt.path, slot, got, tt.want)
+			}
+		})
+	}
+}